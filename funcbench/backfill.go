@@ -0,0 +1,267 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/pkg/errors"
+)
+
+// backfill runs the benchmarks on past commits and stores the results in the result cache,
+// so that benchTrend has a history of the benchmarks from the start.
+type backfill struct {
+	// Revisions is the range of commits as from..to, both included.
+	revisions string
+	// Only benchmark the commits with a tag matching the pattern when set.
+	tags string
+	// Only follow the first parent of the merge commits, the commits of the main branch.
+	firstParent bool
+	// Benchmark every nth commit of the range.
+	every int
+	// Shard as index/count, to split the commits between several runners sharing the result cache.
+	shard string
+}
+
+// shardOf parses the shard as index/count.
+func shardOf(s string) (index, count int, err error) {
+	if s == "" {
+		return 0, 1, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) == 2 {
+		index, err = strconv.Atoi(parts[0])
+		if err == nil {
+			count, err = strconv.Atoi(parts[1])
+		}
+		if err == nil && index >= 0 && index < count {
+			return index, count, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid shard %q, expected index/count with 0 <= index < count", s)
+}
+
+// commits returns the commits to benchmark, the oldest first.
+func (bf *backfill) commits(repo *git.Repository) ([]*object.Commit, error) {
+	parts := strings.Split(bf.revisions, "..")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid revision range %q, expected from..to", bf.revisions)
+	}
+	from, err := repo.ResolveRevision(plumbing.Revision(parts[0]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve %v", parts[0])
+	}
+	to, err := repo.ResolveRevision(plumbing.Revision(parts[1]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve %v", parts[1])
+	}
+
+	// The commits of the range are the ancestors of to which aren't ancestors of from, and from itself.
+	excluded := map[plumbing.Hash]bool{}
+	iter, err := repo.Log(&git.LogOptions{From: *from})
+	if err != nil {
+		return nil, errors.Wrapf(err, "log %v", parts[0])
+	}
+	if err := iter.ForEach(func(c *object.Commit) error {
+		excluded[c.Hash] = true
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "log %v", parts[0])
+	}
+	if excluded[*to] {
+		return nil, fmt.Errorf("%v is an ancestor of %v, the range is empty", parts[1], parts[0])
+	}
+
+	fromCommit, err := repo.CommitObject(*from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "commit %v", parts[0])
+	}
+	commits := []*object.Commit{fromCommit}
+	if bf.firstParent {
+		c, err := repo.CommitObject(*to)
+		for err == nil && !excluded[c.Hash] {
+			commits = append(commits, c)
+			if c.NumParents() == 0 {
+				break
+			}
+			c, err = c.Parent(0)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "log %v", parts[1])
+		}
+	} else {
+		iter, err := repo.Log(&git.LogOptions{From: *to})
+		if err != nil {
+			return nil, errors.Wrapf(err, "log %v", parts[1])
+		}
+		if err := iter.ForEach(func(c *object.Commit) error {
+			if !excluded[c.Hash] {
+				commits = append(commits, c)
+			}
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "log %v", parts[1])
+		}
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.Before(commits[j].Committer.When)
+	})
+	return bf.selectCommits(repo, commits)
+}
+
+// selectCommits keeps the tagged commits, every nth of them always including the last one,
+// and then the commits of the shard.
+func (bf *backfill) selectCommits(repo *git.Repository, commits []*object.Commit) ([]*object.Commit, error) {
+	if bf.tags != "" {
+		tagged, err := taggedCommits(repo, bf.tags)
+		if err != nil {
+			return nil, err
+		}
+		var selected []*object.Commit
+		for _, c := range commits {
+			if tagged[c.Hash] {
+				selected = append(selected, c)
+			}
+		}
+		commits = selected
+	}
+	if bf.every > 1 {
+		var selected []*object.Commit
+		for i, c := range commits {
+			if i%bf.every == 0 || i == len(commits)-1 {
+				selected = append(selected, c)
+			}
+		}
+		commits = selected
+	}
+
+	index, count, err := shardOf(bf.shard)
+	if err != nil {
+		return nil, err
+	}
+	var selected []*object.Commit
+	for i, c := range commits {
+		if i%count == index {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+// taggedCommits returns the commits with a tag matching the pattern.
+func taggedCommits(repo *git.Repository, pattern string) (map[plumbing.Hash]bool, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, errors.Wrap(err, "list tags")
+	}
+	tagged := map[plumbing.Hash]bool{}
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		ok, err := path.Match(pattern, ref.Name().Short())
+		if err != nil || !ok {
+			return err
+		}
+		// Annotated tags point to a tag object instead of the commit.
+		hash := ref.Hash()
+		if tag, err := repo.TagObject(hash); err == nil {
+			c, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = c.Hash
+		}
+		tagged[hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "match tags with %q", pattern)
+	}
+	return tagged, nil
+}
+
+// run benchmarks the commits in a worktree one after the other. The commits with results in the cache are skipped
+// and the results get the time of the commit, which benchTrend uses as the time of the run.
+// A commit which fails to benchmark, like an old commit which doesn't build, is logged and skipped.
+func (bf *backfill) run(env Environment, bench *Benchmarker) error {
+	commits, err := bf.commits(env.Repo())
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no commits to benchmark in %v", bf.revisions)
+	}
+	bench.logger.Println("Backfilling", len(commits), "commits of", bf.revisions)
+
+	wt, err := env.Repo().Worktree()
+	if err != nil {
+		return errors.Wrap(err, "worktree")
+	}
+	backfillDir := filepath.Join(wt.Filesystem.Root(), "_funcbench-backfill")
+
+	var failed []string
+	for i, c := range commits {
+		bench.logger.Println(fmt.Sprintf("[%d/%d]", i+1, len(commits)), "Benchmarking", c.Hash.String(), c.Committer.When.UTC())
+
+		if err := os.RemoveAll(backfillDir); err != nil {
+			return errors.Wrapf(err, "delete worktree at %s", backfillDir)
+		}
+		if _, err := bench.c.exec("git", "worktree", "prune"); err != nil {
+			return errors.Wrap(err, "worktree prune")
+		}
+		if _, err := bench.c.exec("git", "worktree", "add", "-f", backfillDir, c.Hash.String()); err != nil {
+			return errors.Wrapf(err, "checkout %s in worktree %s", c.Hash.String(), backfillDir)
+		}
+
+		result, err := bench.exec(backfillDir, c.Hash.String())
+		if err != nil {
+			bench.logger.Println("Skipping", c.Hash.String(), err)
+			failed = append(failed, c.Hash.String())
+			continue
+		}
+		if err := os.Chtimes(result, c.Committer.When, c.Committer.When); err != nil {
+			return err
+		}
+		if bench.history != nil {
+			if err := bench.history.save(bench.benchFunc, c.Hash.String(), result); err != nil {
+				return err
+			}
+		}
+		if bench.metrics != nil {
+			if err := bench.metrics.push(bench.benchFunc, c.Hash.String(), result, c.Committer.When); err != nil {
+				return err
+			}
+		}
+		if bench.profile {
+			if profile, err := bench.profilePath(c.Hash.String()); err == nil {
+				// The profile is only there when the benchmarks ran.
+				_ = os.Chtimes(profile, c.Committer.When, c.Committer.When)
+			}
+		}
+	}
+
+	if len(failed) == len(commits) {
+		return fmt.Errorf("all %d commits failed to benchmark", len(commits))
+	}
+	if len(failed) > 0 {
+		bench.logger.Println("Failed to benchmark", len(failed), "of", len(commits), "commits:", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -17,13 +17,15 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/pkg/errors"
 	"golang.org/x/perf/benchstat"
 )
@@ -35,34 +37,101 @@ type Benchmarker struct {
 	benchmarkArgs  []string
 	benchFunc      string
 	resultCacheDir string
+	// Additional arguments of go test like the build tags, also used to check the build.
+	goTestArgs string
+	// Directory of the benchmarked Go module, relative to the repository root.
+	moduleDir string
+
+	// Collect CPU profiles and link them in the results when published at profilesURL.
+	profile     bool
+	profilesURL string
+	// Number of functions of the diff of the profiles added to the results, none when 0.
+	profileTop int
+	// Container running the go commands, on the host when nil.
+	docker *dockerConfig
+	// Stores the results and compares them with the history of the target, when not nil.
+	history *history
+	// Pushes the new results as metrics, when not nil.
+	metrics *benchMetrics
+	// Reruns the benchmarks varying too much and reports the spread of the runs, when not nil.
+	variance *variance
+	// Additional information collected while benchmarking, posted along with the results.
+	extraInfo []string
+
+	// Significance test of the deltas and its threshold, the deltas with a p-value above alpha are reported as ~.
+	count     int
+	deltaTest benchstat.DeltaTest
+	alpha     float64
 
 	c    *commander
 	repo *git.Repository
 }
 
-func newBenchmarker(logger Logger, env Environment, c *commander, benchTime time.Duration, benchTimeout time.Duration, resultCacheDir, packagePath string) *Benchmarker {
+// goTestFlags are the flags of the go test command running the benchmarks.
+type goTestFlags struct {
+	benchTime    time.Duration
+	benchTimeout time.Duration
+	benchmem     bool
+	count        int
+	// Comma separated list of GOMAXPROCS values to run the benchmarks with, eg. 1,4.
+	cpu string
+	// Comma separated list of build tags, eg. stringlabels.
+	tags string
+	// Additional arguments of go test, parsed by the shell, eg. -tags=stringlabels.
+	args string
+}
+
+func newBenchmarker(logger Logger, env Environment, c *commander, flags goTestFlags, resultCacheDir, packagePath string) *Benchmarker {
+	// 'go test' flags: https://golang.org/cmd/go/#hdr-Testing_flags
+	args := []string{
+		// TODO(bwplotka): Allow memprofiles.
+		"go test",
+		"-mod", "vendor",
+		"-run", `"^$"`,
+		"-bench", fmt.Sprintf(`"%s"`, benchRegex(env.BenchFunc())),
+	}
+	if flags.benchmem {
+		args = append(args, "-benchmem")
+	}
+	args = append(args,
+		"-benchtime", flags.benchTime.String(),
+		"-timeout", flags.benchTimeout.String(),
+		"-count", strconv.Itoa(flags.count),
+	)
+	if flags.cpu != "" {
+		args = append(args, "-cpu", flags.cpu)
+	}
+	var buildArgs []string
+	if flags.tags != "" {
+		buildArgs = append(buildArgs, "-tags", flags.tags)
+	}
+	if flags.args != "" {
+		buildArgs = append(buildArgs, flags.args)
+	}
+	args = append(args, buildArgs...)
+	// The package path is always the last argument.
+	args = append(args, packagePath)
+
 	return &Benchmarker{
-		logger:    logger,
-		benchFunc: env.BenchFunc(),
-		benchmarkArgs: []string{
-			// TODO(bwplotka): Allow memprofiles.
-			// 'go test' flags: https://golang.org/cmd/go/#hdr-Testing_flags
-			"go test",
-			"-mod", "vendor",
-			"-run", `"^$"`,
-			"-bench", fmt.Sprintf(`"^%s$"`, env.BenchFunc()),
-			"-benchmem",
-			"-benchtime", benchTime.String(),
-			"-timeout", benchTimeout.String(),
-			packagePath,
-		},
+		logger:         logger,
+		benchFunc:      env.BenchFunc(),
+		benchmarkArgs:  args,
+		goTestArgs:     strings.Join(buildArgs, " "),
 		c:              c,
 		repo:           env.Repo(),
 		resultCacheDir: resultCacheDir,
+		count:          flags.count,
+		deltaTest:      benchstat.UTest,
+		alpha:          0.05,
 	}
 }
 
-func (b *Benchmarker) benchOutFileName(commit plumbing.Hash) (string, error) {
+// dirtySuffix is added to the hash of the HEAD commit to name the benchmarks of the uncommitted changes of the worktree.
+const dirtySuffix = "-dirty"
+
+// benchOutFileName returns the name of the results file of the revision, the hash of a commit
+// or, for the uncommitted changes, the hash of HEAD with the dirtySuffix.
+func (b *Benchmarker) benchOutFileName(rev string) (string, error) {
 	// Sanitize bench func.
 	bb := bytes.Buffer{}
 	e := base64.NewEncoder(base64.StdEncoding, &bb)
@@ -73,27 +142,41 @@ func (b *Benchmarker) benchOutFileName(commit plumbing.Hash) (string, error) {
 		return "", err
 	}
 
-	return fmt.Sprintf("%s-%s.out", bb.String(), commit.String()), nil
+	return fmt.Sprintf("%s-%s.out", bb.String(), rev), nil
 }
 
-func (b *Benchmarker) exec(pkgRoot string, commit plumbing.Hash) (string, error) {
-	fileName, err := b.benchOutFileName(commit)
+// exec runs the benchmarks of the revision checked out at pkgRoot, unless the result cache has its results.
+// The uncommitted changes always run.
+func (b *Benchmarker) exec(pkgRoot, rev string) (string, error) {
+	fileName, err := b.benchOutFileName(rev)
 	if err != nil {
 		return "", err
 	}
 
-	if _, err := ioutil.ReadFile(filepath.Join(b.resultCacheDir, fileName)); err == nil {
+	if _, err := ioutil.ReadFile(filepath.Join(b.resultCacheDir, fileName)); err == nil && !strings.HasSuffix(rev, dirtySuffix) {
 		fmt.Println("Found previous results for ", fileName, b.benchFunc, "Reusing.")
 		return filepath.Join(b.resultCacheDir, fileName), nil
 	}
 
-	// TODO Switch working directory before entering this function.
-	benchCmd := []string{"sh", "-c", strings.Join(append([]string{"cd", pkgRoot, "&&"}, b.benchmarkArgs...), " ")}
+	args := b.benchmarkArgs
+	if b.profile {
+		profile, err := b.profilePath(rev)
+		if err != nil {
+			return "", err
+		}
+		// The package path is the last argument so keep it last.
+		args = append(append(append([]string{}, args[:len(args)-1]...), "-cpuprofile", profile), args[len(args)-1])
+	}
 
-	b.logger.Println("Executing benchmark command for", commit.String(), "\n", benchCmd)
-	out, err := b.c.exec(benchCmd...)
+	b.logger.Println("Executing benchmark command for", rev)
+	out, err := b.run(pkgRoot, args)
 	if err != nil {
-		return "", errors.Wrap(err, "benchmark ended with an error.")
+		return "", err
+	}
+	if b.variance != nil {
+		if out, err = b.rerunNoisy(pkgRoot, rev, out); err != nil {
+			return "", err
+		}
 	}
 
 	fn := filepath.Join(b.resultCacheDir, fileName)
@@ -108,16 +191,336 @@ func (b *Benchmarker) exec(pkgRoot string, commit plumbing.Hash) (string, error)
 	return fn, nil
 }
 
-func (b *Benchmarker) compareSubBenchmarks(string) ([]*benchstat.Table, error) {
-	// TODO(bwplotka): Implement.
-	return nil, errors.New("not implemented")
+// run runs the benchmark command in the module of the repository checked out at pkgRoot and returns its output.
+func (b *Benchmarker) run(pkgRoot string, args []string) (string, error) {
+	moduleRoot := filepath.Join(pkgRoot, b.moduleDir)
+	if moduleRoot != filepath.Clean(pkgRoot) {
+		if _, err := os.Stat(filepath.Join(moduleRoot, "go.mod")); err != nil {
+			return "", errors.Wrapf(err, "no Go module found in %s", moduleRoot)
+		}
+	}
+
+	benchCmd, err := b.shellCommand(pkgRoot, strings.Join(args, " "))
+	if err != nil {
+		return "", err
+	}
+
+	b.logger.Println(benchCmd)
+	out, err := b.c.exec(benchCmd...)
+	if err != nil {
+		return "", errors.Wrap(err, "benchmark ended with an error.")
+	}
+	return out, nil
 }
 
-func compareBenchmarks(files ...string) ([]*benchstat.Table, error) {
-	c := &benchstat.Collection{
-		DeltaTest: benchstat.NoDeltaTest,
+// checkBuild compiles the benchmarked packages including their tests and lists their benchmarks without running anything,
+// so that a change which doesn't compile or a regex which matches no benchmark is reported before starting the long benchmarks.
+// Sub-benchmarks only exist once their benchmark runs so only the first level of the regex is checked.
+func (b *Benchmarker) checkBuild(pkgRoot string) error {
+	levels := splitBenchRegex(b.benchFunc)
+	for _, l := range levels {
+		if _, err := regexp.Compile(l); err != nil {
+			return errors.Wrapf(err, "invalid bench func regex %q", b.benchFunc)
+		}
+	}
+
+	// The package path is the last argument.
+	packagePath := b.benchmarkArgs[len(b.benchmarkArgs)-1]
+	buildCmd, err := b.shellCommand(pkgRoot, strings.Join([]string{
+		"go test", "-mod", "vendor", "-list", fmt.Sprintf(`"%s"`, anchorRegex(levels[0])), b.goTestArgs, packagePath,
+	}, " "))
+	if err != nil {
+		return err
+	}
+
+	b.logger.Println("Checking that the packages compile\n", buildCmd)
+	out, err := b.c.exec(buildCmd...)
+	if err != nil {
+		return errors.Wrap(err, "build failed")
+	}
+	benchmarks := listedBenchmarks(out)
+	if len(benchmarks) == 0 {
+		return errors.Errorf("no benchmark matches %q in %s", b.benchFunc, packagePath)
+	}
+	b.logger.Println("Benchmarks matching", b.benchFunc+":", strings.Join(benchmarks, " "))
+	return nil
+}
+
+// shellCommand returns the command running the shell command in the module of the repository checked out at pkgRoot,
+// in a container with --in-docker.
+func (b *Benchmarker) shellCommand(pkgRoot, command string) ([]string, error) {
+	moduleRoot := filepath.Join(pkgRoot, b.moduleDir)
+	if b.docker == nil {
+		return []string{"sh", "-c", strings.Join([]string{"cd", moduleRoot, "&&", command}, " ")}, nil
 	}
+	root, err := filepath.Abs(pkgRoot)
+	if err != nil {
+		return nil, err
+	}
+	mounts := []string{root}
+	if b.profile {
+		// The profiles are written to the result cache.
+		cacheDir, err := filepath.Abs(b.resultCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, cacheDir)
+	}
+	return b.docker.command(filepath.Join(root, b.moduleDir), mounts, command), nil
+}
 
+// benchRegex returns the -bench regex of go test running the benchmarks matching the bench func regex.
+// Each level of the sub-benchmarks, separated by slashes, is fully anchored, eg. BenchmarkQuery/series=.*
+func benchRegex(benchFunc string) string {
+	levels := splitBenchRegex(benchFunc)
+	for i, l := range levels {
+		levels[i] = anchorRegex(l)
+	}
+	return strings.Join(levels, "/")
+}
+
+// anchorRegex anchors the regex at both ends, the alternations are grouped so that the anchors apply to all of them.
+func anchorRegex(r string) string {
+	if strings.Contains(r, "|") {
+		return "^(?:" + r + ")$"
+	}
+	return "^" + r + "$"
+}
+
+// splitBenchRegex splits the regex into the regexes of the levels of the sub-benchmarks,
+// like go test does with the slashes which aren't in brackets or parentheses.
+func splitBenchRegex(r string) []string {
+	var (
+		levels           []string
+		brackets, parens int
+	)
+	for i := 0; i < len(r); i++ {
+		switch r[i] {
+		case '[':
+			brackets++
+		case ']':
+			if brackets > 0 {
+				brackets--
+			}
+		case '(':
+			if brackets == 0 {
+				parens++
+			}
+		case ')':
+			if brackets == 0 {
+				parens--
+			}
+		case '\\':
+			i++
+		case '/':
+			if brackets == 0 && parens == 0 {
+				levels = append(levels, r[:i])
+				r = r[i+1:]
+				i = -1
+			}
+		}
+	}
+	return append(levels, r)
+}
+
+// listedBenchmarks returns the benchmarks in the output of go test -list.
+func listedBenchmarks(out string) []string {
+	var benchmarks []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Benchmark") && !strings.ContainsAny(line, " \t") {
+			benchmarks = append(benchmarks, line)
+		}
+	}
+	return benchmarks
+}
+
+// switchToWorkTree checks out the revision in a new worktree at dir, replacing any previous one.
+func (b *Benchmarker) switchToWorkTree(dir, rev string) error {
+	// Best effort cleanup and checkout new worktree.
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrapf(err, "delete worktree at %s", dir)
+	}
+
+	// TODO (geekodour): switch to worktree remove once we decide not to support git<2.17
+	if _, err := b.c.exec("git", "worktree", "prune"); err != nil {
+		return errors.Wrap(err, "worktree prune")
+	}
+
+	b.logger.Println("Checking out (in new workdir):", dir, "commmit", rev)
+	if _, err := b.c.exec("git", "worktree", "add", "-f", dir, rev); err != nil {
+		return errors.Wrapf(err, "checkout %s in worktree %s", rev, dir)
+	}
+	return nil
+}
+
+// comparedRev is a revision checked out at dir and the results of its benchmarks.
+type comparedRev struct {
+	dir, rev, result string
+}
+
+// compareResults compares the results of the old and new revisions and adds the dependency changes
+// and the profiles of both to the extra info of the results.
+func (b *Benchmarker) compareResults(env Environment, oldRev, newRev comparedRev) ([]*benchstat.Table, error) {
+	// Compare B vs A.
+	tables, err := b.compareBenchmarks(oldRev.result, newRev.result)
+	if err != nil {
+		return nil, errors.Wrap(err, "comparing benchmarks")
+	}
+
+	// Dependency bumps often explain the benchmark differences so report them as well.
+	deps, err := dependencyDiff(filepath.Join(oldRev.dir, b.moduleDir), filepath.Join(newRev.dir, b.moduleDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "comparing dependencies")
+	}
+	if deps != "" {
+		b.extraInfo = append(b.extraInfo, fmt.Sprintf("Dependency changes:\n```\n%s\n```", deps))
+	}
+
+	if err := b.addProfileLinks(oldRev.rev, newRev.rev); err != nil {
+		return nil, errors.Wrap(err, "adding profile links")
+	}
+	if err := b.addProfileDiff(oldRev.rev, newRev.rev); err != nil {
+		return nil, errors.Wrap(err, "comparing profiles")
+	}
+	if b.variance != nil {
+		if err := b.addSpread(oldRev.result, newRev.result); err != nil {
+			return nil, errors.Wrap(err, "adding the spread of the runs")
+		}
+	}
+	if b.history != nil {
+		if err := b.addTrend(oldRev, newRev); err != nil {
+			return nil, errors.Wrap(err, "comparing with the history")
+		}
+	}
+	if b.metrics != nil {
+		if err := b.metrics.push(b.benchFunc, newRev.rev, newRev.result, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Save hashes for info about benchmark.
+	env.SetHashStrings(oldRev.rev, newRev.rev)
+	env.SetResultFiles(oldRev.result, newRev.result)
+
+	return tables, nil
+}
+
+// profilePath returns the absolute path of the CPU profile file for the given revision.
+func (b *Benchmarker) profilePath(rev string) (string, error) {
+	fileName, err := b.benchOutFileName(rev)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(b.resultCacheDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	return filepath.Abs(filepath.Join(b.resultCacheDir, strings.TrimSuffix(fileName, ".out")+".cpu.pprof"))
+}
+
+// addProfileLinks adds links to the flamegraphs of the profiles collected
+// for both commits, assuming the results directory is published at profilesURL.
+func (b *Benchmarker) addProfileLinks(oldRev, newRev string) error {
+	if !b.profile || b.profilesURL == "" {
+		return nil
+	}
+
+	links := make([]string, 0, 2)
+	for _, c := range []struct {
+		name, rev string
+	}{{"Old", oldRev}, {"New", newRev}} {
+		profile, err := b.profilePath(c.rev)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(profile); err != nil {
+			b.logger.Println("No profile found for", c.rev, "skipping the profile links.")
+			return nil
+		}
+		u := strings.TrimSuffix(b.profilesURL, "/") + "/" + url.PathEscape(filepath.Base(profile))
+		links = append(links, fmt.Sprintf("%s: [flamegraph](https://www.speedscope.app/#profileURL=%s) ([pprof](%s))", c.name, url.QueryEscape(u), u))
+	}
+	b.extraInfo = append(b.extraInfo, "CPU profiles:\n"+strings.Join(links, "\n"))
+	return nil
+}
+
+// addProfileDiff adds the functions whose time changed the most between the profiles of both commits,
+// to tell where the time moved to, not only that a benchmark got slower.
+func (b *Benchmarker) addProfileDiff(oldRev, newRev string) error {
+	if !b.profile || b.profileTop <= 0 {
+		return nil
+	}
+	oldProfile, err := b.profilePath(oldRev)
+	if err != nil {
+		return err
+	}
+	newProfile, err := b.profilePath(newRev)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{oldProfile, newProfile} {
+		if _, err := os.Stat(p); err != nil {
+			b.logger.Println("No profile found at", p, "skipping the profile diff.")
+			return nil
+		}
+	}
+	diff, err := profileDiff(oldProfile, newProfile, b.profileTop)
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		b.extraInfo = append(b.extraInfo, fmt.Sprintf("Top %d CPU time changes of the profiles (new - old):\n```\n%s```", b.profileTop, diff))
+	}
+	return nil
+}
+
+// addTrend stores the results of both revisions and adds the trend of the benchmarks
+// over the last commits of the old revision, the target, followed by the new results.
+func (b *Benchmarker) addTrend(oldRev, newRev comparedRev) error {
+	for _, r := range []comparedRev{oldRev, newRev} {
+		if err := b.history.save(b.benchFunc, r.rev, r.result); err != nil {
+			return err
+		}
+	}
+	trend, err := b.history.trend(b.repo, strings.TrimSuffix(oldRev.rev, dirtySuffix), b.benchFunc, newRev.result)
+	if err != nil {
+		return err
+	}
+	if trend != "" {
+		b.extraInfo = append(b.extraInfo, trend)
+	}
+	return nil
+}
+
+// deltaTests are the significance tests of the --delta-test flag.
+var deltaTests = map[string]benchstat.DeltaTest{
+	"utest": benchstat.UTest,
+	"ttest": benchstat.TTest,
+	"none":  nil,
+}
+
+// significance describes how the significance of the deltas is tested, for the results.
+func (b *Benchmarker) significance() string {
+	if b.deltaTest == nil {
+		return ""
+	}
+	return fmt.Sprintf("Deltas with a p-value above %v are statistically insignificant and reported as ~, ± is the variation of the %d runs.", b.alpha, b.count)
+}
+
+func (b *Benchmarker) compareBenchmarks(files ...string) ([]*benchstat.Table, error) {
+	return compareBenchmarks(b.deltaTest, b.alpha, files...)
+}
+
+// compareBenchmarks compares the results of the files with the delta test, the deltas with a p-value
+// above alpha are reported as ~. Without a delta test all the deltas are reported.
+func compareBenchmarks(deltaTest benchstat.DeltaTest, alpha float64, files ...string) ([]*benchstat.Table, error) {
+	if deltaTest == nil {
+		deltaTest = benchstat.NoDeltaTest
+	}
+	c := &benchstat.Collection{
+		Alpha:     alpha,
+		DeltaTest: deltaTest,
+	}
 	for _, file := range files {
 		f, err := os.Open(file)
 		if err != nil {
@@ -14,6 +14,9 @@ package main
 
 import (
 	"bytes"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -59,3 +62,83 @@ func formGroup(rows []*benchstat.Row) (out [][]*benchstat.Row) {
 func formatMarkdown(buf *bytes.Buffer, tables []*benchstat.Table) error {
 	return renderTemplate.Execute(buf, tables)
 }
+
+// scaleTables sets the scaler used to format the values of every table row.
+// Byte values are scaled using binary units (B, KiB, MiB...) and all other values
+// are scaled by benchstat, so that every value is shown with 3 significant figures.
+// When raw is set the values are shown unscaled so they can be consumed by other tools.
+func scaleTables(tables []*benchstat.Table, raw bool) {
+	for _, table := range tables {
+		for _, row := range table.Rows {
+			if raw {
+				row.Scaler = rawScaler
+				continue
+			}
+			// Like benchstat, use the same scaler for the whole row
+			// so that the units are consistent across the row.
+			for _, m := range row.Metrics {
+				if m.Unit != "" {
+					row.Scaler = newScaler(m.Mean, m.Unit)
+					break
+				}
+			}
+		}
+	}
+}
+
+// applyNoiseFloor reports the deltas of the old-new tables within the noise floor of the runner as unchanged.
+// The floors are the largest deltas in percent between two runs of the same code, by unit.
+func applyNoiseFloor(tables []*benchstat.Table, floors map[string]float64) {
+	for _, table := range tables {
+		if !table.OldNewDelta {
+			continue
+		}
+		for _, row := range table.Rows {
+			if row.Change == 0 || len(row.Metrics) == 0 {
+				continue
+			}
+			floor, ok := floors[row.Metrics[0].Unit]
+			if !ok || math.Abs(row.PctDelta) >= floor {
+				continue
+			}
+			row.PctDelta, row.Delta, row.Change = 0, "~", 0
+			row.Note = fmt.Sprintf("(noise ±%.1f%%)", floor)
+		}
+	}
+}
+
+// newScaler returns a scaler appropriate for formatting the value val with the given unit.
+func newScaler(val float64, unit string) benchstat.Scaler {
+	if !hasBaseUnit(unit, "B/op") && !hasBaseUnit(unit, "bytes/op") && !hasBaseUnit(unit, "bytes") {
+		return benchstat.NewScaler(val, unit)
+	}
+
+	scale, suffix := 1.0, "B"
+	for _, s := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		if val < scale*1024 {
+			break
+		}
+		scale *= 1024
+		suffix = s
+	}
+
+	format := "%.2f"
+	switch x := val / scale; {
+	case x >= 99.5:
+		format = "%.0f"
+	case x >= 9.95:
+		format = "%.1f"
+	}
+	return func(val float64) string {
+		return fmt.Sprintf(format+suffix, val/scale)
+	}
+}
+
+func rawScaler(val float64) string {
+	return strconv.FormatFloat(val, 'f', -1, 64)
+}
+
+// hasBaseUnit reports whether s has unit unit.
+func hasBaseUnit(s, unit string) bool {
+	return s == unit || strings.HasSuffix(s, "-"+unit)
+}
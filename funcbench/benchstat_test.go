@@ -15,7 +15,9 @@ package main
 import (
 	"bytes"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -31,8 +33,8 @@ Parse/expfmt-text/promtestdata.nometa.txt-4|2.39µs ± 0%|2.37µs ± 0%|~ (p=1.0
 
 Benchmark|Old alloc/op|New alloc/op|Delta
 -|-|-|-
-Respond-4|241kB ± 0%|233kB ± 0%|~ (p=1.000 n=1+1)
-RangeQuery/expr=abs(a_one),steps=1000-4|41.4kB ± 0%|41.4kB ± 0%|~ (p=1.000 n=1+1)
+Respond-4|236KiB ± 0%|227KiB ± 0%|~ (p=1.000 n=1+1)
+RangeQuery/expr=abs(a_one),steps=1000-4|40.4KiB ± 0%|40.5KiB ± 0%|~ (p=1.000 n=1+1)
 Parse/expfmt-text/promtestdata.nometa.txt-4|921B ± 0%|922B ± 0%|~ (p=1.000 n=1+1)
 
 Benchmark|Old allocs/op|New allocs/op|Delta
@@ -56,6 +58,43 @@ BenchmarkParse/expfmt-text/promtestdata.nometa.txt-4
 	c.AddConfig("file2", []byte(file2))
 
 	tables := c.Tables()
+	scaleTables(tables, false)
+	var buf bytes.Buffer
+	_ = formatMarkdown(&buf, tables)
+	out := buf.String()
+	if strings.Compare(expected, strings.TrimSpace(out)) != 0 {
+		t.Errorf("Expected:\n%s, but got:\n%s", expected, out)
+	}
+
+	scaleTables(tables, true)
+	buf.Reset()
+	_ = formatMarkdown(&buf, tables)
+	if expected := "Respond-4|1691189 ± 0%|1751880 ± 0%|~ (p=1.000 n=1+1)"; !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected raw values:\n%s, but got:\n%s", expected, buf.String())
+	}
+}
+
+func TestFormatMarkdownCustomMetrics(t *testing.T) {
+	expected := `Benchmark|Old time/op|New time/op|Delta
+-|-|-|-
+Compaction-4|1.69s ± 0%|1.75s ± 0%|~ (p=1.000 n=1+1)
+
+Benchmark|Old samples/s|New samples/s|Delta
+-|-|-|-
+Compaction-4|1.24M ± 0%|1.31M ± 0%|~ (p=1.000 n=1+1)
+
+Benchmark|Old compactions|New compactions|Delta
+-|-|-|-
+Compaction-4|12.0 ± 0%|10.0 ± 0%|~ (p=1.000 n=1+1)`
+	file1 := `BenchmarkCompaction-4	1	1691189000 ns/op	1240000 samples/s	12 compactions`
+	file2 := `BenchmarkCompaction-4	1	1751880000 ns/op	1310000 samples/s	10 compactions`
+	c := &benchstat.Collection{}
+
+	c.AddConfig("file1", []byte(file1))
+	c.AddConfig("file2", []byte(file2))
+
+	tables := c.Tables()
+	scaleTables(tables, false)
 	var buf bytes.Buffer
 	_ = formatMarkdown(&buf, tables)
 	out := buf.String()
@@ -93,7 +132,94 @@ BenchmarkIsolation/100-8	39044	28747 ns/op	6 B/op	0 allocs/op
 		names = append(names, f)
 	}
 
-	if _, err := compareBenchmarks(names...); err == nil || !strings.Contains(err.Error(), "match any") {
+	if _, err := compareBenchmarks(benchstat.UTest, 0.05, names...); err == nil || !strings.Contains(err.Error(), "match any") {
 		t.Error("Should return an error indicated that no matching benchmarks found.")
 	}
 }
+
+func TestApplyNoiseFloor(t *testing.T) {
+	c := &benchstat.Collection{DeltaTest: benchstat.NoDeltaTest}
+	c.AddConfig("old", []byte("BenchmarkQuery-4	100	1000 ns/op	64 B/op\nBenchmarkParse-4	100	500 ns/op	32 B/op"))
+	c.AddConfig("new", []byte("BenchmarkQuery-4	100	1030 ns/op	70 B/op\nBenchmarkParse-4	100	600 ns/op	32 B/op"))
+	tables := c.Tables()
+	applyNoiseFloor(tables, map[string]float64{"ns/op": 5})
+
+	var buf bytes.Buffer
+	_ = formatMarkdown(&buf, tables)
+	for _, expected := range []string{
+		"Query-4|1.00µs ± 0%|1.03µs ± 0%|~ (noise ±5.0%)",
+		"Parse-4|500ns ± 0%|600ns ± 0%|+20.00%",
+		// There is no floor of the unit.
+		"Query-4|64.0B ± 0%|70.0B ± 0%|+9.38%",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestCompareBenchmarksSignificance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_significance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Query got slower in every run, the runs of Parse overlap.
+	oldRuns := `BenchmarkQuery-4	100	1000 ns/op
+BenchmarkQuery-4	100	1010 ns/op
+BenchmarkQuery-4	100	990 ns/op
+BenchmarkQuery-4	100	1005 ns/op
+BenchmarkQuery-4	100	995 ns/op
+BenchmarkQuery-4	100	1000 ns/op
+BenchmarkParse-4	100	500 ns/op
+BenchmarkParse-4	100	600 ns/op
+BenchmarkParse-4	100	450 ns/op
+BenchmarkParse-4	100	550 ns/op
+BenchmarkParse-4	100	500 ns/op
+BenchmarkParse-4	100	520 ns/op`
+	newRuns := `BenchmarkQuery-4	100	1200 ns/op
+BenchmarkQuery-4	100	1210 ns/op
+BenchmarkQuery-4	100	1190 ns/op
+BenchmarkQuery-4	100	1205 ns/op
+BenchmarkQuery-4	100	1195 ns/op
+BenchmarkQuery-4	100	1200 ns/op
+BenchmarkParse-4	100	560 ns/op
+BenchmarkParse-4	100	460 ns/op
+BenchmarkParse-4	100	610 ns/op
+BenchmarkParse-4	100	510 ns/op
+BenchmarkParse-4	100	540 ns/op
+BenchmarkParse-4	100	580 ns/op`
+	names := []string{filepath.Join(dir, "old"), filepath.Join(dir, "new")}
+	for i, content := range []string{oldRuns, newRuns} {
+		if err := ioutil.WriteFile(names[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tables, err := compareBenchmarks(benchstat.UTest, 0.05, names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = formatMarkdown(&buf, tables)
+	for _, expected := range []string{
+		"Query-4|1.00µs ± 1%|1.20µs ± 1%|+20.00% (p=0.002 n=6+6)",
+		"Parse-4|520ns ±15%|543ns ±15%|~ (p=0.370 n=6+6)",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, buf.String())
+		}
+	}
+	if got, expected := regressions(tables, 1), []string{"Query-4 time/op +20.00%"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected only the significant regression %v, got %v", expected, got)
+	}
+
+	tables, err = compareBenchmarks(nil, 0.05, names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := regressions(tables, 1); len(got) != 2 {
+		t.Errorf("expected every delta to count without a delta test, got %v", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// calibration measures the noise floor of a runner by running the same benchmarks several times.
+type calibration struct {
+	runs int
+	// File to write the noise floor to.
+	file string
+}
+
+// noiseFloor is the variance between the runs of the same benchmarks on a runner.
+type noiseFloor struct {
+	Host      string    `json:"host"`
+	CPUs      int       `json:"cpus"`
+	GoVersion string    `json:"goVersion"`
+	Commit    string    `json:"commit"`
+	BenchFunc string    `json:"benchFunc"`
+	Runs      int       `json:"runs"`
+	Time      time.Time `json:"time"`
+	// Floors are the largest deltas in percent between two runs of a benchmark, by unit.
+	Floors map[string]float64 `json:"floors"`
+}
+
+// loadNoiseFloor reads the noise floor written by calibrate, nil when there is none.
+func loadNoiseFloor(file string) (*noiseFloor, error) {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	nf := &noiseFloor{}
+	if err := json.Unmarshal(content, nf); err != nil {
+		return nil, errors.Wrapf(err, "parsing the noise floor %s", file)
+	}
+	return nf, nil
+}
+
+// String describes the noise floor for the results.
+func (nf *noiseFloor) String() string {
+	units := make([]string, 0, len(nf.Floors))
+	for u := range nf.Floors {
+		units = append(units, u)
+	}
+	sort.Strings(units)
+	floors := make([]string, 0, len(units))
+	for _, u := range units {
+		floors = append(floors, fmt.Sprintf("%s ±%.1f%%", u, nf.Floors[u]))
+	}
+	return fmt.Sprintf("Deltas below the noise floor of the runner are reported as ~: %s (%d runs of %s on %s, %s)",
+		strings.Join(floors, ", "), nf.Runs, nf.BenchFunc, nf.Host, nf.Time.Format("2006-01-02"))
+}
+
+// benchmarkNoise is the largest delta between two runs of a benchmark.
+type benchmarkNoise struct {
+	benchmark, unit string
+	mean, delta     float64
+}
+
+// measureNoise returns the largest delta between the runs of every benchmark, in percent.
+// The results of each run are the output of go test -bench.
+func measureNoise(results []string) []benchmarkNoise {
+	c := &benchstat.Collection{}
+	for i, r := range results {
+		c.AddConfig(fmt.Sprintf("run %d", i+1), []byte(r))
+	}
+	// Compute the statistics of the metrics.
+	c.Tables()
+
+	var noise []benchmarkNoise
+	for _, unit := range c.Units {
+		for _, group := range c.Groups {
+			for _, benchmark := range c.Benchmarks[group] {
+				min, max, sum, n := math.Inf(1), math.Inf(-1), 0.0, 0
+				for _, config := range c.Configs {
+					m := c.Metrics[benchstat.Key{Config: config, Group: group, Benchmark: benchmark, Unit: unit}]
+					if m == nil || len(m.RValues) == 0 {
+						continue
+					}
+					min, max = math.Min(min, m.Mean), math.Max(max, m.Mean)
+					sum += m.Mean
+					n++
+				}
+				if n < 2 {
+					continue
+				}
+				bn := benchmarkNoise{benchmark: benchmark, unit: unit, mean: sum / float64(n)}
+				if min > 0 {
+					bn.delta = (max/min - 1) * 100
+				}
+				noise = append(noise, bn)
+			}
+		}
+	}
+	return noise
+}
+
+// run runs the benchmarks of the current commit several times and writes their noise floor,
+// the largest delta between two runs of any benchmark of each unit.
+func (cal *calibration) run(env Environment, bench *Benchmarker) error {
+	if cal.runs < 2 {
+		return fmt.Errorf("at least 2 runs are needed to measure the noise, got %d", cal.runs)
+	}
+	wt, err := env.Repo().Worktree()
+	if err != nil {
+		return errors.Wrap(err, "worktree")
+	}
+	ref, err := env.Repo().Head()
+	if err != nil {
+		return errors.Wrap(err, "get head")
+	}
+	if err := bench.checkBuild(wt.Filesystem.Root()); err != nil {
+		return err
+	}
+
+	results := make([]string, 0, cal.runs)
+	for i := 0; i < cal.runs; i++ {
+		bench.logger.Println(fmt.Sprintf("[%d/%d]", i+1, cal.runs), "Calibrating on", ref.Hash().String())
+		out, err := bench.run(wt.Filesystem.Root(), bench.benchmarkArgs)
+		if err != nil {
+			return err
+		}
+		results = append(results, out)
+	}
+
+	noise := measureNoise(results)
+	if len(noise) == 0 {
+		return errors.New("didn't match any existing benchmarks")
+	}
+	goVersion, err := bench.c.exec("go", "version")
+	if err != nil {
+		return errors.Wrap(err, "go version")
+	}
+	nf := &noiseFloor{
+		CPUs:      runtime.NumCPU(),
+		GoVersion: strings.TrimSpace(goVersion),
+		Commit:    ref.Hash().String(),
+		BenchFunc: env.BenchFunc(),
+		Runs:      cal.runs,
+		Time:      time.Now().UTC(),
+		Floors:    map[string]float64{},
+	}
+	nf.Host, _ = os.Hostname()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "BENCHMARK\tUNIT\tMEAN\tMAX DELTA")
+	for _, n := range noise {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f%%\n", n.benchmark, n.unit, benchstat.NewScaler(n.mean, n.unit)(n.mean), n.delta)
+		if n.delta > nf.Floors[n.unit] {
+			nf.Floors[n.unit] = n.delta
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(nf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cal.file), os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(cal.file, content, 0644); err != nil {
+		return err
+	}
+	bench.logger.Println(nf.String(), "\nWritten to", cal.file)
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeasureNoise(t *testing.T) {
+	noise := measureNoise([]string{
+		"BenchmarkQuery-4	100	1000 ns/op	64 B/op	2 allocs/op\nBenchmarkParse-4	100	500 ns/op	32 B/op	1 allocs/op",
+		"BenchmarkQuery-4	100	1100 ns/op	64 B/op	2 allocs/op\nBenchmarkParse-4	100	490 ns/op	32 B/op	1 allocs/op",
+		"BenchmarkQuery-4	100	1050 ns/op	64 B/op	2 allocs/op\nBenchmarkParse-4	100	510 ns/op	32 B/op	1 allocs/op",
+	})
+	expected := map[string]float64{
+		"Query-4 ns/op":     10,
+		"Parse-4 ns/op":     100 * (510.0/490 - 1),
+		"Query-4 B/op":      0,
+		"Parse-4 allocs/op": 0,
+	}
+	got := map[string]float64{}
+	for _, n := range noise {
+		got[n.benchmark+" "+n.unit] = n.delta
+	}
+	for k, v := range expected {
+		if d, ok := got[k]; !ok || math.Abs(d-v) > 1e-9 {
+			t.Errorf("%s: expected a delta of %v, got %v", k, v, got[k])
+		}
+	}
+	if len(got) != 6 {
+		t.Errorf("expected the noise of 6 benchmark units, got %v", got)
+	}
+
+	if noise := measureNoise([]string{"BenchmarkQuery-4	100	1000 ns/op"}); len(noise) != 0 {
+		t.Errorf("expected no noise of a single run, got %v", noise)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// checkRun reports the results of a PR as a check run, which shows in the checks tab of the PR
+// and can be required to merge it.
+type checkRun struct {
+	name string
+	// The conclusion is failure when a benchmark regresses by more than this percent,
+	// in the given metrics or all of them when none are given.
+	maxRegression float64
+	metrics       []string
+
+	id int64
+}
+
+const (
+	// The size limits of the output of a check run.
+	maxCheckRunText        = 65535
+	maxCheckRunAnnotations = 50
+)
+
+// checkConclusion returns the conclusion of the check run and its title: failure when a benchmark regressed
+// by more than the max regression in the metrics, neutral when some regressed by less, success otherwise.
+func checkConclusion(tables []*benchstat.Table, max float64, metrics ...string) (conclusion, title string) {
+	if regressed := regressions(tables, max, metrics...); len(regressed) > 0 {
+		return "failure", fmt.Sprintf("%d benchmarks regressed by more than %.1f%%", len(regressed), max)
+	}
+	if regressed := regressions(tables, 0); len(regressed) > 0 {
+		return "neutral", fmt.Sprintf("%d benchmarks regressed by less than %.1f%%", len(regressed), max)
+	}
+	return "success", fmt.Sprintf("No benchmark regressed by more than %.1f%%", max)
+}
+
+// output returns the conclusion and the output of the check run with the results, the regressions are annotated
+// on the benchmark functions in the worktree at root.
+func (c *checkRun) output(root string, tables []*benchstat.Table, summary string, extraInfo ...string) (conclusion string, output *github.CheckRunOutput, err error) {
+	conclusion, title := checkConclusion(tables, c.maxRegression, c.metrics...)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n", strings.Join(extraInfo, "\n"))
+	if err := formatMarkdown(&b, tables); err != nil {
+		return "", nil, err
+	}
+	text := b.String()
+	if len(text) > maxCheckRunText {
+		text = text[:maxCheckRunText-len("\n...")] + "\n..."
+	}
+
+	annotations, err := c.regressionAnnotations(root, tables)
+	if err != nil {
+		return "", nil, err
+	}
+	return conclusion, &github.CheckRunOutput{
+		Title:       github.String(title),
+		Summary:     github.String(summary),
+		Text:        github.String(text),
+		Annotations: annotations,
+	}, nil
+}
+
+// procsSuffix is the GOMAXPROCS suffix go test adds to the names of the benchmarks.
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// regressionAnnotations annotates the functions of the regressed benchmarks, as a failure when they fail the check run
+// and a warning otherwise. The benchmarks which aren't found aren't annotated.
+func (c *checkRun) regressionAnnotations(root string, tables []*benchstat.Table) ([]*github.CheckRunAnnotation, error) {
+	var annotations []*github.CheckRunAnnotation
+	var funcs map[string]benchmarkFunc
+	for _, table := range tables {
+		if !table.OldNewDelta {
+			continue
+		}
+		for _, row := range table.Rows {
+			if row.Change >= 0 || len(annotations) == maxCheckRunAnnotations {
+				continue
+			}
+			if funcs == nil {
+				var err error
+				if funcs, err = benchmarkFuncs(root); err != nil {
+					return nil, err
+				}
+			}
+			name := "Benchmark" + strings.SplitN(procsSuffix.ReplaceAllString(row.Benchmark, ""), "/", 2)[0]
+			f, ok := funcs[name]
+			if !ok {
+				continue
+			}
+			level := "warning"
+			if hasMetric(c.metrics, table.Metric) && (row.PctDelta > c.maxRegression || row.PctDelta < -c.maxRegression) {
+				level = "failure"
+			}
+			annotations = append(annotations, &github.CheckRunAnnotation{
+				Path:            github.String(f.path),
+				StartLine:       github.Int(f.line),
+				EndLine:         github.Int(f.line),
+				AnnotationLevel: github.String(level),
+				Title:           github.String(fmt.Sprintf("%s regressed", row.Benchmark)),
+				Message:         github.String(fmt.Sprintf("%s %s %s", row.Benchmark, table.Metric, row.Delta)),
+			})
+		}
+	}
+	return annotations, nil
+}
+
+// benchmarkFunc is the declaration of a benchmark function, the path is relative to the root of the repository.
+type benchmarkFunc struct {
+	path string
+	line int
+}
+
+// benchmarkFuncRe matches the declaration of a benchmark function.
+var benchmarkFuncRe = regexp.MustCompile(`^func (Benchmark\w*)\(`)
+
+// benchmarkFuncs returns the benchmark functions declared in the test files of the worktree at root.
+// A function declared in several packages is the first one found.
+func benchmarkFuncs(root string) (map[string]benchmarkFunc, error) {
+	funcs := map[string]benchmarkFunc{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Skip the worktrees of the compared commits and the dependencies.
+			if path != root && (strings.HasPrefix(info.Name(), ".") || strings.HasPrefix(info.Name(), "_funcbench") || info.Name() == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		s := bufio.NewScanner(f)
+		for line := 1; s.Scan(); line++ {
+			if m := benchmarkFuncRe.FindStringSubmatch(s.Text()); m != nil {
+				if _, ok := funcs[m[1]]; !ok {
+					funcs[m[1]] = benchmarkFunc{path: filepath.ToSlash(rel), line: line}
+				}
+			}
+		}
+		return s.Err()
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "finding the benchmark functions")
+	}
+	return funcs, nil
+}
+
+// createCheckRun creates the check run of the commit, in progress until it is completed.
+func (c *gitHubClient) createCheckRun(name, headSHA string) (int64, error) {
+	run, _, err := c.client.Checks.CreateCheckRun(c.ctx, c.owner, c.repo, github.CreateCheckRunOptions{
+		Name:      name,
+		HeadSHA:   headSHA,
+		Status:    github.String("in_progress"),
+		StartedAt: &github.Timestamp{Time: time.Now()},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "create check run")
+	}
+	return run.GetID(), nil
+}
+
+// completeCheckRun completes the check run with the conclusion and the output.
+func (c *gitHubClient) completeCheckRun(id int64, name, conclusion string, output *github.CheckRunOutput) error {
+	_, _, err := c.client.Checks.UpdateCheckRun(c.ctx, c.owner, c.repo, id, github.UpdateCheckRunOptions{
+		Name:        name,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output:      output,
+	})
+	return errors.Wrap(err, "complete check run")
+}
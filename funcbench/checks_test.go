@@ -0,0 +1,94 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/perf/benchstat"
+)
+
+func TestCheckRunOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_check_run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for file, content := range map[string]string{
+		"promql/engine_test.go":                "package promql\n\nimport \"testing\"\n\nfunc BenchmarkQuery(b *testing.B) {\n}\n",
+		"promql/parser/parse_test.go":          "package parser\n\nfunc TestParse(t *testing.T) {}\n\nfunc BenchmarkParse(b *testing.B) {}\n",
+		"_funcbench-cmp/promql/engine_test.go": "package promql\n\nfunc BenchmarkQuery(b *testing.B) {}\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &benchstat.Collection{DeltaTest: benchstat.NoDeltaTest}
+	c.AddConfig("old", []byte("BenchmarkQuery/series=1-4	100	1000 ns/op	64 B/op\nBenchmarkParse-4	100	500 ns/op	32 B/op\nBenchmarkMissing-4	100	500 ns/op	32 B/op"))
+	c.AddConfig("new", []byte("BenchmarkQuery/series=1-4	100	1200 ns/op	64 B/op\nBenchmarkParse-4	100	400 ns/op	34 B/op\nBenchmarkMissing-4	100	600 ns/op	32 B/op"))
+	tables := c.Tables()
+
+	check := &checkRun{maxRegression: 10}
+	conclusion, output, err := check.output(dir, tables, "summary", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conclusion != "failure" || output.GetTitle() != "2 benchmarks regressed by more than 10.0%" {
+		t.Errorf("unexpected conclusion %q: %q", conclusion, output.GetTitle())
+	}
+	if output.GetSummary() != "summary" || !strings.HasPrefix(output.GetText(), "info\n") || !strings.Contains(output.GetText(), "Query/series=1-4") {
+		t.Errorf("unexpected output:\n%s\n%s", output.GetSummary(), output.GetText())
+	}
+
+	var got []string
+	for _, a := range output.Annotations {
+		got = append(got, fmt.Sprintf("%s:%d %s %s", a.GetPath(), a.GetStartLine(), a.GetAnnotationLevel(), a.GetMessage()))
+	}
+	expected := []string{
+		"promql/engine_test.go:5 failure Query/series=1-4 time/op +20.00%",
+		"promql/parser/parse_test.go:5 warning Parse-4 alloc/op +6.25%",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the annotations:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	// With --fail-on-regression only the time and allocs count.
+	check = &checkRun{maxRegression: 5, metrics: gatedMetrics}
+	annotations, err := check.regressionAnnotations(dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 2 || annotations[0].GetAnnotationLevel() != "failure" || annotations[1].GetAnnotationLevel() != "warning" {
+		t.Errorf("expected the alloc/op regression as a warning, got %v", annotations)
+	}
+
+	if conclusion, _ := checkConclusion(tables, 25); conclusion != "neutral" {
+		t.Errorf("expected a neutral conclusion below the max regression, got %q", conclusion)
+	}
+	c = &benchstat.Collection{DeltaTest: benchstat.NoDeltaTest}
+	c.AddConfig("old", []byte("BenchmarkQuery-4	100	1000 ns/op"))
+	c.AddConfig("new", []byte("BenchmarkQuery-4	100	900 ns/op"))
+	if conclusion, title := checkConclusion(c.Tables(), 10); conclusion != "success" || title != "No benchmark regressed by more than 10.0%" {
+		t.Errorf("expected a success without regressions, got %q: %q", conclusion, title)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// commentTemplates holds the golang templates used for every comment posted by funcbench.
+// An empty template disables the corresponding comment.
+type commentTemplates struct {
+	Start       string `yaml:"start"`
+	Progress    string `yaml:"progress"`
+	SetupError  string `yaml:"setup_error"`
+	SyntaxError string `yaml:"syntax_error"`
+	Error       string `yaml:"error"`
+	Results     string `yaml:"results"`
+}
+
+var defaultCommentTemplates = commentTemplates{
+	SetupError: "{{ .Error }}. Could not setup environment, please check logs.",
+	SyntaxError: "Incorrect funcbench syntax: {{ .Error }}.\n\nThe syntax is `" + commentSyntax + "`, " +
+		"please find the [examples here](https://github.com/prometheus/test-infra/tree/master/funcbench#triggering-with-github-comments).",
+	Error: "Old: `{{ .Target }}`\nNew: `PR-{{ .PR }}`\n" +
+		"{{ .ExtraInfo }}\nError:\n```\n{{ .Error }}\n```",
+	Results: "{{ with .Tier }}Results of the `{{ . }}` benchmark tier{{ with $.TierDescription }}: {{ . }}{{ end }}\n\n{{ end }}" +
+		"<details><summary>Click to check benchmark result</summary>\n\n" +
+		"Old: `{{ .Target }}`/`{{ .TargetHash }}`\nNew: `PR-{{ .PR }}`/`{{ .HeadHash }}`\n" +
+		"{{ .ExtraInfo }}\n{{ .Results }}</details>",
+}
+
+// commentData is the data passed when executing the comment templates.
+type commentData struct {
+	Owner      string
+	Repo       string
+	PR         int
+	Target     string
+	TargetHash string
+	HeadHash   string
+	ExtraInfo  string
+	// Progress is the step of the benchmark which is starting.
+	Progress string
+	Error    string
+	Results  string
+	// Tier and its description when benchmarking a tier of the repository.
+	Tier            string
+	TierDescription string
+}
+
+// loadCommentTemplates returns the default comment templates
+// with any template set in the given yaml file overriding the default one.
+func loadCommentTemplates(file string) (*commentTemplates, error) {
+	t := defaultCommentTemplates
+	if file == "" {
+		return &t, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading comment templates file %s", file)
+	}
+	// Unmarshaling over the defaults keeps the templates missing from the file
+	// and applies the empty ones, which disable their comment.
+	if err := yaml.UnmarshalStrict(content, &t); err != nil {
+		return nil, errors.Wrapf(err, "parsing comment templates file %s", file)
+	}
+
+	// Validate all templates upfront so that a broken override
+	// is caught before starting a long benchmark.
+	for name, text := range map[string]string{
+		"start":        t.Start,
+		"progress":     t.Progress,
+		"setup_error":  t.SetupError,
+		"syntax_error": t.SyntaxError,
+		"error":        t.Error,
+		"results":      t.Results,
+	} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s comment template", name)
+		}
+	}
+	return &t, nil
+}
+
+// renderComment executes the comment template with the given data.
+func renderComment(text string, data commentData) (string, error) {
+	var buf bytes.Buffer
+	t, err := template.New("comment").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
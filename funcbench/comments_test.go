@@ -0,0 +1,95 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCommentTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_comment_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "comments.yml")
+	if err := ioutil.WriteFile(file, []byte("start: 'Benchmark of PR-{{ .PR }} versus `{{ .Target }}` started.'\nprogress: 'Starting the {{ .Progress }}.'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	comments, err := loadCommentTemplates(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments.Results != defaultCommentTemplates.Results {
+		t.Errorf("results template should not be overridden, got:\n%s", comments.Results)
+	}
+
+	data := commentData{PR: 35, Target: "master", TargetHash: "abc", HeadHash: "def", ExtraInfo: "info", Progress: "benchmark of master", Results: "table", Error: "failed"}
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{
+			template: comments.Start,
+			expected: "Benchmark of PR-35 versus `master` started.",
+		},
+		{
+			template: comments.Progress,
+			expected: "Starting the benchmark of master.",
+		},
+		{
+			template: comments.Error,
+			expected: "Old: `master`\nNew: `PR-35`\ninfo\nError:\n```\nfailed\n```",
+		},
+		{
+			template: comments.Results,
+			expected: "<details><summary>Click to check benchmark result</summary>\n\nOld: `master`/`abc`\nNew: `PR-35`/`def`\ninfo\ntable</details>",
+		},
+	}
+	for _, tc := range testCases {
+		got, err := renderComment(tc.template, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, got)
+		}
+	}
+
+	// An empty template disables its comment.
+	if err := ioutil.WriteFile(file, []byte("setup_error: ''\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	comments, err = loadCommentTemplates(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comments.SetupError != "" {
+		t.Errorf("setup error template should be disabled, got:\n%s", comments.SetupError)
+	}
+	if comments.Error != defaultCommentTemplates.Error {
+		t.Errorf("error template should not be overridden, got:\n%s", comments.Error)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("results: '{{ .Results '\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCommentTemplates(file); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// splitRefs parses the refs to compare given as old..new.
+func splitRefs(refs string) (oldRef, newRef string, err error) {
+	parts := strings.Split(refs, "..")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid refs %q, expected old..new", refs)
+	}
+	return parts[0], parts[1], nil
+}
+
+// compareRefs returns the comparison of the benchmarks of two refs given as old..new.
+// Both refs are checked out in their own worktree so that, unlike startBenchmark,
+// the current worktree and its changes don't matter, eg. to bisect a regression between releases.
+func compareRefs(env Environment, bench *Benchmarker, refs string) ([]*benchstat.Table, error) {
+	oldRef, newRef, err := splitRefs(refs)
+	if err != nil {
+		return nil, err
+	}
+	oldCommit, err := resolveTarget(env.Repo(), oldRef)
+	if err != nil {
+		return nil, err
+	}
+	newCommit, err := resolveTarget(env.Repo(), newRef)
+	if err != nil {
+		return nil, err
+	}
+	if oldCommit == newCommit {
+		return nil, fmt.Errorf("%s and %s are the same commit %s; No changes would be expected; Aborting", oldRef, newRef, oldCommit)
+	}
+	bench.logger.Println("Comparing", oldRef, oldCommit.String(), "with", newRef, newCommit.String())
+
+	wt, err := env.Repo().Worktree()
+	if err != nil {
+		return nil, errors.Wrap(err, "worktree")
+	}
+	newWorkTreeDir := filepath.Join(wt.Filesystem.Root(), "_funcbench-new")
+	oldWorkTreeDir := filepath.Join(wt.Filesystem.Root(), "_funcbench-cmp")
+
+	// Execute benchmark A, failing fast when it doesn't compile.
+	if err := bench.switchToWorkTree(newWorkTreeDir, newCommit.String()); err != nil {
+		return nil, err
+	}
+	if err := bench.checkBuild(newWorkTreeDir); err != nil {
+		return nil, err
+	}
+	newResult, err := bench.exec(newWorkTreeDir, newCommit.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "execute benchmark for A: %v", newRef)
+	}
+
+	// Execute benchmark B.
+	if err := bench.switchToWorkTree(oldWorkTreeDir, oldCommit.String()); err != nil {
+		return nil, err
+	}
+	oldResult, err := bench.exec(oldWorkTreeDir, oldCommit.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "execute benchmark for B: %v", oldRef)
+	}
+
+	return bench.compareResults(env, comparedRev{oldWorkTreeDir, oldCommit.String(), oldResult}, comparedRev{newWorkTreeDir, newCommit.String(), newResult})
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+func TestCompareRefs(t *testing.T) {
+	for refs, expected := range map[string][2]string{
+		"v2.19.0..v2.20.0":   {"v2.19.0", "v2.20.0"},
+		"6ecf0ef..origin/rc": {"6ecf0ef", "origin/rc"},
+	} {
+		oldRef, newRef, err := splitRefs(refs)
+		if err != nil || oldRef != expected[0] || newRef != expected[1] {
+			t.Errorf("expected %v for %s, got %s, %s, %v", expected, refs, oldRef, newRef, err)
+		}
+	}
+
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := git.Open(sto, f.DotGit())
+	if err != nil {
+		t.Fatalf("error when open repository: %s", err)
+	}
+	env := &Local{repo: r}
+	for refs, expected := range map[string]string{
+		"master":           "invalid refs",
+		"master..":         "invalid refs",
+		"a..b..c":          "invalid refs",
+		"master..notFound": "cannot find target notFound",
+		"master..v1.0.0":   "are the same commit",
+	} {
+		if _, err := compareRefs(env, &Benchmarker{}, refs); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error with %q for %s, got %v", expected, refs, err)
+		}
+	}
+}
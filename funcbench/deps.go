@@ -0,0 +1,127 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// dependencyDiff returns the dependency changes between the go.mod and go.sum files
+// of the old and new module directories, or an empty string when they are the same.
+func dependencyDiff(oldDir, newDir string) (string, error) {
+	oldMod, err := readOptionalFile(filepath.Join(oldDir, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	newMod, err := readOptionalFile(filepath.Join(newDir, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	oldSum, err := readOptionalFile(filepath.Join(oldDir, "go.sum"))
+	if err != nil {
+		return "", err
+	}
+	newSum, err := readOptionalFile(filepath.Join(newDir, "go.sum"))
+	if err != nil {
+		return "", err
+	}
+
+	changes, err := requireChanges(oldMod, newMod)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		if bytes.Equal(oldSum, newSum) {
+			return "", nil
+		}
+		changes = append(changes, "go.sum changed")
+	}
+	return strings.Join(changes, "\n"), nil
+}
+
+// requireChanges returns the added, removed, updated and replaced modules between two go.mod files.
+func requireChanges(oldMod, newMod []byte) ([]string, error) {
+	oldReqs, err := modRequirements(oldMod)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing old go.mod")
+	}
+	newReqs, err := modRequirements(newMod)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing new go.mod")
+	}
+
+	var changes []string
+	for path, newVersion := range newReqs {
+		oldVersion, ok := oldReqs[path]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s %s", path, newVersion))
+		case oldVersion != newVersion:
+			changes = append(changes, fmt.Sprintf("~ %s %s => %s", path, oldVersion, newVersion))
+		}
+	}
+	for path, oldVersion := range oldReqs {
+		if _, ok := newReqs[path]; !ok {
+			changes = append(changes, fmt.Sprintf("- %s %s", path, oldVersion))
+		}
+	}
+	// Sort by module path.
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	return changes, nil
+}
+
+// modRequirements returns the versions of the required modules, taking the replace directives into account.
+func modRequirements(content []byte) (map[string]string, error) {
+	reqs := map[string]string{}
+	if content == nil {
+		return reqs, nil
+	}
+	f, err := modfile.Parse("go.mod", content, nil)
+	if err != nil {
+		// Directives unknown to the parser are ignored in lax mode, but so are the replace directives.
+		if f, err = modfile.ParseLax("go.mod", content, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range f.Require {
+		reqs[r.Mod.Path] = r.Mod.Version
+	}
+	for _, r := range f.Replace {
+		if _, ok := reqs[r.Old.Path]; !ok {
+			continue
+		}
+		if r.Old.Version != "" && reqs[r.Old.Path] != r.Old.Version {
+			continue
+		}
+		reqs[r.Old.Path] = strings.TrimSpace(r.New.Path + " " + r.New.Version)
+	}
+	return reqs, nil
+}
+
+// readOptionalFile returns the file content or nil if the file doesn't exist.
+func readOptionalFile(file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRequireChanges(t *testing.T) {
+	oldMod := []byte(`module github.com/prometheus/prometheus
+
+require (
+	github.com/go-kit/kit v0.10.0
+	github.com/pkg/errors v0.9.1
+	github.com/prometheus/common v0.10.0
+)
+
+replace github.com/prometheus/common => github.com/prometheus/common v0.9.0
+`)
+	newMod := []byte(`module github.com/prometheus/prometheus
+
+require (
+	github.com/go-kit/kit v0.10.0
+	github.com/golang/snappy v0.0.1
+	github.com/prometheus/common v0.11.0
+)
+`)
+
+	changes, err := requireChanges(oldMod, newMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"+ github.com/golang/snappy v0.0.1",
+		"- github.com/pkg/errors v0.9.1",
+		"~ github.com/prometheus/common github.com/prometheus/common v0.9.0 => v0.11.0",
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("expected:\n%v\ngot:\n%v", expected, changes)
+	}
+
+	changes, err = requireChanges(newMod, newMod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got:\n%v", changes)
+	}
+}
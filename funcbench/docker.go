@@ -0,0 +1,92 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// dockerConfig is the container running the go commands with --in-docker. Both sides of the comparison run
+// in the same pinned image with the same resources, which isolates them from the host and gets the local
+// results closer to the ones of the CI.
+type dockerConfig struct {
+	image string
+	// CPU limit of the container, also the GOMAXPROCS of the benchmarks, no limit when 0.
+	cpus float64
+	// Memory limit of the container, eg. 16g, no limit when empty.
+	memory string
+	// CPUs the container is pinned to, eg. 0-3, not pinned when empty.
+	cpuset string
+	// Host directories of the build and module caches, mounted in the containers so that they share them.
+	// The caches are discarded with the container when empty.
+	gocache, gomodcache string
+}
+
+// command returns the command running the shell command in the directory, inside a container.
+// The directories are mounted at the same paths in the container, so the paths of the command don't change.
+func (d *dockerConfig) command(dir string, mounts []string, command string) []string {
+	args := []string{
+		"docker", "run", "--rm",
+		// Files like the profiles are created with the host user.
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"-e", "HOME=/tmp",
+		// Like on the host.
+		"-e", "CGO_ENABLED",
+	}
+	if d.gocache != "" {
+		args = append(args, "-e", "GOCACHE="+d.gocache)
+		mounts = append(mounts, d.gocache)
+	} else {
+		args = append(args, "-e", "GOCACHE=/tmp/.cache/go-build")
+	}
+	if d.gomodcache != "" {
+		args = append(args, "-e", "GOMODCACHE="+d.gomodcache)
+		mounts = append(mounts, d.gomodcache)
+	}
+	if d.cpus > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(d.cpus, 'f', -1, 64),
+			// Go doesn't know about the CPU limit, the benchmarks would run with the CPUs of the host.
+			"-e", fmt.Sprintf("GOMAXPROCS=%d", int(math.Ceil(d.cpus))))
+	}
+	if d.memory != "" {
+		args = append(args, "--memory", d.memory)
+	}
+	if d.cpuset != "" {
+		args = append(args, "--cpuset-cpus", d.cpuset)
+	}
+	for _, m := range mounts {
+		args = append(args, "-v", m+":"+m)
+	}
+	return append(args, "-w", dir, d.image, "sh", "-c", command)
+}
+
+func (d *dockerConfig) String() string {
+	limits := []string{}
+	if d.cpus > 0 {
+		limits = append(limits, fmt.Sprintf("%v CPUs", d.cpus))
+	}
+	if d.cpuset != "" {
+		limits = append(limits, "pinned to the CPUs "+d.cpuset)
+	}
+	if d.memory != "" {
+		limits = append(limits, d.memory+" of memory")
+	}
+	if len(limits) == 0 {
+		return fmt.Sprintf("Benchmarks ran in a %s container.", d.image)
+	}
+	return fmt.Sprintf("Benchmarks ran in a %s container with %s.", d.image, strings.Join(limits, ", "))
+}
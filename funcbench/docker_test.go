@@ -0,0 +1,65 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShellCommand(t *testing.T) {
+	b := &Benchmarker{moduleDir: "sub", resultCacheDir: "/tmp/results"}
+	cmd, err := b.shellCommand("/repo", "go test ./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "sh -c cd /repo/sub && go test ./..."; strings.Join(cmd, " ") != expected {
+		t.Errorf("expected the command:\n%s\ngot:\n%s", expected, strings.Join(cmd, " "))
+	}
+
+	b.docker = &dockerConfig{image: "golang:1.15-alpine", cpus: 3.5, memory: "16g", cpuset: "0-3"}
+	b.profile = true
+	cmd, err = b.shellCommand("/repo", "go test ./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := fmt.Sprintf("docker run --rm --user %d:%d -e HOME=/tmp -e CGO_ENABLED -e GOCACHE=/tmp/.cache/go-build "+
+		"--cpus 3.5 -e GOMAXPROCS=4 --memory 16g --cpuset-cpus 0-3 -v /repo:/repo -v /tmp/results:/tmp/results "+
+		"-w /repo/sub golang:1.15-alpine sh -c", os.Getuid(), os.Getgid())
+	if got := strings.Join(cmd[:len(cmd)-1], " "); got != expected {
+		t.Errorf("expected the command:\n%s\ngot:\n%s", expected, got)
+	}
+	if cmd[len(cmd)-1] != "go test ./..." {
+		t.Errorf("expected the go command as a single argument, got %q", cmd[len(cmd)-1])
+	}
+	if expected := "Benchmarks ran in a golang:1.15-alpine container with 3.5 CPUs, pinned to the CPUs 0-3, 16g of memory."; b.docker.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.docker.String())
+	}
+
+	// The caches are shared by the containers.
+	b.docker.gocache, b.docker.gomodcache = "/cache/go-build", "/cache/mod"
+	b.docker.cpus, b.docker.memory, b.docker.cpuset = 0, "", ""
+	b.profile = false
+	cmd, err = b.shellCommand("/repo", "go test ./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = fmt.Sprintf("docker run --rm --user %d:%d -e HOME=/tmp -e CGO_ENABLED -e GOCACHE=/cache/go-build -e GOMODCACHE=/cache/mod "+
+		"-v /repo:/repo -v /cache/go-build:/cache/go-build -v /cache/mod:/cache/mod "+
+		"-w /repo/sub golang:1.15-alpine sh -c", os.Getuid(), os.Getgid())
+	if got := strings.Join(cmd[:len(cmd)-1], " "); got != expected {
+		t.Errorf("expected the command:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -33,9 +33,12 @@ import (
 type Environment interface {
 	BenchFunc() string
 	CompareTarget() string
+	Tier() *tier
 	SetHashStrings(compareTargetHash, repoHeadHashString string)
+	SetResultFiles(compareTargetResultFile, repoHeadResultFile string)
 
-	PostErr(err string) error
+	PostProgress(progress string) error
+	PostErr(err string, extraInfo ...string) error
 	PostResults(tables []*benchstat.Table, extraInfo ...string) error
 
 	Repo() *git.Repository
@@ -48,15 +51,63 @@ type environment struct {
 	compareTarget           string
 	compareTargetHashString string
 	repoHeadHashString      string
+	// The go test outputs of the benchmarks of both commits.
+	compareTargetResultFile string
+	repoHeadResultFile      string
+
+	// Format of the results and the file they are written to.
+	output     string
+	outputFile string
+
+	// Name of the tier to benchmark and the config file of the repository configuring it.
+	tierName       string
+	repoConfigFile string
+	tier           *tier
 }
 
 func (e environment) BenchFunc() string     { return e.benchFunc }
 func (e environment) CompareTarget() string { return e.compareTarget }
+func (e environment) Tier() *tier           { return e.tier }
+
+// loadRepoConfig applies the config of the repository checked out at root.
+// The benchmark func regex of the tier overrides the one given as argument, and
+// without a target the baseline pinned for the branch is compared against, if any.
+func (e *environment) loadRepoConfig(root, branch string) error {
+	cfg, err := loadRepoConfig(root, e.repoConfigFile)
+	if err != nil {
+		return err
+	}
+	if e.tierName != "" {
+		t, err := cfg.tier(e.tierName)
+		if err != nil {
+			return err
+		}
+		e.tier = t
+		if t.BenchFuncRegex != "" {
+			e.benchFunc = t.BenchFuncRegex
+		}
+	}
+	if e.compareTarget == "" {
+		if e.compareTarget, err = cfg.baseline(branch); err != nil {
+			return err
+		}
+		if e.compareTarget != "" {
+			e.logger.Println("Comparing with", e.compareTarget, "pinned as the baseline of branch", branch)
+		}
+	}
+	return nil
+}
+
 func (e *environment) SetHashStrings(compareTargetHash, repoHeadHashString string) {
 	e.compareTargetHashString = compareTargetHash
 	e.repoHeadHashString = repoHeadHashString
 }
 
+func (e *environment) SetResultFiles(compareTargetResultFile, repoHeadResultFile string) {
+	e.compareTargetResultFile = compareTargetResultFile
+	e.repoHeadResultFile = repoHeadResultFile
+}
+
 type Local struct {
 	environment
 
@@ -68,25 +119,33 @@ func newLocalEnv(e environment) (Environment, error) {
 	if err != nil {
 		return nil, err
 	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, errors.Wrap(err, "get head")
+	}
+	if err := e.loadRepoConfig(wt.Filesystem.Root(), head.Name().Short()); err != nil {
+		return nil, err
+	}
+	if e.compareTarget == "" {
+		return nil, errors.Errorf("no target given and no baseline pinned for branch %s", head.Name().Short())
+	}
 	e.logger.Println("[Local Mode]", "\nBenchmarking current version versus:", e.compareTarget, "\nBenchmark func regex:", e.benchFunc)
 	return &Local{environment: e, repo: r}, nil
 }
 
-func (l *Local) PostErr(string) error { return nil } // Noop. We will see error anyway.
+func (l *Local) PostProgress(string) error       { return nil } // Noop. The steps are logged anyway.
+func (l *Local) PostErr(string, ...string) error { return nil } // Noop. We will see error anyway.
 
+// PostResults prints the results in the output format, or writes them to the output file.
 func (l *Local) PostResults(tables []*benchstat.Table, extraInfo ...string) error {
-	legend := fmt.Sprintf("Old: %s\nNew: %s",
-		l.compareTargetHashString,
-		l.repoHeadHashString,
-	)
-	fmt.Printf("Results:\n%s\n", legend)
-
-	var buf bytes.Buffer
-	benchstat.FormatText(&buf, tables)
-
-	os.Stdout.Write(buf.Bytes())
-
-	return nil
+	if l.outputFile != "" {
+		return l.writeOutputFile(tables, extraInfo...)
+	}
+	return l.writeResults(os.Stdout, l.output, tables, extraInfo...)
 }
 
 func (l *Local) Repo() *git.Repository { return l.repo }
@@ -95,25 +154,32 @@ func (l *Local) Repo() *git.Repository { return l.repo }
 type GitHub struct {
 	environment
 
-	repo   *git.Repository
-	client *gitHubClient
+	repo     *git.Repository
+	client   *gitHubClient
+	comments *commentTemplates
+	// Check run reporting the results along with the comments, if any.
+	check *checkRun
 
 	ctx context.Context
 }
 
-func newGitHubEnv(ctx context.Context, e environment, gc *gitHubClient, workspace string) (Environment, error) {
+func newGitHubEnv(ctx context.Context, e environment, gc *gitHubClient, comments *commentTemplates, check *checkRun, workspace string) (Environment, error) {
 
+	// The commands run in the clone, so its path is absolute rather than relative to the working directory.
+	dir, err := filepath.Abs(filepath.Join(workspace, gc.repo))
+	if err != nil {
+		return nil, err
+	}
 	var r *git.Repository
-	var err error
 	retryTime := 10 * time.Second
 	// Retry 10 times.
 	for i := 1; i <= 10; i++ {
-		if err := os.RemoveAll(filepath.Join(workspace, gc.repo)); err != nil {
+		if err := os.RemoveAll(dir); err != nil {
 			return nil, err
 		}
 		e.logger.Println("Cloning ", gc.owner, ":", gc.repo, " is in progress. Checking in ", retryTime)
 		time.Sleep(retryTime)
-		r, err = git.PlainCloneContext(ctx, filepath.Join(workspace, gc.repo), false, &git.CloneOptions{
+		r, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
 			URL:      fmt.Sprintf("https://github.com/%s/%s.git", gc.owner, gc.repo),
 			Progress: os.Stdout,
 		})
@@ -125,21 +191,15 @@ func newGitHubEnv(ctx context.Context, e environment, gc *gitHubClient, workspac
 		return nil, errors.Wrap(err, "clone git repository")
 	}
 
-	if err := os.Chdir(filepath.Join(workspace, gc.repo)); err != nil {
-		return nil, errors.Wrapf(err, "changing to %s/%s dir", workspace, gc.repo)
-	}
-
 	g := &GitHub{
 		environment: e,
 		repo:        r,
 		client:      gc,
+		comments:    comments,
+		check:       check,
 		ctx:         ctx,
 	}
 
-	if err := os.Setenv("CGO_ENABLED", "0"); err != nil {
-		return nil, err
-	}
-
 	wt, err := g.repo.Worktree()
 	if err != nil {
 		return nil, err
@@ -160,44 +220,116 @@ func newGitHubEnv(ctx context.Context, e environment, gc *gitHubClient, workspac
 		return nil, errors.Wrap(err, "switch to pull request branch")
 	}
 
-	e.logger.Println("[GitHub Mode]", gc.owner, ":", gc.repo, "\nBenchmarking PR -", gc.prNumber, "versus:", e.compareTarget, "\nBenchmark func regex:", e.benchFunc)
+	base, err := gc.baseBranch()
+	if err != nil {
+		return nil, errors.Wrap(err, "get base branch of the pull request")
+	}
+	if err := g.loadRepoConfig(wt.Filesystem.Root(), base); err != nil {
+		return nil, err
+	}
+	if g.compareTarget == "" {
+		g.compareTarget = base
+	}
+
+	e.logger.Println("[GitHub Mode]", gc.owner, ":", gc.repo, "\nBenchmarking PR -", gc.prNumber, "versus:", g.compareTarget, "\nBenchmark func regex:", g.benchFunc)
+
+	if g.check != nil {
+		head, err := r.Head()
+		if err != nil {
+			return nil, errors.Wrap(err, "get head")
+		}
+		if g.check.id, err = gc.createCheckRun(g.check.name, head.Hash().String()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.postTemplate(g.comments.Start, g.commentData()); err != nil {
+		return nil, errors.Wrap(err, "post start comment")
+	}
 	return g, nil
 }
 
-func (g *GitHub) PostErr(txt string) error {
-	c := fmt.Sprintf(
-		"Old: `%v`\nNew: `PR-%v`\n%v",
-		g.compareTarget,
-		g.client.prNumber,
-		txt,
-	)
+// commentData returns the comment template data known for the current benchmark.
+func (g *GitHub) commentData(extraInfo ...string) commentData {
+	data := commentData{
+		Owner:      g.client.owner,
+		Repo:       g.client.repo,
+		PR:         g.client.prNumber,
+		Target:     g.compareTarget,
+		TargetHash: g.compareTargetHashString,
+		HeadHash:   g.repoHeadHashString,
+		ExtraInfo:  strings.Join(extraInfo, "\n"),
+	}
+	if g.tier != nil {
+		data.Tier = g.tier.Name
+		data.TierDescription = g.tier.Description
+	}
+	return data
+}
 
-	if err := g.client.postComment(c); err != nil {
-		return err
+// postTemplate renders and posts a comment. Empty templates are not posted.
+func (g *GitHub) postTemplate(text string, data commentData) error {
+	if text == "" {
+		return nil
+	}
+	c, err := renderComment(text, data)
+	if err != nil {
+		return errors.Wrap(err, "render comment")
 	}
+	return g.client.postComment(c)
+}
 
-	return nil
+func (g *GitHub) PostProgress(progress string) error {
+	data := g.commentData()
+	data.Progress = progress
+	return g.postTemplate(g.comments.Progress, data)
 }
 
+func (g *GitHub) PostErr(txt string, extraInfo ...string) error {
+	if g.check != nil {
+		if err := g.client.completeCheckRun(g.check.id, g.check.name, "failure", &github.CheckRunOutput{
+			Title:   github.String("The benchmark failed"),
+			Summary: github.String(fmt.Sprintf("```\n%s\n```", txt)),
+			Text:    github.String(strings.Join(extraInfo, "\n")),
+		}); err != nil {
+			return err
+		}
+	}
+
+	data := g.commentData(extraInfo...)
+	data.Error = txt
+	return g.postTemplate(g.comments.Error, data)
+}
+
+// PostResults posts the results as a markdown comment and writes them to the output file, if any.
+// With a check run, it is completed with the results and a conclusion from their regressions.
 func (g *GitHub) PostResults(tables []*benchstat.Table, extraInfo ...string) error {
+	if err := g.writeOutputFile(tables, extraInfo...); err != nil {
+		return err
+	}
+	if g.check != nil {
+		wt, err := g.repo.Worktree()
+		if err != nil {
+			return err
+		}
+		summary := fmt.Sprintf("Benchmarks of PR #%d (`%s`) versus %s (`%s`).", g.client.prNumber, g.repoHeadHashString, g.compareTarget, g.compareTargetHashString)
+		conclusion, output, err := g.check.output(wt.Filesystem.Root(), tables, summary, extraInfo...)
+		if err != nil {
+			return err
+		}
+		if err := g.client.completeCheckRun(g.check.id, g.check.name, conclusion, output); err != nil {
+			return err
+		}
+	}
+
 	b := bytes.Buffer{}
 	if err := formatMarkdown(&b, tables); err != nil {
 		return err
 	}
 
-	legend := fmt.Sprintf("Old: `%v`/`%v`\nNew: `PR-%v`/`%v`",
-		g.compareTarget,
-		g.compareTargetHashString,
-		g.client.prNumber,
-		g.repoHeadHashString,
-	)
-	result := fmt.Sprintf(
-		"<details><summary>Click to check benchmark result</summary>\n\n%s\n%s\n%s</details>",
-		legend,
-		strings.Join(extraInfo, "\n"),
-		b.String(),
-	)
-	return g.client.postComment(result)
+	data := g.commentData(extraInfo...)
+	data.Results = b.String()
+	return g.postTemplate(g.comments.Results, data)
 }
 
 func (g *GitHub) Repo() *git.Repository { return g.repo }
@@ -229,6 +361,15 @@ func newGitHubClient(ctx context.Context, owner, repo string, prNumber int, noco
 	return &c, nil
 }
 
+// baseBranch returns the branch the pull request is opened against.
+func (c *gitHubClient) baseBranch() (string, error) {
+	pr, _, err := c.client.PullRequests.Get(c.ctx, c.owner, c.repo, c.prNumber)
+	if err != nil {
+		return "", err
+	}
+	return pr.GetBase().GetRef(), nil
+}
+
 func (c *gitHubClient) postComment(comment string) error {
 	if c.nocomment {
 		return nil
@@ -0,0 +1,194 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/store"
+	"golang.org/x/perf/benchstat"
+)
+
+// history stores the results of the runs in the results store and compares the new results
+// with the rolling baseline of the target branch, the results of its last commits.
+type history struct {
+	store store.Store
+	// Repository of the results, as owner/repo.
+	repo string
+	// Number of the last commits of the target branch with results in the rolling baseline.
+	commits int
+}
+
+// save stores the results of a commit, the results of the uncommitted changes aren't stored.
+func (h *history) save(benchFunc, rev, resultFile string) error {
+	if strings.HasSuffix(rev, dirtySuffix) {
+		return nil
+	}
+	content, err := ioutil.ReadFile(resultFile)
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(h.store.Write(resultKey(h.repo, rev, benchFunc), content), "storing the results of %s", rev)
+}
+
+// resultKey is the key of the results of a benchmark regex at a commit of a repository, like owner/repo/<commit>/<regex>.out.
+// The regex is encoded like in the result cache.
+func resultKey(repo, commit, benchFunc string) string {
+	return path.Join(repo, commit, base64.URLEncoding.EncodeToString([]byte(benchFunc))+".out")
+}
+
+// trendKey is a metric of a benchmark.
+type trendKey struct {
+	benchmark, unit string
+}
+
+// trend returns the markdown table of the trend of the benchmarks over the last commits of the target branch,
+// the first parents of the target commit, followed by the new results. It is empty when less than 2 commits have results.
+func (h *history) trend(repo *git.Repository, target, benchFunc, newResultFile string) (string, error) {
+	commit, err := repo.CommitObject(plumbing.NewHash(target))
+	if err != nil {
+		return "", errors.Wrapf(err, "commit %s", target)
+	}
+
+	// The commits without results, like the ones which weren't benchmarked, are skipped
+	// but the search stops after a while not to walk the whole history.
+	var runs []map[trendKey]float64
+	for i := 0; len(runs) < h.commits && i < 5*h.commits; i++ {
+		content, err := h.store.Read(resultKey(h.repo, commit.Hash.String(), benchFunc))
+		if err != nil {
+			return "", err
+		}
+		if content != nil {
+			means, err := resultMeans(content)
+			if err != nil {
+				return "", errors.Wrapf(err, "parsing the results of %s", commit.Hash)
+			}
+			runs = append(runs, means)
+		}
+		if commit.NumParents() == 0 {
+			break
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return "", errors.Wrapf(err, "parent of %s", commit.Hash)
+		}
+		commit = parent
+	}
+	if len(runs) < 2 {
+		return "", nil
+	}
+	// Oldest first.
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+
+	content, err := ioutil.ReadFile(newResultFile)
+	if err != nil {
+		return "", err
+	}
+	newMeans, err := resultMeans(content)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing the new results")
+	}
+	keys := make([]trendKey, 0, len(newMeans))
+	for k := range newMeans {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].benchmark != keys[j].benchmark {
+			return keys[i].benchmark < keys[j].benchmark
+		}
+		return keys[i].unit < keys[j].unit
+	})
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Trend of the last %d commits of the target with results, the new results last, compared with their median:\n\n", len(runs))
+	b.WriteString("| Benchmark | Unit | Trend | Baseline | New | Delta |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, k := range keys {
+		var values []float64
+		for _, r := range runs {
+			if v, ok := r[k]; ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		baseline, v := median(values), newMeans[k]
+		delta := "~"
+		if baseline != 0 {
+			delta = fmt.Sprintf("%+.2f%%", (v-baseline)/baseline*100)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %.4g | %.4g | %s |\n", k.benchmark, k.unit, sparkline(append(values, v)), baseline, v, delta)
+	}
+	return b.String(), nil
+}
+
+// resultMeans returns the mean of each metric of the benchmarks of a go test output.
+func resultMeans(content []byte) (map[trendKey]float64, error) {
+	c := &benchstat.Collection{}
+	if err := c.AddFile("results", bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	means := map[trendKey]float64{}
+	for k, m := range c.Metrics {
+		if len(m.Values) == 0 {
+			continue
+		}
+		var sum float64
+		for _, v := range m.Values {
+			sum += v
+		}
+		means[trendKey{benchmark: k.Benchmark, unit: k.Unit}] = sum / float64(len(m.Values))
+	}
+	return means, nil
+}
+
+func median(values []float64) float64 {
+	s := append([]float64{}, values...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline returns the values as a unicode sparkline.
+func sparkline(values []float64) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > min {
+			i = int((v - min) / (max - min) * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fixtures "github.com/go-git/go-git-fixtures/v4"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/prometheus/test-infra/pkg/store"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := &history{store: store.Dir(filepath.Join(dir, "store")), repo: "prometheus/prometheus", commits: 3}
+
+	f := fixtures.Basic().One()
+	r, err := git.Open(filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault()), f.DotGit())
+	if err != nil {
+		t.Fatalf("error when open repository: %s", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first parents of master, the last commit first.
+	var commits []string
+	c, err := r.CommitObject(head.Hash())
+	for err == nil && len(commits) < 5 {
+		commits = append(commits, c.Hash.String())
+		c, err = c.Parent(0)
+	}
+
+	result := func(name string, ns int) string {
+		fn := filepath.Join(dir, name)
+		content := fmt.Sprintf("BenchmarkQuery-4\t100\t%d ns/op\nBenchmarkQuery-4\t100\t%d ns/op\n", ns, ns)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fn
+	}
+	newResult := result("new.out", 1500)
+	if trend, err := h.trend(r, commits[0], "BenchmarkQuery", newResult); err != nil || trend != "" {
+		t.Fatalf("expected no trend without results, got %q, %v", trend, err)
+	}
+
+	// The results of the commit after the last one are out of the rolling baseline, the second commit has no results.
+	for i, ns := range map[int]int{0: 1100, 2: 1000, 3: 1200, 4: 5000} {
+		if err := h.save("BenchmarkQuery", commits[i], result(fmt.Sprintf("%d.out", i), ns)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.save("BenchmarkQuery", commits[1]+dirtySuffix, newResult); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := h.store.Read(resultKey(h.repo, commits[1], "BenchmarkQuery")); err != nil || content != nil {
+		t.Fatalf("expected the uncommitted changes not to be stored, got %q, %v", content, err)
+	}
+
+	trend, err := h.trend(r, commits[0], "BenchmarkQuery", newResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"Trend of the last 3 commits of the target",
+		"| Query-4 | ns/op | ▃▁▂█ | 1100 | 1500 | +36.36% |",
+	} {
+		if !strings.Contains(trend, expected) {
+			t.Errorf("expected %q in:\n%s", expected, trend)
+		}
+	}
+}
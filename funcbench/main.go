@@ -22,14 +22,17 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
-	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/oklog/run"
 	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/store"
 	"golang.org/x/perf/benchstat"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -55,26 +58,57 @@ func main() {
 	cfg := struct {
 		verbose        bool
 		nocomment      bool
+		checkRun       bool
 		owner          string
 		repo           string
 		resultsDir     string
 		workspaceDir   string
+		goCache        string
+		goModCache     string
 		ghPR           int
-		benchTime      time.Duration
-		benchTimeout   time.Duration
+		comment        string
+		goTest         goTestFlags
+		deltaTest      string
+		alpha          float64
 		compareTarget  string
 		benchFuncRegex string
 		packagePath    string
+		packages       []string
+		cgo            bool
+		maxVariance    float64
+		reruns         int
+		inDocker       bool
+		docker         dockerConfig
+		moduleDir      string
+		commentsFile   string
+		rawValues      bool
+		profile        bool
+		profilesURL    string
+		profileTop     int
+		resultsStore   string
+		storeEndpoint  string
+		trendCommits   int
+		pushgateway    string
+		remoteWrite    string
+		metricsBranch  string
+		tier           string
+		repoConfigFile string
+		noiseFloorFile string
+		output         string
+		outputFile     string
+
+		// Percent of the --fail-on-regression flag, eg. 10%.
+		failOnRegression string
 	}{}
 
 	app := kingpin.New(
 		filepath.Base(os.Args[0]),
-		`Benchmark and compare your Go code between sub benchmarks or commits.
+		`Benchmark and compare your Go code between commits or with uncommitted changes.
 		* For BenchmarkFuncName, compare current with master: ./funcbench -v master BenchmarkFuncName
 		* For BenchmarkFunc.*, compare current with master: ./funcbench -v master BenchmarkFunc.*
 		* For all benchmarks, compare current with devel: ./funcbench -v devel .* or ./funcbench -v devel
 		* For BenchmarkFunc.*, compare current with 6d280 commit: ./funcbench -v 6d280 BenchmarkFunc.*
-		* For BenchmarkFunc.*, compare between sub-benchmarks of same benchmark on current commit: ./funcbench -v . BenchmarkFunc.*
+		* For BenchmarkFunc.*, compare the uncommitted changes with HEAD: ./funcbench -v . BenchmarkFunc.*
 		* For BenchmarkFuncName, compare pr#35 with master: ./funcbench --nocomment --github-pr="35" master BenchmarkFuncName`,
 	)
 	// Options.
@@ -90,34 +124,311 @@ func main() {
 		Default("prometheus").StringVar(&cfg.repo)
 	app.Flag("github-pr", "GitHub PR number to pull changes from and to post benchmark results.").
 		IntVar(&cfg.ghPR)
+	app.Flag("comment", "Body of the comment triggering the benchmarks of the PR, eg. from the issue_comment event. "+
+		"The arguments of its /funcbench command replace the target, regex, package path and tier arguments, and its "+
+		"settings override the flags. An invalid command is replied to with its syntax.").
+		Envar("FUNCBENCH_COMMENT").PlaceHolder("BODY").StringVar(&cfg.comment)
+	check := &checkRun{}
+	app.Flag("check-run", "Also report the results of the PR as a check run, which can be required to merge it. "+
+		"Use --nocomment to only report the check run.").
+		BoolVar(&cfg.checkRun)
+	app.Flag("check-run-name", "Name of the check run.").
+		Default("funcbench").StringVar(&check.name)
+	app.Flag("check-run-max-regression", "Conclude the check run as a failure when a benchmark regresses by more than this percent, "+
+		"as neutral when one regresses by less. The max regression of the tier overrides it.").
+		Default("10").Float64Var(&check.maxRegression)
+	app.Flag("fail-on-regression", "Exit with an error when the time/op or allocs/op of a benchmark regress by more than this percent, eg. 10%, "+
+		"with statistical significance, to run funcbench as a required CI job. The check run fails on these regressions only. "+
+		"The max regression of the tier overrides it. Disabled when empty.").
+		PlaceHolder("PERCENT").StringVar(&cfg.failOnRegression)
 	app.Flag("workspace", "Directory to clone GitHub PR.").
-		Default("/tmp/funcbench").
+		Envar("FUNCBENCH_WORKSPACE").Default("/tmp/funcbench").
 		StringVar(&cfg.workspaceDir)
-	app.Flag("result-cache", "Directory to store benchmark results.").
-		Default("_dev/funcbench").
+	app.Flag("result-cache", "Directory to store benchmark results, relative to the working directory.").
+		Envar("FUNCBENCH_RESULT_CACHE").Default("_dev/funcbench").
 		StringVar(&cfg.resultsDir)
+	app.Flag("gocache", "Build cache of the go commands, shared by both sides so that the packages which didn't change "+
+		"are only built once. Defaults to the cache of Go, or to .gocache in the result cache with --in-docker.").
+		Envar("FUNCBENCH_GOCACHE").PlaceHolder("DIR").StringVar(&cfg.goCache)
+	app.Flag("gomodcache", "Module cache of the go commands, eg. a volume kept between the runs. Defaults to the cache of Go.").
+		Envar("FUNCBENCH_GOMODCACHE").PlaceHolder("DIR").StringVar(&cfg.goModCache)
+
+	app.Flag("module-dir", "Directory of the Go module to benchmark, relative to the repository root. "+
+		"Useful for repositories with multiple Go modules. The package path is relative to this directory.").
+		Default(".").
+		StringVar(&cfg.moduleDir)
+
+	app.Flag("comment-templates", "YAML file with golang templates overriding the default comments posted to GitHub. "+
+		"Supported keys: start, setup_error, syntax_error, error and results.").
+		StringVar(&cfg.commentsFile)
+
+	app.Flag("raw-values", "Show the raw benchmark values in the results instead of scaling them to human-friendly units.").
+		BoolVar(&cfg.rawValues)
+
+	app.Flag("profile", "Collect a CPU profile of both benchmark runs. Requires the benchmarks of a single package.").
+		BoolVar(&cfg.profile)
+	app.Flag("profiles-url", "Base URL where the result cache directory is published, e.g. an artifacts bucket. "+
+		"When set together with --profile, flamegraph links of both CPU profiles are added to the results.").
+		StringVar(&cfg.profilesURL)
+	app.Flag("profile-top", "Number of functions whose CPU time changed the most between both profiles added to the results "+
+		"when --profile is set, like pprof -top -diff_base. 0 disables the profile diff.").
+		Default("10").IntVar(&cfg.profileTop)
+
+	app.Flag("results-store", "Store of the results of every run keyed by repository, commit and benchmark regex: "+
+		"a s3://bucket/prefix or gs://bucket/prefix bucket, or a directory. The new results are compared with the "+
+		"rolling baseline of the last commits of the target in the store, and their trend is added to the results.").
+		PlaceHolder("URL").StringVar(&cfg.resultsStore)
+	app.Flag("results-store-endpoint", "Endpoint of the API of the results store bucket, eg. of a MinIO server for s3://.").
+		StringVar(&cfg.storeEndpoint)
+	app.Flag("trend-commits", "Number of the last commits of the target with results in the rolling baseline.").
+		Default("20").IntVar(&cfg.trendCommits)
+
+	app.Flag("pushgateway", "URL of a Pushgateway to push the mean ns/op, B/op and allocs/op of the new results to, "+
+		"with commit and branch labels, to chart the benchmarks of a branch, eg. in Grafana. "+
+		"The group of the branch only holds the last results pushed.").
+		PlaceHolder("URL").StringVar(&cfg.pushgateway)
+	app.Flag("remote-write", "URL of a Prometheus remote write endpoint to write the metrics of the new results to, "+
+		"like --pushgateway. The backfilled results get the time of their commit.").
+		PlaceHolder("URL").StringVar(&cfg.remoteWrite)
+	app.Flag("metrics-branch", "Branch label of the metrics. Defaults to the current branch.").
+		StringVar(&cfg.metricsBranch)
+
+	app.Flag("tier", "Benchmark a tier of the repo config, like a quick subset for every PR or the full suite. "+
+		"The benchmark func regex, package path, bench time and timeout set by the tier override the given ones.").
+		StringVar(&cfg.tier)
+	app.Flag("repo-config", "YAML file of the benchmarked repository configuring its benchmark tiers and baselines, relative to the repository root.").
+		Default(".funcbench.yml").
+		StringVar(&cfg.repoConfigFile)
+
+	app.Flag("noise-floor", "JSON file with the noise floor of the runner measured by calibrate. "+
+		"Deltas below the noise floor are reported as unchanged. Defaults to noise-floor.json in the result cache.").
+		PlaceHolder("FILE").
+		StringVar(&cfg.noiseFloorFile)
+
+	app.Flag("output", "Format of the results: text, md, json or benchfmt, the go test outputs of both commits "+
+		"labelled with their commit. In GitHub mode the results are posted as markdown and only written in "+
+		"this format to the output file.").
+		Short('o').Default("text").EnumVar(&cfg.output, outputFormats...)
+	app.Flag("output-file", "File to write the results to instead of stdout.").
+		PlaceHolder("FILE").StringVar(&cfg.outputFile)
 
 	app.Flag("bench-time", "Run enough iterations of each benchmark to take t, specified "+
 		"as a time.Duration. The special syntax Nx means to run the benchmark N times").
-		Short('t').Default("1s").DurationVar(&cfg.benchTime)
+		Short('t').Envar("FUNCBENCH_BENCH_TIME").Default("1s").DurationVar(&cfg.goTest.benchTime)
 	app.Flag("timeout", "Benchmark timeout specified in time.Duration format, "+
 		"disabled if set to 0. If a test binary runs longer than duration d, panic.").
-		Short('d').Default("2h").DurationVar(&cfg.benchTimeout)
-
-	app.Arg("target", "Can be one of '.', tag name, branch name or commit SHA of the branch "+
-		"to compare against. If set to '.', branch/commit is the same as the current one; "+
-		"funcbench will run once and try to compare between 2 sub-benchmarks. "+
-		"Errors out if there are no sub-benchmarks.").
-		Required().StringVar(&cfg.compareTarget)
-	app.Arg("bench-func-regex", "Function regex to use for benchmark."+
-		"Supports RE2 regexp and is fully anchored, by default will run all benchmarks.").
+		Short('d').Default("2h").DurationVar(&cfg.goTest.benchTimeout)
+
+	app.Flag("benchmem", "Report memory allocation statistics of the benchmarks. "+
+		"Use --no-benchmem for benchmarks reporting only custom metrics with b.ReportMetric.").
+		Default("true").BoolVar(&cfg.goTest.benchmem)
+	app.Flag("count", "Run each benchmark n times, the samples of the runs give the variance of the results "+
+		"and the significance of the deltas.").
+		Envar("FUNCBENCH_COUNT").Default("6").IntVar(&cfg.goTest.count)
+	app.Flag("cpu", "Comma separated list of GOMAXPROCS values to run each benchmark with, eg. 1,4. "+
+		"Defaults to the number of CPUs.").
+		Envar("FUNCBENCH_CPU").StringVar(&cfg.goTest.cpu)
+	app.Flag("go-test-args", "Additional arguments of the go test command, parsed by the shell, "+
+		"eg. --go-test-args='-tags=stringlabels'.").
+		PlaceHolder("ARGS").StringVar(&cfg.goTest.args)
+	app.Flag("build-tags", "Comma separated list of build tags of the benchmarks, also used to check the build, eg. stringlabels.").
+		Envar("FUNCBENCH_BUILD_TAGS").PlaceHolder("TAGS").StringVar(&cfg.goTest.tags)
+	app.Flag("cgo", "Build the benchmarks with cgo, for the benchmarks requiring it. By default CGO_ENABLED=0 like in the CI, "+
+		"also in the container with --in-docker, whose image then needs a C compiler.").
+		Envar("FUNCBENCH_CGO").BoolVar(&cfg.cgo)
+	app.Flag("packages", "Package to benchmark instead of the packagepath argument, repeatable, "+
+		"eg. --packages ./tsdb/... --packages ./promql.").
+		PlaceHolder("PACKAGE").StringsVar(&cfg.packages)
+	app.Flag("max-variance", "Rerun the benchmarks whose time varies by more than this percent between the --count runs of a side, "+
+		"like the ± of the results, and add the min, median and max of the runs to the results. Disabled when 0.").
+		PlaceHolder("PERCENT").Float64Var(&cfg.maxVariance)
+	app.Flag("reruns", "Number of reruns of the benchmarks varying by more than --max-variance.").
+		Default("2").IntVar(&cfg.reruns)
+	app.Flag("in-docker", "Run the go commands of both sides in a container with the --docker-* resources, "+
+		"which isolates the benchmarks from the host and makes the local results comparable with the CI. Requires docker.").
+		BoolVar(&cfg.inDocker)
+	app.Flag("docker-image", "Image of the container with --in-docker, pinned to the Go version of the CI.").
+		Default("golang:1.15-alpine").StringVar(&cfg.docker.image)
+	app.Flag("docker-cpus", "CPU limit of the container with --in-docker, also the GOMAXPROCS of the benchmarks. "+
+		"Defaults to the CPUs of the CI nodes, no limit when 0.").
+		Default("4").Float64Var(&cfg.docker.cpus)
+	app.Flag("docker-memory", "Memory limit of the container with --in-docker, eg. 16g, no limit when empty.").
+		Default("16g").StringVar(&cfg.docker.memory)
+	app.Flag("docker-cpuset", "CPUs the container is pinned to with --in-docker, eg. 0-3. "+
+		"Pinning to CPUs the host doesn't otherwise use reduces the noise the most.").
+		StringVar(&cfg.docker.cpuset)
+	app.Flag("delta-test", "Significance test of the deltas between the old and new results. "+
+		"Deltas which aren't statistically significant are reported as ~.").
+		Default("utest").EnumVar(&cfg.deltaTest, "utest", "ttest", "none")
+	app.Flag("alpha", "Consider the deltas with a p-value below alpha as significant.").
+		Default("0.05").Float64Var(&cfg.alpha)
+
+	benchCmd := app.Command("bench", "Compare the benchmarks of the current commit with the target.").Default()
+	benchCmd.Arg("target", "Can be one of '.', tag name, branch name or commit SHA, possibly abbreviated, "+
+		"to compare against. Branches which aren't checked out are looked up on the origin remote. "+
+		"If set to '.', the uncommitted changes of the worktree are compared with HEAD, "+
+		"in GitHub mode the PR is compared with itself. When empty, the baseline pinned in the repo config "+
+		"for the branch of the PR, or the current branch in local mode, is used. "+
+		"Without a pinned baseline a PR is compared with its branch.").
+		StringVar(&cfg.compareTarget)
+	benchCmd.Arg("bench-func-regex", "Function regex to use for benchmark."+
+		"Supports RE2 regexp and is fully anchored, by default will run all benchmarks. "+
+		"Select sub-benchmarks with a slash, each level being anchored, eg. 'BenchmarkQuery/series=.*'.").
 		Default(".*").
-		StringVar(&cfg.benchFuncRegex) // TODO (geekodour) : validate regex?
-	app.Arg("packagepath", "Package to run benchmark against. Eg. ./tsdb, defaults to ./...").
+		StringVar(&cfg.benchFuncRegex)
+	benchCmd.Arg("packagepath", "Package to run benchmark against. Eg. ./tsdb, defaults to ./...").
 		Default("./...").
 		StringVar(&cfg.packagePath)
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	bf := &backfill{}
+	backfillCmd := app.Command("backfill", "Run the benchmarks on the past commits of a range and store the results in the result cache, "+
+		"with the time of the commits, to give benchTrend a history. Commits with results in the cache are skipped.\n"+
+		"Eg. ./funcbench backfill --tags 'v2.*' --module-dir=. v2.20.0..v2.25.0 BenchmarkQuery ./promql")
+	backfillCmd.Flag("tags", "Only benchmark the commits with a tag matching the pattern, eg. 'v2.*'.").
+		StringVar(&bf.tags)
+	backfillCmd.Flag("first-parent", "Only benchmark the commits of the branch, not the commits of the merged branches.").
+		BoolVar(&bf.firstParent)
+	backfillCmd.Flag("every", "Benchmark every nth commit, always including the last one.").
+		Default("1").IntVar(&bf.every)
+	backfillCmd.Flag("shard", "Only benchmark a shard of the commits as index/count, eg. 0/4, "+
+		"to split the backfill between several runners writing to the same result cache.").
+		StringVar(&bf.shard)
+	backfillCmd.Arg("revisions", "Range of the commits to benchmark as from..to, both included.").
+		Required().StringVar(&bf.revisions)
+	backfillCmd.Arg("bench-func-regex", "Function regex to use for benchmark."+
+		"Supports RE2 regexp and is fully anchored, by default will run all benchmarks. "+
+		"Select sub-benchmarks with a slash, each level being anchored, eg. 'BenchmarkQuery/series=.*'.").
+		Default(".*").
+		StringVar(&cfg.benchFuncRegex)
+	backfillCmd.Arg("packagepath", "Package to run benchmark against. Eg. ./tsdb, defaults to ./...").
+		Default("./...").
+		StringVar(&cfg.packagePath)
+
+	var refs string
+	compareCmd := app.Command("compare", "Compare the benchmarks of two refs, each checked out in its own worktree "+
+		"whatever the current worktree or PR, eg. to bisect a regression between releases.\n"+
+		"Eg. ./funcbench compare v2.19.0..v2.20.0 BenchmarkRangeQuery ./promql")
+	compareCmd.Arg("refs", "Refs to compare as old..new, each a branch, tag or commit.").
+		Required().StringVar(&refs)
+	compareCmd.Arg("bench-func-regex", "Function regex to use for benchmark."+
+		"Supports RE2 regexp and is fully anchored, by default will run all benchmarks. "+
+		"Select sub-benchmarks with a slash, each level being anchored, eg. 'BenchmarkQuery/series=.*'.").
+		Default(".*").
+		StringVar(&cfg.benchFuncRegex)
+	compareCmd.Arg("packagepath", "Package to run benchmark against. Eg. ./tsdb, defaults to ./...").
+		Default("./...").
+		StringVar(&cfg.packagePath)
+
+	cal := &calibration{}
+	calibrateCmd := app.Command("calibrate", "Run the benchmarks of the current commit several times to measure the noise floor of the runner, "+
+		"the largest delta between two runs of the same code, and write it to the noise floor file. "+
+		"The comparisons on the runner report the deltas below it as unchanged.\n"+
+		"Eg. ./funcbench calibrate --runs=5 BenchmarkRangeQuery ./promql")
+	calibrateCmd.Flag("runs", "Number of runs of the benchmarks.").
+		Default("5").IntVar(&cal.runs)
+	calibrateCmd.Arg("bench-func-regex", "Function regex to use for benchmark."+
+		"Supports RE2 regexp and is fully anchored, by default will run all benchmarks. "+
+		"Select sub-benchmarks with a slash, each level being anchored, eg. 'BenchmarkQuery/series=.*'.").
+		Default(".*").
+		StringVar(&cfg.benchFuncRegex)
+	calibrateCmd.Arg("packagepath", "Package to run benchmark against. Eg. ./tsdb, defaults to ./...").
+		Default("./...").
+		StringVar(&cfg.packagePath)
+
+	mg := &mergeGroup{}
+	mergeQueueCmd := app.Command("merge-queue", "Compare the benchmarks of a group of the GitHub merge queue with the commit it is built on, "+
+		"as a required check failing when a benchmark regresses. The results are cached by commit, "+
+		"so the groups built on the same commit share its benchmark run.\n"+
+		"Eg. ./funcbench --tier=quick --result-cache=/cache merge-queue")
+	mergeQueueCmd.Flag("base", "Commit to compare with. Defaults to the base of the merge_group event of the workflow run.").
+		PlaceHolder("SHA").StringVar(&mg.base)
+	mergeQueueCmd.Flag("event", "JSON file with the event triggering the workflow run.").
+		Envar("GITHUB_EVENT_PATH").PlaceHolder("FILE").StringVar(&mg.eventFile)
+	mergeQueueCmd.Flag("max-regression", "Fail when a benchmark regresses by more than this percent. The max regression of the tier overrides it.").
+		Default("10").Float64Var(&mg.maxRegression)
+	mergeQueueCmd.Flag("summary", "Markdown file the results are appended to, the job summary of GitHub Actions.").
+		Envar("GITHUB_STEP_SUMMARY").PlaceHolder("FILE").StringVar(&mg.summaryFile)
+	mergeQueueCmd.Arg("bench-func-regex", "Function regex to use for benchmark."+
+		"Supports RE2 regexp and is fully anchored, by default will run all benchmarks. "+
+		"Select sub-benchmarks with a slash, each level being anchored, eg. 'BenchmarkQuery/series=.*'.").
+		Default(".*").
+		StringVar(&cfg.benchFuncRegex)
+	mergeQueueCmd.Arg("packagepath", "Package to run benchmark against. Eg. ./tsdb, defaults to ./...").
+		Default("./...").
+		StringVar(&cfg.packagePath)
+
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	if cfg.noiseFloorFile == "" {
+		cfg.noiseFloorFile = filepath.Join(cfg.resultsDir, "noise-floor.json")
+	}
+	if cfg.goTest.count < 1 {
+		app.Fatalf("--count must be at least 1, got %d", cfg.goTest.count)
+	}
+	if cfg.reruns < 0 {
+		app.Fatalf("--reruns must be positive, got %d", cfg.reruns)
+	}
+	if len(cfg.packages) > 0 {
+		cfg.packagePath = strings.Join(cfg.packages, " ")
+	}
+	cgo := "0"
+	if cfg.cgo {
+		cgo = "1"
+	}
+	// The go commands inherit the environment, the containers get it from the host.
+	if err := os.Setenv("CGO_ENABLED", cgo); err != nil {
+		app.Fatalf("CGO_ENABLED: %v", err)
+	}
+	if cfg.comment != "" && cfg.ghPR == 0 {
+		app.Fatalf("--comment requires --github-pr")
+	}
+	if !cfg.checkRun {
+		check = nil
+	} else if cfg.ghPR == 0 {
+		app.Fatalf("--check-run requires --github-pr")
+	}
+	var failOnRegression float64
+	if cfg.failOnRegression != "" {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(cfg.failOnRegression, "%"), 64)
+		if err != nil || v <= 0 {
+			app.Fatalf("--fail-on-regression must be a positive percent, eg. 10%%, got %q", cfg.failOnRegression)
+		}
+		failOnRegression = v
+		if check != nil {
+			check.maxRegression, check.metrics = v, gatedMetrics
+		}
+	}
+	if cfg.inDocker {
+		if _, err := exec.LookPath("docker"); err != nil {
+			app.Fatalf("--in-docker requires docker: %v", err)
+		}
+		if cfg.goCache == "" {
+			// The containers don't have the cache of the host.
+			cfg.goCache = filepath.Join(cfg.resultsDir, ".gocache")
+		}
+	}
+	for _, c := range []struct {
+		env string
+		dir *string
+	}{{"GOCACHE", &cfg.goCache}, {"GOMODCACHE", &cfg.goModCache}} {
+		if *c.dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(*c.dir)
+		if err != nil {
+			app.Fatalf("%s: %v", c.env, err)
+		}
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			app.Fatalf("%s: %v", c.env, err)
+		}
+		*c.dir = dir
+		// The go commands on the host inherit the environment, the containers get the caches mounted.
+		if !cfg.inDocker {
+			if err := os.Setenv(c.env, dir); err != nil {
+				app.Fatalf("%s: %v", c.env, err)
+			}
+		}
+	}
+	cfg.docker.gocache, cfg.docker.gomodcache = cfg.goCache, cfg.goModCache
 	logger := &logger{
 		// Show file line with each log.
 		Logger:  log.New(os.Stdout, "funcbech", log.Ltime|log.Lshortfile),
@@ -136,11 +447,38 @@ func main() {
 
 			// Setup Environment.
 			e := environment{
-				logger:        logger,
-				benchFunc:     cfg.benchFuncRegex,
-				compareTarget: cfg.compareTarget,
+				logger:         logger,
+				benchFunc:      cfg.benchFuncRegex,
+				compareTarget:  cfg.compareTarget,
+				tierName:       cfg.tier,
+				repoConfigFile: cfg.repoConfigFile,
+				output:         cfg.output,
+				outputFile:     cfg.outputFile,
 			}
-			if cfg.ghPR == 0 {
+			if cmd == compareCmd.FullCommand() {
+				e.compareTarget = refs
+			}
+			if cmd == backfillCmd.FullCommand() || cmd == calibrateCmd.FullCommand() {
+				e.compareTarget = bf.revisions
+				if cmd == calibrateCmd.FullCommand() {
+					// The current commit is benchmarked against itself.
+					e.compareTarget = "HEAD"
+				}
+				env, err = newLocalEnv(e)
+				if err != nil {
+					return errors.Wrap(err, "environment create")
+				}
+			} else if cmd == mergeQueueCmd.FullCommand() {
+				// The merge queue runs a check rather than commenting on a PR.
+				if err := mg.resolveBase(logger); err != nil {
+					return err
+				}
+				e.compareTarget = mg.base
+				env, err = newLocalEnv(e)
+				if err != nil {
+					return errors.Wrap(err, "environment create")
+				}
+			} else if cfg.ghPR == 0 {
 				// Local Mode.
 				env, err = newLocalEnv(e)
 				if err != nil {
@@ -148,34 +486,161 @@ func main() {
 				}
 			} else {
 				// Github Mode.
+				comments, err := loadCommentTemplates(cfg.commentsFile)
+				if err != nil {
+					return err
+				}
+
 				ghClient, err := newGitHubClient(ctx, cfg.owner, cfg.repo, cfg.ghPR, cfg.nocomment)
 				if err != nil {
 					return errors.Wrapf(err, "github client")
 				}
 
-				env, err = newGitHubEnv(ctx, e, ghClient, cfg.workspaceDir)
+				if cfg.comment != "" {
+					c, err := parseComment(cfg.comment)
+					if err != nil {
+						if comments.SyntaxError != "" {
+							reply, rErr := renderComment(comments.SyntaxError, commentData{
+								Owner: cfg.owner,
+								Repo:  cfg.repo,
+								PR:    cfg.ghPR,
+								Error: err.Error(),
+							})
+							if rErr != nil {
+								return errors.Wrap(rErr, "could not render syntax error")
+							}
+							if err := ghClient.postComment(reply); err != nil {
+								return errors.Wrap(err, "could not post syntax error")
+							}
+						}
+						return errors.Wrap(err, "parsing the comment")
+					}
+					cfg.tier, cfg.compareTarget = c.tier, c.target
+					cfg.benchFuncRegex, cfg.packagePath = ".*", "./..."
+					if c.benchFuncRegex != "" {
+						cfg.benchFuncRegex = c.benchFuncRegex
+					}
+					if c.packagePath != "" {
+						cfg.packagePath = c.packagePath
+					}
+					if c.count != 0 {
+						cfg.goTest.count = c.count
+					}
+					if c.benchTime != 0 {
+						cfg.goTest.benchTime = c.benchTime
+					}
+					if c.cpu != "" {
+						cfg.goTest.cpu = c.cpu
+					}
+					e.tierName, e.compareTarget, e.benchFunc = cfg.tier, cfg.compareTarget, cfg.benchFuncRegex
+				}
+
+				env, err = newGitHubEnv(ctx, e, ghClient, comments, check, cfg.workspaceDir)
 				if err != nil {
-					if err := ghClient.postComment(fmt.Sprintf("%v. Could not setup environment, please check logs.", err)); err != nil {
-						return errors.Wrap(err, "could not post error")
+					if comments.SetupError != "" {
+						c, rErr := renderComment(comments.SetupError, commentData{
+							Owner:  cfg.owner,
+							Repo:   cfg.repo,
+							PR:     cfg.ghPR,
+							Target: cfg.compareTarget,
+							Error:  err.Error(),
+							Tier:   cfg.tier,
+						})
+						if rErr != nil {
+							return errors.Wrap(rErr, "could not render error")
+						}
+						if err := ghClient.postComment(c); err != nil {
+							return errors.Wrap(err, "could not post error")
+						}
 					}
 					return errors.Wrap(err, "environment create")
 				}
 			}
 
+			if t := env.Tier(); t != nil {
+				if t.PackagePath != "" {
+					cfg.packagePath = t.PackagePath
+				}
+				if t.BenchTime != 0 {
+					cfg.goTest.benchTime = t.BenchTime
+				}
+				if t.Timeout != 0 {
+					cfg.goTest.benchTimeout = t.Timeout
+				}
+				if t.MaxRegression != 0 {
+					mg.maxRegression = t.MaxRegression
+					if check != nil {
+						check.maxRegression = t.MaxRegression
+					}
+					if failOnRegression > 0 {
+						failOnRegression = t.MaxRegression
+					}
+				}
+			}
+
+			wt, err := env.Repo().Worktree()
+			if err != nil {
+				return errors.Wrap(err, "worktree")
+			}
+
 			// ( ◔_◔)ﾉ Start benchmarking!
 			benchmarker := newBenchmarker(logger, env,
-				&commander{verbose: cfg.verbose, ctx: ctx},
-				cfg.benchTime, cfg.benchTimeout, cfg.resultsDir,
+				&commander{verbose: cfg.verbose, ctx: ctx, dir: wt.Filesystem.Root()},
+				cfg.goTest, cfg.resultsDir,
 				cfg.packagePath,
 			)
-			tables, err := startBenchmark(env, benchmarker)
+			benchmarker.moduleDir = cfg.moduleDir
+			benchmarker.profile = cfg.profile
+			benchmarker.profilesURL = cfg.profilesURL
+			benchmarker.profileTop = cfg.profileTop
+			benchmarker.deltaTest = deltaTests[cfg.deltaTest]
+			benchmarker.alpha = cfg.alpha
+			if cfg.resultsStore != "" {
+				results, err := store.New(ctx, cfg.resultsStore, cfg.storeEndpoint)
+				if err != nil {
+					return errors.Wrap(err, "results store")
+				}
+				benchmarker.history = &history{store: results, repo: cfg.owner + "/" + cfg.repo, commits: cfg.trendCommits}
+			}
+			if cfg.pushgateway != "" || cfg.remoteWrite != "" {
+				branch, err := metricsBranch(env.Repo(), cfg.metricsBranch)
+				if err != nil {
+					return err
+				}
+				benchmarker.metrics = &benchMetrics{
+					pushgateway: cfg.pushgateway,
+					remoteWrite: cfg.remoteWrite,
+					repo:        cfg.owner + "/" + cfg.repo,
+					branch:      branch,
+				}
+			}
+			// Calibrating measures the variance of the runner, the noisy runs are kept.
+			if cfg.maxVariance > 0 && cmd != calibrateCmd.FullCommand() {
+				benchmarker.variance = &variance{max: cfg.maxVariance, reruns: cfg.reruns}
+			}
+			if cfg.inDocker {
+				benchmarker.docker = &cfg.docker
+				benchmarker.extraInfo = append(benchmarker.extraInfo, cfg.docker.String())
+			}
+
+			switch cmd {
+			case backfillCmd.FullCommand():
+				return bf.run(env, benchmarker)
+			case calibrateCmd.FullCommand():
+				cal.file = cfg.noiseFloorFile
+				return cal.run(env, benchmarker)
+			}
+
+			var tables []*benchstat.Table
+			if cmd == compareCmd.FullCommand() {
+				tables, err = compareRefs(env, benchmarker, refs)
+			} else {
+				tables, err = startBenchmark(env, benchmarker)
+			}
 			if err != nil {
 				pErr := env.PostErr(
-					fmt.Sprintf(
-						"```\n%s\n```\nError:\n```\n%s\n```",
-						strings.Join(benchmarker.benchmarkArgs, " "),
-						err.Error(),
-					),
+					err.Error(),
+					fmt.Sprintf("```\n%s\n```", strings.Join(benchmarker.benchmarkArgs, " ")),
 				)
 
 				if pErr != nil {
@@ -183,13 +648,37 @@ func main() {
 				}
 				return err
 			}
+			nf, err := loadNoiseFloor(cfg.noiseFloorFile)
+			if err != nil {
+				return err
+			}
+			if nf != nil {
+				applyNoiseFloor(tables, nf.Floors)
+				benchmarker.extraInfo = append(benchmarker.extraInfo, nf.String())
+			}
+			if info := benchmarker.significance(); info != "" {
+				benchmarker.extraInfo = append(benchmarker.extraInfo, info)
+			}
+			scaleTables(tables, cfg.rawValues)
 
 			// Post results.
 			// TODO (geekodour): probably post some kind of funcbench summary(?)
-			return env.PostResults(
-				tables,
-				fmt.Sprintf("```\n%s\n```", strings.Join(benchmarker.benchmarkArgs, " ")),
+			extraInfo := append(
+				[]string{fmt.Sprintf("```\n%s\n```", strings.Join(benchmarker.benchmarkArgs, " "))},
+				benchmarker.extraInfo...,
 			)
+			if err := env.PostResults(tables, extraInfo...); err != nil {
+				return err
+			}
+			if cmd == mergeQueueCmd.FullCommand() {
+				return mg.report(tables, extraInfo...)
+			}
+			if failOnRegression > 0 {
+				if regressed := regressions(tables, failOnRegression, gatedMetrics...); len(regressed) > 0 {
+					return errors.Errorf("%d benchmarks regressed by more than %.1f%%:\n%s", len(regressed), failOnRegression, strings.Join(regressed, "\n"))
+				}
+			}
+			return nil
 
 		}, func(err error) {
 			cancel()
@@ -212,7 +701,8 @@ func main() {
 }
 
 // startBenchmark returns the comparision results.
-// 1. If target is same as current ref, run sub-benchmarks and return instead (TODO).
+// 0. Check that the packages in the current worktree compile.
+// 1. Resolve the target, a branch, tag or commit, or HEAD for the uncommitted changes when the target is '.'.
 // 2. Execute benchmark against packages in the current worktree.
 // 3. Cleanup of worktree in case funcbench was run previously and checkout target worktree.
 // 4. Execute benchmark against packages in the new(target) worktree.
@@ -227,77 +717,59 @@ func startBenchmark(env Environment, bench *Benchmarker) ([]*benchstat.Table, er
 		return nil, errors.Wrap(err, "get head")
 	}
 
-	// TODO move it into env? since GitHub env doesn't need this check.
-	if _, err := bench.c.exec("sh", "-c", "git update-index -q --ignore-submodules --refresh && git diff-files --quiet --ignore-submodules --"); err != nil {
-		return nil, errors.Wrap(err, "not clean worktree")
-	}
-
-	if env.CompareTarget() == "." {
-		bench.logger.Println("Assuming sub-benchmarks comparison.")
-		subResult, err := bench.exec(wt.Filesystem.Root(), ref.Hash())
-		if err != nil {
-			return nil, errors.Wrap(err, "execute sub-benchmark")
+	target, newRev := env.CompareTarget(), ref.Hash().String()
+	if target == "." {
+		// Compare the uncommitted changes with HEAD. Without changes, like in GitHub mode,
+		// HEAD is compared with itself which shows the noise of the runner.
+		bench.logger.Println("Comparing the worktree with HEAD.")
+		target, newRev = "HEAD", newRev+dirtySuffix
+	} else {
+		// TODO move it into env? since GitHub env doesn't need this check.
+		if _, err := bench.c.exec("sh", "-c", "git update-index -q --ignore-submodules --refresh && git diff-files --quiet --ignore-submodules --"); err != nil {
+			return nil, errors.Wrap(err, "not clean worktree, commit the changes or compare them with HEAD using '.' as target")
 		}
+	}
 
-		cmps, err := bench.compareSubBenchmarks(subResult)
-		if err != nil {
-			return nil, errors.Wrap(err, "comparing sub benchmarks")
-		}
-		return cmps, nil
+	// Fail fast when the current ref doesn't compile.
+	if err := bench.checkBuild(wt.Filesystem.Root()); err != nil {
+		return nil, err
 	}
 
 	// Get info about target.
-	targetCommit := getTargetInfo(env.Repo(), env.CompareTarget())
-	if targetCommit == plumbing.ZeroHash {
-		return nil, fmt.Errorf("cannot find target %s", env.CompareTarget())
+	targetCommit, err := resolveTarget(env.Repo(), target)
+	if err != nil {
+		return nil, err
 	}
 
-	bench.logger.Println("Target:", targetCommit.String(), "Current Ref:", ref.Hash().String())
+	bench.logger.Println("Target:", targetCommit.String(), "Current Ref:", newRev)
 
-	if targetCommit == ref.Hash() {
+	if targetCommit.String() == newRev {
 		return nil, fmt.Errorf("target: %s is the same as current ref %s (or is on the same commit); No changes would be expected; Aborting", targetCommit, ref.String())
 	}
 
 	bench.logger.Println("Assuming comparing with target (clean workdir will be checked.)")
 
 	// Execute benchmark A.
-	newResult, err := bench.exec(wt.Filesystem.Root(), ref.Hash())
+	newResult, err := bench.exec(wt.Filesystem.Root(), newRev)
 	if err != nil {
 		return nil, errors.Wrapf(err, "execute benchmark for A: %v", ref.Name().String())
 	}
 
-	// TODO move the following part before 'Execute benchmark B.' into a function Benchmarker.switchToWorkTree.
-	// Best effort cleanup and checkout new worktree.
-	if err := os.RemoveAll(cmpWorkTreeDir); err != nil {
-		return nil, errors.Wrapf(err, "delete worktree at %s", cmpWorkTreeDir)
-	}
-
-	// TODO (geekodour): switch to worktree remove once we decide not to support git<2.17
-	if _, err := bench.c.exec("git", "worktree", "prune"); err != nil {
-		return nil, errors.Wrap(err, "worktree prune")
+	if err := env.PostProgress(fmt.Sprintf("benchmark of %v", env.CompareTarget())); err != nil {
+		return nil, errors.Wrap(err, "post progress comment")
 	}
 
-	bench.logger.Println("Checking out (in new workdir):", cmpWorkTreeDir, "commmit", targetCommit.String())
-	if _, err := bench.c.exec("git", "worktree", "add", "-f", cmpWorkTreeDir, targetCommit.String()); err != nil {
-		return nil, errors.Wrapf(err, "checkout %s in worktree %s", targetCommit.String(), cmpWorkTreeDir)
+	if err := bench.switchToWorkTree(cmpWorkTreeDir, targetCommit.String()); err != nil {
+		return nil, err
 	}
 
 	// Execute benchmark B.
-	oldResult, err := bench.exec(cmpWorkTreeDir, targetCommit)
+	oldResult, err := bench.exec(cmpWorkTreeDir, targetCommit.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "execute benchmark for B: %v", env.CompareTarget())
 	}
 
-	// Compare B vs A.
-	tables, err := compareBenchmarks(oldResult, newResult)
-	if err != nil {
-		return nil, errors.Wrap(err, "comparing benchmarks")
-	}
-
-	// Save hashes for info about benchmark.
-	env.SetHashStrings(targetCommit.String(), ref.Hash().String())
-
-	return tables, nil
+	return bench.compareResults(env, comparedRev{cmpWorkTreeDir, targetCommit.String(), oldResult}, comparedRev{wt.Filesystem.Root(), newRev, newResult})
 }
 
 func interrupt(logger Logger, cancel <-chan struct{}) error {
@@ -312,24 +784,68 @@ func interrupt(logger Logger, cancel <-chan struct{}) error {
 	}
 }
 
-// getTargetInfo returns the hash of the target if found,
-// otherwise returns plumbing.ZeroHash.
+// resolveTarget returns the hash of the commit of the target, a branch, a tag or a commit, possibly abbreviated.
+// The branches which aren't checked out are resolved from the origin remote, like in a fresh clone.
 // NOTE: if both a branch and a tag have the same name, it always chooses the branch name.
-func getTargetInfo(repo *git.Repository, target string) plumbing.Hash {
-	hash, err := repo.ResolveRevision(plumbing.Revision(target))
+func resolveTarget(repo *git.Repository, target string) (plumbing.Hash, error) {
+	if hash, err := repo.ResolveRevision(plumbing.Revision(target)); err == nil {
+		return *hash, nil
+	}
+	if hash, err := repo.ResolveRevision(plumbing.Revision("origin/" + target)); err == nil {
+		return *hash, nil
+	}
+	if abbreviatedHash.MatchString(target) {
+		commits, err := repo.CommitObjects()
+		if err != nil {
+			return plumbing.ZeroHash, errors.Wrap(err, "list commits")
+		}
+		var found []plumbing.Hash
+		if err := commits.ForEach(func(c *object.Commit) error {
+			if strings.HasPrefix(c.Hash.String(), target) {
+				found = append(found, c.Hash)
+			}
+			return nil
+		}); err != nil {
+			return plumbing.ZeroHash, errors.Wrap(err, "list commits")
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+		if len(found) > 1 {
+			return plumbing.ZeroHash, errors.Errorf("target %s is ambiguous, it is the prefix of the commits %v", target, found)
+		}
+	}
+	return plumbing.ZeroHash, errors.Errorf("cannot find target %s: it isn't a branch, tag or commit of the repository", target)
+}
+
+// metricsBranch returns the branch label of the metrics, the given one or the current branch.
+func metricsBranch(repo *git.Repository, branch string) (string, error) {
+	if branch != "" {
+		return branch, nil
+	}
+	ref, err := repo.Head()
 	if err != nil {
-		return plumbing.ZeroHash
+		return "", errors.Wrap(err, "get head")
+	}
+	if !ref.Name().IsBranch() {
+		return "", errors.New("HEAD isn't a branch, set the branch label of the metrics with --metrics-branch")
 	}
-	return *hash
+	return ref.Name().Short(), nil
 }
 
+// abbreviatedHash matches the abbreviated hashes of commits.
+var abbreviatedHash = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
 type commander struct {
 	verbose bool
 	ctx     context.Context
+	// Directory the commands run in, the root of the repository.
+	dir string
 }
 
 func (c *commander) exec(command ...string) (string, error) {
 	cmd := exec.CommandContext(c.ctx, command[0], command[1:]...)
+	cmd.Dir = c.dir
 	var b bytes.Buffer
 	cmd.Stdout = &b
 	cmd.Stderr = &b
@@ -14,7 +14,9 @@
 package main
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	fixtures "github.com/go-git/go-git-fixtures/v4"
 	"github.com/go-git/go-git/v5"
@@ -23,27 +25,160 @@ import (
 	"github.com/go-git/go-git/v5/storage/filesystem"
 )
 
-func TestGetTargetInfo(t *testing.T) {
+func TestResolveTarget(t *testing.T) {
 	f := fixtures.Basic().One()
 	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
 	r, err := git.Open(sto, f.DotGit())
 	if err != nil {
 		t.Errorf("error when open repository: %s", err)
 	}
+	// A branch which is only on the remote, like the branches of a fresh clone.
+	if err := r.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/feature", plumbing.NewHash("918c48b83bd081e863dbe1b80f8998f058cd8294"))); err != nil {
+		t.Fatal(err)
+	}
 
 	testCases := map[string]string{
-		"notFound": plumbing.ZeroHash.String(),
-		"HEAD":     "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
-		"master":   "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
-		"branch":   "e8d3ffab552895c19b9fcf7aa264d277cde33881",
-		"v1.0.0":   "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"HEAD":    "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"master":  "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
+		"branch":  "e8d3ffab552895c19b9fcf7aa264d277cde33881",
+		"feature": "918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"v1.0.0":  "6ecf0ef2c2dffb796033e5a02219af86ec6584e5",
 		"918c48b83bd081e863dbe1b80f8998f058cd8294": "918c48b83bd081e863dbe1b80f8998f058cd8294",
+		"918c48b": "918c48b83bd081e863dbe1b80f8998f058cd8294",
 	}
 
 	for target, hash := range testCases {
-		commit := getTargetInfo(r, target)
+		commit, err := resolveTarget(r, target)
+		if err != nil {
+			t.Errorf("error when get target %s: %v", target, err)
+			continue
+		}
 		if commit.String() != hash {
 			t.Errorf("error when get target %s, expect %s, got %s", target, hash, commit)
 		}
 	}
+
+	for _, target := range []string{"notFound", "abcdef1", "1111111111111111111111111111111111111111"} {
+		if _, err := resolveTarget(r, target); err == nil || !strings.Contains(err.Error(), "cannot find target "+target) {
+			t.Errorf("expected an error for the target %s, got %v", target, err)
+		}
+	}
+}
+
+func TestBackfillCommits(t *testing.T) {
+	f := fixtures.Basic().One()
+	sto := filesystem.NewStorage(f.DotGit(), cache.NewObjectLRUDefault())
+	r, err := git.Open(sto, f.DotGit())
+	if err != nil {
+		t.Fatalf("error when open repository: %s", err)
+	}
+
+	const initial = "b029517f6300c2da0f4b651b8642506cd6aaf45d"
+	testCases := []struct {
+		backfill backfill
+		expected []string
+		invalid  bool
+	}{
+		{
+			backfill: backfill{revisions: initial + "..master"},
+			expected: []string{"b029517", "b8e471f", "35e8510", "a5b8b09", "1669dce", "af2d6a6", "918c48b", "6ecf0ef"},
+		},
+		{
+			backfill: backfill{revisions: initial + "..master", firstParent: true},
+			expected: []string{"b029517", "35e8510", "1669dce", "af2d6a6", "918c48b", "6ecf0ef"},
+		},
+		{
+			backfill: backfill{revisions: initial + "..master", every: 3},
+			expected: []string{"b029517", "a5b8b09", "918c48b", "6ecf0ef"},
+		},
+		{
+			backfill: backfill{revisions: initial + "..master", shard: "1/3"},
+			expected: []string{"b8e471f", "1669dce", "6ecf0ef"},
+		},
+		{
+			backfill: backfill{revisions: initial + "..master", tags: "v1.*"},
+			expected: []string{"6ecf0ef"},
+		},
+		{backfill: backfill{revisions: "master.." + initial}, invalid: true},
+		{backfill: backfill{revisions: "master"}, invalid: true},
+		{backfill: backfill{revisions: initial + "..master", shard: "3/3"}, invalid: true},
+	}
+	for _, tc := range testCases {
+		commits, err := tc.backfill.commits(r)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%+v: expected an error", tc.backfill)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tc.backfill, err)
+			continue
+		}
+		got := make([]string, 0, len(commits))
+		for _, c := range commits {
+			got = append(got, c.Hash.String()[:7])
+		}
+		if strings.Join(got, " ") != strings.Join(tc.expected, " ") {
+			t.Errorf("%+v: expected %v, got %v", tc.backfill, tc.expected, got)
+		}
+	}
+}
+
+func TestBenchmarkArgs(t *testing.T) {
+	env := &Local{environment: environment{benchFunc: "BenchmarkQuery"}}
+	flags := goTestFlags{benchTime: 2 * time.Second, benchTimeout: time.Hour, count: 10, cpu: "1,4", args: "-tags=stringlabels"}
+	b := newBenchmarker(nil, env, nil, flags, "", "./promql")
+
+	expected := `go test -mod vendor -run "^$" -bench "^BenchmarkQuery$" -benchtime 2s -timeout 1h0m0s -count 10 -cpu 1,4 -tags=stringlabels ./promql`
+	if got := strings.Join(b.benchmarkArgs, " "); got != expected {
+		t.Errorf("expected the command:\n%s\ngot:\n%s", expected, got)
+	}
+
+	flags.benchmem, flags.cpu, flags.args = true, "", ""
+	b = newBenchmarker(nil, env, nil, flags, "", "./...")
+	expected = `go test -mod vendor -run "^$" -bench "^BenchmarkQuery$" -benchmem -benchtime 2s -timeout 1h0m0s -count 10 ./...`
+	if got := strings.Join(b.benchmarkArgs, " "); got != expected {
+		t.Errorf("expected the command:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// The build tags are also used to check the build.
+	flags.tags, flags.args = "stringlabels,dedupelabels", "-race"
+	b = newBenchmarker(nil, env, nil, flags, "", "./...")
+	expected = `go test -mod vendor -run "^$" -bench "^BenchmarkQuery$" -benchmem -benchtime 2s -timeout 1h0m0s -count 10 -tags stringlabels,dedupelabels -race ./...`
+	if got := strings.Join(b.benchmarkArgs, " "); got != expected {
+		t.Errorf("expected the command:\n%s\ngot:\n%s", expected, got)
+	}
+	if expected := "-tags stringlabels,dedupelabels -race"; b.goTestArgs != expected {
+		t.Errorf("expected the go test args %s, got %s", expected, b.goTestArgs)
+	}
+}
+
+func TestBenchRegex(t *testing.T) {
+	for regex, expected := range map[string]string{
+		".*":                                   "^.*$",
+		"BenchmarkQuery":                       "^BenchmarkQuery$",
+		"BenchmarkQuery|BenchmarkSelect":       "^(?:BenchmarkQuery|BenchmarkSelect)$",
+		"BenchmarkQuery/series=.*":             "^BenchmarkQuery$/^series=.*$",
+		"BenchmarkQuery/series=(1|10)/steps=1": "^BenchmarkQuery$/^(?:series=(1|10))$/^steps=1$",
+		`BenchmarkQuery/[a/b]/(c/d)`:           `^BenchmarkQuery$/^[a/b]$/^(c/d)$`,
+		`BenchmarkQuery\/x`:                    `^BenchmarkQuery\/x$`,
+	} {
+		if got := benchRegex(regex); got != expected {
+			t.Errorf("%s: expected %s, got %s", regex, expected, got)
+		}
+	}
+}
+
+func TestListedBenchmarks(t *testing.T) {
+	out := "TestQuery\nBenchmarkQuery\nBenchmarkRangeQuery\nExampleQuery\n" +
+		"ok  \tgithub.com/prometheus/prometheus/promql\t0.025s\n" +
+		"?   \tgithub.com/prometheus/prometheus/promql/parser\t[no test files]\n"
+	expected := []string{"BenchmarkQuery", "BenchmarkRangeQuery"}
+	if got := listedBenchmarks(out); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := listedBenchmarks("ok  \tgithub.com/prometheus/prometheus/promql\t0.025s\n"); len(got) != 0 {
+		t.Errorf("expected no benchmarks, got %v", got)
+	}
 }
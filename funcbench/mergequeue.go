@@ -0,0 +1,142 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// mergeGroup benchmarks a group of the GitHub merge queue against the commit it is built on,
+// as a required check failing on the regressions.
+type mergeGroup struct {
+	// Commit the group is compared with, the base_sha of the merge_group event when empty.
+	base string
+	// Event of the workflow run, $GITHUB_EVENT_PATH.
+	eventFile string
+	// Fail when a benchmark regresses by more than this percent.
+	maxRegression float64
+	// File the results are appended to as markdown, the job summary of GitHub Actions.
+	summaryFile string
+}
+
+// mergeGroupEvent is the payload of the merge_group event, see
+// https://docs.github.com/en/webhooks/webhook-events-and-payloads#merge_group.
+type mergeGroupEvent struct {
+	MergeGroup struct {
+		HeadSHA string `json:"head_sha"`
+		HeadRef string `json:"head_ref"`
+		BaseSHA string `json:"base_sha"`
+		BaseRef string `json:"base_ref"`
+	} `json:"merge_group"`
+}
+
+// resolveBase sets the base from the merge_group event unless it is given.
+func (mg *mergeGroup) resolveBase(logger Logger) error {
+	if mg.base != "" {
+		return nil
+	}
+	if mg.eventFile == "" {
+		return errors.New("no base given and no merge_group event found, set --base")
+	}
+	content, err := ioutil.ReadFile(mg.eventFile)
+	if err != nil {
+		return errors.Wrap(err, "reading the merge_group event")
+	}
+	var e mergeGroupEvent
+	if err := json.Unmarshal(content, &e); err != nil {
+		return errors.Wrapf(err, "parsing the merge_group event %s", mg.eventFile)
+	}
+	if e.MergeGroup.BaseSHA == "" {
+		return errors.Errorf("%s isn't a merge_group event, set --base", mg.eventFile)
+	}
+	mg.base = e.MergeGroup.BaseSHA
+	logger.Println("Benchmarking the merge group", e.MergeGroup.HeadRef, "versus", e.MergeGroup.BaseRef, "at", mg.base)
+	return nil
+}
+
+// regressions returns the benchmarks of the old-new tables which got worse by more than max percent,
+// in the given metrics or all of them when none are given.
+// The statistically insignificant deltas have no change and don't count.
+func regressions(tables []*benchstat.Table, max float64, metrics ...string) []string {
+	var regressed []string
+	for _, table := range tables {
+		if !table.OldNewDelta || !hasMetric(metrics, table.Metric) {
+			continue
+		}
+		for _, row := range table.Rows {
+			if row.Change >= 0 || math.Abs(row.PctDelta) <= max {
+				continue
+			}
+			regressed = append(regressed, fmt.Sprintf("%s %s %s", row.Benchmark, table.Metric, row.Delta))
+		}
+	}
+	return regressed
+}
+
+// gatedMetrics are the metrics whose regressions fail funcbench with --fail-on-regression.
+var gatedMetrics = []string{"time/op", "allocs/op"}
+
+func hasMetric(metrics []string, metric string) bool {
+	if len(metrics) == 0 {
+		return true
+	}
+	for _, m := range metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// report appends the results to the summary file and fails when a benchmark regressed by more than the max regression.
+func (mg *mergeGroup) report(tables []*benchstat.Table, extraInfo ...string) error {
+	regressed := regressions(tables, mg.maxRegression)
+
+	if mg.summaryFile != "" {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "### funcbench: merge group vs `%s`\n\n", mg.base)
+		if len(regressed) > 0 {
+			fmt.Fprintf(&b, "%d benchmarks regressed by more than %.1f%%:\n```\n%s\n```\n", len(regressed), mg.maxRegression, strings.Join(regressed, "\n"))
+		} else {
+			fmt.Fprintf(&b, "No benchmark regressed by more than %.1f%%.\n", mg.maxRegression)
+		}
+		fmt.Fprintf(&b, "\n<details><summary>Benchmark results</summary>\n\n%s\n", strings.Join(extraInfo, "\n"))
+		if err := formatMarkdown(&b, tables); err != nil {
+			return err
+		}
+		b.WriteString("</details>\n")
+
+		f, err := os.OpenFile(mg.summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return errors.Wrap(err, "open summary file")
+		}
+		defer f.Close()
+		if _, err := f.Write(b.Bytes()); err != nil {
+			return errors.Wrap(err, "write summary file")
+		}
+	}
+
+	if len(regressed) > 0 {
+		return errors.Errorf("%d benchmarks regressed by more than %.1f%%:\n%s", len(regressed), mg.maxRegression, strings.Join(regressed, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/perf/benchstat"
+)
+
+func TestMergeGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_merge_group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	event := filepath.Join(dir, "event.json")
+	content := `{"action": "checks_requested", "merge_group": {"head_sha": "ec26c3e", "head_ref": "refs/heads/gh-readonly-queue/main/pr-123-f95f852", "base_sha": "f95f852", "base_ref": "refs/heads/main"}}`
+	if err := ioutil.WriteFile(event, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l := &logger{Logger: log.New(ioutil.Discard, "", 0)}
+	mg := &mergeGroup{eventFile: event, maxRegression: 10, summaryFile: filepath.Join(dir, "summary.md")}
+	if err := mg.resolveBase(l); err != nil {
+		t.Fatal(err)
+	}
+	if mg.base != "f95f852" {
+		t.Errorf("expected the base of the merge group, got %q", mg.base)
+	}
+	if err := (&mergeGroup{}).resolveBase(l); err == nil {
+		t.Error("expected an error without a base or an event")
+	}
+
+	c := &benchstat.Collection{DeltaTest: benchstat.NoDeltaTest}
+	c.AddConfig("old", []byte("BenchmarkQuery-4	100	1000 ns/op	64 B/op\nBenchmarkParse-4	100	500 ns/op	32 B/op"))
+	c.AddConfig("new", []byte("BenchmarkQuery-4	100	1200 ns/op	64 B/op\nBenchmarkParse-4	100	400 ns/op	34 B/op"))
+	tables := c.Tables()
+
+	if got, expected := regressions(tables, 10), []string{"Query-4 time/op +20.00%"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the regressions %v, got %v", expected, got)
+	}
+	if got := regressions(tables, 3); len(got) != 2 {
+		t.Errorf("expected the time and alloc regressions, got %v", got)
+	}
+	if got, expected := regressions(tables, 3, gatedMetrics...), []string{"Query-4 time/op +20.00%"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the regressions of the gated metrics %v, got %v", expected, got)
+	}
+
+	err = mg.report(tables)
+	if err == nil || !strings.Contains(err.Error(), "1 benchmarks regressed by more than 10.0%") {
+		t.Errorf("expected the check to fail with the regression, got %v", err)
+	}
+	summary, err := ioutil.ReadFile(mg.summaryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(summary), "merge group vs `f95f852`") || !strings.Contains(string(summary), "Query-4 time/op +20.00%") {
+		t.Errorf("unexpected summary:\n%s", summary)
+	}
+
+	mg.maxRegression = 25
+	if err := mg.report(tables); err != nil {
+		t.Errorf("expected the check to pass below the max regression, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// benchMetrics pushes the results of the benchmarks as metrics to a Pushgateway or a remote write endpoint,
+// to chart the performance of a branch over its commits, eg. in Grafana.
+type benchMetrics struct {
+	// URL of the Pushgateway, the metrics are pushed to the funcbench job grouped by repo, branch and regex.
+	pushgateway string
+	// URL of the remote write endpoint, the samples get the time of the run, or of the commit when backfilling.
+	remoteWrite string
+	// Repository of the results, as owner/repo.
+	repo   string
+	branch string
+
+	client *http.Client
+}
+
+// benchMetricNames are the metrics of the units of the results, the other units aren't pushed.
+var benchMetricNames = map[string]string{
+	"ns/op":     "funcbench_ns_per_op",
+	"B/op":      "funcbench_bytes_per_op",
+	"allocs/op": "funcbench_allocs_per_op",
+}
+
+var benchMetricHelps = map[string]string{
+	"funcbench_ns_per_op":     "Mean time of an iteration of the benchmark in nanoseconds.",
+	"funcbench_bytes_per_op":  "Mean bytes allocated by an iteration of the benchmark.",
+	"funcbench_allocs_per_op": "Mean allocations of an iteration of the benchmark.",
+}
+
+// push pushes the mean of each metric of the results of a commit, the results of the uncommitted changes aren't pushed.
+func (m *benchMetrics) push(benchFunc, rev, resultFile string, ts time.Time) error {
+	if strings.HasSuffix(rev, dirtySuffix) {
+		return nil
+	}
+	content, err := ioutil.ReadFile(resultFile)
+	if err != nil {
+		return err
+	}
+	samples, err := m.samples(benchFunc, rev, content, ts)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	if m.pushgateway != "" {
+		if err := m.pushToGateway(benchFunc, samples); err != nil {
+			return err
+		}
+	}
+	if m.remoteWrite != "" {
+		if err := m.writeRemote(samples); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// samples returns the samples of the results, sorted by benchmark and metric.
+func (m *benchMetrics) samples(benchFunc, rev string, content []byte, ts time.Time) (model.Samples, error) {
+	means, err := resultMeans(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the results")
+	}
+	var samples model.Samples
+	for k, v := range means {
+		name, ok := benchMetricNames[k.unit]
+		if !ok {
+			continue
+		}
+		samples = append(samples, &model.Sample{
+			Metric: model.Metric{
+				model.MetricNameLabel: model.LabelValue(name),
+				model.JobLabel:        "funcbench",
+				"repo":                model.LabelValue(m.repo),
+				"branch":              model.LabelValue(m.branch),
+				"regex":               model.LabelValue(benchFunc),
+				"benchmark":           model.LabelValue(k.benchmark),
+				"commit":              model.LabelValue(rev),
+			},
+			Value:     model.SampleValue(v),
+			Timestamp: model.TimeFromUnixNano(ts.UnixNano()),
+		})
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].Metric.String() < samples[j].Metric.String()
+	})
+	return samples, nil
+}
+
+// pushToGateway replaces the metrics of the group of the branch and regex, which only holds the last commit pushed.
+func (m *benchMetrics) pushToGateway(benchFunc string, samples model.Samples) error {
+	reg := prometheus.NewRegistry()
+	gauges := map[model.LabelValue]*prometheus.GaugeVec{}
+	for _, s := range samples {
+		name := s.Metric[model.MetricNameLabel]
+		g, ok := gauges[name]
+		if !ok {
+			// The Pushgateway adds the grouping labels.
+			g = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: string(name), Help: benchMetricHelps[string(name)]}, []string{"benchmark", "commit"})
+			reg.MustRegister(g)
+			gauges[name] = g
+		}
+		g.WithLabelValues(string(s.Metric["benchmark"]), string(s.Metric["commit"])).Set(float64(s.Value))
+	}
+	err := push.New(m.pushgateway, "funcbench").
+		Grouping("repo", m.repo).Grouping("branch", m.branch).Grouping("regex", benchFunc).
+		Client(m.httpClient()).Gatherer(reg).Push()
+	return errors.Wrapf(err, "pushing the metrics to %v", m.pushgateway)
+}
+
+// writeRemote sends the samples to the remote write endpoint, as a snappy compressed protobuf WriteRequest.
+func (m *benchMetrics) writeRemote(samples model.Samples) error {
+	req, err := http.NewRequest("POST", m.remoteWrite, bytes.NewReader(snappy.Encode(nil, encodeWriteRequest(samples))))
+	if err != nil {
+		return errors.Wrap(err, "creating the remote write request")
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	resp, err := m.httpClient().Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "writing the metrics to %v", m.remoteWrite)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("writing the metrics to %v: unexpected status %s: %s", m.remoteWrite, resp.Status, body)
+	}
+	return nil
+}
+
+func (m *benchMetrics) httpClient() *http.Client {
+	if m.client != nil {
+		return m.client
+	}
+	return &http.Client{Timeout: time.Minute}
+}
+
+// encodeWriteRequest encodes the samples as the WriteRequest protobuf message of the remote write protocol,
+// a time series with sorted labels for each sample.
+func encodeWriteRequest(samples model.Samples) []byte {
+	var req []byte
+	for _, s := range samples {
+		names := make([]string, 0, len(s.Metric))
+		for n := range s.Metric {
+			names = append(names, string(n))
+		}
+		sort.Strings(names)
+
+		var series []byte
+		for _, n := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, n)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, string(s.Metric[model.LabelName(n)]))
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(float64(s.Value)))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, series)
+	}
+	return req
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestBenchMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	result := filepath.Join(dir, "result.out")
+	content := "BenchmarkQuery-8 100 200 ns/op 64 B/op 2 allocs/op 5 series/op\n" +
+		"BenchmarkQuery-8 100 400 ns/op 64 B/op 2 allocs/op 5 series/op\n"
+	if err := ioutil.WriteFile(result, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var pushPath, pushed string
+	var written []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		if r.URL.Path == "/api/v1/write" {
+			req, err := snappy.Decode(nil, body)
+			if err != nil {
+				t.Error(err)
+			}
+			written = decodeWriteRequest(t, req)
+			return
+		}
+		pushPath, pushed = r.URL.Path, string(body)
+	}))
+	defer srv.Close()
+
+	m := &benchMetrics{pushgateway: srv.URL, remoteWrite: srv.URL + "/api/v1/write", repo: "prometheus/prometheus", branch: "main"}
+	ts := time.Unix(1600000000, 0)
+	if err := m.push("BenchmarkQuery", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5", result, ts); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(pushPath, "/metrics/job/funcbench/") || !strings.Contains(pushPath, "/branch/main") || !strings.Contains(pushPath, "/regex/BenchmarkQuery") {
+		t.Errorf("unexpected push path %s", pushPath)
+	}
+	// The samples aren't pushed as text, look for the labels and values.
+	for _, s := range []string{"funcbench_ns_per_op", "funcbench_bytes_per_op", "funcbench_allocs_per_op", "Query-8", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"} {
+		if !strings.Contains(pushed, s) {
+			t.Errorf("expected %s in the pushed metrics", s)
+		}
+	}
+	if strings.Contains(pushed, "series") {
+		t.Error("expected the custom metrics not to be pushed")
+	}
+
+	labels := `benchmark="Query-8",branch="main",commit="6ecf0ef2c2dffb796033e5a02219af86ec6584e5",job="funcbench",regex="BenchmarkQuery",repo="prometheus/prometheus"`
+	expected := []string{
+		fmt.Sprintf(`__name__="funcbench_allocs_per_op",%s 2 %d`, labels, ts.UnixNano()/1e6),
+		fmt.Sprintf(`__name__="funcbench_bytes_per_op",%s 64 %d`, labels, ts.UnixNano()/1e6),
+		fmt.Sprintf(`__name__="funcbench_ns_per_op",%s 300 %d`, labels, ts.UnixNano()/1e6),
+	}
+	if strings.Join(written, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected the written samples:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(written, "\n"))
+	}
+
+	// The uncommitted changes aren't pushed.
+	written = nil
+	if err := m.push("BenchmarkQuery", "6ecf0ef2c2dffb796033e5a02219af86ec6584e5"+dirtySuffix, result, ts); err != nil {
+		t.Fatal(err)
+	}
+	if written != nil {
+		t.Errorf("expected no samples for the uncommitted changes, got %v", written)
+	}
+}
+
+// decodeWriteRequest returns the samples of a WriteRequest as name="value",... value timestamp, sorted.
+func decodeWriteRequest(t *testing.T, b []byte) []string {
+	var samples []string
+	fields := func(b []byte, f func(num protowire.Number, v []byte, n uint64)) {
+		for len(b) > 0 {
+			num, typ, l := protowire.ConsumeTag(b)
+			if l < 0 {
+				t.Fatal("invalid WriteRequest")
+			}
+			b = b[l:]
+			switch typ {
+			case protowire.BytesType:
+				var v []byte
+				v, l = protowire.ConsumeBytes(b)
+				if l >= 0 {
+					f(num, v, 0)
+				}
+			case protowire.Fixed64Type:
+				var v uint64
+				v, l = protowire.ConsumeFixed64(b)
+				f(num, nil, v)
+			case protowire.VarintType:
+				var v uint64
+				v, l = protowire.ConsumeVarint(b)
+				f(num, nil, v)
+			default:
+				t.Fatalf("unexpected wire type %v", typ)
+			}
+			if l < 0 {
+				t.Fatal("invalid WriteRequest")
+			}
+			b = b[l:]
+		}
+	}
+	fields(b, func(_ protowire.Number, series []byte, _ uint64) {
+		var labels []string
+		var sample string
+		fields(series, func(num protowire.Number, v []byte, _ uint64) {
+			if num == 1 {
+				var name, value string
+				fields(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+				return
+			}
+			var value float64
+			var ts uint64
+			fields(v, func(num protowire.Number, _ []byte, n uint64) {
+				if num == 1 {
+					value = math.Float64frombits(n)
+				} else {
+					ts = n
+				}
+			})
+			sample = fmt.Sprintf("%v %d", value, ts)
+		})
+		samples = append(samples, strings.Join(labels, ",")+" "+sample)
+	})
+	sort.Strings(samples)
+	return samples
+}
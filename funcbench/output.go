@@ -0,0 +1,168 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// outputFormats are the formats of the results of the --output flag.
+var outputFormats = []string{"text", "md", "json", "benchfmt"}
+
+// jsonResults are the results in the json output format.
+type jsonResults struct {
+	BenchFunc string      `json:"benchFunc"`
+	Target    string      `json:"target"`
+	OldCommit string      `json:"oldCommit"`
+	NewCommit string      `json:"newCommit"`
+	ExtraInfo []string    `json:"extraInfo,omitempty"`
+	Tables    []jsonTable `json:"tables"`
+}
+
+type jsonTable struct {
+	Metric  string    `json:"metric"`
+	Configs []string  `json:"configs"`
+	Rows    []jsonRow `json:"rows"`
+}
+
+type jsonRow struct {
+	Benchmark string `json:"benchmark"`
+	Group     string `json:"group,omitempty"`
+	// Metrics of the benchmark in each config of the table.
+	Metrics []jsonMetrics `json:"metrics"`
+	// The delta between the old and new results, ~ when it isn't significant.
+	Delta    string  `json:"delta,omitempty"`
+	PctDelta float64 `json:"pctDelta"`
+	// Change is -1 when the new results are worse, +1 when they are better and 0 when the delta isn't significant.
+	Change int    `json:"change"`
+	Note   string `json:"note,omitempty"`
+}
+
+type jsonMetrics struct {
+	Unit string `json:"unit"`
+	// Values are the samples of the runs, RValues the samples without the outliers.
+	Values  []float64 `json:"values"`
+	RValues []float64 `json:"rValues"`
+	Min     float64   `json:"min"`
+	Mean    float64   `json:"mean"`
+	Max     float64   `json:"max"`
+	// Diff is the variation of the samples, like ±2%.
+	Diff string `json:"diff"`
+}
+
+// writeResults writes the results in the output format.
+// The benchfmt format has the go test outputs of both commits, labelled with their commit,
+// for benchstat or other tools to compare them later.
+func (e *environment) writeResults(w io.Writer, format string, tables []*benchstat.Table, extraInfo ...string) error {
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "Results:\nOld: %s\nNew: %s\n", e.compareTargetHashString, e.repoHeadHashString)
+		var buf bytes.Buffer
+		benchstat.FormatText(&buf, tables)
+		if len(extraInfo) > 0 {
+			fmt.Fprintf(&buf, "\n%s\n", strings.Join(extraInfo, "\n"))
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	case "md":
+		var buf bytes.Buffer
+		if len(extraInfo) > 0 {
+			fmt.Fprintf(&buf, "%s\n", strings.Join(extraInfo, "\n"))
+		}
+		if err := formatMarkdown(&buf, tables); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	case "json":
+		r := jsonResults{
+			BenchFunc: e.benchFunc,
+			Target:    e.compareTarget,
+			OldCommit: e.compareTargetHashString,
+			NewCommit: e.repoHeadHashString,
+			ExtraInfo: extraInfo,
+			Tables:    make([]jsonTable, 0, len(tables)),
+		}
+		for _, t := range tables {
+			jt := jsonTable{Metric: t.Metric, Configs: t.Configs, Rows: make([]jsonRow, 0, len(t.Rows))}
+			for _, row := range t.Rows {
+				jr := jsonRow{
+					Benchmark: row.Benchmark,
+					Group:     row.Group,
+					Delta:     row.Delta,
+					PctDelta:  row.PctDelta,
+					Change:    row.Change,
+					Note:      row.Note,
+				}
+				for _, m := range row.Metrics {
+					jr.Metrics = append(jr.Metrics, jsonMetrics{
+						Unit:    m.Unit,
+						Values:  m.Values,
+						RValues: m.RValues,
+						Min:     m.Min,
+						Mean:    m.Mean,
+						Max:     m.Max,
+						Diff:    m.FormatDiff(),
+					})
+				}
+				jt.Rows = append(jt.Rows, jr)
+			}
+			r.Tables = append(r.Tables, jt)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "benchfmt":
+		for _, f := range []struct {
+			name, commit, file string
+		}{
+			{"old", e.compareTargetHashString, e.compareTargetResultFile},
+			{"new", e.repoHeadHashString, e.repoHeadResultFile},
+		} {
+			if f.file == "" {
+				return errors.Errorf("no %s results to write", f.name)
+			}
+			content, err := ioutil.ReadFile(f.file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "commit: %s\nfuncbench: %s\n\n%s\n", f.commit, f.name, bytes.TrimSpace(content))
+		}
+		return nil
+	}
+	return errors.Errorf("unknown output format %q, expected one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// writeOutputFile writes the results to the output file in the output format, when there is one.
+func (e *environment) writeOutputFile(tables []*benchstat.Table, extraInfo ...string) error {
+	if e.outputFile == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := e.writeResults(&buf, e.output, tables, extraInfo...); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(e.outputFile, buf.Bytes(), 0644); err != nil {
+		return errors.Wrap(err, "write output file")
+	}
+	e.logger.Println("Results written to", e.outputFile)
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := &environment{benchFunc: "BenchmarkQuery", compareTarget: "master"}
+	e.SetHashStrings("f95f852", "ec26c3e")
+	files := []string{filepath.Join(dir, "old.out"), filepath.Join(dir, "new.out")}
+	for i, content := range []string{
+		"goos: linux\nBenchmarkQuery-4\t100\t1000 ns/op\t64 B/op\nBenchmarkQuery-4\t100\t1010 ns/op\t64 B/op\nPASS\n",
+		"goos: linux\nBenchmarkQuery-4\t100\t1200 ns/op\t64 B/op\nBenchmarkQuery-4\t100\t1190 ns/op\t64 B/op\nPASS\n",
+	} {
+		if err := ioutil.WriteFile(files[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.SetResultFiles(files[0], files[1])
+	tables, err := compareBenchmarks(nil, 0.05, files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.writeResults(&buf, "json", tables, "info"); err != nil {
+		t.Fatal(err)
+	}
+	var r jsonResults
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.OldCommit != "f95f852" || r.NewCommit != "ec26c3e" || len(r.Tables) != 2 || r.Tables[0].Metric != "time/op" {
+		t.Fatalf("unexpected results: %+v", r)
+	}
+	row := r.Tables[0].Rows[0]
+	if row.Benchmark != "Query-4" || row.Change != -1 || row.Delta != "+18.91%" || len(row.Metrics) != 2 {
+		t.Errorf("unexpected row: %+v", row)
+	}
+	if expected := []float64{1200, 1190}; !reflect.DeepEqual(row.Metrics[1].Values, expected) {
+		t.Errorf("expected the samples %v, got %v", expected, row.Metrics[1].Values)
+	}
+
+	buf.Reset()
+	if err := e.writeResults(&buf, "benchfmt", tables); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"commit: f95f852\nfuncbench: old\n\ngoos: linux\nBenchmarkQuery-4\t100\t1000 ns/op",
+		"commit: ec26c3e\nfuncbench: new\n\ngoos: linux\nBenchmarkQuery-4\t100\t1200 ns/op",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in:\n%s", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := e.writeResults(&buf, "md", tables, "info"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "info\n") || !strings.Contains(buf.String(), "Query-4|1.00µs ± 0%|1.20µs ± 0%|+18.91%") {
+		t.Errorf("unexpected markdown:\n%s", buf.String())
+	}
+
+	if err := e.writeResults(&buf, "html", tables); err == nil {
+		t.Error("expected an error with an unknown format")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/pkg/errors"
+)
+
+// functionDelta is the change of the time spent in a function between two profiles.
+type functionDelta struct {
+	name      string
+	flat, cum int64
+}
+
+// profileDiff returns the top functions whose flat time changed the most between the old and new CPU profiles,
+// like `pprof -top -diff_base old new`, or an empty string when none changed.
+// The percentages are relative to the total time of the old profile.
+func profileDiff(oldFile, newFile string, top int) (string, error) {
+	oldProfile, err := readProfile(oldFile)
+	if err != nil {
+		return "", err
+	}
+	newProfile, err := readProfile(newFile)
+	if err != nil {
+		return "", err
+	}
+	index, err := newProfile.SampleIndexByName("")
+	if err != nil {
+		return "", err
+	}
+	var total int64
+	for _, s := range oldProfile.Sample {
+		total += s.Value[index]
+	}
+
+	// Subtracting the old profile from the new one is what pprof does with -diff_base.
+	oldProfile.Scale(-1)
+	diff, err := profile.Merge([]*profile.Profile{newProfile, oldProfile})
+	if err != nil {
+		return "", errors.Wrap(err, "merging the profiles")
+	}
+
+	deltas := map[string]*functionDelta{}
+	delta := func(name string) *functionDelta {
+		d, ok := deltas[name]
+		if !ok {
+			d = &functionDelta{name: name}
+			deltas[name] = d
+		}
+		return d
+	}
+	for _, s := range diff.Sample {
+		v := s.Value[index]
+		if v == 0 || len(s.Location) == 0 {
+			continue
+		}
+		// The first line of the first location is the innermost function, even when inlined.
+		if lines := s.Location[0].Line; len(lines) > 0 && lines[0].Function != nil {
+			delta(lines[0].Function.Name).flat += v
+		}
+		// Recursive functions count once in the cumulative time of a sample.
+		seen := map[string]bool{}
+		for _, l := range s.Location {
+			for _, line := range l.Line {
+				if line.Function == nil || seen[line.Function.Name] {
+					continue
+				}
+				seen[line.Function.Name] = true
+				delta(line.Function.Name).cum += v
+			}
+		}
+	}
+
+	sorted := make([]*functionDelta, 0, len(deltas))
+	for _, d := range deltas {
+		if d.flat != 0 || d.cum != 0 {
+			sorted = append(sorted, d)
+		}
+	}
+	if len(sorted) == 0 {
+		return "", nil
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if a, b := abs(sorted[i].flat), abs(sorted[j].flat); a != b {
+			return a > b
+		}
+		if a, b := abs(sorted[i].cum), abs(sorted[j].cum); a != b {
+			return a > b
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	if top > 0 && len(sorted) > top {
+		sorted = sorted[:top]
+	}
+
+	unit := diff.SampleType[index].Unit
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "flat\tflat%\tcum\tcum%\t")
+	for _, d := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t %s\n", formatProfileValue(d.flat, unit), percent(d.flat, total), formatProfileValue(d.cum, unit), percent(d.cum, total), d.name)
+	}
+	if err := tw.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func readProfile(file string) (*profile.Profile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing the profile %s", file)
+	}
+	return p, nil
+}
+
+// formatProfileValue formats a signed value of the profile, the nanoseconds as a duration.
+func formatProfileValue(v int64, unit string) string {
+	s := fmt.Sprintf("%d%s", v, unit)
+	if unit == "nanoseconds" {
+		s = time.Duration(v).String()
+	}
+	if v > 0 {
+		return "+" + s
+	}
+	return s
+}
+
+func percent(v, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f%%", 100*float64(v)/float64(total))
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// writeCPUProfile writes a CPU profile with the nanoseconds spent in the stacks, leaf function first.
+func writeCPUProfile(t *testing.T, file string, stacks map[string]int64) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType: &profile.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:     10000000,
+	}
+	functions := map[string]*profile.Location{}
+	for stack, ns := range stacks {
+		s := &profile.Sample{Value: []int64{ns / p.Period, ns}}
+		for _, name := range strings.Split(stack, ";") {
+			l, ok := functions[name]
+			if !ok {
+				id := uint64(len(functions) + 1)
+				f := &profile.Function{ID: id, Name: name}
+				l = &profile.Location{ID: id, Address: id, Line: []profile.Line{{Function: f}}}
+				functions[name] = l
+				p.Function = append(p.Function, f)
+				p.Location = append(p.Location, l)
+			}
+			s.Location = append(s.Location, l)
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := p.Write(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfileDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_profilediff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldFile, newFile := filepath.Join(dir, "old.pprof"), filepath.Join(dir, "new.pprof")
+	writeCPUProfile(t, oldFile, map[string]int64{
+		"parse;BenchmarkQuery":          800e6,
+		"lookup;query;BenchmarkQuery":   200e6,
+		"unchanged;BenchmarkQuery":      100e6,
+		"mallocgc;query;BenchmarkQuery": 100e6,
+	})
+	writeCPUProfile(t, newFile, map[string]int64{
+		"parse;BenchmarkQuery":          600e6,
+		"lookup;query;BenchmarkQuery":   500e6,
+		"unchanged;BenchmarkQuery":      100e6,
+		"mallocgc;query;BenchmarkQuery": 110e6,
+	})
+
+	diff, err := profileDiff(oldFile, newFile, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(diff), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected the header and 2 functions, got:\n%s", diff)
+	}
+	for i, expected := range [][]string{
+		{"flat", "flat%", "cum", "cum%"},
+		{"+300ms", "+25.00%", "+300ms", "+25.00%", "lookup"},
+		{"-200ms", "-16.67%", "-200ms", "-16.67%", "parse"},
+	} {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(expected, " ") {
+			t.Errorf("line %d: expected %v, got %v", i, expected, got)
+		}
+	}
+
+	diff, err = profileDiff(oldFile, newFile, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"0s +0.00% +310ms +25.83% query", "0s +0.00% +110ms +9.17% BenchmarkQuery"} {
+		if !strings.Contains(strings.Join(strings.Fields(diff), " "), expected) {
+			t.Errorf("expected %q in:\n%s", expected, diff)
+		}
+	}
+	if strings.Contains(diff, "unchanged") {
+		t.Errorf("expected no unchanged functions in:\n%s", diff)
+	}
+
+	diff, err = profileDiff(oldFile, oldFile, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("expected no diff of the same profile, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// repoConfig is the funcbench configuration kept in the benchmarked repository.
+type repoConfig struct {
+	file string
+
+	Tiers     map[string]tier `yaml:"tiers"`
+	Baselines []baseline      `yaml:"baselines"`
+}
+
+// tier is a named set of benchmarks configured by the benchmarked repository,
+// like a quick subset run on every PR and the full suite run on demand.
+type tier struct {
+	Name           string        `yaml:"-"`
+	Description    string        `yaml:"description"`
+	BenchFuncRegex string        `yaml:"bench_func_regex"`
+	PackagePath    string        `yaml:"package_path"`
+	BenchTime      time.Duration `yaml:"bench_time"`
+	Timeout        time.Duration `yaml:"timeout"`
+	// MaxRegression in percent fails the merge queue check when a benchmark regresses by more.
+	MaxRegression float64 `yaml:"max_regression"`
+}
+
+// baseline pins the target compared against when none is given, for the PRs to the matching branches.
+type baseline struct {
+	// Branch is a fully anchored regex, whose submatches can be used in the target as $1.
+	Branch string `yaml:"branch"`
+	Target string `yaml:"target"`
+}
+
+// loadRepoConfig reads the config file, relative to the root of the benchmarked repository.
+// A missing file is an empty config.
+func loadRepoConfig(root, file string) (*repoConfig, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(root, file)
+	}
+	cfg := &repoConfig{file: file}
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading repo config %s", file)
+	}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, errors.Wrapf(err, "parsing repo config %s", file)
+	}
+	return cfg, nil
+}
+
+// tier returns the named tier.
+func (c *repoConfig) tier(name string) (*tier, error) {
+	t, ok := c.Tiers[name]
+	if !ok {
+		var names []string
+		for n := range c.Tiers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("tier %q not found in %s, available tiers: %s", name, c.file, strings.Join(names, ", "))
+	}
+	t.Name = name
+	return &t, nil
+}
+
+// baseline returns the target of the first baseline matching the branch, or an empty string when none matches.
+func (c *repoConfig) baseline(branch string) (string, error) {
+	for _, b := range c.Baselines {
+		re, err := regexp.Compile("^(?:" + b.Branch + ")$")
+		if err != nil {
+			return "", errors.Wrapf(err, "parsing baseline branch %q of %s", b.Branch, c.file)
+		}
+		m := re.FindStringSubmatchIndex(branch)
+		if m == nil {
+			continue
+		}
+		return string(re.ExpandString(nil, b.Target, branch, m)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepoConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_repo_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := `tiers:
+  quick:
+    description: A subset run on every PR, comment /funcbench full master for the full suite.
+    bench_func_regex: BenchmarkQuery.*
+    package_path: ./promql
+    bench_time: 2s
+  full:
+    bench_func_regex: .*
+baselines:
+  - branch: release-2\.50
+    target: v2.50.1
+  - branch: release-(\d+\.\d+)
+    target: v$1.0
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, ".funcbench.yml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &logger{Logger: log.New(ioutil.Discard, "", 0)}
+	e := environment{logger: l, benchFunc: "BenchmarkHead", tierName: "quick", repoConfigFile: ".funcbench.yml"}
+	if err := e.loadRepoConfig(dir, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if e.benchFunc != "BenchmarkQuery.*" {
+		t.Errorf("the tier should override the benchmark func regex, got %q", e.benchFunc)
+	}
+	if e.tier.PackagePath != "./promql" || e.tier.BenchTime != 2*time.Second {
+		t.Errorf("unexpected tier %+v", e.tier)
+	}
+
+	c, err := renderComment(defaultCommentTemplates.Results, commentData{Tier: e.tier.Name, TierDescription: e.tier.Description})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(c, "Results of the `quick` benchmark tier: A subset run on every PR") {
+		t.Errorf("the results should explain the tier, got:\n%s", c)
+	}
+
+	if e.compareTarget != "" {
+		t.Errorf("no baseline is pinned for main, got %q", e.compareTarget)
+	}
+
+	for branch, target := range map[string]string{
+		"release-2.50":      "v2.50.1",
+		"release-2.51":      "v2.51.0",
+		"release-2.51-rc":   "",
+		"feature/release-3": "",
+	} {
+		e = environment{logger: l, repoConfigFile: ".funcbench.yml"}
+		if err := e.loadRepoConfig(dir, branch); err != nil {
+			t.Fatal(err)
+		}
+		if e.compareTarget != target {
+			t.Errorf("expected baseline %q for branch %s, got %q", target, branch, e.compareTarget)
+		}
+	}
+	e = environment{logger: l, repoConfigFile: ".funcbench.yml", compareTarget: "main"}
+	if err := e.loadRepoConfig(dir, "release-2.50"); err != nil {
+		t.Fatal(err)
+	}
+	if e.compareTarget != "main" {
+		t.Errorf("a given target should not be overridden by the baseline, got %q", e.compareTarget)
+	}
+
+	e = environment{logger: l, tierName: "nightly", repoConfigFile: filepath.Join(dir, ".funcbench.yml")}
+	if err := e.loadRepoConfig("/nonexistent", "main"); err == nil || !strings.Contains(err.Error(), "available tiers: full, quick") {
+		t.Errorf("expected an error listing the available tiers, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// commentSyntax is the syntax of the /funcbench command of the comments triggering the benchmarks.
+const commentSyntax = "/funcbench [<tier> [<branch|tag|commit>] | <branch|tag|commit> [<benchmark function regex> [<package path>]]] " +
+	"[count=<n>] [benchtime=<duration>] [cpu=<list>]"
+
+// commentTiers are the tiers which can be given instead of a target in a comment.
+var commentTiers = map[string]bool{"quick": true, "full": true}
+
+// commentTarget matches the branches, tags and commits of a comment.
+var commentTarget = regexp.MustCompile(`^[\w\-/.]+$`)
+
+// commentCommand is the /funcbench command of a comment, the arguments which aren't given are empty.
+type commentCommand struct {
+	tier           string
+	target         string
+	benchFuncRegex string
+	packagePath    string
+
+	count     int
+	benchTime time.Duration
+	cpu       string
+}
+
+// parseComment parses the first line of the comment starting with /funcbench, the other lines are ignored.
+// The settings like count=<n> come after the other arguments.
+func parseComment(body string) (*commentCommand, error) {
+	var args []string
+	found := false
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "/funcbench" {
+			args, found = fields[1:], true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("no /funcbench command in the comment")
+	}
+
+	c := &commentCommand{}
+	var positional []string
+	settings := map[string]bool{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		switch kv[0] {
+		case "count", "benchtime", "cpu":
+			if len(kv) == 2 {
+				if settings[kv[0]] {
+					return nil, errors.Errorf("%s is set twice", kv[0])
+				}
+				settings[kv[0]] = true
+				if err := c.set(kv[0], kv[1]); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		if len(settings) > 0 {
+			return nil, errors.Errorf("unexpected %q after the settings, the settings like count=<n> come last", arg)
+		}
+		positional = append(positional, arg)
+	}
+
+	if len(positional) > 0 && commentTiers[positional[0]] {
+		c.tier, positional = positional[0], positional[1:]
+		if len(positional) > 1 {
+			return nil, errors.Errorf("unexpected %q, a tier only takes a branch, tag or commit", positional[1])
+		}
+	}
+	if len(positional) > 3 {
+		return nil, errors.Errorf("unexpected %q, expected at most a branch, tag or commit, a benchmark function regex and a package path", positional[3])
+	}
+	if len(positional) > 0 {
+		c.target = positional[0]
+		if !commentTarget.MatchString(c.target) {
+			return nil, errors.Errorf("invalid target %q, expected a branch, tag or commit", c.target)
+		}
+	}
+	if len(positional) > 1 {
+		c.benchFuncRegex = positional[1]
+		for _, l := range splitBenchRegex(c.benchFuncRegex) {
+			if _, err := regexp.Compile(l); err != nil {
+				return nil, errors.Wrapf(err, "invalid benchmark function regex %q", c.benchFuncRegex)
+			}
+		}
+	}
+	if len(positional) > 2 {
+		c.packagePath = positional[2]
+		if !strings.HasPrefix(c.packagePath, ".") {
+			return nil, errors.Errorf("invalid package path %q, expected a path relative to the module, eg. ./tsdb", c.packagePath)
+		}
+	}
+	return c, nil
+}
+
+// set sets a setting of the command.
+func (c *commentCommand) set(key, value string) error {
+	switch key {
+	case "count":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return errors.Errorf("invalid count=%s, expected a positive number of runs", value)
+		}
+		c.count = n
+	case "benchtime":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return errors.Errorf("invalid benchtime=%s, expected a duration, eg. 2s", value)
+		}
+		c.benchTime = d
+	case "cpu":
+		for _, n := range strings.Split(value, ",") {
+			if p, err := strconv.Atoi(n); err != nil || p < 1 {
+				return errors.Errorf("invalid cpu=%s, expected a comma separated list of GOMAXPROCS, eg. 1,4", value)
+			}
+		}
+		c.cpu = value
+	}
+	return nil
+}
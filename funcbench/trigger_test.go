@@ -0,0 +1,70 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseComment(t *testing.T) {
+	for body, expected := range map[string]commentCommand{
+		"/funcbench":                               {},
+		"/funcbench master":                        {target: "master"},
+		"\r\n/funcbench master\t\r\nSomething":     {target: "master"},
+		"I bet:\n/funcbench v2.20.0 .*\n":          {target: "v2.20.0", benchFuncRegex: ".*"},
+		"/funcbench master BenchmarkQuery.* ./...": {target: "master", benchFuncRegex: "BenchmarkQuery.*", packagePath: "./..."},
+		"/funcbench master Benchmark(?:Isolation.*|QuerierSelect) ./tsdb": {
+			target: "master", benchFuncRegex: "Benchmark(?:Isolation.*|QuerierSelect)", packagePath: "./tsdb",
+		},
+		"/funcbench feature/x BenchmarkQuery/series=1 ./promql count=10 benchtime=2s cpu=1,4": {
+			target: "feature/x", benchFuncRegex: "BenchmarkQuery/series=1", packagePath: "./promql",
+			count: 10, benchTime: 2 * time.Second, cpu: "1,4",
+		},
+		"/funcbench full":                  {tier: "full"},
+		"/funcbench quick master":          {tier: "quick", target: "master"},
+		"/funcbench cpu=4 count=3":         {cpu: "4", count: 3},
+		"/funcbench . BenchmarkQuery.*":    {target: ".", benchFuncRegex: "BenchmarkQuery.*"},
+		"/funcbench master BenchmarkQ=1.*": {target: "master", benchFuncRegex: "BenchmarkQ=1.*"},
+	} {
+		c, err := parseComment(body)
+		if err != nil {
+			t.Errorf("%q: %v", body, err)
+			continue
+		}
+		if *c != expected {
+			t.Errorf("%q: expected %+v, got %+v", body, expected, *c)
+		}
+	}
+
+	for body, expected := range map[string]string{
+		"/prombench master":                        "no /funcbench command",
+		"/funcbenchmaster":                         "no /funcbench command",
+		"/funcbench master BenchmarkQuery[ ./tsdb": "invalid benchmark function regex",
+		"/funcbench master .* tsdb":                "invalid package path",
+		"/funcbench master .* ./tsdb extra":        `unexpected "extra"`,
+		"/funcbench quick master .*":               "a tier only takes",
+		"/funcbench master count=10 .*":            "the settings like count=<n> come last",
+		"/funcbench count=0":                       "invalid count=0",
+		"/funcbench benchtime=2":                   "invalid benchtime=2",
+		"/funcbench cpu=1,,4":                      "invalid cpu=1,,4",
+		"/funcbench count=1 count=2":               "count is set twice",
+		"/funcbench master;rm":                     "invalid target",
+	} {
+		_, err := parseComment(body)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", body, expected, err)
+		}
+	}
+}
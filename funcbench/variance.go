@@ -0,0 +1,187 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/perf/benchstat"
+)
+
+// variance reruns the benchmarks whose time varies too much between the runs of a side,
+// like a benchmark disturbed by another process of the runner, and reports the spread of the runs.
+type variance struct {
+	// Max variation of the time of a benchmark in percent of its mean, like the ± of the results.
+	max float64
+	// Number of reruns of the benchmarks varying by more than max.
+	reruns int
+}
+
+// noisyBenchmarks returns the benchmarks of the go test output whose time varies by more than max percent,
+// without their GOMAXPROCS suffix. The variation is computed like the ± of benchstat, without the outliers.
+func noisyBenchmarks(out string, max float64) ([]string, error) {
+	c := &benchstat.Collection{}
+	if err := c.AddFile("results", strings.NewReader(out)); err != nil {
+		return nil, err
+	}
+	// The tables compute the statistics of the metrics.
+	c.Tables()
+
+	noisy := map[string]bool{}
+	for k, m := range c.Metrics {
+		if k.Unit != "ns/op" || m.Mean == 0 {
+			continue
+		}
+		diff := 1 - m.Min/m.Mean
+		if d := m.Max/m.Mean - 1; d > diff {
+			diff = d
+		}
+		if diff*100 > max {
+			noisy["Benchmark"+procsSuffix.ReplaceAllString(k.Benchmark, "")] = true
+		}
+	}
+	names := make([]string, 0, len(noisy))
+	for n := range noisy {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// rerunRegex returns the bench func regex matching only the benchmark.
+func rerunRegex(benchmark string) string {
+	levels := strings.Split(benchmark, "/")
+	for i, l := range levels {
+		levels[i] = regexp.QuoteMeta(l)
+	}
+	return strings.Join(levels, "/")
+}
+
+// replaceBenchmark replaces the results of the benchmark in the go test output with the ones of its rerun.
+// The rerun output is appended with its headers, like the package of the benchmark.
+func replaceBenchmark(out, benchmark, rerun string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && procsSuffix.ReplaceAllString(fields[0], "") == benchmark {
+			continue
+		}
+		b.WriteString(line)
+	}
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(rerun)
+	return b.String()
+}
+
+// rerunNoisy reruns the benchmarks of the go test output which vary too much, up to the number of reruns,
+// and returns the output with their new results. The benchmarks which still vary too much are added to the extra info.
+func (b *Benchmarker) rerunNoisy(pkgRoot, rev, out string) (string, error) {
+	var noisy []string
+	for i := 0; ; i++ {
+		var err error
+		noisy, err = noisyBenchmarks(out, b.variance.max)
+		if err != nil {
+			return "", err
+		}
+		if len(noisy) == 0 || i == b.variance.reruns {
+			break
+		}
+		for _, n := range noisy {
+			b.logger.Println(fmt.Sprintf("[%d/%d]", i+1, b.variance.reruns), "Rerunning", n, "of", rev, "varying by more than", fmt.Sprintf("%v%%", b.variance.max))
+			// Without the CPU profile, which only covers the first run.
+			args := append([]string{}, b.benchmarkArgs...)
+			for j := range args {
+				if args[j] == "-bench" {
+					args[j+1] = fmt.Sprintf(`"%s"`, benchRegex(rerunRegex(n)))
+				}
+			}
+			rerun, err := b.run(pkgRoot, args)
+			if err != nil {
+				return "", err
+			}
+			out = replaceBenchmark(out, n, rerun)
+		}
+	}
+	if len(noisy) > 0 {
+		b.extraInfo = append(b.extraInfo, fmt.Sprintf("The time of %s of %s still varies by more than %v%% after %d reruns.",
+			strings.Join(noisy, ", "), rev, b.variance.max, b.variance.reruns))
+	}
+	return out, nil
+}
+
+// spread is the min, median and max of the runs of a benchmark.
+type spread struct {
+	min, median, max float64
+}
+
+// timeSpreads returns the spread of the time of each benchmark of the go test output.
+func timeSpreads(content []byte) (map[string]spread, error) {
+	c := &benchstat.Collection{}
+	if err := c.AddFile("results", bytes.NewReader(content)); err != nil {
+		return nil, err
+	}
+	spreads := map[string]spread{}
+	for k, m := range c.Metrics {
+		if k.Unit != "ns/op" || len(m.Values) == 0 {
+			continue
+		}
+		s := append([]float64{}, m.Values...)
+		sort.Float64s(s)
+		spreads[k.Benchmark] = spread{min: s[0], median: median(s), max: s[len(s)-1]}
+	}
+	return spreads, nil
+}
+
+// addSpread adds the min, median and max of the time of the runs of both revisions,
+// which shows the variance the means of the results hide.
+func (b *Benchmarker) addSpread(oldResult, newResult string) error {
+	var spreads [2]map[string]spread
+	for i, fn := range []string{oldResult, newResult} {
+		content, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		if spreads[i], err = timeSpreads(content); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(spreads[1]))
+	for n := range spreads[1] {
+		if _, ok := spreads[0][n]; ok {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("Spread of the time of the runs, min / median / max:\n\n| Benchmark | Old | New |\n| --- | --- | --- |\n")
+	for _, n := range names {
+		// The same scale for both sides.
+		scaler := newScaler(spreads[0][n].median, "ns/op")
+		format := func(s spread) string {
+			return fmt.Sprintf("%s / %s / %s", scaler(s.min), scaler(s.median), scaler(s.max))
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s |\n", n, format(spreads[0][n]), format(spreads[1][n]))
+	}
+	b.extraInfo = append(b.extraInfo, buf.String())
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVariance(t *testing.T) {
+	out := "goos: linux\npkg: github.com/prometheus/prometheus/promql\n" +
+		"BenchmarkQuery/series=1-8 100 100 ns/op\n" +
+		"BenchmarkQuery/series=1-8 100 102 ns/op\n" +
+		"BenchmarkQuery/series=1-8 100 101 ns/op\n" +
+		"BenchmarkRangeQuery-8 100 100 ns/op\n" +
+		"BenchmarkRangeQuery-8 100 150 ns/op\n" +
+		"BenchmarkRangeQuery-8 100 120 ns/op\n" +
+		"PASS\nok  \tgithub.com/prometheus/prometheus/promql\t1.000s\n"
+
+	noisy, err := noisyBenchmarks(out, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(noisy, " ") != "BenchmarkRangeQuery" {
+		t.Errorf("expected BenchmarkRangeQuery to vary too much, got %v", noisy)
+	}
+	if noisy, err = noisyBenchmarks(out, 50); err != nil || len(noisy) != 0 {
+		t.Errorf("expected no noisy benchmarks, got %v %v", noisy, err)
+	}
+
+	if got := benchRegex(rerunRegex("BenchmarkQuery/series=1.5(a)")); got != `^BenchmarkQuery$/^series=1\.5\(a\)$` {
+		t.Errorf("unexpected rerun regex %s", got)
+	}
+
+	rerun := "pkg: github.com/prometheus/prometheus/promql\n" +
+		"BenchmarkRangeQuery-8 100 110 ns/op\n" +
+		"BenchmarkRangeQuery-8 100 111 ns/op\n" +
+		"BenchmarkRangeQuery-8 100 110 ns/op\n" +
+		"PASS\n"
+	out = replaceBenchmark(out, "BenchmarkRangeQuery", rerun)
+	if strings.Contains(out, "150 ns/op") || !strings.Contains(out, "111 ns/op") || !strings.Contains(out, "102 ns/op") {
+		t.Errorf("expected the results of the rerun only to replace the noisy benchmark, got:\n%s", out)
+	}
+	if noisy, err = noisyBenchmarks(out, 5); err != nil || len(noisy) != 0 {
+		t.Errorf("expected no noisy benchmarks after the rerun, got %v %v", noisy, err)
+	}
+
+	dir, err := ioutil.TempDir("", "test_variance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldResult, newResult := filepath.Join(dir, "old.out"), filepath.Join(dir, "new.out")
+	if err := ioutil.WriteFile(oldResult, []byte("BenchmarkQuery-8 100 1000 ns/op\nBenchmarkQuery-8 100 3000 ns/op\nBenchmarkQuery-8 100 2000 ns/op\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(newResult, []byte("BenchmarkQuery-8 100 1500 ns/op\nBenchmarkQuery-8 100 1600 ns/op\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := &Benchmarker{}
+	if err := b.addSpread(oldResult, newResult); err != nil {
+		t.Fatal(err)
+	}
+	expected := "| Query-8 | 1.00µs / 2.00µs / 3.00µs | 1.50µs / 1.55µs / 1.60µs |"
+	if len(b.extraInfo) != 1 || !strings.Contains(b.extraInfo[0], expected) {
+		t.Errorf("expected the spread %s, got %v", expected, b.extraInfo)
+	}
+}
@@ -5,26 +5,40 @@ go 1.12
 require (
 	cloud.google.com/go v0.56.0
 	github.com/aws/aws-sdk-go v1.34.5
+	github.com/coreos/go-oidc v2.2.1+incompatible
+	github.com/evanphx/json-patch v4.5.0+incompatible // indirect
 	github.com/go-git/go-git-fixtures/v4 v4.0.1
 	github.com/go-git/go-git/v5 v5.1.0
+	github.com/golang/snappy v0.0.1
 	github.com/google/go-github/v29 v29.0.3
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38
 	github.com/googleapis/gnostic v0.2.0 // indirect
 	github.com/oklog/run v1.1.0
 	github.com/pkg/errors v0.9.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/prometheus/alertmanager v0.21.0
 	github.com/prometheus/client_golang v1.6.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.10.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/mod v0.2.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
 	golang.org/x/perf v0.0.0-20200318175901-9c9101da8316
+	golang.org/x/text v0.3.2
 	google.golang.org/api v0.27.0
 	google.golang.org/genproto v0.0.0-20200331122359-1ee6d9798940
 	google.golang.org/grpc v1.28.0
+	google.golang.org/protobuf v1.21.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/square/go-jose.v2 v2.2.2
 	gopkg.in/yaml.v2 v2.3.0
-	k8s.io/api v0.18.4
-	k8s.io/apiextensions-apiserver v0.18.4
-	k8s.io/apimachinery v0.18.4
-	k8s.io/client-go v0.18.4
+	helm.sh/helm/v3 v3.3.4
+	k8s.io/api v0.18.8
+	k8s.io/apiextensions-apiserver v0.18.8
+	k8s.io/apimachinery v0.18.8
+	k8s.io/client-go v0.18.8
 	sigs.k8s.io/aws-iam-authenticator v0.5.1
 	sigs.k8s.io/kind v0.8.1
+	sigs.k8s.io/kustomize/api v0.7.4
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -20,10 +20,17 @@ import (
 	"path/filepath"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/checks"
+	"github.com/prometheus/test-infra/pkg/cost"
 	"github.com/prometheus/test-infra/pkg/provider"
+	"github.com/prometheus/test-infra/pkg/provider/doks"
 	"github.com/prometheus/test-infra/pkg/provider/eks"
 	"github.com/prometheus/test-infra/pkg/provider/gke"
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
 	kind "github.com/prometheus/test-infra/pkg/provider/kind"
+	"github.com/prometheus/test-infra/pkg/provider/magnum"
+	"github.com/prometheus/test-infra/pkg/provider/plugin"
+	"github.com/prometheus/test-infra/pkg/provider/ssh"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -40,11 +47,86 @@ func main() {
 	app.Flag("vars", "When provided it will substitute the token holders in the yaml file. Follows the standard golang template formating - {{ .hashStable }}.").
 		Short('v').
 		StringMapVar(&dr.FlagDeploymentVars)
+	app.Flag("vars-file", "yaml file with a variable name and value on each line, like the values files of helm. Can be repeated, later files override earlier ones and the --vars flags override all of them.").
+		PlaceHolder("values.yaml").
+		ExistingFilesVar(&dr.VarsFiles)
+	app.Action(dr.LoadVarsFiles)
+	app.Flag("separator", "Line separating the documents of the deployment files.").
+		Envar("INFRA_DOCUMENT_SEPARATOR").
+		Default(provider.Separator).
+		StringVar(&provider.DocumentSeparator)
+	app.Flag("encoding", "Encoding of the deployment files - auto, utf-8, utf-16le or utf-16be. A byte order mark always takes precedence, auto detects utf-16 files without one.").
+		Envar("INFRA_FILE_ENCODING").
+		Default("auto").
+		EnumVar(&provider.FileEncoding, "auto", "utf-8", "utf-16le", "utf-16be")
+	app.Flag("allow-env", "Pattern of the environment variables the deployment files can read with {{ env \"GITHUB_SHA\" }}, e.g. GITHUB_*. Can be repeated, no variables are allowed by default.").
+		PlaceHolder("GITHUB_*").
+		StringsVar(&provider.AllowedEnv)
+	app.Flag("dry-run", "Render and validate the deployment files and print the requests that would change a cluster without sending them. The k8s objects are validated by the API server without being persisted.").
+		BoolVar(&provider.DryRun)
+	app.Flag("chaos", "Probability between 0 and 1 of injecting a failure or a timeout into the provider calls and waits. For development, to exercise the retry and cleanup paths.").
+		Envar("INFRA_CHAOS").
+		Default("0").
+		Float64Var(&provider.ChaosProbability)
+	app.Flag("chaos-seed", "Seed of the injected failures to reproduce a run, the seed of every run is logged. Defaults to a random seed.").
+		Envar("INFRA_CHAOS_SEED").
+		Int64Var(&provider.ChaosSeed)
+
+	app.Flag("timeout", "Timeout of the command. The cloud operations and the waits in progress are cancelled when it is reached, like with SIGINT or SIGTERM, and the clusters and nodepools being created are deleted. No timeout when 0.").
+		Envar("INFRA_TIMEOUT").
+		Default("0").
+		DurationVar(&provider.Timeout)
+	app.Flag("cleanup-timeout", "How long deleting the clusters and nodepools being created can take after the command is interrupted or timed out.").
+		Envar("INFRA_CLEANUP_TIMEOUT").
+		Default("30m").
+		DurationVar(&provider.CleanupTimeout)
+	app.Action(provider.HandleSignals)
+
+	runs := provider.NewRuns(dr)
+	app.Flag("run-id", "Record the rendered deployment files, variables, version and environment of the command into the run with this id, to reproduce or audit its results with runs export. The values of the variables with password, secret, token, credential, private or auth in their name are redacted.").
+		Envar("INFRA_RUN_ID").
+		StringVar(&runs.ID)
+	app.Flag("runs-dir", "Directory of the recorded runs.").
+		Envar("INFRA_RUNS_DIR").
+		Default(".infra/runs").
+		StringVar(&runs.Dir)
+	app.Action(runs.Record)
+
+	state := provider.NewState(runs)
+	app.Flag("state", "Where the clusters, nodepools and objects created by the commands of the run with --run-id are recorded for the destroy command - a directory, gs://bucket/prefix or s3://bucket/prefix. Only the kinds and names of the applied objects and the variables without password, secret, token, credential, private or auth in their name are recorded.").
+		Envar("INFRA_STATE").
+		Default(".infra/state").
+		StringVar(&state.URL)
+	app.Action(state.Record)
+
+	report := provider.NewReport()
+	app.Flag("report", "Write a report of the command and the actions it took - the clusters and nodepools created or deleted, the objects applied or deleted, their durations and errors - to this file for CI jobs to summarize the run. The report is json, yaml with a .yaml or .yml extension.").
+		Envar("INFRA_REPORT").
+		PlaceHolder("report.json").
+		StringVar(&report.File)
+	app.Action(report.Start)
+
+	metrics := provider.NewMetrics()
+	app.Flag("metrics-pushgateway", "Push metrics of the command - its duration and success, the number of actions it took and failed, and the ready nodes of the cluster status commands - to this Pushgateway, grouped by command, for the meta-monitoring to alert on.").
+		Envar("INFRA_METRICS_PUSHGATEWAY").
+		PlaceHolder("http://pushgateway:9091").
+		StringVar(&metrics.Pushgateway)
+	app.Flag("metrics-textfile", "Write the metrics of the command to this file for the textfile collector of the node exporter, keeping the metrics of the other commands in the file.").
+		Envar("INFRA_METRICS_TEXTFILE").
+		PlaceHolder("infra.prom").
+		StringVar(&metrics.Textfile)
+	app.Action(metrics.Start)
+
+	pl := plugin.New(dr)
+	app.Flag("provider-plugin", "Binary of a provider plugin used by the plugin commands, looked up in $PATH when it has no path separator.").
+		Envar("INFRA_PROVIDER_PLUGIN").
+		PlaceHolder("./bin/infra-provider-foo").
+		StringVar(&pl.Path)
 
 	g := gke.New(dr)
 	k8sGKE := app.Command("gke", `Google container engine provider - https://cloud.google.com/kubernetes-engine/`).
 		Action(g.SetupDeploymentResources)
-	k8sGKE.Flag("auth", "json authentication for the project. Accepts a filepath or an env variable that inlcudes tha json data. If not set the tool will use the GOOGLE_APPLICATION_CREDENTIALS env variable (export GOOGLE_APPLICATION_CREDENTIALS=service-account.json). https://cloud.google.com/iam/docs/creating-managing-service-account-keys.").
+	k8sGKE.Flag("auth", "json authentication for the project. Accepts a filepath or an env variable that inlcudes tha json data. If not set the tool will use the GOOGLE_APPLICATION_CREDENTIALS env variable (export GOOGLE_APPLICATION_CREDENTIALS=service-account.json). https://cloud.google.com/iam/docs/creating-managing-service-account-keys. Otherwise the Application Default Credentials are used, including the metadata server and Workload Identity credentials when running inside GCP. The GKE_PROJECT_ID variable defaults to the project of these credentials.").
 		PlaceHolder("service-account.json").
 		Short('a').
 		StringVar(&g.Auth)
@@ -56,19 +138,46 @@ func main() {
 	k8sGKECluster := k8sGKE.Command("cluster", "manage GKE clusters").
 		Action(g.NewGKEClient).
 		Action(g.GKEDeploymentsParse)
-	k8sGKECluster.Command("create", "gke cluster create -a service-account.json -f FileOrFolder").
+	k8sGKEClusterCreate := k8sGKECluster.Command("create", "gke cluster create -a service-account.json -f FileOrFolder").
 		Action(g.ClusterCreate)
+	k8sGKEClusterCreate.Flag("release-channel", "Enroll the cluster in a release channel - rapid, regular or stable. The nodepools must have auto-upgrade enabled.").
+		EnumVar(&g.ReleaseChannel, "rapid", "regular", "stable")
 	k8sGKECluster.Command("delete", "gke cluster delete -a service-account.json -f FileOrFolder").
 		Action(g.ClusterDelete)
+	k8sGKEClusterStatus := k8sGKECluster.Command("status", "gke cluster status -a service-account.json -f FileOrFolder --format markdown").
+		Action(g.ClusterStatus)
+	k8sGKEClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&g.StatusFormat, "table", "markdown")
+
+	// Garbage collection.
+	k8sGKEGC := k8sGKE.Command("gc", "gke gc -a service-account.json -v GKE_PROJECT_ID:test --max-age 6h").
+		Action(g.NewGKEClient).
+		Action(g.GC)
+	k8sGKEGC.Flag("max-age", "Delete the clusters and nodepools created by infra longer than this. Clusters not created by infra are kept.").
+		Default("6h").
+		DurationVar(&g.MaxAge)
 
 	// Cluster node-pool operations
 	k8sGKENodePool := k8sGKE.Command("nodes", "manage GKE clusters nodepools").
 		Action(g.NewGKEClient).
 		Action(g.GKEDeploymentsParse)
-	k8sGKENodePool.Command("create", "gke nodes create -a service-account.json -f FileOrFolder").
+	k8sGKENodePoolCreate := k8sGKENodePool.Command("create", "gke nodes create -a service-account.json -f FileOrFolder").
 		Action(g.NodePoolCreate)
+	k8sGKENodePoolCreate.Flag("warm-pool", "Create the nodepools as a warm pool that can be claimed with 'nodes claim'. The PR_NUMBER variable identifies the warm pool.").
+		BoolVar(&g.WarmPool)
+	k8sGKENodePool.Command("claim", "gke nodes claim -a service-account.json -f FileOrFolder -v PR_NUMBER:123").
+		Action(g.NewK8sProvider).
+		Action(g.NodePoolClaim)
 	k8sGKENodePool.Command("delete", "gke nodes delete -a service-account.json -f FileOrFolder").
 		Action(g.NodePoolDelete)
+	k8sGKENodePoolResize := k8sGKENodePool.Command("resize", "gke nodes resize -a service-account.json -f FileOrFolder --nodepool prometheus-123 --nodes 3").
+		Action(g.NodePoolResize)
+	k8sGKENodePoolResize.Flag("nodepool", "Name of the nodepool to resize. All nodepools in the deployment files are resized when not set.").
+		StringVar(&g.NodePoolName)
+	k8sGKENodePoolResize.Flag("nodes", "Number of nodes per zone.").
+		Required().
+		Int32Var(&g.NodeCount)
 	k8sGKENodePool.Command("check-running", "gke nodes check-running -a service-account.json -f FileOrFolder").
 		Action(g.AllNodepoolsRunning)
 	k8sGKENodePool.Command("check-deleted", "gke nodes check-deleted -a service-account.json -f FileOrFolder").
@@ -79,34 +188,197 @@ func main() {
 		Action(g.NewGKEClient).
 		Action(g.K8SDeploymentsParse).
 		Action(g.NewK8sProvider)
-	k8sGKEResource.Command("apply", "gke resource apply -a service-account.json -f manifestsFileOrFolder -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+	k8sGKEResourceApply := k8sGKEResource.Command("apply", "gke resource apply -a service-account.json -f manifestsFileOrFolder -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(g.ResourceApply)
-	k8sGKEResource.Command("delete", "gke resource delete -a service-account.json -f manifestsFileOrFolder -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+	k8sGKEResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&g.ApplySet)
+	k8sGKEResourceDiff := k8sGKEResource.Command("diff", "gke resource diff -a service-account.json -f manifestsFileOrFolder -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(g.ResourceDiff)
+	k8sGKEResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&g.ApplySet)
+	k8sGKEResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&g.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sGKEResourceLogs := k8sGKEResource.Command("logs", "gke resource logs -a service-account.json -f manifestsFileOrFolder -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test -v PR_NUMBER:1234 -l app=prometheus").
+		Action(g.ResourceLogs)
+	k8sGKEResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&g.LogOptions.Selector)
+	k8sGKEResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&g.LogOptions.Namespace)
+	k8sGKEResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&g.LogOptions.Container)
+	k8sGKEResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&g.LogOptions.TailLines)
+	k8sGKEResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&g.LogOptions.Follow)
+	k8sGKEResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&g.LogOptions.Events)
+	k8sGKEResourceDelete := k8sGKEResource.Command("delete", "gke resource delete -a service-account.json -f manifestsFileOrFolder -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(g.ResourceDelete)
+	k8sGKEResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&g.DeleteTimeout)
+	k8sGKEResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&g.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sGKEResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&g.DeleteWait)
+
+	// Namespace operations.
+	k8sGKENamespace := k8sGKE.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(g.NewGKEClient).
+		Action(g.NewK8sProvider)
+	k8sGKENamespaceCreate := k8sGKENamespace.Command("create", "gke namespace create -a service-account.json -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test prombench-1234").
+		Action(g.NamespaceCreate)
+	k8sGKENamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&g.Namespaces)
+	k8sGKENamespaceDelete := k8sGKENamespace.Command("delete", "gke namespace delete -a service-account.json -v GKE_PROJECT_ID:test -v ZONE:europe-west1-b -v CLUSTER_NAME:test prombench-1234").
+		Action(g.NamespaceDelete)
+	k8sGKENamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&g.Namespaces)
+	k8sGKENamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&g.DeleteTimeout)
+	k8sOptionsFlags(&g.Options, k8sGKEResource, k8sGKENamespaceDelete, "gke", g.ResourceApply)
 
 	k := kind.New(dr)
 	k8sKIND := app.Command("kind", `Kubernetes In Docker (KIND) provider - https://kind.sigs.k8s.io/docs/user/quick-start/`).
 		Action(k.SetupDeploymentResources)
+	k8sKIND.Flag("kubeconfig", "kubeconfig file used for the cluster, defaults to $KUBECONFIG or $HOME/.kube/config.").
+		StringVar(&k.Kubeconfig)
+	k8sKIND.Flag("runtime", "Container runtime for the cluster nodes - docker, podman or nerdctl. Auto-detected when not set.").
+		Envar("KIND_EXPERIMENTAL_PROVIDER").
+		EnumVar(&k.Runtime, "docker", "podman", "nerdctl")
 
 	k8sKIND.Command("info", "kind info -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(k.GetDeploymentVars)
 
 	//Cluster operations.
 	k8sKINDCluster := k8sKIND.Command("cluster", "manage KIND clusters").
-		Action(k.KINDDeploymentsParse)
-	k8sKINDCluster.Command("create", "kind cluster create -f File -v PR_NUMBER:$PR_NUMBER -v CLUSTER_NAME:$CLUSTER_NAME").
+		Action(k.NewKINDProvider)
+	k8sKINDClusterCreate := k8sKINDCluster.Command("create", "kind cluster create -f File -v PR_NUMBER:$PR_NUMBER -v CLUSTER_NAME:$CLUSTER_NAME").
+		Action(k.KINDDeploymentsParse).
 		Action(k.ClusterCreate)
+	k8sKINDClusterCreate.Flag("local-registry", "Run a local registry (registry:2) connected to the KIND network so that manifests can use localhost:5000/... images.").
+		BoolVar(&k.LocalRegistry)
+	k8sKINDClusterCreate.Flag("recreate", "Delete and recreate the cluster when it already exists, by default an existing cluster is left as it is.").
+		BoolVar(&k.Recreate)
 	k8sKINDCluster.Command("delete", "kind cluster delete -f File -v PR_NUMBER:$PR_NUMBER -v CLUSTER_NAME:$CLUSTER_NAME").
+		Action(k.KINDDeploymentsParse).
 		Action(k.ClusterDelete)
+	k8sKINDCluster.Command("check-running", "kind cluster check-running -f File -v PR_NUMBER:$PR_NUMBER -v CLUSTER_NAME:$CLUSTER_NAME").
+		Action(k.KINDDeploymentsParse).
+		Action(k.ClusterRunning)
+	k8sKINDCluster.Command("check-deleted", "kind cluster check-deleted -f File -v PR_NUMBER:$PR_NUMBER -v CLUSTER_NAME:$CLUSTER_NAME").
+		Action(k.KINDDeploymentsParse).
+		Action(k.ClusterDeleted)
+	k8sKINDClusterStatus := k8sKINDCluster.Command("status", "kind cluster status -v CLUSTER_NAME:$CLUSTER_NAME --format markdown").
+		Action(k.ClusterStatus)
+	k8sKINDClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&k.StatusFormat, "table", "markdown")
+	k8sKINDClusterList := k8sKINDCluster.Command("list", "kind cluster list --output json").
+		Action(k.ClusterList)
+	k8sKINDClusterList.Flag("output", "Output format - table or json.").
+		Short('o').
+		Default("table").
+		EnumVar(&k.ListOutput, "table", "json")
+
+	// Kubeconfig operations.
+	k8sKINDKubeconfig := k8sKIND.Command("kubeconfig", "kind kubeconfig --name prombench --output kubeconfig.yaml").
+		Action(k.NewKINDProvider).
+		Action(k.KubeconfigExport)
+	k8sKINDKubeconfig.Flag("name", "Name of the cluster, defaults to the CLUSTER_NAME variable.").
+		StringVar(&k.KubeconfigName)
+	k8sKINDKubeconfig.Flag("output", "File to write the kubeconfig to, defaults to stdout.").
+		Short('o').
+		StringVar(&k.KubeconfigOutput)
+	k8sKINDKubeconfig.Flag("merge", "Merge the kubeconfig into the existing output file instead of overwriting it.").
+		BoolVar(&k.KubeconfigMerge)
+
+	// Garbage collection.
+	k8sKINDGC := k8sKIND.Command("gc", "kind gc --max-age 6h").
+		Action(k.NewKINDProvider).
+		Action(k.GC)
+	k8sKINDGC.Flag("max-age", "Delete the clusters created by infra longer than this. Clusters not created by infra are kept.").
+		Default("6h").
+		DurationVar(&k.MaxAge)
+
+	// Image operations.
+	k8sKINDImage := k8sKIND.Command("image", "manage images on KIND cluster nodes").
+		Action(k.NewKINDProvider)
+	k8sKINDImageLoad := k8sKINDImage.Command("load", "kind image load -v CLUSTER_NAME:$CLUSTER_NAME prominfra/funcbench:master --archive images.tar").
+		Action(k.ImageLoad)
+	k8sKINDImageLoad.Arg("images", "Local docker images to load onto all cluster nodes.").
+		StringsVar(&k.Images)
+	k8sKINDImageLoad.Flag("archive", "Image tarball to load onto all cluster nodes.").
+		ExistingFilesVar(&k.ImageArchives)
 
 	// K8s resource operations.
 	k8sKINDResource := k8sKIND.Command("resource", `Apply and delete different k8s resources - deployments, services, config maps etc.`).
 		Action(k.NewK8sProvider).
 		Action(k.K8SDeploymentsParse)
-	k8sKINDResource.Command("apply", "kind resource apply -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+	k8sKINDResourceApply := k8sKINDResource.Command("apply", "kind resource apply -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(k.ResourceApply)
-	k8sKINDResource.Command("delete", "kind resource delete -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+	k8sKINDResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&k.ApplySet)
+	k8sKINDResourceDiff := k8sKINDResource.Command("diff", "kind resource diff -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(k.ResourceDiff)
+	k8sKINDResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&k.ApplySet)
+	k8sKINDResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&k.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sKINDResourceLogs := k8sKINDResource.Command("logs", "kind resource logs -f manifestsFileOrFolder -v PR_NUMBER:1234 -l app=prometheus").
+		Action(k.ResourceLogs)
+	k8sKINDResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&k.LogOptions.Selector)
+	k8sKINDResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&k.LogOptions.Namespace)
+	k8sKINDResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&k.LogOptions.Container)
+	k8sKINDResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&k.LogOptions.TailLines)
+	k8sKINDResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&k.LogOptions.Follow)
+	k8sKINDResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&k.LogOptions.Events)
+	k8sKINDResourceDelete := k8sKINDResource.Command("delete", "kind resource delete -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(k.ResourceDelete)
+	k8sKINDResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&k.DeleteTimeout)
+	k8sKINDResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&k.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sKINDResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&k.DeleteWait)
+
+	// Namespace operations.
+	k8sKINDNamespace := k8sKIND.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(k.NewK8sProvider)
+	k8sKINDNamespaceCreate := k8sKINDNamespace.Command("create", "kind namespace create prombench-1234").
+		Action(k.NamespaceCreate)
+	k8sKINDNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&k.Namespaces)
+	k8sKINDNamespaceDelete := k8sKINDNamespace.Command("delete", "kind namespace delete prombench-1234").
+		Action(k.NamespaceDelete)
+	k8sKINDNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&k.Namespaces)
+	k8sKINDNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&k.DeleteTimeout)
+	k8sOptionsFlags(&k.Options, k8sKINDResource, k8sKINDNamespaceDelete, "kind", k.ResourceApply)
 
 	// EKS based commands
 	e := eks.New(dr)
@@ -128,6 +400,19 @@ func main() {
 		Action(e.ClusterCreate)
 	k8sEKSCluster.Command("delete", "eks cluster delete -a credentials -f FileOrFolder").
 		Action(e.ClusterDelete)
+	k8sEKSClusterStatus := k8sEKSCluster.Command("status", "eks cluster status -a credentials -f FileOrFolder --format markdown").
+		Action(e.ClusterStatus)
+	k8sEKSClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&e.StatusFormat, "table", "markdown")
+
+	// Garbage collection.
+	k8sEKSGC := k8sEKS.Command("gc", "eks gc -a credentials -v ZONE:eu-west-1 --max-age 6h").
+		Action(e.NewEKSClient).
+		Action(e.GC)
+	k8sEKSGC.Flag("max-age", "Delete the clusters and nodegroups created by infra longer than this. Clusters not created by infra are kept.").
+		Default("6h").
+		DurationVar(&e.MaxAge)
 
 	// Cluster node-pool operations
 	k8sEKSNodeGroup := k8sEKS.Command("nodes", "manage EKS clusters nodegroups").
@@ -147,15 +432,743 @@ func main() {
 		Action(e.NewEKSClient).
 		Action(e.K8SDeploymentsParse).
 		Action(e.NewK8sProvider)
-	k8sEKSResource.Command("apply", "eks resource apply -a credentials -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+	k8sEKSResourceApply := k8sEKSResource.Command("apply", "eks resource apply -a credentials -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(e.ResourceApply)
-	k8sEKSResource.Command("delete", "eks resource delete -a credentials -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+	k8sEKSResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&e.ApplySet)
+	k8sEKSResourceDiff := k8sEKSResource.Command("diff", "eks resource diff -a credentials -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(e.ResourceDiff)
+	k8sEKSResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&e.ApplySet)
+	k8sEKSResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&e.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sEKSResourceLogs := k8sEKSResource.Command("logs", "eks resource logs -a credentials -f manifestsFileOrFolder -v PR_NUMBER:1234 -l app=prometheus").
+		Action(e.ResourceLogs)
+	k8sEKSResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&e.LogOptions.Selector)
+	k8sEKSResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&e.LogOptions.Namespace)
+	k8sEKSResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&e.LogOptions.Container)
+	k8sEKSResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&e.LogOptions.TailLines)
+	k8sEKSResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&e.LogOptions.Follow)
+	k8sEKSResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&e.LogOptions.Events)
+	k8sEKSResourceDelete := k8sEKSResource.Command("delete", "eks resource delete -a credentials -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
 		Action(e.ResourceDelete)
+	k8sEKSResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&e.DeleteTimeout)
+	k8sEKSResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&e.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sEKSResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&e.DeleteWait)
+
+	// Namespace operations.
+	k8sEKSNamespace := k8sEKS.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(e.NewEKSClient).
+		Action(e.NewK8sProvider)
+	k8sEKSNamespaceCreate := k8sEKSNamespace.Command("create", "eks namespace create -a credentials -v ZONE:us-east-2 -v CLUSTER_NAME:test prombench-1234").
+		Action(e.NamespaceCreate)
+	k8sEKSNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&e.Namespaces)
+	k8sEKSNamespaceDelete := k8sEKSNamespace.Command("delete", "eks namespace delete -a credentials -v ZONE:us-east-2 -v CLUSTER_NAME:test prombench-1234").
+		Action(e.NamespaceDelete)
+	k8sEKSNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&e.Namespaces)
+	k8sEKSNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&e.DeleteTimeout)
+	k8sOptionsFlags(&e.Options, k8sEKSResource, k8sEKSNamespaceDelete, "eks", e.ResourceApply)
+
+	// DOKS based commands
+	d := doks.New(dr)
+	k8sDOKS := app.Command("doks", "DigitalOcean Kubernetes - https://www.digitalocean.com/products/kubernetes/").
+		Action(d.SetupDeploymentResources)
+	k8sDOKS.Flag("auth", "API token for the account. Accepts a filepath or an env variable that includes the token. If not set the tool will use the DIGITALOCEAN_TOKEN env variable. https://www.digitalocean.com/docs/apis-clis/api/create-personal-access-token/").
+		PlaceHolder("token").
+		Short('a').
+		StringVar(&d.Auth)
+
+	k8sDOKS.Command("info", "doks info -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(d.GetDeploymentVars)
+
+	// DOKS Cluster operations
+	k8sDOKSCluster := k8sDOKS.Command("cluster", "manage DOKS clusters").
+		Action(d.NewDOKSClient).
+		Action(d.DOKSDeploymentsParse)
+	k8sDOKSCluster.Command("create", "doks cluster create -a token -f FileOrFolder -v ZONE:fra1 -v CLUSTER_NAME:test").
+		Action(d.ClusterCreate)
+	k8sDOKSCluster.Command("delete", "doks cluster delete -a token -f FileOrFolder -v ZONE:fra1 -v CLUSTER_NAME:test").
+		Action(d.ClusterDelete)
+	k8sDOKSClusterStatus := k8sDOKSCluster.Command("status", "doks cluster status -a token -f FileOrFolder --format markdown").
+		Action(d.ClusterStatus)
+	k8sDOKSClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&d.StatusFormat, "table", "markdown")
+
+	// DOKS Cluster node-pool operations
+	k8sDOKSNodePool := k8sDOKS.Command("nodes", "manage DOKS clusters nodepools").
+		Action(d.NewDOKSClient).
+		Action(d.DOKSDeploymentsParse)
+	k8sDOKSNodePool.Command("create", "doks nodes create -a token -f FileOrFolder -v ZONE:fra1 -v CLUSTER_NAME:test").
+		Action(d.NodePoolCreate)
+	k8sDOKSNodePool.Command("delete", "doks nodes delete -a token -f FileOrFolder -v ZONE:fra1 -v CLUSTER_NAME:test").
+		Action(d.NodePoolDelete)
+	k8sDOKSNodePool.Command("check-running", "doks nodes check-running -a token -f FileOrFolder -v ZONE:fra1 -v CLUSTER_NAME:test").
+		Action(d.AllNodePoolsRunning)
+	k8sDOKSNodePool.Command("check-deleted", "doks nodes check-deleted -a token -f FileOrFolder -v ZONE:fra1 -v CLUSTER_NAME:test").
+		Action(d.AllNodePoolsDeleted)
+
+	// K8s resource operations.
+	k8sDOKSResource := k8sDOKS.Command("resource", `Apply and delete different k8s resources - deployments, services, config maps etc.Required variables -v ZONE:fra1 -v CLUSTER_NAME:test `).
+		Action(d.NewDOKSClient).
+		Action(d.K8SDeploymentsParse).
+		Action(d.NewK8sProvider)
+	k8sDOKSResourceApply := k8sDOKSResource.Command("apply", "doks resource apply -a token -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(d.ResourceApply)
+	k8sDOKSResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&d.ApplySet)
+	k8sDOKSResourceDiff := k8sDOKSResource.Command("diff", "doks resource diff -a token -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(d.ResourceDiff)
+	k8sDOKSResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&d.ApplySet)
+	k8sDOKSResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&d.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sDOKSResourceLogs := k8sDOKSResource.Command("logs", "doks resource logs -a token -f manifestsFileOrFolder -v PR_NUMBER:1234 -l app=prometheus").
+		Action(d.ResourceLogs)
+	k8sDOKSResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&d.LogOptions.Selector)
+	k8sDOKSResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&d.LogOptions.Namespace)
+	k8sDOKSResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&d.LogOptions.Container)
+	k8sDOKSResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&d.LogOptions.TailLines)
+	k8sDOKSResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&d.LogOptions.Follow)
+	k8sDOKSResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&d.LogOptions.Events)
+	k8sDOKSResourceDelete := k8sDOKSResource.Command("delete", "doks resource delete -a token -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(d.ResourceDelete)
+	k8sDOKSResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&d.DeleteTimeout)
+	k8sDOKSResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&d.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sDOKSResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&d.DeleteWait)
+
+	// Namespace operations.
+	k8sDOKSNamespace := k8sDOKS.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(d.NewDOKSClient).
+		Action(d.NewK8sProvider)
+	k8sDOKSNamespaceCreate := k8sDOKSNamespace.Command("create", "doks namespace create -a token -v ZONE:fra1 -v CLUSTER_NAME:test prombench-1234").
+		Action(d.NamespaceCreate)
+	k8sDOKSNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&d.Namespaces)
+	k8sDOKSNamespaceDelete := k8sDOKSNamespace.Command("delete", "doks namespace delete -a token -v ZONE:fra1 -v CLUSTER_NAME:test prombench-1234").
+		Action(d.NamespaceDelete)
+	k8sDOKSNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&d.Namespaces)
+	k8sDOKSNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&d.DeleteTimeout)
+	k8sOptionsFlags(&d.Options, k8sDOKSResource, k8sDOKSNamespaceDelete, "doks", d.ResourceApply)
+
+	// Magnum based commands
+	m := magnum.New(dr)
+	k8sMagnum := app.Command("magnum", "OpenStack Magnum - https://docs.openstack.org/magnum/latest/").
+		Action(m.SetupDeploymentResources)
+	k8sMagnum.Flag("auth", "Keystone credentials yaml with the keys of the auth section of clouds.yaml and region_name. Accepts a filepath or an env variable that includes the yaml. If not set the tool will use the OS_* env variables of the OpenStack RC file. https://docs.openstack.org/python-openstackclient/latest/configuration/").
+		PlaceHolder("credentials.yaml").
+		Short('a').
+		StringVar(&m.Auth)
+
+	k8sMagnum.Command("info", "magnum info -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(m.GetDeploymentVars)
+
+	// Magnum Cluster operations
+	k8sMagnumCluster := k8sMagnum.Command("cluster", "manage Magnum clusters").
+		Action(m.NewMagnumClient).
+		Action(m.MagnumDeploymentsParse)
+	k8sMagnumCluster.Command("create", "magnum cluster create -a credentials.yaml -f FileOrFolder -v CLUSTER_NAME:test").
+		Action(m.ClusterCreate)
+	k8sMagnumCluster.Command("delete", "magnum cluster delete -a credentials.yaml -f FileOrFolder -v CLUSTER_NAME:test").
+		Action(m.ClusterDelete)
+	k8sMagnumClusterStatus := k8sMagnumCluster.Command("status", "magnum cluster status -a credentials.yaml -f FileOrFolder --format markdown").
+		Action(m.ClusterStatus)
+	k8sMagnumClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&m.StatusFormat, "table", "markdown")
+
+	// Magnum Cluster node group operations
+	k8sMagnumNodeGroup := k8sMagnum.Command("nodes", "manage Magnum clusters node groups").
+		Action(m.NewMagnumClient).
+		Action(m.MagnumDeploymentsParse)
+	k8sMagnumNodeGroup.Command("create", "magnum nodes create -a credentials.yaml -f FileOrFolder -v CLUSTER_NAME:test").
+		Action(m.NodeGroupCreate)
+	k8sMagnumNodeGroup.Command("delete", "magnum nodes delete -a credentials.yaml -f FileOrFolder -v CLUSTER_NAME:test").
+		Action(m.NodeGroupDelete)
+	k8sMagnumNodeGroup.Command("check-running", "magnum nodes check-running -a credentials.yaml -f FileOrFolder -v CLUSTER_NAME:test").
+		Action(m.AllNodeGroupsRunning)
+	k8sMagnumNodeGroup.Command("check-deleted", "magnum nodes check-deleted -a credentials.yaml -f FileOrFolder -v CLUSTER_NAME:test").
+		Action(m.AllNodeGroupsDeleted)
+
+	// K8s resource operations.
+	k8sMagnumResource := k8sMagnum.Command("resource", `Apply and delete different k8s resources - deployments, services, config maps etc.Required variables -v CLUSTER_NAME:test `).
+		Action(m.NewMagnumClient).
+		Action(m.K8SDeploymentsParse).
+		Action(m.NewK8sProvider)
+	k8sMagnumResourceApply := k8sMagnumResource.Command("apply", "magnum resource apply -a credentials.yaml -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(m.ResourceApply)
+	k8sMagnumResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&m.ApplySet)
+	k8sMagnumResourceDiff := k8sMagnumResource.Command("diff", "magnum resource diff -a credentials.yaml -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(m.ResourceDiff)
+	k8sMagnumResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&m.ApplySet)
+	k8sMagnumResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&m.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sMagnumResourceLogs := k8sMagnumResource.Command("logs", "magnum resource logs -a credentials.yaml -f manifestsFileOrFolder -v PR_NUMBER:1234 -l app=prometheus").
+		Action(m.ResourceLogs)
+	k8sMagnumResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&m.LogOptions.Selector)
+	k8sMagnumResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&m.LogOptions.Namespace)
+	k8sMagnumResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&m.LogOptions.Container)
+	k8sMagnumResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&m.LogOptions.TailLines)
+	k8sMagnumResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&m.LogOptions.Follow)
+	k8sMagnumResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&m.LogOptions.Events)
+	k8sMagnumResourceDelete := k8sMagnumResource.Command("delete", "magnum resource delete -a credentials.yaml -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(m.ResourceDelete)
+	k8sMagnumResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&m.DeleteTimeout)
+	k8sMagnumResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&m.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sMagnumResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&m.DeleteWait)
+
+	// Namespace operations.
+	k8sMagnumNamespace := k8sMagnum.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(m.NewMagnumClient).
+		Action(m.NewK8sProvider)
+	k8sMagnumNamespaceCreate := k8sMagnumNamespace.Command("create", "magnum namespace create -a credentials.yaml -v CLUSTER_NAME:test prombench-1234").
+		Action(m.NamespaceCreate)
+	k8sMagnumNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&m.Namespaces)
+	k8sMagnumNamespaceDelete := k8sMagnumNamespace.Command("delete", "magnum namespace delete -a credentials.yaml -v CLUSTER_NAME:test prombench-1234").
+		Action(m.NamespaceDelete)
+	k8sMagnumNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&m.Namespaces)
+	k8sMagnumNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&m.DeleteTimeout)
+	k8sOptionsFlags(&m.Options, k8sMagnumResource, k8sMagnumNamespaceDelete, "magnum", m.ResourceApply)
+
+	// SSH based commands
+	sh := ssh.New(dr)
+	k8sSSH := app.Command("ssh", "kubeadm clusters on existing hosts over ssh - https://kubernetes.io/docs/setup/production-environment/tools/kubeadm/").
+		Action(sh.SetupDeploymentResources)
+	k8sSSH.Flag("auth", "Private key file for the ssh connections, can be repeated. The keys of the ssh agent are also used when SSH_AUTH_SOCK is set.").
+		PlaceHolder("id_rsa").
+		Short('a').
+		StringsVar(&sh.Auth)
+	k8sSSH.Flag("user", "User for the ssh connections, commands are run with sudo when it is not root.").
+		Default("root").
+		StringVar(&sh.User)
+	k8sSSH.Flag("port", "Port for the ssh connections.").
+		Default("22").
+		IntVar(&sh.Port)
+	k8sSSH.Flag("known-hosts", "Known hosts file used to verify the host keys, defaults to ~/.ssh/known_hosts.").
+		StringVar(&sh.KnownHosts)
+	k8sSSH.Flag("insecure-ignore-host-key", "Don't verify the host keys.").
+		BoolVar(&sh.InsecureIgnoreHostKey)
+
+	k8sSSH.Command("info", "ssh info -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(sh.GetDeploymentVars)
+
+	// SSH Cluster operations
+	k8sSSHCluster := k8sSSH.Command("cluster", "manage kubeadm clusters").
+		Action(sh.NewSSHClient).
+		Action(sh.SSHDeploymentsParse)
+	k8sSSHCluster.Command("create", "ssh cluster create -a id_rsa -f FileOrFolder -v CONTROL_PLANE:10.0.0.1").
+		Action(sh.ClusterCreate)
+	k8sSSHCluster.Command("delete", "ssh cluster delete -a id_rsa -f FileOrFolder -v CONTROL_PLANE:10.0.0.1").
+		Action(sh.ClusterDelete)
+	k8sSSHClusterStatus := k8sSSHCluster.Command("status", "ssh cluster status -a id_rsa -f FileOrFolder --format markdown").
+		Action(sh.ClusterStatus)
+	k8sSSHClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&sh.StatusFormat, "table", "markdown")
 
-	if _, err := app.Parse(os.Args[1:]); err != nil {
+	// SSH Cluster node-pool operations
+	k8sSSHNodePool := k8sSSH.Command("nodes", "manage the hosts of kubeadm clusters nodepools").
+		Action(sh.NewSSHClient).
+		Action(sh.SSHDeploymentsParse)
+	k8sSSHNodePool.Command("create", "ssh nodes create -a id_rsa -f FileOrFolder -v CONTROL_PLANE:10.0.0.1").
+		Action(sh.NodePoolCreate)
+	k8sSSHNodePool.Command("delete", "ssh nodes delete -a id_rsa -f FileOrFolder -v CONTROL_PLANE:10.0.0.1").
+		Action(sh.NodePoolDelete)
+	k8sSSHNodePool.Command("check-running", "ssh nodes check-running -a id_rsa -f FileOrFolder -v CONTROL_PLANE:10.0.0.1").
+		Action(sh.AllNodePoolsRunning)
+	k8sSSHNodePool.Command("check-deleted", "ssh nodes check-deleted -a id_rsa -f FileOrFolder -v CONTROL_PLANE:10.0.0.1").
+		Action(sh.AllNodePoolsDeleted)
+
+	// K8s resource operations.
+	k8sSSHResource := k8sSSH.Command("resource", `Apply and delete different k8s resources - deployments, services, config maps etc.Required variables -v CONTROL_PLANE:10.0.0.1 `).
+		Action(sh.NewSSHClient).
+		Action(sh.K8SDeploymentsParse).
+		Action(sh.NewK8sProvider)
+	k8sSSHResourceApply := k8sSSHResource.Command("apply", "ssh resource apply -a id_rsa -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(sh.ResourceApply)
+	k8sSSHResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&sh.ApplySet)
+	k8sSSHResourceDiff := k8sSSHResource.Command("diff", "ssh resource diff -a id_rsa -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(sh.ResourceDiff)
+	k8sSSHResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&sh.ApplySet)
+	k8sSSHResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&sh.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sSSHResourceLogs := k8sSSHResource.Command("logs", "ssh resource logs -a id_rsa -f manifestsFileOrFolder -v PR_NUMBER:1234 -l app=prometheus").
+		Action(sh.ResourceLogs)
+	k8sSSHResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&sh.LogOptions.Selector)
+	k8sSSHResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&sh.LogOptions.Namespace)
+	k8sSSHResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&sh.LogOptions.Container)
+	k8sSSHResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&sh.LogOptions.TailLines)
+	k8sSSHResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&sh.LogOptions.Follow)
+	k8sSSHResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&sh.LogOptions.Events)
+	k8sSSHResourceDelete := k8sSSHResource.Command("delete", "ssh resource delete -a id_rsa -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(sh.ResourceDelete)
+	k8sSSHResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&sh.DeleteTimeout)
+	k8sSSHResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&sh.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sSSHResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&sh.DeleteWait)
+
+	// Namespace operations.
+	k8sSSHNamespace := k8sSSH.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(sh.NewSSHClient).
+		Action(sh.NewK8sProvider)
+	k8sSSHNamespaceCreate := k8sSSHNamespace.Command("create", "ssh namespace create -a id_rsa -v CONTROL_PLANE:10.0.0.1 prombench-1234").
+		Action(sh.NamespaceCreate)
+	k8sSSHNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&sh.Namespaces)
+	k8sSSHNamespaceDelete := k8sSSHNamespace.Command("delete", "ssh namespace delete -a id_rsa -v CONTROL_PLANE:10.0.0.1 prombench-1234").
+		Action(sh.NamespaceDelete)
+	k8sSSHNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&sh.Namespaces)
+	k8sSSHNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&sh.DeleteTimeout)
+	k8sOptionsFlags(&sh.Options, k8sSSHResource, k8sSSHNamespaceDelete, "ssh", sh.ResourceApply)
+
+	// Provider plugin based commands
+	k8sPlugin := app.Command("plugin", "Clusters of an external provider plugin set with --provider-plugin.").
+		Action(pl.SetupDeploymentResources)
+
+	k8sPlugin.Command("info", "plugin info -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(pl.GetDeploymentVars)
+
+	// Plugin Cluster operations
+	k8sPluginCluster := k8sPlugin.Command("cluster", "manage the clusters of the plugin").
+		Action(pl.Handshake).
+		Action(pl.PluginDeploymentsParse)
+	k8sPluginCluster.Command("create", "plugin cluster create --provider-plugin ./bin/infra-provider-foo -f FileOrFolder").
+		Action(pl.ClusterCreate)
+	k8sPluginCluster.Command("delete", "plugin cluster delete --provider-plugin ./bin/infra-provider-foo -f FileOrFolder").
+		Action(pl.ClusterDelete)
+	k8sPluginClusterStatus := k8sPluginCluster.Command("status", "plugin cluster status --provider-plugin ./bin/infra-provider-foo -f FileOrFolder --format markdown").
+		Action(pl.ClusterStatus)
+	k8sPluginClusterStatus.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&pl.StatusFormat, "table", "markdown")
+
+	// Plugin Cluster node-pool operations
+	k8sPluginNodePool := k8sPlugin.Command("nodes", "manage the nodepools of the plugin clusters").
+		Action(pl.Handshake).
+		Action(pl.PluginDeploymentsParse)
+	k8sPluginNodePool.Command("create", "plugin nodes create --provider-plugin ./bin/infra-provider-foo -f FileOrFolder").
+		Action(pl.NodePoolCreate)
+	k8sPluginNodePool.Command("delete", "plugin nodes delete --provider-plugin ./bin/infra-provider-foo -f FileOrFolder").
+		Action(pl.NodePoolDelete)
+	k8sPluginNodePool.Command("check-running", "plugin nodes check-running --provider-plugin ./bin/infra-provider-foo -f FileOrFolder").
+		Action(pl.AllNodePoolsRunning)
+	k8sPluginNodePool.Command("check-deleted", "plugin nodes check-deleted --provider-plugin ./bin/infra-provider-foo -f FileOrFolder").
+		Action(pl.AllNodePoolsDeleted)
+
+	// K8s resource operations.
+	k8sPluginResource := k8sPlugin.Command("resource", `Apply and delete different k8s resources - deployments, services, config maps etc.`).
+		Action(pl.Handshake).
+		Action(pl.K8SDeploymentsParse).
+		Action(pl.NewK8sProvider)
+	k8sPluginResourceApply := k8sPluginResource.Command("apply", "plugin resource apply --provider-plugin ./bin/infra-provider-foo -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(pl.ResourceApply)
+	k8sPluginResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&pl.ApplySet)
+	k8sPluginResourceDiff := k8sPluginResource.Command("diff", "plugin resource diff --provider-plugin ./bin/infra-provider-foo -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(pl.ResourceDiff)
+	k8sPluginResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&pl.ApplySet)
+	k8sPluginResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&pl.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sPluginResourceLogs := k8sPluginResource.Command("logs", "plugin resource logs --provider-plugin ./bin/infra-provider-foo -f manifestsFileOrFolder -v PR_NUMBER:1234 -l app=prometheus").
+		Action(pl.ResourceLogs)
+	k8sPluginResourceLogs.Flag("selector", "Label selector of the pods, like app=prometheus. All pods when not set.").
+		Short('l').
+		StringVar(&pl.LogOptions.Selector)
+	k8sPluginResourceLogs.Flag("namespace", "Namespace of the pods, defaults to the namespaces of the objects in the deployment files.").
+		StringVar(&pl.LogOptions.Namespace)
+	k8sPluginResourceLogs.Flag("container", "Name of the container, all containers when not set.").
+		StringVar(&pl.LogOptions.Container)
+	k8sPluginResourceLogs.Flag("tail", "Number of lines from the end of the logs of each container, all lines when 0.").
+		Int64Var(&pl.LogOptions.TailLines)
+	k8sPluginResourceLogs.Flag("follow", "Keep streaming the logs, including the containers started later, until interrupted.").
+		Default("true").
+		BoolVar(&pl.LogOptions.Follow)
+	k8sPluginResourceLogs.Flag("events", "Include the events of the namespaces, which show the progress of the deployment.").
+		BoolVar(&pl.LogOptions.Events)
+	k8sPluginResourceDelete := k8sPluginResource.Command("delete", "plugin resource delete --provider-plugin ./bin/infra-provider-foo -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(pl.ResourceDelete)
+	k8sPluginResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&pl.DeleteTimeout)
+	k8sPluginResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&pl.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sPluginResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&pl.DeleteWait)
+
+	// Namespace operations.
+	k8sPluginNamespace := k8sPlugin.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`).
+		Action(pl.Handshake).
+		Action(pl.NewK8sProvider)
+	k8sPluginNamespaceCreate := k8sPluginNamespace.Command("create", "plugin namespace create --provider-plugin ./bin/infra-provider-foo prombench-1234").
+		Action(pl.NamespaceCreate)
+	k8sPluginNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&pl.Namespaces)
+	k8sPluginNamespaceDelete := k8sPluginNamespace.Command("delete", "plugin namespace delete --provider-plugin ./bin/infra-provider-foo prombench-1234").
+		Action(pl.NamespaceDelete)
+	k8sPluginNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&pl.Namespaces)
+	k8sPluginNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&pl.DeleteTimeout)
+	k8sOptionsFlags(&pl.Options, k8sPluginResource, k8sPluginNamespaceDelete, "plugin", pl.ResourceApply)
+
+	// Kubeconfig based commands
+	kc := k8s.NewContexts(dr)
+	k8sContexts := app.Command("k8s", "Existing clusters of kubeconfig contexts, the same resources can be applied to several clusters.")
+	k8sContexts.Flag("kubeconfig", "kubeconfig file with the contexts, defaults to $KUBECONFIG or $HOME/.kube/config.").
+		StringVar(&kc.Kubeconfig)
+	k8sContexts.Flag("contexts", "Comma separated contexts of the clusters, can be repeated. Defaults to the current context.").
+		PlaceHolder("ctxA,ctxB").
+		StringsVar(&kc.Contexts)
+	k8sContexts.Flag("format", "Output format of the results per context and the cluster status - table or markdown.").
+		Default("table").
+		EnumVar(&kc.StatusFormat, "table", "markdown")
+
+	k8sContexts.Command("cluster", "manage the clusters of the contexts").
+		Command("status", "k8s cluster status --contexts ctxA,ctxB --format markdown").
+		Action(kc.ClusterStatus)
+
+	// K8s resource operations.
+	k8sContextsResource := k8sContexts.Command("resource", `Apply and delete different k8s resources - deployments, services, config maps etc.`).
+		Action(kc.DeploymentsParse)
+	k8sContextsResourceApply := k8sContextsResource.Command("apply", "k8s resource apply --contexts ctxA,ctxB -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(kc.ResourceApply)
+	k8sContextsResourceApply.Flag("apply-set", "Label the applied objects with this apply set so that the objects removed from the deployment files can be pruned. Use a different apply set for every set of deployment files.").
+		StringVar(&kc.ApplySet)
+	k8sContextsResourceDiff := k8sContextsResource.Command("diff", "k8s resource diff --contexts ctxA,ctxB -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(kc.ResourceDiff)
+	k8sContextsResourceDiff.Flag("apply-set", "Diff the apply labeling the objects with this apply set, see the apply command.").
+		StringVar(&kc.ApplySet)
+	k8sContextsResourceDiff.Flag("diff-format", "Format of the diff - unified for a diff of the yaml of the objects or structured for the paths of the changed fields.").
+		Default(k8s.DiffUnified).
+		EnumVar(&kc.DiffFormat, k8s.DiffUnified, k8s.DiffStructured)
+	k8sContextsResourceDelete := k8sContextsResource.Command("delete", "k8s resource delete --contexts ctxA,ctxB -f manifestsFileOrFolder -v hashStable:COMMIT1 -v hashTesting:COMMIT2").
+		Action(kc.ResourceDelete)
+	k8sContextsResourceDelete.Flag("delete-timeout", "How long to wait for the deleted objects to be removed before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&kc.DeleteTimeout)
+	k8sContextsResourceDelete.Flag("cascade", "Propagation policy of the deletion of the dependents of the objects, like the pods of a deployment - foreground deletes them before the object, background after it and orphan keeps them.").
+		Default(k8s.DeleteForeground).
+		EnumVar(&kc.DeletePropagation, k8s.DeleteForeground, k8s.DeleteBackground, k8s.DeleteOrphan)
+	k8sContextsResourceDelete.Flag("wait", "Wait up to the delete timeout for the deleted objects and the persistent volumes of the deleted claims to be removed. With --no-wait it returns once the deletions are accepted.").
+		Default("true").
+		BoolVar(&kc.DeleteWait)
+
+	// Namespace operations.
+	k8sContextsNamespace := k8sContexts.Command("namespace", `Create and delete namespaces, to start and end the test runs with clean namespaces.`)
+	k8sContextsNamespaceCreate := k8sContextsNamespace.Command("create", "k8s namespace create --contexts ctxA,ctxB prombench-1234").
+		Action(kc.NamespaceCreate)
+	k8sContextsNamespaceCreate.Arg("names", "Namespaces to create.").
+		Required().
+		StringsVar(&kc.Namespaces)
+	k8sContextsNamespaceDelete := k8sContextsNamespace.Command("delete", "k8s namespace delete --contexts ctxA,ctxB prombench-1234").
+		Action(kc.NamespaceDelete)
+	k8sContextsNamespaceDelete.Arg("names", "Namespaces to delete with all their objects.").
+		Required().
+		StringsVar(&kc.Namespaces)
+	k8sContextsNamespaceDelete.Flag("delete-timeout", "How long to wait for the namespaces to be removed, blocked by their finalizers, before reporting them as left behind.").
+		Default("15m").
+		DurationVar(&kc.DeleteTimeout)
+	k8sOptionsFlags(&kc.Options, k8sContextsResource, k8sContextsNamespaceDelete, "k8s", kc.ResourceApply)
+
+	// Render the deployment files.
+	r := provider.NewRender(dr)
+	render := app.Command("render", "Write the deployment files after applying the template variables, to review or commit what will be applied. render -f manifestsFileOrFolder -v hashStable:COMMIT1 --output-dir rendered").
+		Action(r.Render)
+	render.Flag("output-dir", "Directory to write the rendered files to, keeping the layout of the deployment folders. Defaults to stdout.").
+		Short('o').
+		StringVar(&r.OutputDir)
+
+	// Recorded runs.
+	runsCmd := app.Command("runs", "Work with the runs recorded with --run-id.")
+	runsCmd.Command("list", "List the recorded runs.").
+		Action(runs.List)
+	runsExport := runsCmd.Command("export", "Write a tarball of a recorded run with the rendered manifests, variables, version and environment of its commands. runs export pr-1234 -o pr-1234.tar.gz").
+		Action(runs.Export)
+	runsExport.Arg("id", "Id of the run.").
+		Required().
+		StringVar(&runs.ExportID)
+	runsExport.Flag("output", "File to write the tarball to, defaults to <id>.tar.gz.").
+		Short('o').
+		StringVar(&runs.Output)
+
+	// Verify the toolchain end to end on a KIND cluster.
+	st := kind.New(dr)
+	plan := provider.NewPlan(dr, state)
+	apply := app.Command("apply", "Run the steps of the plan files in order - create the cluster or the nodepools, apply the objects and evaluate the checks - with the commands of the providers, stopping at the first failed step. apply -f plan.yaml -v PR_NUMBER:1234").
+		Action(plan.Apply)
+	apply.Flag("auth", "Auth flag of the commands of a provider, like gke=service-account.json, overriding the auth of the plan files. Can be repeated.").
+		PlaceHolder("PROVIDER=AUTH").
+		StringMapVar(&state.Auth)
+	destroy := app.Command("destroy", "Delete what the steps of the plan files create, the last step first, or without plan files everything the run with --run-id created, as recorded in --state, with the delete commands of the providers: the objects, then the nodepools and the clusters. destroy -f plan.yaml -v PR_NUMBER:1234 or destroy --run-id pr-1234 --auth gke=service-account.json").
+		Action(plan.Destroy)
+	destroy.Flag("auth", "Auth flag of the delete commands of a provider, like gke=service-account.json. Can be repeated, the auth isn't recorded in the state.").
+		PlaceHolder("PROVIDER=AUTH").
+		StringMapVar(&state.Auth)
+
+	selfTest := app.Command("selftest", "Create a KIND cluster, apply a minimal set of manifests, run a mock benchmark, publish its result and delete the cluster, to verify the toolchain after an upgrade or a config change. selftest --duration 30s").
+		Action(st.NewKINDProvider).
+		Action(st.SelfTest)
+	selfTest.Flag("name", "Name of the cluster of the self test.").
+		Default("infra-selftest").
+		StringVar(&st.SelfTestName)
+	selfTest.Flag("duration", "How long the mock benchmark runs.").
+		Default("30s").
+		DurationVar(&st.SelfTestDuration)
+	selfTest.Flag("results-dir", "Directory the result of the mock benchmark is published to, in the go benchmark format read by benchTrend.").
+		Default(".infra/selftest").
+		StringVar(&st.SelfTestResultsDir)
+	selfTest.Flag("keep", "Keep the cluster when a step fails, to debug it.").
+		BoolVar(&st.SelfTestKeep)
+	selfTest.Flag("kubeconfig", "kubeconfig file the cluster is added to, defaults to $KUBECONFIG or $HOME/.kube/config.").
+		StringVar(&st.Kubeconfig)
+	selfTest.Flag("runtime", "Container runtime for the cluster nodes - docker, podman or nerdctl. Auto-detected when not set.").
+		Envar("KIND_EXPERIMENTAL_PROVIDER").
+		EnumVar(&st.Runtime, "docker", "podman", "nerdctl")
+
+	// Evaluate the checks gating a benchmark.
+	ch := checks.New(dr)
+	check := app.Command("check", "Evaluate the checks of the checks files, like deployments with ready replicas, endpoints answering HTTP or PromQL queries returning data, until they pass or time out. check -f checks.yaml -v PR_NUMBER:1234").
+		Action(ch.Run)
+	check.Flag("kubeconfig", "kubeconfig file of the cluster of the deployment and service checks, defaults to $KUBECONFIG or $HOME/.kube/config, or the in-cluster config.").
+		StringVar(&ch.Kubeconfig)
+	check.Flag("context", "Context of the kubeconfig to use, defaults to the current context.").
+		StringVar(&ch.Context)
+	check.Flag("interval", "Interval between the evaluations of a check.").
+		Default("10s").
+		DurationVar(&ch.Interval)
+	check.Flag("check-timeout", "Timeout of the checks without one.").
+		Default("5m").
+		DurationVar(&ch.Timeout)
+
+	// Estimate and report the cost of the nodes.
+	co := cost.New(dr)
+	costCmd := app.Command("cost", "Estimate and report the cost of the nodes of a benchmark. The default prices are the on-demand prices of the common GKE machine types in us-central1, EKS instance types in us-east-1 and DOKS droplets.")
+	costCmd.Flag("price", "Hourly price in dollars of a machine type, overriding its default price, e.g. n1-highmem-8=0.47 or n1-highmem-8/preemptible=0.1. Can be repeated.").
+		PlaceHolder("TYPE=PRICE").
+		StringMapVar(&co.Prices)
+	costCmd.Flag("format", "Output format - table or markdown.").
+		Default("table").
+		EnumVar(&co.Format, "table", "markdown")
+	costEstimate := costCmd.Command("estimate", "Estimate the cost of running the nodepools of the GKE, EKS or DOKS cluster and nodes files. cost estimate -f manifests/prombench/nodes_gke.yaml -v PR_NUMBER:1234 --duration 72h").
+		Action(co.Estimate)
+	costEstimate.Flag("duration", "Duration of the run.").
+		Default("1h").
+		DurationVar(&co.Duration)
+	costReport := costCmd.Command("report", "Report the node hours consumed by the nodes of a cluster since they were created and their cost, before deleting them. cost report -l node-name=prometheus-1234").
+		Action(co.Report)
+	costReport.Flag("kubeconfig", "kubeconfig file of the cluster, defaults to $KUBECONFIG or $HOME/.kube/config, or the in-cluster config.").
+		StringVar(&co.Kubeconfig)
+	costReport.Flag("context", "Context of the kubeconfig to use, defaults to the current context.").
+		StringVar(&co.Context)
+	costReport.Flag("selector", "Label selector of the nodes, like node-name=prometheus-1234. All nodes when not set.").
+		Short('l').
+		StringVar(&co.Selector)
+
+	// Validate the deployment files of a scenario.
+	sc := k8s.NewScenario(dr)
+	scenario := app.Command("scenario", "Work with the deployment files of benchmark scenarios.")
+	scenario.Command("validate", "Validate the nodepools and manifests of a scenario with its variables without a cluster, to catch broken edits in CI. scenario validate -f manifests/prombench/nodes_gke.yaml -f manifests/prombench/benchmark --vars-file values.yaml").
+		Action(sc.Validate)
+	scenarioRun := scenario.Command("run", "Run the stages of a scenario, each as soon as the stages it needs have succeeded. scenario run -f manifests/prombench/stages.yaml -v PR_NUMBER:1234").
+		Action(sc.RunStages)
+	scenarioRun.Flag("parallelism", "Maximum number of stages running at once, no limit when 0.").
+		Default("0").
+		IntVar(&sc.Parallelism)
+
+	// Cluster bootstrap commands.
+	b := &k8s.Bootstrap{}
+	bootstrap := app.Command("bootstrap", "Prepare an existing cluster for infra")
+	bootstrapRBAC := bootstrap.Command("rbac", "bootstrap rbac --kubeconfig admin.yaml --output infra.yaml").
+		Action(b.RBAC)
+	bootstrapRBAC.Flag("kubeconfig", "kubeconfig file with admin access to the cluster, defaults to $KUBECONFIG or $HOME/.kube/config.").
+		StringVar(&b.Kubeconfig)
+	bootstrapRBAC.Flag("context", "Context of the kubeconfig to use, defaults to the current context.").
+		StringVar(&b.Context)
+	bootstrapRBAC.Flag("namespace", "Namespace of the service account.").
+		Default("infra").
+		StringVar(&b.Namespace)
+	bootstrapRBAC.Flag("service-account", "Name of the service account, cluster role and cluster role binding.").
+		Default("infra").
+		StringVar(&b.ServiceAccount)
+	bootstrapRBAC.Flag("output", "File to write the kubeconfig of the service account to, defaults to stdout.").
+		Short('o').
+		StringVar(&b.Output)
+
+	// Fleet inventory exporter.
+	ex := provider.NewExporter()
+	ex.AddInventory("gke", g.NewGKEClient, g)
+	ex.AddInventory("eks", e.NewEKSClient, e)
+	ex.AddInventory("kind", k.NewKINDProvider, k)
+	exporter := app.Command("exporter", "Serve the inventory of the clusters of the providers as Prometheus metrics. exporter --provider gke --gke-auth service-account.json -v GKE_PROJECT_ID:test --provider eks --eks-auth credentials -v ZONE:eu-west-1 --price n1-standard-8=0.38").
+		Action(g.SetupDeploymentResources).
+		Action(e.SetupDeploymentResources).
+		Action(k.SetupDeploymentResources).
+		Action(ex.Run)
+	exporter.Flag("provider", "Provider to inventory - gke, eks or kind. Can be repeated.").
+		Required().
+		EnumsVar(&ex.Providers, "gke", "eks", "kind")
+	exporter.Flag("gke-auth", "json authentication for the GKE project, see the auth flag of the gke command.").
+		PlaceHolder("service-account.json").
+		StringVar(&g.Auth)
+	exporter.Flag("eks-auth", "filename which consist eks credentials, see the auth flag of the eks command.").
+		PlaceHolder("credentials").
+		StringVar(&e.Auth)
+	exporter.Flag("listen-address", "Address to serve the metrics on.").
+		Default(":9111").
+		StringVar(&ex.ListenAddress)
+	exporter.Flag("interval", "Time between the inventories of a provider.").
+		Default("5m").
+		DurationVar(&ex.Interval)
+	exporter.Flag("price", "Hourly price in dollars of a machine type for the cost estimate, overriding the default prices of the cost command, e.g. n1-standard-8=0.38. Can be repeated.").
+		PlaceHolder("TYPE=PRICE").
+		StringMapVar(&ex.Prices)
+
+	_, err := app.Parse(os.Args[1:])
+	if err := provider.Cleanup(); err != nil {
+		log.Printf("Couldn't clean up after the interruption: %v", err)
+	}
+	if err := report.Write(err); err != nil {
+		log.Printf("Couldn't write the report: %v", err)
+	}
+	if err := metrics.Write(err); err != nil {
+		log.Printf("Couldn't write the metrics: %v", err)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, errors.Wrapf(err, "Error parsing commandline arguments"))
 		app.Usage(os.Args[1:])
 		os.Exit(2)
 	}
 
 }
+
+// k8sOptionsFlags adds the flags of the k8s.Options to the resource and namespace commands of a provider,
+// and the helm-install command which applies only the objects of the HelmChart documents of the deployment files.
+func k8sOptionsFlags(o *k8s.Options, resource, namespaceDelete *kingpin.CmdClause, name string, apply kingpin.Action) {
+	resource.Flag("check-permissions", "Verify that the current identity can perform every operation on the objects before applying or deleting them and report the missing permissions.").
+		BoolVar(&o.CheckPermissions)
+
+	helmInstall := resource.Command("helm-install", fmt.Sprintf("Install the helm charts of the HelmChart documents of the deployment files. %v resource helm-install -f chartsFileOrFolder", name)).
+		PreAction(helmChartsOnly).
+		Action(apply)
+	for _, cmd := range []*kingpin.CmdClause{resource.GetCommand("apply"), helmInstall} {
+		cmd.Flag("rollout-timeout", "How long to wait for the applied deployments, statefulsets and daemonsets to have all their replicas updated and available before failing.").
+			Default("15m").
+			DurationVar(&o.RolloutTimeout)
+		cmd.Flag("force-conflicts", "Take over the fields of the objects managed by other field managers, like controllers or kubectl, instead of failing the server-side apply.").
+			BoolVar(&o.ForceConflicts)
+		cmd.Flag("create-namespaces", "Create the namespaces of the objects which don't exist and aren't in the deployment files, before applying them.").
+			BoolVar(&o.CreateNamespaces)
+		cmd.Flag("apply-concurrency", "How many objects to apply at a time. Objects are applied concurrently only with the objects of the same kinds rank, after the namespaces, CRDs, RBAC and configs they depend on.").
+			Default("4").
+			IntVar(&o.ApplyConcurrency)
+	}
+	// The helm charts have no apply set to prune.
+	resource.GetCommand("apply").Flag("prune", "Delete the objects of the apply set which are no longer in the deployment files, after applying them.").
+		BoolVar(&o.Prune)
+
+	resource.GetCommand("diff").Flag("force-conflicts", "Diff the apply taking over the fields of the objects managed by other field managers, see the apply command.").
+		BoolVar(&o.ForceConflicts)
+
+	resource.GetCommand("delete").Flag("force-finalizers", "Remove the finalizers of the objects still terminating after the delete timeout. Objects that couldn't be cleaned up by their finalizers can be orphaned in the cluster.").
+		BoolVar(&o.ForceFinalizers)
+	namespaceDelete.Flag("force-finalizers", "Remove the finalizers of the namespaces still terminating after the delete timeout. Objects that couldn't be cleaned up by their finalizers can be orphaned in the cluster.").
+		BoolVar(&o.ForceFinalizers)
+}
+
+// helmChartsOnly runs before the actions parsing the deployment files.
+func helmChartsOnly(*kingpin.ParseContext) error {
+	provider.HelmChartsOnly = true
+	return nil
+}
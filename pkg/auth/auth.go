@@ -0,0 +1,302 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auth authenticates the requests of the http services with bearer tokens, static tokens
+// or the ID tokens of an OpenID Connect issuer, and gives each token the scopes of the requests it can make.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// The scopes of the tokens, a token can only make the requests of its scopes.
+const (
+	// ScopeRead lists the runners of the runnerPool and streams the logs of the logStreamer.
+	ScopeRead = "read"
+	// ScopeTrigger leases runners and renews the leases.
+	ScopeTrigger = "trigger"
+	// ScopeTeardown releases the leases and removes runners.
+	ScopeTeardown = "teardown"
+	// ScopeAgent registers the runners with their heartbeats.
+	ScopeAgent = "agent"
+)
+
+// AllScopes are the scopes of the token passed to New.
+var AllScopes = []string{ScopeRead, ScopeTrigger, ScopeTeardown, ScopeAgent}
+
+// authConfig is the config of the tokens allowed to use the api.
+type authConfig struct {
+	Tokens []tokenConfig `yaml:"tokens"`
+	OIDC   *oidcConfig   `yaml:"oidc"`
+}
+
+// tokenConfig is a static token with its scopes.
+type tokenConfig struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// TokenFile is read instead of the Token to keep the token out of the config.
+	TokenFile string   `yaml:"token_file"`
+	Scopes    []string `yaml:"scopes"`
+}
+
+// oidcConfig accepts the ID tokens of an OpenID Connect issuer.
+type oidcConfig struct {
+	Issuer string `yaml:"issuer"`
+	// Audience is the client ID the tokens must be issued for.
+	Audience string `yaml:"audience"`
+	// Scopes of all the identities of the issuer.
+	Scopes []string `yaml:"scopes"`
+	// GroupsClaim is the claim with the groups of an identity, groups by default.
+	GroupsClaim string `yaml:"groups_claim"`
+	// Groups are the scopes of the identities in each group, in addition to the Scopes.
+	Groups map[string][]string `yaml:"groups"`
+}
+
+// Identity is the caller of the api.
+type Identity struct {
+	Name   string
+	scopes map[string]bool
+}
+
+func newIdentity(name string, scopes []string) *Identity {
+	id := &Identity{Name: name, scopes: map[string]bool{}}
+	id.grant(scopes)
+	return id
+}
+
+func (id *Identity) grant(scopes []string) {
+	for _, scope := range scopes {
+		id.scopes[scope] = true
+	}
+}
+
+// HasScope returns whether the identity can make the requests of the scope.
+func (id *Identity) HasScope(scope string) bool {
+	return id.scopes[scope]
+}
+
+// Authenticator authenticates the requests with their bearer token.
+type Authenticator struct {
+	tokens []tokenConfig
+	oidc   *oidcVerifier
+}
+
+// New returns an authenticator of the token, which has all the scopes,
+// and of the tokens of the config file when set.
+// It returns nil when there is nothing to authenticate with.
+func New(token, configFile string) (*Authenticator, error) {
+	a := &Authenticator{}
+	if token != "" {
+		a.tokens = append(a.tokens, tokenConfig{Name: "RUNNER_POOL_TOKEN", Token: token, Scopes: AllScopes})
+	}
+	if configFile != "" {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &authConfig{}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, errors.Wrapf(err, "parsing %v", configFile)
+		}
+		if err := a.init(cfg); err != nil {
+			return nil, errors.Wrapf(err, "invalid auth config %v", configFile)
+		}
+	}
+	if len(a.tokens) == 0 && a.oidc == nil {
+		return nil, nil
+	}
+	return a, nil
+}
+
+func (a *Authenticator) init(cfg *authConfig) error {
+	for _, t := range cfg.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("token without a name")
+		}
+		if (t.Token == "") == (t.TokenFile == "") {
+			return fmt.Errorf("token %v: exactly one of token or token_file must be set", t.Name)
+		}
+		if t.TokenFile != "" {
+			content, err := ioutil.ReadFile(t.TokenFile)
+			if err != nil {
+				return errors.Wrapf(err, "token %v", t.Name)
+			}
+			if t.Token = strings.TrimSpace(string(content)); t.Token == "" {
+				return fmt.Errorf("token %v: empty token file %v", t.Name, t.TokenFile)
+			}
+		}
+		if err := validateScopes(t.Scopes); err != nil {
+			return errors.Wrapf(err, "token %v", t.Name)
+		}
+		a.tokens = append(a.tokens, t)
+	}
+
+	if cfg.OIDC == nil {
+		return nil
+	}
+	if cfg.OIDC.Issuer == "" || cfg.OIDC.Audience == "" {
+		return fmt.Errorf("oidc: issuer and audience must be set")
+	}
+	if err := validateScopes(cfg.OIDC.Scopes); err != nil {
+		return errors.Wrap(err, "oidc")
+	}
+	for group, scopes := range cfg.OIDC.Groups {
+		if err := validateScopes(scopes); err != nil {
+			return errors.Wrapf(err, "oidc group %v", group)
+		}
+	}
+	if cfg.OIDC.GroupsClaim == "" {
+		cfg.OIDC.GroupsClaim = "groups"
+	}
+	a.oidc = &oidcVerifier{oidcConfig: *cfg.OIDC, client: &http.Client{Timeout: 30 * time.Second}}
+	return nil
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range AllScopes {
+			valid = valid || s == scope
+		}
+		if !valid {
+			return fmt.Errorf("unknown scope %q, valid scopes: %v", scope, strings.Join(AllScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the identity of the bearer token of the request.
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return newIdentity(t.Name, t.Scopes), nil
+		}
+	}
+	if a.oidc != nil && strings.Count(token, ".") == 2 {
+		return a.oidc.verify(r.Context(), token)
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+// Require returns a handler serving only the requests of the identities with the scope.
+// The other requests fail with 401 without a valid token and 403 without the scope.
+func (a *Authenticator) Require(scope string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !id.HasScope(scope) {
+			log.Printf("%v denied to %v without the %v scope", r.Method+" "+r.URL.Path, id.Name, scope)
+			http.Error(w, fmt.Sprintf("the %v scope is required", scope), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// oidcVerifier verifies the ID tokens of an issuer with the keys of its discovery document.
+type oidcVerifier struct {
+	oidcConfig
+	client *http.Client
+
+	mtx sync.Mutex
+	// verifier is created with the discovery document of the issuer on the first verification.
+	verifier *oidc.IDTokenVerifier
+}
+
+func (v *oidcVerifier) verify(ctx context.Context, token string) (*Identity, error) {
+	verifier, err := v.idTokenVerifier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	// The authorized party must be the audience, and is required when the token has other audiences.
+	// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, errors.Wrap(err, "invalid token claims")
+	}
+	azp, _ := claims["azp"].(string)
+	if azp == "" && len(idToken.Audience) > 1 {
+		return nil, fmt.Errorf("token with several audiences without an authorized party")
+	}
+	if azp != "" && azp != v.Audience {
+		return nil, fmt.Errorf("token authorized for %v", azp)
+	}
+
+	name, _ := claims["email"].(string)
+	if name == "" {
+		name = idToken.Subject
+	}
+	id := newIdentity(name, v.Scopes)
+	for group, scopes := range v.Groups {
+		if contains(claims[v.GroupsClaim], group) {
+			id.grant(scopes)
+		}
+	}
+	return id, nil
+}
+
+// idTokenVerifier returns the verifier of the tokens, fetching the discovery document of the issuer
+// until it succeeds. The keys of the issuer are fetched again when a token is signed with an unknown key.
+func (v *oidcVerifier) idTokenVerifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if v.verifier != nil {
+		return v.verifier, nil
+	}
+	// The provider keeps the context to fetch the keys so it must outlive the request.
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), v.client), v.Issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching the discovery document of %v", v.Issuer)
+	}
+	v.verifier = provider.Verifier(&oidc.Config{ClientID: v.Audience, SupportedSigningAlgs: []string{oidc.RS256}})
+	return v.verifier, nil
+}
+
+// contains returns whether a claim, a string or a list of strings, contains the value.
+func contains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		return c == value
+	case []interface{}:
+		for _, v := range c {
+			if v == value {
+				return true
+			}
+		}
+	}
+	return false
+}
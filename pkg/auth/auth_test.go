@@ -0,0 +1,77 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "auth.yml")
+	if err := ioutil.WriteFile(configFile, []byte(`
+tokens:
+- name: dashboard
+  token: dashboard-secret
+  scopes: [read]
+- name: agent
+  token: agent-secret
+  scopes: [agent]
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := New("admin-secret", configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(a.Require(ScopeRead, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	defer srv.Close()
+
+	for token, expected := range map[string]int{
+		"":                 http.StatusUnauthorized,
+		"other-secret":     http.StatusUnauthorized,
+		"agent-secret":     http.StatusForbidden,
+		"dashboard-secret": http.StatusOK,
+		"admin-secret":     http.StatusOK,
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("token %q: expected status %v, got %v", token, expected, resp.StatusCode)
+		}
+	}
+
+	if a, err := New("", ""); a != nil || err != nil {
+		t.Errorf("expected no authenticator without tokens, got %v, %v", a, err)
+	}
+}
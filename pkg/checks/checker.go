@@ -0,0 +1,127 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checks
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Checker evaluates the checks of the deployment files.
+type Checker struct {
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Kubeconfig of the cluster, defaults to $KUBECONFIG or $HOME/.kube/config,
+	// or the in-cluster config when there is none.
+	Kubeconfig string
+	// Context of the kubeconfig, the current context when empty.
+	Context string
+	// Interval between the evaluations of a check.
+	Interval time.Duration
+	// Timeout of the checks without one.
+	Timeout time.Duration
+}
+
+// New is the Checker constructor.
+func New(dr *provider.DeploymentResource) *Checker {
+	return &Checker{DeploymentResource: dr}
+}
+
+// Run evaluates the checks of the deployment files and fails when one of them doesn't pass before its timeout.
+// A cluster is only needed by the deployment checks and the service endpoints.
+func (c *Checker) Run(*kingpin.ParseContext) error {
+	if len(c.DeploymentResource.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing checks file(s)")
+	}
+	checks, err := Load(c.DeploymentResource.DeploymentFiles, provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	))
+	if err != nil {
+		return err
+	}
+
+	var cluster Cluster
+	for _, check := range checks {
+		if check.needsCluster() {
+			if cluster, err = c.cluster(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	log.Printf("Evaluating %v checks", len(checks))
+	results := Evaluate(provider.Context(), cluster, checks, c.Interval, c.Timeout)
+	if err := WriteResults(os.Stdout, results); err != nil {
+		return err
+	}
+	var failed []string
+	for _, r := range results {
+		if !r.Passed {
+			failed = append(failed, r.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%v of %v checks failed: %v", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (c *Checker) cluster() (*k8s.K8s, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if c.Kubeconfig != "" {
+		loadingRules.ExplicitPath = c.Kubeconfig
+	}
+	config, err := loadingRules.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading the kubeconfig")
+	}
+	if len(config.Contexts) == 0 && c.Kubeconfig == "" && c.Context == "" {
+		// Running in a pod of the cluster.
+		return k8s.New(provider.Context(), nil)
+	}
+	if c.Context != "" {
+		if _, ok := config.Contexts[c.Context]; !ok {
+			return nil, fmt.Errorf("context %v not found in the kubeconfig", c.Context)
+		}
+		config.CurrentContext = c.Context
+	}
+	return k8s.New(provider.Context(), config)
+}
+
+// WriteResults writes a table of the results, with the error of the failed checks.
+func WriteResults(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDURATION\tERROR")
+	for _, r := range results {
+		result, msg := "passed", ""
+		if !r.Passed {
+			result, msg = "failed", r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", r.Name, result, r.Duration.Round(time.Second), msg)
+	}
+	return tw.Flush()
+}
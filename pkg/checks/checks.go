@@ -0,0 +1,339 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package checks evaluates the conditions a deployment must meet, like a benchmark
+// before it starts: deployments with ready replicas, endpoints answering HTTP
+// and PromQL queries returning data.
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/yaml.v2"
+)
+
+// Check is a condition that is evaluated until it passes or times out.
+// It has exactly one of a deployment, an http or a promql condition.
+type Check struct {
+	Name string `yaml:"name"`
+	// Timeout of the check, the default timeout when 0.
+	Timeout model.Duration `yaml:"timeout,omitempty"`
+
+	Deployment *DeploymentCheck `yaml:"deployment,omitempty"`
+	HTTP       *HTTPCheck       `yaml:"http,omitempty"`
+	PromQL     *PromQLCheck     `yaml:"promql,omitempty"`
+}
+
+// DeploymentCheck passes when the deployment has enough ready replicas.
+type DeploymentCheck struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	// ReadyReplicas is the minimum number of ready replicas, all desired replicas when 0.
+	ReadyReplicas int32 `yaml:"readyReplicas,omitempty"`
+}
+
+// Endpoint is reached by URL or, from outside the cluster, through a port forward to a service.
+type Endpoint struct {
+	URL     string   `yaml:"url,omitempty"`
+	Service *Service `yaml:"service,omitempty"`
+}
+
+// Service is a port of a service of the cluster.
+type Service struct {
+	Namespace string `yaml:"namespace"`
+	Name      string `yaml:"name"`
+	Port      int    `yaml:"port"`
+}
+
+// HTTPCheck passes when a GET of the path of the endpoint returns the status.
+type HTTPCheck struct {
+	Endpoint `yaml:",inline"`
+	Path     string `yaml:"path,omitempty"`
+	// Status is the expected status code, 200 when 0.
+	Status int `yaml:"status,omitempty"`
+}
+
+// PromQLCheck passes when the query of the Prometheus at the endpoint returns a value above 0.
+type PromQLCheck struct {
+	Endpoint `yaml:",inline"`
+	Query    string `yaml:"query"`
+}
+
+type checksFile struct {
+	Checks []Check `yaml:"checks"`
+}
+
+// Cluster is the cluster of the deployment checks and of the service endpoints, implemented by k8s.K8s.
+type Cluster interface {
+	DeploymentReadyReplicas(namespace, name string) (ready, desired int32, err error)
+	PortForward(namespace, target string, ports []string) (*k8s.PortForward, error)
+}
+
+// Load parses the checks files after replacing the template variables.
+func Load(files []string, vars map[string]string) ([]Check, error) {
+	resources, err := provider.DeploymentsParse(files, vars)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse the checks files")
+	}
+
+	var checks []Check
+	names := map[string]bool{}
+	for _, r := range resources {
+		f := &checksFile{}
+		if err := yaml.UnmarshalStrict(r.Content, f); err != nil {
+			return nil, errors.Wrapf(err, "parsing the checks file %s", r.FileName)
+		}
+		for _, c := range f.Checks {
+			if err := c.validate(); err != nil {
+				return nil, errors.Wrapf(err, "checks file %s", r.FileName)
+			}
+			if names[c.Name] {
+				return nil, fmt.Errorf("checks file %s: check %q is defined twice", r.FileName, c.Name)
+			}
+			names[c.Name] = true
+			checks = append(checks, c)
+		}
+	}
+	return checks, nil
+}
+
+func (c Check) validate() error {
+	if c.Name == "" {
+		return errors.New("check without a name")
+	}
+	conditions := 0
+	for _, set := range []bool{c.Deployment != nil, c.HTTP != nil, c.PromQL != nil} {
+		if set {
+			conditions++
+		}
+	}
+	if conditions != 1 {
+		return fmt.Errorf("check %q must have exactly one of a deployment, an http or a promql condition", c.Name)
+	}
+	switch {
+	case c.Deployment != nil:
+		if c.Deployment.Namespace == "" || c.Deployment.Name == "" {
+			return fmt.Errorf("check %q: the deployment needs a namespace and a name", c.Name)
+		}
+	case c.HTTP != nil:
+		return c.HTTP.Endpoint.validate(c.Name)
+	case c.PromQL != nil:
+		if c.PromQL.Query == "" {
+			return fmt.Errorf("check %q: the promql condition needs a query", c.Name)
+		}
+		return c.PromQL.Endpoint.validate(c.Name)
+	}
+	return nil
+}
+
+func (e Endpoint) validate(check string) error {
+	if (e.URL == "") == (e.Service == nil) {
+		return fmt.Errorf("check %q must have exactly one of a url or a service", check)
+	}
+	if e.Service != nil && (e.Service.Namespace == "" || e.Service.Name == "" || e.Service.Port == 0) {
+		return fmt.Errorf("check %q: the service needs a namespace, a name and a port", check)
+	}
+	return nil
+}
+
+// needsCluster returns whether evaluating the check needs a Cluster.
+func (c Check) needsCluster() bool {
+	switch {
+	case c.Deployment != nil:
+		return true
+	case c.HTTP != nil:
+		return c.HTTP.Service != nil
+	case c.PromQL != nil:
+		return c.PromQL.Service != nil
+	}
+	return false
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Check
+	Passed   bool
+	Duration time.Duration
+	// Err is the error of the last evaluation of a failed check.
+	Err error
+}
+
+// Evaluate evaluates the checks at the same time, each every interval until it passes or its timeout is reached.
+// The cluster is only used by the deployment checks and the service endpoints.
+func Evaluate(ctx context.Context, cluster Cluster, checks []Check, interval, timeout time.Duration) []Result {
+	results := make([]Result, len(checks))
+	done := make(chan struct{})
+	for i, c := range checks {
+		go func(i int, c Check) {
+			defer func() { done <- struct{}{} }()
+			results[i] = evaluate(ctx, cluster, c, interval, timeout)
+		}(i, c)
+	}
+	for range checks {
+		<-done
+	}
+	return results
+}
+
+func evaluate(ctx context.Context, cluster Cluster, c Check, interval, timeout time.Duration) Result {
+	if c.Timeout > 0 {
+		timeout = time.Duration(c.Timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var last error
+	for {
+		err := c.eval(ctx, cluster)
+		if err == nil {
+			return Result{Check: c, Passed: true, Duration: time.Since(start)}
+		}
+		// An evaluation interrupted by the timeout doesn't tell why the check fails,
+		// report the one before it.
+		if ctx.Err() == nil || last == nil {
+			last = err
+		}
+		select {
+		case <-ctx.Done():
+			return Result{Check: c, Duration: time.Since(start), Err: last}
+		case <-time.After(interval):
+		}
+	}
+}
+
+// eval evaluates the check once and returns why it doesn't pass.
+func (c Check) eval(ctx context.Context, cluster Cluster) error {
+	if c.needsCluster() && cluster == nil {
+		return errors.New("no cluster to evaluate the check")
+	}
+	switch {
+	case c.Deployment != nil:
+		d := c.Deployment
+		ready, desired, err := cluster.DeploymentReadyReplicas(d.Namespace, d.Name)
+		if err != nil {
+			return err
+		}
+		expected := d.ReadyReplicas
+		if expected == 0 {
+			expected = desired
+		}
+		if ready < expected {
+			return fmt.Errorf("deployment %v/%v has %v ready replicas, expected %v", d.Namespace, d.Name, ready, expected)
+		}
+		return nil
+
+	case c.HTTP != nil:
+		return c.HTTP.eval(ctx, cluster)
+
+	case c.PromQL != nil:
+		return c.PromQL.eval(ctx, cluster)
+	}
+	return nil
+}
+
+// url returns the url of the endpoint, with the port forward to close once done for a service.
+func (e Endpoint) url(cluster Cluster) (string, func(), error) {
+	if e.Service == nil {
+		return strings.TrimSuffix(e.URL, "/"), func() {}, nil
+	}
+	s := e.Service
+	pf, err := cluster.PortForward(s.Namespace, "svc/"+s.Name, []string{fmt.Sprintf(":%v", s.Port)})
+	if err != nil {
+		return "", nil, err
+	}
+	closePF := func() { pf.Close() }
+	ports, err := pf.Ports()
+	if err == nil && len(ports) == 0 {
+		err = errors.New("no forwarded port")
+	}
+	if err != nil {
+		closePF()
+		return "", nil, errors.Wrapf(err, "port forward to service %v/%v", s.Namespace, s.Name)
+	}
+	return fmt.Sprintf("http://localhost:%v", ports[0].Local), closePF, nil
+}
+
+func (h *HTTPCheck) eval(ctx context.Context, cluster Cluster) error {
+	base, done, err := h.url(cluster)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	url := base + h.Path
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	expected := h.Status
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if resp.StatusCode != expected {
+		return fmt.Errorf("GET %v returned %v, expected %v: %.200s", url, resp.StatusCode, expected, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (p *PromQLCheck) eval(ctx context.Context, cluster Cluster) error {
+	base, done, err := p.url(cluster)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	clt, err := api.NewClient(api.Config{Address: base})
+	if err != nil {
+		return errors.Wrap(err, "creating the Prometheus client")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	value, _, err := v1.NewAPI(clt).Query(ctx, p.Query, time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "query %q", p.Query)
+	}
+	switch v := value.(type) {
+	case model.Vector:
+		for _, s := range v {
+			if s.Value > 0 {
+				return nil
+			}
+		}
+	case *model.Scalar:
+		if v.Value > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("query %q returned no value above 0: %v", p.Query, value)
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_checks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		content string
+		err     string
+	}{
+		{
+			content: `checks:
+- name: prometheus ready
+  deployment: {namespace: prombench-{{ .PR_NUMBER }}, name: prometheus, readyReplicas: 1}
+  timeout: 10m
+- name: prometheus answers
+  http: {url: "http://prombench.example.com/{{ .PR_NUMBER }}/prometheus-pr", path: /-/ready}
+- name: targets up
+  promql: {service: {namespace: monitoring, name: prometheus-meta, port: 80}, query: count(up == 1)}
+`,
+		},
+		{content: "checks:\n- deployment: {namespace: a, name: b}\n", err: "check without a name"},
+		{content: "checks:\n- name: a\n", err: `check "a" must have exactly one of`},
+		{content: "checks:\n- name: a\n  http: {url: http://a, service: {namespace: a, name: b, port: 80}}\n", err: "exactly one of a url or a service"},
+		{content: "checks:\n- name: a\n  promql: {url: http://a}\n", err: "needs a query"},
+		{content: "checks:\n- name: a\n  http: {url: http://a}\n- name: a\n  http: {url: http://b}\n", err: "defined twice"},
+		{content: "checks:\n- name: a\n  http: {url: http://a, method: POST}\n", err: "field method not found"},
+	} {
+		file := filepath.Join(dir, "checks.yaml")
+		if err := ioutil.WriteFile(file, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		checks, err := Load([]string{file}, map[string]string{"PR_NUMBER": "1234"})
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(checks) != 3 || checks[0].Deployment.Namespace != "prombench-1234" || time.Duration(checks[0].Timeout) != 10*time.Minute {
+			t.Errorf("unexpected checks %+v", checks)
+		}
+		if checks[1].needsCluster() || !checks[2].needsCluster() {
+			t.Error("expected only the service endpoint to need a cluster")
+		}
+	}
+}
+
+// TestLoadPrombench loads the checks gating the prombench benchmarks.
+func TestLoadPrombench(t *testing.T) {
+	vars := map[string]string{"PR_NUMBER": "123", "DOMAIN_NAME": "prombench.example.com"}
+	if _, err := Load([]string{"../../prombench/manifests/prombench/checks.yaml"}, vars); err != nil {
+		t.Error(err)
+	}
+}
+
+type fakeCluster struct {
+	mtx   sync.Mutex
+	ready int32
+}
+
+func (f *fakeCluster) DeploymentReadyReplicas(namespace, name string) (int32, int32, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if name != "prometheus" {
+		return 0, 0, errors.Errorf("deployment %v not found", name)
+	}
+	// A replica becomes ready at every evaluation.
+	f.ready++
+	return f.ready, 3, nil
+}
+
+func (f *fakeCluster) PortForward(string, string, []string) (*k8s.PortForward, error) {
+	return nil, errors.New("no port forward")
+}
+
+func TestEvaluate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/-/ready":
+			fmt.Fprintln(w, "Prometheus is Ready.")
+		case "/api/v1/query":
+			value := "0"
+			if r.FormValue("query") == "count(up == 1)" {
+				value = "2"
+			}
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1591000000,"%v"]}]}}`, value)
+		default:
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	checks := []Check{
+		{Name: "all replicas ready", Deployment: &DeploymentCheck{Namespace: "prombench-1234", Name: "prometheus"}},
+		{Name: "missing deployment", Deployment: &DeploymentCheck{Namespace: "prombench-1234", Name: "loadgen"}},
+		{Name: "ready", HTTP: &HTTPCheck{Endpoint: Endpoint{URL: srv.URL + "/"}, Path: "/-/ready"}},
+		{Name: "unavailable", HTTP: &HTTPCheck{Endpoint: Endpoint{URL: srv.URL}, Path: "/-/healthy"}},
+		{Name: "targets up", PromQL: &PromQLCheck{Endpoint: Endpoint{URL: srv.URL}, Query: "count(up == 1)"}},
+		{Name: "no samples", PromQL: &PromQLCheck{Endpoint: Endpoint{URL: srv.URL}, Query: "count(up == 0)"}},
+		{Name: "port forward", HTTP: &HTTPCheck{Endpoint: Endpoint{Service: &Service{Namespace: "a", Name: "b", Port: 80}}}},
+	}
+	results := Evaluate(context.Background(), &fakeCluster{}, checks, 10*time.Millisecond, 200*time.Millisecond)
+
+	expected := map[string]string{
+		"all replicas ready": "",
+		"missing deployment": "deployment loadgen not found",
+		"ready":              "",
+		"unavailable":        "returned 503, expected 200: Service Unavailable",
+		"targets up":         "",
+		"no samples":         `query "count(up == 0)" returned no value above 0`,
+		"port forward":       "no port forward",
+	}
+	for _, r := range results {
+		msg := expected[r.Name]
+		if msg == "" {
+			if !r.Passed {
+				t.Errorf("%v: expected the check to pass, got %v", r.Name, r.Err)
+			}
+			continue
+		}
+		if r.Passed || !strings.Contains(r.Err.Error(), msg) {
+			t.Errorf("%v: expected the check to fail with %q, got %v", r.Name, msg, r.Err)
+		}
+	}
+}
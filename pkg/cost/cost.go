@@ -0,0 +1,349 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cost
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Cost estimates the cost of the nodepools of the deployment files
+// and reports the cost of the nodes running in a cluster.
+type Cost struct {
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Prices are the hourly prices of the machine types in dollars, overriding the provider.DefaultPrices.
+	Prices map[string]string
+	// Format of the output, table or markdown.
+	Format string
+	// Duration of the estimated run.
+	Duration time.Duration
+	// Kubeconfig of the reported cluster, defaults to $KUBECONFIG or $HOME/.kube/config,
+	// or the in-cluster config when there is none.
+	Kubeconfig string
+	// Context of the kubeconfig, the current context when empty.
+	Context string
+	// Selector of the reported nodes, all nodes when empty.
+	Selector string
+}
+
+// New is the Cost constructor.
+func New(dr *provider.DeploymentResource) *Cost {
+	return &Cost{DeploymentResource: dr, Prices: map[string]string{}}
+}
+
+// Usage is the usage of the nodes of a nodepool.
+type Usage struct {
+	Nodepool    string
+	MachineType string
+	Preemptible bool
+	Nodes       int
+	NodeHours   float64
+	// Price is the hourly price of a node, 0 when the machine type has no price.
+	Price float64
+}
+
+// Cost is the cost of the node hours.
+func (u Usage) Cost() float64 {
+	return u.Price * u.NodeHours
+}
+
+// Estimate prints the estimated cost of running the nodepools of the GKE, EKS and DOKS cluster and nodes files for the duration.
+func (c *Cost) Estimate(*kingpin.ParseContext) error {
+	if len(c.DeploymentResource.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing cluster or nodes file(s)")
+	}
+	deployments, err := provider.DeploymentsParse(c.DeploymentResource.DeploymentFiles, provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	))
+	if err != nil {
+		return err
+	}
+	var usage []Usage
+	for _, d := range deployments {
+		u, err := EstimateNodepools(d.Content, c.Duration)
+		if err != nil {
+			return errors.Wrapf(err, "estimating the nodepools of %v", d.FileName)
+		}
+		usage = append(usage, u...)
+	}
+	if len(usage) == 0 {
+		return fmt.Errorf("no nodepools in the deployment files")
+	}
+	return c.write(os.Stdout, usage)
+}
+
+// Report prints the node hours consumed by the nodes of the cluster since they were created and their cost,
+// to run before the nodes are deleted.
+func (c *Cost) Report(*kingpin.ParseContext) error {
+	cluster, err := c.cluster()
+	if err != nil {
+		return err
+	}
+	nodes, err := cluster.NodesList(c.Selector)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no nodes with selector %q", c.Selector)
+	}
+	return c.write(os.Stdout, NodeUsage(nodes, time.Now()))
+}
+
+func (c *Cost) cluster() (*k8s.K8s, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if c.Kubeconfig != "" {
+		loadingRules.ExplicitPath = c.Kubeconfig
+	}
+	config, err := loadingRules.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading the kubeconfig")
+	}
+	if len(config.Contexts) == 0 && c.Kubeconfig == "" && c.Context == "" {
+		// Running in a pod of the cluster.
+		return k8s.New(provider.Context(), nil)
+	}
+	if c.Context != "" {
+		if _, ok := config.Contexts[c.Context]; !ok {
+			return nil, fmt.Errorf("context %v not found in the kubeconfig", c.Context)
+		}
+		config.CurrentContext = c.Context
+	}
+	return k8s.New(provider.Context(), config)
+}
+
+// EstimateNodepools returns the usage of the nodepools of a GKE, EKS or DOKS cluster or nodes file running for the duration.
+// The GKE nodepools have their initial node count in each of their locations, the EKS nodegroups their desired size.
+func EstimateNodepools(content []byte, duration time.Duration) ([]Usage, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	var usage []Usage
+	add := func(items interface{}, parse func(fields map[string]interface{}) Usage) error {
+		if items == nil {
+			return nil
+		}
+		list, ok := items.([]interface{})
+		if !ok {
+			return fmt.Errorf("the nodepools must be a list")
+		}
+		for i, item := range list {
+			fields, ok := item.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("nodepool %v must be a map", i+1)
+			}
+			u := parse(fields)
+			if u.MachineType == "" {
+				return fmt.Errorf("nodepool %v has no machine type", u.Nodepool)
+			}
+			u.NodeHours = float64(u.Nodes) * duration.Hours()
+			usage = append(usage, u)
+		}
+		return nil
+	}
+
+	// GKE.
+	if cluster, ok := doc["cluster"].(map[string]interface{}); ok {
+		if err := add(cluster["nodepools"], func(fields map[string]interface{}) Usage {
+			config, _ := fields["config"].(map[string]interface{})
+			locations, _ := fields["locations"].([]interface{})
+			zones := len(locations)
+			if zones == 0 {
+				zones = 1
+			}
+			return Usage{
+				Nodepool:    str(fields["name"]),
+				MachineType: str(config["machinetype"]),
+				Preemptible: str(config["preemptible"]) == "true",
+				Nodes:       number(fields["initialnodecount"]) * zones,
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	// EKS.
+	if err := add(doc["nodegroups"], func(fields map[string]interface{}) Usage {
+		u := Usage{Nodepool: str(fields["nodegroupname"])}
+		if types, ok := fields["instancetypes"].([]interface{}); ok && len(types) > 0 {
+			u.MachineType = str(types[0])
+		}
+		if scaling, ok := fields["scalingconfig"].(map[string]interface{}); ok {
+			u.Nodes = number(scaling["desiredsize"])
+		}
+		return u
+	}); err != nil {
+		return nil, err
+	}
+	// DOKS.
+	if err := add(doc["nodepools"], func(fields map[string]interface{}) Usage {
+		return Usage{
+			Nodepool:    str(fields["name"]),
+			MachineType: str(fields["size"]),
+			Nodes:       number(fields["count"]),
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// The labels of the nodepool and the machine type of the nodes.
+var (
+	nodepoolLabels    = []string{"cloud.google.com/gke-nodepool", "eks.amazonaws.com/nodegroup", "doks.digitalocean.com/node-pool"}
+	machineTypeLabels = []string{"node.kubernetes.io/instance-type", "beta.kubernetes.io/instance-type"}
+)
+
+// NodeUsage returns the node hours consumed by the nodes since they were created, by nodepool and machine type.
+func NodeUsage(nodes []apiCoreV1.Node, now time.Time) []Usage {
+	byPool := map[Usage]*Usage{}
+	for _, n := range nodes {
+		key := Usage{
+			Nodepool:    labelValue(n.Labels, nodepoolLabels),
+			MachineType: labelValue(n.Labels, machineTypeLabels),
+			Preemptible: n.Labels["cloud.google.com/gke-preemptible"] == "true",
+		}
+		if key.Nodepool == "" {
+			key.Nodepool = n.Name
+		}
+		u, ok := byPool[key]
+		if !ok {
+			u = &Usage{Nodepool: key.Nodepool, MachineType: key.MachineType, Preemptible: key.Preemptible}
+			byPool[key] = u
+		}
+		u.Nodes++
+		if created := n.CreationTimestamp.Time; created.Before(now) {
+			u.NodeHours += now.Sub(created).Hours()
+		}
+	}
+	usage := make([]Usage, 0, len(byPool))
+	for _, u := range byPool {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Nodepool != usage[j].Nodepool {
+			return usage[i].Nodepool < usage[j].Nodepool
+		}
+		return usage[i].MachineType < usage[j].MachineType
+	})
+	return usage
+}
+
+// write prices the usage and writes it with the totals in the format of the Cost.
+func (c *Cost) write(w io.Writer, usage []Usage) error {
+	prices, err := provider.ParsePrices(c.Prices)
+	if err != nil {
+		return err
+	}
+	var (
+		nodes           int
+		nodeHours, cost float64
+		hourly          float64
+		unpriced        []string
+	)
+	for i, u := range usage {
+		key := u.MachineType
+		if u.Preemptible {
+			key += provider.PreemptibleSuffix
+		}
+		price, ok := prices[key]
+		if !ok && (len(unpriced) == 0 || unpriced[len(unpriced)-1] != key) {
+			unpriced = append(unpriced, key)
+		}
+		usage[i].Price = price
+		nodes += u.Nodes
+		nodeHours += u.NodeHours
+		hourly += price * float64(u.Nodes)
+		cost += usage[i].Cost()
+	}
+
+	price := func(p float64) string {
+		if p == 0 {
+			return "?"
+		}
+		return "$" + strconv.FormatFloat(p, 'f', 2, 64)
+	}
+	machineType := func(u Usage) string {
+		if u.Preemptible {
+			return u.MachineType + " (preemptible)"
+		}
+		return u.MachineType
+	}
+	switch c.Format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "NODEPOOL\tMACHINE TYPE\tNODES\tNODE HOURS\tHOURLY COST\tCOST")
+		for _, u := range usage {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%.1f\t%v\t%v\n", u.Nodepool, machineType(u), u.Nodes, u.NodeHours, price(u.Price*float64(u.Nodes)), price(u.Cost()))
+		}
+		fmt.Fprintf(tw, "TOTAL\t\t%v\t%.1f\t%v\t%v\n", nodes, nodeHours, price(hourly), price(cost))
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	case "markdown":
+		fmt.Fprintf(w, "| Nodepool | Machine type | Nodes | Node hours | Hourly cost | Cost |\n| --- | --- | --- | --- | --- | --- |\n")
+		for _, u := range usage {
+			fmt.Fprintf(w, "| %v | `%v` | %v | %.1f | %v | %v |\n", u.Nodepool, machineType(u), u.Nodes, u.NodeHours, price(u.Price*float64(u.Nodes)), price(u.Cost()))
+		}
+		fmt.Fprintf(w, "| **Total** | | %v | %.1f | %v | **%v** |\n", nodes, nodeHours, price(hourly), price(cost))
+	default:
+		return fmt.Errorf("unknown format %q", c.Format)
+	}
+	if len(unpriced) > 0 {
+		fmt.Fprintf(w, "\nThe totals exclude the machine types without a price, set them with --price: %v\n", unpriced)
+	}
+	return nil
+}
+
+func labelValue(labels map[string]string, keys []string) string {
+	for _, k := range keys {
+		if v, ok := labels[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+func str(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// number returns the yaml number, the template variables can make it a string.
+func number(v interface{}) int {
+	switch v := v.(type) {
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cost
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEstimatePrombench(t *testing.T) {
+	vars := map[string]string{
+		"ZONE": "us-central1-a", "GKE_PROJECT_ID": "test", "CLUSTER_NAME": "test", "PR_NUMBER": "1", "PREEMPTIBLE": "true",
+		"EKS_WORKER_ROLE_ARN": "arn", "EKS_SUBNET_IDS": "a,b", "SEPARATOR": ",",
+	}
+	for _, tc := range []struct {
+		file     string
+		expected []Usage
+	}{
+		{
+			file: "../../prombench/manifests/prombench/nodes_gke.yaml",
+			expected: []Usage{
+				{Nodepool: "prometheus-1", MachineType: "n1-highmem-8", Preemptible: true, Nodes: 2, NodeHours: 6},
+				{Nodepool: "nodes-1", MachineType: "n1-highcpu-16", Preemptible: true, Nodes: 1, NodeHours: 3},
+			},
+		},
+		{
+			file: "../../prombench/manifests/prombench/nodes_eks.yaml",
+			expected: []Usage{
+				{Nodepool: "prometheus-1", MachineType: "r5d.2xlarge", Nodes: 2, NodeHours: 6},
+				{Nodepool: "nodes-1", MachineType: "c5.4xlarge", Nodes: 1, NodeHours: 3},
+			},
+		},
+	} {
+		deployments, err := provider.DeploymentsParse([]string{tc.file}, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		usage, err := EstimateNodepools(deployments[0].Content, 3*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(usage, tc.expected) {
+			t.Errorf("%v: expected %+v, got %+v", tc.file, tc.expected, usage)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	now := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+	node := func(name, pool, machineType string, age time.Duration) apiCoreV1.Node {
+		return apiCoreV1.Node{ObjectMeta: apiMetaV1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: apiMetaV1.NewTime(now.Add(-age)),
+			Labels:            map[string]string{"cloud.google.com/gke-nodepool": pool, "node.kubernetes.io/instance-type": machineType},
+		}}
+	}
+	usage := NodeUsage([]apiCoreV1.Node{
+		node("a", "prometheus-1", "n1-highmem-8", 2*time.Hour),
+		node("b", "prometheus-1", "n1-highmem-8", time.Hour),
+		node("c", "nodes-1", "e2-small", 3*time.Hour),
+	}, now)
+	expected := []Usage{
+		{Nodepool: "nodes-1", MachineType: "e2-small", Nodes: 1, NodeHours: 3},
+		{Nodepool: "prometheus-1", MachineType: "n1-highmem-8", Nodes: 2, NodeHours: 3},
+	}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, usage)
+	}
+
+	c := New(&provider.DeploymentResource{})
+	c.Prices["n1-highmem-8"] = "0.5"
+	for format, lines := range map[string][]string{
+		"table":    {"prometheus-1   n1-highmem-8   2       3.0          $1.00         $1.50", "TOTAL                         3       6.0          $1.00         $1.50"},
+		"markdown": {"| prometheus-1 | `n1-highmem-8` | 2 | 3.0 | $1.00 | $1.50 |", "| nodes-1 | `e2-small` | 1 | 3.0 | ? | ? |"},
+	} {
+		c.Format = format
+		var out bytes.Buffer
+		if err := c.write(&out, usage); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range append(lines, "set them with --price: [e2-small]") {
+			if !strings.Contains(out.String(), l) {
+				t.Errorf("%v: expected %q in:\n%v", format, l, out.String())
+			}
+		}
+	}
+	if err := New(&provider.DeploymentResource{}).write(ioutil.Discard, usage); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ChaosProbability is the probability of injecting a failure into a provider call, 0 disables it.
+// It is meant for development to exercise the retry and cleanup paths without waiting for real failures.
+var ChaosProbability float64
+
+// ChaosSeed seeds the injected failures so that a run can be reproduced, 0 uses a random seed.
+var ChaosSeed int64
+
+var (
+	chaosMtx  sync.Mutex
+	chaosRand *rand.Rand
+)
+
+// InjectedError is a failure injected by Chaos.
+type InjectedError struct {
+	Operation string
+	// Timeout is set when the operation is made to look like it never completes.
+	Timeout bool
+}
+
+func (e *InjectedError) Error() string {
+	if e.Timeout {
+		return fmt.Sprintf("chaos: '%v' timed out", e.Operation)
+	}
+	return fmt.Sprintf("chaos: '%v' failed", e.Operation)
+}
+
+// Chaos returns an InjectedError with the ChaosProbability, otherwise nil.
+// Half of the injected failures are timeouts.
+func Chaos(operation string) error {
+	if ChaosProbability <= 0 {
+		return nil
+	}
+	chaosMtx.Lock()
+	defer chaosMtx.Unlock()
+	if chaosRand == nil {
+		if ChaosSeed == 0 {
+			ChaosSeed = time.Now().UnixNano()
+		}
+		log.Printf("chaos: injecting failures with probability %v, seed %v", ChaosProbability, ChaosSeed)
+		chaosRand = rand.New(rand.NewSource(ChaosSeed))
+	}
+	if chaosRand.Float64() >= ChaosProbability {
+		return nil
+	}
+	err := &InjectedError{Operation: operation, Timeout: chaosRand.Intn(2) == 0}
+	log.Print(err)
+	return err
+}
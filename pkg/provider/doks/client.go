@@ -0,0 +1,250 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+	"golang.org/x/oauth2"
+)
+
+const apiURL = "https://api.digitalocean.com/v2"
+
+// Cluster is a DigitalOcean Kubernetes cluster.
+// https://developers.digitalocean.com/documentation/v2/#kubernetes
+type Cluster struct {
+	ID        string     `json:"id,omitempty" yaml:"-"`
+	Name      string     `json:"name" yaml:"name"`
+	Region    string     `json:"region" yaml:"region"`
+	Version   string     `json:"version" yaml:"version"`
+	VPCUUID   string     `json:"vpc_uuid,omitempty" yaml:"vpcuuid,omitempty"`
+	Tags      []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	NodePools []NodePool `json:"node_pools,omitempty" yaml:"-"`
+	Status    *Status    `json:"status,omitempty" yaml:"-"`
+}
+
+// NodePool is a node pool of a DigitalOcean Kubernetes cluster.
+type NodePool struct {
+	ID        string            `json:"id,omitempty" yaml:"-"`
+	Name      string            `json:"name" yaml:"name"`
+	Size      string            `json:"size" yaml:"size"`
+	Count     int               `json:"count" yaml:"count"`
+	Tags      []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	AutoScale bool              `json:"auto_scale,omitempty" yaml:"autoscale,omitempty"`
+	MinNodes  int               `json:"min_nodes,omitempty" yaml:"minnodes,omitempty"`
+	MaxNodes  int               `json:"max_nodes,omitempty" yaml:"maxnodes,omitempty"`
+	Nodes     []Node            `json:"nodes,omitempty" yaml:"-"`
+}
+
+// Node is a droplet of a node pool.
+type Node struct {
+	Name   string  `json:"name"`
+	Status *Status `json:"status"`
+}
+
+// Status is the state of a cluster or a node.
+type Status struct {
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// notFoundError is returned when the requested cluster or node pool doesn't exist.
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(*notFoundError)
+	return ok
+}
+
+// client is a minimal client for the DigitalOcean Kubernetes API.
+type client struct {
+	ctx  context.Context
+	http *http.Client
+}
+
+func newClient(ctx context.Context, token string) *client {
+	hc := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	hc.Transport = provider.RetryTransport(hc.Transport)
+	return &client{
+		ctx:  ctx,
+		http: hc,
+	}
+}
+
+// do sends the request and decodes the json response into out when it is not nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(c.ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return &notFoundError{msg: fmt.Sprintf("%v %v: not found", method, path)}
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%v %v: %v %s", method, path, resp.Status, content)
+	}
+	if out == nil || len(content) == 0 {
+		return nil
+	}
+	return json.Unmarshal(content, out)
+}
+
+// change sends a request that changes a cluster or nodepool.
+// In dry-run mode the request is only printed.
+func (c *client) change(method, path string, in, out interface{}) error {
+	if provider.DryRun {
+		return provider.DryRunRequest(method+" "+apiURL+path, in)
+	}
+	if err := provider.Chaos(method + " " + path); err != nil {
+		return err
+	}
+	return c.do(method, path, in, out)
+}
+
+func (c *client) createCluster(cluster *Cluster) (*Cluster, error) {
+	var resp struct {
+		Cluster *Cluster `json:"kubernetes_cluster"`
+	}
+	if err := c.change(http.MethodPost, "/kubernetes/clusters", cluster, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Cluster, nil
+}
+
+func (c *client) getCluster(id string) (*Cluster, error) {
+	var resp struct {
+		Cluster *Cluster `json:"kubernetes_cluster"`
+	}
+	if err := c.do(http.MethodGet, "/kubernetes/clusters/"+id, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Cluster, nil
+}
+
+// clusterByName returns the cluster with the given name.
+// Cluster names are unique within an account.
+// The clusters are listed following the next page links until the cluster is found.
+func (c *client) clusterByName(name string) (*Cluster, error) {
+	path := "/kubernetes/clusters?per_page=200"
+	for path != "" {
+		var resp struct {
+			Clusters []*Cluster `json:"kubernetes_clusters"`
+			Links    struct {
+				Pages struct {
+					Next string `json:"next"`
+				} `json:"pages"`
+			} `json:"links"`
+		}
+		if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, cluster := range resp.Clusters {
+			if cluster.Name == name {
+				return cluster, nil
+			}
+		}
+		next := resp.Links.Pages.Next
+		if next != "" && !strings.HasPrefix(next, apiURL+"/") {
+			return nil, fmt.Errorf("unexpected next page %v of the clusters", next)
+		}
+		path = strings.TrimPrefix(next, apiURL)
+	}
+	return nil, &notFoundError{msg: fmt.Sprintf("cluster %v not found", name)}
+}
+
+func (c *client) deleteCluster(id string) error {
+	return c.change(http.MethodDelete, "/kubernetes/clusters/"+id, nil, nil)
+}
+
+func (c *client) createNodePool(clusterID string, pool *NodePool) error {
+	return c.change(http.MethodPost, "/kubernetes/clusters/"+clusterID+"/node_pools", pool, nil)
+}
+
+func (c *client) deleteNodePool(clusterID, poolID string) error {
+	return c.change(http.MethodDelete, "/kubernetes/clusters/"+clusterID+"/node_pools/"+poolID, nil, nil)
+}
+
+func (c *client) kubeconfig(clusterID string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL+"/kubernetes/clusters/"+clusterID+"/kubeconfig", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req.WithContext(c.ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting the kubeconfig: %v %s", resp.Status, content)
+	}
+	return content, nil
+}
+
+// latestVersion returns the newest Kubernetes version slug supported by DigitalOcean.
+func (c *client) latestVersion() (string, error) {
+	var resp struct {
+		Options struct {
+			Versions []struct {
+				Slug string `json:"slug"`
+			} `json:"versions"`
+		} `json:"options"`
+	}
+	if err := c.do(http.MethodGet, "/kubernetes/options", nil, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Options.Versions) == 0 {
+		return "", fmt.Errorf("no Kubernetes versions available")
+	}
+	return resp.Options.Versions[0].Slug, nil
+}
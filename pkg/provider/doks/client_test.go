@@ -0,0 +1,67 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// redirectTransport sends the requests to the API to the test server.
+type redirectTransport struct {
+	server *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.server.Scheme
+	req.URL.Host = t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClusterByName(t *testing.T) {
+	pages := map[string]string{
+		"": fmt.Sprintf(`{"kubernetes_clusters": [{"id": "1", "name": "a"}], "links": {"pages": {"next": "%v/kubernetes/clusters?page=2&per_page=200"}}}`, apiURL),
+		"2": fmt.Sprintf(`{"kubernetes_clusters": [{"id": "2", "name": "b"}], "links": {"pages": {"prev": "%v/kubernetes/clusters?page=1&per_page=200"}}}`, apiURL),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/kubernetes/clusters" || r.URL.Query().Get("per_page") != "200" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, pages[r.URL.Query().Get("page")])
+	}))
+	defer srv.Close()
+	server, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{ctx: context.Background(), http: &http.Client{Transport: redirectTransport{server: server}}}
+
+	for name, id := range map[string]string{"a": "1", "b": "2"} {
+		cluster, err := c.clusterByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cluster.ID != id {
+			t.Errorf("expected the cluster %v to have the id %v, got %v", name, id, cluster.ID)
+		}
+	}
+	if _, err := c.clusterByName("c"); !isNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,602 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+	yamlGo "gopkg.in/yaml.v2"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type Resource = provider.Resource
+
+// doksCluster is the format of the cluster and nodepool deployment files.
+type doksCluster struct {
+	Cluster   Cluster    `yaml:"cluster"`
+	NodePools []NodePool `yaml:"nodepools"`
+}
+
+// DOKS holds the fields used to generate an API request.
+type DOKS struct {
+	// The API token used to authenticate the cli.
+	// Can be a file path or an env variable that includes the token.
+	Auth string
+	// The client used when performing DigitalOcean API requests.
+	clientDOKS *client
+	// The k8s provider used when we work with the manifest files.
+	k8sProvider *k8sProvider.K8s
+	// Final DeploymentFiles files.
+	DeploymentFiles []string
+	// Final DeploymentVars.
+	DeploymentVars map[string]string
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Content bytes after parsing the template variables, grouped by filename.
+	doksResources []Resource
+	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
+	k8sResources []k8sProvider.Resource
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
+
+	ctx context.Context
+}
+
+// New is the DOKS constructor.
+func New(dr *provider.DeploymentResource) *DOKS {
+	return &DOKS{
+		DeploymentResource: dr,
+		ctx:                provider.Context(),
+	}
+}
+
+// NewDOKSClient sets the client used when performing DigitalOcean API requests.
+func (c *DOKS) NewDOKSClient(*kingpin.ParseContext) error {
+	if c.Auth != "" {
+	} else if c.Auth = os.Getenv("DIGITALOCEAN_TOKEN"); c.Auth == "" {
+		return errors.Errorf("no auth provided set the auth flag or the DIGITALOCEAN_TOKEN env variable")
+	}
+
+	// When the auth variable points to a file
+	// put the file content in the variable.
+	if content, err := ioutil.ReadFile(c.Auth); err == nil {
+		c.Auth = string(content)
+	}
+
+	c.clientDOKS = newClient(c.ctx, strings.TrimSpace(c.Auth))
+	return nil
+}
+
+// SetupDeploymentResources Sets up DeploymentVars and DeploymentFiles
+func (c *DOKS) SetupDeploymentResources(*kingpin.ParseContext) error {
+	c.DeploymentFiles = c.DeploymentResource.DeploymentFiles
+	c.DeploymentVars = provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	)
+	return nil
+}
+
+// checkDeploymentVarsAndFiles checks whether the requied deployment vars are passed.
+func (c *DOKS) checkDeploymentVarsAndFiles() error {
+	reqDepVars := []string{"ZONE", "CLUSTER_NAME"}
+	for _, k := range reqDepVars {
+		if v := c.DeploymentVars[k]; v == "" {
+			return fmt.Errorf("missing required %v variable", k)
+		}
+	}
+	if len(c.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+	return nil
+}
+
+// DOKSDeploymentsParse parses the cluster/nodepool deployment files and saves the result as bytes grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *DOKS) DOKSDeploymentsParse(*kingpin.ParseContext) error {
+	if err := c.checkDeploymentVarsAndFiles(); err != nil {
+		return err
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	c.doksResources = deploymentResource
+	return nil
+}
+
+// K8SDeploymentsParse parses the k8s objects deployment files and saves the result as k8s objects grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *DOKS) K8SDeploymentsParse(*kingpin.ParseContext) error {
+	if err := c.checkDeploymentVarsAndFiles(); err != nil {
+		return err
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	for _, deployment := range deploymentResource {
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
+		}
+		if len(k8sObjects) > 0 {
+			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
+		}
+	}
+	return nil
+}
+
+// parseCluster returns the cluster and nodepools of a deployment file.
+func parseCluster(deployment Resource) (*doksCluster, error) {
+	req := &doksCluster{}
+	if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
+		return nil, errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
+	}
+	if req.Cluster.Name == "" {
+		return nil, fmt.Errorf("missing cluster name in the deployment file %s", deployment.FileName)
+	}
+	return req, nil
+}
+
+// ClusterCreate creates a new cluster with the nodepools in the deployment files.
+// DigitalOcean requires at least one nodepool when creating a cluster.
+func (c *DOKS) ClusterCreate(*kingpin.ParseContext) error {
+	for _, deployment := range c.doksResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+
+		cluster := req.Cluster
+		if cluster.Version == "" || cluster.Version == "latest" {
+			if cluster.Version, err = c.clientDOKS.latestVersion(); err != nil {
+				return errors.Wrap(err, "getting the latest Kubernetes version")
+			}
+		}
+		cluster.Tags = c.resourceTags(cluster.Tags)
+		for _, pool := range req.NodePools {
+			pool.Tags = c.resourceTags(pool.Tags)
+			cluster.NodePools = append(cluster.NodePools, pool)
+		}
+
+		log.Printf("Cluster create request: name:'%s', version:'%s'", cluster.Name, cluster.Version)
+		created, err := c.clientDOKS.createCluster(&cluster)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't create cluster '%v', file:%v", cluster.Name, deployment.FileName)
+		}
+		if provider.DryRun {
+			continue
+		}
+		// A cluster still being created when the command is interrupted is deleted.
+		done := provider.OnInterrupt(fmt.Sprintf("deleting the cluster:%v being created", cluster.Name), func(ctx context.Context) error {
+			c.clientDOKS.ctx = ctx
+			return c.deleteCluster(created)
+		})
+
+		err = provider.RetryUntilTrue(
+			fmt.Sprintf("creating cluster:%v", cluster.Name),
+			provider.GlobalRetryCount,
+			func() (bool, error) { return c.clusterRunning(created.ID) },
+		)
+		if err != nil {
+			return errors.Wrap(err, "creating cluster")
+		}
+		done()
+	}
+	return nil
+}
+
+// ClusterDelete deletes a cluster together with its nodepools.
+func (c *DOKS) ClusterDelete(*kingpin.ParseContext) error {
+	for _, deployment := range c.doksResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+
+		cluster, err := c.clientDOKS.clusterByName(req.Cluster.Name)
+		if err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+
+		if err := c.deleteCluster(cluster); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCluster deletes the cluster and waits until it is removed.
+func (c *DOKS) deleteCluster(cluster *Cluster) error {
+	log.Printf("Removing cluster '%v'", cluster.Name)
+	if err := c.clientDOKS.deleteCluster(cluster.ID); err != nil {
+		return errors.Wrapf(err, "couldn't delete cluster '%v'", cluster.Name)
+	}
+	if provider.DryRun {
+		return nil
+	}
+
+	err := provider.RetryUntilTrue(
+		fmt.Sprintf("deleting cluster:%v", cluster.Name),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.clusterDeleted(cluster.ID) })
+	if err != nil {
+		return errors.Wrap(err, "removing cluster")
+	}
+	return nil
+}
+
+// clusterRunning checks whether a cluster is in a running state.
+func (c *DOKS) clusterRunning(id string) (bool, error) {
+	cluster, err := c.clientDOKS.getCluster(id)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "couldn't get cluster status")
+	}
+	switch cluster.Status.State {
+	case "running":
+		return true, nil
+	case "error", "deleting", "deleted":
+		return false, fmt.Errorf("Cluster not in a status to become ready - %s %s", cluster.Status.State, cluster.Status.Message)
+	}
+	log.Printf("Cluster '%v' status: %v", cluster.Name, cluster.Status.State)
+	return false, nil
+}
+
+// clusterDeleted checks whether a cluster is removed.
+func (c *DOKS) clusterDeleted(id string) (bool, error) {
+	cluster, err := c.clientDOKS.getCluster(id)
+	if err != nil {
+		if isNotFound(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, "couldn't get cluster status")
+	}
+	if cluster.Status.State == "deleted" {
+		return true, nil
+	}
+	log.Printf("Cluster '%v' status: %v", cluster.Name, cluster.Status.State)
+	return false, nil
+}
+
+// NodePoolCreate creates new nodepools in an existing cluster.
+func (c *DOKS) NodePoolCreate(*kingpin.ParseContext) error {
+	for _, deployment := range c.doksResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		cluster, err := c.clientDOKS.clusterByName(req.Cluster.Name)
+		if err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+
+		for _, pool := range req.NodePools {
+			pool.Tags = c.resourceTags(pool.Tags)
+			log.Printf("Nodepool create request: name:'%s', cluster:'%s'", pool.Name, cluster.Name)
+			if err := c.clientDOKS.createNodePool(cluster.ID, &pool); err != nil {
+				return errors.Wrapf(err, "couldn't create nodepool '%v' for cluster '%v', file:%v", pool.Name, cluster.Name, deployment.FileName)
+			}
+			if provider.DryRun {
+				continue
+			}
+
+			name := pool.Name
+			err = provider.RetryUntilTrue(
+				fmt.Sprintf("creating nodepool:%v for cluster:%v", name, cluster.Name),
+				provider.GlobalRetryCount,
+				func() (bool, error) { return c.nodePoolRunning(cluster.ID, name) },
+			)
+			if err != nil {
+				return errors.Wrap(err, "creating nodepool")
+			}
+		}
+	}
+	return nil
+}
+
+// NodePoolDelete deletes nodepools in an existing cluster.
+func (c *DOKS) NodePoolDelete(*kingpin.ParseContext) error {
+	for _, deployment := range c.doksResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		cluster, err := c.clientDOKS.clusterByName(req.Cluster.Name)
+		if err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+
+		for _, pool := range req.NodePools {
+			existing := nodePool(cluster, pool.Name)
+			if existing == nil {
+				log.Printf("Nodepool '%v' for cluster '%v' doesn't exist", pool.Name, cluster.Name)
+				continue
+			}
+			log.Printf("Nodepool delete request: name:'%s', cluster:'%s'", pool.Name, cluster.Name)
+			if err := c.clientDOKS.deleteNodePool(cluster.ID, existing.ID); err != nil {
+				return errors.Wrapf(err, "couldn't delete nodepool '%v' for cluster '%v', file:%v", pool.Name, cluster.Name, deployment.FileName)
+			}
+			if provider.DryRun {
+				continue
+			}
+
+			name := pool.Name
+			err = provider.RetryUntilTrue(
+				fmt.Sprintf("deleting nodepool:%v for cluster:%v", name, cluster.Name),
+				provider.GlobalRetryCount,
+				func() (bool, error) { return c.nodePoolDeleted(cluster.ID, name) },
+			)
+			if err != nil {
+				return errors.Wrap(err, "deleting nodepool")
+			}
+		}
+	}
+	return nil
+}
+
+// nodePool returns the nodepool of the cluster with the given name, nil when it doesn't exist.
+func nodePool(cluster *Cluster, name string) *NodePool {
+	for i, pool := range cluster.NodePools {
+		if pool.Name == name {
+			return &cluster.NodePools[i]
+		}
+	}
+	return nil
+}
+
+// nodePoolRunning checks whether all nodes of a nodepool are running.
+func (c *DOKS) nodePoolRunning(clusterID, name string) (bool, error) {
+	cluster, err := c.clientDOKS.getCluster(clusterID)
+	if err != nil {
+		return false, errors.Wrap(err, "couldn't get cluster status")
+	}
+	pool := nodePool(cluster, name)
+	if pool == nil {
+		return false, nil
+	}
+	if len(pool.Nodes) < pool.Count {
+		log.Printf("Nodepool '%v' for cluster '%v' has %v of %v nodes", name, cluster.Name, len(pool.Nodes), pool.Count)
+		return false, nil
+	}
+	for _, node := range pool.Nodes {
+		if node.Status == nil || node.Status.State != "running" {
+			log.Printf("Nodepool '%v' for cluster '%v' node '%v' not running", name, cluster.Name, node.Name)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// nodePoolDeleted checks whether a nodepool is removed.
+func (c *DOKS) nodePoolDeleted(clusterID, name string) (bool, error) {
+	cluster, err := c.clientDOKS.getCluster(clusterID)
+	if err != nil {
+		if isNotFound(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, "couldn't get cluster status")
+	}
+	if nodePool(cluster, name) == nil {
+		return true, nil
+	}
+	log.Printf("Nodepool '%v' for cluster '%v' is being deleted", name, cluster.Name)
+	return false, nil
+}
+
+// AllNodePoolsRunning returns an error if at least one nodepool is not running.
+func (c *DOKS) AllNodePoolsRunning(*kingpin.ParseContext) error {
+	return c.checkNodePools(c.nodePoolRunning, "not running")
+}
+
+// AllNodePoolsDeleted returns an error if at least one nodepool is not deleted.
+func (c *DOKS) AllNodePoolsDeleted(*kingpin.ParseContext) error {
+	return c.checkNodePools(c.nodePoolDeleted, "not deleted")
+}
+
+func (c *DOKS) checkNodePools(check func(clusterID, name string) (bool, error), msg string) error {
+	for _, deployment := range c.doksResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		cluster, err := c.clientDOKS.clusterByName(req.Cluster.Name)
+		if err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+		for _, pool := range req.NodePools {
+			ok, err := check(cluster.ID, pool.Name)
+			if err != nil {
+				return errors.Wrap(err, "error fetching nodepool info")
+			}
+			if !ok {
+				return fmt.Errorf("nodepool %v name: %v", msg, pool.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// resourceTags returns the tags for the clusters and nodepools created by infra.
+// DigitalOcean tags are plain strings so the labels are added as key:value.
+func (c *DOKS) resourceTags(tags []string) []string {
+	for k, v := range provider.ResourceLabels(c.DeploymentVars["OWNER"], time.Now()) {
+		tags = append(tags, k+":"+v)
+	}
+	return tags
+}
+
+// ClusterStatus prints the state of the cluster and, when it is running,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *DOKS) ClusterStatus(*kingpin.ParseContext) error {
+	s := &k8sProvider.ClusterStatus{Name: c.DeploymentVars["CLUSTER_NAME"]}
+	cluster, err := c.clientDOKS.clusterByName(s.Name)
+	if isNotFound(err) {
+		s.State = "NOT_FOUND"
+	} else if err != nil {
+		return errors.Wrap(err, "couldn't get cluster status")
+	} else {
+		s.State = cluster.Status.State
+	}
+
+	if s.State == "running" {
+		if err := c.NewK8sProvider(nil); err != nil {
+			return err
+		}
+		if err := c.k8sProvider.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
+// NewK8sProvider sets the k8s provider used for deploying k8s manifests.
+func (c *DOKS) NewK8sProvider(*kingpin.ParseContext) error {
+	cluster, err := c.clientDOKS.clusterByName(c.DeploymentVars["CLUSTER_NAME"])
+	if err != nil {
+		return errors.Wrap(err, "failed to get cluster details")
+	}
+	kubeconfig, err := c.clientDOKS.kubeconfig(cluster.ID)
+	if err != nil {
+		return err
+	}
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "parsing the cluster kubeconfig")
+	}
+
+	c.k8sProvider, err = k8sProvider.New(c.ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "k8s provider error")
+	}
+	return nil
+}
+
+// ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
+func (c *DOKS) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while applying a resource")
+	}
+	return nil
+}
+
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *DOKS) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	if err := c.k8sProvider.ResourceDiff(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while diffing the resources")
+	}
+	return nil
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *DOKS) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	if err := c.k8sProvider.ResourceLogs(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while streaming the logs")
+	}
+	return nil
+}
+
+// ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
+func (c *DOKS) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
+	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while deleting objects from a manifest file")
+	}
+	return nil
+}
+
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *DOKS) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *DOKS) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
+	}
+	return nil
+}
+
+// GetDeploymentVars shows deployment variables.
+func (c *DOKS) GetDeploymentVars(*kingpin.ParseContext) error {
+	fmt.Print("-------------------\n   DeploymentVars   \n------------------- \n")
+	for key, value := range c.DeploymentVars {
+		fmt.Println(key, " : ", value)
+	}
+
+	return nil
+}
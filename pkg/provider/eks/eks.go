@@ -21,11 +21,13 @@ import (
 	"log"
 	"os"
 	"regexp"
-	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsClient "github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	awsSession "github.com/aws/aws-sdk-go/aws/session"
 	eks "github.com/aws/aws-sdk-go/service/eks"
 	"github.com/pkg/errors"
@@ -35,8 +37,6 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 	yamlGo "gopkg.in/yaml.v2"
 
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes/scheme"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	awsToken "sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
@@ -69,6 +69,26 @@ type EKS struct {
 	eksResources []Resource
 	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
 	k8sResources []k8sProvider.Resource
+	// Clusters and nodegroups created by infra longer than this are deleted by the garbage collection.
+	MaxAge time.Duration
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
 
 	ctx context.Context
 }
@@ -112,14 +132,23 @@ func (c *EKS) NewEKSClient(*kingpin.ParseContext) error {
 		return errors.Wrap(err, "could not get credential values")
 	}
 
-	awsSess := awsSession.Must(awsSession.NewSession(&aws.Config{
+	// The SDK retries the throttled requests, the 5xx responses and the connection errors
+	// with a jittered exponential backoff, use the same backoff as the other providers.
+	b := provider.RetryBackoff
+	awsSess := awsSession.Must(awsSession.NewSession(request.WithRetryer(&aws.Config{
 		Credentials: credentials.NewStaticCredentialsFromCreds(*credValue),
 		Region:      aws.String(c.DeploymentVars["ZONE"]),
-	}))
+	}, awsClient.DefaultRetryer{
+		NumMaxRetries:    b.Attempts - 1,
+		MinRetryDelay:    b.Initial,
+		MaxRetryDelay:    b.Max,
+		MinThrottleDelay: b.Initial,
+		MaxThrottleDelay: b.Max,
+	})))
 
 	c.sessionAWS = awsSess
 	c.clientEKS = eks.New(awsSess)
-	c.ctx = context.Background()
+	c.ctx = provider.Context()
 	return nil
 }
 
@@ -176,25 +205,9 @@ func (c *EKS) K8SDeploymentsParse(*kingpin.ParseContext) error {
 	}
 
 	for _, deployment := range deploymentResource {
-
-		decode := scheme.Codecs.UniversalDeserializer().Decode
-		k8sObjects := make([]runtime.Object, 0)
-
-		for _, text := range strings.Split(string(deployment.Content), provider.Separator) {
-			text = strings.TrimSpace(text)
-			if len(text) == 0 {
-				continue
-			}
-
-			resource, _, err := decode([]byte(text), nil, nil)
-
-			if err != nil {
-				return errors.Wrapf(err, "decoding the resource file:%v, section:%v...", deployment.FileName, text[:100])
-			}
-			if resource == nil {
-				continue
-			}
-			k8sObjects = append(k8sObjects, resource)
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
 		}
 		if len(k8sObjects) > 0 {
 			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
@@ -203,134 +216,287 @@ func (c *EKS) K8SDeploymentsParse(*kingpin.ParseContext) error {
 	return nil
 }
 
-// ClusterCreate create a new cluster or applies changes to an existing cluster.
+// ClusterCreate creates the clusters of the deployment files and their nodegroups.
+// A cluster which already exists, for example after a crashed run, is adopted and its nodegroups are
+// reconciled with the deployment file like with NodeGroupCreate, unless it failed or is being deleted,
+// then it is deleted and created again.
 func (c *EKS) ClusterCreate(*kingpin.ParseContext) error {
 	req := &eksCluster{}
+	rec := provider.NewReconciliation("cluster")
+	defer rec.Report()
 	for _, deployment := range c.eksResources {
 
 		if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
 			return fmt.Errorf("Error parsing the cluster deployment file %s:%v", deployment.FileName, err)
 		}
 
-		log.Printf("Cluster create request: name:'%s'", *req.Cluster.Name)
-		_, err := c.clientEKS.CreateCluster(&req.Cluster)
+		req.Cluster.Tags = c.resourceTags(req.Cluster.Tags)
+		existing, err := c.existingCluster(*req.Cluster.Name)
 		if err != nil {
-			return fmt.Errorf("Couldn't create cluster '%v', file:%v ,err: %v", *req.Cluster.Name, deployment.FileName, err)
+			return err
+		}
+		var status string
+		if existing != nil {
+			status = aws.StringValue(existing.Status)
+		}
+		switch {
+		case existing == nil:
+			rec.Created(*req.Cluster.Name)
+			err = c.createCluster(&req.Cluster)
+		case status == eks.ClusterStatusFailed || status == eks.ClusterStatusDeleting:
+			rec.Replaced(*req.Cluster.Name, []string{"status " + status})
+			err = c.replaceCluster(&req.Cluster, status)
+		default:
+			rec.Adopted(*req.Cluster.Name)
+			if !provider.DryRun {
+				err = provider.RetryUntilTrue(
+					fmt.Sprintf("creating cluster:%v", *req.Cluster.Name),
+					provider.EKSRetryCount,
+					func() (bool, error) { return c.clusterRunning(*req.Cluster.Name) },
+				)
+			}
 		}
-
-		err = provider.RetryUntilTrue(
-			fmt.Sprintf("creating cluster:%v", *req.Cluster.Name),
-			provider.EKSRetryCount,
-			func() (bool, error) { return c.clusterRunning(*req.Cluster.Name) },
-		)
-
 		if err != nil {
-			return fmt.Errorf("creating cluster err:%v", err)
+			return fmt.Errorf("creating cluster '%v', file:%v, err:%v", *req.Cluster.Name, deployment.FileName, err)
 		}
 
+		nodegroups := provider.NewReconciliation("nodegroup")
 		for _, nodegroupReq := range req.NodeGroups {
 			nodegroupReq.ClusterName = req.Cluster.Name
-			log.Printf("Nodegroup create request: NodeGroupName: '%s', ClusterName: '%s'", *nodegroupReq.NodegroupName, *req.Cluster.Name)
-			_, err := c.clientEKS.CreateNodegroup(&nodegroupReq)
-			if err != nil {
-				return fmt.Errorf("Couldn't create nodegroup '%v' for cluster '%v, file:%v ,err: %v", nodegroupReq.NodegroupName, req.Cluster.Name, deployment.FileName, err)
-			}
-
-			err = provider.RetryUntilTrue(
-				fmt.Sprintf("creating nodegroup:%s for cluster:%s", *nodegroupReq.NodegroupName, *req.Cluster.Name),
-				provider.EKSRetryCount,
-				func() (bool, error) { return c.nodeGroupCreated(*nodegroupReq.NodegroupName, *req.Cluster.Name) },
-			)
-
-			if err != nil {
-				return fmt.Errorf("creating nodegroup err:%v", err)
+			nodegroupReq.Tags = c.resourceTags(nodegroupReq.Tags)
+			if err := c.reconcileNodeGroup(&nodegroupReq, nodegroups); err != nil {
+				return errors.Wrapf(err, "file:%v", deployment.FileName)
 			}
 		}
+		nodegroups.Report()
 	}
 	return nil
 }
 
+// createCluster creates a cluster and waits until it is active.
+func (c *EKS) createCluster(req *eks.CreateClusterInput) error {
+	log.Printf("Cluster create request: name:'%s'", *req.Name)
+	if provider.DryRun {
+		return provider.DryRunRequest("CreateCluster", req.String())
+	}
+	err := provider.Chaos("CreateCluster")
+	if err == nil {
+		_, err = c.clientEKS.CreateClusterWithContext(c.ctx, req)
+	}
+	if err != nil {
+		return fmt.Errorf("Couldn't create cluster '%v', err: %v", *req.Name, err)
+	}
+	// A cluster still being created when the command is interrupted is deleted.
+	name := *req.Name
+	created := provider.OnInterrupt(fmt.Sprintf("deleting the cluster:%v being created", name), func(ctx context.Context) error {
+		c.ctx = ctx
+		return c.deleteCluster(name)
+	})
+
+	if err := provider.RetryUntilTrue(
+		fmt.Sprintf("creating cluster:%v", *req.Name),
+		provider.EKSRetryCount,
+		func() (bool, error) { return c.clusterRunning(*req.Name) },
+	); err != nil {
+		return err
+	}
+	created()
+	return nil
+}
+
 // ClusterDelete deletes a eks Cluster
 func (c *EKS) ClusterDelete(*kingpin.ParseContext) error {
 	req := &eksCluster{}
+	var leftoversErr error
 	for _, deployment := range c.eksResources {
 
 		if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
 			return fmt.Errorf("Error parsing the cluster deployment file %s:%v", deployment.FileName, err)
 		}
 
-		// To delete a cluster we have to manually delete all cluster
-		log.Printf("Removing all nodepools for '%s'", *req.Cluster.Name)
+		if err := c.deleteCluster(*req.Cluster.Name); err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+		if provider.DryRun {
+			continue
+		}
+		// The remaining clusters are still deleted when resources of this one were left behind.
+		if err := c.verifyClusterDeleted(*req.Cluster.Name); err != nil && leftoversErr == nil {
+			leftoversErr = err
+		}
+	}
+	return leftoversErr
+}
 
-		// Listing all nodepools for cluster
-		reqL := &eks.ListNodegroupsInput{
-			ClusterName: req.Cluster.Name,
+// deleteCluster deletes all nodegroups of a cluster and then the cluster itself.
+func (c *EKS) deleteCluster(name string) error {
+	// To delete a cluster we have to manually delete all cluster
+	log.Printf("Removing all nodepools for '%s'", name)
+
+	// Listing all nodepools for cluster
+	reqL := &eks.ListNodegroupsInput{
+		ClusterName: aws.String(name),
+	}
+
+	for {
+		resL, err := c.clientEKS.ListNodegroups(reqL)
+		if err != nil {
+			return fmt.Errorf("listing nodepools err:%v", err)
 		}
 
-		for {
-			resL, err := c.clientEKS.ListNodegroups(reqL)
-			if err != nil {
-				return fmt.Errorf("listing nodepools err:%v", err)
+		for _, nodegroup := range resL.Nodegroups {
+			if err := c.deleteNodeGroup(*nodegroup, name); err != nil {
+				return err
 			}
+		}
 
-			for _, nodegroup := range resL.Nodegroups {
-				log.Printf("Removing nodepool '%s' in cluster '%s'", *nodegroup, *req.Cluster.Name)
+		if resL.NextToken == nil {
+			break
+		} else {
+			reqL.NextToken = resL.NextToken
+		}
+	}
 
-				reqD := eks.DeleteNodegroupInput{
-					ClusterName:   req.Cluster.Name,
-					NodegroupName: nodegroup,
-				}
-				_, err := c.clientEKS.DeleteNodegroup(&reqD)
-				if err != nil {
-					return fmt.Errorf("Couldn't create nodegroup '%v' for cluster '%v ,err: %v", *nodegroup, req.Cluster.Name, err)
-				}
+	reqD := &eks.DeleteClusterInput{
+		Name: aws.String(name),
+	}
 
-				err = provider.RetryUntilTrue(
-					fmt.Sprintf("deleting nodegroup:%v for cluster:%v", *nodegroup, *req.Cluster.Name),
-					provider.GlobalRetryCount,
-					func() (bool, error) { return c.nodeGroupDeleted(*nodegroup, *req.Cluster.Name) },
-				)
+	log.Printf("Removing cluster '%v'", *reqD.Name)
+	if provider.DryRun {
+		return provider.DryRunRequest("DeleteCluster", reqD.String())
+	}
+	err := provider.Chaos("DeleteCluster")
+	if err == nil {
+		_, err = c.clientEKS.DeleteCluster(reqD)
+	}
+	if err != nil {
+		return fmt.Errorf("Couldn't delete cluster '%v', err: %v", name, err)
+	}
 
-				if err != nil {
-					return fmt.Errorf("deleting nodegroup err:%v", err)
-				}
-			}
+	err = provider.RetryUntilTrue(
+		fmt.Sprintf("deleting cluster:%v", *reqD.Name),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.clusterDeleted(*reqD.Name) })
 
-			if resL.NextToken == nil {
-				break
-			} else {
-				reqL.NextToken = resL.NextToken
-			}
-		}
+	if err != nil {
+		return fmt.Errorf("removing cluster err:%v", err)
+	}
+	return nil
+}
 
-		reqD := &eks.DeleteClusterInput{
-			Name: req.Cluster.Name,
-		}
+// deleteNodeGroup deletes a nodegroup and waits until it is removed.
+func (c *EKS) deleteNodeGroup(nodegroupName, clusterName string) error {
+	log.Printf("Removing nodepool '%s' in cluster '%s'", nodegroupName, clusterName)
 
-		log.Printf("Removing cluster '%v'", *reqD.Name)
-		_, err := c.clientEKS.DeleteCluster(reqD)
-		if err != nil {
-			return fmt.Errorf("Couldn't delete cluster '%v', file:%v ,err: %v", *req.Cluster.Name, deployment.FileName, err)
+	reqD := eks.DeleteNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(nodegroupName),
+	}
+	if provider.DryRun {
+		return provider.DryRunRequest("DeleteNodegroup", reqD.String())
+	}
+	err := provider.Chaos("DeleteNodegroup")
+	if err == nil {
+		_, err = c.clientEKS.DeleteNodegroup(&reqD)
+	}
+	if err != nil {
+		return fmt.Errorf("Couldn't delete nodegroup '%v' for cluster '%v ,err: %v", nodegroupName, clusterName, err)
+	}
+
+	err = provider.RetryUntilTrue(
+		fmt.Sprintf("deleting nodegroup:%v for cluster:%v", nodegroupName, clusterName),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.nodeGroupDeleted(nodegroupName, clusterName) },
+	)
+
+	if err != nil {
+		return fmt.Errorf("deleting nodegroup err:%v", err)
+	}
+	return nil
+}
+
+// GC deletes the clusters and nodegroups created by infra that are older than MaxAge.
+// Clusters not created by infra are kept, but their expired nodegroups are deleted.
+func (c *EKS) GC(*kingpin.ParseContext) error {
+	var clusters []string
+	err := c.clientEKS.ListClustersPages(&eks.ListClustersInput{}, func(page *eks.ListClustersOutput, _ bool) bool {
+		clusters = append(clusters, aws.StringValueSlice(page.Clusters)...)
+		return true
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing clusters")
+	}
+
+	now := time.Now()
+	var failed []string
+	for _, name := range clusters {
+		// Continue with the other clusters so that a single failure doesn't block the garbage collection.
+		if err := c.gcCluster(name, now); err != nil {
+			log.Printf("Garbage collecting cluster '%v' err: %v", name, err)
+			failed = append(failed, name)
 		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("garbage collection failed for clusters: %v", failed)
+	}
+	return nil
+}
 
-		err = provider.RetryUntilTrue(
-			fmt.Sprintf("deleting cluster:%v", *reqD.Name),
-			provider.GlobalRetryCount,
-			func() (bool, error) { return c.clusterDeleted(*reqD.Name) })
+// gcCluster deletes the cluster when it is expired, otherwise only its expired nodegroups.
+func (c *EKS) gcCluster(name string, now time.Time) error {
+	rep, err := c.clientEKS.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		return err
+	}
+	if provider.Expired(aws.StringValueMap(rep.Cluster.Tags), c.MaxAge, now) {
+		log.Printf("Removing expired cluster '%v', owner '%v'", name, aws.StringValue(rep.Cluster.Tags[provider.OwnerLabel]))
+		return c.deleteCluster(name)
+	}
 
-		if err != nil {
-			return fmt.Errorf("removing cluster err:%v", err)
+	var expired []string
+	err = c.clientEKS.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: aws.String(name)}, func(page *eks.ListNodegroupsOutput, _ bool) bool {
+		for _, nodegroup := range page.Nodegroups {
+			rep, err := c.clientEKS.DescribeNodegroup(&eks.DescribeNodegroupInput{ClusterName: aws.String(name), NodegroupName: nodegroup})
+			if err != nil {
+				log.Printf("Couldn't describe nodegroup '%v' for cluster '%v': %v", *nodegroup, name, err)
+				continue
+			}
+			if provider.Expired(aws.StringValueMap(rep.Nodegroup.Tags), c.MaxAge, now) {
+				expired = append(expired, *nodegroup)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, nodegroup := range expired {
+		log.Printf("Removing expired nodegroup '%v' in cluster '%v'", nodegroup, name)
+		if err := c.deleteNodeGroup(nodegroup, name); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// resourceTags returns the tags for the clusters and nodegroups created by infra.
+// The owner is set with the OWNER deployment variable.
+func (c *EKS) resourceTags(tags map[string]*string) map[string]*string {
+	if tags == nil {
+		tags = map[string]*string{}
+	}
+	for k, v := range provider.ResourceLabels(c.DeploymentVars["OWNER"], time.Now()) {
+		tags[k] = aws.String(v)
+	}
+	return tags
+}
+
 // clusterRunning checks whether a cluster is in a active state.
 func (c *EKS) clusterRunning(name string) (bool, error) {
 	req := &eks.DescribeClusterInput{
 		Name: aws.String(name),
 	}
-	clusterRes, err := c.clientEKS.DescribeCluster(req)
+	clusterRes, err := c.clientEKS.DescribeClusterWithContext(c.ctx, req)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeNotFoundException {
 			return false, nil
@@ -347,6 +513,32 @@ func (c *EKS) clusterRunning(name string) (bool, error) {
 	return false, nil
 }
 
+// ClusterStatus prints the state of the cluster and, when it is active,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *EKS) ClusterStatus(*kingpin.ParseContext) error {
+	s := &k8sProvider.ClusterStatus{Name: c.DeploymentVars["CLUSTER_NAME"]}
+	clusterRes, err := c.clientEKS.DescribeCluster(&eks.DescribeClusterInput{
+		Name: aws.String(s.Name),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeNotFoundException {
+		s.State = "NOT_FOUND"
+	} else if err != nil {
+		return fmt.Errorf("Couldn't get cluster status: %v", err)
+	} else {
+		s.State = *clusterRes.Cluster.Status
+	}
+
+	if s.State == eks.ClusterStatusActive {
+		if err := c.NewK8sProvider(nil); err != nil {
+			return err
+		}
+		if err := c.k8sProvider.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
 func (c *EKS) clusterDeleted(name string) (bool, error) {
 	req := &eks.DescribeClusterInput{
 		Name: aws.String(name),
@@ -363,9 +555,11 @@ func (c *EKS) clusterDeleted(name string) (bool, error) {
 	return false, nil
 }
 
-// NodeGroupCreate creates a new k8s nodegroup in an existing cluster.
+// NodeGroupCreate creates the nodegroups of the deployment files in an existing cluster.
+// The nodegroups which already exist, for example after a crashed run, are adopted or replaced, see reconcileNodeGroup.
 func (c *EKS) NodeGroupCreate(*kingpin.ParseContext) error {
 	req := &eksCluster{}
+	rec := provider.NewReconciliation("nodegroup")
 	for _, deployment := range c.eksResources {
 
 		if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
@@ -374,23 +568,13 @@ func (c *EKS) NodeGroupCreate(*kingpin.ParseContext) error {
 
 		for _, nodegroupReq := range req.NodeGroups {
 			nodegroupReq.ClusterName = req.Cluster.Name
-			log.Printf("Nodegroup create request: NodeGroupName: '%s', ClusterName: '%s'", *nodegroupReq.NodegroupName, *req.Cluster.Name)
-			_, err := c.clientEKS.CreateNodegroup(&nodegroupReq)
-			if err != nil {
-				return fmt.Errorf("Couldn't create nodegroup '%s' for cluster '%s', file:%v ,err: %v", *nodegroupReq.NodegroupName, *req.Cluster.Name, deployment.FileName, err)
-			}
-
-			err = provider.RetryUntilTrue(
-				fmt.Sprintf("creating nodegroup:%s for cluster:%s", *nodegroupReq.NodegroupName, *req.Cluster.Name),
-				provider.GlobalRetryCount,
-				func() (bool, error) { return c.nodeGroupCreated(*nodegroupReq.NodegroupName, *req.Cluster.Name) },
-			)
-
-			if err != nil {
-				return fmt.Errorf("creating nodegroup err:%v", err)
+			nodegroupReq.Tags = c.resourceTags(nodegroupReq.Tags)
+			if err := c.reconcileNodeGroup(&nodegroupReq, rec); err != nil {
+				return errors.Wrapf(err, "file:%v", deployment.FileName)
 			}
 		}
 	}
+	rec.Report()
 	return nil
 }
 
@@ -409,7 +593,16 @@ func (c *EKS) NodeGroupDelete(*kingpin.ParseContext) error {
 				ClusterName:   req.Cluster.Name,
 				NodegroupName: nodegroupReq.NodegroupName,
 			}
-			_, err := c.clientEKS.DeleteNodegroup(&reqD)
+			if provider.DryRun {
+				if err := provider.DryRunRequest("DeleteNodegroup", reqD.String()); err != nil {
+					return err
+				}
+				continue
+			}
+			err := provider.Chaos("DeleteNodegroup")
+			if err == nil {
+				_, err = c.clientEKS.DeleteNodegroup(&reqD)
+			}
 			if err != nil {
 				return fmt.Errorf("Couldn't delete nodegroup '%s' for cluster '%s, file:%v ,err: %v", *nodegroupReq.NodegroupName, *req.Cluster.Name, deployment.FileName, err)
 			}
@@ -433,7 +626,7 @@ func (c *EKS) nodeGroupCreated(nodegroupName, clusterName string) (bool, error)
 		ClusterName:   aws.String(clusterName),
 		NodegroupName: aws.String(nodegroupName),
 	}
-	nodegroupRes, err := c.clientEKS.DescribeNodegroup(req)
+	nodegroupRes, err := c.clientEKS.DescribeNodegroupWithContext(c.ctx, req)
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeNotFoundException {
 			return false, nil
@@ -507,12 +700,12 @@ func (c *EKS) AllNodeGroupsDeleted(*kingpin.ParseContext) error {
 }
 
 // EKSK8sToken returns aws iam authenticator token which is used to access eks k8s cluster from outside.
-func (c *EKS) EKSK8sToken(clusterName, region string) awsToken.Token {
+func (c *EKS) EKSK8sToken(clusterName, region string) (awsToken.Token, error) {
 
 	gen, err := awsToken.NewGenerator(true, false)
 
 	if err != nil {
-		log.Fatalf("Token abstraction error: %v", err)
+		return awsToken.Token{}, errors.Wrap(err, "token abstraction error")
 	}
 
 	opts := &awsToken.GetTokenOptions{
@@ -523,10 +716,10 @@ func (c *EKS) EKSK8sToken(clusterName, region string) awsToken.Token {
 	tok, err := gen.GetWithOptions(opts)
 
 	if err != nil {
-		log.Fatalf("Token abstraction error: %v", err)
+		return awsToken.Token{}, errors.Wrap(err, "token abstraction error")
 	}
 
-	return tok
+	return tok, nil
 }
 
 // NewK8sProvider sets the k8s provider used for deploying k8s manifests
@@ -560,7 +753,11 @@ func (c *EKS) NewK8sProvider(*kingpin.ParseContext) error {
 	clusterContext.AuthInfo = arnRole
 
 	authInfo := clientcmdapi.NewAuthInfo()
-	authInfo.Token = c.EKSK8sToken(clusterName, region).Token
+	token, err := c.EKSK8sToken(clusterName, region)
+	if err != nil {
+		return err
+	}
+	authInfo.Token = token.Token
 
 	config := clientcmdapi.NewConfig()
 	config.AuthInfos[arnRole] = authInfo
@@ -580,20 +777,79 @@ func (c *EKS) NewK8sProvider(*kingpin.ParseContext) error {
 
 // ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
 func (c *EKS) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
 	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
 		return fmt.Errorf("error while applying a resource err: %v", err)
 	}
 	return nil
 }
 
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *EKS) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	if err := c.k8sProvider.ResourceDiff(c.k8sResources); err != nil {
+		return fmt.Errorf("error while diffing the resources err: %v", err)
+	}
+	return nil
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *EKS) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	if err := c.k8sProvider.ResourceLogs(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while streaming the logs")
+	}
+	return nil
+}
+
 // ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
 func (c *EKS) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
 	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
 		return fmt.Errorf("error while deleting objects from a manifest file err: %v", err)
 	}
 	return nil
 }
 
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *EKS) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *EKS) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
+	}
+	return nil
+}
+
 // GetDeploymentVars shows deployment variables.
 func (c *EKS) GetDeploymentVars(*kingpin.ParseContext) error {
 	fmt.Print("-------------------\n   DeploymentVars   \n------------------- \n")
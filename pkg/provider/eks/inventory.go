@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eks
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+// Inventory returns the clusters of the ZONE region.
+// The nodes are the desired size of the nodegroups.
+func (c *EKS) Inventory() ([]provider.ClusterInfo, error) {
+	var names []string
+	if err := c.clientEKS.ListClustersPages(&eks.ListClustersInput{}, func(page *eks.ListClustersOutput, _ bool) bool {
+		names = append(names, aws.StringValueSlice(page.Clusters)...)
+		return true
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing clusters")
+	}
+
+	clusters := make([]provider.ClusterInfo, 0, len(names))
+	for _, name := range names {
+		info, err := c.clusterInfo(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cluster:%v", name)
+		}
+		clusters = append(clusters, info)
+	}
+	return clusters, nil
+}
+
+func (c *EKS) clusterInfo(name string) (provider.ClusterInfo, error) {
+	rep, err := c.clientEKS.DescribeCluster(&eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		return provider.ClusterInfo{}, err
+	}
+	info := provider.ClusterInfo{
+		Name:         name,
+		Location:     c.DeploymentVars["ZONE"],
+		Owner:        aws.StringValue(rep.Cluster.Tags[provider.OwnerLabel]),
+		Created:      aws.TimeValue(rep.Cluster.CreatedAt),
+		MachineTypes: map[string]int{},
+	}
+
+	var nodegroups []*string
+	if err := c.clientEKS.ListNodegroupsPages(&eks.ListNodegroupsInput{ClusterName: aws.String(name)}, func(page *eks.ListNodegroupsOutput, _ bool) bool {
+		nodegroups = append(nodegroups, page.Nodegroups...)
+		return true
+	}); err != nil {
+		return info, errors.Wrap(err, "listing nodegroups")
+	}
+	for _, nodegroup := range nodegroups {
+		rep, err := c.clientEKS.DescribeNodegroup(&eks.DescribeNodegroupInput{ClusterName: aws.String(name), NodegroupName: nodegroup})
+		if err != nil {
+			return info, errors.Wrapf(err, "describing nodegroup:%v", aws.StringValue(nodegroup))
+		}
+		var size int
+		if rep.Nodegroup.ScalingConfig != nil {
+			size = int(aws.Int64Value(rep.Nodegroup.ScalingConfig.DesiredSize))
+		}
+		info.Nodes += size
+		// Managed nodegroups have a single instance type.
+		if types := aws.StringValueSlice(rep.Nodegroup.InstanceTypes); len(types) > 0 && size > 0 {
+			info.MachineTypes[types[0]] += size
+		}
+	}
+	return info, nil
+}
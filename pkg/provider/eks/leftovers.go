@@ -0,0 +1,143 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eks
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+// maxTagsRequest is the maximum number of load balancers in a request for their tags.
+const maxTagsRequest = 20
+
+// clusterTagKey is the key of the tag set by kubernetes on the AWS resources created for a cluster,
+// like the volumes of persistent volumes and the load balancers of services.
+func clusterTagKey(cluster string) string {
+	return "kubernetes.io/cluster/" + cluster
+}
+
+// verifyClusterDeleted reports the resources of a deleted cluster that were left behind.
+// Deleting a cluster doesn't delete the volumes of the persistent volumes which weren't deleted
+// nor the load balancers, addresses and security groups of the services of type LoadBalancer.
+func (c *EKS) verifyClusterDeleted(cluster string) error {
+	run := fmt.Sprintf("cluster %v", cluster)
+	leftovers, err := c.clusterLeftovers(cluster)
+	if err != nil {
+		provider.CleanupUnverified(run, err)
+		return nil
+	}
+	return provider.ReportLeftovers(run, leftovers)
+}
+
+func (c *EKS) clusterLeftovers(cluster string) ([]provider.Leftover, error) {
+	key := clusterTagKey(cluster)
+	reason := "tag " + key
+	var leftovers []provider.Leftover
+	add := func(kind, name string) {
+		leftovers = append(leftovers, provider.Leftover{Kind: kind, Name: name, Reason: reason})
+	}
+
+	ec2Client := ec2.New(c.sessionAWS)
+	filters := []*ec2.Filter{{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{key})}}
+	if err := ec2Client.DescribeVolumesPages(&ec2.DescribeVolumesInput{Filters: filters}, func(out *ec2.DescribeVolumesOutput, _ bool) bool {
+		for _, v := range out.Volumes {
+			add("volume", aws.StringValue(v.VolumeId))
+		}
+		return true
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing volumes")
+	}
+	addresses, err := ec2Client.DescribeAddresses(&ec2.DescribeAddressesInput{Filters: filters})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing addresses")
+	}
+	for _, a := range addresses.Addresses {
+		add("address", aws.StringValue(a.PublicIp))
+	}
+	if err := ec2Client.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{Filters: filters}, func(out *ec2.DescribeSecurityGroupsOutput, _ bool) bool {
+		for _, g := range out.SecurityGroups {
+			add("security group", fmt.Sprintf("%v (%v)", aws.StringValue(g.GroupId), aws.StringValue(g.GroupName)))
+		}
+		return true
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing security groups")
+	}
+
+	// The load balancers can't be filtered by tag so their tags are requested in batches.
+	elbClient := elb.New(c.sessionAWS)
+	var names []*string
+	if err := elbClient.DescribeLoadBalancersPages(&elb.DescribeLoadBalancersInput{}, func(out *elb.DescribeLoadBalancersOutput, _ bool) bool {
+		for _, lb := range out.LoadBalancerDescriptions {
+			names = append(names, lb.LoadBalancerName)
+		}
+		return true
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing classic load balancers")
+	}
+	for len(names) > 0 {
+		n := len(names)
+		if n > maxTagsRequest {
+			n = maxTagsRequest
+		}
+		out, err := elbClient.DescribeTags(&elb.DescribeTagsInput{LoadBalancerNames: names[:n]})
+		if err != nil {
+			return nil, errors.Wrap(err, "listing the tags of classic load balancers")
+		}
+		for _, d := range out.TagDescriptions {
+			for _, t := range d.Tags {
+				if aws.StringValue(t.Key) == key {
+					add("load balancer", aws.StringValue(d.LoadBalancerName))
+				}
+			}
+		}
+		names = names[n:]
+	}
+
+	elbv2Client := elbv2.New(c.sessionAWS)
+	var arns []*string
+	if err := elbv2Client.DescribeLoadBalancersPages(&elbv2.DescribeLoadBalancersInput{}, func(out *elbv2.DescribeLoadBalancersOutput, _ bool) bool {
+		for _, lb := range out.LoadBalancers {
+			arns = append(arns, lb.LoadBalancerArn)
+		}
+		return true
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing load balancers")
+	}
+	for len(arns) > 0 {
+		n := len(arns)
+		if n > maxTagsRequest {
+			n = maxTagsRequest
+		}
+		out, err := elbv2Client.DescribeTags(&elbv2.DescribeTagsInput{ResourceArns: arns[:n]})
+		if err != nil {
+			return nil, errors.Wrap(err, "listing the tags of load balancers")
+		}
+		for _, d := range out.TagDescriptions {
+			for _, t := range d.Tags {
+				if aws.StringValue(t.Key) == key {
+					add("load balancer", aws.StringValue(d.ResourceArn))
+				}
+			}
+		}
+		arns = arns[n:]
+	}
+
+	return leftovers, nil
+}
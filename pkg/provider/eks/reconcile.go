@@ -0,0 +1,176 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	eks "github.com/aws/aws-sdk-go/service/eks"
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+// existingNodeGroup returns the nodegroup when it already exists, nil otherwise.
+func (c *EKS) existingNodeGroup(nodegroupName, clusterName string) (*eks.Nodegroup, error) {
+	res, err := c.clientEKS.DescribeNodegroup(&eks.DescribeNodegroupInput{
+		ClusterName:   aws.String(clusterName),
+		NodegroupName: aws.String(nodegroupName),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeResourceNotFoundException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "describing nodegroup '%v'", nodegroupName)
+	}
+	return res.Nodegroup, nil
+}
+
+// nodeGroupDivergence returns how an existing nodegroup differs from the nodegroup of the deployment file.
+// Only the settings of the deployment file are compared, the desired size can be changed by the autoscaler.
+func nodeGroupDivergence(existing *eks.Nodegroup, desired *eks.CreateNodegroupInput) []string {
+	var reasons []string
+	switch status := aws.StringValue(existing.Status); status {
+	case eks.NodegroupStatusCreateFailed, eks.NodegroupStatusDeleteFailed, eks.NodegroupStatusDegraded, eks.NodegroupStatusDeleting:
+		reasons = append(reasons, "status "+status)
+	}
+
+	if want, got := sortedValues(desired.InstanceTypes), sortedValues(existing.InstanceTypes); len(want) > 0 && want != got {
+		reasons = append(reasons, fmt.Sprintf("instance types %v instead of %v", got, want))
+	}
+	if want, got := aws.Int64Value(desired.DiskSize), aws.Int64Value(existing.DiskSize); want != 0 && want != got {
+		reasons = append(reasons, fmt.Sprintf("disk size %vGB instead of %vGB", got, want))
+	}
+	if want, got := aws.StringValue(desired.AmiType), aws.StringValue(existing.AmiType); want != "" && want != got {
+		reasons = append(reasons, fmt.Sprintf("AMI type %v instead of %v", got, want))
+	}
+	var labels []string
+	for k, v := range desired.Labels {
+		if aws.StringValue(existing.Labels[k]) != aws.StringValue(v) {
+			labels = append(labels, fmt.Sprintf("label %v=%v missing", k, aws.StringValue(v)))
+		}
+	}
+	sort.Strings(labels)
+	reasons = append(reasons, labels...)
+	if want, got := desired.ScalingConfig, existing.ScalingConfig; want != nil && got != nil &&
+		(aws.Int64Value(want.MinSize) != aws.Int64Value(got.MinSize) || aws.Int64Value(want.MaxSize) != aws.Int64Value(got.MaxSize)) {
+		reasons = append(reasons, fmt.Sprintf("scaling %v-%v nodes instead of %v-%v", aws.Int64Value(got.MinSize), aws.Int64Value(got.MaxSize), aws.Int64Value(want.MinSize), aws.Int64Value(want.MaxSize)))
+	}
+	return reasons
+}
+
+func sortedValues(values []*string) string {
+	s := aws.StringValueSlice(values)
+	sort.Strings(s)
+	return strings.Join(s, ",")
+}
+
+// reconcileNodeGroup creates a nodegroup of the deployment files and waits until it is active.
+// An existing nodegroup is adopted when it matches the deployment file, otherwise it is deleted and created again.
+func (c *EKS) reconcileNodeGroup(nodegroupReq *eks.CreateNodegroupInput, rec *provider.Reconciliation) error {
+	name, clusterName := *nodegroupReq.NodegroupName, *nodegroupReq.ClusterName
+	active := func() error {
+		if provider.DryRun {
+			return nil
+		}
+		return provider.RetryUntilTrue(
+			fmt.Sprintf("creating nodegroup:%s for cluster:%s", name, clusterName),
+			provider.EKSRetryCount,
+			func() (bool, error) { return c.nodeGroupCreated(name, clusterName) },
+		)
+	}
+
+	existing, err := c.existingNodeGroup(name, clusterName)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		rec.Created(name)
+	} else if reasons := nodeGroupDivergence(existing, nodegroupReq); len(reasons) == 0 {
+		rec.Adopted(name)
+		return active()
+	} else {
+		rec.Replaced(name, reasons)
+		if aws.StringValue(existing.Status) != eks.NodegroupStatusDeleting {
+			err = c.deleteNodeGroup(name, clusterName)
+		} else if !provider.DryRun {
+			err = provider.RetryUntilTrue(
+				fmt.Sprintf("deleting nodegroup:%v for cluster:%v", name, clusterName),
+				provider.GlobalRetryCount,
+				func() (bool, error) { return c.nodeGroupDeleted(name, clusterName) },
+			)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "replacing nodegroup '%v'", name)
+		}
+	}
+
+	log.Printf("Nodegroup create request: NodeGroupName: '%s', ClusterName: '%s'", name, clusterName)
+	if provider.DryRun {
+		return provider.DryRunRequest("CreateNodegroup", nodegroupReq.String())
+	}
+	err = provider.Chaos("CreateNodegroup")
+	if err == nil {
+		_, err = c.clientEKS.CreateNodegroupWithContext(c.ctx, nodegroupReq)
+	}
+	if err != nil {
+		return fmt.Errorf("Couldn't create nodegroup '%s' for cluster '%s', err: %v", name, clusterName, err)
+	}
+	// A nodegroup still being created when the command is interrupted is deleted.
+	created := provider.OnInterrupt(fmt.Sprintf("deleting the nodegroup:%v being created", name), func(ctx context.Context) error {
+		c.ctx = ctx
+		return c.deleteNodeGroup(name, clusterName)
+	})
+	if err := active(); err != nil {
+		return fmt.Errorf("creating nodegroup err:%v", err)
+	}
+	created()
+	return nil
+}
+
+// existingCluster returns the cluster when it already exists, nil otherwise.
+func (c *EKS) existingCluster(name string) (*eks.Cluster, error) {
+	res, err := c.clientEKS.DescribeCluster(&eks.DescribeClusterInput{
+		Name: aws.String(name),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == eks.ErrCodeResourceNotFoundException {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "describing cluster '%v'", name)
+	}
+	return res.Cluster, nil
+}
+
+// replaceCluster deletes a failed cluster, or waits until a cluster being deleted is removed, and creates it again.
+func (c *EKS) replaceCluster(req *eks.CreateClusterInput, status string) error {
+	var err error
+	if status != eks.ClusterStatusDeleting {
+		err = c.deleteCluster(*req.Name)
+	} else if !provider.DryRun {
+		err = provider.RetryUntilTrue(
+			fmt.Sprintf("deleting cluster:%v", *req.Name),
+			provider.EKSRetryCount,
+			func() (bool, error) { return c.clusterDeleted(*req.Name) })
+	}
+	if err != nil {
+		return errors.Wrapf(err, "replacing cluster '%v'", *req.Name)
+	}
+	return c.createCluster(req)
+}
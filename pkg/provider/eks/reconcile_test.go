@@ -0,0 +1,80 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eks
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	eks "github.com/aws/aws-sdk-go/service/eks"
+)
+
+func TestNodeGroupDivergence(t *testing.T) {
+	desired := &eks.CreateNodegroupInput{
+		NodegroupName: aws.String("prometheus-123"),
+		DiskSize:      aws.Int64(100),
+		InstanceTypes: aws.StringSlice([]string{"r5d.2xlarge"}),
+		Labels:        aws.StringMap(map[string]string{"isolation": "prometheus", "node-name": "prometheus-123"}),
+		ScalingConfig: &eks.NodegroupScalingConfig{DesiredSize: aws.Int64(2), MinSize: aws.Int64(2), MaxSize: aws.Int64(2)},
+	}
+	// The nodegroup created by a previous run, with the AMI type chosen by EKS.
+	existing := func() *eks.Nodegroup {
+		return &eks.Nodegroup{
+			NodegroupName: aws.String("prometheus-123"),
+			Status:        aws.String(eks.NodegroupStatusActive),
+			AmiType:       aws.String(eks.AMITypesAl2X8664),
+			DiskSize:      aws.Int64(100),
+			InstanceTypes: aws.StringSlice([]string{"r5d.2xlarge"}),
+			Labels:        aws.StringMap(map[string]string{"isolation": "prometheus", "node-name": "prometheus-123"}),
+			ScalingConfig: &eks.NodegroupScalingConfig{DesiredSize: aws.Int64(2), MinSize: aws.Int64(2), MaxSize: aws.Int64(2)},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		modify  func(*eks.Nodegroup)
+		reasons []string
+	}{
+		{
+			name:   "matching",
+			modify: func(*eks.Nodegroup) {},
+		},
+		{
+			name:    "failed",
+			modify:  func(n *eks.Nodegroup) { n.Status = aws.String(eks.NodegroupStatusCreateFailed) },
+			reasons: []string{"status CREATE_FAILED"},
+		},
+		{
+			name: "instances",
+			modify: func(n *eks.Nodegroup) {
+				n.InstanceTypes = aws.StringSlice([]string{"c5.4xlarge"})
+				n.Labels = nil
+			},
+			reasons: []string{
+				"instance types c5.4xlarge instead of r5d.2xlarge",
+				"label isolation=prometheus missing",
+				"label node-name=prometheus-123 missing",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			node := existing()
+			tc.modify(node)
+			if reasons := nodeGroupDivergence(node, desired); !reflect.DeepEqual(reasons, tc.reasons) {
+				t.Errorf("expected %v, got %v", tc.reasons, reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// ClusterInfo is a cluster in the inventory of a provider.
+type ClusterInfo struct {
+	Name     string
+	Location string
+	// Owner is the value of the OwnerLabel, empty for clusters not created by infra.
+	Owner string
+	// Created is zero when the creation time is unknown.
+	Created time.Time
+	Nodes   int
+	// MachineTypes are the number of nodes of each machine type, used for the cost estimate.
+	MachineTypes map[string]int
+}
+
+// Inventory lists the clusters of a provider.
+type Inventory interface {
+	Inventory() ([]ClusterInfo, error)
+}
+
+// CreatedTime returns the creation time of a resource tagged with ResourceLabels,
+// or a zero time when it has no creation label.
+func CreatedTime(labels map[string]string) time.Time {
+	created, err := strconv.ParseInt(labels[CreatedLabel], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(created, 0)
+}
+
+var (
+	clusterLabels = []string{"provider", "cluster", "location", "owner"}
+
+	clustersDesc = prometheus.NewDesc(
+		"infra_clusters",
+		"Number of clusters of the provider.",
+		[]string{"provider"}, nil,
+	)
+	clusterCreatedDesc = prometheus.NewDesc(
+		"infra_cluster_created_timestamp_seconds",
+		"Creation time of the cluster in unix seconds.",
+		clusterLabels, nil,
+	)
+	clusterNodesDesc = prometheus.NewDesc(
+		"infra_cluster_nodes",
+		"Number of nodes of the cluster.",
+		clusterLabels, nil,
+	)
+	clusterCostDesc = prometheus.NewDesc(
+		"infra_cluster_estimated_cost_dollars_per_hour",
+		"Estimated hourly cost of the nodes of the cluster, set when all its machine types have a price.",
+		clusterLabels, nil,
+	)
+	inventorySuccessDesc = prometheus.NewDesc(
+		"infra_inventory_last_success_timestamp_seconds",
+		"Time of the last successful inventory of the provider in unix seconds.",
+		[]string{"provider"}, nil,
+	)
+)
+
+// inventorySource is an inventory with the action that connects it to its provider.
+type inventorySource struct {
+	connect   kingpin.Action
+	inventory Inventory
+}
+
+// providerInventory is the result of the last successful inventory of a provider.
+type providerInventory struct {
+	clusters []ClusterInfo
+	time     time.Time
+}
+
+// Exporter periodically inventories the clusters of the providers
+// and exposes them as metrics for Prometheus to scrape.
+type Exporter struct {
+	// Providers are the names of the inventoried providers.
+	Providers []string
+	// ListenAddress is the address serving the metrics.
+	ListenAddress string
+	// Interval is the time between the inventories.
+	Interval time.Duration
+	// Prices are the hourly prices of the machine types in dollars, overriding the DefaultPrices.
+	Prices map[string]string
+
+	sources map[string]inventorySource
+	prices  map[string]float64
+
+	mtx         sync.Mutex
+	inventories map[string]providerInventory
+
+	inventoryErrors *prometheus.CounterVec
+}
+
+// NewExporter is the Exporter constructor.
+func NewExporter() *Exporter {
+	return &Exporter{
+		Prices:      map[string]string{},
+		sources:     map[string]inventorySource{},
+		inventories: map[string]providerInventory{},
+		inventoryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "infra_inventory_errors_total",
+			Help: "Number of failed inventories of the provider.",
+		}, []string{"provider"}),
+	}
+}
+
+// AddInventory makes a provider available to the exporter.
+// The connect action creates the clients of the provider when it is selected.
+func (e *Exporter) AddInventory(name string, connect kingpin.Action, inventory Inventory) {
+	e.sources[name] = inventorySource{connect: connect, inventory: inventory}
+}
+
+// Run connects the selected providers and serves their inventory until it fails.
+func (e *Exporter) Run(pc *kingpin.ParseContext) error {
+	prices, err := ParsePrices(e.Prices)
+	if err != nil {
+		return err
+	}
+	e.prices = prices
+
+	for _, name := range e.Providers {
+		source, ok := e.sources[name]
+		if !ok {
+			return fmt.Errorf("provider %v has no inventory", name)
+		}
+		if err := source.connect(pc); err != nil {
+			return errors.Wrapf(err, "connecting to provider %v", name)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e, e.inventoryErrors, prometheus.NewGoCollector())
+	for _, name := range e.Providers {
+		e.inventoryErrors.WithLabelValues(name)
+		go e.refresh(name)
+	}
+
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Printf("Serving the inventory of %v on %v/metrics", strings.Join(e.Providers, ", "), e.ListenAddress)
+	return http.ListenAndServe(e.ListenAddress, nil)
+}
+
+// refresh inventories a provider every Interval.
+// A failed inventory keeps the clusters of the last successful one.
+func (e *Exporter) refresh(name string) {
+	for {
+		start := time.Now()
+		clusters, err := e.sources[name].inventory.Inventory()
+		if err != nil {
+			log.Printf("Inventory of %v failed: %v", name, err)
+			e.inventoryErrors.WithLabelValues(name).Inc()
+		} else {
+			log.Printf("Inventory of %v found %d clusters in %v", name, len(clusters), time.Since(start).Round(time.Millisecond))
+			e.mtx.Lock()
+			e.inventories[name] = providerInventory{clusters: clusters, time: time.Now()}
+			e.mtx.Unlock()
+		}
+		time.Sleep(e.Interval)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clustersDesc
+	ch <- clusterCreatedDesc
+	ch <- clusterNodesDesc
+	ch <- clusterCostDesc
+	ch <- inventorySuccessDesc
+}
+
+// Collect implements prometheus.Collector.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	names := make([]string, 0, len(e.inventories))
+	for name := range e.inventories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		inv := e.inventories[name]
+		ch <- prometheus.MustNewConstMetric(inventorySuccessDesc, prometheus.GaugeValue, float64(inv.time.Unix()), name)
+		ch <- prometheus.MustNewConstMetric(clustersDesc, prometheus.GaugeValue, float64(len(inv.clusters)), name)
+		for _, c := range inv.clusters {
+			labels := []string{name, c.Name, c.Location, c.Owner}
+			ch <- prometheus.MustNewConstMetric(clusterNodesDesc, prometheus.GaugeValue, float64(c.Nodes), labels...)
+			if !c.Created.IsZero() {
+				ch <- prometheus.MustNewConstMetric(clusterCreatedDesc, prometheus.GaugeValue, float64(c.Created.Unix()), labels...)
+			}
+			if cost, ok := e.hourlyCost(c); ok {
+				ch <- prometheus.MustNewConstMetric(clusterCostDesc, prometheus.GaugeValue, cost, labels...)
+			}
+		}
+	}
+}
+
+// hourlyCost returns the estimated hourly cost of the nodes of a cluster,
+// false when a machine type has no price.
+func (e *Exporter) hourlyCost(c ClusterInfo) (float64, bool) {
+	if len(c.MachineTypes) == 0 {
+		return 0, false
+	}
+	var cost float64
+	for machineType, count := range c.MachineTypes {
+		price, ok := e.prices[machineType]
+		if !ok {
+			return 0, false
+		}
+		cost += price * float64(count)
+	}
+	return cost, true
+}
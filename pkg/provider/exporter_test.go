@@ -0,0 +1,69 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestExporterCollect(t *testing.T) {
+	e := NewExporter()
+	e.prices = map[string]float64{"n1-standard-8": 0.38, "n1-standard-2": 0.1}
+	e.inventories["gke"] = providerInventory{
+		time: time.Unix(2000, 0),
+		clusters: []ClusterInfo{
+			{
+				Name:         "prombench",
+				Location:     "europe-west3-a",
+				Owner:        "ci",
+				Created:      time.Unix(1000, 0),
+				Nodes:        3,
+				MachineTypes: map[string]int{"n1-standard-8": 2, "n1-standard-2": 1},
+			},
+			{
+				// The machine type has no price so there is no cost estimate.
+				Name:         "test",
+				Location:     "europe-west3",
+				Nodes:        1,
+				MachineTypes: map[string]int{"e2-small": 1},
+			},
+		},
+	}
+
+	expected := `
+# HELP infra_cluster_created_timestamp_seconds Creation time of the cluster in unix seconds.
+# TYPE infra_cluster_created_timestamp_seconds gauge
+infra_cluster_created_timestamp_seconds{cluster="prombench",location="europe-west3-a",owner="ci",provider="gke"} 1000
+# HELP infra_cluster_estimated_cost_dollars_per_hour Estimated hourly cost of the nodes of the cluster, set when all its machine types have a price.
+# TYPE infra_cluster_estimated_cost_dollars_per_hour gauge
+infra_cluster_estimated_cost_dollars_per_hour{cluster="prombench",location="europe-west3-a",owner="ci",provider="gke"} 0.86
+# HELP infra_cluster_nodes Number of nodes of the cluster.
+# TYPE infra_cluster_nodes gauge
+infra_cluster_nodes{cluster="prombench",location="europe-west3-a",owner="ci",provider="gke"} 3
+infra_cluster_nodes{cluster="test",location="europe-west3",owner="",provider="gke"} 1
+# HELP infra_clusters Number of clusters of the provider.
+# TYPE infra_clusters gauge
+infra_clusters{provider="gke"} 2
+# HELP infra_inventory_last_success_timestamp_seconds Time of the last successful inventory of the provider in unix seconds.
+# TYPE infra_inventory_last_success_timestamp_seconds gauge
+infra_inventory_last_success_timestamp_seconds{provider="gke"} 2000
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
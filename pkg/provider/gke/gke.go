@@ -20,27 +20,40 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"regexp"
 	"strings"
+	"time"
 
+	"cloud.google.com/go/compute/metadata"
 	gke "cloud.google.com/go/container/apiv1"
 	"github.com/pkg/errors"
 	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
 
 	"github.com/prometheus/test-infra/pkg/provider"
+	"golang.org/x/oauth2/google"
 	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"gopkg.in/alecthomas/kingpin.v2"
 	yamlGo "gopkg.in/yaml.v2"
 
+	containerBeta "google.golang.org/api/container/v1beta1"
 	"google.golang.org/api/option"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
+// retryOption retries the calls of the GKE API which fail with a transient error.
+var retryOption = option.WithGRPCDialOption(grpc.WithUnaryInterceptor(
+	func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return provider.Retry(ctx, path.Base(method), func() error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	},
+))
+
 // New is the GKE constructor.
 func New(dr *provider.DeploymentResource) *GKE {
 	return &GKE{
@@ -54,11 +67,14 @@ type Resource = provider.Resource
 type GKE struct {
 	// The auth used to authenticate the cli.
 	// Can be a file path or an env variable that includes the json data.
+	// When empty the Application Default Credentials are used.
 	Auth string
 	// The project id for all requests.
 	ProjectID string
 	// The gke client used when performing GKE requests.
 	clientGKE *gke.ClusterManagerClient
+	// The credentials used by the GKE clients.
+	clientOption option.ClientOption
 	// The k8s provider used when we work with the manifest files.
 	k8sProvider *k8sProvider.K8s
 	// Final DeploymentFiles files.
@@ -71,6 +87,34 @@ type GKE struct {
 	gkeResources []Resource
 	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
 	k8sResources []k8sProvider.Resource
+	// Clusters and nodepools created by infra longer than this are deleted by the garbage collection.
+	MaxAge time.Duration
+	// Create the nodepools as a warm pool that can be claimed by a later PR_NUMBER.
+	WarmPool bool
+	// The release channel to enroll the created clusters in - rapid, regular or stable.
+	ReleaseChannel string
+	// The nodepool to resize, all nodepools in the deployment files when empty.
+	NodePoolName string
+	// The number of nodes to resize the nodepools to.
+	NodeCount int32
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
 
 	ctx context.Context
 }
@@ -80,7 +124,7 @@ func (c *GKE) NewGKEClient(*kingpin.ParseContext) error {
 	// Set the auth env variable needed to the gke client.
 	if c.Auth != "" {
 	} else if c.Auth = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); c.Auth == "" {
-		return errors.Errorf("no auth provided! Need to either set the auth flag or the GOOGLE_APPLICATION_CREDENTIALS env variable")
+		return c.newDefaultCredentialsClient()
 	}
 
 	// When the auth variable points to a file
@@ -117,15 +161,47 @@ func (c *GKE) NewGKEClient(*kingpin.ParseContext) error {
 	// https://github.com/kubernetes/kubernetes/pull/80303
 	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", saFile.Name())
 
-	opts := option.WithCredentialsJSON([]byte(c.Auth))
+	c.clientOption = option.WithCredentialsJSON([]byte(c.Auth))
 
-	cl, err := gke.NewClusterManagerClient(context.Background(), opts)
+	cl, err := gke.NewClusterManagerClient(provider.Context(), c.clientOption, retryOption)
 	if err != nil {
 		return errors.Wrap(err, "could not create the gke client")
 	}
 	c.clientGKE = cl
-	c.ctx = context.Background()
+	c.ctx = provider.Context()
+
+	return nil
+}
 
+// newDefaultCredentialsClient sets the GKE client using the Application Default Credentials.
+// These are the gcloud user credentials or, when running inside GCP,
+// the credentials of the metadata server which include the Workload Identity of a GKE pod.
+// The k8s client finds the same credentials so no service account file is needed.
+func (c *GKE) newDefaultCredentialsClient() error {
+	c.ctx = provider.Context()
+
+	creds, err := google.FindDefaultCredentials(c.ctx, gke.DefaultAuthScopes()...)
+	if err != nil {
+		return errors.Wrap(err, "no auth provided and no Application Default Credentials found! Need to either set the auth flag, the GOOGLE_APPLICATION_CREDENTIALS env variable or login with 'gcloud auth application-default login'")
+	}
+	if metadata.OnGCE() && len(creds.JSON) == 0 {
+		log.Printf("Using the credentials of the GCP metadata server")
+	} else {
+		log.Printf("Using the Application Default Credentials")
+	}
+
+	// The project of the credentials is used when not set explicitly.
+	if c.DeploymentVars["GKE_PROJECT_ID"] == "" && creds.ProjectID != "" {
+		log.Printf("Using the project '%v' of the credentials", creds.ProjectID)
+		c.DeploymentVars["GKE_PROJECT_ID"] = creds.ProjectID
+	}
+
+	c.clientOption = option.WithCredentials(creds)
+	cl, err := gke.NewClusterManagerClient(c.ctx, c.clientOption, retryOption)
+	if err != nil {
+		return errors.Wrap(err, "could not create the gke client")
+	}
+	c.clientGKE = cl
 	return nil
 }
 
@@ -148,7 +224,7 @@ func (c *GKE) GKEDeploymentsParse(*kingpin.ParseContext) error {
 
 	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
 	if err != nil {
-		log.Fatalf("Couldn't parse deployment files: %v", err)
+		return errors.Wrap(err, "couldn't parse deployment files")
 	}
 
 	c.gkeResources = deploymentResource
@@ -164,28 +240,13 @@ func (c *GKE) K8SDeploymentsParse(*kingpin.ParseContext) error {
 
 	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
 	if err != nil {
-		log.Fatalf("Couldn't parse deployment files: %v", err)
+		return errors.Wrap(err, "couldn't parse deployment files")
 	}
 
 	for _, deployment := range deploymentResource {
-
-		decode := scheme.Codecs.UniversalDeserializer().Decode
-		k8sObjects := make([]runtime.Object, 0)
-
-		for _, text := range strings.Split(string(deployment.Content), provider.Separator) {
-			text = strings.TrimSpace(text)
-			if len(text) == 0 {
-				continue
-			}
-
-			resource, _, err := decode([]byte(text), nil, nil)
-			if err != nil {
-				return errors.Wrapf(err, "decoding the resource file:%v, section:%v...", deployment.FileName, text[:100])
-			}
-			if resource == nil {
-				continue
-			}
-			k8sObjects = append(k8sObjects, resource)
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
 		}
 		if len(k8sObjects) > 0 {
 			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
@@ -208,20 +269,77 @@ func (c *GKE) checkDeploymentVarsAndFiles() error {
 	return nil
 }
 
-// ClusterCreate create a new cluster or applies changes to an existing cluster.
+// ClusterCreate creates the clusters of the deployment files.
+// A cluster which already exists, for example after a crashed run, is adopted and its nodepools are
+// reconciled with the deployment file like with NodePoolCreate, unless it failed or is being deleted,
+// then it is deleted and created again.
 func (c *GKE) ClusterCreate(*kingpin.ParseContext) error {
 	req := &containerpb.CreateClusterRequest{}
+	rec := provider.NewReconciliation("cluster")
+	defer rec.Report()
 	for _, deployment := range c.gkeResources {
 
 		if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
-			log.Fatalf("Error parsing the cluster deployment file %s:%v", deployment.FileName, err)
+			return errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
+		}
+		labels := c.resourceLabels()
+		req.Cluster.ResourceLabels = provider.MergeDeploymentVars(req.Cluster.ResourceLabels, labels)
+		for _, node := range req.Cluster.NodePools {
+			labelNodePool(node, labels)
+			repairPreemptible(node)
+			if err := configureAutoscaling(node); err != nil {
+				return errors.Wrapf(err, "file:%v", deployment.FileName)
+			}
 		}
 
-		log.Printf("Cluster create request: name:'%v', project `%s`,zone `%s`", req.Cluster.Name, req.ProjectId, req.Zone)
-		_, err := c.clientGKE.CreateCluster(c.ctx, req)
+		existing, err := c.existingCluster(req.ProjectId, req.Zone, req.Cluster.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			reasons := clusterDivergence(existing)
+			if len(reasons) == 0 {
+				rec.Adopted(req.Cluster.Name)
+				if err := c.adoptCluster(req); err != nil {
+					return errors.Wrapf(err, "adopting cluster '%v', file:%v", req.Cluster.Name, deployment.FileName)
+				}
+				continue
+			}
+			rec.Replaced(req.Cluster.Name, reasons)
+			if err := c.deleteCluster(req.ProjectId, req.Zone, req.Cluster.Name); err != nil {
+				return errors.Wrapf(err, "replacing cluster '%v', file:%v", req.Cluster.Name, deployment.FileName)
+			}
+		} else {
+			rec.Created(req.Cluster.Name)
+		}
+
+		log.Printf("Cluster create request: name:'%v', project `%s`,location `%s`", req.Cluster.Name, req.ProjectId, req.Zone)
+		reqC := &containerpb.CreateClusterRequest{
+			Parent:  locationName(req.ProjectId, req.Zone),
+			Cluster: req.Cluster,
+		}
+		if provider.DryRun {
+			if err := provider.DryRunRequest("CreateCluster", reqC); err != nil {
+				return err
+			}
+			if c.ReleaseChannel != "" {
+				log.Printf("The release channel '%v' would be set after the cluster is running", c.ReleaseChannel)
+			}
+			continue
+		}
+		err = provider.Chaos("CreateCluster " + req.Cluster.Name)
+		if err == nil {
+			_, err = c.clientGKE.CreateCluster(c.ctx, reqC)
+		}
 		if err != nil {
-			log.Fatalf("Couldn't create cluster '%v', file:%v ,err: %v", req.Cluster.Name, deployment.FileName, err)
+			return errors.Wrapf(err, "couldn't create cluster '%v', file:%v", req.Cluster.Name, deployment.FileName)
 		}
+		// A cluster still being created when the command is interrupted is deleted.
+		projectID, zone, name := req.ProjectId, req.Zone, req.Cluster.Name
+		created := provider.OnInterrupt(fmt.Sprintf("deleting the cluster:%v being created", name), func(ctx context.Context) error {
+			c.ctx = ctx
+			return c.deleteCluster(projectID, zone, name)
+		})
 
 		err = provider.RetryUntilTrue(
 			fmt.Sprintf("creating cluster:%v", req.Cluster.Name),
@@ -229,8 +347,15 @@ func (c *GKE) ClusterCreate(*kingpin.ParseContext) error {
 			func() (bool, error) { return c.clusterRunning(req.Zone, req.ProjectId, req.Cluster.Name) })
 
 		if err != nil {
-			log.Fatalf("creating cluster err:%v", err)
+			return errors.Wrap(err, "creating cluster")
 		}
+
+		if c.ReleaseChannel != "" {
+			if err := c.setReleaseChannel(req.ProjectId, req.Zone, req.Cluster.Name); err != nil {
+				return err
+			}
+		}
+		created()
 	}
 	return nil
 }
@@ -240,27 +365,36 @@ func (c *GKE) ClusterDelete(*kingpin.ParseContext) error {
 	// Use CreateClusterRequest struct to pass the UnmarshalStrict validation and
 	// than use the result to create the DeleteClusterRequest
 	reqC := &containerpb.CreateClusterRequest{}
+	var leftoversErr error
 	for _, deployment := range c.gkeResources {
 		if err := yamlGo.UnmarshalStrict(deployment.Content, reqC); err != nil {
-			log.Fatalf("Error parsing the cluster deployment file %s:%v", deployment.FileName, err)
+			return errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
 		}
 		reqD := &containerpb.DeleteClusterRequest{
-			ProjectId: reqC.ProjectId,
-			Zone:      reqC.Zone,
-			ClusterId: reqC.Cluster.Name,
+			Name: clusterName(reqC.ProjectId, reqC.Zone, reqC.Cluster.Name),
+		}
+		log.Printf("Removing cluster '%v', project '%v', location '%v'", reqC.Cluster.Name, reqC.ProjectId, reqC.Zone)
+		if provider.DryRun {
+			if err := provider.DryRunRequest("DeleteCluster", reqD); err != nil {
+				return err
+			}
+			continue
 		}
-		log.Printf("Removing cluster '%v', project '%v', zone '%v'", reqD.ClusterId, reqD.ProjectId, reqD.Zone)
 
 		err := provider.RetryUntilTrue(
-			fmt.Sprintf("deleting cluster:%v", reqD.ClusterId),
+			fmt.Sprintf("deleting cluster:%v", reqC.Cluster.Name),
 			provider.GlobalRetryCount,
 			func() (bool, error) { return c.clusterDeleted(reqD) })
 
 		if err != nil {
-			log.Fatalf("removing cluster err:%v", err)
+			return errors.Wrap(err, "removing cluster")
+		}
+		// The remaining clusters are still deleted when resources of this one were left behind.
+		if err := c.verifyClusterDeleted(reqC.ProjectId, reqC.Cluster.Name); err != nil && leftoversErr == nil {
+			leftoversErr = err
 		}
 	}
-	return nil
+	return leftoversErr
 }
 
 // clusterDeleted checks whether a cluster has been deleted.
@@ -278,18 +412,17 @@ func (c *GKE) clusterDeleted(req *containerpb.DeleteClusterRequest) (bool, error
 			log.Printf("Cluster in 'FailedPrecondition' state '%s'", err)
 			return false, nil
 		}
-		return false, errors.Wrapf(err, "deleting cluster:%v", req.ClusterId)
+		return false, errors.Wrapf(err, "deleting cluster:%v", req.Name)
 	}
 	log.Printf("cluster status: `%v`", rep.Status)
 	return false, nil
 }
 
 // clusterRunning checks whether a cluster is in a running state.
+// The zone is a region for regional clusters.
 func (c *GKE) clusterRunning(zone, projectID, clusterID string) (bool, error) {
 	req := &containerpb.GetClusterRequest{
-		ProjectId: projectID,
-		Zone:      zone,
-		ClusterId: clusterID,
+		Name: clusterName(projectID, zone, clusterID),
 	}
 	cluster, err := c.clientGKE.GetCluster(c.ctx, req)
 	if err != nil {
@@ -311,47 +444,92 @@ func (c *GKE) clusterRunning(zone, projectID, clusterID string) (bool, error) {
 	return false, nil
 }
 
-// NodePoolCreate creates a new k8s node-pool in an existing cluster.
+// ClusterStatus prints the state of the cluster and, when it is running,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *GKE) ClusterStatus(*kingpin.ParseContext) error {
+	s := &k8sProvider.ClusterStatus{Name: c.DeploymentVars["CLUSTER_NAME"]}
+	req := &containerpb.GetClusterRequest{
+		Name: clusterName(c.DeploymentVars["GKE_PROJECT_ID"], c.DeploymentVars["ZONE"], c.DeploymentVars["CLUSTER_NAME"]),
+	}
+	cluster, err := c.clientGKE.GetCluster(c.ctx, req)
+	if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+		s.State = "NOT_FOUND"
+	} else if err != nil {
+		return errors.Wrap(err, "failed to get cluster details")
+	} else {
+		s.State = cluster.Status.String()
+	}
+
+	if s.State == containerpb.Cluster_RUNNING.String() {
+		if err := c.NewK8sProvider(nil); err != nil {
+			return err
+		}
+		if err := c.k8sProvider.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
+// setReleaseChannel enrolls the cluster in the ReleaseChannel.
+// Release channels are not part of the v1 API so this uses the v1beta1 API.
+func (c *GKE) setReleaseChannel(projectID, location, cluster string) error {
+	svc, err := containerBeta.NewService(c.ctx, c.clientOption)
+	if err != nil {
+		return errors.Wrap(err, "could not create the gke v1beta1 client")
+	}
+
+	log.Printf("Setting the release channel of cluster '%v' to '%v'", cluster, c.ReleaseChannel)
+	req := &containerBeta.UpdateClusterRequest{
+		Update: &containerBeta.ClusterUpdate{
+			DesiredReleaseChannel: &containerBeta.ReleaseChannel{Channel: strings.ToUpper(c.ReleaseChannel)},
+		},
+	}
+	err = provider.Retry(c.ctx, "UpdateCluster", func() error {
+		_, err := svc.Projects.Locations.Clusters.Update(clusterName(projectID, location, cluster), req).Context(c.ctx).Do()
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "setting the release channel of cluster:%v", cluster)
+	}
+
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("updating cluster:%v", cluster),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.clusterRunning(location, projectID, cluster) })
+}
+
+// NodePoolCreate creates the nodepools of the deployment files in an existing cluster.
+// The nodepools which already exist, for example after a crashed run, are adopted or replaced, see reconcileNodePool.
 func (c *GKE) NodePoolCreate(*kingpin.ParseContext) error {
 	reqC := &containerpb.CreateClusterRequest{}
+	rec := provider.NewReconciliation("nodepool")
+
+	labels := c.resourceLabels()
+	if c.WarmPool {
+		if c.DeploymentVars["PR_NUMBER"] == "" {
+			return fmt.Errorf("missing required PR_NUMBER variable for the warm pool")
+		}
+		labels[warmPoolLabel] = c.DeploymentVars["PR_NUMBER"]
+	}
 
 	for _, deployment := range c.gkeResources {
 		if err := yamlGo.UnmarshalStrict(deployment.Content, reqC); err != nil {
-			log.Fatalf("Error parsing the cluster deployment file %s:%v", deployment.FileName, err)
+			return errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
 		}
 
 		for _, node := range reqC.Cluster.NodePools {
-			reqN := &containerpb.CreateNodePoolRequest{
-				ProjectId: reqC.ProjectId,
-				Zone:      reqC.Zone,
-				ClusterId: reqC.Cluster.Name,
-				NodePool:  node,
-			}
-			log.Printf("Cluster nodepool create request: cluster '%v', nodepool '%v' , project `%s`,zone `%s`", reqN.ClusterId, reqN.NodePool.Name, reqN.ProjectId, reqN.Zone)
-
-			err := provider.RetryUntilTrue(
-				fmt.Sprintf("nodepool creation:%v", reqN.NodePool.Name),
-				provider.GlobalRetryCount,
-				func() (bool, error) {
-					return c.nodePoolCreated(reqN)
-				})
-
-			if err != nil {
-				log.Fatalf("Couldn't create cluster nodepool '%v', file:%v ,err: %v", node.Name, deployment.FileName, err)
+			labelNodePool(node, labels)
+			repairPreemptible(node)
+			if err := configureAutoscaling(node); err != nil {
+				return errors.Wrapf(err, "file:%v", deployment.FileName)
 			}
-
-			err = provider.RetryUntilTrue(
-				fmt.Sprintf("checking nodepool running status for:%v", reqN.NodePool.Name),
-				provider.GlobalRetryCount,
-				func() (bool, error) {
-					return c.nodePoolRunning(reqN.Zone, reqN.ProjectId, reqN.ClusterId, reqN.NodePool.Name)
-				})
-
-			if err != nil {
-				log.Fatalf("Couldn't create cluster nodepool '%v', file:%v ,err: %v", node.Name, deployment.FileName, err)
+			if err := c.reconcileNodePool(reqC.ProjectId, reqC.Zone, reqC.Cluster.Name, node, rec); err != nil {
+				return errors.Wrapf(err, "couldn't create cluster nodepool '%v', file:%v", node.Name, deployment.FileName)
 			}
 		}
 	}
+	rec.Report()
 	return nil
 }
 
@@ -379,38 +557,115 @@ func (c *GKE) nodePoolCreated(req *containerpb.CreateNodePoolRequest) (bool, err
 }
 
 // NodePoolDelete deletes a new k8s node-pool in an existing cluster.
+// The warm pools claimed by the PR_NUMBER are deleted as well and their claims are released.
 func (c *GKE) NodePoolDelete(*kingpin.ParseContext) error {
 	// Use CreateNodePoolRequest struct to pass the UnmarshalStrict validation and
 	// than use the result to create the DeleteNodePoolRequest
 	reqC := &containerpb.CreateClusterRequest{}
+	claims, claimedPools, err := c.claimedWarmPools(c.DeploymentVars["PR_NUMBER"])
+	if err != nil {
+		return err
+	}
 	for _, deployment := range c.gkeResources {
 
 		if err := yamlGo.UnmarshalStrict(deployment.Content, reqC); err != nil {
-			log.Fatalf("Error parsing the cluster deployment file %s:%v", deployment.FileName, err)
+			return errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
 		}
 
 		for _, node := range reqC.Cluster.NodePools {
-			reqD := &containerpb.DeleteNodePoolRequest{
-				ProjectId:  reqC.ProjectId,
-				Zone:       reqC.Zone,
-				ClusterId:  reqC.Cluster.Name,
-				NodePoolId: node.Name,
+			log.Printf("Removing cluster node pool: `%v`,  cluster '%v', project '%v', location '%v'", node.Name, reqC.Cluster.Name, reqC.ProjectId, reqC.Zone)
+			if err := c.deleteNodePool(reqC.ProjectId, reqC.Zone, reqC.Cluster.Name, node.Name); err != nil {
+				return errors.Wrapf(err, "couldn't delete cluster nodepool '%v', file:%v", node.Name, deployment.FileName)
+			}
+		}
+	}
+
+	for _, name := range claimedPools {
+		log.Printf("Removing claimed warm node pool: `%v`, cluster '%v'", name, c.DeploymentVars["CLUSTER_NAME"])
+		if err := c.deleteNodePool(c.DeploymentVars["GKE_PROJECT_ID"], c.DeploymentVars["ZONE"], c.DeploymentVars["CLUSTER_NAME"], name); err != nil {
+			return errors.Wrapf(err, "couldn't delete the claimed warm nodepool '%v'", name)
+		}
+	}
+	return c.releaseWarmPools(claims)
+}
+
+// NodePoolResize sets the number of nodes of the nodepools in the deployment files.
+// When NodePoolName is set only this nodepool is resized.
+func (c *GKE) NodePoolResize(*kingpin.ParseContext) error {
+	reqC := &containerpb.CreateClusterRequest{}
+	var found bool
+	for _, deployment := range c.gkeResources {
+		if err := yamlGo.UnmarshalStrict(deployment.Content, reqC); err != nil {
+			return errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
+		}
+
+		for _, node := range reqC.Cluster.NodePools {
+			if c.NodePoolName != "" && node.Name != c.NodePoolName {
+				continue
+			}
+			found = true
+			if node.GetAutoscaling().GetMaxNodeCount() > 0 {
+				log.Printf("Nodepool '%v' has autoscaling enabled so the autoscaler can change its size", node.Name)
+			}
+
+			reqS := &containerpb.SetNodePoolSizeRequest{
+				Name:      nodePoolName(reqC.ProjectId, reqC.Zone, reqC.Cluster.Name, node.Name),
+				NodeCount: c.NodeCount,
+			}
+			log.Printf("Resizing cluster node pool: `%v` to %v nodes, cluster '%v'", node.Name, c.NodeCount, reqC.Cluster.Name)
+			if provider.DryRun {
+				if err := provider.DryRunRequest("SetNodePoolSize", reqS); err != nil {
+					return err
+				}
+				continue
 			}
-			log.Printf("Removing cluster node pool: `%v`,  cluster '%v', project '%v', zone '%v'", reqD.NodePoolId, reqD.ClusterId, reqD.ProjectId, reqD.Zone)
 
 			err := provider.RetryUntilTrue(
-				fmt.Sprintf("deleting nodepool:%v", reqD.NodePoolId),
+				fmt.Sprintf("resizing nodepool:%v", node.Name),
 				provider.GlobalRetryCount,
-				func() (bool, error) { return c.nodePoolDeleted(reqD) })
+				func() (bool, error) { return c.nodePoolResized(reqS) })
+			if err != nil {
+				return errors.Wrapf(err, "couldn't resize cluster nodepool '%v', file:%v", node.Name, deployment.FileName)
+			}
 
+			err = provider.RetryUntilTrue(
+				fmt.Sprintf("checking nodepool running status for:%v", node.Name),
+				provider.GlobalRetryCount,
+				func() (bool, error) {
+					return c.nodePoolRunning(reqC.Zone, reqC.ProjectId, reqC.Cluster.Name, node.Name)
+				})
 			if err != nil {
-				log.Fatalf("Couldn't delete cluster nodepool '%v', file:%v ,err: %v", node.Name, deployment.FileName, err)
+				return errors.Wrapf(err, "couldn't resize cluster nodepool '%v', file:%v", node.Name, deployment.FileName)
 			}
 		}
 	}
+	if !found {
+		return fmt.Errorf("nodepool '%v' not found in the deployment files", c.NodePoolName)
+	}
 	return nil
 }
 
+// nodePoolResized checks if there is any ongoing NodePool operation on the cluster
+// when resizing a NodePool.
+func (c *GKE) nodePoolResized(req *containerpb.SetNodePoolSizeRequest) (bool, error) {
+	rep, err := c.clientGKE.SetNodePoolSize(c.ctx, req)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			return false, fmt.Errorf("unknown reply status error %v", err)
+		}
+		if st.Code() == codes.FailedPrecondition {
+			// GKE cannot have two simultaneous nodepool operations running on it
+			// Waiting for any ongoing operation to complete before starting new one
+			log.Printf("Cluster in 'FailedPrecondition' state '%s'", err)
+			return false, nil
+		}
+		return false, err
+	}
+	log.Printf("cluster node pool status: `%v`", rep.Status)
+	return true, nil
+}
+
 // nodePoolDeleted checks whether a nodepool has been deleted.
 func (c *GKE) nodePoolDeleted(req *containerpb.DeleteNodePoolRequest) (bool, error) {
 
@@ -439,10 +694,7 @@ func (c *GKE) nodePoolDeleted(req *containerpb.DeleteNodePoolRequest) (bool, err
 // nodePoolRunning checks whether a nodepool has been created and is running.
 func (c *GKE) nodePoolRunning(zone, projectID, clusterID, poolName string) (bool, error) {
 	req := &containerpb.GetNodePoolRequest{
-		ProjectId:  projectID,
-		Zone:       zone,
-		ClusterId:  clusterID,
-		NodePoolId: poolName,
+		Name: nodePoolName(projectID, zone, clusterID, poolName),
 	}
 	rep, err := c.clientGKE.GetNodePool(c.ctx, req)
 
@@ -461,7 +713,7 @@ func (c *GKE) nodePoolRunning(zone, projectID, clusterID, poolName string) (bool
 		rep.Status == containerpb.NodePool_RUNNING_WITH_ERROR ||
 		rep.Status == containerpb.NodePool_STOPPING ||
 		rep.Status == containerpb.NodePool_STATUS_UNSPECIFIED {
-		log.Fatalf("NodePool %s not in a status to become ready: %v", rep.Name, rep.StatusMessage)
+		return false, fmt.Errorf("NodePool %s not in a status to become ready: %v", rep.Name, rep.StatusMessage)
 	}
 
 	log.Printf("Current cluster node pool '%v' status:%v , %v", rep.Name, rep.Status, rep.StatusMessage)
@@ -480,10 +732,10 @@ func (c *GKE) AllNodepoolsRunning(*kingpin.ParseContext) error {
 		for _, node := range reqC.Cluster.NodePools {
 			isRunning, err := c.nodePoolRunning(reqC.Zone, reqC.ProjectId, reqC.Cluster.Name, node.Name)
 			if err != nil {
-				log.Fatalf("error fetching nodePool info")
+				return errors.Wrapf(err, "fetching nodepool info for:%v", node.Name)
 			}
 			if !isRunning {
-				log.Fatalf("nodepool not running name: %v", node.Name)
+				return fmt.Errorf("nodepool not running name: %v", node.Name)
 			}
 		}
 	}
@@ -503,10 +755,10 @@ func (c *GKE) AllNodepoolsDeleted(*kingpin.ParseContext) error {
 		for _, node := range reqC.Cluster.NodePools {
 			isRunning, err := c.nodePoolRunning(reqC.Zone, reqC.ProjectId, reqC.Cluster.Name, node.Name)
 			if err != nil {
-				log.Fatalf("error fetching nodePool info")
+				return errors.Wrapf(err, "fetching nodepool info for:%v", node.Name)
 			}
 			if isRunning {
-				log.Fatalf("nodepool running name: %v", node.Name)
+				return fmt.Errorf("nodepool running name: %v", node.Name)
 			}
 		}
 	}
@@ -514,23 +766,145 @@ func (c *GKE) AllNodepoolsDeleted(*kingpin.ParseContext) error {
 	return nil
 }
 
+// resourceLabels returns the labels for the clusters and nodepools created by infra.
+// The owner is set with the OWNER deployment variable.
+func (c *GKE) resourceLabels() map[string]string {
+	return provider.ResourceLabels(c.DeploymentVars["OWNER"], time.Now())
+}
+
+// labelNodePool adds the labels to the nodes of the nodepool.
+func labelNodePool(node *containerpb.NodePool, labels map[string]string) {
+	if node.Config == nil {
+		node.Config = &containerpb.NodeConfig{}
+	}
+	node.Config.Labels = provider.MergeDeploymentVars(node.Config.Labels, labels)
+}
+
+// repairPreemptible enables the auto-repair of preemptible nodepools
+// so that the nodes which don't come back after a preemption are recreated.
+func repairPreemptible(node *containerpb.NodePool) {
+	if !node.GetConfig().GetPreemptible() {
+		return
+	}
+	if node.Management == nil {
+		node.Management = &containerpb.NodeManagement{}
+	}
+	node.Management.AutoRepair = true
+}
+
+// configureAutoscaling enables the autoscaling of a nodepool that declares its maximum number of nodes.
+func configureAutoscaling(node *containerpb.NodePool) error {
+	a := node.GetAutoscaling()
+	if a.GetMaxNodeCount() == 0 {
+		return nil
+	}
+	if a.MinNodeCount > a.MaxNodeCount {
+		return fmt.Errorf("nodepool '%v' minimum nodes %v are more than the maximum nodes %v", node.Name, a.MinNodeCount, a.MaxNodeCount)
+	}
+	a.Enabled = true
+	return nil
+}
+
+// GC deletes the clusters and nodepools created by infra that are older than MaxAge.
+// Clusters not created by infra are kept, but their expired nodepools are deleted.
+func (c *GKE) GC(*kingpin.ParseContext) error {
+	projectID := c.DeploymentVars["GKE_PROJECT_ID"]
+	if projectID == "" {
+		return fmt.Errorf("missing required GKE_PROJECT_ID variable")
+	}
+
+	// The "-" location matches all zones and regions.
+	rep, err := c.clientGKE.ListClusters(c.ctx, &containerpb.ListClustersRequest{Parent: locationName(projectID, "-")})
+	if err != nil {
+		return errors.Wrapf(err, "listing clusters for project:%v", projectID)
+	}
+
+	now := time.Now()
+	// Continue with the other resources so that a single failure doesn't block the garbage collection.
+	var failed []string
+	for _, cluster := range rep.Clusters {
+		if provider.Expired(cluster.ResourceLabels, c.MaxAge, now) {
+			reqD := &containerpb.DeleteClusterRequest{
+				Name: clusterName(projectID, cluster.Location, cluster.Name),
+			}
+			log.Printf("Removing expired cluster '%v', owner '%v', location '%v'", cluster.Name, cluster.ResourceLabels[provider.OwnerLabel], cluster.Location)
+			if provider.DryRun {
+				if err := provider.DryRunRequest("DeleteCluster", reqD); err != nil {
+					return err
+				}
+				continue
+			}
+			err := provider.RetryUntilTrue(
+				fmt.Sprintf("deleting cluster:%v", cluster.Name),
+				provider.GlobalRetryCount,
+				func() (bool, error) { return c.clusterDeleted(reqD) })
+			if err != nil {
+				log.Printf("Removing cluster '%v' err: %v", cluster.Name, err)
+				failed = append(failed, "cluster:"+cluster.Name)
+			}
+			continue
+		}
+
+		for _, node := range cluster.NodePools {
+			if node.Config == nil || !provider.Expired(node.Config.Labels, c.MaxAge, now) {
+				continue
+			}
+			reqD := &containerpb.DeleteNodePoolRequest{
+				Name: nodePoolName(projectID, cluster.Location, cluster.Name, node.Name),
+			}
+			log.Printf("Removing expired nodepool '%v', owner '%v', cluster '%v'", node.Name, node.Config.Labels[provider.OwnerLabel], cluster.Name)
+			if provider.DryRun {
+				if err := provider.DryRunRequest("DeleteNodePool", reqD); err != nil {
+					return err
+				}
+				continue
+			}
+			err := provider.RetryUntilTrue(
+				fmt.Sprintf("deleting nodepool:%v", node.Name),
+				provider.GlobalRetryCount,
+				func() (bool, error) { return c.nodePoolDeleted(reqD) })
+			if err != nil {
+				log.Printf("Removing nodepool '%v' of cluster '%v' err: %v", node.Name, cluster.Name, err)
+				failed = append(failed, "nodepool:"+cluster.Name+"/"+node.Name)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("garbage collection failed for %v", failed)
+	}
+	return nil
+}
+
+// locationName returns the resource name of a zone or a region.
+func locationName(projectID, location string) string {
+	return fmt.Sprintf("projects/%s/locations/%s", projectID, location)
+}
+
+// clusterName returns the resource name of a zonal or a regional cluster.
+func clusterName(projectID, location, cluster string) string {
+	return fmt.Sprintf("%s/clusters/%s", locationName(projectID, location), cluster)
+}
+
+// nodePoolName returns the resource name of a nodepool.
+func nodePoolName(projectID, location, cluster, nodePool string) string {
+	return fmt.Sprintf("%s/nodePools/%s", clusterName(projectID, location, cluster), nodePool)
+}
+
 // NewK8sProvider sets the k8s provider used for deploying k8s manifests.
 func (c *GKE) NewK8sProvider(*kingpin.ParseContext) error {
 	// Get the authentication certificate for the cluster using the GKE client.
 	req := &containerpb.GetClusterRequest{
-		ProjectId: c.DeploymentVars["GKE_PROJECT_ID"],
-		Zone:      c.DeploymentVars["ZONE"],
-		ClusterId: c.DeploymentVars["CLUSTER_NAME"],
+		Name: clusterName(c.DeploymentVars["GKE_PROJECT_ID"], c.DeploymentVars["ZONE"], c.DeploymentVars["CLUSTER_NAME"]),
 	}
 	rep, err := c.clientGKE.GetCluster(c.ctx, req)
 	if err != nil {
-		log.Fatalf("failed to get cluster details: %v", err)
+		return errors.Wrap(err, "failed to get cluster details")
 	}
 
 	// The master auth retrieved from GCP it is base64 encoded so it must be decoded first.
 	caCert, err := base64.StdEncoding.DecodeString(rep.MasterAuth.GetClusterCaCertificate())
 	if err != nil {
-		log.Fatalf("failed to decode certificate: %v", err.Error())
+		return errors.Wrap(err, "failed to decode certificate")
 	}
 
 	cluster := clientcmdapi.NewCluster()
@@ -539,7 +913,7 @@ func (c *GKE) NewK8sProvider(*kingpin.ParseContext) error {
 
 	context := clientcmdapi.NewContext()
 	context.Cluster = rep.Name
-	context.AuthInfo = rep.Zone
+	context.AuthInfo = rep.Location
 
 	authInfo := clientcmdapi.NewAuthInfo()
 	authInfo.AuthProvider = &clientcmdapi.AuthProviderConfig{
@@ -553,29 +927,88 @@ func (c *GKE) NewK8sProvider(*kingpin.ParseContext) error {
 
 	config := clientcmdapi.NewConfig()
 	config.Clusters[rep.Name] = cluster
-	config.Contexts[rep.Zone] = context
-	config.AuthInfos[rep.Zone] = authInfo
-	config.CurrentContext = rep.Zone
+	config.Contexts[rep.Location] = context
+	config.AuthInfos[rep.Location] = authInfo
+	config.CurrentContext = rep.Location
 
 	c.k8sProvider, err = k8sProvider.New(c.ctx, config)
 	if err != nil {
-		log.Fatal("k8s provider error", err)
+		return errors.Wrap(err, "k8s provider error")
 	}
 	return nil
 }
 
 // ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
 func (c *GKE) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
 	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
-		log.Fatal("error while applying a resource err:", err)
+		return errors.Wrap(err, "error while applying a resource")
+	}
+	return nil
+}
+
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *GKE) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	if err := c.k8sProvider.ResourceDiff(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while diffing the resources")
+	}
+	return nil
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *GKE) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	if err := c.k8sProvider.ResourceLogs(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while streaming the logs")
 	}
 	return nil
 }
 
 // ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
 func (c *GKE) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
 	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
-		log.Fatal("error while deleting objects from a manifest file err:", err)
+		return errors.Wrap(err, "error while deleting objects from a manifest file")
+	}
+	return nil
+}
+
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *GKE) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *GKE) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
 	}
 	return nil
 }
@@ -0,0 +1,91 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	compute "google.golang.org/api/compute/v1"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+)
+
+// Inventory returns the clusters of the GKE_PROJECT_ID project in all locations.
+// The machine types of the nodes come from the instances GKE labels with their cluster name,
+// without access to the compute API the clusters have no cost estimate.
+func (c *GKE) Inventory() ([]provider.ClusterInfo, error) {
+	projectID := c.DeploymentVars["GKE_PROJECT_ID"]
+	if projectID == "" {
+		return nil, fmt.Errorf("missing required GKE_PROJECT_ID variable")
+	}
+
+	rep, err := c.clientGKE.ListClusters(c.ctx, &containerpb.ListClustersRequest{Parent: locationName(projectID, "-")})
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing clusters for project:%v", projectID)
+	}
+
+	machineTypes, err := c.nodeMachineTypes(projectID)
+	if err != nil {
+		log.Printf("Couldn't list the nodes of project '%v', the clusters have no cost estimate: %v", projectID, err)
+	}
+
+	clusters := make([]provider.ClusterInfo, 0, len(rep.Clusters))
+	for _, cluster := range rep.Clusters {
+		created, err := time.Parse(time.RFC3339, cluster.CreateTime)
+		if err != nil {
+			created = provider.CreatedTime(cluster.ResourceLabels)
+		}
+		clusters = append(clusters, provider.ClusterInfo{
+			Name:         cluster.Name,
+			Location:     cluster.Location,
+			Owner:        cluster.ResourceLabels[provider.OwnerLabel],
+			Created:      created,
+			Nodes:        int(cluster.CurrentNodeCount),
+			MachineTypes: machineTypes[cluster.Name],
+		})
+	}
+	return clusters, nil
+}
+
+// nodeMachineTypes returns the number of nodes of each machine type by cluster name.
+func (c *GKE) nodeMachineTypes(projectID string) (map[string]map[string]int, error) {
+	svc, err := compute.NewService(c.ctx, c.clientOption)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating the compute client")
+	}
+	machineTypes := map[string]map[string]int{}
+	if err := svc.Instances.AggregatedList(projectID).Pages(c.ctx, func(l *compute.InstanceAggregatedList) error {
+		for _, scope := range l.Items {
+			for _, i := range scope.Instances {
+				cluster, ok := i.Labels[clusterNameLabel]
+				if !ok {
+					continue
+				}
+				if machineTypes[cluster] == nil {
+					machineTypes[cluster] = map[string]int{}
+				}
+				// The machine type is a URL ending with its name.
+				machineTypes[cluster][path.Base(i.MachineType)]++
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing instances")
+	}
+	return machineTypes, nil
+}
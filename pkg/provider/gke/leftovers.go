@@ -0,0 +1,175 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	compute "google.golang.org/api/compute/v1"
+)
+
+// clusterNameLabel is set by GKE on the compute resources it creates for a cluster.
+const clusterNameLabel = "goog-k8s-cluster-name"
+
+// leftoverMatcher attributes compute resources to a deleted cluster.
+type leftoverMatcher struct {
+	cluster string
+	// owner is the owner label value of the run, empty when the OWNER variable isn't set.
+	owner string
+	// prefix starts the names of the instances, disks and firewall rules GKE creates for the cluster.
+	prefix string
+}
+
+func newLeftoverMatcher(cluster, owner string) leftoverMatcher {
+	m := leftoverMatcher{cluster: cluster, prefix: "gke-" + cluster + "-"}
+	if owner != "" {
+		m.owner = provider.ResourceLabels(owner, time.Time{})[provider.OwnerLabel]
+	}
+	return m
+}
+
+// match returns why the resource belongs to the cluster, or an empty string when it doesn't.
+func (m leftoverMatcher) match(name string, labels map[string]string) string {
+	switch {
+	case labels[clusterNameLabel] == m.cluster:
+		return fmt.Sprintf("label %v=%v", clusterNameLabel, m.cluster)
+	case m.owner != "" && labels[provider.OwnerLabel] == m.owner:
+		return fmt.Sprintf("label %v=%v", provider.OwnerLabel, m.owner)
+	case strings.HasPrefix(name, m.prefix):
+		return fmt.Sprintf("name prefix %v", m.prefix)
+	}
+	return ""
+}
+
+// matchInstances returns why a resource targeting the instances belongs to the cluster,
+// like the target pools of the load balancers of services.
+func (m leftoverMatcher) matchInstances(instances []string) string {
+	for _, i := range instances {
+		if strings.HasPrefix(i[strings.LastIndex(i, "/")+1:], m.prefix) {
+			return fmt.Sprintf("targets node %v", i[strings.LastIndex(i, "/")+1:])
+		}
+	}
+	return ""
+}
+
+// verifyClusterDeleted reports the compute resources of a deleted cluster that were left behind.
+// Deleting a cluster doesn't delete the disks of the persistent volumes which weren't deleted
+// nor the load balancers, addresses and firewall rules of the services of type LoadBalancer.
+func (c *GKE) verifyClusterDeleted(projectID, cluster string) error {
+	run := fmt.Sprintf("cluster %v", cluster)
+	leftovers, err := c.clusterLeftovers(projectID, newLeftoverMatcher(cluster, c.DeploymentVars["OWNER"]))
+	if err != nil {
+		provider.CleanupUnverified(run, err)
+		return nil
+	}
+	return provider.ReportLeftovers(run, leftovers)
+}
+
+func (c *GKE) clusterLeftovers(projectID string, m leftoverMatcher) ([]provider.Leftover, error) {
+	svc, err := compute.NewService(c.ctx, c.clientOption)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating the compute client")
+	}
+
+	var leftovers []provider.Leftover
+	add := func(kind, name, reason string) {
+		if reason != "" {
+			leftovers = append(leftovers, provider.Leftover{Kind: kind, Name: name, Reason: reason})
+		}
+	}
+
+	if err := svc.Disks.AggregatedList(projectID).Pages(c.ctx, func(l *compute.DiskAggregatedList) error {
+		for _, scope := range l.Items {
+			for _, d := range scope.Disks {
+				add("disk", d.Name, m.match(d.Name, d.Labels))
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing disks")
+	}
+
+	// The load balancers of the services are forwarding rules to target pools of the nodes.
+	pools := map[string]string{}
+	if err := svc.TargetPools.AggregatedList(projectID).Pages(c.ctx, func(l *compute.TargetPoolAggregatedList) error {
+		for _, scope := range l.Items {
+			for _, p := range scope.TargetPools {
+				if reason := m.matchInstances(p.Instances); reason != "" {
+					pools[p.SelfLink] = p.Name
+					add("target pool", p.Name, reason)
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing target pools")
+	}
+
+	rules := map[string]string{}
+	if err := svc.ForwardingRules.AggregatedList(projectID).Pages(c.ctx, func(l *compute.ForwardingRuleAggregatedList) error {
+		for _, scope := range l.Items {
+			for _, f := range scope.ForwardingRules {
+				reason := m.match(f.Name, nil)
+				if pool, ok := pools[f.Target]; ok && reason == "" {
+					reason = fmt.Sprintf("targets pool %v", pool)
+				}
+				if reason != "" {
+					rules[f.SelfLink] = f.Name
+				}
+				add("load balancer", fmt.Sprintf("%v (%v)", f.Name, f.IPAddress), reason)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing forwarding rules")
+	}
+
+	if err := svc.Addresses.AggregatedList(projectID).Pages(c.ctx, func(l *compute.AddressAggregatedList) error {
+		for _, scope := range l.Items {
+			for _, a := range scope.Addresses {
+				reason := m.match(a.Name, nil)
+				for _, u := range a.Users {
+					if rule, ok := rules[u]; ok && reason == "" {
+						reason = fmt.Sprintf("used by load balancer %v", rule)
+					}
+				}
+				add("address", fmt.Sprintf("%v (%v)", a.Name, a.Address), reason)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing addresses")
+	}
+
+	if err := svc.Firewalls.List(projectID).Pages(c.ctx, func(l *compute.FirewallList) error {
+		for _, f := range l.Items {
+			reason := m.match(f.Name, nil)
+			for _, tag := range f.TargetTags {
+				if reason == "" && strings.HasPrefix(tag, m.prefix) {
+					reason = fmt.Sprintf("targets the nodes tagged %v", tag)
+				}
+			}
+			add("firewall rule", f.Name, reason)
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "listing firewall rules")
+	}
+
+	return leftovers, nil
+}
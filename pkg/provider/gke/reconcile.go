@@ -0,0 +1,221 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// existingCluster returns the cluster when it already exists, nil otherwise.
+func (c *GKE) existingCluster(projectID, zone, cluster string) (*containerpb.Cluster, error) {
+	rep, err := c.clientGKE.GetCluster(c.ctx, &containerpb.GetClusterRequest{
+		Name: clusterName(projectID, zone, cluster),
+	})
+	if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting cluster '%v'", cluster)
+	}
+	return rep, nil
+}
+
+// existingNodePool returns the nodepool when it already exists, nil otherwise.
+func (c *GKE) existingNodePool(projectID, zone, cluster, nodePool string) (*containerpb.NodePool, error) {
+	rep, err := c.clientGKE.GetNodePool(c.ctx, &containerpb.GetNodePoolRequest{
+		Name: nodePoolName(projectID, zone, cluster, nodePool),
+	})
+	if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting nodepool '%v'", nodePool)
+	}
+	return rep, nil
+}
+
+// clusterDivergence returns why an existing cluster can't be adopted.
+// Its nodepools are reconciled on their own so only its status is checked.
+func clusterDivergence(existing *containerpb.Cluster) []string {
+	switch existing.Status {
+	case containerpb.Cluster_ERROR, containerpb.Cluster_STOPPING:
+		return []string{fmt.Sprintf("status %v", existing.Status)}
+	}
+	return nil
+}
+
+// nodePoolDivergence returns how an existing nodepool differs from the nodepool of the deployment file.
+// Only the settings of the deployment file are compared. The node count, which is changed by resizes
+// and the autoscaler, and the labels added by infra, like the creation time, are ignored.
+func nodePoolDivergence(existing, desired *containerpb.NodePool) []string {
+	var reasons []string
+	switch existing.Status {
+	case containerpb.NodePool_ERROR, containerpb.NodePool_RUNNING_WITH_ERROR, containerpb.NodePool_STOPPING:
+		reasons = append(reasons, fmt.Sprintf("status %v", existing.Status))
+	}
+
+	want, got := desired.GetConfig(), existing.GetConfig()
+	if want.GetMachineType() != "" && want.GetMachineType() != got.GetMachineType() {
+		reasons = append(reasons, fmt.Sprintf("machine type %v instead of %v", got.GetMachineType(), want.GetMachineType()))
+	}
+	if want.GetImageType() != "" && !strings.EqualFold(want.GetImageType(), got.GetImageType()) {
+		reasons = append(reasons, fmt.Sprintf("image type %v instead of %v", got.GetImageType(), want.GetImageType()))
+	}
+	if want.GetDiskSizeGb() != 0 && want.GetDiskSizeGb() != got.GetDiskSizeGb() {
+		reasons = append(reasons, fmt.Sprintf("disk size %vGB instead of %vGB", got.GetDiskSizeGb(), want.GetDiskSizeGb()))
+	}
+	if want.GetLocalSsdCount() != got.GetLocalSsdCount() {
+		reasons = append(reasons, fmt.Sprintf("%v local SSDs instead of %v", got.GetLocalSsdCount(), want.GetLocalSsdCount()))
+	}
+	if want.GetPreemptible() != got.GetPreemptible() {
+		reasons = append(reasons, fmt.Sprintf("preemptible %v instead of %v", got.GetPreemptible(), want.GetPreemptible()))
+	}
+	var labels []string
+	for k, v := range want.GetLabels() {
+		if k == provider.CreatedLabel || k == provider.OwnerLabel || k == warmPoolLabel {
+			continue
+		}
+		if got.GetLabels()[k] != v {
+			labels = append(labels, fmt.Sprintf("label %v=%v missing", k, v))
+		}
+	}
+	sort.Strings(labels)
+	reasons = append(reasons, labels...)
+	if a := desired.GetAutoscaling(); a.GetMaxNodeCount() > 0 &&
+		(a.MinNodeCount != existing.GetAutoscaling().GetMinNodeCount() || a.MaxNodeCount != existing.GetAutoscaling().GetMaxNodeCount()) {
+		reasons = append(reasons, fmt.Sprintf("autoscaling %v-%v nodes instead of %v-%v", existing.GetAutoscaling().GetMinNodeCount(), existing.GetAutoscaling().GetMaxNodeCount(), a.MinNodeCount, a.MaxNodeCount))
+	}
+	return reasons
+}
+
+// reconcileNodePool creates a nodepool of the deployment files and waits until it is running.
+// An existing nodepool is adopted when it matches the deployment file, otherwise it is deleted and created again.
+func (c *GKE) reconcileNodePool(projectID, zone, cluster string, node *containerpb.NodePool, rec *provider.Reconciliation) error {
+	existing, err := c.existingNodePool(projectID, zone, cluster, node.Name)
+	if err != nil {
+		return err
+	}
+	running := func() error {
+		if provider.DryRun {
+			return nil
+		}
+		return provider.RetryUntilTrue(
+			fmt.Sprintf("checking nodepool running status for:%v", node.Name),
+			provider.GlobalRetryCount,
+			func() (bool, error) {
+				return c.nodePoolRunning(zone, projectID, cluster, node.Name)
+			})
+	}
+
+	if existing == nil {
+		rec.Created(node.Name)
+	} else if reasons := nodePoolDivergence(existing, node); len(reasons) == 0 {
+		rec.Adopted(node.Name)
+		return running()
+	} else {
+		rec.Replaced(node.Name, reasons)
+		if err := c.deleteNodePool(projectID, zone, cluster, node.Name); err != nil {
+			return errors.Wrapf(err, "replacing nodepool '%v'", node.Name)
+		}
+	}
+
+	reqN := &containerpb.CreateNodePoolRequest{
+		Parent:   clusterName(projectID, zone, cluster),
+		NodePool: node,
+	}
+	log.Printf("Cluster nodepool create request: cluster '%v', nodepool '%v' , project `%s`,location `%s`", cluster, node.Name, projectID, zone)
+	if provider.DryRun {
+		return provider.DryRunRequest("CreateNodePool", reqN)
+	}
+	// A nodepool still being created when the command is interrupted is deleted.
+	created := provider.OnInterrupt(fmt.Sprintf("deleting the nodepool:%v being created", node.Name), func(ctx context.Context) error {
+		c.ctx = ctx
+		return c.deleteNodePool(projectID, zone, cluster, node.Name)
+	})
+	if err := provider.RetryUntilTrue(
+		fmt.Sprintf("nodepool creation:%v", node.Name),
+		provider.GlobalRetryCount,
+		func() (bool, error) {
+			return c.nodePoolCreated(reqN)
+		}); err != nil {
+		return err
+	}
+	if err := running(); err != nil {
+		return err
+	}
+	created()
+	return nil
+}
+
+// deleteNodePool deletes a nodepool and waits until it is removed.
+func (c *GKE) deleteNodePool(projectID, zone, cluster, nodePool string) error {
+	reqD := &containerpb.DeleteNodePoolRequest{
+		Name: nodePoolName(projectID, zone, cluster, nodePool),
+	}
+	if provider.DryRun {
+		return provider.DryRunRequest("DeleteNodePool", reqD)
+	}
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("deleting nodepool:%v", nodePool),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.nodePoolDeleted(reqD) })
+}
+
+// adoptCluster waits until an existing cluster is running and reconciles its nodepools
+// with the nodepools of the deployment file.
+func (c *GKE) adoptCluster(req *containerpb.CreateClusterRequest) error {
+	if !provider.DryRun {
+		if err := provider.RetryUntilTrue(
+			fmt.Sprintf("creating cluster:%v", req.Cluster.Name),
+			provider.GlobalRetryCount,
+			func() (bool, error) { return c.clusterRunning(req.Zone, req.ProjectId, req.Cluster.Name) }); err != nil {
+			return err
+		}
+	}
+	rec := provider.NewReconciliation("nodepool")
+	for _, node := range req.Cluster.NodePools {
+		if err := c.reconcileNodePool(req.ProjectId, req.Zone, req.Cluster.Name, node, rec); err != nil {
+			return errors.Wrapf(err, "nodepool '%v'", node.Name)
+		}
+	}
+	rec.Report()
+	if c.ReleaseChannel != "" && !provider.DryRun {
+		return c.setReleaseChannel(req.ProjectId, req.Zone, req.Cluster.Name)
+	}
+	return nil
+}
+
+// deleteCluster deletes a cluster and waits until it is removed.
+func (c *GKE) deleteCluster(projectID, zone, cluster string) error {
+	reqD := &containerpb.DeleteClusterRequest{
+		Name: clusterName(projectID, zone, cluster),
+	}
+	if provider.DryRun {
+		return provider.DryRunRequest("DeleteCluster", reqD)
+	}
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("deleting cluster:%v", cluster),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.clusterDeleted(reqD) })
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+)
+
+func TestNodePoolDivergence(t *testing.T) {
+	desired := func() *containerpb.NodePool {
+		node := &containerpb.NodePool{
+			Name: "prometheus-123",
+			Config: &containerpb.NodeConfig{
+				MachineType:   "n1-highmem-8",
+				ImageType:     "COS",
+				DiskSizeGb:    100,
+				LocalSsdCount: 1,
+				Labels:        map[string]string{"node-name": "prometheus-123"},
+			},
+		}
+		labelNodePool(node, provider.ResourceLabels("ci", time.Now()))
+		return node
+	}
+	// The nodepool created by a previous run, with its own creation time and the node count changed by a resize.
+	existing := func() *containerpb.NodePool {
+		node := desired()
+		node.Status = containerpb.NodePool_RUNNING
+		node.InitialNodeCount = 5
+		node.Config.ImageType = "cos"
+		labelNodePool(node, provider.ResourceLabels("ci", time.Now().Add(-time.Hour)))
+		return node
+	}
+
+	for _, tc := range []struct {
+		name    string
+		modify  func(*containerpb.NodePool)
+		reasons []string
+	}{
+		{
+			name:   "matching",
+			modify: func(*containerpb.NodePool) {},
+		},
+		{
+			name:    "failed",
+			modify:  func(n *containerpb.NodePool) { n.Status = containerpb.NodePool_ERROR },
+			reasons: []string{"status ERROR"},
+		},
+		{
+			name: "machine",
+			modify: func(n *containerpb.NodePool) {
+				n.Config.MachineType = "n1-standard-4"
+				n.Config.LocalSsdCount = 0
+			},
+			reasons: []string{"machine type n1-standard-4 instead of n1-highmem-8", "0 local SSDs instead of 1"},
+		},
+		{
+			name:    "labels",
+			modify:  func(n *containerpb.NodePool) { n.Config.Labels["node-name"] = "prometheus-456" },
+			reasons: []string{"label node-name=prometheus-123 missing"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			node := existing()
+			tc.modify(node)
+			if reasons := nodePoolDivergence(node, desired()); !reflect.DeepEqual(reasons, tc.reasons) {
+				t.Errorf("expected %v, got %v", tc.reasons, reasons)
+			}
+		})
+	}
+}
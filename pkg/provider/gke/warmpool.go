@@ -0,0 +1,327 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/alecthomas/kingpin.v2"
+	yamlGo "gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// warmPoolLabel marks the nodes of a standby nodepool.
+	// The value is the PR_NUMBER used when creating the warm pool.
+	warmPoolLabel = "infra-warm-pool"
+	// nodePoolLabel is set by GKE on every node with the name of its nodepool.
+	nodePoolLabel = "cloud.google.com/gke-nodepool"
+	// warmPoolClaimLabel prefixes the resource labels of the cluster recording the claimed warm pools.
+	// The key is the prefix followed by the id of the warm pool and the value is the PR_NUMBER which claimed it.
+	warmPoolClaimLabel = "infra-warm-claim-"
+)
+
+// parseNodePools returns the nodepools of the cluster deployment files.
+func parseNodePools(resources []Resource) ([]*containerpb.NodePool, error) {
+	var pools []*containerpb.NodePool
+	for _, deployment := range resources {
+		reqC := &containerpb.CreateClusterRequest{}
+		if err := yamlGo.UnmarshalStrict(deployment.Content, reqC); err != nil {
+			return nil, errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
+		}
+		if reqC.Cluster != nil {
+			pools = append(pools, reqC.Cluster.NodePools...)
+		}
+	}
+	return pools, nil
+}
+
+// NodePoolClaim assigns a ready warm pool to the PR_NUMBER instead of creating new nodepools.
+// The claim is recorded in the resource labels of the cluster so that a warm pool is claimed only once,
+// even when its nodes are recreated by an auto-repair or an upgrade.
+// The nodes of the warm pool are relabeled with the labels of the nodepools in the deployment files
+// so the k8s objects are scheduled on them. The warm nodepools keep their names and
+// are deleted together with the nodepools of the PR_NUMBER.
+// Returns an error when no warm pool is ready so that the nodepools can be created instead.
+func (c *GKE) NodePoolClaim(*kingpin.ParseContext) error {
+	claimant := c.DeploymentVars["PR_NUMBER"]
+	if claimant == "" {
+		return fmt.Errorf("missing required PR_NUMBER variable for the claim")
+	}
+	targets, err := parseNodePools(c.gkeResources)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := c.getCluster()
+	if err != nil {
+		return err
+	}
+	for _, id := range warmPoolIDs(cluster) {
+		warm, err := c.readyWarmPool(id, len(targets))
+		if err != nil {
+			return err
+		}
+		if warm == nil {
+			continue
+		}
+		claimed, err := c.claimWarmPool(id, claimant)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			log.Printf("Skipping warm pool '%v' claimed by another run", id)
+			continue
+		}
+
+		for i, pool := range warm {
+			nodes, err := c.k8sProvider.NodesList(labels.Set{nodePoolLabel: pool.Name}.String())
+			if err != nil {
+				return err
+			}
+			log.Printf("Claiming warm nodepool '%v' for nodepool '%v'", pool.Name, targets[i].Name)
+			for _, node := range nodes {
+				if err := c.k8sProvider.NodeLabelsUpdate(node.Name, targets[i].GetConfig().GetLabels(), []string{warmPoolLabel}); err != nil {
+					return errors.Wrapf(err, "relabeling node:%v", node.Name)
+				}
+			}
+		}
+		return nil
+	}
+	return errors.New("no warm pool ready to claim")
+}
+
+// getCluster returns the cluster of the deployment variables.
+func (c *GKE) getCluster() (*containerpb.Cluster, error) {
+	req := &containerpb.GetClusterRequest{
+		Name: clusterName(c.DeploymentVars["GKE_PROJECT_ID"], c.DeploymentVars["ZONE"], c.DeploymentVars["CLUSTER_NAME"]),
+	}
+	rep, err := c.clientGKE.GetCluster(c.ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get cluster details")
+	}
+	return rep, nil
+}
+
+// warmPoolIDs returns the ids of the warm pools of the cluster which aren't claimed, oldest first.
+func warmPoolIDs(cluster *containerpb.Cluster) []string {
+	seen := map[string]bool{}
+	var ids []string
+	for _, pool := range cluster.NodePools {
+		id := pool.GetConfig().GetLabels()[warmPoolLabel]
+		if id == "" || seen[id] || cluster.ResourceLabels[warmPoolClaimLabel+id] != "" {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return warmPoolIDLess(ids[i], ids[j]) })
+	return ids
+}
+
+// warmPoolNumber splits the ids of the warm pools into a prefix and a number, eg. warm-1606725960 or 1234.
+var warmPoolNumber = regexp.MustCompile(`^(.*?)(\d+)$`)
+
+// warmPoolIDLess orders the ids with the same prefix by their number, eg. warm-9 before warm-10,
+// so that the oldest warm pools are claimed first. The other ids are compared as strings.
+func warmPoolIDLess(a, b string) bool {
+	ma, mb := warmPoolNumber.FindStringSubmatch(a), warmPoolNumber.FindStringSubmatch(b)
+	if ma != nil && mb != nil && ma[1] == mb[1] {
+		na, errA := strconv.ParseUint(ma[2], 10, 64)
+		nb, errB := strconv.ParseUint(mb[2], 10, 64)
+		if errA == nil && errB == nil && na != nb {
+			return na < nb
+		}
+	}
+	return a < b
+}
+
+// readyWarmPool returns the nodepools of the warm pool when all of them are running and their nodes are registered.
+// The nodepools are in the order of the deployment files so they match the nodepools they are claimed for.
+func (c *GKE) readyWarmPool(id string, count int) ([]*containerpb.NodePool, error) {
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, provider.MergeDeploymentVars(
+		c.DeploymentVars,
+		map[string]string{"PR_NUMBER": id},
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse deployment files")
+	}
+	pools, err := parseNodePools(deploymentResource)
+	if err != nil {
+		return nil, err
+	}
+	if len(pools) != count {
+		log.Printf("Skipping warm pool '%v' with %v nodepools, expected %v", id, len(pools), count)
+		return nil, nil
+	}
+
+	for _, pool := range pools {
+		// Recreated nodes get the labels of the nodepool so a preempted node would lose the claim.
+		if pool.GetConfig().GetPreemptible() {
+			log.Printf("Skipping warm pool '%v' with the preemptible nodepool '%v'", id, pool.Name)
+			return nil, nil
+		}
+		isRunning, err := c.nodePoolRunning(c.DeploymentVars["ZONE"], c.DeploymentVars["GKE_PROJECT_ID"], c.DeploymentVars["CLUSTER_NAME"], pool.Name)
+		if err != nil {
+			log.Printf("Skipping warm pool '%v': %v", id, err)
+			return nil, nil
+		}
+		if !isRunning {
+			return nil, nil
+		}
+		nodes, err := c.k8sProvider.NodesList(labels.Set{nodePoolLabel: pool.Name}.String())
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 {
+			// The nodes haven't registered yet.
+			return nil, nil
+		}
+	}
+	return pools, nil
+}
+
+// claimWarmPool records the claim of the warm pool in the resource labels of the cluster.
+// Returns false when the warm pool is already claimed.
+func (c *GKE) claimWarmPool(id, claimant string) (bool, error) {
+	key := warmPoolClaimLabel + id
+	var claimed bool
+	err := c.updateClusterLabels(func(labels map[string]string) bool {
+		claimed = labels[key] == ""
+		if claimed {
+			labels[key] = claimant
+		}
+		return claimed
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "claiming warm pool:%v", id)
+	}
+	return claimed, nil
+}
+
+// claimedWarmPools returns the ids of the warm pools claimed by the claimant
+// and the names of their nodepools.
+func (c *GKE) claimedWarmPools(claimant string) ([]string, []string, error) {
+	if claimant == "" {
+		return nil, nil, nil
+	}
+	cluster, err := c.getCluster()
+	if err != nil {
+		if st, ok := status.FromError(errors.Cause(err)); ok && st.Code() == codes.NotFound {
+			return nil, nil, nil
+		}
+		return nil, nil, errors.Wrap(err, "finding the claimed warm pools")
+	}
+	ids, names := warmPoolClaims(cluster, claimant)
+	return ids, names, nil
+}
+
+// warmPoolClaims returns the ids of the warm pools of the cluster claimed by the claimant
+// and the names of their nodepools.
+func warmPoolClaims(cluster *containerpb.Cluster, claimant string) ([]string, []string) {
+	claims := map[string]bool{}
+	var ids []string
+	for k, v := range cluster.ResourceLabels {
+		if strings.HasPrefix(k, warmPoolClaimLabel) && v == claimant {
+			id := strings.TrimPrefix(k, warmPoolClaimLabel)
+			claims[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var names []string
+	for _, pool := range cluster.NodePools {
+		if claims[pool.GetConfig().GetLabels()[warmPoolLabel]] {
+			names = append(names, pool.Name)
+		}
+	}
+	return ids, names
+}
+
+// releaseWarmPools removes the claims of the warm pools from the resource labels of the cluster.
+func (c *GKE) releaseWarmPools(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := c.updateClusterLabels(func(labels map[string]string) bool {
+		var changed bool
+		for _, id := range ids {
+			if _, ok := labels[warmPoolClaimLabel+id]; ok {
+				delete(labels, warmPoolClaimLabel+id)
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		return errors.Wrapf(err, "releasing the claims of the warm pools %v", ids)
+	}
+	return nil
+}
+
+// updateClusterLabels sets the resource labels of the cluster changed by update, nothing is set when it returns false.
+// The labels are set with the fingerprint of the labels they were read with so a concurrent change fails the request,
+// the labels are then read again and update is called with them.
+func (c *GKE) updateClusterLabels(update func(map[string]string) bool) error {
+	name := clusterName(c.DeploymentVars["GKE_PROJECT_ID"], c.DeploymentVars["ZONE"], c.DeploymentVars["CLUSTER_NAME"])
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("updating the labels of cluster:%v", c.DeploymentVars["CLUSTER_NAME"]),
+		provider.GlobalRetryCount,
+		func() (bool, error) {
+			cluster, err := c.getCluster()
+			if err != nil {
+				return false, err
+			}
+			labels := map[string]string{}
+			for k, v := range cluster.ResourceLabels {
+				labels[k] = v
+			}
+			if !update(labels) {
+				return true, nil
+			}
+
+			req := &containerpb.SetLabelsRequest{
+				Name:             name,
+				ResourceLabels:   labels,
+				LabelFingerprint: cluster.LabelFingerprint,
+			}
+			if provider.DryRun {
+				return true, provider.DryRunRequest("SetLabels", req)
+			}
+			if _, err := c.clientGKE.SetLabels(c.ctx, req); err != nil {
+				st, ok := status.FromError(err)
+				if !ok {
+					return false, fmt.Errorf("unknown reply status error %v", err)
+				}
+				// The fingerprint doesn't match or another operation is running on the cluster.
+				if st.Code() == codes.FailedPrecondition || st.Code() == codes.Aborted {
+					log.Printf("Couldn't update the labels of the cluster, retrying: %v", err)
+					return false, nil
+				}
+				return false, err
+			}
+			return true, nil
+		})
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gke
+
+import (
+	"reflect"
+	"testing"
+
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+)
+
+func TestWarmPools(t *testing.T) {
+	pool := func(name, id string) *containerpb.NodePool {
+		return &containerpb.NodePool{
+			Name:   name,
+			Config: &containerpb.NodeConfig{Labels: map[string]string{warmPoolLabel: id}},
+		}
+	}
+	cluster := &containerpb.Cluster{
+		NodePools: []*containerpb.NodePool{
+			{Name: "prometheus-123"},
+			pool("prometheus-warm-10", "warm-10"),
+			pool("nodes-warm-10", "warm-10"),
+			pool("prometheus-warm-9", "warm-9"),
+			pool("prometheus-warm-100", "warm-100"),
+			pool("prometheus-warm-8", "warm-8"),
+			pool("nodes-warm-8", "warm-8"),
+			pool("prometheus-other", "other"),
+		},
+		ResourceLabels: map[string]string{
+			"owner":                         "ci",
+			warmPoolClaimLabel + "warm-8":   "123",
+			warmPoolClaimLabel + "warm-100": "456",
+		},
+	}
+
+	if expected, ids := []string{"other", "warm-9", "warm-10"}, warmPoolIDs(cluster); !reflect.DeepEqual(expected, ids) {
+		t.Errorf("expected the unclaimed warm pools %v, got %v", expected, ids)
+	}
+
+	ids, names := warmPoolClaims(cluster, "123")
+	if expected := []string{"warm-8"}; !reflect.DeepEqual(expected, ids) {
+		t.Errorf("expected the claims %v, got %v", expected, ids)
+	}
+	if expected := []string{"prometheus-warm-8", "nodes-warm-8"}; !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected the claimed nodepools %v, got %v", expected, names)
+	}
+
+	if ids, names := warmPoolClaims(cluster, "789"); len(ids) != 0 || len(names) != 0 {
+		t.Errorf("expected no claims, got %v and the nodepools %v", ids, names)
+	}
+}
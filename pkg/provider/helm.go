@@ -0,0 +1,269 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	helmChartAPIVersion = "infra.prometheus.io/v1"
+	helmChartKind       = "HelmChart"
+)
+
+// HelmCacheDir is the directory of the charts downloaded from the repositories.
+var HelmCacheDir = filepath.Join(os.TempDir(), "infra-helm")
+
+// HelmChartsOnly keeps only the objects of the HelmChart documents of the deployment files, used by resource helm-install.
+var HelmChartsOnly bool
+
+// helmChart is a document of the deployment files installing a helm chart.
+// It is replaced with the objects of the chart rendered like helm template, see expandHelmCharts.
+type helmChart struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		// Name is the release name.
+		Name string `json:"name"`
+		// Namespace is the release namespace, default when not set.
+		Namespace string `json:"namespace,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		// Repo is the url of the chart repository, the chart is a local directory or archive when not set.
+		Repo  string `json:"repo,omitempty"`
+		Chart string `json:"chart"`
+		// Version is the version or a version constraint of the chart, the latest version when not set.
+		Version string `json:"version,omitempty"`
+		// ValuesFiles are merged in order, followed by the Values.
+		ValuesFiles []string               `json:"valuesFiles,omitempty"`
+		Values      map[string]interface{} `json:"values,omitempty"`
+		// APIVersions are added to the .Capabilities.APIVersions of the cluster.
+		APIVersions []string `json:"apiVersions,omitempty"`
+		SkipCRDs    bool     `json:"skipCRDs,omitempty"`
+	} `json:"spec"`
+}
+
+// expandHelmCharts replaces the HelmChart documents of the file with the objects of their charts.
+// The values files are read with readFile, relative to the file.
+// With HelmChartsOnly the other documents are dropped.
+func expandHelmCharts(name string, content []byte, readFile func(name string) ([]byte, error)) ([]byte, error) {
+	if !bytes.Contains(content, []byte(helmChartKind)) {
+		if HelmChartsOnly {
+			return nil, nil
+		}
+		return content, nil
+	}
+	var docs [][]byte
+	for i, doc := range splitYAMLDocuments(content) {
+		var typeMeta struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		// The other documents are kept as they are.
+		if err := yaml.Unmarshal(doc, &typeMeta); err != nil || typeMeta.APIVersion != helmChartAPIVersion || typeMeta.Kind != helmChartKind {
+			if !HelmChartsOnly {
+				docs = append(docs, doc)
+			}
+			continue
+		}
+		var h helmChart
+		if err := yaml.UnmarshalStrict(doc, &h); err != nil {
+			return nil, errors.Wrapf(err, "decoding the %v of document %v", helmChartKind, i+1)
+		}
+		rendered, err := h.render(filepath.Dir(name), readFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rendering chart %v of release %v", h.Spec.Chart, h.Metadata.Name)
+		}
+		docs = append(docs, rendered)
+	}
+	return bytes.Join(docs, []byte(Separator+"\n")), nil
+}
+
+// render installs the chart with a client only dry run of helm and returns the objects of the release as yaml documents.
+// The hooks are included as normal objects, except the tests.
+func (h *helmChart) render(dir string, readFile func(name string) ([]byte, error)) ([]byte, error) {
+	if h.Metadata.Name == "" || h.Spec.Chart == "" {
+		return nil, fmt.Errorf("the release name and the chart are required")
+	}
+
+	values := map[string]interface{}{}
+	for _, f := range h.Spec.ValuesFiles {
+		content, err := readFile(filepath.Join(dir, f))
+		if err != nil {
+			return nil, err
+		}
+		v := map[string]interface{}{}
+		if err := yaml.Unmarshal(content, &v); err != nil {
+			return nil, errors.Wrapf(err, "decoding the values file %v", f)
+		}
+		values = chartutil.CoalesceTables(v, values)
+	}
+	values = chartutil.CoalesceTables(h.Spec.Values, values)
+
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = !h.Spec.SkipCRDs
+	install.SkipCRDs = h.Spec.SkipCRDs
+	install.ReleaseName = h.Metadata.Name
+	install.Namespace = h.Metadata.Namespace
+	if install.Namespace == "" {
+		install.Namespace = "default"
+	}
+	install.APIVersions = h.Spec.APIVersions
+	install.RepoURL = h.Spec.Repo
+	install.Version = h.Spec.Version
+
+	chartPath := h.Spec.Chart
+	if h.Spec.Repo == "" {
+		chartPath = filepath.Join(dir, chartPath)
+	}
+	settings := cli.New()
+	settings.RepositoryCache = HelmCacheDir
+	settings.RepositoryConfig = filepath.Join(HelmCacheDir, "repositories.yaml")
+	chartPath, err := install.LocateChart(chartPath, settings)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading %v", chartPath)
+	}
+	rel, err := install.Run(chart, values)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []string{rel.Manifest}
+	for _, hook := range rel.Hooks {
+		if !isTestHook(hook) {
+			manifests = append(manifests, fmt.Sprintf("# Source: %v\n%v", hook.Path, hook.Manifest))
+		}
+	}
+	objects, err := decodeKObjects(h.Spec.Chart, []byte(strings.Join(manifests, "\n"+Separator+"\n")))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	for i, o := range objects {
+		// Helm applies the objects without a namespace in the release namespace.
+		if o.namespace() == "" && !clusterScoped[o.gvk().Kind] {
+			o.meta()["namespace"] = install.Namespace
+		}
+		doc, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, errors.Wrapf(err, "marshal %v", o)
+		}
+		if i > 0 {
+			b.WriteString(Separator + "\n")
+		}
+		b.Write(doc)
+	}
+	return b.Bytes(), nil
+}
+
+func isTestHook(hook *release.Hook) bool {
+	for _, e := range hook.Events {
+		if e == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
+
+// kobject is a k8s object decoded from yaml.
+type kobject map[string]interface{}
+
+func (o kobject) gvk() schema.GroupVersionKind {
+	apiVersion, _ := o["apiVersion"].(string)
+	kind, _ := o["kind"].(string)
+	return schema.FromAPIVersionAndKind(apiVersion, kind)
+}
+
+// meta returns the metadata field, creating it when missing.
+func (o kobject) meta() map[string]interface{} {
+	m, ok := o["metadata"].(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+		o["metadata"] = m
+	}
+	return m
+}
+
+func (o kobject) name() string {
+	name, _ := o.meta()["name"].(string)
+	return name
+}
+
+func (o kobject) namespace() string {
+	ns, _ := o.meta()["namespace"].(string)
+	return ns
+}
+
+func (o kobject) String() string {
+	return fmt.Sprintf("%v/%v", strings.ToLower(o.gvk().Kind), o.name())
+}
+
+// decodeKObjects decodes the yaml documents of a file, the items of a List are decoded as separate objects.
+func decodeKObjects(name string, content []byte) ([]kobject, error) {
+	var objects []kobject
+	for i, doc := range splitYAMLDocuments(content) {
+		var o kobject
+		if err := yaml.Unmarshal(doc, &o); err != nil {
+			return nil, errors.Wrapf(err, "decoding %v, document %v", name, i+1)
+		}
+		if len(o) == 0 {
+			continue
+		}
+		if items, ok := o["items"].([]interface{}); ok && strings.HasSuffix(o.gvk().Kind, "List") {
+			for _, item := range items {
+				if m, ok := item.(map[string]interface{}); ok {
+					objects = append(objects, kobject(m))
+				}
+			}
+			continue
+		}
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
+
+// clusterScoped are the kinds which don't get the namespace of the release.
+var clusterScoped = map[string]bool{
+	"Namespace":                      true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"CustomResourceDefinition":       true,
+	"PersistentVolume":               true,
+	"StorageClass":                   true,
+	"PriorityClass":                  true,
+	"PodSecurityPolicy":              true,
+	"APIService":                     true,
+	"MutatingWebhookConfiguration":   true,
+	"ValidatingWebhookConfiguration": true,
+}
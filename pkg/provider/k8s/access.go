@@ -0,0 +1,118 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	authorizationV1 "k8s.io/api/authorization/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// ApplyVerbs are the verbs used by ResourceApply.
+	// The objects are applied with a server-side apply patch which also needs create
+	// for the objects that don't exist yet, get is used when waiting for the objects to become ready.
+	ApplyVerbs = []string{"get", "create", "patch"}
+	// DeleteVerbs are the verbs used by ResourceDelete.
+	// get is used when waiting for the objects to be removed.
+	DeleteVerbs = []string{"delete", "get"}
+)
+
+// clusterScoped are the kinds supported by ResourceApply that don't belong to a namespace.
+var clusterScoped = map[string]bool{
+	"clusterrole":              true,
+	"clusterrolebinding":       true,
+	"customresourcedefinition": true,
+	"namespace":                true,
+}
+
+// permission is an operation on a k8s object.
+type permission struct {
+	authorizationV1.ResourceAttributes
+}
+
+func (p permission) String() string {
+	resource := p.Resource
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	s := fmt.Sprintf("%v %v", p.Verb, resource)
+	if p.Name != "" {
+		s += "/" + p.Name
+	}
+	if p.Namespace != "" {
+		s += " in namespace " + p.Namespace
+	}
+	return s
+}
+
+// requiredPermissions returns the operations needed to perform the verbs on the objects, without duplicates.
+// The list verb isn't scoped to an object name.
+func requiredPermissions(deployments []Resource, verbs []string) []permission {
+	var perms []permission
+	seen := map[permission]bool{}
+	for _, deployment := range deployments {
+		for _, resource := range deployment.Objects {
+			gvr, namespace, name := objectRef(resource)
+			for _, verb := range verbs {
+				p := permission{authorizationV1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Group:     gvr.Group,
+					Resource:  gvr.Resource,
+					Name:      name,
+				}}
+				if verb == "list" {
+					p.Name = ""
+				}
+				if seen[p] {
+					continue
+				}
+				seen[p] = true
+				perms = append(perms, p)
+			}
+		}
+	}
+	return perms
+}
+
+// PermissionsCheck uses SelfSubjectAccessReview to verify that the current identity
+// can perform the verbs on all objects and returns an error with every missing permission.
+// This avoids failing in the middle of an apply or a delete.
+func (c *K8s) PermissionsCheck(deployments []Resource, verbs []string) error {
+	deployments, err := c.secretSources(deployments, false)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, p := range requiredPermissions(deployments, verbs) {
+		attrs := p.ResourceAttributes
+		review, err := c.clt.AuthorizationV1().SelfSubjectAccessReviews().Create(c.ctx, &authorizationV1.SelfSubjectAccessReview{
+			Spec: authorizationV1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attrs},
+		}, apiMetaV1.CreateOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "reviewing access for %v", p)
+		}
+		if !review.Status.Allowed {
+			missing = append(missing, p.String())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing permissions:\n\t%v", strings.Join(missing, "\n\t"))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	appsV1 "k8s.io/api/apps/v1"
+	batchV1 "k8s.io/api/batch/v1"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// FieldManager is the manager of the fields set by ResourceApply.
+const FieldManager = "test-infra"
+
+// applyAll applies the objects with up to ApplyConcurrency objects at a time.
+// Once an object failed no more objects are started, the errors of the objects already started are all returned.
+func (c *K8s) applyAll(objects []object) error {
+	workers := c.ApplyConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg   sync.WaitGroup
+		mtx  sync.Mutex
+		errs []string
+	)
+	sem := make(chan struct{}, workers)
+	for _, o := range objects {
+		sem <- struct{}{}
+		mtx.Lock()
+		failed := len(errs) > 0
+		mtx.Unlock()
+		if failed {
+			break
+		}
+		wg.Add(1)
+		go func(o object) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			start := time.Now()
+			err := provider.Chaos("applying " + describe(o.resource))
+			if err == nil {
+				err = c.apply(o.resource)
+			}
+			provider.RecordAction("apply "+describe(o.resource), start, err)
+			if err != nil {
+				mtx.Lock()
+				errs = append(errs, fmt.Sprintf("error applying '%v' err:%v", o.fileName, err))
+				mtx.Unlock()
+			}
+		}(o)
+	}
+	wg.Wait()
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errors.New(errs[0])
+	}
+	return fmt.Errorf("%v objects failed to apply:\n\t%v", len(errs), strings.Join(errs, "\n\t"))
+}
+
+// apply applies an object and waits until it is ready.
+func (c *K8s) apply(resource runtime.Object) error {
+	if err := c.serverSideApply(resource); err != nil {
+		return err
+	}
+
+	switch req := resource.(type) {
+	case *appsV1.Deployment, *appsV1.StatefulSet, *appsV1.DaemonSet:
+		return c.waitRollout(resource)
+	case *batchV1.Job:
+		const Infinite int = 1<<31 - 1
+		return c.waitReady(
+			fmt.Sprintf("running job:%v", req.Name),
+			Infinite,
+			func() (bool, error) { return c.jobReady(resource) })
+	case *apiCoreV1.Service:
+		return c.waitReady(
+			fmt.Sprintf("applying service:%v", req.Name),
+			provider.GlobalRetryCount,
+			func() (bool, error) { return c.serviceExists(resource) })
+	}
+	return nil
+}
+
+// serverSideApply creates or updates an object with a server-side apply.
+// The API server merges the fields of the object with the ones set by other managers,
+// so repeated applies converge and the fields set by controllers, like the replicas
+// of an autoscaled deployment, are kept unless the object sets them too.
+// Setting a field owned by another manager is a conflict which fails the apply,
+// with ForceConflicts the fields are taken over instead.
+func (c *K8s) serverSideApply(resource runtime.Object) error {
+	timeout := kindServedTimeout
+	if provider.DryRun {
+		// The CRDs applied in dry-run mode aren't persisted so their kinds won't be served.
+		timeout = 0
+	}
+	kind := resource.GetObjectKind().GroupVersionKind().Kind
+	client, obj, err := c.resourceClient(resource, timeout)
+	if provider.DryRun && meta.IsNoMatchError(err) {
+		log.Printf("Dry run, skipping %v as its kind isn't served by the cluster", describe(resource))
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error finding the resource of %v", describe(resource))
+	}
+	c.labelApplySet(obj)
+	c.appliedMtx.Lock()
+	c.applied[objectKey(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = true
+	c.appliedMtx.Unlock()
+
+	data, err := applyConfiguration(obj)
+	if err != nil {
+		return errors.Wrapf(err, "encoding %v", describe(resource))
+	}
+	force := c.ForceConflicts
+	_, err = client.Patch(c.ctx, obj.GetName(), types.ApplyPatchType, data, apiMetaV1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+		DryRun:       c.dryRun(),
+	})
+	if apiErrors.IsConflict(err) {
+		return errors.Wrapf(err, "resource apply conflicts with the fields of other managers, use --force-conflicts to take them over - kind: %v, name: %v", kind, obj.GetName())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "resource apply failed - kind: %v, name: %v", kind, obj.GetName())
+	}
+	log.Printf("resource applied - kind: %v, name: %v", kind, obj.GetName())
+	return nil
+}
+
+// applyConfiguration returns the fields of the object that ResourceApply manages.
+// The zero creation timestamp and the status of the typed objects aren't part of
+// the deployment files so they are removed to not claim them.
+func applyConfiguration(obj *unstructured.Unstructured) ([]byte, error) {
+	obj = obj.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "status")
+	return json.Marshal(obj.Object)
+}
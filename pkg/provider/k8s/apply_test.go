@@ -0,0 +1,183 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	fakeDiscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	fakeDynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/restmapper"
+	clientTesting "k8s.io/client-go/testing"
+)
+
+func TestApplyConfiguration(t *testing.T) {
+	objects, err := DecodeObjects("test", []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus
+spec:
+  template:
+    spec:
+      containers:
+      - name: prometheus
+        image: prom/prometheus
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(objects[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &unstructured.Unstructured{Object: content}
+	if _, ok := obj.Object["status"]; !ok {
+		t.Fatal("expected the typed object to have a status")
+	}
+
+	data, err := applyConfiguration(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied map[string]interface{}
+	if err := json.Unmarshal(data, &applied); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := applied["status"]; ok {
+		t.Error("the status should not be applied")
+	}
+	metadata := applied["metadata"].(map[string]interface{})
+	if _, ok := metadata["creationTimestamp"]; ok {
+		t.Error("the creation timestamp should not be applied")
+	}
+	if metadata["name"] != "prometheus" || applied["kind"] != "Deployment" || applied["apiVersion"] != "apps/v1" {
+		t.Errorf("unexpected apply configuration: %s", data)
+	}
+	if _, ok := obj.Object["status"]; !ok {
+		t.Error("the object should not be modified")
+	}
+}
+
+// countingClient counts the concurrent patches of the configmaps, the fake client handles its requests one by one.
+type countingClient struct {
+	dynamic.Interface
+	fail string
+
+	mtx              sync.Mutex
+	running, maxRuns int
+	patched          []string
+}
+
+func (c *countingClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return countingResource{NamespaceableResourceInterface: c.Interface.Resource(gvr), c: c}
+}
+
+type countingResource struct {
+	dynamic.NamespaceableResourceInterface
+	c *countingClient
+}
+
+func (r countingResource) Namespace(ns string) dynamic.ResourceInterface {
+	return countingNamespace{ResourceInterface: r.NamespaceableResourceInterface.Namespace(ns), c: r.c}
+}
+
+type countingNamespace struct {
+	dynamic.ResourceInterface
+	c *countingClient
+}
+
+func (r countingNamespace) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, options apiMetaV1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	c := r.c
+	c.mtx.Lock()
+	c.running++
+	if c.running > c.maxRuns {
+		c.maxRuns = c.running
+	}
+	c.mtx.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.running--
+	if name == c.fail {
+		return nil, fmt.Errorf("injected")
+	}
+	c.patched = append(c.patched, name)
+	return testConfigMap(name, nil), nil
+}
+
+func TestApplyAll(t *testing.T) {
+	for _, tc := range []struct {
+		concurrency int
+		fail        string
+	}{
+		{concurrency: 1},
+		{concurrency: 4},
+		{concurrency: 4, fail: "config-2"},
+	} {
+		client := &countingClient{Interface: fakeDynamic.NewSimpleDynamicClient(runtime.NewScheme()), fail: tc.fail}
+		discoveryClient := memory.NewMemCacheClient(&fakeDiscovery.FakeDiscovery{Fake: &clientTesting.Fake{
+			Resources: []*apiMetaV1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []apiMetaV1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}},
+			}},
+		}})
+		c := &K8s{
+			ctx:       context.Background(),
+			dynClient: client,
+			discovery: discoveryClient,
+			mapper:    restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient),
+			Options:   Options{ApplyConcurrency: tc.concurrency},
+			applied:   map[string]bool{},
+		}
+		var objects []object
+		for i := 0; i < 8; i++ {
+			objects = append(objects, object{fileName: "configmaps.yaml", resource: testConfigMap(fmt.Sprintf("config-%v", i), nil)})
+		}
+
+		err := c.applyAll(objects)
+		if tc.fail == "" {
+			if err != nil {
+				t.Fatalf("concurrency %v: %v", tc.concurrency, err)
+			}
+			if client.maxRuns != tc.concurrency || len(client.patched) != len(objects) || len(c.applied) != len(objects) {
+				t.Errorf("concurrency %v: expected all objects applied %v at a time, got %v applied %v at a time", tc.concurrency, tc.concurrency, len(client.patched), client.maxRuns)
+			}
+			if tc.concurrency == 1 && fmt.Sprint(client.patched) != "[config-0 config-1 config-2 config-3 config-4 config-5 config-6 config-7]" {
+				t.Errorf("expected the objects applied in order, got %v", client.patched)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "injected") {
+			t.Fatalf("expected the injected error, got %v", err)
+		}
+		// The objects started before the failure was noticed are applied, no more are started after it.
+		if len(client.patched) >= len(objects)-1 {
+			t.Errorf("expected the apply to stop after the failure, got %v applied", client.patched)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"gopkg.in/alecthomas/kingpin.v2"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// rbacManifest holds the minimal permissions needed to apply and delete
+// the resources supported by ResourceApply and ResourceDelete and to manage the nodes.
+// The bind and escalate verbs allow applying the roles used by the benchmark manifests.
+const rbacManifest = `
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: {{ .Namespace }}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: {{ .ServiceAccount }}
+  namespace: {{ .Namespace }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: {{ .ServiceAccount }}
+rules:
+- apiGroups: [""]
+  resources: ["namespaces", "services", "configmaps", "secrets", "serviceaccounts", "persistentvolumeclaims"]
+  verbs: ["get", "list", "create", "update", "patch", "delete"]
+- apiGroups: [""]
+  resources: ["nodes"]
+  verbs: ["get", "list", "update"]
+- apiGroups: ["apps"]
+  resources: ["deployments", "daemonsets", "statefulsets"]
+  verbs: ["get", "list", "create", "update", "patch", "delete"]
+- apiGroups: ["batch"]
+  resources: ["jobs"]
+  verbs: ["get", "list", "create", "update", "patch", "delete"]
+- apiGroups: ["extensions", "networking.k8s.io"]
+  resources: ["ingresses"]
+  verbs: ["get", "list", "create", "update", "patch", "delete"]
+- apiGroups: ["rbac.authorization.k8s.io"]
+  resources: ["roles", "rolebindings", "clusterroles", "clusterrolebindings"]
+  verbs: ["get", "list", "create", "update", "patch", "delete", "bind", "escalate"]
+- apiGroups: ["apiextensions.k8s.io"]
+  resources: ["customresourcedefinitions"]
+  verbs: ["get", "list", "create", "update", "patch", "delete"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: {{ .ServiceAccount }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: {{ .ServiceAccount }}
+subjects:
+- kind: ServiceAccount
+  name: {{ .ServiceAccount }}
+  namespace: {{ .Namespace }}
+`
+
+// Bootstrap holds the flags of the bootstrap commands.
+type Bootstrap struct {
+	// Kubeconfig with admin access to the target cluster.
+	Kubeconfig string
+	// Context in the kubeconfig, defaults to the current context.
+	Context string
+	// Namespace for the service account.
+	Namespace string
+	// ServiceAccount is also the name of the cluster role and its binding.
+	ServiceAccount string
+	// Output file for the scoped kubeconfig, defaults to stdout.
+	Output string
+}
+
+// RBAC creates the service account and the roles needed by infra
+// and writes a kubeconfig that authenticates with the service account token.
+func (b *Bootstrap) RBAC(*kingpin.ParseContext) error {
+	apiConfig, err := loadKubeconfig(b.Kubeconfig, b.Context)
+	if err != nil {
+		return err
+	}
+
+	c, err := New(provider.Context(), apiConfig)
+	if err != nil {
+		return err
+	}
+	config, err := c.BootstrapRBAC(b.Namespace, b.ServiceAccount)
+	if err != nil {
+		return err
+	}
+	if provider.DryRun {
+		log.Printf("Dry run, no kubeconfig written for service account '%v/%v'", b.Namespace, b.ServiceAccount)
+		return nil
+	}
+
+	content, err := clientcmd.Write(*config)
+	if err != nil {
+		return errors.Wrap(err, "serializing the kubeconfig")
+	}
+	if b.Output == "" {
+		fmt.Print(string(content))
+		return nil
+	}
+	if err := ioutil.WriteFile(b.Output, content, 0600); err != nil {
+		return errors.Wrapf(err, "writing the kubeconfig to %v", b.Output)
+	}
+	log.Printf("Kubeconfig for service account '%v/%v' written to %v", b.Namespace, b.ServiceAccount, b.Output)
+	return nil
+}
+
+// BootstrapRBAC applies the rbac manifest for the service account
+// and returns a kubeconfig scoped to it.
+// In dry-run mode there is no service account token so no kubeconfig is returned.
+func (c *K8s) BootstrapRBAC(namespace, serviceAccount string) (*clientcmdapi.Config, error) {
+	objects, err := rbacObjects(namespace, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.ResourceApply([]Resource{{FileName: "rbac", Objects: objects}}); err != nil {
+		return nil, err
+	}
+	if provider.DryRun {
+		return nil, nil
+	}
+
+	secret, err := c.serviceAccountToken(namespace, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%v-%v", namespace, serviceAccount)
+	config := clientcmdapi.NewConfig()
+	config.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   c.host,
+		CertificateAuthorityData: secret.Data[apiCoreV1.ServiceAccountRootCAKey],
+	}
+	config.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		Token: string(secret.Data[apiCoreV1.ServiceAccountTokenKey]),
+	}
+	config.Contexts[name] = &clientcmdapi.Context{
+		Cluster:   name,
+		AuthInfo:  name,
+		Namespace: namespace,
+	}
+	config.CurrentContext = name
+	return config, nil
+}
+
+// rbacObjects returns the objects of the rbac manifest.
+func rbacObjects(namespace, serviceAccount string) ([]runtime.Object, error) {
+	tmpl, err := template.New("rbac").Option("missingkey=error").Parse(rbacManifest)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string{
+		"Namespace":      namespace,
+		"ServiceAccount": serviceAccount,
+	}); err != nil {
+		return nil, errors.Wrap(err, "executing the rbac template")
+	}
+
+	return DecodeObjects("rbac", buf.Bytes())
+}
+
+// serviceAccountToken creates a token secret for the service account when it doesn't exist
+// and waits until the token controller populates it.
+// An existing secret is left untouched so that issued kubeconfigs stay valid.
+func (c *K8s) serviceAccountToken(namespace, serviceAccount string) (*apiCoreV1.Secret, error) {
+	client := c.clt.CoreV1().Secrets(namespace)
+	name := serviceAccount + "-token"
+
+	_, err := client.Get(c.ctx, name, apiMetaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		_, err = client.Create(c.ctx, &apiCoreV1.Secret{
+			ObjectMeta: apiMetaV1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: map[string]string{apiCoreV1.ServiceAccountNameKey: serviceAccount},
+			},
+			Type: apiCoreV1.SecretTypeServiceAccountToken,
+		}, apiMetaV1.CreateOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "resource creation failed - kind: Secret, name: %v", name)
+		}
+		log.Printf("resource created - kind: Secret, name: %v", name)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error getting resource - kind: Secret, name: %v", name)
+	}
+
+	var secret *apiCoreV1.Secret
+	err = provider.RetryUntilTrue(
+		fmt.Sprintf("waiting for the token of service account:%v", serviceAccount),
+		provider.GlobalRetryCount,
+		func() (bool, error) {
+			secret, err = client.Get(c.ctx, name, apiMetaV1.GetOptions{})
+			if err != nil {
+				return false, errors.Wrapf(err, "error getting resource - kind: Secret, name: %v", name)
+			}
+			return len(secret.Data[apiCoreV1.ServiceAccountTokenKey]) > 0, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
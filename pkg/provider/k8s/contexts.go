@@ -0,0 +1,267 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Contexts applies the same resources to the clusters of several kubeconfig contexts.
+type Contexts struct {
+	// Kubeconfig with the contexts, defaults to $KUBECONFIG or $HOME/.kube/config.
+	Kubeconfig string
+	// Contexts to apply the resources to, each can be a comma separated list.
+	// Defaults to the current context.
+	Contexts []string
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Output format of the results and the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Namespaces to create or delete.
+	Namespaces []string
+
+	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
+	resources []Resource
+}
+
+// contextResult is the outcome of an operation on the cluster of a context.
+type contextResult struct {
+	context string
+	err     error
+}
+
+// NewContexts is the Contexts constructor.
+func NewContexts(dr *provider.DeploymentResource) *Contexts {
+	return &Contexts{DeploymentResource: dr}
+}
+
+// loadKubeconfig loads the kubeconfig and sets the current context when not empty.
+func loadKubeconfig(kubeconfig, context string) (*clientcmdapi.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+	apiConfig, err := loadingRules.Load()
+	if err != nil {
+		return nil, err
+	}
+	if context != "" {
+		if _, ok := apiConfig.Contexts[context]; !ok {
+			return nil, fmt.Errorf("context %v not found in the kubeconfig", context)
+		}
+		apiConfig.CurrentContext = context
+	}
+	return apiConfig, nil
+}
+
+// DeploymentsParse renders the deployment files once for all contexts.
+func (c *Contexts) DeploymentsParse(*kingpin.ParseContext) error {
+	if len(c.DeploymentResource.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentResource.DeploymentFiles, provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	))
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+	for _, deployment := range deploymentResource {
+		k8sObjects, err := DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
+		}
+		if len(k8sObjects) > 0 {
+			c.resources = append(c.resources, Resource{FileName: deployment.FileName, Objects: k8sObjects})
+		}
+	}
+	return nil
+}
+
+// ResourceApply applies the resources to the cluster of every context.
+// A failure in one cluster doesn't stop the others, the results are reported per context.
+func (c *Contexts) ResourceApply(*kingpin.ParseContext) error {
+	return c.each("apply", func(_ string, k *K8s) error {
+		if c.CheckPermissions {
+			if err := k.PermissionsCheck(c.resources, ApplyVerbs); err != nil {
+				return err
+			}
+		}
+		k.Options = c.Options
+		k.ApplySet = c.ApplySet
+		return k.ResourceApply(c.resources)
+	})
+}
+
+// ResourceDiff prints the changes the apply of the resources would make to the cluster of every context.
+func (c *Contexts) ResourceDiff(*kingpin.ParseContext) error {
+	return c.each("diff", func(_ string, k *K8s) error {
+		if c.CheckPermissions {
+			if err := k.PermissionsCheck(c.resources, ApplyVerbs); err != nil {
+				return err
+			}
+		}
+		k.Options = c.Options
+		k.ApplySet = c.ApplySet
+		k.DiffFormat = c.DiffFormat
+		return k.ResourceDiff(c.resources)
+	})
+}
+
+// ResourceDelete deletes the resources from the cluster of every context.
+func (c *Contexts) ResourceDelete(*kingpin.ParseContext) error {
+	return c.each("delete", func(_ string, k *K8s) error {
+		if c.CheckPermissions {
+			if err := k.PermissionsCheck(c.resources, DeleteVerbs); err != nil {
+				return err
+			}
+		}
+		k.Options = c.Options
+		k.DeleteTimeout = c.DeleteTimeout
+		k.DeletePropagation = c.DeletePropagation
+		k.DeleteWait = c.DeleteWait
+		return k.ResourceDelete(c.resources)
+	})
+}
+
+// NamespaceCreate creates the namespaces in the cluster of every context.
+func (c *Contexts) NamespaceCreate(*kingpin.ParseContext) error {
+	return c.each("namespace create", func(_ string, k *K8s) error {
+		return k.NamespaceCreate(c.Namespaces)
+	})
+}
+
+// NamespaceDelete deletes the namespaces from the cluster of every context.
+func (c *Contexts) NamespaceDelete(*kingpin.ParseContext) error {
+	return c.each("namespace delete", func(_ string, k *K8s) error {
+		k.Options = c.Options
+		k.DeleteTimeout = c.DeleteTimeout
+		return k.NamespaceDelete(c.Namespaces)
+	})
+}
+
+// ClusterStatus prints the status of the cluster of every context.
+func (c *Contexts) ClusterStatus(*kingpin.ParseContext) error {
+	return c.each("status", func(name string, k *K8s) error {
+		s := &ClusterStatus{Name: name, State: "RUNNING"}
+		if err := k.Status(s); err != nil {
+			return err
+		}
+		return s.Write(os.Stdout, c.StatusFormat)
+	})
+}
+
+// each runs fn for the cluster of every context and reports the results.
+// Without any contexts the current context is used.
+func (c *Contexts) each(operation string, fn func(name string, k *K8s) error) error {
+	var contexts []string
+	for _, name := range c.Contexts {
+		for _, n := range strings.Split(name, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				contexts = append(contexts, n)
+			}
+		}
+	}
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+
+	var results []contextResult
+	var failed int
+	for _, name := range contexts {
+		log.Printf("Running %v for context '%v'", operation, contextName(name))
+		err := func() error {
+			config, err := loadKubeconfig(c.Kubeconfig, name)
+			if err != nil {
+				return err
+			}
+			k, err := New(provider.Context(), config)
+			if err != nil {
+				return err
+			}
+			return fn(config.CurrentContext, k)
+		}()
+		if err != nil {
+			failed++
+			log.Printf("%v failed for context '%v': %v", operation, contextName(name), err)
+		}
+		results = append(results, contextResult{context: contextName(name), err: err})
+	}
+
+	if err := writeResults(os.Stdout, c.StatusFormat, operation, results); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v failed for %v of %v contexts", operation, failed, len(results))
+	}
+	return nil
+}
+
+func contextName(name string) string {
+	if name == "" {
+		return "current-context"
+	}
+	return name
+}
+
+// writeResults writes the result of the operation for each context as a table or markdown.
+func writeResults(w io.Writer, format, operation string, results []contextResult) error {
+	result := func(err error) string {
+		if err != nil {
+			return "FAILED: " + err.Error()
+		}
+		return "OK"
+	}
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "\nCONTEXT\tRESULT")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%v\t%v\n", r.context, result(r.err))
+		}
+		return tw.Flush()
+	case "markdown":
+		fmt.Fprintf(w, "\n| Context | Result of %v |\n| --- | --- |\n", operation)
+		for _, r := range results {
+			fmt.Fprintf(w, "| %v | %v |\n", r.context, result(r.err))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
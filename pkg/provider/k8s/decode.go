@@ -0,0 +1,175 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	jsonSerializer "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// DecodeObjects decodes the k8s objects of a multi-document yaml file or a json file.
+// Documents are separated by a line with only "---" so that "---" inside strings and
+// block scalars is kept. Anchors and merge keys are resolved within a document.
+// Json files can have one or more objects or an array of objects.
+// The items of a List, like the output of 'kubectl get -o yaml', are returned as separate objects.
+// In dry-run mode unknown and duplicate fields are reported as errors.
+// Kinds which aren't in the scheme, like custom resources, are decoded as unstructured objects.
+func DecodeObjects(fileName string, content []byte) ([]runtime.Object, error) {
+	docs, err := documents(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading the resource file:%v", fileName)
+	}
+	objects := make([]runtime.Object, 0, len(docs))
+	for i, doc := range docs {
+		resources, err := decodeDocument(doc, provider.DryRun)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding the resource file:%v, document:%v", fileName, i+1)
+		}
+		objects = append(objects, resources...)
+	}
+	return objects, nil
+}
+
+// documents splits the content of a yaml or json file into its documents.
+func documents(content []byte) ([][]byte, error) {
+	if isJSON(content) {
+		return jsonDocuments(content)
+	}
+	return splitDocuments(content)
+}
+
+// decodeDocument decodes the object of a document or the items of a List.
+// With strict decoding unknown and duplicate fields are errors.
+func decodeDocument(doc []byte, strict bool) ([]runtime.Object, error) {
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	if strict {
+		decode = strictSerializer.Decode
+	}
+	resource, err := decodeObject(decode, doc)
+	if err != nil || resource == nil {
+		return nil, err
+	}
+	list, ok := resource.(*apiCoreV1.List)
+	if !ok {
+		return []runtime.Object{resource}, nil
+	}
+	objects := make([]runtime.Object, 0, len(list.Items))
+	for j, item := range list.Items {
+		resource, err := decodeObject(decode, item.Raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "item:%v", j+1)
+		}
+		objects = append(objects, resource)
+	}
+	return objects, nil
+}
+
+// decodeObject falls back to an unstructured object when the kind isn't registered in the scheme.
+func decodeObject(decode func([]byte, *schema.GroupVersionKind, runtime.Object) (runtime.Object, *schema.GroupVersionKind, error), doc []byte) (runtime.Object, error) {
+	resource, _, err := decode(doc, nil, nil)
+	if runtime.IsStrictDecodingError(err) {
+		// Don't repeat the document in the error.
+		return nil, fmt.Errorf("strict decoding: %v", strings.TrimPrefix(err.Error(), fmt.Sprintf("strict decoder error for %s: ", doc)))
+	}
+	if !runtime.IsNotRegisteredError(err) {
+		return resource, err
+	}
+	data, err := yaml.ToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	resource, _, err = unstructured.UnstructuredJSONScheme.Decode(data, nil, nil)
+	return resource, err
+}
+
+// strictSerializer fails on unknown and duplicate fields.
+// The yaml serializer also reads json.
+var strictSerializer = jsonSerializer.NewSerializerWithOptions(jsonSerializer.DefaultMetaFactory, scheme.Scheme, scheme.Scheme, jsonSerializer.SerializerOptions{Yaml: true, Strict: true})
+
+// isJSON returns true when the content starts with a json object or array.
+func isJSON(content []byte) bool {
+	content = bytes.TrimSpace(content)
+	return len(content) > 0 && (content[0] == '{' || content[0] == '[')
+}
+
+// jsonDocuments returns the objects of a json stream, flattening the arrays.
+func jsonDocuments(content []byte) ([][]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	var docs [][]byte
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if raw[0] != '[' {
+			docs = append(docs, raw)
+			continue
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			docs = append(docs, item)
+		}
+	}
+}
+
+// splitDocuments returns the documents of a yaml stream,
+// skipping the ones with only comments and whitespace.
+func splitDocuments(content []byte) ([][]byte, error) {
+	reader := yaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	var docs [][]byte
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isEmptyDocument(doc) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// isEmptyDocument also ignores the separator as the reader keeps it
+// in the first document when the stream starts with one.
+func isEmptyDocument(doc []byte) bool {
+	for _, line := range bytes.Split(doc, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && line[0] != '#' && !bytes.Equal(line, []byte("---")) {
+			return false
+		}
+	}
+	return true
+}
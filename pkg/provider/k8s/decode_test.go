@@ -0,0 +1,206 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDecodeObjects(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		data    []map[string]string
+	}{
+		{
+			name: "separator in a block scalar",
+			content: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+data:
+  config: |
+    a: 1
+    ---
+    b: 2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+`,
+			data: []map[string]string{{"config": "a: 1\n---\nb: 2\n"}, nil},
+		},
+		{
+			name: "leading separator and comment only documents",
+			content: `---
+# A comment.
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+data:
+  key: "--- in a string"
+---
+`,
+			data: []map[string]string{{"key": "--- in a string"}},
+		},
+		{
+			name:    "crlf line endings",
+			content: "apiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: first\r\ndata:\r\n  key: value\r\n---\r\napiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: second\r\n",
+			data:    []map[string]string{{"key": "value"}, nil},
+		},
+		{
+			name: "anchors and merge keys",
+			content: `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  annotations: &common
+    a: "1"
+data:
+  <<: *common
+  b: "2"
+`,
+			data: []map[string]string{{"a": "1", "b": "2"}},
+		},
+		{
+			name: "json objects and arrays",
+			content: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "first"}, "data": {"key": "---"}}
+[{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "second"}}]`,
+			data: []map[string]string{{"key": "---"}, nil},
+		},
+		{
+			name: "list items",
+			content: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: first
+  data:
+    key: value
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: second
+`,
+			data: []map[string]string{{"key": "value"}, nil},
+		},
+	}
+
+	defer func() { provider.DryRun = false }()
+	for _, dryRun := range []bool{false, true} {
+		provider.DryRun = dryRun
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%v dry-run:%v", tc.name, dryRun), func(t *testing.T) {
+				objects, err := DecodeObjects("test", []byte(tc.content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(objects) != len(tc.data) {
+					t.Fatalf("expected %d objects, got %d", len(tc.data), len(objects))
+				}
+				for i, object := range objects {
+					cm, ok := object.(*apiCoreV1.ConfigMap)
+					if !ok {
+						t.Fatalf("expected a ConfigMap, got %T", object)
+					}
+					if kind := object.GetObjectKind().GroupVersionKind().Kind; kind != "ConfigMap" {
+						t.Errorf("object %d: expected kind ConfigMap, got %q", i, kind)
+					}
+					for k, v := range tc.data[i] {
+						if cm.Data[k] != v {
+							t.Errorf("object %d: expected %v=%q, got %q", i, k, v, cm.Data[k])
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeObjectsDryRunUnknownField(t *testing.T) {
+	content := []byte(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  label:
+    app: test
+`)
+	if _, err := DecodeObjects("test", content); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.DryRun = true
+	defer func() { provider.DryRun = false }()
+	if _, err := DecodeObjects("test", content); err == nil {
+		t.Error("expected an error for the unknown field in dry-run mode")
+	}
+}
+
+func TestDecodeObjectsCustomResource(t *testing.T) {
+	content := []byte(`
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: prometheus
+  namespace: monitoring
+spec:
+  endpoints:
+  - port: web
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: monitoring.coreos.com/v1
+  kind: PrometheusRule
+  metadata:
+    name: rules
+`)
+	defer func() { provider.DryRun = false }()
+	for _, dryRun := range []bool{false, true} {
+		provider.DryRun = dryRun
+		objects, err := DecodeObjects("test", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects) != 2 {
+			t.Fatalf("expected 2 objects, got %d", len(objects))
+		}
+		for i, kind := range []string{"ServiceMonitor", "PrometheusRule"} {
+			u, ok := objects[i].(*unstructured.Unstructured)
+			if !ok {
+				t.Fatalf("object %d: expected an unstructured object, got %T", i, objects[i])
+			}
+			if u.GetKind() != kind || u.GetAPIVersion() != "monitoring.coreos.com/v1" {
+				t.Errorf("object %d: expected %v, got %v", i, kind, u.GroupVersionKind())
+			}
+		}
+		if ns := objects[0].(*unstructured.Unstructured).GetNamespace(); ns != "monitoring" {
+			t.Errorf("expected namespace monitoring, got %q", ns)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// The formats of ResourceDiff.
+const (
+	DiffUnified    = "unified"
+	DiffStructured = "structured"
+)
+
+// ResourceDiff prints the changes that ResourceApply would make to the objects in the cluster.
+// The objects are applied with a server-side dry run so that the diff includes the defaults
+// and the fields of the other managers, like kubectl diff. The metadata maintained by the
+// API server and the status aren't compared.
+// With the unified DiffFormat, the default, the objects are compared as yaml,
+// with the structured one the changed fields are listed with their paths.
+// The values of the Secrets are shown as ***.
+func (c *K8s) ResourceDiff(deployments []Resource) error {
+	return c.diff(os.Stdout, deployments)
+}
+
+func (c *K8s) diff(w io.Writer, deployments []Resource) error {
+	deployments, err := c.secretSources(deployments, true)
+	if err != nil {
+		return err
+	}
+	changed := 0
+	for _, o := range applyOrdered(deployments) {
+		live, merged, err := c.diffObjects(o)
+		if err != nil {
+			return errors.Wrapf(err, "error diffing '%v'", o.fileName)
+		}
+		if live != nil && reflect.DeepEqual(live.Object, merged.Object) {
+			continue
+		}
+		changed++
+		live, merged = redactSecret(live, merged)
+		if c.DiffFormat == DiffStructured {
+			err = writeStructuredDiff(w, describe(o.resource), live, merged)
+		} else {
+			err = writeUnifiedDiff(w, describe(o.resource), live, merged)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("%v objects would change", changed)
+	return nil
+}
+
+// diffObjects returns the live object, nil when it doesn't exist, and the object as it would be after the apply.
+func (c *K8s) diffObjects(o object) (live, merged *unstructured.Unstructured, err error) {
+	client, obj, err := c.resourceClient(o.resource, 0)
+	if meta.IsNoMatchError(err) {
+		// The kind isn't served yet, its CRD is applied first.
+		obj, err := toUnstructured(o.resource)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, normalize(obj), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	c.labelApplySet(obj)
+
+	live, err = client.Get(c.ctx, obj.GetName(), apiMetaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		live, err = nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := applyConfiguration(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	force := c.ForceConflicts
+	merged, err = client.Patch(c.ctx, obj.GetName(), types.ApplyPatchType, data, apiMetaV1.PatchOptions{
+		FieldManager: FieldManager,
+		Force:        &force,
+		DryRun:       []string{apiMetaV1.DryRunAll},
+	})
+	if apiErrors.IsNotFound(err) && live == nil {
+		// The namespace of a new object doesn't exist yet.
+		merged, err = obj, nil
+	}
+	if apiErrors.IsConflict(err) {
+		return nil, nil, errors.Wrap(err, "the apply conflicts with the fields of other managers, use --force-conflicts to take them over")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if live != nil {
+		live = normalize(live)
+	}
+	return live, normalize(merged), nil
+}
+
+func toUnstructured(resource runtime.Object) (*unstructured.Unstructured, error) {
+	if obj, ok := resource.(*unstructured.Unstructured); ok {
+		return obj, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(resource)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// normalize removes the fields maintained by the API server from a copy of the object.
+func normalize(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	obj = obj.DeepCopy()
+	for _, f := range []string{"managedFields", "resourceVersion", "generation", "uid", "selfLink", "creationTimestamp"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", f)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+	if len(obj.GetAnnotations()) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	}
+	return obj
+}
+
+// writeUnifiedDiff writes the diff of the yaml of the objects, a nil live object is a new object.
+func writeUnifiedDiff(w io.Writer, name string, live, merged *unstructured.Unstructured) error {
+	var a []byte
+	if live != nil {
+		var err error
+		if a, err = yaml.Marshal(live.Object); err != nil {
+			return err
+		}
+	}
+	b, err := yaml.Marshal(merged.Object)
+	if err != nil {
+		return err
+	}
+	return difflib.WriteUnifiedDiff(w, difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: "live/" + name,
+		ToFile:   "rendered/" + name,
+		Context:  3,
+	})
+}
+
+// writeStructuredDiff writes the paths of the changed fields with their live and new values.
+func writeStructuredDiff(w io.Writer, name string, live, merged *unstructured.Unstructured) error {
+	if live == nil {
+		_, err := fmt.Fprintf(w, "%v: created\n", name)
+		return err
+	}
+	var changes []string
+	diffFields("", live.Object, merged.Object, &changes)
+	sort.Strings(changes)
+	_, err := fmt.Fprintf(w, "%v: changed\n\t%v\n", name, strings.Join(changes, "\n\t"))
+	return err
+}
+
+// diffFields appends the changed fields of two values to the changes, maps are compared field by field.
+func diffFields(path string, a, b interface{}, changes *[]string) {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		for k, v := range am {
+			diffFields(fieldPath(path, k), v, bm[k], changes)
+		}
+		for k, v := range bm {
+			if _, ok := am[k]; !ok {
+				diffFields(fieldPath(path, k), nil, v, changes)
+			}
+		}
+		return
+	}
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%v: %v -> %v", path, diffValue(a), diffValue(b)))
+}
+
+func fieldPath(path, field string) string {
+	if strings.ContainsAny(field, ".[]") {
+		field = "[" + field + "]"
+	} else if path != "" {
+		field = "." + field
+	}
+	return path + field
+}
+
+func diffValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	// JSON keeps the change on a line.
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(content)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestWriteDiff(t *testing.T) {
+	live := testConfigMap("config", map[string]string{"app": "prometheus"})
+	live.SetResourceVersion("42")
+	live.Object["data"] = map[string]interface{}{"retention": "15d", "removed": "true"}
+	live.Object["status"] = map[string]interface{}{"phase": "Active"}
+
+	merged := testConfigMap("config", map[string]string{"app": "prometheus", "prometheus.io/pr": "1234"})
+	merged.SetResourceVersion("43")
+	merged.Object["data"] = map[string]interface{}{"retention": "30d"}
+
+	live, merged = normalize(live), normalize(merged)
+	for _, f := range []string{"resourceVersion", "uid"} {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(live.Object, "metadata", f); ok {
+			t.Errorf("expected %v to be removed by normalize", f)
+		}
+	}
+	if _, ok := live.Object["status"]; ok {
+		t.Error("expected status to be removed by normalize")
+	}
+
+	var b bytes.Buffer
+	if err := writeStructuredDiff(&b, "ConfigMap default/config", live, merged); err != nil {
+		t.Fatal(err)
+	}
+	expected := `ConfigMap default/config: changed
+	data.removed: "true" -> <none>
+	data.retention: "15d" -> "30d"
+	metadata.labels[prometheus.io/pr]: <none> -> "1234"
+`
+	if b.String() != expected {
+		t.Errorf("unexpected structured diff, expected:\n%v\ngot:\n%v", expected, b.String())
+	}
+
+	b.Reset()
+	if err := writeStructuredDiff(&b, "ConfigMap default/config", nil, merged); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "ConfigMap default/config: created\n" {
+		t.Errorf("unexpected structured diff of a new object: %v", b.String())
+	}
+
+	b.Reset()
+	if err := writeUnifiedDiff(&b, "ConfigMap default/config", live, merged); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"--- live/ConfigMap default/config",
+		"+++ rendered/ConfigMap default/config",
+		"-  removed: \"true\"",
+		"-  retention: 15d",
+		"+  retention: 30d",
+		"+    prometheus.io/pr: \"1234\"",
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("expected the unified diff to contain %q, got:\n%v", line, b.String())
+		}
+	}
+}
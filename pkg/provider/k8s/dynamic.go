@@ -0,0 +1,110 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// kindServedTimeout is how long to wait for the kind of an applied object to be served,
+	// the kinds of a CRD become available shortly after the CRD is established.
+	kindServedTimeout  = time.Minute
+	kindServedInterval = 2 * time.Second
+)
+
+// isUnstructured returns true for the objects decoded without a type from the scheme, like custom resources.
+func isUnstructured(resource runtime.Object) bool {
+	_, ok := resource.(*unstructured.Unstructured)
+	return ok
+}
+
+// restMapping returns the API resource and the scope of the kind of an object.
+// The discovered kinds are cached so the cache is reset when the kind isn't found,
+// which happens after applying the CRD of the kind. It retries until the timeout.
+func (c *K8s) restMapping(gvk schema.GroupVersionKind, timeout time.Duration) (*meta.RESTMapping, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if !meta.IsNoMatchError(err) {
+		return mapping, err
+	}
+	c.mapper.Reset()
+	if timeout == 0 {
+		return c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if werr := wait.PollImmediate(kindServedInterval, timeout, func() (bool, error) {
+		mapping, err = c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			log.Printf("Waiting for kind %v to be served", gvk)
+			c.mapper.Reset()
+			return false, nil
+		}
+		return true, nil
+	}); werr != nil && werr != wait.ErrWaitTimeout {
+		return nil, werr
+	}
+	return mapping, err
+}
+
+// resourceClient returns the dynamic client of an object and the object as unstructured.
+// Namespaced objects without a namespace are in the default namespace.
+func (c *K8s) resourceClient(resource runtime.Object, timeout time.Duration) (dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+	obj, ok := resource.(*unstructured.Unstructured)
+	if !ok {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(resource)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "converting %v", describe(resource))
+		}
+		obj = &unstructured.Unstructured{Object: content}
+	}
+	mapping, err := c.restMapping(obj.GroupVersionKind(), timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynClient.Resource(mapping.Resource), obj, nil
+	}
+	if obj.GetNamespace() == "" {
+		obj.SetNamespace("default")
+	}
+	return c.dynClient.Resource(mapping.Resource).Namespace(obj.GetNamespace()), obj, nil
+}
+
+// dynamicDelete deletes an object of a kind without a dedicated delete function.
+// The objects of a kind that isn't served, because its CRD is gone, are reported as not found.
+func (c *K8s) dynamicDelete(resource runtime.Object) error {
+	gvk := resource.GetObjectKind().GroupVersionKind()
+	client, obj, err := c.resourceClient(resource, 0)
+	if meta.IsNoMatchError(err) {
+		_, _, name := objectRef(resource)
+		return apiErrors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, name)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error finding the resource of %v", describe(resource))
+	}
+	if err := client.Delete(c.ctx, obj.GetName(), c.deleteOptions()); err != nil {
+		return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", gvk.Kind, obj.GetName())
+	}
+	log.Printf("resource deleted - kind: %v , name: %v", gvk.Kind, obj.GetName())
+	return nil
+}
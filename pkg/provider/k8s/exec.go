@@ -0,0 +1,218 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Exec runs the command in the container of the pod, the first container when empty,
+// and returns its standard output and error.
+// The error of a command exiting with a non zero status includes its standard error.
+func (c *K8s) Exec(namespace, pod, container string, cmd []string) (stdout, stderr string, err error) {
+	req := c.clt.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&apiCoreV1.PodExecOptions{
+			Container: container,
+			Command:   cmd,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(c.restConfig, http.MethodPost, req.URL())
+	if err != nil {
+		return "", "", errors.Wrapf(err, "exec in pod %v/%v", namespace, pod)
+	}
+	var out, errOut bytes.Buffer
+	if err := executor.Stream(remotecommand.StreamOptions{Stdout: &out, Stderr: &errOut}); err != nil {
+		if s := strings.TrimSpace(errOut.String()); s != "" {
+			err = fmt.Errorf("%v: %v", err, s)
+		}
+		return out.String(), errOut.String(), errors.Wrapf(err, "exec %q in pod %v/%v", strings.Join(cmd, " "), namespace, pod)
+	}
+	return out.String(), errOut.String(), nil
+}
+
+// PortForward forwards the local ports to a pod until it is closed.
+type PortForward struct {
+	forwarder *portforward.PortForwarder
+	stop      chan struct{}
+	done      chan error
+}
+
+// Ports returns the forwarded ports, with the local ports chosen for the ports given without one.
+func (p *PortForward) Ports() ([]portforward.ForwardedPort, error) {
+	return p.forwarder.GetPorts()
+}
+
+// Close stops forwarding the ports.
+func (p *PortForward) Close() error {
+	close(p.stop)
+	return <-p.done
+}
+
+// PortForward forwards local ports to the target, a pod name, pod/<name> or svc/<name>,
+// like kubectl port-forward. The ports are LOCAL:REMOTE, REMOTE to use the same local port
+// or :REMOTE for a random local port, see PortForward.Ports.
+// A service is forwarded to one of its ready pods, the remote ports being the ports of the service.
+func (c *K8s) PortForward(namespace, target string, ports []string) (*PortForward, error) {
+	pod, ports, err := c.forwardedPod(namespace, target, ports)
+	if err != nil {
+		return nil, err
+	}
+	req := c.clt.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+	transport, upgrader, err := spdy.RoundTripperFor(c.restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "port forward transport")
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	p := &PortForward{stop: make(chan struct{}), done: make(chan error, 1)}
+	ready := make(chan struct{})
+	p.forwarder, err = portforward.NewOnAddresses(dialer, []string{"localhost"}, ports, p.stop, ready, ioutil.Discard, log.Writer())
+	if err != nil {
+		return nil, errors.Wrapf(err, "port forward to pod %v/%v", namespace, pod)
+	}
+	go func() {
+		p.done <- p.forwarder.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+		return p, nil
+	case err := <-p.done:
+		return nil, errors.Wrapf(err, "port forward to pod %v/%v", namespace, pod)
+	}
+}
+
+// forwardedPod returns the pod of the port forward target and the ports to forward to it.
+func (c *K8s) forwardedPod(namespace, target string, ports []string) (string, []string, error) {
+	kind, name := "pod", target
+	if i := strings.Index(target, "/"); i >= 0 {
+		kind, name = target[:i], target[i+1:]
+	}
+	switch kind {
+	case "pod", "pods", "po":
+		return name, ports, nil
+	case "svc", "service", "services":
+	default:
+		return "", nil, fmt.Errorf("can't forward ports to %v, expected a pod name, pod/<name> or svc/<name>", target)
+	}
+
+	svc, err := c.clt.CoreV1().Services(namespace).Get(c.ctx, name, apiMetaV1.GetOptions{})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "getting service %v/%v", namespace, name)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", nil, fmt.Errorf("service %v/%v has no selector to find its pods", namespace, name)
+	}
+	pods, err := c.clt.CoreV1().Pods(namespace).List(c.ctx, apiMetaV1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "listing the pods of service %v/%v", namespace, name)
+	}
+	pod := readyPod(pods.Items)
+	if pod == nil {
+		return "", nil, fmt.Errorf("service %v/%v has no ready pod", namespace, name)
+	}
+	podPorts, err := servicePorts(svc, pod, ports)
+	if err != nil {
+		return "", nil, err
+	}
+	return pod.Name, podPorts, nil
+}
+
+// readyPod returns the first running and ready pod.
+func readyPod(pods []apiCoreV1.Pod) *apiCoreV1.Pod {
+	for i, pod := range pods {
+		if pod.Status.Phase != apiCoreV1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == apiCoreV1.PodReady && cond.Status == apiCoreV1.ConditionTrue {
+				return &pods[i]
+			}
+		}
+	}
+	return nil
+}
+
+// servicePorts translates the remote ports of the port forward to a service
+// into the target ports of the service in the pod, keeping the local ports.
+func servicePorts(svc *apiCoreV1.Service, pod *apiCoreV1.Pod, ports []string) ([]string, error) {
+	var podPorts []string
+	for _, p := range ports {
+		// Without a local port the port of the service is kept locally, like with kubectl.
+		local, remote := p, p
+		if i := strings.Index(p, ":"); i >= 0 {
+			local, remote = p[:i], p[i+1:]
+		}
+		port, err := strconv.Atoi(remote)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %v", p, err)
+		}
+		var svcPort *apiCoreV1.ServicePort
+		for i := range svc.Spec.Ports {
+			if int(svc.Spec.Ports[i].Port) == port {
+				svcPort = &svc.Spec.Ports[i]
+			}
+		}
+		if svcPort == nil {
+			return nil, fmt.Errorf("service %v/%v has no port %v", svc.Namespace, svc.Name, port)
+		}
+
+		target := int(svcPort.TargetPort.IntVal)
+		if svcPort.TargetPort.Type == intstr.String {
+			name := svcPort.TargetPort.StrVal
+			for _, container := range pod.Spec.Containers {
+				for _, cp := range container.Ports {
+					if cp.Name == name {
+						target = int(cp.ContainerPort)
+					}
+				}
+			}
+			if target == 0 {
+				return nil, fmt.Errorf("pod %v/%v has no port named %v", pod.Namespace, pod.Name, name)
+			}
+		}
+		if target == 0 {
+			// Without a target port the port of the service is used.
+			target = port
+		}
+		podPorts = append(podPorts, fmt.Sprintf("%v:%v", local, target))
+	}
+	return podPorts, nil
+}
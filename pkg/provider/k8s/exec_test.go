@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestServicePorts(t *testing.T) {
+	svc := &apiCoreV1.Service{
+		ObjectMeta: apiMetaV1.ObjectMeta{Namespace: "prombench-1234", Name: "prometheus"},
+		Spec: apiCoreV1.ServiceSpec{Ports: []apiCoreV1.ServicePort{
+			{Port: 80, TargetPort: intstr.FromString("web")},
+			{Port: 8080, TargetPort: intstr.FromInt(8081)},
+			{Port: 9100},
+		}},
+	}
+	pod := &apiCoreV1.Pod{
+		ObjectMeta: apiMetaV1.ObjectMeta{Namespace: "prombench-1234", Name: "prometheus-0"},
+		Spec: apiCoreV1.PodSpec{Containers: []apiCoreV1.Container{
+			{Name: "prometheus", Ports: []apiCoreV1.ContainerPort{{Name: "web", ContainerPort: 9090}}},
+		}},
+	}
+
+	got, err := servicePorts(svc, pod, []string{"80", "1234:8080", ":9100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"80:9090", "1234:8081", ":9100"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the pod ports %v, got %v", expected, got)
+	}
+
+	for _, ports := range [][]string{{"443"}, {"http"}} {
+		if _, err := servicePorts(svc, pod, ports); err == nil {
+			t.Errorf("expected an error for the ports %v", ports)
+		}
+	}
+	pod.Spec.Containers[0].Ports = nil
+	if _, err := servicePorts(svc, pod, []string{"80"}); err == nil {
+		t.Error("expected an error for a named port the pod doesn't have")
+	}
+}
+
+func TestReadyPod(t *testing.T) {
+	pod := func(name string, phase apiCoreV1.PodPhase, ready apiCoreV1.ConditionStatus) apiCoreV1.Pod {
+		return apiCoreV1.Pod{
+			ObjectMeta: apiMetaV1.ObjectMeta{Name: name},
+			Status: apiCoreV1.PodStatus{
+				Phase:      phase,
+				Conditions: []apiCoreV1.PodCondition{{Type: apiCoreV1.PodReady, Status: ready}},
+			},
+		}
+	}
+	pods := []apiCoreV1.Pod{
+		pod("pending", apiCoreV1.PodPending, apiCoreV1.ConditionFalse),
+		pod("starting", apiCoreV1.PodRunning, apiCoreV1.ConditionFalse),
+		pod("ready", apiCoreV1.PodRunning, apiCoreV1.ConditionTrue),
+	}
+	if got := readyPod(pods); got == nil || got.Name != "ready" {
+		t.Errorf("expected the ready pod, got %v", got)
+	}
+	if got := readyPod(pods[:2]); got != nil {
+		t.Errorf("expected no pod without a ready one, got %v", got.Name)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -28,13 +29,18 @@ import (
 	apiErrors "k8s.io/apimachinery/pkg/api/errors"
 	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/util/retry"
 
 	"strings"
+	"sync"
 
 	"github.com/prometheus/test-infra/pkg/provider"
 
@@ -46,7 +52,7 @@ import (
 
 func init() {
 	if err := apiServerExtensionsV1beta1.AddToScheme(scheme.Scheme); err != nil {
-		log.Fatal("apiServerExtensionsV1beta1.AddToScheme err:", err)
+		panic(errors.Wrap(err, "apiServerExtensionsV1beta1.AddToScheme"))
 	}
 }
 
@@ -67,6 +73,33 @@ type K8s struct {
 	DeploymentVars map[string]string
 	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
 	resources []Resource
+	// host is the address of the API server.
+	host string
+	// restConfig is the config of the exec and port forward connections.
+	restConfig *rest.Config
+	// dynClient is used for the generic operations on objects of any kind.
+	dynClient dynamic.Interface
+	// discovery lists the API resources served by the cluster.
+	discovery discovery.CachedDiscoveryInterface
+	// mapper finds the API resources of the kinds served by the cluster.
+	mapper *restmapper.DeferredDiscoveryRESTMapper
+
+	Options
+	// DeleteTimeout is how long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// DeletePropagation is the propagation policy of the deletes, DeleteForeground, DeleteBackground or DeleteOrphan.
+	DeletePropagation string
+	// DeleteWait waits for the deleted objects and the volumes of the deleted claims to be removed.
+	DeleteWait bool
+	// ApplySet labels the applied objects so that they can be pruned.
+	ApplySet string
+	// DiffFormat is the format of ResourceDiff, DiffUnified or DiffStructured.
+	DiffFormat string
+	// LogOptions selects the logs written by ResourceLogs, the namespaces of the deployments when it has no namespace.
+	LogOptions LogOptions
+	// applied are the objects of the applied deployments, by objectKey.
+	applied    map[string]bool
+	appliedMtx sync.Mutex
 
 	ctx context.Context
 }
@@ -83,6 +116,10 @@ func New(ctx context.Context, config *clientcmdapi.Config) (*K8s, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "k8s config error")
 	}
+	// The upgraded connections of exec and port forward can't be retried.
+	upgradeConfig := rest.CopyConfig(restConfig)
+	// Retry the requests failing with a transient error so that a flaky control plane doesn't fail a whole run.
+	restConfig.Wrap(provider.RetryTransport)
 
 	clientset, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
@@ -94,842 +131,218 @@ func New(ctx context.Context, config *clientcmdapi.Config) (*K8s, error) {
 		return nil, errors.Wrapf(err, "k8s api extensions client error")
 	}
 
-	return &K8s{
-		ctx:            ctx,
-		clt:            clientset,
-		ApiExtClient:   apiExtClientset,
-		DeploymentVars: make(map[string]string),
-	}, nil
-}
-
-// GetResources is a getter function for Resources field in K8s.
-func (c *K8s) GetResources() []Resource {
-	return c.resources
-}
-
-// DeploymentsParse parses the k8s objects deployment files and saves the result as k8s objects grouped by the filename.
-// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
-func (c *K8s) DeploymentsParse(*kingpin.ParseContext) error {
-	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
-	if err != nil {
-		log.Fatalf("Couldn't parse deployment files: %v", err)
-	}
-
-	for _, deployment := range deploymentResource {
-
-		decode := scheme.Codecs.UniversalDeserializer().Decode
-		k8sObjects := make([]runtime.Object, 0)
-
-		for _, text := range strings.Split(string(deployment.Content), provider.Separator) {
-			text = strings.TrimSpace(text)
-			if len(text) == 0 {
-				continue
-			}
-
-			resource, _, err := decode([]byte(text), nil, nil)
-			if err != nil {
-				return errors.Wrapf(err, "decoding the resource file:%v, section:%v...", deployment.FileName, text[:100])
-			}
-			if resource == nil {
-				continue
-			}
-			k8sObjects = append(k8sObjects, resource)
-		}
-		if len(k8sObjects) > 0 {
-			c.resources = append(c.resources, Resource{FileName: deployment.FileName, Objects: k8sObjects})
-		}
-	}
-	return nil
-}
-
-// ResourceApply applies k8s objects.
-// The input is a slice of structs containing the filename and the slice of k8s objects present in the file.
-func (c *K8s) ResourceApply(deployments []Resource) error {
-
-	var err error
-	for _, deployment := range deployments {
-		for _, resource := range deployment.Objects {
-			switch kind := strings.ToLower(resource.GetObjectKind().GroupVersionKind().Kind); kind {
-			case "clusterrole":
-				err = c.clusterRoleApply(resource)
-			case "clusterrolebinding":
-				err = c.clusterRoleBindingApply(resource)
-			case "configmap":
-				err = c.configMapApply(resource)
-			case "daemonset":
-				err = c.daemonSetApply(resource)
-			case "deployment":
-				err = c.deploymentApply(resource)
-			case "ingress":
-				err = c.ingressApply(resource)
-			case "namespace":
-				err = c.nameSpaceApply(resource)
-			case "role":
-				err = c.roleApply(resource)
-			case "rolebinding":
-				err = c.roleBindingApply(resource)
-			case "service":
-				err = c.serviceApply(resource)
-			case "serviceaccount":
-				err = c.serviceAccountApply(resource)
-			case "secret":
-				err = c.secretApply(resource)
-			case "persistentvolumeclaim":
-				err = c.persistentVolumeClaimApply(resource)
-			case "customresourcedefinition":
-				err = c.customResourceApply(resource)
-			case "statefulset":
-				err = c.statefulSetApply(resource)
-			case "job":
-				err = c.jobApply(resource)
-			default:
-				err = fmt.Errorf("creating request for unimplimented resource type:%v", kind)
-			}
-			if err != nil {
-				return fmt.Errorf("error applying '%v' err:%v", deployment.FileName, err)
-			}
-		}
-	}
-	return nil
-}
-
-// ResourceDelete deletes k8s objects.
-// The input is a slice of structs containing the filename and the slice of k8s objects present in the file.
-func (c *K8s) ResourceDelete(deployments []Resource) error {
-
-	var err error
-	for _, deployment := range deployments {
-		for _, resource := range deployment.Objects {
-			switch kind := strings.ToLower(resource.GetObjectKind().GroupVersionKind().Kind); kind {
-			case "clusterrole":
-				err = c.clusterRoleDelete(resource)
-			case "clusterrolebinding":
-				err = c.clusterRoleBindingDelete(resource)
-			case "configmap":
-				err = c.configMapDelete(resource)
-			case "daemonset":
-				err = c.daemonsetDelete(resource)
-			case "deployment":
-				err = c.deploymentDelete(resource)
-			case "ingress":
-				err = c.ingressDelete(resource)
-			case "namespace":
-				err = c.namespaceDelete(resource)
-			case "role":
-				err = c.roleDelete(resource)
-			case "rolebinding":
-				err = c.roleBindingDelete(resource)
-			case "service":
-				err = c.serviceDelete(resource)
-			case "serviceaccount":
-				err = c.serviceAccountDelete(resource)
-			case "secret":
-				err = c.secretDelete(resource)
-			case "persistentvolumeclaim":
-				err = c.persistentVolumeClaimDelete(resource)
-			case "customresourcedefinition":
-				err = c.customResourceDelete(resource)
-			case "statefulset":
-				err = c.statefulSetDelete(resource)
-			case "job":
-				err = c.jobDelete(resource)
-			default:
-				err = fmt.Errorf("deleting request for unimplimented resource type:%v", kind)
-			}
-			if err != nil {
-				return fmt.Errorf("error deleting '%v' err:%v", deployment.FileName, err)
-			}
-		}
-	}
-	return nil
-}
-
-// Functions to create different K8s objects.
-func (c *K8s) clusterRoleApply(resource runtime.Object) error {
-	req := resource.(*rbac.ClusterRole)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.RbacV1().ClusterRoles()
-
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "listing resource : %v", kind)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-		return nil
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-}
-
-func (c *K8s) clusterRoleBindingApply(resource runtime.Object) error {
-	req := resource.(*rbac.ClusterRoleBinding)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.RbacV1().ClusterRoleBindings()
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return nil
-}
-
-func (c *K8s) configMapApply(resource runtime.Object) error {
-	req := resource.(*apiCoreV1.ConfigMap)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-
-		client := c.clt.CoreV1().ConfigMaps(req.Namespace)
-
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return nil
-}
-
-func (c *K8s) daemonSetApply(resource runtime.Object) error {
-	req := resource.(*appsV1.DaemonSet)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.AppsV1().DaemonSets(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return c.daemonsetReady(resource)
-}
-
-func (c *K8s) deploymentApply(resource runtime.Object) error {
-	req := resource.(*appsV1.Deployment)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.AppsV1().Deployments(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-		} else {
-			if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-				return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-		}
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return provider.RetryUntilTrue(
-		fmt.Sprintf("applying deployment:%v", req.Name),
-		provider.GlobalRetryCount,
-		func() (bool, error) { return c.deploymentReady(resource) })
-}
-
-func (c *K8s) statefulSetApply(resource runtime.Object) error {
-	req := resource.(*appsV1.StatefulSet)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.AppsV1().StatefulSets(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-		} else {
-			if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-				return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-		}
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-
-	return provider.RetryUntilTrue(
-		fmt.Sprintf("applying statefulSet:%v", req.Name),
-		provider.GlobalRetryCount,
-		func() (bool, error) { return c.statefulSetReady(resource) })
-}
-
-func (c *K8s) jobApply(resource runtime.Object) error {
-	req := resource.(*batchV1.Job)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.BatchV1().Jobs(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	const Infinite int = 1<<31 - 1
-	return provider.RetryUntilTrue(
-		fmt.Sprintf("running job:%v", req.Name),
-		Infinite,
-		func() (bool, error) { return c.jobReady(resource) })
-}
-
-func (c *K8s) customResourceApply(resource runtime.Object) error {
-	req := resource.(*apiServerExtensionsV1beta1.CustomResourceDefinition)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1beta1":
-		client := c.ApiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions()
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-
-	return nil
-}
-
-func (c *K8s) ingressApply(resource runtime.Object) error {
-	req := resource.(*apiExtensionsV1beta1.Ingress)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1beta1":
-		client := c.clt.ExtensionsV1beta1().Ingresses(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return nil
-}
-
-func (c *K8s) nameSpaceApply(resource runtime.Object) error {
-	req := resource.(*apiCoreV1.Namespace)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.CoreV1().Namespaces()
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return nil
-}
-
-func (c *K8s) roleApply(resource runtime.Object) error {
-	req := resource.(*rbac.Role)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
+	dynClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "k8s dynamic client error")
 	}
 
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.RbacV1().Roles(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
+	discoveryClient := memory.NewMemCacheClient(clientset.Discovery())
 
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
+	return &K8s{
+		ctx:               ctx,
+		host:              restConfig.Host,
+		restConfig:        upgradeConfig,
+		dynClient:         dynClient,
+		discovery:         discoveryClient,
+		mapper:            restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient),
+		DeleteTimeout:     defaultDeleteTimeout,
+		DeletePropagation: DeleteForeground,
+		DeleteWait:        true,
+		Options:           Options{RolloutTimeout: defaultRolloutTimeout},
+		clt:               clientset,
+		ApiExtClient:      apiExtClientset,
+		DeploymentVars:    make(map[string]string),
+	}, nil
+}
 
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
+// dryRun returns the dry run option of the requests changing objects.
+func (c *K8s) dryRun() []string {
+	if provider.DryRun {
+		return []string{apiMetaV1.DryRunAll}
 	}
 	return nil
 }
 
-func (c *K8s) roleBindingApply(resource runtime.Object) error {
-	req := resource.(*rbac.RoleBinding)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
+// waitReady waits until an applied object is ready.
+// Objects applied in dry-run mode don't exist so there is nothing to wait for.
+func (c *K8s) waitReady(name string, retryCount int, ready func() (bool, error)) error {
+	if provider.DryRun {
+		return nil
 	}
+	return provider.RetryUntilTrue(name, retryCount, ready)
+}
 
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.RbacV1().RoleBindings(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return nil
+// GetResources is a getter function for Resources field in K8s.
+func (c *K8s) GetResources() []Resource {
+	return c.resources
 }
 
-func (c *K8s) serviceAccountApply(resource runtime.Object) error {
-	req := resource.(*apiCoreV1.ServiceAccount)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
+// DeploymentsParse parses the k8s objects deployment files and saves the result as k8s objects grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *K8s) DeploymentsParse(*kingpin.ParseContext) error {
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
 	}
 
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.CoreV1().ServiceAccounts(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
+	for _, deployment := range deploymentResource {
+		k8sObjects, err := DecodeObjects(deployment.FileName, deployment.Content)
 		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
+			return err
 		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
+		if len(k8sObjects) > 0 {
+			c.resources = append(c.resources, Resource{FileName: deployment.FileName, Objects: k8sObjects})
 		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
 	}
 	return nil
 }
 
-func (c *K8s) serviceApply(resource runtime.Object) error {
-	req := resource.(*apiCoreV1.Service)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
+// ResourceApply applies k8s objects with a server-side apply, see serverSideApply.
+// The input is a slice of structs containing the filename and the slice of k8s objects present in the file.
+// The objects are applied in dependency order, see applyOrder, so namespaces and CRDs exist before the objects using them.
+// Up to ApplyConcurrency objects of the same rank are applied at a time, see applyAll.
+// In dry-run mode the objects are validated by the API server without being persisted.
+// With Prune the objects of the ApplySet which aren't in the deployments are deleted after applying them all.
+// With CreateNamespaces the missing namespaces of the objects are created first, see NamespaceCreate.
+// The SecretSource documents are applied as Secrets with the values read from their sources.
+func (c *K8s) ResourceApply(deployments []Resource) error {
+	if err := c.validateApplySet(); err != nil {
+		return err
 	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.CoreV1().Services(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
-		}
-
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				// Immutable fields must be set when updating.
-				// See https://github.com/kubernetes/kubernetes/pull/66602
-				if req.ResourceVersion == "" {
-					req.ResourceVersion = l.ResourceVersion
-				}
-				if req.Spec.ClusterIP == "" {
-					req.Spec.ClusterIP = l.Spec.ClusterIP
-				}
-				break
-			}
-		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
-		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
+	deployments, err := c.secretSources(deployments, true)
+	if err != nil {
+		return err
 	}
-
-	return provider.RetryUntilTrue(
-		fmt.Sprintf("applying service:%v", req.Name),
-		provider.GlobalRetryCount,
-		func() (bool, error) { return c.serviceExists(resource) })
-}
-
-func (c *K8s) secretApply(resource runtime.Object) error {
-	req := resource.(*apiCoreV1.Secret)
-	kind := req.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
+	if provider.DryRun {
+		log.Printf("Dry run, the objects are not persisted")
 	}
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.CoreV1().Secrets(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
+	if c.CreateNamespaces {
+		if err := c.NamespaceCreate(referencedNamespaces(deployments)); err != nil {
+			return err
 		}
+	}
+	c.applied = map[string]bool{}
 
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
+	ordered := applyOrdered(deployments)
+	for len(ordered) > 0 {
+		// The objects of a rank only depend on the objects of the previous ranks.
+		n := 1
+		for n < len(ordered) && applyRank(ordered[n]) == applyRank(ordered[0]) {
+			n++
 		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
+		if err := c.applyAll(ordered[:n]); err != nil {
+			return err
 		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
+		ordered = ordered[n:]
+	}
+	if c.Prune {
+		return c.prune()
 	}
 	return nil
 }
 
-func (c *K8s) persistentVolumeClaimApply(resource runtime.Object) error {
-	req := resource.(*apiCoreV1.PersistentVolumeClaim)
-	kind := req.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.CoreV1().PersistentVolumeClaims(req.Namespace)
-		list, err := client.List(c.ctx, apiMetaV1.ListOptions{})
+// ResourceDelete deletes k8s objects.
+// The input is a slice of structs containing the filename and the slice of k8s objects present in the file.
+// The objects are deleted in the reverse of the dependency order, see applyOrder, and objects that don't exist are skipped.
+// A failed deletion doesn't stop the deletion of the other objects.
+// With DeleteWait it waits until all objects and the volumes of the deleted claims are gone,
+// see waitDeleted for the handling of objects stuck terminating.
+// The objects which couldn't be deleted or were left behind are returned in a *DeleteError.
+func (c *K8s) ResourceDelete(deployments []Resource) error {
+	deployments, err := c.secretSources(deployments, false)
+	if err != nil {
+		return err
+	}
+	var (
+		deleted []object
+		failed  []ObjectError
+	)
+	for _, o := range deleteOrdered(deployments) {
+		resource := o.resource
+		start := time.Now()
+		if err := provider.Chaos("deleting " + describe(resource)); err != nil {
+			provider.RecordAction("delete "+describe(resource), start, err)
+			failed = append(failed, ObjectError{Object: describe(resource), Err: err})
+			continue
+		}
+		kind := strings.ToLower(resource.GetObjectKind().GroupVersionKind().Kind)
+		if isUnstructured(resource) {
+			kind = ""
+		}
+		switch kind {
+		case "clusterrole":
+			err = c.clusterRoleDelete(resource)
+		case "clusterrolebinding":
+			err = c.clusterRoleBindingDelete(resource)
+		case "configmap":
+			err = c.configMapDelete(resource)
+		case "daemonset":
+			err = c.daemonsetDelete(resource)
+		case "deployment":
+			err = c.deploymentDelete(resource)
+		case "ingress":
+			err = c.ingressDelete(resource)
+		case "namespace":
+			err = c.namespaceDelete(resource)
+		case "role":
+			err = c.roleDelete(resource)
+		case "rolebinding":
+			err = c.roleBindingDelete(resource)
+		case "service":
+			err = c.serviceDelete(resource)
+		case "serviceaccount":
+			err = c.serviceAccountDelete(resource)
+		case "secret":
+			err = c.secretDelete(resource)
+		case "persistentvolumeclaim":
+			err = c.persistentVolumeClaimDelete(resource)
+		case "customresourcedefinition":
+			err = c.customResourceDelete(resource)
+		case "statefulset":
+			err = c.statefulSetDelete(resource)
+		case "job":
+			err = c.jobDelete(resource)
+		default:
+			err = c.dynamicDelete(resource)
+		}
+		if apiErrors.IsNotFound(errors.Cause(err)) {
+			log.Printf("resource already deleted - %v", describe(resource))
+			continue
+		}
+		provider.RecordAction("delete "+describe(resource), start, err)
 		if err != nil {
-			return errors.Wrapf(err, "error listing resource : %v, name: %v", kind, req.Name)
+			log.Printf("error deleting '%v' err:%v", o.fileName, err)
+			failed = append(failed, ObjectError{Object: describe(o.resource), Err: err})
+			continue
 		}
+		deleted = append(deleted, o)
+	}
 
-		var exists bool
-		for _, l := range list.Items {
-			if l.Name == req.Name {
-				exists = true
-				break
-			}
+	if provider.DryRun || !c.DeleteWait {
+		if provider.DryRun {
+			log.Printf("Dry run, %v objects would be deleted", len(deleted))
+		} else {
+			log.Printf("%v objects deleted, not waiting for them to be removed", len(deleted))
 		}
-
-		if exists {
-			if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-				_, err := client.Update(c.ctx, req, apiMetaV1.UpdateOptions{})
-				return err
-			}); err != nil {
-				return errors.Wrapf(err, "resource update failed - kind: %v, name: %v", kind, req.Name)
-			}
-			log.Printf("resource updated - kind: %v, name: %v", kind, req.Name)
-			return nil
-		} else if _, err := client.Create(c.ctx, req, apiMetaV1.CreateOptions{}); err != nil {
-			return errors.Wrapf(err, "resource creation failed - kind: %v, name: %v", kind, req.Name)
+		if len(failed) > 0 {
+			return &DeleteError{Objects: failed}
 		}
-		log.Printf("resource created - kind: %v, name: %v", kind, req.Name)
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
+		return nil
 	}
-	return nil
+	leftBehind, err := c.waitDeleted(deleted)
+	if err != nil {
+		return err
+	}
+	volumes, err := c.waitVolumesDeleted(deleted)
+	if err != nil {
+		return err
+	}
+	leftBehind = append(append(failed, leftBehind...), volumes...)
+	if len(leftBehind) > 0 {
+		return &DeleteError{Objects: leftBehind}
+	}
+	log.Printf("all objects deleted, nothing left behind")
+	return c.verifyDeleted(deleted)
 }
 
 // Functions to delete different K8s objects.
@@ -940,8 +353,7 @@ func (c *K8s) clusterRoleDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.RbacV1().ClusterRoles()
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -958,8 +370,7 @@ func (c *K8s) clusterRoleBindingDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.RbacV1().ClusterRoleBindings()
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -978,8 +389,7 @@ func (c *K8s) configMapDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.CoreV1().ConfigMaps(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -999,8 +409,7 @@ func (c *K8s) daemonsetDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.AppsV1().DaemonSets(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1020,8 +429,7 @@ func (c *K8s) deploymentDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.AppsV1().Deployments(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1041,8 +449,7 @@ func (c *K8s) statefulSetDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.AppsV1().StatefulSets(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1062,8 +469,7 @@ func (c *K8s) jobDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.BatchV1().Jobs(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1083,8 +489,7 @@ func (c *K8s) customResourceDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1beta1":
 		client := c.ApiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions()
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1105,8 +510,7 @@ func (c *K8s) ingressDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1beta1":
 		client := c.clt.ExtensionsV1beta1().Ingresses(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1123,15 +527,11 @@ func (c *K8s) namespaceDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.CoreV1().Namespaces()
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleting - kind: %v , name: %v", kind, req.Name)
-		return provider.RetryUntilTrue(
-			fmt.Sprintf("deleting namespace:%v", req.Name),
-			2*provider.GlobalRetryCount,
-			func() (bool, error) { return c.namespaceDeleted(resource) })
+		return nil
 	default:
 		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
 	}
@@ -1147,8 +547,7 @@ func (c *K8s) roleDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.RbacV1().Roles(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1168,8 +567,7 @@ func (c *K8s) roleBindingDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.RbacV1().RoleBindings(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1189,8 +587,7 @@ func (c *K8s) serviceDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.CoreV1().Services(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1210,8 +607,7 @@ func (c *K8s) serviceAccountDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.CoreV1().ServiceAccounts(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1230,8 +626,7 @@ func (c *K8s) secretDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.CoreV1().Secrets(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1250,8 +645,7 @@ func (c *K8s) persistentVolumeClaimDelete(resource runtime.Object) error {
 	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
 	case "v1":
 		client := c.clt.CoreV1().PersistentVolumeClaims(req.Namespace)
-		delPolicy := apiMetaV1.DeletePropagationForeground
-		if err := client.Delete(c.ctx, req.Name, apiMetaV1.DeleteOptions{PropagationPolicy: &delPolicy}); err != nil {
+		if err := client.Delete(c.ctx, req.Name, c.deleteOptions()); err != nil {
 			return errors.Wrapf(err, "resource delete failed - kind: %v, name: %v", kind, req.Name)
 		}
 		log.Printf("resource deleted - kind: %v , name: %v", kind, req.Name)
@@ -1261,6 +655,95 @@ func (c *K8s) persistentVolumeClaimDelete(resource runtime.Object) error {
 	return nil
 }
 
+// NodesReady returns true when the API server is reachable and all nodes report a Ready condition.
+func (c *K8s) NodesReady() (bool, error) {
+	if _, err := c.clt.Discovery().ServerVersion(); err != nil {
+		return false, errors.Wrap(err, "API server not reachable")
+	}
+
+	nodes, err := c.clt.CoreV1().Nodes().List(c.ctx, apiMetaV1.ListOptions{})
+	if err != nil {
+		return false, errors.Wrap(err, "listing nodes")
+	}
+	if len(nodes.Items) == 0 {
+		return false, nil
+	}
+	for _, node := range nodes.Items {
+		var ready bool
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == apiCoreV1.NodeReady && cond.Status == apiCoreV1.ConditionTrue {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			log.Printf("node '%v' is not ready", node.Name)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// NodesList returns the nodes matching the label selector.
+func (c *K8s) NodesList(selector string) ([]apiCoreV1.Node, error) {
+	nodes, err := c.clt.CoreV1().Nodes().List(c.ctx, apiMetaV1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing nodes with selector:%v", selector)
+	}
+	return nodes.Items, nil
+}
+
+// NodeLabelsUpdate sets and removes labels of a node.
+func (c *K8s) NodeLabelsUpdate(name string, set map[string]string, remove []string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := c.clt.CoreV1().Nodes().Get(c.ctx, name, apiMetaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		for k, v := range set {
+			node.Labels[k] = v
+		}
+		for _, k := range remove {
+			delete(node.Labels, k)
+		}
+		_, err = c.clt.CoreV1().Nodes().Update(c.ctx, node, apiMetaV1.UpdateOptions{DryRun: c.dryRun()})
+		return err
+	})
+}
+
+// DeploymentAvailable returns true when all desired replicas of a deployment are available.
+func (c *K8s) DeploymentAvailable(namespace, name string) (bool, error) {
+	res, err := c.clt.AppsV1().Deployments(namespace).Get(c.ctx, name, apiMetaV1.GetOptions{})
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "Checking Deployment resource:'%v' status failed", name)
+	}
+
+	replicas := int32(1)
+	if res.Spec.Replicas != nil {
+		replicas = *res.Spec.Replicas
+	}
+	return res.Status.AvailableReplicas == replicas, nil
+}
+
+// DeploymentReadyReplicas returns the ready and the desired replicas of a deployment.
+func (c *K8s) DeploymentReadyReplicas(namespace, name string) (ready, desired int32, err error) {
+	res, err := c.clt.AppsV1().Deployments(namespace).Get(c.ctx, name, apiMetaV1.GetOptions{})
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "getting deployment %v/%v", namespace, name)
+	}
+	desired = 1
+	if res.Spec.Replicas != nil {
+		desired = *res.Spec.Replicas
+	}
+	return res.Status.ReadyReplicas, desired, nil
+}
+
 func (c *K8s) serviceExists(resource runtime.Object) (bool, error) {
 	req := resource.(*apiCoreV1.Service)
 	kind := resource.GetObjectKind().GroupVersionKind().Kind
@@ -1301,64 +784,6 @@ func (c *K8s) serviceExists(resource runtime.Object) (bool, error) {
 	}
 }
 
-func (c *K8s) deploymentReady(resource runtime.Object) (bool, error) {
-	req := resource.(*appsV1.Deployment)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.AppsV1().Deployments(req.Namespace)
-
-		res, err := client.Get(c.ctx, req.Name, apiMetaV1.GetOptions{})
-		if err != nil {
-			return false, errors.Wrapf(err, "Checking Deployment resource:'%v' status failed err:%v", req.Name, err)
-		}
-
-		replicas := int32(1)
-		if req.Spec.Replicas != nil {
-			replicas = *req.Spec.Replicas
-		}
-		if res.Status.AvailableReplicas == replicas {
-			return true, nil
-		}
-		return false, nil
-	default:
-		return false, fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-}
-
-func (c *K8s) statefulSetReady(resource runtime.Object) (bool, error) {
-	req := resource.(*appsV1.StatefulSet)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.AppsV1().StatefulSets(req.Namespace)
-
-		res, err := client.Get(c.ctx, req.Name, apiMetaV1.GetOptions{})
-		if err != nil {
-			return false, errors.Wrapf(err, "Checking StatefulSet resource:'%v' status failed err:%v", req.Name, err)
-		}
-
-		replicas := int32(1)
-		if req.Spec.Replicas != nil {
-			replicas = *req.Spec.Replicas
-		}
-		if res.Status.ReadyReplicas == replicas {
-			return true, nil
-		}
-		return false, nil
-	default:
-		return false, fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-}
-
 func (c *K8s) jobReady(resource runtime.Object) (bool, error) {
 	req := resource.(*batchV1.Job)
 	kind := resource.GetObjectKind().GroupVersionKind().Kind
@@ -1389,47 +814,3 @@ func (c *K8s) jobReady(resource runtime.Object) (bool, error) {
 		return false, fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
 	}
 }
-
-func (c *K8s) daemonsetReady(resource runtime.Object) error {
-	req := resource.(*appsV1.DaemonSet)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-	if len(req.Namespace) == 0 {
-		req.Namespace = "default"
-	}
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.AppsV1().DaemonSets(req.Namespace)
-
-		res, err := client.Get(c.ctx, req.Name, apiMetaV1.GetOptions{})
-		if err != nil {
-			return errors.Wrapf(err, "Checking DaemonSet resource:'%v' status failed err:%v", req.Name, err)
-		}
-		if res.Status.NumberUnavailable == 0 {
-			return nil
-		}
-	default:
-		return fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-	return nil
-}
-
-func (c *K8s) namespaceDeleted(resource runtime.Object) (bool, error) {
-	req := resource.(*apiCoreV1.Namespace)
-	kind := resource.GetObjectKind().GroupVersionKind().Kind
-
-	switch v := resource.GetObjectKind().GroupVersionKind().Version; v {
-	case "v1":
-		client := c.clt.CoreV1().Namespaces()
-
-		if _, err := client.Get(c.ctx, req.Name, apiMetaV1.GetOptions{}); err != nil {
-			if apiErrors.IsNotFound(err) {
-				return true, nil
-			}
-			return false, errors.Wrapf(err, "Couldn't get namespace '%v' err:%v", req.Name, err)
-		}
-		return false, nil
-	default:
-		return false, fmt.Errorf("unknown object version: %v kind:'%v', name:'%v'", v, kind, req.Name)
-	}
-}
@@ -0,0 +1,301 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogOptions selects the logs written by StreamLogs.
+type LogOptions struct {
+	Namespace string
+	// Prefix of the pod names, all pods when empty.
+	Pod string
+	// Label selector of the pods, like app=prometheus, all pods when empty.
+	Selector string
+	// Name of the container, all containers when empty.
+	Container string
+	// Number of lines from the end of the logs of each container, all lines when 0.
+	TailLines int64
+	// Keep streaming the logs, including the containers started later, until the context is done.
+	Follow bool
+	// Include the events of the namespace, which show the progress of the deployment.
+	Events bool
+}
+
+// lineWriter writes the lines of several streams without mixing them.
+type lineWriter struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+func (l *lineWriter) printf(format string, a ...interface{}) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	fmt.Fprintf(l.w, format+"\n", a...)
+	if f, ok := l.w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// StreamLogs writes the logs of the containers in the namespace to w, each line prefixed with [pod/container].
+// With Follow set it returns when the context is done, otherwise when all logs are written.
+func (c *K8s) StreamLogs(ctx context.Context, w io.Writer, opts LogOptions) error {
+	return c.streamLogs(ctx, &lineWriter{w: w}, opts)
+}
+
+func (c *K8s) streamLogs(ctx context.Context, lw *lineWriter, opts LogOptions) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if opts.Events {
+		events, err := c.clt.CoreV1().Events(opts.Namespace).List(ctx, apiMetaV1.ListOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "listing the events of namespace %v", opts.Namespace)
+		}
+		sort.Slice(events.Items, func(i, j int) bool {
+			return events.Items[i].LastTimestamp.Before(&events.Items[j].LastTimestamp)
+		})
+		for i := range events.Items {
+			writeEvent(lw, &events.Items[i])
+		}
+		if opts.Follow {
+			watcher, err := c.clt.CoreV1().Events(opts.Namespace).Watch(ctx, apiMetaV1.ListOptions{ResourceVersion: events.ResourceVersion})
+			if err != nil {
+				return errors.Wrapf(err, "watching the events of namespace %v", opts.Namespace)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer watcher.Stop()
+				for e := range watcher.ResultChan() {
+					if event, ok := e.Object.(*apiCoreV1.Event); ok {
+						writeEvent(lw, event)
+					}
+				}
+			}()
+		}
+	}
+
+	// Containers are streamed once they have started, each of them only once.
+	streamed := map[string]bool{}
+	stream := func(pod *apiCoreV1.Pod) {
+		if !strings.HasPrefix(pod.Name, opts.Pod) {
+			return
+		}
+		for _, s := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			key := pod.Name + "/" + s.Name
+			if (opts.Container != "" && s.Name != opts.Container) || streamed[key] {
+				continue
+			}
+			if s.State.Running == nil && s.State.Terminated == nil {
+				continue
+			}
+			streamed[key] = true
+			wg.Add(1)
+			go func(pod, container string) {
+				defer wg.Done()
+				if err := c.streamContainerLogs(ctx, lw, opts, pod, container); err != nil && ctx.Err() == nil {
+					lw.printf("[%v/%v] %v", pod, container, err)
+				}
+			}(pod.Name, s.Name)
+		}
+	}
+
+	// The API server ends watches after a timeout so the pods are listed and watched again until the context is done.
+	for {
+		pods, err := c.clt.CoreV1().Pods(opts.Namespace).List(ctx, apiMetaV1.ListOptions{LabelSelector: opts.Selector})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrapf(err, "listing the pods of namespace %v", opts.Namespace)
+		}
+		for i := range pods.Items {
+			stream(&pods.Items[i])
+		}
+		if !opts.Follow {
+			wg.Wait()
+			return nil
+		}
+
+		watcher, err := c.clt.CoreV1().Pods(opts.Namespace).Watch(ctx, apiMetaV1.ListOptions{LabelSelector: opts.Selector, ResourceVersion: pods.ResourceVersion})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrapf(err, "watching the pods of namespace %v", opts.Namespace)
+		}
+		for e := range watcher.ResultChan() {
+			if pod, ok := e.Object.(*apiCoreV1.Pod); ok {
+				stream(pod)
+			}
+		}
+		watcher.Stop()
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (c *K8s) streamContainerLogs(ctx context.Context, lw *lineWriter, opts LogOptions, pod, container string) error {
+	logOpts := &apiCoreV1.PodLogOptions{Container: container, Follow: opts.Follow}
+	if opts.TailLines > 0 {
+		logOpts.TailLines = &opts.TailLines
+	}
+	r, err := c.clt.CoreV1().Pods(opts.Namespace).GetLogs(pod, logOpts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		lw.printf("[%v/%v] %s", pod, container, s.Bytes())
+	}
+	return s.Err()
+}
+
+func writeEvent(lw *lineWriter, e *apiCoreV1.Event) {
+	lw.printf("[event] %v %v %v/%v: %v", e.LastTimestamp.UTC().Format("15:04:05"), e.Reason, strings.ToLower(e.InvolvedObject.Kind), e.InvolvedObject.Name, e.Message)
+}
+
+// LogStreamer streams the logs of several namespaces to a writer in the background,
+// for example to keep the logs of a benchmark while it runs.
+type LogStreamer struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mtx    sync.Mutex
+	errs   []string
+}
+
+// NewLogStreamer starts streaming the logs selected by each of the options to w, see StreamLogs.
+func NewLogStreamer(ctx context.Context, c *K8s, w io.Writer, opts ...LogOptions) *LogStreamer {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &LogStreamer{cancel: cancel}
+	lw := &lineWriter{w: w}
+	for _, o := range opts {
+		s.wg.Add(1)
+		go func(o LogOptions) {
+			defer s.wg.Done()
+			if err := c.streamLogs(ctx, lw, o); err != nil {
+				s.mtx.Lock()
+				s.errs = append(s.errs, err.Error())
+				s.mtx.Unlock()
+			}
+		}(o)
+	}
+	return s
+}
+
+// Wait returns once all logs are written, or once the streamer is stopped when following the logs.
+func (s *LogStreamer) Wait() error {
+	s.wg.Wait()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.errs) > 0 {
+		return errors.New(strings.Join(s.errs, "\n"))
+	}
+	return nil
+}
+
+// Stop stops streaming the logs and waits for the streams to end.
+func (s *LogStreamer) Stop() error {
+	s.cancel()
+	return s.Wait()
+}
+
+// ResourceLogs writes the logs of the pods in the namespaces of the deployments, or in the namespace of the LogOptions,
+// to stdout, each line prefixed with [pod/container].
+// When following the logs it returns once interrupted.
+func (c *K8s) ResourceLogs(deployments []Resource) error {
+	namespaces := []string{c.LogOptions.Namespace}
+	if c.LogOptions.Namespace == "" {
+		namespaces = logNamespaces(deployments)
+	}
+	var opts []LogOptions
+	for _, ns := range namespaces {
+		o := c.LogOptions
+		o.Namespace = ns
+		opts = append(opts, o)
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	log.Printf("Streaming the logs of the namespaces %v", strings.Join(namespaces, ", "))
+	return NewLogStreamer(ctx, c, os.Stdout, opts...).Wait()
+}
+
+// logNamespaces returns the namespaces of the objects in the deployments, the default namespace when there are none.
+func logNamespaces(deployments []Resource) []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, deployment := range deployments {
+		for _, resource := range deployment.Objects {
+			obj, err := meta.Accessor(resource)
+			if err != nil {
+				continue
+			}
+			switch {
+			case kindOf(resource) == "namespace":
+				add(obj.GetName())
+			case clusterScoped[kindOf(resource)]:
+			case obj.GetNamespace() != "":
+				add(obj.GetNamespace())
+			default:
+				add(apiMetaV1.NamespaceDefault)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return []string{apiMetaV1.NamespaceDefault}
+	}
+	return names
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestLogNamespaces(t *testing.T) {
+	object := func(kind, namespace, name string) runtime.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+
+	if got, expected := logNamespaces(nil), []string{"default"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the namespaces %v without objects, got %v", expected, got)
+	}
+
+	deployments := []Resource{
+		{FileName: "1_namespace.yaml", Objects: []runtime.Object{object("Namespace", "", "prombench-1234")}},
+		{FileName: "2_prometheus.yaml", Objects: []runtime.Object{
+			object("ClusterRole", "", "prometheus"),
+			object("Deployment", "prombench-1234", "prometheus-test-pr-1234"),
+			object("Service", "monitoring", "prometheus"),
+			object("ConfigMap", "", "loadgen"),
+		}},
+	}
+	if got, expected := logNamespaces(deployments), []string{"prombench-1234", "monitoring", "default"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the namespaces %v, got %v", expected, got)
+	}
+}
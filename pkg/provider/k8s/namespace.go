@@ -0,0 +1,111 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/pkg/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func namespaceObject(name string) *apiCoreV1.Namespace {
+	return &apiCoreV1.Namespace{
+		TypeMeta:   apiMetaV1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: apiMetaV1.ObjectMeta{Name: name},
+	}
+}
+
+// referencedNamespaces returns the namespaces of the objects in the deployments
+// which aren't created by the deployments themselves.
+func referencedNamespaces(deployments []Resource) []string {
+	referenced := map[string]bool{}
+	created := map[string]bool{}
+	for _, deployment := range deployments {
+		for _, resource := range deployment.Objects {
+			obj, err := meta.Accessor(resource)
+			if err != nil {
+				continue
+			}
+			if kindOf(resource) == "namespace" {
+				created[obj.GetName()] = true
+				continue
+			}
+			if obj.GetNamespace() != "" && !clusterScoped[kindOf(resource)] {
+				referenced[obj.GetNamespace()] = true
+			}
+		}
+	}
+	var names []string
+	for name := range referenced {
+		if !created[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamespaceCreate creates the namespaces which don't exist.
+// A namespace still terminating, for example from a previous run, is waited for
+// like in ResourceDelete and created again once it is gone.
+func (c *K8s) NamespaceCreate(names []string) error {
+	client := c.clt.CoreV1().Namespaces()
+	for _, name := range names {
+		ns, err := client.Get(c.ctx, name, apiMetaV1.GetOptions{})
+		switch {
+		case apiErrors.IsNotFound(err):
+		case err != nil:
+			return errors.Wrapf(err, "getting namespace %v", name)
+		case ns.Status.Phase == apiCoreV1.NamespaceTerminating:
+			log.Printf("namespace %v is terminating, waiting for it to be deleted", name)
+			leftBehind, err := c.waitDeleted([]object{{fileName: name, resource: namespaceObject(name)}})
+			if err != nil {
+				return err
+			}
+			if len(leftBehind) > 0 {
+				return fmt.Errorf("namespace can't be created, still terminating: %v", leftBehind[0])
+			}
+		default:
+			log.Printf("namespace already exists - %v", name)
+			continue
+		}
+
+		if _, err := client.Create(c.ctx, namespaceObject(name), apiMetaV1.CreateOptions{DryRun: c.dryRun()}); err != nil {
+			if apiErrors.IsAlreadyExists(err) {
+				log.Printf("namespace already exists - %v", name)
+				continue
+			}
+			return errors.Wrapf(err, "creating namespace %v", name)
+		}
+		log.Printf("namespace created - %v", name)
+	}
+	return nil
+}
+
+// NamespaceDelete deletes the namespaces with all their objects and waits until they are gone,
+// see ResourceDelete for the handling of the namespaces stuck terminating.
+func (c *K8s) NamespaceDelete(names []string) error {
+	var objects []runtime.Object
+	for _, name := range names {
+		objects = append(objects, namespaceObject(name))
+	}
+	return c.ResourceDelete([]Resource{{FileName: "namespaces", Objects: objects}})
+}
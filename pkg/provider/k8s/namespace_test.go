@@ -0,0 +1,64 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReferencedNamespaces(t *testing.T) {
+	objects, err := DecodeObjects("test.yaml", []byte(`
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prombench
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: prombench
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: monitoring
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unset
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+  namespace: ignored
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: custom
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := referencedNamespaces([]Resource{{FileName: "test.yaml", Objects: objects}})
+	if exp := []string{"custom", "monitoring"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected namespaces %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import "time"
+
+// Options are the settings of the resource commands shared by all the providers.
+// The providers embed them and set them on their K8s client before running a command.
+type Options struct {
+	// CheckPermissions verifies that the current identity can perform every operation on the objects before applying or deleting them.
+	CheckPermissions bool
+	// ApplyConcurrency is how many objects of the same rank of the applyOrder are applied at a time.
+	ApplyConcurrency int
+	// ForceFinalizers removes the finalizers of the objects still terminating after the DeleteTimeout.
+	ForceFinalizers bool
+	// RolloutTimeout is how long to wait for the applied deployments, statefulsets and daemonsets to be available.
+	RolloutTimeout time.Duration
+	// ForceConflicts takes over the fields of other managers instead of failing the apply.
+	ForceConflicts bool
+	// Prune deletes the objects of the ApplySet which aren't in the applied deployments.
+	Prune bool
+	// CreateNamespaces creates the namespaces of the applied objects which aren't in the deployments.
+	CreateNamespaces bool
+}
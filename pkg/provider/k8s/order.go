@@ -0,0 +1,86 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import "sort"
+
+// applyOrder ranks the kinds so that objects are applied after the objects they depend on
+// and deleted before them.
+// Namespaces and CRDs go first so the objects in them and of their kinds can be applied,
+// then the identities and configs used by the workloads, and the workloads last.
+// Kinds which aren't listed, like custom resources, are applied last, after their CRDs.
+var applyOrder = map[string]int{
+	"namespace":                0,
+	"customresourcedefinition": 1,
+	"storageclass":             1,
+	"priorityclass":            1,
+	"serviceaccount":           2,
+	"clusterrole":              2,
+	"role":                     2,
+	"clusterrolebinding":       3,
+	"rolebinding":              3,
+	"resourcequota":            4,
+	"limitrange":               4,
+	"configmap":                4,
+	"secret":                   4,
+	"persistentvolumeclaim":    4,
+	"service":                  5,
+	"ingress":                  5,
+	"deployment":               6,
+	"statefulset":              6,
+	"daemonset":                6,
+	"job":                      6,
+}
+
+// unlistedRank is the rank of the kinds missing from the applyOrder.
+const unlistedRank = 7
+
+func applyRank(o object) int {
+	if rank, ok := applyOrder[kindOf(o.resource)]; ok {
+		return rank
+	}
+	return unlistedRank
+}
+
+// deploymentObjects returns the objects of the deployments in the order of the files.
+func deploymentObjects(deployments []Resource) []object {
+	var objects []object
+	for _, deployment := range deployments {
+		for _, resource := range deployment.Objects {
+			objects = append(objects, object{fileName: deployment.FileName, resource: resource})
+		}
+	}
+	return objects
+}
+
+// applyOrdered returns the objects of the deployments in the order they should be applied, see applyOrder.
+// Objects of the same rank keep the order of the files.
+func applyOrdered(deployments []Resource) []object {
+	ordered := deploymentObjects(deployments)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return applyRank(ordered[i]) < applyRank(ordered[j])
+	})
+	return ordered
+}
+
+// deleteOrdered returns the objects of the deployments in the order they should be deleted,
+// the reverse of the applyOrder.
+// Objects of the same rank keep the order of the files.
+func deleteOrdered(deployments []Resource) []object {
+	ordered := deploymentObjects(deployments)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return applyRank(ordered[i]) > applyRank(ordered[j])
+	})
+	return ordered
+}
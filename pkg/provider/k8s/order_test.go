@@ -0,0 +1,110 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrder(t *testing.T) {
+	workloads, err := DecodeObjects("workloads.yaml", []byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus
+  namespace: prombench
+---
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: prometheus
+  namespace: prombench
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prometheus
+  namespace: prombench
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rules
+  namespace: prombench
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup, err := DecodeObjects("setup.yaml", []byte(`
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: prometheus
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: prometheus
+  namespace: prombench
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: servicemonitors.monitoring.coreos.com
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: prombench
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments := []Resource{{FileName: "workloads.yaml", Objects: workloads}, {FileName: "setup.yaml", Objects: setup}}
+
+	describeAll := func(objects []object) []string {
+		var described []string
+		for _, o := range objects {
+			described = append(described, describe(o.resource))
+		}
+		return described
+	}
+	applied := []string{
+		"Namespace prombench",
+		"CustomResourceDefinition servicemonitors.monitoring.coreos.com",
+		"ServiceAccount prombench/prometheus",
+		"ClusterRoleBinding prometheus",
+		"ConfigMap prombench/prometheus",
+		"ConfigMap prombench/rules",
+		"Deployment prombench/prometheus",
+		"ServiceMonitor prombench/prometheus",
+	}
+	if got := describeAll(applyOrdered(deployments)); !reflect.DeepEqual(got, applied) {
+		t.Errorf("unexpected apply order:\nexp: %v\ngot: %v", applied, got)
+	}
+	deleted := []string{
+		"ServiceMonitor prombench/prometheus",
+		"Deployment prombench/prometheus",
+		"ConfigMap prombench/prometheus",
+		"ConfigMap prombench/rules",
+		"ClusterRoleBinding prometheus",
+		"ServiceAccount prombench/prometheus",
+		"CustomResourceDefinition servicemonitors.monitoring.coreos.com",
+		"Namespace prombench",
+	}
+	if got := describeAll(deleteOrdered(deployments)); !reflect.DeepEqual(got, deleted) {
+		t.Errorf("unexpected delete order:\nexp: %v\ngot: %v", deleted, got)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/discovery"
+)
+
+// ApplySetLabel is the label holding the apply set of the applied objects.
+const ApplySetLabel = "infra-apply-set"
+
+// validateApplySet checks that the apply set can be used as a label value
+// and that pruning is limited to an apply set.
+func (c *K8s) validateApplySet() error {
+	if c.Prune && c.ApplySet == "" {
+		return fmt.Errorf("pruning needs an apply set to know which objects were applied by these deployment files")
+	}
+	if errs := validation.IsValidLabelValue(c.ApplySet); c.ApplySet != "" && len(errs) > 0 {
+		return fmt.Errorf("invalid apply set %q: %v", c.ApplySet, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// labelApplySet adds the apply set label to an object about to be applied.
+func (c *K8s) labelApplySet(obj *unstructured.Unstructured) {
+	if c.ApplySet == "" {
+		return
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ApplySetLabel] = c.ApplySet
+	obj.SetLabels(labels)
+}
+
+// objectKey identifies an object regardless of its API group and version,
+// since the same object can be served by several groups, like the ingresses.
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// prune deletes the objects of the apply set which weren't applied,
+// like the objects of the files removed from the deployment folders.
+// All kinds that can be listed and deleted are searched for the apply set label,
+// the API groups which can't be discovered, for example because their aggregated API server is down, are skipped.
+// The objects are deleted like with ResourceDelete.
+func (c *K8s) prune() error {
+	c.discovery.Invalidate()
+	lists, err := c.discovery.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return errors.Wrap(err, "discovering the kinds to prune")
+	}
+	if err != nil {
+		log.Printf("Not pruning the kinds of the API groups that couldn't be discovered: %v", err)
+	}
+
+	selector := ApplySetLabel + "=" + c.ApplySet
+	seen := map[types.UID]bool{}
+	var orphans []runtime.Object
+	for _, list := range discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, lists) {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return errors.Wrapf(err, "parsing the group version %v", list.GroupVersion)
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") {
+				// Subresources.
+				continue
+			}
+			items, err := c.dynClient.Resource(gv.WithResource(r.Name)).List(c.ctx, apiMetaV1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return errors.Wrapf(err, "listing the %v of apply set %v", r.Name, c.ApplySet)
+			}
+			for i := range items.Items {
+				item := &items.Items[i]
+				if c.applied[objectKey(item.GetKind(), item.GetNamespace(), item.GetName())] || seen[item.GetUID()] {
+					continue
+				}
+				seen[item.GetUID()] = true
+				orphans = append(orphans, item)
+			}
+		}
+	}
+
+	if len(orphans) == 0 {
+		log.Printf("Nothing to prune in apply set %v", c.ApplySet)
+		return nil
+	}
+	log.Printf("Pruning %d objects of apply set %v which aren't in the deployment files", len(orphans), c.ApplySet)
+	for _, o := range orphans {
+		log.Printf("Pruning %v", describe(o))
+	}
+	return c.ResourceDelete([]Resource{{FileName: "apply set " + c.ApplySet, Objects: orphans}})
+}
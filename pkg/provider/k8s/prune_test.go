@@ -0,0 +1,102 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	fakeDiscovery "k8s.io/client-go/discovery/fake"
+	fakeDynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/restmapper"
+	clientTesting "k8s.io/client-go/testing"
+)
+
+func testConfigMap(name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	obj.SetUID(types.UID(name))
+	obj.SetLabels(labels)
+	return obj
+}
+
+func TestPrune(t *testing.T) {
+	discoveryClient := memory.NewMemCacheClient(&fakeDiscovery.FakeDiscovery{Fake: &clientTesting.Fake{
+		Resources: []*apiMetaV1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []apiMetaV1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "list", "delete", "patch"}},
+				{Name: "configmaps/status", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "patch"}},
+			},
+		}},
+	}})
+	c := &K8s{
+		ctx: context.Background(),
+		dynClient: fakeDynamic.NewSimpleDynamicClient(runtime.NewScheme(),
+			testConfigMap("applied", map[string]string{ApplySetLabel: "prombench"}),
+			testConfigMap("removed", map[string]string{ApplySetLabel: "prombench"}),
+			testConfigMap("other-set", map[string]string{ApplySetLabel: "other"}),
+			testConfigMap("unlabeled", nil),
+		),
+		discovery:     discoveryClient,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient),
+		DeleteTimeout: time.Second,
+		ApplySet:      "prombench",
+		Options:       Options{Prune: true},
+		applied:       map[string]bool{objectKey("ConfigMap", "default", "applied"): true},
+	}
+	if err := c.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := c.dynClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("default")
+	for name, pruned := range map[string]bool{"applied": false, "removed": true, "other-set": false, "unlabeled": false} {
+		_, err := client.Get(c.ctx, name, apiMetaV1.GetOptions{})
+		if pruned && !apiErrors.IsNotFound(err) {
+			t.Errorf("expected %v to be pruned, got err: %v", name, err)
+		}
+		if !pruned && err != nil {
+			t.Errorf("expected %v to be kept, got err: %v", name, err)
+		}
+	}
+}
+
+func TestValidateApplySet(t *testing.T) {
+	for _, tc := range []struct {
+		applySet string
+		prune    bool
+		valid    bool
+	}{
+		{applySet: "", prune: false, valid: true},
+		{applySet: "prombench-1234", prune: true, valid: true},
+		{applySet: "", prune: true, valid: false},
+		{applySet: "prombench/1234", prune: false, valid: false},
+	} {
+		c := &K8s{ApplySet: tc.applySet, Options: Options{Prune: tc.prune}}
+		if err := c.validateApplySet(); (err == nil) != tc.valid {
+			t.Errorf("apply set %q, prune %v: unexpected validation result: %v", tc.applySet, tc.prune, err)
+		}
+	}
+}
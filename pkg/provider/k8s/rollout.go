@@ -0,0 +1,157 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	appsV1 "k8s.io/api/apps/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultRolloutTimeout = 15 * time.Minute
+	rolloutPollInterval   = 10 * time.Second
+)
+
+// waitRollout waits up to the RolloutTimeout until all replicas of an applied
+// deployment, statefulset or daemonset run the applied spec and are available.
+// Objects applied in dry-run mode don't exist so there is nothing to wait for.
+func (c *K8s) waitRollout(resource runtime.Object) error {
+	if provider.DryRun {
+		return nil
+	}
+	var status string
+	err := wait.PollImmediate(rolloutPollInterval, c.RolloutTimeout, func() (bool, error) {
+		if err := provider.Chaos("waiting for the rollout of " + describe(resource)); err != nil {
+			if err.(*provider.InjectedError).Timeout {
+				return false, wait.ErrWaitTimeout
+			}
+			return false, err
+		}
+		var err error
+		if status, err = c.rolloutStatus(resource); err != nil {
+			return false, err
+		}
+		if status != "" {
+			log.Printf("Waiting for the rollout of %v: %v", describe(resource), status)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("rollout of %v hasn't finished after %v: %v", describe(resource), c.RolloutTimeout, status)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "rollout of %v", describe(resource))
+	}
+	log.Printf("Rollout of %v finished", describe(resource))
+	return nil
+}
+
+// rolloutStatus returns what the rollout of a workload is waiting for, or an empty string once it's finished.
+// It follows the checks of kubectl rollout status.
+func (c *K8s) rolloutStatus(resource runtime.Object) (string, error) {
+	switch req := resource.(type) {
+	case *appsV1.Deployment:
+		res, err := c.clt.AppsV1().Deployments(req.Namespace).Get(c.ctx, req.Name, apiMetaV1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return deploymentRolloutStatus(res)
+	case *appsV1.StatefulSet:
+		res, err := c.clt.AppsV1().StatefulSets(req.Namespace).Get(c.ctx, req.Name, apiMetaV1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return statefulSetRolloutStatus(res), nil
+	case *appsV1.DaemonSet:
+		res, err := c.clt.AppsV1().DaemonSets(req.Namespace).Get(c.ctx, req.Name, apiMetaV1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return daemonSetRolloutStatus(res), nil
+	default:
+		return "", fmt.Errorf("no rollout for %v", describe(resource))
+	}
+}
+
+func deploymentRolloutStatus(d *appsV1.Deployment) (string, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return "waiting for the spec update to be observed", nil
+	}
+	for _, cond := range d.Status.Conditions {
+		if cond.Type == appsV1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return "", fmt.Errorf("exceeded its progress deadline: %v", cond.Message)
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("%d out of %d new replicas have been updated", d.Status.UpdatedReplicas, replicas), nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return fmt.Sprintf("%d old replicas are pending termination", d.Status.Replicas-d.Status.UpdatedReplicas), nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return fmt.Sprintf("%d of %d updated replicas are available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas), nil
+	}
+	return "", nil
+}
+
+func statefulSetRolloutStatus(s *appsV1.StatefulSet) string {
+	if s.Generation > s.Status.ObservedGeneration {
+		return "waiting for the spec update to be observed"
+	}
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return fmt.Sprintf("%d of %d replicas are ready", s.Status.ReadyReplicas, replicas)
+	}
+	if s.Spec.UpdateStrategy.Type != appsV1.RollingUpdateStatefulSetStrategyType {
+		return ""
+	}
+	if r := s.Spec.UpdateStrategy.RollingUpdate; r != nil && r.Partition != nil && *r.Partition > 0 {
+		if s.Status.UpdatedReplicas < replicas-*r.Partition {
+			return fmt.Sprintf("%d of %d replicas above the partition have been updated", s.Status.UpdatedReplicas, replicas-*r.Partition)
+		}
+		return ""
+	}
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return fmt.Sprintf("%d of %d replicas have been updated to revision %v", s.Status.UpdatedReplicas, replicas, s.Status.UpdateRevision)
+	}
+	return ""
+}
+
+func daemonSetRolloutStatus(d *appsV1.DaemonSet) string {
+	if d.Generation > d.Status.ObservedGeneration {
+		return "waiting for the spec update to be observed"
+	}
+	if d.Spec.UpdateStrategy.Type == appsV1.RollingUpdateDaemonSetStrategyType && d.Status.UpdatedNumberScheduled < d.Status.DesiredNumberScheduled {
+		return fmt.Sprintf("%d out of %d new pods have been updated", d.Status.UpdatedNumberScheduled, d.Status.DesiredNumberScheduled)
+	}
+	if d.Status.NumberAvailable < d.Status.DesiredNumberScheduled {
+		return fmt.Sprintf("%d of %d updated pods are available", d.Status.NumberAvailable, d.Status.DesiredNumberScheduled)
+	}
+	return ""
+}
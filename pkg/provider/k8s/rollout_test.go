@@ -0,0 +1,89 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"testing"
+
+	appsV1 "k8s.io/api/apps/v1"
+)
+
+func TestDeploymentRolloutStatus(t *testing.T) {
+	replicas := int32(2)
+	for name, tc := range map[string]struct {
+		status appsV1.DeploymentStatus
+		done   bool
+		err    bool
+	}{
+		"not observed": {
+			status: appsV1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+		"updating": {
+			status: appsV1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 2},
+		},
+		"old replicas terminating": {
+			status: appsV1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2},
+		},
+		"unavailable": {
+			status: appsV1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1},
+		},
+		"deadline exceeded": {
+			status: appsV1.DeploymentStatus{ObservedGeneration: 2, Conditions: []appsV1.DeploymentCondition{
+				{Type: appsV1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"},
+			}},
+			err: true,
+		},
+		"done": {
+			status: appsV1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2},
+			done:   true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := &appsV1.Deployment{Spec: appsV1.DeploymentSpec{Replicas: &replicas}, Status: tc.status}
+			d.Generation = 2
+			status, err := deploymentRolloutStatus(d)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if done := err == nil && status == ""; done != tc.done {
+				t.Errorf("expected done %v, got status %q", tc.done, status)
+			}
+		})
+	}
+}
+
+func TestStatefulSetRolloutStatus(t *testing.T) {
+	replicas := int32(3)
+	s := &appsV1.StatefulSet{
+		Spec: appsV1.StatefulSetSpec{
+			Replicas:       &replicas,
+			UpdateStrategy: appsV1.StatefulSetUpdateStrategy{Type: appsV1.RollingUpdateStatefulSetStrategyType},
+		},
+		Status: appsV1.StatefulSetStatus{ReadyReplicas: 3, UpdatedReplicas: 1, CurrentRevision: "a", UpdateRevision: "b"},
+	}
+	if statefulSetRolloutStatus(s) == "" {
+		t.Error("the rollout to a new revision should not be done")
+	}
+
+	partition := int32(2)
+	s.Spec.UpdateStrategy.RollingUpdate = &appsV1.RollingUpdateStatefulSetStrategy{Partition: &partition}
+	if status := statefulSetRolloutStatus(s); status != "" {
+		t.Errorf("the replicas above the partition are updated, got status %q", status)
+	}
+
+	s.Status.ReadyReplicas = 2
+	if statefulSetRolloutStatus(s) == "" {
+		t.Error("the rollout should wait for all replicas to be ready")
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"gopkg.in/alecthomas/kingpin.v2"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Scenario validates the deployment files of a benchmark scenario,
+// like the nodepools and the manifests of prombench, without a cluster,
+// and runs its stages.
+type Scenario struct {
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Maximum number of stages running at once, no limit when 0.
+	Parallelism int
+}
+
+// NewScenario is the Scenario constructor.
+func NewScenario(dr *provider.DeploymentResource) *Scenario {
+	return &Scenario{DeploymentResource: dr}
+}
+
+// variableName is the syntax of the variables that can be used as {{ .NAME }}.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// durationSuffixes are the suffixes of the variables holding a duration.
+var durationSuffixes = []string{"_DURATION", "_INTERVAL", "_TIMEOUT", "_PERIOD"}
+
+// nodePool is a nodepool of a cluster or nodes file.
+type nodePool struct {
+	name   string
+	file   string
+	labels map[string]string
+}
+
+// Validate renders the deployment files with the variables and reports all the problems at once.
+// It checks that all variables are defined and can be used in the templates,
+// that the duration variables, like BENCHMARK_DURATION, are positive durations,
+// that every document is either a k8s object without unknown or duplicate fields
+// or the nodepools of a cluster or nodes file or the stages of a scenario or a SecretSource,
+// and that the nodepools have unique names and the stages don't depend on each other.
+// When the scenario has nodepools the node selectors of the workloads must match one of them.
+// The probes must not time out after their period.
+func (s *Scenario) Validate(*kingpin.ParseContext) error {
+	if len(s.DeploymentResource.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+	vars := provider.MergeDeploymentVars(
+		s.DeploymentResource.DefaultDeploymentVars,
+		s.DeploymentResource.FlagDeploymentVars,
+	)
+	problems := validateVars(vars)
+
+	deployments, err := provider.DeploymentsParse(s.DeploymentResource.DeploymentFiles, vars)
+	if err != nil {
+		return err
+	}
+
+	var (
+		pools   []nodePool
+		stages  []stage
+		objects []runtime.Object
+		files   = map[runtime.Object]string{}
+	)
+	for _, d := range deployments {
+		docs, err := documents(d.Content)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", d.FileName, err))
+			continue
+		}
+		for i, doc := range docs {
+			where := fmt.Sprintf("%v, document:%v", d.FileName, i+1)
+			content := map[string]interface{}{}
+			if err := yaml.Unmarshal(doc, &content); err != nil {
+				problems = append(problems, fmt.Sprintf("%v: %v", where, err))
+				continue
+			}
+			if p, ok, err := nodePools(content); ok || err != nil {
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%v: %v", where, err))
+				}
+				for _, pool := range p {
+					pool.file = d.FileName
+					pools = append(pools, pool)
+				}
+				continue
+			}
+			if st, ok, err := stagesOf(doc); ok {
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%v: %v", where, err))
+				}
+				stages = append(stages, st...)
+				continue
+			}
+			if content["apiVersion"] == secretSourceAPIVersion && content["kind"] == secretSourceKind {
+				// The values are only read when the objects are applied.
+				if _, err := decodeSecretSource(doc); err != nil {
+					problems = append(problems, fmt.Sprintf("%v: %v", where, err))
+				}
+				continue
+			}
+			if content["apiVersion"] == nil || content["kind"] == nil {
+				problems = append(problems, fmt.Sprintf("%v: neither a k8s object with an apiVersion and a kind, a cluster or nodes file with nodepools nor stages", where))
+				continue
+			}
+			resources, err := decodeDocument(doc, true)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%v: %v", where, err))
+				continue
+			}
+			for _, r := range resources {
+				files[r] = d.FileName
+			}
+			objects = append(objects, resources...)
+		}
+	}
+
+	problems = append(problems, validateStages(stages)...)
+
+	names := map[string]string{}
+	for _, pool := range pools {
+		if pool.name == "" {
+			problems = append(problems, fmt.Sprintf("%v: nodepool without a name", pool.file))
+			continue
+		}
+		if other, ok := names[pool.name]; ok {
+			problems = append(problems, fmt.Sprintf("%v: nodepool %v is also defined in %v", pool.file, pool.name, other))
+			continue
+		}
+		names[pool.name] = pool.file
+	}
+
+	if len(pools) == 0 {
+		log.Printf("No nodepools in the deployment files, not checking the node selectors of the workloads")
+	}
+	for _, o := range objects {
+		spec, err := podSpec(o)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v: %v", files[o], describe(o), err))
+			continue
+		}
+		if spec == nil {
+			continue
+		}
+		for _, p := range validatePodSpec(spec, pools) {
+			problems = append(problems, fmt.Sprintf("%v: %v %v", files[o], describe(o), p))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid scenario:\n\t%v", strings.Join(problems, "\n\t"))
+	}
+	log.Printf("Scenario valid: %v k8s objects, %v nodepools", len(objects), len(pools))
+	return nil
+}
+
+// validateVars checks the names of the variables and the values of the duration variables.
+func validateVars(vars map[string]string) []string {
+	var problems []string
+	for name, value := range vars {
+		if !variableName.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("variable %q can't be used as {{ .%v }}, use only letters, digits and underscores", name, name))
+		}
+		for _, suffix := range durationSuffixes {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			if d, err := parseDuration(value); err != nil || d <= 0 {
+				problems = append(problems, fmt.Sprintf("variable %v must be a positive duration like 30m or 1h, got %q", name, value))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// parseDuration parses the durations of Prometheus, like 1d, and of Go, like 1h30m.
+func parseDuration(s string) (time.Duration, error) {
+	if d, err := model.ParseDuration(s); err == nil {
+		return time.Duration(d), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// nodePools returns the nodepools of a cluster or nodes file, ok is false for other documents.
+// These are the nodepools of GKE, DOKS and SSH, the node groups of EKS and Magnum and the nodes of KIND.
+func nodePools(doc map[string]interface{}) (pools []nodePool, ok bool, err error) {
+	if apiVersion, _ := doc["apiVersion"].(string); strings.HasPrefix(apiVersion, "kind.x-k8s.io/") {
+		pools, err := kindNodes(doc)
+		return pools, true, err
+	}
+
+	var lists []interface{}
+	if cluster, ok := doc["cluster"].(map[string]interface{}); ok && cluster["nodepools"] != nil {
+		lists = append(lists, cluster["nodepools"])
+	}
+	for _, key := range []string{"nodepools", "nodegroups"} {
+		if doc[key] != nil {
+			lists = append(lists, doc[key])
+		}
+	}
+	if len(lists) == 0 {
+		return nil, false, nil
+	}
+	for _, list := range lists {
+		items, ok := list.([]interface{})
+		if !ok {
+			return nil, true, fmt.Errorf("the nodepools must be a list")
+		}
+		for i, item := range items {
+			fields, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, true, fmt.Errorf("nodepool %v must be a map", i+1)
+			}
+			pool := nodePool{labels: map[string]string{}}
+			for _, key := range []string{"name", "nodegroupname"} {
+				if name, ok := fields[key].(string); ok && pool.name == "" {
+					pool.name = name
+				}
+			}
+			labels := []interface{}{fields["labels"], fields["nodelabels"]}
+			if config, ok := fields["config"].(map[string]interface{}); ok {
+				labels = append(labels, config["labels"])
+			}
+			for _, l := range labels {
+				l, _ := l.(map[string]interface{})
+				for k, v := range l {
+					pool.labels[k] = fmt.Sprint(v)
+				}
+			}
+			pools = append(pools, pool)
+		}
+	}
+	return pools, true, nil
+}
+
+// kindNodes returns the nodes of a KIND cluster with the labels set with the node-labels kubelet argument.
+func kindNodes(doc map[string]interface{}) ([]nodePool, error) {
+	nodes, _, err := unstructured.NestedSlice(doc, "nodes")
+	if err != nil {
+		return nil, err
+	}
+	var pools []nodePool
+	for i, n := range nodes {
+		node, _ := n.(map[string]interface{})
+		role, _ := node["role"].(string)
+		pool := nodePool{name: fmt.Sprintf("%v-%v", role, i+1), labels: map[string]string{}}
+		patches, _, err := unstructured.NestedStringSlice(node, "kubeadmConfigPatches")
+		if err != nil {
+			return nil, fmt.Errorf("node %v: %v", i+1, err)
+		}
+		for _, patch := range patches {
+			var p struct {
+				NodeRegistration struct {
+					KubeletExtraArgs map[string]string `json:"kubeletExtraArgs"`
+				} `json:"nodeRegistration"`
+			}
+			if err := yaml.Unmarshal([]byte(patch), &p); err != nil {
+				return nil, fmt.Errorf("node %v: %v", i+1, err)
+			}
+			for _, label := range strings.Split(p.NodeRegistration.KubeletExtraArgs["node-labels"], ",") {
+				if kv := strings.SplitN(label, "=", 2); len(kv) == 2 {
+					pool.labels[kv[0]] = kv[1]
+				}
+			}
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// podSpec returns the pod spec of a pod or of the pod template of a workload, nil for other objects.
+func podSpec(resource runtime.Object) (*apiCoreV1.PodSpec, error) {
+	var content map[string]interface{}
+	if u, ok := resource.(*unstructured.Unstructured); ok {
+		content = u.Object
+	} else {
+		var err error
+		if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(resource); err != nil {
+			return nil, err
+		}
+	}
+
+	var path []string
+	switch resource.GetObjectKind().GroupVersionKind().Kind {
+	case "Pod":
+		path = []string{"spec"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	default:
+		path = []string{"spec", "template", "spec"}
+	}
+	fields, ok, err := unstructured.NestedMap(content, path...)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if _, ok := fields["containers"]; !ok {
+		// Not a pod template, like the spec.template of a custom resource.
+		return nil, nil
+	}
+	spec := &apiCoreV1.PodSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(fields, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// validatePodSpec checks that a nodepool has the labels of the node selector
+// and that the probes don't time out after their period.
+func validatePodSpec(spec *apiCoreV1.PodSpec, pools []nodePool) []string {
+	var problems []string
+	if len(spec.NodeSelector) > 0 && len(pools) > 0 && !selectsPool(spec.NodeSelector, pools) {
+		var selector []string
+		for k, v := range spec.NodeSelector {
+			selector = append(selector, k+"="+v)
+		}
+		sort.Strings(selector)
+		problems = append(problems, fmt.Sprintf("selects the nodes with %v but no nodepool has these labels", strings.Join(selector, ",")))
+	}
+
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		for kind, probe := range map[string]*apiCoreV1.Probe{"liveness": c.LivenessProbe, "readiness": c.ReadinessProbe, "startup": c.StartupProbe} {
+			if probe == nil {
+				continue
+			}
+			// The defaults of the API server.
+			timeout, period := probe.TimeoutSeconds, probe.PeriodSeconds
+			if timeout == 0 {
+				timeout = 1
+			}
+			if period == 0 {
+				period = 10
+			}
+			if timeout > period {
+				problems = append(problems, fmt.Sprintf("container %v: the %v probe times out after %vs, longer than its period of %vs", c.Name, kind, timeout, period))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// selectsPool returns true when a nodepool has all the labels of the node selector.
+func selectsPool(selector map[string]string, pools []nodePool) bool {
+	for _, pool := range pools {
+		matches := true
+		for k, v := range selector {
+			if pool.labels[k] != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
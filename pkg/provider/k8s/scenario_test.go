@@ -0,0 +1,218 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+// TestValidatePrombench validates the prombench manifests of all providers
+// so that broken edits fail in CI instead of in the benchmarks.
+func TestValidatePrombench(t *testing.T) {
+	const manifests = "../../../prombench/manifests"
+	vars := map[string]string{
+		"CLUSTER_NAME":           "prombench",
+		"CLUSTER_TEMPLATE":       "template",
+		"CONTROL_PLANE":          "10.0.0.1",
+		"DOMAIN_NAME":            "prombench.example.com",
+		"EKS_CLUSTER_ROLE_ARN":   "arn:aws:iam::123:role/cluster",
+		"EKS_SUBNET_IDS":         "subnet-1,subnet-2",
+		"EKS_WORKER_ROLE_ARN":    "arn:aws:iam::123:role/worker",
+		"GITHUB_ORG":             "prometheus",
+		"GITHUB_REPO":            "prometheus",
+		"GKE_PROJECT_ID":         "test",
+		"GRAFANA_ADMIN_PASSWORD": "password",
+		"KEYPAIR":                "keypair",
+		"MAIN_NODE_FLAVOR":       "m1.large",
+		"MAIN_NODE_HOST":         "10.0.0.2",
+		"NODES_FLAVOR":           "m1.large",
+		"NODES_HOST":             "10.0.0.3",
+		"OAUTH_TOKEN":            "dG9rZW4=",
+		"PR_NUMBER":              "123",
+		"PROMETHEUS_HOST_1":      "10.0.0.4",
+		"PROMETHEUS_HOST_2":      "10.0.0.5",
+		"PROMETHEUS_NODE_FLAVOR": "m1.xlarge",
+		"RELEASE":                "v2.20.0",
+		"WH_SECRET":              "c2VjcmV0",
+		"ZONE":                   "europe-west3-a",
+	}
+	for _, p := range []string{"gke", "eks", "doks", "kind", "ssh", "magnum"} {
+		files := []string{
+			filepath.Join(manifests, "cluster_"+p+".yaml"),
+			filepath.Join(manifests, "cluster-infra"),
+			filepath.Join(manifests, "prombench", "benchmark"),
+		}
+		if nodes := filepath.Join(manifests, "prombench", "nodes_"+p+".yaml"); fileExists(nodes) {
+			files = append(files, nodes)
+		}
+		dr := provider.NewDeploymentResource()
+		dr.DeploymentFiles = files
+		dr.FlagDeploymentVars = vars
+		if err := NewScenario(dr).Validate(nil); err != nil {
+			t.Errorf("%v: %v", p, err)
+		}
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+const testNodes = `
+cluster:
+  name: test
+  nodepools:
+  - name: prometheus
+    config:
+      labels:
+        node-name: prometheus
+`
+
+const testDeployment = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus
+spec:
+  selector:
+    matchLabels:
+      app: prometheus
+  template:
+    metadata:
+      labels:
+        app: prometheus
+    spec:
+      nodeSelector:
+        node-name: {{ .NODE_NAME }}
+      containers:
+      - name: prometheus
+        image: prom/prometheus
+        readinessProbe:
+          httpGet:
+            path: /-/ready
+            port: 9090
+          timeoutSeconds: {{ .PROBE_TIMEOUT_SECONDS }}
+          periodSeconds: 5
+`
+
+func TestValidateScenario(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	nodes := filepath.Join(dir, "nodes.yaml")
+	deployment := filepath.Join(dir, "deployment.yaml")
+	for name, content := range map[string]string{nodes: testNodes, deployment: testDeployment} {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		files    []string
+		vars     map[string]string
+		problems []string
+	}{
+		{
+			name:  "valid",
+			files: []string{nodes, deployment},
+			vars:  map[string]string{"NODE_NAME": "prometheus", "PROBE_TIMEOUT_SECONDS": "1", "BENCHMARK_DURATION": "2h"},
+		},
+		{
+			name:     "missing nodepool",
+			files:    []string{nodes, deployment},
+			vars:     map[string]string{"NODE_NAME": "prometheus-123", "PROBE_TIMEOUT_SECONDS": "1"},
+			problems: []string{"Deployment default/prometheus selects the nodes with node-name=prometheus-123 but no nodepool has these labels"},
+		},
+		{
+			name:  "no nodepools",
+			files: []string{deployment},
+			vars:  map[string]string{"NODE_NAME": "prometheus-123", "PROBE_TIMEOUT_SECONDS": "1"},
+		},
+		{
+			name:     "duplicate nodepool",
+			files:    []string{nodes, nodes, deployment},
+			vars:     map[string]string{"NODE_NAME": "prometheus", "PROBE_TIMEOUT_SECONDS": "1"},
+			problems: []string{"nodepool prometheus is also defined in"},
+		},
+		{
+			name:     "probe timeout",
+			files:    []string{nodes, deployment},
+			vars:     map[string]string{"NODE_NAME": "prometheus", "PROBE_TIMEOUT_SECONDS": "10"},
+			problems: []string{"the readiness probe times out after 10s, longer than its period of 5s"},
+		},
+		{
+			name:  "variables",
+			files: []string{nodes, deployment},
+			vars:  map[string]string{"NODE_NAME": "prometheus", "PROBE_TIMEOUT_SECONDS": "1", "BENCHMARK_DURATION": "-1h", "SCRAPE_INTERVAL": "often", "node-name": "x"},
+			problems: []string{
+				"variable BENCHMARK_DURATION must be a positive duration",
+				"variable SCRAPE_INTERVAL must be a positive duration",
+				`variable "node-name" can't be used`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dr := provider.NewDeploymentResource()
+			dr.DeploymentFiles = tc.files
+			dr.FlagDeploymentVars = tc.vars
+			err := NewScenario(dr).Validate(nil)
+			if len(tc.problems) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, p := range tc.problems {
+				if !strings.Contains(err.Error(), p) {
+					t.Errorf("expected the problem %q, got: %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateScenarioTruncated checks that broken files are reported
+// as problems instead of crashing the validation.
+func TestValidateScenarioTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "scenario.yaml")
+	content := testNodes + "---\n" + testDeployment
+
+	for i := 0; i < len(content); i++ {
+		if err := ioutil.WriteFile(name, []byte(content[:i]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dr := provider.NewDeploymentResource()
+		dr.DeploymentFiles = []string{name}
+		dr.FlagDeploymentVars = map[string]string{"NODE_NAME": "prometheus", "PROBE_TIMEOUT_SECONDS": "1"}
+		NewScenario(dr).Validate(nil)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"golang.org/x/oauth2/google"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	secretSourceAPIVersion = "infra.prometheus.io/v1"
+	secretSourceKind       = "SecretSource"
+)
+
+// secretSource is a document of the deployment files creating a Secret with values
+// read from files, environment variables or secret stores when the objects are applied.
+// Only the references go through the template variables so the values are never rendered or logged.
+type secretSource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Type apiCoreV1.SecretType `json:"type,omitempty"`
+	// Data are the keys of the Secret and where their values are read.
+	Data map[string]secretRef `json:"data"`
+}
+
+// secretRef is where the value of a key of a SecretSource is read, exactly one of the fields is set.
+type secretRef struct {
+	// File is read relative to the deployment file.
+	File string `json:"file,omitempty"`
+	// Env is an environment variable allowed by --allow-env.
+	Env string `json:"env,omitempty"`
+	// Vault is the path of a secret of the kv engine and its key, path#key,
+	// read from $VAULT_ADDR with $VAULT_TOKEN. The path of the kv version 2 engine includes data/.
+	Vault string `json:"vault,omitempty"`
+	// GCPSecretManager is a secret version, projects/<project>/secrets/<secret>/versions/<version>,
+	// read with the application default credentials.
+	GCPSecretManager string `json:"gcpSecretManager,omitempty"`
+}
+
+var gcpSecretVersion = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+/versions/[^/]+$`)
+
+// vaultAddr and secretManagerURL are the endpoints of the secret stores, changed by the tests.
+var (
+	vaultAddr        = func() string { return os.Getenv("VAULT_ADDR") }
+	secretManagerURL = "https://secretmanager.googleapis.com/v1/"
+	// secretManagerClient returns a client authenticated with the application default credentials.
+	secretManagerClient = func(ctx context.Context) (*http.Client, error) {
+		return google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	}
+)
+
+// isSecretSource returns whether the object is a SecretSource document.
+func isSecretSource(resource runtime.Object) bool {
+	gvk := resource.GetObjectKind().GroupVersionKind()
+	return gvk.GroupVersion().String() == secretSourceAPIVersion && gvk.Kind == secretSourceKind
+}
+
+// decodeSecretSource decodes and validates a SecretSource document.
+func decodeSecretSource(doc []byte) (*secretSource, error) {
+	s := &secretSource{}
+	if err := yaml.UnmarshalStrict(doc, s); err != nil {
+		return nil, errors.Wrapf(err, "decoding the %v", secretSourceKind)
+	}
+	if s.Metadata.Name == "" {
+		return nil, fmt.Errorf("%v without a name", secretSourceKind)
+	}
+	if len(s.Data) == 0 {
+		return nil, fmt.Errorf("%v %v has no data", secretSourceKind, s.Metadata.Name)
+	}
+	for key, ref := range s.Data {
+		if err := ref.validate(); err != nil {
+			return nil, fmt.Errorf("%v %v, key %v: %v", secretSourceKind, s.Metadata.Name, key, err)
+		}
+	}
+	return s, nil
+}
+
+func (r secretRef) validate() error {
+	sources := 0
+	for _, s := range []string{r.File, r.Env, r.Vault, r.GCPSecretManager} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("must have exactly one of file, env, vault or gcpSecretManager")
+	}
+	if r.Vault != "" && !strings.Contains(r.Vault, "#") {
+		return fmt.Errorf("vault reference %q must be path#key", r.Vault)
+	}
+	if r.GCPSecretManager != "" && !gcpSecretVersion.MatchString(r.GCPSecretManager) {
+		return fmt.Errorf("gcpSecretManager reference %q must be projects/<project>/secrets/<secret>/versions/<version>", r.GCPSecretManager)
+	}
+	return nil
+}
+
+// secret returns the Secret of the SecretSource, with the values read when read is set.
+// The files are relative to dir.
+func (s *secretSource) secret(ctx context.Context, dir string, read bool) (*apiCoreV1.Secret, error) {
+	secret := &apiCoreV1.Secret{
+		TypeMeta: apiMetaV1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: apiMetaV1.ObjectMeta{
+			Name:        s.Metadata.Name,
+			Namespace:   s.Metadata.Namespace,
+			Labels:      s.Metadata.Labels,
+			Annotations: s.Metadata.Annotations,
+		},
+		Type: s.Type,
+	}
+	if !read {
+		return secret, nil
+	}
+	keys := make([]string, 0, len(s.Data))
+	for key := range s.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	secret.Data = make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := s.Data[key].read(ctx, dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading key %v of secret %v", key, s.Metadata.Name)
+		}
+		secret.Data[key] = value
+	}
+	return secret, nil
+}
+
+// read returns the value of the reference.
+// The errors don't include the value.
+func (r secretRef) read(ctx context.Context, dir string) ([]byte, error) {
+	switch {
+	case r.File != "":
+		name := r.File
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		value, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading the file")
+		}
+		return value, nil
+	case r.Env != "":
+		value, err := provider.Env(r.Env)
+		return []byte(value), err
+	case r.Vault != "":
+		return vaultSecret(ctx, r.Vault)
+	default:
+		return gcpSecret(ctx, r.GCPSecretManager)
+	}
+}
+
+// vaultSecret reads the key of a secret of the kv engine, path#key.
+func vaultSecret(ctx context.Context, ref string) ([]byte, error) {
+	i := strings.LastIndex(ref, "#")
+	path, key := ref[:i], ref[i+1:]
+	addr, token := vaultAddr(), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, errors.New("reading a secret from vault needs VAULT_ADDR and VAULT_TOKEN")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	var resp struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	status, err := getJSON(ctx, http.DefaultClient, req, &resp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading vault secret %v", path)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("reading vault secret %v: status %v: %v", path, status, strings.Join(resp.Errors, ", "))
+	}
+	data := resp.Data
+	// The kv version 2 engine nests the keys in data.data, next to the metadata.
+	if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = nested
+	}
+	value, ok := data[key]
+	if !ok {
+		return nil, fmt.Errorf("vault secret %v has no key %v", path, key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("key %v of vault secret %v isn't a string", key, path)
+	}
+	return []byte(s), nil
+}
+
+// gcpSecret reads a secret version of the GCP Secret Manager.
+func gcpSecret(ctx context.Context, version string) ([]byte, error) {
+	client, err := secretManagerClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "GCP Secret Manager credentials")
+	}
+	req, err := http.NewRequest(http.MethodGet, secretManagerURL+version+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Payload struct {
+			// Data is base64 encoded in the response.
+			Data []byte `json:"data"`
+		} `json:"payload"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	status, err := getJSON(ctx, client, req, &resp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading GCP secret %v", version)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("reading GCP secret %v: status %v: %v", version, status, resp.Error.Message)
+	}
+	return resp.Payload.Data, nil
+}
+
+// getJSON sends the request and decodes the json response into v.
+func getJSON(ctx context.Context, client *http.Client, req *http.Request, v interface{}) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, errors.Wrapf(err, "decoding the response with status %v", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// secretSources replaces the SecretSource documents of the deployments with their Secrets,
+// with the values read when read is set, and returns the other objects as they are.
+func (c *K8s) secretSources(deployments []Resource, read bool) ([]Resource, error) {
+	replaced := make([]Resource, 0, len(deployments))
+	for _, d := range deployments {
+		objects := make([]runtime.Object, 0, len(d.Objects))
+		for _, resource := range d.Objects {
+			if !isSecretSource(resource) {
+				objects = append(objects, resource)
+				continue
+			}
+			doc, err := json.Marshal(resource.(*unstructured.Unstructured).Object)
+			if err != nil {
+				return nil, err
+			}
+			s, err := decodeSecretSource(doc)
+			if err != nil {
+				return nil, errors.Wrapf(err, "resource file:%v", d.FileName)
+			}
+			secret, err := s.secret(c.ctx, filepath.Dir(d.FileName), read)
+			if err != nil {
+				return nil, errors.Wrapf(err, "resource file:%v", d.FileName)
+			}
+			objects = append(objects, secret)
+		}
+		replaced = append(replaced, Resource{FileName: d.FileName, Objects: objects})
+	}
+	return replaced, nil
+}
+
+// redactSecret replaces the values of the data of a Secret with *** so that a diff doesn't show them.
+// Like kubectl diff the changed values are marked with (before) and (after).
+func redactSecret(live, merged *unstructured.Unstructured) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	if merged.GetKind() != "Secret" || merged.GetAPIVersion() != "v1" {
+		return live, merged
+	}
+	merged = merged.DeepCopy()
+	if live != nil {
+		live = live.DeepCopy()
+	}
+	for _, field := range []string{"data", "stringData"} {
+		var liveData map[string]interface{}
+		if live != nil {
+			liveData, _, _ = unstructured.NestedMap(live.Object, field)
+		}
+		mergedData, _, _ := unstructured.NestedMap(merged.Object, field)
+		for k, v := range mergedData {
+			lv, ok := liveData[k]
+			switch {
+			case ok && lv != v:
+				liveData[k], mergedData[k] = "*** (before)", "*** (after)"
+			case ok:
+				liveData[k], mergedData[k] = "***", "***"
+			default:
+				mergedData[k] = "***"
+			}
+		}
+		for k := range liveData {
+			if _, ok := mergedData[k]; !ok {
+				liveData[k] = "***"
+			}
+		}
+		if mergedData != nil {
+			unstructured.SetNestedMap(merged.Object, mergedData, field)
+		}
+		if liveData != nil {
+			unstructured.SetNestedMap(live.Object, liveData, field)
+		}
+	}
+	return live, merged
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testSecretSource = `apiVersion: infra.prometheus.io/v1
+kind: SecretSource
+metadata:
+  name: tokens
+  namespace: prombench-1234
+type: Opaque
+data:
+  oauth:
+    env: INFRA_TEST_TOKEN
+  key.json:
+    file: key.json
+  password:
+    vault: secret/data/prombench#password
+  webhook:
+    gcpSecretManager: projects/test/secrets/webhook/versions/latest
+`
+
+func TestSecretSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "key.json"), []byte(`{"key":"file"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(allowed []string) { provider.AllowedEnv = allowed }(provider.AllowedEnv)
+	provider.AllowedEnv = []string{"INFRA_TEST_*"}
+	os.Setenv("INFRA_TEST_TOKEN", "env")
+	defer os.Unsetenv("INFRA_TEST_TOKEN")
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/prombench" || r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"vault"},"metadata":{"version":1}}}`))
+	}))
+	defer vault.Close()
+	defer func(addr func() string) { vaultAddr = addr }(vaultAddr)
+	vaultAddr = func() string { return vault.URL }
+	os.Setenv("VAULT_TOKEN", "token")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	gcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/test/secrets/webhook/versions/latest:access" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"not found"}}`))
+			return
+		}
+		w.Write([]byte(`{"payload":{"data":"Z2Nw"}}`))
+	}))
+	defer gcp.Close()
+	defer func(url string, client func(context.Context) (*http.Client, error)) {
+		secretManagerURL, secretManagerClient = url, client
+	}(secretManagerURL, secretManagerClient)
+	secretManagerURL = gcp.URL + "/"
+	secretManagerClient = func(context.Context) (*http.Client, error) { return http.DefaultClient, nil }
+
+	objects, err := DecodeObjects("secrets.yaml", []byte(testSecretSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &K8s{ctx: context.Background()}
+	deployments := []Resource{{FileName: filepath.Join(dir, "secrets.yaml"), Objects: objects}}
+
+	replaced, err := c.secretSources(deployments, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := replaced[0].Objects[0].(*apiCoreV1.Secret)
+	if secret.Name != "tokens" || secret.Namespace != "prombench-1234" || secret.Kind != "Secret" {
+		t.Errorf("unexpected secret %v/%v of kind %v", secret.Namespace, secret.Name, secret.Kind)
+	}
+	for key, expected := range map[string]string{"oauth": "env", "key.json": `{"key":"file"}`, "password": "vault", "webhook": "gcp"} {
+		if v := string(secret.Data[key]); v != expected {
+			t.Errorf("expected %q for key %v, got %q", expected, key, v)
+		}
+	}
+
+	// Deleting doesn't read the values.
+	vaultAddr = func() string { return "" }
+	replaced, err = c.secretSources(deployments, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret := replaced[0].Objects[0].(*apiCoreV1.Secret); secret.Name != "tokens" || secret.Data != nil {
+		t.Errorf("expected the secret without data, got %v", secret)
+	}
+	if _, err := c.secretSources(deployments, true); err == nil || !strings.Contains(err.Error(), "needs VAULT_ADDR and VAULT_TOKEN") {
+		t.Errorf("expected an error without vault, got %v", err)
+	}
+}
+
+func TestDecodeSecretSource(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		err  string
+	}{
+		{data: "  a: {env: A}\n"},
+		{data: "", err: "has no data"},
+		{data: "  a: {env: A, file: a}\n", err: "exactly one of"},
+		{data: "  a: {vault: secret/a}\n", err: "must be path#key"},
+		{data: "  a: {gcpSecretManager: projects/a/secrets/b}\n", err: "must be projects/"},
+		{data: "  a: {value: a}\n", err: "unknown field"},
+	} {
+		_, err := decodeSecretSource([]byte("apiVersion: infra.prometheus.io/v1\nkind: SecretSource\nmetadata:\n  name: a\ndata:\n" + tc.data))
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tc.data, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: expected an error containing %q, got %v", tc.data, tc.err, err)
+		}
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	secret := func(data map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "tokens"},
+			"data":       data,
+		}}
+	}
+	live, merged := redactSecret(
+		secret(map[string]interface{}{"same": "YQ==", "changed": "Yg==", "removed": "Yw=="}),
+		secret(map[string]interface{}{"same": "YQ==", "changed": "ZA==", "added": "ZQ=="}),
+	)
+	expected := map[string]string{
+		"live same": "***", "live changed": "*** (before)", "live removed": "***",
+		"merged same": "***", "merged changed": "*** (after)", "merged added": "***",
+	}
+	for name, obj := range map[string]*unstructured.Unstructured{"live": live, "merged": merged} {
+		data, _, _ := unstructured.NestedStringMap(obj.Object, "data")
+		for k, v := range data {
+			if expected[name+" "+k] != v {
+				t.Errorf("%v %v: expected %q, got %q", name, k, expected[name+" "+k], v)
+			}
+		}
+	}
+
+	// A new secret has no live object.
+	if _, merged := redactSecret(nil, secret(map[string]interface{}{"a": "YQ=="})); merged.Object["data"].(map[string]interface{})["a"] != "***" {
+		t.Errorf("expected the data of a new secret to be redacted, got %v", merged.Object["data"])
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
+)
+
+// stage is a step of a scenario, a shell command run once the stages it needs have succeeded.
+type stage struct {
+	Name  string   `json:"name"`
+	Needs []string `json:"needs,omitempty"`
+	Run   string   `json:"run"`
+	// Timeout of the command, like 30m, no timeout when empty.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// stageResult is the outcome of a stage of a run.
+type stageResult struct {
+	start, end time.Time
+	err        error
+}
+
+// stagesOf returns the stages of a document, ok is false for the documents without stages.
+func stagesOf(doc []byte) (stages []stage, ok bool, err error) {
+	content := map[string]interface{}{}
+	if err := yaml.Unmarshal(doc, &content); err != nil {
+		return nil, false, err
+	}
+	if _, ok := content["stages"]; !ok {
+		return nil, false, nil
+	}
+	var file struct {
+		Stages []stage `json:"stages"`
+	}
+	if err := yaml.UnmarshalStrict(doc, &file); err != nil {
+		return nil, true, err
+	}
+	return file.Stages, true, nil
+}
+
+// validateStages checks that the stages have unique names, a command and a valid timeout,
+// and that their needs are stages which don't depend on them.
+func validateStages(stages []stage) []string {
+	var problems []string
+	byName := map[string]stage{}
+	for _, s := range stages {
+		switch {
+		case s.Name == "":
+			problems = append(problems, "stage without a name")
+			continue
+		case byName[s.Name].Name != "":
+			problems = append(problems, fmt.Sprintf("stage %v is defined twice", s.Name))
+			continue
+		}
+		byName[s.Name] = s
+		if strings.TrimSpace(s.Run) == "" {
+			problems = append(problems, fmt.Sprintf("stage %v has nothing to run", s.Name))
+		}
+		if s.Timeout != "" {
+			if d, err := parseDuration(s.Timeout); err != nil || d <= 0 {
+				problems = append(problems, fmt.Sprintf("stage %v: timeout must be a positive duration like 30m or 1h, got %q", s.Name, s.Timeout))
+			}
+		}
+	}
+	for _, s := range stages {
+		for _, n := range s.Needs {
+			if _, ok := byName[n]; !ok {
+				problems = append(problems, fmt.Sprintf("stage %v needs the unknown stage %v", s.Name, n))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	// Depth first search for a stage reached again through its needs.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(name string, path []string) []string
+	visit = func(name string, path []string) []string {
+		switch state[name] {
+		case visiting:
+			return append(path, name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, n := range byName[name].Needs {
+			if cycle := visit(n, append(path, name)); cycle != nil {
+				return cycle
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, s := range stages {
+		if cycle := visit(s.Name, nil); cycle != nil {
+			return []string{fmt.Sprintf("stages depend on each other: %v", strings.Join(cycle, " -> "))}
+		}
+	}
+	return nil
+}
+
+// RunStages runs the stages of the deployment files, each as soon as the stages it needs have succeeded,
+// so the independent stages run in parallel and the run only takes as long as its critical path.
+// After a failure no more stages are started and the running ones are waited for.
+func (s *Scenario) RunStages(*kingpin.ParseContext) error {
+	if len(s.DeploymentResource.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+	deployments, err := provider.DeploymentsParse(s.DeploymentResource.DeploymentFiles, provider.MergeDeploymentVars(
+		s.DeploymentResource.DefaultDeploymentVars,
+		s.DeploymentResource.FlagDeploymentVars,
+	))
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+	var stages []stage
+	for _, d := range deployments {
+		docs, err := documents(d.Content)
+		if err != nil {
+			return errors.Wrapf(err, "reading %v", d.FileName)
+		}
+		for i, doc := range docs {
+			// The other documents, like the manifests, are left to the resource commands.
+			st, _, err := stagesOf(doc)
+			if err != nil {
+				return errors.Wrapf(err, "%v, document:%v", d.FileName, i+1)
+			}
+			stages = append(stages, st...)
+		}
+	}
+	if len(stages) == 0 {
+		return fmt.Errorf("no stages in the deployment files")
+	}
+	if problems := validateStages(stages); len(problems) > 0 {
+		return fmt.Errorf("invalid stages:\n\t%v", strings.Join(problems, "\n\t"))
+	}
+
+	lw := &lineWriter{w: os.Stdout}
+	results := runStages(stages, s.Parallelism, func(st stage) error {
+		return runStage(provider.Context(), lw, st)
+	})
+	return stagesReport(stages, results)
+}
+
+// runStages runs the stages with run, at most parallelism at a time when it is positive,
+// and returns the results of the stages that were started.
+func runStages(stages []stage, parallelism int, run func(stage) error) map[string]*stageResult {
+	results := map[string]*stageResult{}
+	done := make(chan string)
+	running := 0
+	failed := false
+	ready := func(s stage) bool {
+		for _, n := range s.Needs {
+			r, ok := results[n]
+			if !ok || r.end.IsZero() || r.err != nil {
+				return false
+			}
+		}
+		return true
+	}
+	for {
+		for _, s := range stages {
+			if failed || parallelism > 0 && running >= parallelism {
+				break
+			}
+			if _, started := results[s.Name]; started || !ready(s) {
+				continue
+			}
+			r := &stageResult{start: time.Now()}
+			results[s.Name] = r
+			running++
+			log.Printf("Starting stage %v", s.Name)
+			go func(s stage, r *stageResult) {
+				// The error is only read once the stage is reported done.
+				r.err = run(s)
+				done <- s.Name
+			}(s, r)
+		}
+		if running == 0 {
+			return results
+		}
+		name := <-done
+		running--
+		r := results[name]
+		r.end = time.Now()
+		if r.err != nil {
+			log.Printf("Stage %v failed after %v: %v", name, r.end.Sub(r.start).Round(time.Second), r.err)
+			failed = true
+			continue
+		}
+		log.Printf("Stage %v done in %v", name, r.end.Sub(r.start).Round(time.Second))
+	}
+}
+
+// runStage runs the command of a stage with sh, each line of its output prefixed with the name of the stage.
+func runStage(ctx context.Context, lw *lineWriter, s stage) error {
+	if s.Timeout != "" {
+		timeout, err := parseDuration(s.Timeout)
+		if err != nil {
+			return err
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	r, w := io.Pipe()
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.Run)
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	output := make(chan struct{})
+	go func() {
+		defer close(output)
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			lw.printf("[%v] %s", s.Name, sc.Bytes())
+		}
+		// Drain the output of a line too long for the scanner.
+		io.Copy(ioutil.Discard, r)
+	}()
+	err := cmd.Run()
+	w.Close()
+	<-output
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v", s.Timeout)
+	}
+	return err
+}
+
+// stagesReport logs the durations and the critical path of the run and returns an error with the failed and skipped stages.
+func stagesReport(stages []stage, results map[string]*stageResult) error {
+	var failed, skipped []string
+	for _, s := range stages {
+		r, ok := results[s.Name]
+		switch {
+		case !ok:
+			skipped = append(skipped, s.Name)
+		case r.err != nil:
+			failed = append(failed, fmt.Sprintf("%v (%v)", s.Name, r.err))
+		}
+	}
+	if path := criticalPath(stages, results); len(path) > 0 {
+		first, last := results[path[0]], results[path[len(path)-1]]
+		log.Printf("Critical path: %v, %v", strings.Join(path, " -> "), last.end.Sub(first.start).Round(time.Second))
+	}
+	if len(failed) == 0 {
+		log.Printf("All %v stages succeeded", len(stages))
+		return nil
+	}
+	msg := fmt.Sprintf("stages failed:\n\t%v", strings.Join(failed, "\n\t"))
+	if len(skipped) > 0 {
+		msg += fmt.Sprintf("\nstages not run: %v", strings.Join(skipped, ", "))
+	}
+	return errors.New(msg)
+}
+
+// criticalPath returns the chain of stages which determined the duration of the run:
+// the stage which ended last preceded by its need which ended last, and so on.
+func criticalPath(stages []stage, results map[string]*stageResult) []string {
+	byName := map[string]stage{}
+	var last string
+	for _, s := range stages {
+		byName[s.Name] = s
+		if r, ok := results[s.Name]; ok && (last == "" || r.end.After(results[last].end)) {
+			last = s.Name
+		}
+	}
+	var path []string
+	for last != "" {
+		path = append(path, last)
+		next := ""
+		for _, n := range byName[last].Needs {
+			if r, ok := results[n]; ok && (next == "" || r.end.After(results[next].end)) {
+				next = n
+			}
+		}
+		last = next
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
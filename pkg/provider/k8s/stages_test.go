@@ -0,0 +1,103 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestValidateStages(t *testing.T) {
+	for _, tc := range []struct {
+		stages   []stage
+		problems []string
+	}{
+		{
+			stages: []stage{{Name: "a", Run: "true"}, {Name: "b", Needs: []string{"a"}, Run: "true", Timeout: "5m"}},
+		},
+		{
+			stages: []stage{{Run: "true"}, {Name: "a", Run: "true"}, {Name: "a", Run: "true"}, {Name: "b", Needs: []string{"c"}, Timeout: "-1m"}},
+			problems: []string{
+				"stage without a name",
+				"stage a is defined twice",
+				"stage b has nothing to run",
+				`stage b: timeout must be a positive duration like 30m or 1h, got "-1m"`,
+				"stage b needs the unknown stage c",
+			},
+		},
+		{
+			stages:   []stage{{Name: "a", Needs: []string{"c"}, Run: "true"}, {Name: "b", Needs: []string{"a"}, Run: "true"}, {Name: "c", Needs: []string{"b"}, Run: "true"}},
+			problems: []string{"stages depend on each other: a -> c -> b -> a"},
+		},
+	} {
+		if got := validateStages(tc.stages); !reflect.DeepEqual(got, tc.problems) {
+			t.Errorf("expected the problems %q, got %q", tc.problems, got)
+		}
+	}
+}
+
+func TestRunStages(t *testing.T) {
+	stages := []stage{
+		{Name: "loadgen"},
+		{Name: "dashboards"},
+		{Name: "preload", Needs: []string{"loadgen"}},
+		{Name: "queries", Needs: []string{"preload", "dashboards"}},
+	}
+
+	// The independent stages must run at the same time: loadgen only ends once dashboards started.
+	var (
+		mtx     sync.Mutex
+		order   []string
+		started = make(chan struct{})
+	)
+	results := runStages(stages, 0, func(s stage) error {
+		mtx.Lock()
+		order = append(order, s.Name)
+		mtx.Unlock()
+		switch s.Name {
+		case "dashboards":
+			close(started)
+		case "loadgen":
+			<-started
+		}
+		return nil
+	})
+	if len(results) != len(stages) {
+		t.Fatalf("expected all stages to run, got %v", results)
+	}
+	if last := order[len(order)-1]; last != "queries" {
+		t.Errorf("expected the stage with the most needs to run last, got %v", order)
+	}
+	if err := stagesReport(stages, results); err != nil {
+		t.Error(err)
+	}
+	if path := criticalPath(stages, results); path[len(path)-1] != "queries" {
+		t.Errorf("expected the critical path to end with the last stage, got %v", path)
+	}
+
+	// After a failure the stages needing it and the stages not started yet are skipped.
+	results = runStages(stages, 1, func(s stage) error {
+		if s.Name == "loadgen" {
+			return errors.New("no capacity")
+		}
+		return nil
+	})
+	err := stagesReport(stages, results)
+	if err == nil || !strings.Contains(err.Error(), "loadgen (no capacity)") || !strings.Contains(err.Error(), "stages not run: dashboards, preload, queries") {
+		t.Errorf("expected the failed and skipped stages, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// versionLabel is the recommended label for the version of an application.
+const versionLabel = "app.kubernetes.io/version"
+
+// ClusterStatus is a health summary of a cluster.
+type ClusterStatus struct {
+	Name string
+	// State of the cluster as reported by the provider.
+	State      string
+	Nodes      int
+	NodesReady int
+	// Pending pods as namespace/name with the reason they are pending.
+	PendingPods []string
+	Components  []Component
+}
+
+// Component is a deployment, statefulset or daemonset running in the cluster.
+type Component struct {
+	Namespace string
+	Name      string
+	Kind      string
+	// Version is the app.kubernetes.io/version label or the container images when not set.
+	Version  string
+	Ready    int32
+	Replicas int32
+}
+
+// Status fills the nodes, pending pods and components of the cluster status.
+// Components in the kube-* namespaces are skipped.
+func (c *K8s) Status(s *ClusterStatus) error {
+	nodes, err := c.clt.CoreV1().Nodes().List(c.ctx, apiMetaV1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "listing nodes")
+	}
+	s.Nodes = len(nodes.Items)
+	for _, node := range nodes.Items {
+		for _, cond := range node.Status.Conditions {
+			if cond.Type == apiCoreV1.NodeReady && cond.Status == apiCoreV1.ConditionTrue {
+				s.NodesReady++
+			}
+		}
+	}
+	provider.RecordNodes(s.NodesReady, s.Nodes)
+
+	pods, err := c.clt.CoreV1().Pods("").List(c.ctx, apiMetaV1.ListOptions{
+		FieldSelector: "status.phase=" + string(apiCoreV1.PodPending),
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing pods")
+	}
+	for _, pod := range pods.Items {
+		s.PendingPods = append(s.PendingPods, fmt.Sprintf("%v/%v (%v)", pod.Namespace, pod.Name, pendingReason(pod)))
+	}
+	sort.Strings(s.PendingPods)
+
+	deployments, err := c.clt.AppsV1().Deployments("").List(c.ctx, apiMetaV1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "listing deployments")
+	}
+	for _, d := range deployments.Items {
+		replicas := int32(1)
+		if d.Spec.Replicas != nil {
+			replicas = *d.Spec.Replicas
+		}
+		s.Components = append(s.Components, component("Deployment", d.ObjectMeta, d.Spec.Template.Spec, d.Status.ReadyReplicas, replicas))
+	}
+
+	statefulSets, err := c.clt.AppsV1().StatefulSets("").List(c.ctx, apiMetaV1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "listing statefulsets")
+	}
+	for _, ss := range statefulSets.Items {
+		replicas := int32(1)
+		if ss.Spec.Replicas != nil {
+			replicas = *ss.Spec.Replicas
+		}
+		s.Components = append(s.Components, component("StatefulSet", ss.ObjectMeta, ss.Spec.Template.Spec, ss.Status.ReadyReplicas, replicas))
+	}
+
+	daemonSets, err := c.clt.AppsV1().DaemonSets("").List(c.ctx, apiMetaV1.ListOptions{})
+	if err != nil {
+		return errors.Wrap(err, "listing daemonsets")
+	}
+	for _, ds := range daemonSets.Items {
+		s.Components = append(s.Components, component("DaemonSet", ds.ObjectMeta, ds.Spec.Template.Spec, ds.Status.NumberReady, ds.Status.DesiredNumberScheduled))
+	}
+
+	components := s.Components[:0]
+	for _, comp := range s.Components {
+		if !strings.HasPrefix(comp.Namespace, "kube-") {
+			components = append(components, comp)
+		}
+	}
+	s.Components = components
+	sort.Slice(s.Components, func(i, j int) bool {
+		if s.Components[i].Namespace != s.Components[j].Namespace {
+			return s.Components[i].Namespace < s.Components[j].Namespace
+		}
+		return s.Components[i].Name < s.Components[j].Name
+	})
+	return nil
+}
+
+func component(kind string, meta apiMetaV1.ObjectMeta, spec apiCoreV1.PodSpec, ready, replicas int32) Component {
+	version := meta.Labels[versionLabel]
+	if version == "" {
+		images := make([]string, 0, len(spec.Containers))
+		for _, container := range spec.Containers {
+			images = append(images, container.Image)
+		}
+		version = strings.Join(images, ",")
+	}
+	return Component{
+		Namespace: meta.Namespace,
+		Name:      meta.Name,
+		Kind:      kind,
+		Version:   version,
+		Ready:     ready,
+		Replicas:  replicas,
+	}
+}
+
+// pendingReason returns the reason of the first failed pod condition, usually Unschedulable.
+func pendingReason(pod apiCoreV1.Pod) string {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Status == apiCoreV1.ConditionFalse && cond.Reason != "" {
+			return cond.Reason
+		}
+	}
+	return "Pending"
+}
+
+// Write writes the status as a table or markdown.
+func (s *ClusterStatus) Write(w io.Writer, format string) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "CLUSTER\tSTATE\tNODES READY\tPENDING PODS")
+		fmt.Fprintf(tw, "%v\t%v\t%v/%v\t%v\n\n", s.Name, s.State, s.NodesReady, s.Nodes, len(s.PendingPods))
+		if len(s.Components) > 0 {
+			fmt.Fprintln(tw, "NAMESPACE\tNAME\tKIND\tREADY\tVERSION")
+			for _, comp := range s.Components {
+				fmt.Fprintf(tw, "%v\t%v\t%v\t%v/%v\t%v\n", comp.Namespace, comp.Name, comp.Kind, comp.Ready, comp.Replicas, comp.Version)
+			}
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		for _, pod := range s.PendingPods {
+			fmt.Fprintf(w, "\npending: %v", pod)
+		}
+		if len(s.PendingPods) > 0 {
+			fmt.Fprintln(w)
+		}
+		return nil
+	case "markdown":
+		fmt.Fprintf(w, "| Cluster | State | Nodes ready | Pending pods |\n| --- | --- | --- | --- |\n")
+		fmt.Fprintf(w, "| %v | %v | %v/%v | %v |\n", s.Name, s.State, s.NodesReady, s.Nodes, len(s.PendingPods))
+		if len(s.Components) > 0 {
+			fmt.Fprintf(w, "\n| Namespace | Name | Kind | Ready | Version |\n| --- | --- | --- | --- | --- |\n")
+			for _, comp := range s.Components {
+				fmt.Fprintf(w, "| %v | %v | %v | %v/%v | `%v` |\n", comp.Namespace, comp.Name, comp.Kind, comp.Ready, comp.Replicas, comp.Version)
+			}
+		}
+		if len(s.PendingPods) > 0 {
+			fmt.Fprintf(w, "\n<details><summary>Pending pods</summary>\n\n")
+			for _, pod := range s.PendingPods {
+				fmt.Fprintf(w, "- %v\n", pod)
+			}
+			fmt.Fprintf(w, "\n</details>\n")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
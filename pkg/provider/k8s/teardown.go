@@ -0,0 +1,355 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultDeleteTimeout = 15 * time.Minute
+	// forcedDeleteTimeout is how long to wait for the objects after removing their finalizers.
+	forcedDeleteTimeout = time.Minute
+	deletePollInterval  = 10 * time.Second
+)
+
+// The propagation policies of the deletes, like the --cascade flag of kubectl delete.
+const (
+	// DeleteForeground deletes the dependents of an object, like the pods of a deployment, before the object.
+	DeleteForeground = "foreground"
+	// DeleteBackground deletes the object first and its dependents after it.
+	DeleteBackground = "background"
+	// DeleteOrphan deletes the object and keeps its dependents.
+	DeleteOrphan = "orphan"
+)
+
+// deleteOptions returns the options of the deletes with the DeletePropagation, foreground by default.
+func (c *K8s) deleteOptions() apiMetaV1.DeleteOptions {
+	policy := apiMetaV1.DeletePropagationForeground
+	switch c.DeletePropagation {
+	case DeleteBackground:
+		policy = apiMetaV1.DeletePropagationBackground
+	case DeleteOrphan:
+		policy = apiMetaV1.DeletePropagationOrphan
+	}
+	return apiMetaV1.DeleteOptions{PropagationPolicy: &policy, DryRun: c.dryRun()}
+}
+
+// ObjectError is the error of an object of the deployment files.
+type ObjectError struct {
+	// Object is the kind, namespace and name of the object.
+	Object string
+	Err    error
+}
+
+func (e ObjectError) Error() string {
+	return fmt.Sprintf("%v (%v)", e.Object, e.Err)
+}
+
+// DeleteError is the error of ResourceDelete with the objects which couldn't be deleted or were left behind.
+type DeleteError struct {
+	Objects []ObjectError
+}
+
+func (e *DeleteError) Error() string {
+	objects := make([]string, 0, len(e.Objects))
+	for _, o := range e.Objects {
+		objects = append(objects, o.Error())
+	}
+	return fmt.Sprintf("%v objects not deleted:\n\t%v", len(e.Objects), strings.Join(objects, "\n\t"))
+}
+
+// object is a k8s object of a deployment file.
+type object struct {
+	fileName string
+	resource runtime.Object
+	// live is the object in the cluster, set when waiting for the deletion.
+	live *unstructured.Unstructured
+}
+
+func kindOf(resource runtime.Object) string {
+	return strings.ToLower(resource.GetObjectKind().GroupVersionKind().Kind)
+}
+
+// objectRef returns the API resource, namespace and name of an object.
+// Namespaced objects without a namespace are in the default namespace.
+func objectRef(resource runtime.Object) (gvr schema.GroupVersionResource, namespace, name string) {
+	gvr, _ = meta.UnsafeGuessKindToResource(resource.GetObjectKind().GroupVersionKind())
+	if obj, err := meta.Accessor(resource); err == nil {
+		name = obj.GetName()
+		namespace = obj.GetNamespace()
+	}
+	if clusterScoped[kindOf(resource)] {
+		namespace = ""
+	} else if namespace == "" {
+		namespace = "default"
+	}
+	return gvr, namespace, name
+}
+
+// describe returns the kind, namespace and name of an object.
+func describe(resource runtime.Object) string {
+	_, namespace, name := objectRef(resource)
+	if namespace != "" {
+		name = namespace + "/" + name
+	}
+	return fmt.Sprintf("%v %v", resource.GetObjectKind().GroupVersionKind().Kind, name)
+}
+
+// waitDeleted waits up to the DeleteTimeout for the objects to be removed
+// and returns the errors of the objects left behind.
+// Objects are usually stuck terminating because of a finalizer that isn't handled,
+// for example when the controller or the webhook responsible for it is down.
+// With ForceFinalizers the finalizers of these objects are removed and they get another chance to go away.
+func (c *K8s) waitDeleted(objects []object) ([]ObjectError, error) {
+	remaining, err := c.pollDeleted(objects, c.DeleteTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(remaining) > 0 && c.ForceFinalizers {
+		for _, o := range remaining {
+			if err := c.removeFinalizers(o); err != nil {
+				return nil, err
+			}
+		}
+		if remaining, err = c.pollDeleted(remaining, forcedDeleteTimeout); err != nil {
+			return nil, err
+		}
+	}
+
+	var leftBehind []ObjectError
+	for _, o := range remaining {
+		leftBehind = append(leftBehind, ObjectError{Object: describe(o.resource), Err: c.stuckReason(o)})
+	}
+	return leftBehind, nil
+}
+
+// pollDeleted returns the objects that still exist after the timeout.
+func (c *K8s) pollDeleted(objects []object, timeout time.Duration) ([]object, error) {
+	var remaining []object
+	err := wait.PollImmediate(deletePollInterval, timeout, func() (bool, error) {
+		remaining = remaining[:0]
+		for _, o := range objects {
+			client, obj, err := c.resourceClient(o.resource, 0)
+			if meta.IsNoMatchError(err) {
+				// The kind isn't served anymore since its CRD was deleted.
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			live, err := client.Get(c.ctx, obj.GetName(), apiMetaV1.GetOptions{})
+			if apiErrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return false, errors.Wrapf(err, "getting %v", describe(o.resource))
+			}
+			o.live = live
+			remaining = append(remaining, o)
+		}
+		if len(remaining) > 0 {
+			log.Printf("Waiting for %v objects to be deleted, first: %v", len(remaining), describe(remaining[0].resource))
+		}
+		return len(remaining) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return remaining, nil
+	}
+	return remaining, err
+}
+
+// removeFinalizers removes the finalizers of an object.
+// For namespaces the spec finalizers are removed as well which
+// leaves any objects that couldn't be deleted orphaned in the cluster.
+func (c *K8s) removeFinalizers(o object) error {
+	name := o.live.GetName()
+	if len(o.live.GetFinalizers()) > 0 {
+		log.Printf("Removing the finalizers %v of %v", o.live.GetFinalizers(), describe(o.resource))
+		client, _, err := c.resourceClient(o.resource, 0)
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		patch := []byte(`{"metadata":{"finalizers":null}}`)
+		if _, err := client.Patch(c.ctx, name, types.MergePatchType, patch, apiMetaV1.PatchOptions{}); err != nil && !apiErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "removing the finalizers of %v", describe(o.resource))
+		}
+	}
+
+	if kindOf(o.resource) != "namespace" {
+		return nil
+	}
+	ns, err := c.clt.CoreV1().Namespaces().Get(c.ctx, name, apiMetaV1.GetOptions{})
+	if apiErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "getting namespace %v", name)
+	}
+	if len(ns.Spec.Finalizers) == 0 {
+		return nil
+	}
+	log.Printf("Removing the finalizers %v of namespace %v, its remaining objects are orphaned", ns.Spec.Finalizers, name)
+	ns.Spec.Finalizers = nil
+	if _, err := c.clt.CoreV1().Namespaces().Finalize(c.ctx, ns, apiMetaV1.UpdateOptions{}); err != nil && !apiErrors.IsNotFound(err) {
+		return errors.Wrapf(err, "finalizing namespace %v", name)
+	}
+	return nil
+}
+
+// stuckReason returns why an object wasn't deleted with the finalizers that block it.
+// For namespaces the deletion conditions explain which content couldn't be removed.
+func (c *K8s) stuckReason(o object) error {
+	var reasons []string
+	if ts := o.live.GetDeletionTimestamp(); ts != nil {
+		reasons = append(reasons, fmt.Sprintf("terminating since %v", ts.Format(time.RFC3339)))
+	}
+	if f := o.live.GetFinalizers(); len(f) > 0 {
+		reasons = append(reasons, fmt.Sprintf("finalizers: %v", strings.Join(f, ",")))
+	}
+	if kindOf(o.resource) == "namespace" {
+		ns := &apiCoreV1.Namespace{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(o.live.Object, ns); err == nil {
+			if len(ns.Spec.Finalizers) > 0 {
+				reasons = append(reasons, fmt.Sprintf("namespace finalizers: %v", ns.Spec.Finalizers))
+			}
+			for _, cond := range ns.Status.Conditions {
+				if cond.Status == apiCoreV1.ConditionTrue {
+					reasons = append(reasons, fmt.Sprintf("%v: %v", cond.Type, cond.Message))
+				}
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return errors.New("still exists")
+	}
+	return errors.New(strings.Join(reasons, "; "))
+}
+
+// claimedVolumes returns the persistent volumes of the deleted namespaces and claims.
+func (c *K8s) claimedVolumes(deleted []object) ([]apiCoreV1.PersistentVolume, error) {
+	namespaces := map[string]bool{}
+	claims := map[string]bool{}
+	for _, o := range deleted {
+		_, namespace, name := objectRef(o.resource)
+		switch kindOf(o.resource) {
+		case "namespace":
+			namespaces[name] = true
+		case "persistentvolumeclaim":
+			claims[namespace+"/"+name] = true
+		}
+	}
+	if len(namespaces) == 0 && len(claims) == 0 {
+		return nil, nil
+	}
+
+	pvs, err := c.clt.CoreV1().PersistentVolumes().List(c.ctx, apiMetaV1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing persistent volumes")
+	}
+	claimed := []apiCoreV1.PersistentVolume{}
+	for _, pv := range pvs.Items {
+		ref := pv.Spec.ClaimRef
+		if ref != nil && (namespaces[ref.Namespace] || claims[ref.Namespace+"/"+ref.Name]) {
+			claimed = append(claimed, pv)
+		}
+	}
+	return claimed, nil
+}
+
+// reclaimed returns true for the volumes deleted once their claim is gone.
+func reclaimed(pv apiCoreV1.PersistentVolume) bool {
+	return pv.Spec.PersistentVolumeReclaimPolicy != apiCoreV1.PersistentVolumeReclaimRetain && pv.Status.Phase != apiCoreV1.VolumeFailed
+}
+
+// waitVolumesDeleted waits up to the DeleteTimeout for the volumes of the deleted namespaces and claims
+// to be reclaimed, since their disks are deleted after the claims, and returns the errors of the volumes left.
+func (c *K8s) waitVolumesDeleted(deleted []object) ([]ObjectError, error) {
+	var remaining []apiCoreV1.PersistentVolume
+	err := wait.PollImmediate(deletePollInterval, c.DeleteTimeout, func() (bool, error) {
+		pvs, err := c.claimedVolumes(deleted)
+		if err != nil {
+			return false, err
+		}
+		remaining = remaining[:0]
+		for _, pv := range pvs {
+			if reclaimed(pv) {
+				remaining = append(remaining, pv)
+			}
+		}
+		if len(remaining) > 0 {
+			log.Printf("Waiting for %v persistent volumes to be deleted, first: %v", len(remaining), remaining[0].Name)
+		}
+		return len(remaining) == 0, nil
+	})
+	if err != nil && err != wait.ErrWaitTimeout {
+		return nil, err
+	}
+	var leftBehind []ObjectError
+	for _, pv := range remaining {
+		leftBehind = append(leftBehind, ObjectError{
+			Object: "PersistentVolume " + pv.Name,
+			Err:    fmt.Errorf("claim %v/%v, still %v", pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name, pv.Status.Phase),
+		})
+	}
+	return leftBehind, nil
+}
+
+// verifyDeleted reports the persistent volumes of the deleted namespaces and claims that were left behind.
+// Volumes with the Retain reclaim policy outlive their claims, as do the volumes whose deletion failed,
+// and keep their disks billed.
+func (c *K8s) verifyDeleted(deleted []object) error {
+	pvs, err := c.claimedVolumes(deleted)
+	run := "the deleted namespaces and claims"
+	if err != nil {
+		provider.CleanupUnverified(run, err)
+		return nil
+	}
+	if pvs == nil {
+		return nil
+	}
+	var leftovers []provider.Leftover
+	for _, pv := range pvs {
+		if reclaimed(pv) {
+			// The volume is being deleted.
+			continue
+		}
+		ref := pv.Spec.ClaimRef
+		leftovers = append(leftovers, provider.Leftover{
+			Kind:   "persistent volume",
+			Name:   pv.Name,
+			Reason: fmt.Sprintf("claim %v/%v, reclaim policy %v, phase %v", ref.Namespace, ref.Name, pv.Spec.PersistentVolumeReclaimPolicy, pv.Status.Phase),
+		})
+	}
+	return provider.ReportLeftovers(run, leftovers)
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	apiMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	fakeDiscovery "k8s.io/client-go/discovery/fake"
+	fakeDynamic "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/restmapper"
+	clientTesting "k8s.io/client-go/testing"
+)
+
+func TestDeleteOptions(t *testing.T) {
+	for propagation, expected := range map[string]apiMetaV1.DeletionPropagation{
+		"":               apiMetaV1.DeletePropagationForeground,
+		DeleteForeground: apiMetaV1.DeletePropagationForeground,
+		DeleteBackground: apiMetaV1.DeletePropagationBackground,
+		DeleteOrphan:     apiMetaV1.DeletePropagationOrphan,
+	} {
+		c := &K8s{DeletePropagation: propagation}
+		if got := c.deleteOptions().PropagationPolicy; got == nil || *got != expected {
+			t.Errorf("%q: expected the propagation policy %v, got %v", propagation, expected, got)
+		}
+	}
+}
+
+func TestResourceDeleteErrors(t *testing.T) {
+	for _, wait := range []bool{false, true} {
+		discoveryClient := memory.NewMemCacheClient(&fakeDiscovery.FakeDiscovery{Fake: &clientTesting.Fake{
+			Resources: []*apiMetaV1.APIResourceList{{
+				GroupVersion: "v1",
+				APIResources: []apiMetaV1.APIResource{
+					{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: []string{"get", "delete"}},
+				},
+			}},
+		}})
+		dynClient := fakeDynamic.NewSimpleDynamicClient(runtime.NewScheme(), testConfigMap("deleted", nil), testConfigMap("protected", nil))
+		dynClient.PrependReactor("delete", "configmaps", func(action clientTesting.Action) (bool, runtime.Object, error) {
+			if action.(clientTesting.DeleteAction).GetName() != "protected" {
+				return false, nil, nil
+			}
+			return true, nil, apiErrors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "protected", nil)
+		})
+		c := &K8s{
+			ctx:           context.Background(),
+			dynClient:     dynClient,
+			discovery:     discoveryClient,
+			mapper:        restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient),
+			DeleteTimeout: time.Second,
+			DeleteWait:    wait,
+		}
+
+		err := c.ResourceDelete([]Resource{{FileName: "configmaps.yaml", Objects: []runtime.Object{
+			testConfigMap("deleted", nil), testConfigMap("protected", nil), testConfigMap("missing", nil),
+		}}})
+		deleteErr, ok := err.(*DeleteError)
+		if !ok {
+			t.Fatalf("wait %v: expected a *DeleteError, got %v", wait, err)
+		}
+		if len(deleteErr.Objects) != 1 || deleteErr.Objects[0].Object != "ConfigMap default/protected" || !apiErrors.IsForbidden(errors.Cause(deleteErr.Objects[0].Err)) {
+			t.Errorf("wait %v: expected the error of the protected config map only, got %v", wait, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kind
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	appsV1 "k8s.io/api/apps/v1"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sYaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+const (
+	// ingressManifest is the upstream ingress-nginx deployment for kind, see https://kind.sigs.k8s.io/docs/user/ingress/.
+	// The controller runs on the node labeled ingress-ready=true and listens on its host ports 80 and 443.
+	ingressManifest = "https://raw.githubusercontent.com/kubernetes/ingress-nginx/controller-v0.41.2/deploy/static/provider/kind/deploy.yaml"
+	// ingressNamespace and ingressController are the namespace and the deployment of the controller in the manifest.
+	ingressNamespace  = "ingress-nginx"
+	ingressController = "ingress-nginx-controller"
+	// ingressTimeout is how long to wait for the controller to be available.
+	ingressTimeout = 5 * time.Minute
+)
+
+// ingressNodePatch labels the node running the ingress controller.
+const ingressNodePatch = `kind: InitConfiguration
+nodeRegistration:
+  kubeletExtraArgs:
+    node-labels: "ingress-ready=true"`
+
+// addIngressPortMappings maps the host ports 80 and 443 to the first control plane node
+// and labels it to run the ingress controller, which listens on its host ports.
+// A config without nodes gets the single control plane node kind creates by default.
+func addIngressPortMappings(config *v1alpha4.Cluster) error {
+	mappings := []v1alpha4.PortMapping{
+		{ContainerPort: 80, HostPort: 80, Protocol: v1alpha4.PortMappingProtocolTCP},
+		{ContainerPort: 443, HostPort: 443, Protocol: v1alpha4.PortMappingProtocolTCP},
+	}
+	if len(config.Nodes) == 0 {
+		config.Nodes = []v1alpha4.Node{{Role: v1alpha4.ControlPlaneRole}}
+	}
+	for i, node := range config.Nodes {
+		if node.Role != v1alpha4.ControlPlaneRole {
+			continue
+		}
+		config.Nodes[i].ExtraPortMappings = append(config.Nodes[i].ExtraPortMappings, mappings...)
+		config.Nodes[i].KubeadmConfigPatches = append(config.Nodes[i].KubeadmConfigPatches, ingressNodePatch)
+		return nil
+	}
+	return errors.New("the ingress requires a control-plane node in the cluster config")
+}
+
+// installIngress deploys the upstream ingress-nginx controller for kind on the cluster
+// and waits for it to be available so that the ingresses are reachable when the cluster is created.
+// The objects which already exist are kept.
+func (c *KIND) installIngress(name string) error {
+	kubeconfig, err := c.kindProvider.KubeConfig(name, false)
+	if err != nil {
+		return errors.Wrapf(err, "getting the kubeconfig for cluster:%v", name)
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	if err != nil {
+		return errors.Wrap(err, "parsing the cluster kubeconfig")
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return err
+	}
+	groups, err := restmapper.GetAPIGroupResources(discoveryClient)
+	if err != nil {
+		return errors.Wrap(err, "discovering the cluster resources")
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(groups)
+
+	log.Printf("Installing ingress-nginx on cluster '%v' from %v", name, ingressManifest)
+	objects, err := fetchIngressObjects(c.ctx)
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		gvk := o.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return errors.Wrapf(err, "resource of %v/%v", gvk.Kind, o.GetName())
+		}
+		var resource dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			resource = dynamicClient.Resource(mapping.Resource).Namespace(o.GetNamespace())
+		}
+		if _, err := resource.Create(c.ctx, o, metav1.CreateOptions{}); err != nil && !apiErrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "creating %v/%v", gvk.Kind, o.GetName())
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	log.Printf("Waiting for the ingress-nginx controller of cluster '%v' to be available", name)
+	ctx, cancel := context.WithTimeout(c.ctx, ingressTimeout)
+	defer cancel()
+	if err := wait.PollImmediateUntil(5*time.Second, func() (bool, error) {
+		d, err := clientset.AppsV1().Deployments(ingressNamespace).Get(ctx, ingressController, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		for _, cond := range d.Status.Conditions {
+			if cond.Type == appsV1.DeploymentAvailable && cond.Status == apiCoreV1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, ctx.Done()); err != nil {
+		return errors.Errorf("the ingress-nginx controller isn't available after %v", ingressTimeout)
+	}
+	return nil
+}
+
+// fetchIngressObjects downloads and decodes the objects of the ingress manifest.
+func fetchIngressObjects(ctx context.Context) ([]*unstructured.Unstructured, error) {
+	req, err := http.NewRequest(http.MethodGet, ingressManifest, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "downloading the ingress-nginx manifest")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading the ingress-nginx manifest: %v", resp.Status)
+	}
+	var objects []*unstructured.Unstructured
+	decoder := k8sYaml.NewYAMLOrJSONDecoder(resp.Body, 4096)
+	for {
+		o := &unstructured.Unstructured{}
+		if err := decoder.Decode(&o.Object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "decoding the ingress-nginx manifest")
+		}
+		if len(o.Object) > 0 {
+			objects = append(objects, o)
+		}
+	}
+	return objects, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kind
+
+import (
+	"testing"
+
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
+)
+
+func TestAddIngressPortMappings(t *testing.T) {
+	// Without nodes kind creates a single control plane node.
+	config := &v1alpha4.Cluster{}
+	if err := addIngressPortMappings(config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Nodes) != 1 || config.Nodes[0].Role != v1alpha4.ControlPlaneRole || len(config.Nodes[0].ExtraPortMappings) != 2 {
+		t.Errorf("expected a control plane node with the ingress port mappings, got %+v", config.Nodes)
+	}
+	if patches := config.Nodes[0].KubeadmConfigPatches; len(patches) != 1 || patches[0] != ingressNodePatch {
+		t.Errorf("expected the control plane node to be labeled for the ingress, got %v", patches)
+	}
+
+	config = &v1alpha4.Cluster{Nodes: []v1alpha4.Node{{Role: v1alpha4.WorkerRole}, {Role: v1alpha4.ControlPlaneRole}, {Role: v1alpha4.ControlPlaneRole}}}
+	if err := addIngressPortMappings(config); err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{0, 2, 0} {
+		if got := len(config.Nodes[i].ExtraPortMappings); got != expected {
+			t.Errorf("node %d: expected %d port mappings, got %d", i, expected, got)
+		}
+		if got := len(config.Nodes[i].KubeadmConfigPatches); got != expected/2 {
+			t.Errorf("node %d: expected %d kubeadm patches, got %d", i, expected/2, got)
+		}
+	}
+
+	config = &v1alpha4.Cluster{Nodes: []v1alpha4.Node{{Role: v1alpha4.WorkerRole}}}
+	if err := addIngressPortMappings(config); err == nil {
+		t.Error("expected an error without a control plane node")
+	}
+}
@@ -15,18 +15,27 @@ package kind
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/test-infra/pkg/provider"
 	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
 	"gopkg.in/alecthomas/kingpin.v2"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes/scheme"
+	"gopkg.in/yaml.v2"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/kind/pkg/apis/config/v1alpha4"
 	"sigs.k8s.io/kind/pkg/cluster"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
 	"sigs.k8s.io/kind/pkg/cmd"
 )
 
@@ -51,20 +60,115 @@ type KIND struct {
 	k8sResources []k8sProvider.Resource
 
 	ctx context.Context
-	// KIND kuberconfig file
-	kubeconfig string
+	// KIND kubeconfig file, when empty kind's default is used - $KUBECONFIG or $HOME/.kube/config.
+	Kubeconfig string
+	// Container runtime of the cluster nodes - docker, podman or nerdctl. Auto-detected when empty.
+	Runtime string
+
+	// Local container images to load onto the cluster nodes.
+	Images []string
+	// Image tarballs to load onto the cluster nodes.
+	ImageArchives []string
+	// Run a local registry reachable from the cluster nodes as localhost:5000.
+	LocalRegistry bool
+	// Delete and recreate the cluster when it already exists.
+	Recreate bool
+
+	// Name of the cluster to export the kubeconfig for, defaults to CLUSTER_NAME.
+	KubeconfigName string
+	// File to write the exported kubeconfig to, stdout when empty.
+	KubeconfigOutput string
+	// Merge the exported kubeconfig into the existing output file instead of overwriting it.
+	KubeconfigMerge bool
+
+	// Output format of the cluster list - table or json.
+	ListOutput string
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
+	// Clusters older than this are deleted by the garbage collection.
+	MaxAge time.Duration
+
+	// Name of the cluster created by the self test.
+	SelfTestName string
+	// How long the mock benchmark of the self test runs.
+	SelfTestDuration time.Duration
+	// Directory the result of the self test is published to.
+	SelfTestResultsDir string
+	// Keep the cluster of a failed self test to debug it.
+	SelfTestKeep bool
 }
 
+const (
+	registryName  = "kind-registry"
+	registryPort  = "5000"
+	registryImage = "registry:2"
+	// The container network to which kind attaches all cluster nodes.
+	kindNetwork = "kind"
+)
+
 // New is the KIND constructor.
 func New(dr *provider.DeploymentResource) *KIND {
 	return &KIND{
 		DeploymentResource: dr,
-		kindProvider: cluster.NewProvider(
-			cluster.ProviderWithLogger(cmd.NewLogger()),
-		),
-		ctx:        context.Background(),
-		kubeconfig: homedir.HomeDir() + "/.kube/config",
+		ctx:                provider.Context(),
+	}
+}
+
+// NewKINDProvider checks that the container runtime is usable
+// and sets the kind provider used to manage the clusters.
+func (c *KIND) NewKINDProvider(*kingpin.ParseContext) error {
+	if c.Runtime == "" {
+		c.Runtime = detectRuntime()
+	}
+
+	var runtimeOption cluster.ProviderOption
+	switch c.Runtime {
+	case "docker":
+		runtimeOption = cluster.ProviderWithDocker()
+	case "podman":
+		runtimeOption = cluster.ProviderWithPodman()
+	case "nerdctl":
+		return fmt.Errorf("the nerdctl runtime isn't supported by the kind version used by infra, use docker or podman")
+	default:
+		return fmt.Errorf("unknown container runtime:%v", c.Runtime)
+	}
+
+	// Fail early with a clear error instead of somewhere in the middle of the cluster creation.
+	if out, err := exec.Command(c.Runtime, "info").CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "the %v container runtime isn't usable: %s", c.Runtime, out)
+	}
+
+	c.kindProvider = cluster.NewProvider(
+		cluster.ProviderWithLogger(cmd.NewLogger()),
+		runtimeOption,
+	)
+	return nil
+}
+
+// detectRuntime returns the container runtime the same way kind auto-detects it - docker and then podman.
+func detectRuntime() string {
+	if _, err := exec.LookPath("docker"); err != nil {
+		if _, err := exec.LookPath("podman"); err == nil {
+			return "podman"
+		}
 	}
+	return "docker"
 }
 
 // SetupDeploymentResources Sets up DeploymentVars and DeploymentFiles
@@ -108,24 +212,9 @@ func (c *KIND) K8SDeploymentsParse(*kingpin.ParseContext) error {
 		return err
 	}
 	for _, deployment := range deploymentResource {
-
-		decode := scheme.Codecs.UniversalDeserializer().Decode
-		k8sObjects := make([]runtime.Object, 0)
-
-		for _, text := range strings.Split(string(deployment.Content), provider.Separator) {
-			text = strings.TrimSpace(text)
-			if len(text) == 0 {
-				continue
-			}
-
-			resource, _, err := decode([]byte(text), nil, nil)
-			if err != nil {
-				return errors.Wrapf(err, "decoding the resource file:%v, section:%v...", deployment.FileName, text[:100])
-			}
-			if resource == nil {
-				continue
-			}
-			k8sObjects = append(k8sObjects, resource)
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
 		}
 		if len(k8sObjects) > 0 {
 			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
@@ -148,32 +237,499 @@ func (c *KIND) checkDeploymentVarsAndFiles() error {
 	return nil
 }
 
-// ClusterCreate create a new cluster or applies changes to an existing cluster.
-func (c *KIND) ClusterCreate(*kingpin.ParseContext) error {
+// ClusterCreate creates a new cluster. When the cluster already exists
+// it is left as it is, or deleted and created again when Recreate is set.
+func (c *KIND) ClusterCreate(*kingpin.ParseContext) (err error) {
+	name := c.DeploymentVars["CLUSTER_NAME"]
+	exists, err := c.clusterExists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if !c.Recreate {
+			log.Printf("Cluster '%v' already exists, skipping the creation", name)
+			return nil
+		}
+		log.Printf("Cluster '%v' already exists, deleting it before recreating", name)
+		if err := c.delete(name); err != nil {
+			return errors.Wrapf(err, "deleting the existing cluster:%v", name)
+		}
+	}
+
+	if c.LocalRegistry {
+		if err := c.startRegistry(); err != nil {
+			return err
+		}
+	}
+
+	// A cluster still being created when the command is interrupted is deleted.
+	if !provider.DryRun {
+		done := provider.OnInterrupt(fmt.Sprintf("deleting the cluster:%v being created", name), func(context.Context) error {
+			return c.delete(name)
+		})
+		defer func() {
+			if err == nil {
+				done()
+			}
+		}()
+	}
+
 	for _, deployment := range c.kindResources {
-		CreateWithConfigFile := cluster.CreateWithRawConfig(deployment.Content)
+		config := &v1alpha4.Cluster{}
+		if err := yaml.UnmarshalStrict(deployment.Content, config); err != nil {
+			return errors.Wrapf(err, "parsing the cluster config file:%v", deployment.FileName)
+		}
+		if c.LocalRegistry {
+			config.ContainerdConfigPatches = append(config.ContainerdConfigPatches, registryContainerdConfigPatch)
+		}
+		if c.ingress() {
+			if err := addIngressPortMappings(config); err != nil {
+				return errors.Wrapf(err, "cluster config file:%v", deployment.FileName)
+			}
+		}
 
-		err := c.kindProvider.Create(c.DeploymentVars["CLUSTER_NAME"], CreateWithConfigFile)
-		if err != nil {
+		if provider.DryRun {
+			if err := provider.DryRunRequest("create cluster "+name, config); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := provider.Chaos("create cluster " + name); err != nil {
+			return err
+		}
+		if err := c.kindProvider.Create(name,
+			cluster.CreateWithV1Alpha4Config(config),
+			cluster.CreateWithKubeconfigPath(c.Kubeconfig),
+		); err != nil {
+			return err
+		}
+	}
+
+	if !provider.DryRun {
+		if err := c.writeLabels(name); err != nil {
 			return err
 		}
 	}
+	if c.LocalRegistry {
+		if err := c.connectRegistry(); err != nil {
+			return err
+		}
+	}
+	if c.ingress() {
+		if provider.DryRun {
+			return provider.DryRunRequest("install ingress-nginx on cluster "+name, nil)
+		}
+		return c.installIngress(name)
+	}
+	return nil
+}
+
+// ingress returns whether the cluster should be reachable from the host through an ingress,
+// enabled with the INGRESS:true deployment variable.
+func (c *KIND) ingress() bool {
+	return c.DeploymentVars["INGRESS"] == "true"
+}
+
+// registryContainerdConfigPatch configures containerd on the nodes
+// to pull the localhost:5000 images from the local registry.
+var registryContainerdConfigPatch = fmt.Sprintf(`[plugins."io.containerd.grpc.v1.cri".registry.mirrors."localhost:%[1]v"]
+  endpoint = ["http://%[2]v:%[1]v"]`, registryPort, registryName)
+
+// startRegistry starts the local registry container unless it is already running.
+// The registry is shared by all clusters so it is left running when a cluster is deleted.
+func (c *KIND) startRegistry() error {
+	if provider.DryRun {
+		return provider.DryRunRequest("start the local registry "+registryName, nil)
+	}
+	out, err := exec.Command(c.Runtime, "inspect", "-f", "{{.State.Running}}", registryName).CombinedOutput()
+	if err == nil && strings.TrimSpace(string(out)) == "true" {
+		log.Printf("Local registry '%v' already running", registryName)
+		return nil
+	}
+	if err == nil {
+		// The container exists but it is stopped.
+		if out, err := exec.Command(c.Runtime, "start", registryName).CombinedOutput(); err != nil {
+			return errors.Wrapf(err, "starting the local registry: %s", out)
+		}
+		return nil
+	}
+
+	log.Printf("Starting local registry '%v' on localhost:%v", registryName, registryPort)
+	out, err = exec.Command(c.Runtime, "run", "-d", "--restart=always",
+		"-p", fmt.Sprintf("127.0.0.1:%[1]v:%[1]v", registryPort),
+		"--name", registryName, registryImage).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "starting the local registry: %s", out)
+	}
+	return nil
+}
+
+// connectRegistry connects the local registry to the kind network
+// so that the cluster nodes can reach it.
+func (c *KIND) connectRegistry() error {
+	if provider.DryRun {
+		return provider.DryRunRequest(fmt.Sprintf("%v network connect %v %v", c.Runtime, kindNetwork, registryName), nil)
+	}
+	out, err := exec.Command(c.Runtime, "network", "connect", kindNetwork, registryName).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "already exists") {
+		return errors.Wrapf(err, "connecting the local registry to the %v network: %s", kindNetwork, out)
+	}
 	return nil
 }
 
 // ClusterDelete deletes a k8s cluster.
 func (c *KIND) ClusterDelete(*kingpin.ParseContext) error {
-	err := c.kindProvider.Delete(c.DeploymentVars["CLUSTER_NAME"], c.kubeconfig)
+	err := c.delete(c.DeploymentVars["CLUSTER_NAME"])
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// delete deletes the cluster and removes it from the kubeconfig.
+func (c *KIND) delete(name string) error {
+	if provider.DryRun {
+		return provider.DryRunRequest("delete cluster "+name, nil)
+	}
+	if err := provider.Chaos("delete cluster " + name); err != nil {
+		return err
+	}
+	return c.kindProvider.Delete(name, c.Kubeconfig)
+}
+
+// clusterInfo holds the details of an existing cluster.
+type clusterInfo struct {
+	Name    string    `json:"name"`
+	Nodes   int       `json:"nodes"`
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+// ClusterList prints the existing clusters with their node count, Kubernetes version and age.
+func (c *KIND) ClusterList(*kingpin.ParseContext) error {
+	names, err := c.kindProvider.List()
+	if err != nil {
+		return errors.Wrap(err, "listing clusters")
+	}
+
+	clusters := make([]clusterInfo, 0, len(names))
+	for _, name := range names {
+		info, err := c.clusterInfo(name)
+		if err != nil {
+			return err
+		}
+		clusters = append(clusters, info)
+	}
+
+	if c.ListOutput == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(clusters)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tNODES\tVERSION\tAGE")
+	for _, info := range clusters {
+		age := "unknown"
+		if !info.Created.IsZero() {
+			age = time.Since(info.Created).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", info.Name, info.Nodes, info.Version, age)
+	}
+	return w.Flush()
+}
+
+// Inventory returns the existing clusters.
+// The nodes are containers on this host so the clusters have no machine types to estimate the cost.
+func (c *KIND) Inventory() ([]provider.ClusterInfo, error) {
+	names, err := c.kindProvider.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing clusters")
+	}
+	clusters := make([]provider.ClusterInfo, 0, len(names))
+	for _, name := range names {
+		info, err := c.clusterInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, provider.ClusterInfo{Name: info.Name, Nodes: info.Nodes, Created: info.Created})
+	}
+	return clusters, nil
+}
+
+// GC deletes the clusters created by infra longer than MaxAge ago.
+// KIND doesn't support labeling clusters so the clusters created by infra are marked with a file in their nodes, see writeLabels.
+// The other clusters are kept.
+func (c *KIND) GC(*kingpin.ParseContext) error {
+	names, err := c.kindProvider.List()
+	if err != nil {
+		return errors.Wrap(err, "listing clusters")
+	}
+	now := time.Now()
+	// Continue with the other clusters so that a single failure doesn't block the garbage collection.
+	var failed []string
+	for _, name := range names {
+		labels, err := c.readLabels(name)
+		if err != nil {
+			log.Printf("Skipping cluster '%v': %v", name, err)
+			continue
+		}
+		if !provider.Expired(labels, c.MaxAge, now) {
+			continue
+		}
+		log.Printf("Removing expired cluster '%v', owner '%v', created at %v", name, labels[provider.OwnerLabel], provider.CreatedTime(labels))
+		if err := c.delete(name); err != nil {
+			log.Printf("Removing cluster '%v' err: %v", name, err)
+			failed = append(failed, "cluster:"+name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("garbage collection failed for %v", failed)
+	}
+	return nil
+}
+
+// clusterInfo returns the details of the given cluster,
+// the cluster age is the age of its bootstrap control plane node container.
+func (c *KIND) clusterInfo(name string) (clusterInfo, error) {
+	info := clusterInfo{Name: name}
+	nodes, err := c.kindProvider.ListNodes(name)
+	if err != nil {
+		return info, errors.Wrapf(err, "listing nodes for cluster:%v", name)
+	}
+	info.Nodes = len(nodes)
+
+	node, err := nodeutils.BootstrapControlPlaneNode(nodes)
+	if err != nil {
+		log.Printf("Cluster '%v' has no control plane node: %v", name, err)
+		return info, nil
+	}
+	if info.Version, err = nodeutils.KubeVersion(node); err != nil {
+		log.Printf("Couldn't get the Kubernetes version of cluster '%v': %v", name, err)
+	}
+
+	out, err := exec.Command(c.Runtime, "inspect", "-f", "{{.Created}}", node.String()).CombinedOutput()
+	if err != nil {
+		log.Printf("Couldn't inspect the node '%v': %v %s", node.String(), err, out)
+		return info, nil
+	}
+	if info.Created, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out))); err != nil {
+		log.Printf("Couldn't parse the creation time of node '%v': %v", node.String(), err)
+	}
+	return info, nil
+}
+
+// ClusterRunning blocks until the cluster is usable - all nodes are ready,
+// the API server is reachable and CoreDNS is up, or returns an error when the retries are exhausted.
+func (c *KIND) ClusterRunning(*kingpin.ParseContext) error {
+	name := c.DeploymentVars["CLUSTER_NAME"]
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("checking cluster running status for:%v", name),
+		provider.GlobalRetryCount,
+		func() (bool, error) { return c.clusterRunning(name) })
+}
+
+// ClusterDeleted blocks until the cluster no longer exists,
+// or returns an error when the retries are exhausted.
+func (c *KIND) ClusterDeleted(*kingpin.ParseContext) error {
+	name := c.DeploymentVars["CLUSTER_NAME"]
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("checking cluster deleted status for:%v", name),
+		provider.GlobalRetryCount,
+		func() (bool, error) {
+			exists, err := c.clusterExists(name)
+			return !exists, err
+		})
+}
+
+// ClusterStatus prints whether the cluster exists and, when it does,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *KIND) ClusterStatus(*kingpin.ParseContext) error {
+	name := c.DeploymentVars["CLUSTER_NAME"]
+	s := &k8sProvider.ClusterStatus{Name: name, State: "NOT_FOUND"}
+	exists, err := c.clusterExists(name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		s.State = "RUNNING"
+		k8s, err := c.clusterK8sProvider(name)
+		if err != nil {
+			return err
+		}
+		if err := k8s.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
+// clusterExists checks whether a cluster with the given name exists.
+func (c *KIND) clusterExists(name string) (bool, error) {
+	clusters, err := c.kindProvider.List()
+	if err != nil {
+		return false, errors.Wrap(err, "listing clusters")
+	}
+	for _, cluster := range clusters {
+		if cluster == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// clusterRunning checks whether a cluster exists and is usable.
+func (c *KIND) clusterRunning(name string) (bool, error) {
+	exists, err := c.clusterExists(name)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	k8s, err := c.clusterK8sProvider(name)
+	if err != nil {
+		log.Printf("Cluster '%v' kubeconfig not available yet: %v", name, err)
+		return false, nil
+	}
+
+	// The API server isn't reachable for a while after the cluster creation
+	// so don't consider this a failure.
+	if ready, err := k8s.NodesReady(); err != nil || !ready {
+		if err != nil {
+			log.Printf("Cluster '%v' not ready: %v", name, err)
+		}
+		return false, nil
+	}
+	return k8s.DeploymentAvailable("kube-system", "coredns")
+}
+
+// KubeconfigExport writes the kubeconfig of a cluster to a file or stdout.
+func (c *KIND) KubeconfigExport(*kingpin.ParseContext) error {
+	name := c.KubeconfigName
+	if name == "" {
+		name = c.DeploymentVars["CLUSTER_NAME"]
+	}
+	if name == "" {
+		return fmt.Errorf("missing cluster name, set --name or the CLUSTER_NAME variable")
+	}
+
+	if c.KubeconfigMerge {
+		if c.KubeconfigOutput == "" {
+			return fmt.Errorf("merging requires an --output kubeconfig file")
+		}
+		if err := c.kindProvider.ExportKubeConfig(name, c.KubeconfigOutput); err != nil {
+			return errors.Wrapf(err, "merging the kubeconfig for cluster:%v into %v", name, c.KubeconfigOutput)
+		}
+		log.Printf("Kubeconfig for cluster '%v' merged into %v", name, c.KubeconfigOutput)
+		return nil
+	}
+
+	kubeconfig, err := c.kindProvider.KubeConfig(name, false)
+	if err != nil {
+		return errors.Wrapf(err, "getting the kubeconfig for cluster:%v", name)
+	}
+	if c.KubeconfigOutput == "" {
+		fmt.Print(kubeconfig)
+		return nil
+	}
+	if err := ioutil.WriteFile(c.KubeconfigOutput, []byte(kubeconfig), 0600); err != nil {
+		return errors.Wrapf(err, "writing the kubeconfig to %v", c.KubeconfigOutput)
+	}
+	log.Printf("Kubeconfig for cluster '%v' written to %v", name, c.KubeconfigOutput)
+	return nil
+}
+
+// clusterK8sProvider returns a k8s provider for the given cluster
+// using the kubeconfig from the kind provider.
+func (c *KIND) clusterK8sProvider(name string) (*k8sProvider.K8s, error) {
+	kubeconfig, err := c.kindProvider.KubeConfig(name, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting the kubeconfig for cluster:%v", name)
+	}
+	apiConfig, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing the cluster kubeconfig")
+	}
+	return k8sProvider.New(c.ctx, apiConfig)
+}
+
+// ImageLoad loads the local container images and image tarballs onto all cluster nodes.
+func (c *KIND) ImageLoad(*kingpin.ParseContext) error {
+	name := c.DeploymentVars["CLUSTER_NAME"]
+	if name == "" {
+		return fmt.Errorf("missing required CLUSTER_NAME variable")
+	}
+	if len(c.Images) == 0 && len(c.ImageArchives) == 0 {
+		return fmt.Errorf("missing image(s) or image archive(s) to load")
+	}
+	if provider.DryRun {
+		return provider.DryRunRequest(fmt.Sprintf("load images %v and image archives %v onto cluster %v", c.Images, c.ImageArchives, name), nil)
+	}
+
+	if len(c.Images) > 0 {
+		if err := c.LoadImages(name, c.Images...); err != nil {
+			return err
+		}
+	}
+	return c.LoadImageArchives(name, c.ImageArchives...)
+}
+
+// LoadImages loads local container images onto all nodes of the given cluster.
+func (c *KIND) LoadImages(name string, images ...string) error {
+	dir, err := ioutil.TempDir("", "kind-images")
+	if err != nil {
+		return errors.Wrap(err, "could not create temp dir")
+	}
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "images.tar")
+	log.Printf("Saving images %v", images)
+	if out, err := exec.Command(c.Runtime, append([]string{"save", "-o", archive}, images...)...).CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "saving images %v: %s", images, out)
+	}
+	return c.LoadImageArchives(name, archive)
+}
+
+// LoadImageArchives loads image tarballs onto all nodes of the given cluster.
+func (c *KIND) LoadImageArchives(name string, archives ...string) error {
+	nodes, err := c.kindProvider.ListInternalNodes(name)
+	if err != nil {
+		return errors.Wrapf(err, "listing nodes for cluster:%v", name)
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no nodes found for cluster:%v", name)
+	}
+
+	for _, archive := range archives {
+		for _, node := range nodes {
+			log.Printf("Loading image archive '%v' onto node '%v'", archive, node.String())
+			if err := loadImageArchive(node, archive); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func loadImageArchive(node nodes.Node, archive string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return errors.Wrapf(err, "opening image archive %v", archive)
+	}
+	defer f.Close()
+	if err := nodeutils.LoadImageArchive(node, f); err != nil {
+		return errors.Wrapf(err, "loading image archive %v onto node %v", archive, node.String())
+	}
+	return nil
+}
+
 // NewK8sProvider sets the k8s provider used for deploying k8s manifests.
 func (c *KIND) NewK8sProvider(*kingpin.ParseContext) error {
 	var err error
-	apiConfig, err := clientcmd.LoadFromFile(c.kubeconfig)
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if c.Kubeconfig != "" {
+		loadingRules.ExplicitPath = c.Kubeconfig
+	}
+	apiConfig, err := loadingRules.Load()
 	if err != nil {
 		return err
 	}
@@ -187,20 +743,73 @@ func (c *KIND) NewK8sProvider(*kingpin.ParseContext) error {
 
 // ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
 func (c *KIND) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
 	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
 		return err
 	}
 	return nil
 }
 
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *KIND) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	return c.k8sProvider.ResourceDiff(c.k8sResources)
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *KIND) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	return c.k8sProvider.ResourceLogs(c.k8sResources)
+}
+
 // ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
 func (c *KIND) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
 	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
 		return err
 	}
 	return nil
 }
 
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *KIND) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *KIND) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
+	}
+	return nil
+}
+
 // GetDeploymentVars shows deployment variables.
 func (c *KIND) GetDeploymentVars(parseContext *kingpin.ParseContext) error {
 	fmt.Print("-------------------\n   DeploymentVars   \n------------------- \n")
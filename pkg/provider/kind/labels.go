@@ -0,0 +1,95 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kind
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"sigs.k8s.io/kind/pkg/cluster/nodes"
+	"sigs.k8s.io/kind/pkg/cluster/nodeutils"
+)
+
+// labelsFile is the file of the bootstrap control plane node holding the provider.ResourceLabels of the clusters created by infra.
+// KIND doesn't support labeling clusters so this file marks the clusters which the garbage collection can delete.
+const labelsFile = "/kind/infra-labels"
+
+// writeLabels marks the cluster as created by infra.
+func (c *KIND) writeLabels(name string) error {
+	node, err := c.bootstrapNode(name)
+	if err != nil {
+		return err
+	}
+	labels := formatLabels(provider.ResourceLabels(c.DeploymentVars["OWNER"], time.Now()))
+	if err := node.Command("tee", labelsFile).SetStdin(strings.NewReader(labels)).SetStdout(&bytes.Buffer{}).Run(); err != nil {
+		return errors.Wrapf(err, "writing the labels of cluster:%v", name)
+	}
+	return nil
+}
+
+// readLabels returns the labels of a cluster created by infra, nil for the other clusters.
+func (c *KIND) readLabels(name string) (map[string]string, error) {
+	node, err := c.bootstrapNode(name)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := node.Command("sh", "-c", fmt.Sprintf("test ! -f %[1]v || cat %[1]v", labelsFile)).SetStdout(&out).Run(); err != nil {
+		return nil, errors.Wrapf(err, "reading the labels of cluster:%v", name)
+	}
+	return parseLabels(out.String()), nil
+}
+
+func (c *KIND) bootstrapNode(name string) (nodes.Node, error) {
+	all, err := c.kindProvider.ListNodes(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing nodes for cluster:%v", name)
+	}
+	node, err := nodeutils.BootstrapControlPlaneNode(all)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cluster:%v", name)
+	}
+	return node, nil
+}
+
+// formatLabels returns the labels as key=value lines.
+func formatLabels(labels map[string]string) string {
+	lines := make([]string, 0, len(labels))
+	for k, v := range labels {
+		lines = append(lines, k+"="+v+"\n")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+// parseLabels returns the labels of the key=value lines, nil when there are none.
+func parseLabels(s string) map[string]string {
+	var labels map[string]string
+	for _, line := range strings.Split(s, "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[kv[0]] = kv[1]
+	}
+	return labels
+}
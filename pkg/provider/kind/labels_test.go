@@ -0,0 +1,39 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kind
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+func TestLabels(t *testing.T) {
+	created := time.Now().Add(-7 * time.Hour)
+	labels := provider.ResourceLabels("ci", created)
+	parsed := parseLabels(formatLabels(labels))
+	if !reflect.DeepEqual(labels, parsed) {
+		t.Fatalf("expected the labels %v, got %v", labels, parsed)
+	}
+	if !provider.Expired(parsed, 6*time.Hour, time.Now()) {
+		t.Errorf("expected the cluster created at %v to be expired", created)
+	}
+
+	// The clusters which weren't created by infra have no labels file.
+	if parsed := parseLabels(""); parsed != nil || provider.Expired(parsed, 6*time.Hour, time.Now()) {
+		t.Errorf("expected a cluster without labels to be kept, got the labels %v", parsed)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kind
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
+	"golang.org/x/perf/benchstat"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// selfTestCluster is the config of the single node cluster of the self test.
+const selfTestCluster = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+- role: control-plane
+`
+
+// selfTestNamespace is the namespace of the selfTestManifests.
+const selfTestNamespace = "infra-selftest"
+
+// selfTestManifests are the objects applied by the self test, the mock benchmark polls the deployment.
+const selfTestManifests = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: infra-selftest
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: selftest
+  namespace: infra-selftest
+data:
+  benchmark: mock
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: selftest
+  namespace: infra-selftest
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: selftest
+  template:
+    metadata:
+      labels:
+        app: selftest
+    spec:
+      containers:
+      - name: pause
+        image: k8s.gcr.io/pause:3.2
+`
+
+// SelfTest creates a small cluster, applies a minimal set of manifests, runs a mock benchmark
+// polling the API server, publishes its result to the results directory and deletes the cluster,
+// to verify the whole toolchain with one command after an upgrade or a config change.
+// The cluster is deleted even when a step fails, unless SelfTestKeep is set.
+func (c *KIND) SelfTest(*kingpin.ParseContext) error {
+	if provider.DryRun {
+		return errors.New("the self test creates a real cluster and can't run in dry-run mode")
+	}
+	name := c.SelfTestName
+	c.DeploymentVars = map[string]string{"CLUSTER_NAME": name}
+	c.kindResources = []Resource{{FileName: "selftest-cluster.yaml", Content: []byte(selfTestCluster)}}
+	c.Recreate = true
+
+	var (
+		k8s     *k8sProvider.K8s
+		objects []k8sProvider.Resource
+		result  string
+	)
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"create cluster", func() error {
+			return c.ClusterCreate(nil)
+		}},
+		{"apply manifests", func() error {
+			var err error
+			if k8s, err = c.clusterK8sProvider(name); err != nil {
+				return err
+			}
+			o, err := k8sProvider.DecodeObjects("selftest.yaml", []byte(selfTestManifests))
+			if err != nil {
+				return err
+			}
+			objects = []k8sProvider.Resource{{FileName: "selftest.yaml", Objects: o}}
+			return k8s.ResourceApply(objects)
+		}},
+		{"run mock benchmark", func() error {
+			var err error
+			result, err = mockBenchmark(k8s, c.SelfTestDuration)
+			return err
+		}},
+		{"publish result", func() error {
+			file, err := publishSelfTestResult(c.SelfTestResultsDir, result, time.Now())
+			if err != nil {
+				return err
+			}
+			log.Printf("Published the result to %v", file)
+			return nil
+		}},
+		{"delete manifests", func() error {
+			return k8s.ResourceDelete(objects)
+		}},
+	}
+
+	var (
+		durations []time.Duration
+		failed    error
+	)
+	for i, step := range steps {
+		log.Printf("Self test step %v/%v: %v", i+1, len(steps)+1, step.name)
+		start := time.Now()
+		err := step.run()
+		durations = append(durations, time.Since(start))
+		if err != nil {
+			failed = errors.Wrapf(err, "self test step %q failed", step.name)
+			break
+		}
+	}
+
+	if c.SelfTestKeep && failed != nil {
+		log.Printf("Keeping the cluster '%v' to debug the failure, delete it with: kind delete cluster --name %v", name, name)
+	} else {
+		log.Printf("Self test step %v/%v: delete cluster", len(steps)+1, len(steps)+1)
+		start := time.Now()
+		if err := c.delete(name); err != nil && failed == nil {
+			failed = errors.Wrap(err, `self test step "delete cluster" failed`)
+		}
+		durations = append(durations, time.Since(start))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tDURATION")
+	for i, d := range durations {
+		step := "delete cluster"
+		if i < len(steps) {
+			step = steps[i].name
+		}
+		fmt.Fprintf(w, "%v\t%v\n", step, d.Round(time.Second))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed != nil {
+		return failed
+	}
+	log.Printf("Self test passed")
+	return nil
+}
+
+// mockBenchmark polls the deployment of the self test for the duration
+// and returns the latency of the requests in the go benchmark format.
+func mockBenchmark(k8s *k8sProvider.K8s, duration time.Duration) (string, error) {
+	var latencies []time.Duration
+	end := time.Now().Add(duration)
+	for time.Now().Before(end) {
+		start := time.Now()
+		available, err := k8s.DeploymentAvailable(selfTestNamespace, "selftest")
+		if err != nil {
+			return "", err
+		}
+		if !available {
+			return "", errors.New("the deployment of the self test isn't available")
+		}
+		latencies = append(latencies, time.Since(start))
+		time.Sleep(100 * time.Millisecond)
+	}
+	if len(latencies) == 0 {
+		return "", errors.New("no requests sent during the mock benchmark")
+	}
+	return benchmarkResult(latencies), nil
+}
+
+// benchmarkResult formats the mean and the 99th percentile of the latencies as go benchmark results,
+// the format of the results directory of funcbench read by benchTrend.
+func benchmarkResult(latencies []time.Duration) string {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, l := range sorted {
+		sum += l
+	}
+	p99 := sorted[(len(sorted)*99+99)/100-1]
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "goos: %v\ngoarch: %v\npkg: github.com/prometheus/test-infra/selftest\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "BenchmarkSelfTest/deployment-get\t%d\t%d ns/op\t%d p99-ns\n", len(sorted), int64(sum)/int64(len(sorted)), int64(p99))
+	return b.String()
+}
+
+// publishSelfTestResult writes the result to a new file of the results directory
+// and checks that it can be read back as benchmark results.
+func publishSelfTestResult(dir, result string, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", errors.Wrap(err, "creating the results directory")
+	}
+	file := filepath.Join(dir, fmt.Sprintf("selftest-%v.out", now.UTC().Format("20060102T150405")))
+	if err := ioutil.WriteFile(file, []byte(result), 0644); err != nil {
+		return "", errors.Wrap(err, "writing the result")
+	}
+
+	if err := checkResult(file); err != nil {
+		// Don't leave a broken result for the readers of the results directory.
+		os.Remove(file)
+		return "", err
+	}
+	return file, nil
+}
+
+// checkResult checks that the file can be read as benchmark results.
+func checkResult(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrap(err, "reading the published result")
+	}
+	defer f.Close()
+	collection := &benchstat.Collection{}
+	if err := collection.AddFile(filepath.Base(file), f); err != nil {
+		return errors.Wrapf(err, "parsing the published result %v", file)
+	}
+	if len(collection.Metrics) == 0 {
+		return errors.Errorf("no benchmark results in the published result %v", file)
+	}
+	return nil
+}
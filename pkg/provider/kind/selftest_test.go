@@ -0,0 +1,56 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kind
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishSelfTestResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_selftest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	result := benchmarkResult(latencies)
+	if !strings.Contains(result, "BenchmarkSelfTest/deployment-get\t100\t50500000 ns/op\t99000000 p99-ns\n") {
+		t.Errorf("unexpected result:\n%v", result)
+	}
+
+	resultsDir := filepath.Join(dir, "results")
+	file, err := publishSelfTestResult(resultsDir, result, time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(resultsDir, "selftest-20200601T120000.out"); file != expected {
+		t.Errorf("expected the result to be published to %v, got %v", expected, file)
+	}
+
+	if _, err := publishSelfTestResult(resultsDir, "no results\n", time.Now()); err == nil {
+		t.Error("expected an error for a result without benchmarks")
+	}
+	if files, _ := ioutil.ReadDir(resultsDir); len(files) != 1 {
+		t.Errorf("expected the broken result to be removed, got %v files", len(files))
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+)
+
+// kustomizationFiles are the names of the kustomization file of a directory.
+var kustomizationFiles = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// isKustomization returns true when the file is a kustomization file.
+func isKustomization(name string) bool {
+	for _, k := range kustomizationFiles {
+		if filepath.Base(name) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// kustomizationFile returns the kustomization file of the directory, empty when it has none.
+func kustomizationFile(dir string) string {
+	for _, name := range kustomizationFiles {
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// kustomizeFS is the file system of the kustomizations, where the files are read with readFile.
+type kustomizeFS struct {
+	filesys.FileSystem
+
+	readFile func(name string) ([]byte, error)
+	// undefinedErr is the first undefined variables error of the files,
+	// kustomize wraps the errors of the files so their cause is lost.
+	undefinedErr error
+}
+
+func (fs *kustomizeFS) ReadFile(name string) ([]byte, error) {
+	content, err := fs.readFile(name)
+	if _, ok := err.(*undefinedVarsError); ok && fs.undefinedErr == nil {
+		fs.undefinedErr = err
+	}
+	return content, err
+}
+
+// buildKustomization builds the kustomization of the directory with kustomize, like kustomize build,
+// and returns the objects as yaml documents.
+// Every file is read with readFile, which applies the template variables.
+func buildKustomization(dir string, readFile func(name string) ([]byte, error)) ([]byte, error) {
+	fs := &kustomizeFS{FileSystem: filesys.MakeFsOnDisk(), readFile: readFile}
+	objects, err := krusty.MakeKustomizer(fs, krusty.MakeDefaultOptions()).Run(dir)
+	if fs.undefinedErr != nil {
+		return nil, fs.undefinedErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := objects.AsYaml()
+	return content, errors.Wrap(err, "marshal the objects")
+}
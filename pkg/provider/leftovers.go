@@ -0,0 +1,55 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Leftover is a resource which still exists after the teardown that should have removed it.
+type Leftover struct {
+	Kind string
+	Name string
+	// Reason tells why the resource belongs to the deleted run, e.g. its matching label.
+	Reason string
+}
+
+func (l Leftover) String() string {
+	return fmt.Sprintf("%v %v (%v)", l.Kind, l.Name, l.Reason)
+}
+
+// ReportLeftovers reports the resources of the deleted run that were left behind.
+// Leaked resources are billed until someone notices them, so they are logged loudly
+// and returned as an error which fails the teardown.
+func ReportLeftovers(run string, leftovers []Leftover) error {
+	if len(leftovers) == 0 {
+		log.Printf("Cleanup of %v verified, no resources left behind", run)
+		return nil
+	}
+	var names []string
+	log.Printf("!!! %d resources of %v were left behind and are possibly still billed, delete them manually:", len(leftovers), run)
+	for _, l := range leftovers {
+		log.Printf("!!!   %v", l)
+		names = append(names, l.String())
+	}
+	return fmt.Errorf("%d resources of %v left behind: %v", len(leftovers), run, strings.Join(names, ", "))
+}
+
+// CleanupUnverified logs that the cleanup of the run couldn't be verified.
+// It doesn't fail the teardown which itself succeeded.
+func CleanupUnverified(run string, err error) {
+	log.Printf("!!! Couldn't verify the cleanup of %v, check for leftover resources manually: %v", run, err)
+}
@@ -0,0 +1,299 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package magnum
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+// Credentials are the keystone v3 credentials, using the keys of the auth section of clouds.yaml.
+// Either a username and password or an application credential are required.
+type Credentials struct {
+	AuthURL                     string `yaml:"auth_url"`
+	Username                    string `yaml:"username,omitempty"`
+	Password                    string `yaml:"password,omitempty"`
+	UserDomainName              string `yaml:"user_domain_name,omitempty"`
+	ProjectName                 string `yaml:"project_name,omitempty"`
+	ProjectID                   string `yaml:"project_id,omitempty"`
+	ProjectDomainName           string `yaml:"project_domain_name,omitempty"`
+	ApplicationCredentialID     string `yaml:"application_credential_id,omitempty"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret,omitempty"`
+	RegionName                  string `yaml:"region_name,omitempty"`
+}
+
+// Cluster is a Magnum cluster.
+// https://docs.openstack.org/magnum/latest/api/#clusters
+type Cluster struct {
+	UUID              string            `json:"uuid,omitempty" yaml:"-"`
+	Name              string            `json:"name" yaml:"name"`
+	ClusterTemplateID string            `json:"cluster_template_id,omitempty" yaml:"clustertemplate"`
+	Keypair           string            `json:"keypair,omitempty" yaml:"keypair,omitempty"`
+	MasterCount       int               `json:"master_count,omitempty" yaml:"mastercount,omitempty"`
+	NodeCount         int               `json:"node_count,omitempty" yaml:"nodecount,omitempty"`
+	MasterFlavorID    string            `json:"master_flavor_id,omitempty" yaml:"masterflavor,omitempty"`
+	FlavorID          string            `json:"flavor_id,omitempty" yaml:"flavor,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	MergeLabels       bool              `json:"merge_labels,omitempty" yaml:"mergelabels,omitempty"`
+	CreateTimeout     int               `json:"create_timeout,omitempty" yaml:"createtimeout,omitempty"`
+	Status            string            `json:"status,omitempty" yaml:"-"`
+	StatusReason      string            `json:"status_reason,omitempty" yaml:"-"`
+	APIAddress        string            `json:"api_address,omitempty" yaml:"-"`
+}
+
+// NodeGroup is a group of worker nodes of a Magnum cluster.
+// The Labels are passed to the Magnum driver, the NodeLabels are set on the k8s nodes by infra.
+type NodeGroup struct {
+	UUID         string            `json:"uuid,omitempty" yaml:"-"`
+	Name         string            `json:"name" yaml:"name"`
+	FlavorID     string            `json:"flavor_id,omitempty" yaml:"flavor,omitempty"`
+	NodeCount    int               `json:"node_count" yaml:"nodecount"`
+	MinNodeCount int               `json:"min_node_count,omitempty" yaml:"minnodecount,omitempty"`
+	MaxNodeCount int               `json:"max_node_count,omitempty" yaml:"maxnodecount,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	MergeLabels  bool              `json:"merge_labels,omitempty" yaml:"mergelabels,omitempty"`
+	NodeLabels   map[string]string `json:"-" yaml:"nodelabels,omitempty"`
+	Status       string            `json:"status,omitempty" yaml:"-"`
+	StatusReason string            `json:"status_reason,omitempty" yaml:"-"`
+}
+
+// notFoundError is returned when the requested cluster or node group doesn't exist.
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func isNotFound(err error) bool {
+	_, ok := err.(*notFoundError)
+	return ok
+}
+
+// client is a minimal client for the Magnum API authenticated with a keystone token.
+type client struct {
+	ctx      context.Context
+	http     *http.Client
+	token    string
+	endpoint string
+}
+
+// newClient requests a keystone token and finds the Magnum endpoint in the service catalog.
+func newClient(ctx context.Context, creds *Credentials) (*client, error) {
+	c := &client{ctx: ctx, http: &http.Client{Transport: provider.RetryTransport(http.DefaultTransport)}}
+
+	resp, err := c.request(http.MethodPost, strings.TrimSuffix(creds.AuthURL, "/")+"/auth/tokens", tokenRequest(creds))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("keystone authentication failed: %v %s", resp.Status, content)
+	}
+	c.token = resp.Header.Get("X-Subject-Token")
+
+	var token struct {
+		Token struct {
+			Catalog []struct {
+				Type      string `json:"type"`
+				Endpoints []struct {
+					Interface string `json:"interface"`
+					Region    string `json:"region_id"`
+					URL       string `json:"url"`
+				} `json:"endpoints"`
+			} `json:"catalog"`
+		} `json:"token"`
+	}
+	if err := json.Unmarshal(content, &token); err != nil {
+		return nil, err
+	}
+	for _, service := range token.Token.Catalog {
+		if service.Type != "container-infra" {
+			continue
+		}
+		for _, e := range service.Endpoints {
+			if e.Interface == "public" && (creds.RegionName == "" || e.Region == creds.RegionName) {
+				c.endpoint = strings.TrimSuffix(e.URL, "/")
+				return c, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no public container-infra endpoint in the service catalog for region %q", creds.RegionName)
+}
+
+// tokenRequest returns the body of a keystone v3 token request.
+func tokenRequest(creds *Credentials) interface{} {
+	type m = map[string]interface{}
+
+	if creds.ApplicationCredentialID != "" {
+		return m{"auth": m{"identity": m{
+			"methods": []string{"application_credential"},
+			"application_credential": m{
+				"id":     creds.ApplicationCredentialID,
+				"secret": creds.ApplicationCredentialSecret,
+			},
+		}}}
+	}
+
+	project := m{"id": creds.ProjectID}
+	if creds.ProjectID == "" {
+		project = m{"name": creds.ProjectName, "domain": m{"name": creds.ProjectDomainName}}
+	}
+	return m{"auth": m{
+		"identity": m{
+			"methods": []string{"password"},
+			"password": m{"user": m{
+				"name":     creds.Username,
+				"password": creds.Password,
+				"domain":   m{"name": creds.UserDomainName},
+			}},
+		},
+		"scope": m{"project": project},
+	}}
+}
+
+func (c *client) request(method, url string, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c.ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	// Node groups require the container-infra API 1.9 or newer.
+	req.Header.Set("OpenStack-API-Version", "container-infra latest")
+	if c.token != "" {
+		req.Header.Set("X-Auth-Token", c.token)
+	}
+	return c.http.Do(req)
+}
+
+// do sends the request to the Magnum endpoint and decodes the json response into out when it is not nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	resp, err := c.request(method, c.endpoint+path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return &notFoundError{msg: fmt.Sprintf("%v %v: not found", method, path)}
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%v %v: %v %s", method, path, resp.Status, content)
+	}
+	if out == nil || len(content) == 0 {
+		return nil
+	}
+	return json.Unmarshal(content, out)
+}
+
+// change sends a request that changes a cluster or nodepool.
+// In dry-run mode the request is only printed.
+func (c *client) change(method, path string, in, out interface{}) error {
+	if provider.DryRun {
+		return provider.DryRunRequest(method+" "+c.endpoint+path, in)
+	}
+	if err := provider.Chaos(method + " " + path); err != nil {
+		return err
+	}
+	return c.do(method, path, in, out)
+}
+
+func (c *client) createCluster(cluster *Cluster) (string, error) {
+	var resp struct {
+		UUID string `json:"uuid"`
+	}
+	if err := c.change(http.MethodPost, "/v1/clusters", cluster, &resp); err != nil {
+		return "", err
+	}
+	return resp.UUID, nil
+}
+
+// getCluster returns the cluster by its name or uuid.
+func (c *client) getCluster(ident string) (*Cluster, error) {
+	cluster := &Cluster{}
+	if err := c.do(http.MethodGet, "/v1/clusters/"+ident, nil, cluster); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (c *client) deleteCluster(ident string) error {
+	return c.change(http.MethodDelete, "/v1/clusters/"+ident, nil, nil)
+}
+
+func (c *client) createNodeGroup(cluster string, ng *NodeGroup) error {
+	return c.change(http.MethodPost, "/v1/clusters/"+cluster+"/nodegroups", ng, nil)
+}
+
+func (c *client) getNodeGroup(cluster, name string) (*NodeGroup, error) {
+	ng := &NodeGroup{}
+	if err := c.do(http.MethodGet, "/v1/clusters/"+cluster+"/nodegroups/"+name, nil, ng); err != nil {
+		return nil, err
+	}
+	return ng, nil
+}
+
+func (c *client) deleteNodeGroup(cluster, name string) error {
+	return c.change(http.MethodDelete, "/v1/clusters/"+cluster+"/nodegroups/"+name, nil, nil)
+}
+
+// clusterCA returns the pem encoded CA certificate of the cluster.
+func (c *client) clusterCA(clusterUUID string) ([]byte, error) {
+	var resp struct {
+		PEM string `json:"pem"`
+	}
+	if err := c.do(http.MethodGet, "/v1/certificates/"+clusterUUID, nil, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.PEM), nil
+}
+
+// signCertificate returns the pem encoded certificate for the csr signed by the cluster CA.
+func (c *client) signCertificate(clusterUUID string, csr []byte) ([]byte, error) {
+	var resp struct {
+		PEM string `json:"pem"`
+	}
+	req := map[string]string{"cluster_uuid": clusterUUID, "csr": string(csr)}
+	if err := c.do(http.MethodPost, "/v1/certificates", req, &resp); err != nil {
+		return nil, err
+	}
+	return []byte(resp.PEM), nil
+}
@@ -0,0 +1,687 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package magnum
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+	yamlGo "gopkg.in/yaml.v2"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+type Resource = provider.Resource
+
+// nodeGroupLabel is set by the Magnum kubernetes driver on the nodes of each node group.
+const nodeGroupLabel = "magnum.openstack.org/nodegroup"
+
+// magnumCluster is the format of the cluster and node group deployment files.
+type magnumCluster struct {
+	Cluster    Cluster     `yaml:"cluster"`
+	NodeGroups []NodeGroup `yaml:"nodegroups"`
+}
+
+// Magnum holds the fields used to generate an API request.
+type Magnum struct {
+	// The keystone credentials used to authenticate the cli.
+	// Can be a file path or an env variable that includes the credentials yaml.
+	Auth string
+	// The client used when performing Magnum API requests.
+	clientMagnum *client
+	// The k8s provider used when we work with the manifest files.
+	k8sProvider *k8sProvider.K8s
+	// Final DeploymentFiles files.
+	DeploymentFiles []string
+	// Final DeploymentVars.
+	DeploymentVars map[string]string
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Content bytes after parsing the template variables, grouped by filename.
+	magnumResources []Resource
+	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
+	k8sResources []k8sProvider.Resource
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
+
+	ctx context.Context
+}
+
+// New is the Magnum constructor.
+func New(dr *provider.DeploymentResource) *Magnum {
+	return &Magnum{
+		DeploymentResource: dr,
+		ctx:                provider.Context(),
+	}
+}
+
+// NewMagnumClient sets the client used when performing Magnum API requests.
+// Without the auth flag the credentials are read from the OS_* env variables set by the OpenStack RC file.
+func (c *Magnum) NewMagnumClient(*kingpin.ParseContext) error {
+	creds := &Credentials{
+		AuthURL:                     os.Getenv("OS_AUTH_URL"),
+		Username:                    os.Getenv("OS_USERNAME"),
+		Password:                    os.Getenv("OS_PASSWORD"),
+		UserDomainName:              os.Getenv("OS_USER_DOMAIN_NAME"),
+		ProjectName:                 os.Getenv("OS_PROJECT_NAME"),
+		ProjectID:                   os.Getenv("OS_PROJECT_ID"),
+		ProjectDomainName:           os.Getenv("OS_PROJECT_DOMAIN_NAME"),
+		ApplicationCredentialID:     os.Getenv("OS_APPLICATION_CREDENTIAL_ID"),
+		ApplicationCredentialSecret: os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"),
+		RegionName:                  os.Getenv("OS_REGION_NAME"),
+	}
+
+	if c.Auth != "" {
+		// When the auth variable points to a file
+		// put the file content in the variable.
+		if content, err := ioutil.ReadFile(c.Auth); err == nil {
+			c.Auth = string(content)
+		}
+		creds = &Credentials{}
+		if err := yamlGo.UnmarshalStrict([]byte(c.Auth), creds); err != nil {
+			return errors.Wrap(err, "parsing the auth credentials")
+		}
+	}
+	if creds.AuthURL == "" {
+		return errors.Errorf("no auth provided set the auth flag or the OS_AUTH_URL and credentials env variables")
+	}
+
+	var err error
+	if c.clientMagnum, err = newClient(c.ctx, creds); err != nil {
+		return errors.Wrap(err, "could not create the Magnum client")
+	}
+	return nil
+}
+
+// SetupDeploymentResources Sets up DeploymentVars and DeploymentFiles
+func (c *Magnum) SetupDeploymentResources(*kingpin.ParseContext) error {
+	c.DeploymentFiles = c.DeploymentResource.DeploymentFiles
+	c.DeploymentVars = provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	)
+	return nil
+}
+
+// checkDeploymentVarsAndFiles checks whether the requied deployment vars are passed.
+func (c *Magnum) checkDeploymentVarsAndFiles() error {
+	reqDepVars := []string{"CLUSTER_NAME"}
+	for _, k := range reqDepVars {
+		if v := c.DeploymentVars[k]; v == "" {
+			return fmt.Errorf("missing required %v variable", k)
+		}
+	}
+	if len(c.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+	return nil
+}
+
+// MagnumDeploymentsParse parses the cluster/node group deployment files and saves the result as bytes grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *Magnum) MagnumDeploymentsParse(*kingpin.ParseContext) error {
+	if err := c.checkDeploymentVarsAndFiles(); err != nil {
+		return err
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	c.magnumResources = deploymentResource
+	return nil
+}
+
+// K8SDeploymentsParse parses the k8s objects deployment files and saves the result as k8s objects grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *Magnum) K8SDeploymentsParse(*kingpin.ParseContext) error {
+	if err := c.checkDeploymentVarsAndFiles(); err != nil {
+		return err
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	for _, deployment := range deploymentResource {
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
+		}
+		if len(k8sObjects) > 0 {
+			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
+		}
+	}
+	return nil
+}
+
+// parseCluster returns the cluster and node groups of a deployment file.
+func parseCluster(deployment Resource) (*magnumCluster, error) {
+	req := &magnumCluster{}
+	if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
+		return nil, errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
+	}
+	if req.Cluster.Name == "" {
+		return nil, fmt.Errorf("missing cluster name in the deployment file %s", deployment.FileName)
+	}
+	return req, nil
+}
+
+// ClusterCreate creates a new cluster from a cluster template
+// and then the node groups in the deployment files.
+func (c *Magnum) ClusterCreate(*kingpin.ParseContext) error {
+	for _, deployment := range c.magnumResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+
+		cluster := req.Cluster
+		if cluster.ClusterTemplateID == "" {
+			return fmt.Errorf("missing cluster template for cluster '%v', file:%v", cluster.Name, deployment.FileName)
+		}
+
+		log.Printf("Cluster create request: name:'%s', template:'%s'", cluster.Name, cluster.ClusterTemplateID)
+		uuid, err := c.clientMagnum.createCluster(&cluster)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't create cluster '%v', file:%v", cluster.Name, deployment.FileName)
+		}
+		if provider.DryRun {
+			if err := c.nodeGroupsCreate(cluster.Name, req.NodeGroups); err != nil {
+				return errors.Wrapf(err, "file:%v", deployment.FileName)
+			}
+			continue
+		}
+		// A cluster still being created when the command is interrupted is deleted together with its node groups.
+		name := cluster.Name
+		done := provider.OnInterrupt(fmt.Sprintf("deleting the cluster:%v being created", name), func(ctx context.Context) error {
+			c.clientMagnum.ctx = ctx
+			return c.deleteCluster(&Cluster{UUID: uuid, Name: name})
+		})
+
+		err = provider.RetryUntilTrue(
+			fmt.Sprintf("creating cluster:%v", cluster.Name),
+			provider.MagnumRetryCount,
+			func() (bool, error) { return c.clusterRunning(uuid) },
+		)
+		if err != nil {
+			return errors.Wrap(err, "creating cluster")
+		}
+
+		if err := c.nodeGroupsCreate(cluster.Name, req.NodeGroups); err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+		done()
+	}
+	return nil
+}
+
+// ClusterDelete deletes a cluster together with its node groups.
+func (c *Magnum) ClusterDelete(*kingpin.ParseContext) error {
+	for _, deployment := range c.magnumResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+
+		cluster, err := c.clientMagnum.getCluster(req.Cluster.Name)
+		if err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+
+		if err := c.deleteCluster(cluster); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCluster deletes the cluster and waits until it is removed.
+func (c *Magnum) deleteCluster(cluster *Cluster) error {
+	log.Printf("Removing cluster '%v'", cluster.Name)
+	if err := c.clientMagnum.deleteCluster(cluster.UUID); err != nil {
+		return errors.Wrapf(err, "couldn't delete cluster '%v'", cluster.Name)
+	}
+	if provider.DryRun {
+		return nil
+	}
+
+	err := provider.RetryUntilTrue(
+		fmt.Sprintf("deleting cluster:%v", cluster.Name),
+		provider.MagnumRetryCount,
+		func() (bool, error) { return c.clusterDeleted(cluster.UUID) })
+	if err != nil {
+		return errors.Wrap(err, "removing cluster")
+	}
+	return nil
+}
+
+// clusterRunning checks whether a cluster is in a running state.
+func (c *Magnum) clusterRunning(ident string) (bool, error) {
+	cluster, err := c.clientMagnum.getCluster(ident)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "couldn't get cluster status")
+	}
+	switch {
+	case cluster.Status == "CREATE_COMPLETE" || cluster.Status == "UPDATE_COMPLETE":
+		return true, nil
+	case strings.HasSuffix(cluster.Status, "_FAILED") || strings.HasPrefix(cluster.Status, "DELETE_"):
+		return false, fmt.Errorf("Cluster not in a status to become ready - %s %s", cluster.Status, cluster.StatusReason)
+	}
+	log.Printf("Cluster '%v' status: %v", cluster.Name, cluster.Status)
+	return false, nil
+}
+
+// clusterDeleted checks whether a cluster is removed.
+func (c *Magnum) clusterDeleted(ident string) (bool, error) {
+	cluster, err := c.clientMagnum.getCluster(ident)
+	if err != nil {
+		if isNotFound(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, "couldn't get cluster status")
+	}
+	switch cluster.Status {
+	case "DELETE_COMPLETE":
+		return true, nil
+	case "DELETE_FAILED":
+		return false, fmt.Errorf("Cluster couldn't be deleted - %s", cluster.StatusReason)
+	}
+	log.Printf("Cluster '%v' status: %v", cluster.Name, cluster.Status)
+	return false, nil
+}
+
+// NodeGroupCreate creates new node groups in an existing cluster.
+func (c *Magnum) NodeGroupCreate(*kingpin.ParseContext) error {
+	for _, deployment := range c.magnumResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		if err := c.nodeGroupsCreate(req.Cluster.Name, req.NodeGroups); err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+	}
+	return nil
+}
+
+// nodeGroupsCreate creates the node groups one by one and sets the node labels on their nodes.
+func (c *Magnum) nodeGroupsCreate(clusterName string, nodeGroups []NodeGroup) error {
+	for _, ng := range nodeGroups {
+		log.Printf("Node group create request: name:'%s', cluster:'%s'", ng.Name, clusterName)
+		if err := c.clientMagnum.createNodeGroup(clusterName, &ng); err != nil {
+			return errors.Wrapf(err, "couldn't create node group '%v' for cluster '%v'", ng.Name, clusterName)
+		}
+		if provider.DryRun {
+			continue
+		}
+
+		name := ng.Name
+		err := provider.RetryUntilTrue(
+			fmt.Sprintf("creating node group:%v for cluster:%v", name, clusterName),
+			provider.MagnumRetryCount,
+			func() (bool, error) { return c.nodeGroupRunning(clusterName, name) },
+		)
+		if err != nil {
+			return errors.Wrap(err, "creating node group")
+		}
+
+		if err := c.nodeLabelsApply(clusterName, ng); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeLabelsApply sets the node labels of the node group on its k8s nodes.
+// Magnum labels only configure the driver so the scheduling labels are set through the k8s API.
+func (c *Magnum) nodeLabelsApply(clusterName string, ng NodeGroup) error {
+	if len(ng.NodeLabels) == 0 {
+		return nil
+	}
+	if c.k8sProvider == nil {
+		if err := c.newK8sProvider(clusterName); err != nil {
+			return err
+		}
+	}
+
+	selector := nodeGroupLabel + "=" + ng.Name
+	return provider.RetryUntilTrue(
+		fmt.Sprintf("labeling the nodes of node group:%v", ng.Name),
+		provider.GlobalRetryCount,
+		func() (bool, error) {
+			nodes, err := c.k8sProvider.NodesList(selector)
+			if err != nil {
+				return false, err
+			}
+			if len(nodes) < ng.NodeCount {
+				log.Printf("Node group '%v' has %v of %v nodes registered", ng.Name, len(nodes), ng.NodeCount)
+				return false, nil
+			}
+			for _, node := range nodes {
+				if err := c.k8sProvider.NodeLabelsUpdate(node.Name, ng.NodeLabels, nil); err != nil {
+					return false, errors.Wrapf(err, "labeling node %v", node.Name)
+				}
+			}
+			return true, nil
+		})
+}
+
+// NodeGroupDelete deletes node groups in an existing cluster.
+func (c *Magnum) NodeGroupDelete(*kingpin.ParseContext) error {
+	for _, deployment := range c.magnumResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		clusterName := req.Cluster.Name
+
+		for _, ng := range req.NodeGroups {
+			log.Printf("Node group delete request: name:'%s', cluster:'%s'", ng.Name, clusterName)
+			if err := c.clientMagnum.deleteNodeGroup(clusterName, ng.Name); err != nil {
+				if isNotFound(err) {
+					log.Printf("Node group '%v' for cluster '%v' doesn't exist", ng.Name, clusterName)
+					continue
+				}
+				return errors.Wrapf(err, "couldn't delete node group '%v' for cluster '%v', file:%v", ng.Name, clusterName, deployment.FileName)
+			}
+			if provider.DryRun {
+				continue
+			}
+
+			name := ng.Name
+			err = provider.RetryUntilTrue(
+				fmt.Sprintf("deleting node group:%v for cluster:%v", name, clusterName),
+				provider.MagnumRetryCount,
+				func() (bool, error) { return c.nodeGroupDeleted(clusterName, name) },
+			)
+			if err != nil {
+				return errors.Wrap(err, "deleting node group")
+			}
+		}
+	}
+	return nil
+}
+
+// nodeGroupRunning checks whether a node group is in a running state.
+func (c *Magnum) nodeGroupRunning(clusterName, name string) (bool, error) {
+	ng, err := c.clientMagnum.getNodeGroup(clusterName, name)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "couldn't get node group status")
+	}
+	switch {
+	case ng.Status == "CREATE_COMPLETE" || ng.Status == "UPDATE_COMPLETE":
+		return true, nil
+	case strings.HasSuffix(ng.Status, "_FAILED") || strings.HasPrefix(ng.Status, "DELETE_"):
+		return false, fmt.Errorf("Node group not in a status to become ready - %s %s", ng.Status, ng.StatusReason)
+	}
+	log.Printf("Node group '%v' for cluster '%v' status: %v", name, clusterName, ng.Status)
+	return false, nil
+}
+
+// nodeGroupDeleted checks whether a node group is removed.
+func (c *Magnum) nodeGroupDeleted(clusterName, name string) (bool, error) {
+	ng, err := c.clientMagnum.getNodeGroup(clusterName, name)
+	if err != nil {
+		if isNotFound(err) {
+			return true, nil
+		}
+		return false, errors.Wrap(err, "couldn't get node group status")
+	}
+	switch ng.Status {
+	case "DELETE_COMPLETE":
+		return true, nil
+	case "DELETE_FAILED":
+		return false, fmt.Errorf("Node group couldn't be deleted - %s", ng.StatusReason)
+	}
+	log.Printf("Node group '%v' for cluster '%v' status: %v", name, clusterName, ng.Status)
+	return false, nil
+}
+
+// AllNodeGroupsRunning returns an error if at least one node group is not running.
+func (c *Magnum) AllNodeGroupsRunning(*kingpin.ParseContext) error {
+	return c.checkNodeGroups(c.nodeGroupRunning, "not running")
+}
+
+// AllNodeGroupsDeleted returns an error if at least one node group is not deleted.
+func (c *Magnum) AllNodeGroupsDeleted(*kingpin.ParseContext) error {
+	return c.checkNodeGroups(c.nodeGroupDeleted, "not deleted")
+}
+
+func (c *Magnum) checkNodeGroups(check func(clusterName, name string) (bool, error), msg string) error {
+	for _, deployment := range c.magnumResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		for _, ng := range req.NodeGroups {
+			ok, err := check(req.Cluster.Name, ng.Name)
+			if err != nil {
+				return errors.Wrap(err, "error fetching node group info")
+			}
+			if !ok {
+				return fmt.Errorf("node group %v name: %v", msg, ng.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ClusterStatus prints the state of the cluster and, when it is running,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *Magnum) ClusterStatus(*kingpin.ParseContext) error {
+	s := &k8sProvider.ClusterStatus{Name: c.DeploymentVars["CLUSTER_NAME"]}
+	cluster, err := c.clientMagnum.getCluster(s.Name)
+	if isNotFound(err) {
+		s.State = "NOT_FOUND"
+	} else if err != nil {
+		return errors.Wrap(err, "couldn't get cluster status")
+	} else {
+		s.State = cluster.Status
+	}
+
+	if s.State == "CREATE_COMPLETE" || s.State == "UPDATE_COMPLETE" {
+		if err := c.NewK8sProvider(nil); err != nil {
+			return err
+		}
+		if err := c.k8sProvider.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
+// NewK8sProvider sets the k8s provider used for deploying k8s manifests.
+func (c *Magnum) NewK8sProvider(*kingpin.ParseContext) error {
+	return c.newK8sProvider(c.DeploymentVars["CLUSTER_NAME"])
+}
+
+func (c *Magnum) newK8sProvider(clusterName string) error {
+	cluster, err := c.clientMagnum.getCluster(clusterName)
+	if err != nil {
+		return errors.Wrap(err, "failed to get cluster details")
+	}
+	config, err := c.kubeconfig(cluster)
+	if err != nil {
+		return errors.Wrap(err, "generating the cluster kubeconfig")
+	}
+
+	c.k8sProvider, err = k8sProvider.New(c.ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "k8s provider error")
+	}
+	return nil
+}
+
+// kubeconfig returns a kubeconfig with an admin client certificate signed by the cluster CA.
+// This is the same certificate that 'openstack coe cluster config' generates.
+func (c *Magnum) kubeconfig(cluster *Cluster) (*clientcmdapi.Config, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "admin", Organization: []string{"system:masters"}},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := c.clientMagnum.clusterCA(cluster.UUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the cluster CA")
+	}
+	cert, err := c.clientMagnum.signCertificate(cluster.UUID, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	if err != nil {
+		return nil, errors.Wrap(err, "signing the client certificate")
+	}
+
+	config := clientcmdapi.NewConfig()
+	config.Clusters[cluster.Name] = &clientcmdapi.Cluster{
+		Server:                   cluster.APIAddress,
+		CertificateAuthorityData: ca,
+	}
+	config.AuthInfos[cluster.Name] = &clientcmdapi.AuthInfo{
+		ClientCertificateData: cert,
+		ClientKeyData:         pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+	}
+	config.Contexts[cluster.Name] = &clientcmdapi.Context{
+		Cluster:  cluster.Name,
+		AuthInfo: cluster.Name,
+	}
+	config.CurrentContext = cluster.Name
+	return config, nil
+}
+
+// ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
+func (c *Magnum) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while applying a resource")
+	}
+	return nil
+}
+
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *Magnum) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	if err := c.k8sProvider.ResourceDiff(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while diffing the resources")
+	}
+	return nil
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *Magnum) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	if err := c.k8sProvider.ResourceLogs(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while streaming the logs")
+	}
+	return nil
+}
+
+// ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
+func (c *Magnum) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
+	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while deleting objects from a manifest file")
+	}
+	return nil
+}
+
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *Magnum) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *Magnum) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
+	}
+	return nil
+}
+
+// GetDeploymentVars shows deployment variables.
+func (c *Magnum) GetDeploymentVars(*kingpin.ParseContext) error {
+	fmt.Print("-------------------\n   DeploymentVars   \n------------------- \n")
+	for key, value := range c.DeploymentVars {
+		fmt.Println(key, " : ", value)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// nodes are the nodes of the cluster recorded with RecordNodes.
+var nodes struct {
+	mtx          sync.Mutex
+	set          bool
+	ready, total int
+}
+
+// RecordNodes records the number of ready nodes of the cluster for the metrics of the command.
+func RecordNodes(ready, total int) {
+	nodes.mtx.Lock()
+	nodes.set, nodes.ready, nodes.total = true, ready, total
+	nodes.mtx.Unlock()
+}
+
+// Metrics exposes metrics of the command and the actions it took
+// to a Pushgateway or a textfile of the node exporter, for the meta-monitoring to alert on failing benchmark infra.
+// The metrics have a command label, like "gke cluster create".
+type Metrics struct {
+	// Pushgateway is the url of the Pushgateway, the metrics are pushed to the infra job grouped by command.
+	Pushgateway string
+	// Textfile is the file of the node exporter textfile collector.
+	// The metrics of the other commands in the file are kept.
+	Textfile string
+
+	command string
+	start   time.Time
+}
+
+// NewMetrics is the Metrics constructor.
+func NewMetrics() *Metrics {
+	return &Metrics{start: time.Now()}
+}
+
+// Start records the command of the metrics, it runs before the actions of the command.
+func (m *Metrics) Start(c *kingpin.ParseContext) error {
+	if c.SelectedCommand != nil {
+		m.command = c.SelectedCommand.FullCommand()
+	}
+	m.start = time.Now()
+	return nil
+}
+
+// Write pushes or writes the metrics of the command with the error of the command.
+func (m *Metrics) Write(cmdErr error) error {
+	if m.command == "" || (m.Pushgateway == "" && m.Textfile == "") {
+		return nil
+	}
+	if m.Pushgateway != "" {
+		// The Pushgateway adds the grouping labels.
+		reg := m.registry(cmdErr, nil)
+		if err := push.New(m.Pushgateway, "infra").Grouping("command", m.command).Gatherer(reg).Push(); err != nil {
+			return errors.Wrapf(err, "pushing the metrics to %v", m.Pushgateway)
+		}
+	}
+	if m.Textfile != "" {
+		others, err := m.otherCommands()
+		if err != nil {
+			return err
+		}
+		reg := m.registry(cmdErr, prometheus.Labels{"command": m.command})
+		if err := prometheus.WriteToTextfile(m.Textfile, prometheus.Gatherers{reg, others}); err != nil {
+			return errors.Wrapf(err, "writing the metrics to %v", m.Textfile)
+		}
+	}
+	return nil
+}
+
+func (m *Metrics) registry(cmdErr error, labels prometheus.Labels) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	gauge := func(name, help string, value float64) {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help, ConstLabels: labels})
+		g.Set(value)
+		reg.MustRegister(g)
+	}
+
+	success := 0.0
+	if cmdErr == nil {
+		success = 1
+	}
+	gauge("infra_command_success", "Whether the last run of the command succeeded.", success)
+	gauge("infra_command_last_run_timestamp_seconds", "Start time of the last run of the command.", float64(m.start.UnixNano())/1e9)
+	gauge("infra_command_duration_seconds", "Duration of the last run of the command.", time.Since(m.start).Seconds())
+
+	actions.mtx.Lock()
+	var failed int
+	for _, a := range actions.list {
+		if a.Error != "" {
+			failed++
+		}
+	}
+	gauge("infra_command_actions", "Number of actions taken by the last run of the command, like creating a nodepool or applying an object.", float64(len(actions.list)))
+	gauge("infra_command_failed_actions", "Number of failed actions of the last run of the command.", float64(failed))
+	actions.mtx.Unlock()
+
+	nodes.mtx.Lock()
+	if nodes.set {
+		gauge("infra_nodes", "Number of nodes of the cluster, set by the cluster status commands.", float64(nodes.total))
+		gauge("infra_nodes_ready", "Number of ready nodes of the cluster, set by the cluster status commands.", float64(nodes.ready))
+	}
+	nodes.mtx.Unlock()
+	return reg
+}
+
+// otherCommands returns the metrics of the other commands in the textfile.
+func (m *Metrics) otherCommands() (prometheus.GathererFunc, error) {
+	var families []*dto.MetricFamily
+	f, err := os.Open(m.Textfile)
+	if os.IsNotExist(err) {
+		return func() ([]*dto.MetricFamily, error) { return nil, nil }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	parsed, err := (&expfmt.TextParser{}).TextToMetricFamilies(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing the metrics of %v", m.Textfile)
+	}
+	for _, mf := range parsed {
+		var metrics []*dto.Metric
+		for _, metric := range mf.Metric {
+			keep := true
+			for _, l := range metric.Label {
+				if l.GetName() == "command" && l.GetValue() == m.command {
+					keep = false
+				}
+			}
+			if keep {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) > 0 {
+			mf.Metric = metrics
+			families = append(families, mf)
+		}
+	}
+	return func() ([]*dto.MetricFamily, error) { return families, nil }, nil
+}
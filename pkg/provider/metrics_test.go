@@ -0,0 +1,93 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The other tests record actions too.
+	actions.list = nil
+	defer func() { actions.list = nil }()
+	nodes.set = false
+	defer func() { nodes.set = false }()
+
+	var pushed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPut || len(body) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pushed = append(pushed, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	m := NewMetrics()
+	m.Pushgateway = srv.URL
+	m.Textfile = filepath.Join(dir, "infra.prom")
+	for _, cmd := range []string{"gke resource apply", "gke cluster status", "gke resource apply"} {
+		actions.list = nil
+		RecordAction("apply Deployment prometheus", time.Now(), nil)
+		RecordAction("apply Service prometheus", time.Now(), errors.New("forbidden"))
+		var cmdErr error
+		if cmd == "gke cluster status" {
+			RecordNodes(2, 3)
+		} else {
+			cmdErr = errors.New("applying")
+		}
+		m.command = cmd
+		if err := m.Write(cmdErr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(pushed) != 3 || !strings.HasPrefix(pushed[0], "/metrics/job/infra/command") {
+		t.Errorf("expected the metrics to be pushed to the infra job grouped by command, got %v", pushed)
+	}
+	content, err := ioutil.ReadFile(m.Textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`infra_command_success{command="gke cluster status"} 1`,
+		`infra_command_success{command="gke resource apply"} 0`,
+		`infra_command_actions{command="gke resource apply"} 2`,
+		`infra_command_failed_actions{command="gke resource apply"} 1`,
+		`infra_nodes_ready{command="gke cluster status"} 2`,
+		`infra_nodes{command="gke cluster status"} 3`,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected %q in:\n%s", expected, content)
+		}
+	}
+	// Running a command again replaces its metrics.
+	if n := strings.Count(string(content), `infra_command_success{command="gke resource apply"}`); n != 1 {
+		t.Errorf("expected the metrics of the last run of the command only, got %v", n)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Plan runs the steps of plan files, like creating the nodepools, applying the benchmark
+// and waiting for its checks, with the commands of the providers.
+type Plan struct {
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *DeploymentResource
+	// State has the run ID and the auth flags of the providers, which override the auth of the plans.
+	State *State
+}
+
+// NewPlan is the Plan constructor.
+func NewPlan(dr *DeploymentResource, state *State) *Plan {
+	return &Plan{DeploymentResource: dr, State: state}
+}
+
+// planFile is a plan file, its paths are relative to its directory.
+type planFile struct {
+	// Provider of the steps, like gke.
+	Provider string `json:"provider"`
+	// ProviderPlugin is the binary of the plugin provider.
+	ProviderPlugin string `json:"providerPlugin,omitempty"`
+	// Auth is the auth flag of the provider commands.
+	Auth string `json:"auth,omitempty"`
+	// Vars are the variables of the steps, the --vars flags override them.
+	Vars  map[string]string `json:"vars,omitempty"`
+	Steps []planStep        `json:"steps"`
+}
+
+// planStep creates the clusters, the nodepools or the objects of its files, or evaluates checks.
+type planStep struct {
+	Name      string   `json:"name,omitempty"`
+	Cluster   []string `json:"cluster,omitempty"`
+	Nodes     []string `json:"nodes,omitempty"`
+	Resources []string `json:"resources,omitempty"`
+	Checks    []string `json:"checks,omitempty"`
+	// Flags are added to the command of the step, like --rollout-timeout 30m.
+	Flags []string `json:"flags,omitempty"`
+}
+
+// commands returns the command of the step and the command undoing it, empty for the checks.
+func (s planStep) commands() (files []string, apply, destroy string, err error) {
+	var kinds []string
+	for _, k := range []struct {
+		name, apply, destroy string
+		files                []string
+	}{
+		{"cluster", "cluster create", "cluster delete", s.Cluster},
+		{"nodes", "nodes create", "nodes delete", s.Nodes},
+		{"resources", "resource apply", "resource delete", s.Resources},
+		{"checks", "check", "", s.Checks},
+	} {
+		if len(k.files) > 0 {
+			kinds = append(kinds, k.name)
+			files, apply, destroy = k.files, k.apply, k.destroy
+		}
+	}
+	if len(kinds) != 1 {
+		return nil, "", "", fmt.Errorf("a step must have one of cluster, nodes, resources or checks, got %v", kinds)
+	}
+	return files, apply, destroy, nil
+}
+
+func (s planStep) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	files, apply, _, _ := s.commands()
+	return fmt.Sprintf("%v %v", apply, strings.Join(files, " "))
+}
+
+// Apply runs the steps of the plan files in order and stops at the first failed step.
+// With --run-id the steps are recorded in the state of the run so that destroy can delete what a failed plan created.
+func (p *Plan) Apply(*kingpin.ParseContext) error {
+	plans, err := p.parse()
+	if err != nil {
+		return err
+	}
+	for _, plan := range plans {
+		for i, step := range plan.Steps {
+			if err := Interrupted(); err != nil {
+				return err
+			}
+			_, cmd, _, _ := step.commands()
+			log.Printf("Step %v/%v of %v: %v", i+1, len(plan.Steps), plan.name, step)
+			if err := runInfra(p.args(plan, step, cmd)); err != nil {
+				return errors.Wrapf(err, "step %v of %v: %v", i+1, plan.name, step)
+			}
+		}
+	}
+	return nil
+}
+
+// Destroy deletes what the steps of the plan files create, the last step first, the checks are skipped.
+// All the steps are deleted even after a failure. Without plan files it destroys the run with --run-id, see State.Destroy.
+func (p *Plan) Destroy(c *kingpin.ParseContext) error {
+	if len(p.DeploymentResource.DeploymentFiles) == 0 {
+		return p.State.Destroy(c)
+	}
+	plans, err := p.parse()
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for i := len(plans) - 1; i >= 0; i-- {
+		plan := plans[i]
+		for j := len(plan.Steps) - 1; j >= 0; j-- {
+			if err := Interrupted(); err != nil {
+				return err
+			}
+			step := plan.Steps[j]
+			_, _, cmd, _ := step.commands()
+			if cmd == "" {
+				continue
+			}
+			log.Printf("Destroying step %v/%v of %v: %v", j+1, len(plan.Steps), plan.name, step)
+			if err := runInfra(p.args(plan, step, cmd)); err != nil {
+				log.Printf("Destroying step %v of %v failed: %v", j+1, plan.name, err)
+				failed = append(failed, fmt.Sprintf("%v of %v", j+1, plan.name))
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("destroying steps %v failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// parsedPlan is a plan file with the paths relative to the working directory.
+type parsedPlan struct {
+	planFile
+	name string
+}
+
+// parse reads the plan files after applying the template variables of the command.
+func (p *Plan) parse() ([]parsedPlan, error) {
+	if len(p.DeploymentResource.DeploymentFiles) == 0 {
+		return nil, fmt.Errorf("missing plan file(s)")
+	}
+	deployments, err := DeploymentsParse(p.DeploymentResource.DeploymentFiles, MergeDeploymentVars(
+		p.DeploymentResource.DefaultDeploymentVars,
+		p.DeploymentResource.FlagDeploymentVars,
+	))
+	if err != nil {
+		return nil, err
+	}
+	var plans []parsedPlan
+	for _, d := range deployments {
+		plan := parsedPlan{name: d.FileName}
+		if err := yaml.UnmarshalStrict(d.Content, &plan.planFile); err != nil {
+			return nil, errors.Wrapf(err, "parsing the plan %v", d.FileName)
+		}
+		if !stateProviders[plan.Provider] {
+			return nil, fmt.Errorf("plan %v: unknown provider %q", d.FileName, plan.Provider)
+		}
+		if len(plan.Steps) == 0 {
+			return nil, fmt.Errorf("plan %v has no steps", d.FileName)
+		}
+		dir := filepath.Dir(d.FileName)
+		rel := func(files []string) {
+			for i, f := range files {
+				if !filepath.IsAbs(f) {
+					files[i] = filepath.Join(dir, f)
+				}
+			}
+		}
+		for i, step := range plan.Steps {
+			if _, _, _, err := step.commands(); err != nil {
+				return nil, errors.Wrapf(err, "plan %v, step %v", d.FileName, i+1)
+			}
+			rel(step.Cluster)
+			rel(step.Nodes)
+			rel(step.Resources)
+			rel(step.Checks)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// args returns the arguments of the infra command running cmd for the step.
+func (p *Plan) args(plan parsedPlan, step planStep, cmd string) []string {
+	var args []string
+	if DryRun {
+		args = append(args, "--dry-run")
+	}
+	if p.State.Runs.ID != "" {
+		args = append(args, "--run-id", p.State.Runs.ID, "--state", p.State.URL)
+	}
+	if plan.ProviderPlugin != "" {
+		args = append(args, "--provider-plugin", plan.ProviderPlugin)
+	}
+	if cmd == "check" {
+		args = append(args, cmd)
+	} else {
+		args = append(args, plan.Provider)
+		args = append(args, strings.Fields(cmd)...)
+		auth := plan.Auth
+		if a, ok := p.State.Auth[plan.Provider]; ok {
+			auth = a
+		}
+		if auth != "" {
+			args = append(args, "-a", auth)
+		}
+	}
+	args = append(args, step.Flags...)
+	files, _, _, _ := step.commands()
+	for _, f := range files {
+		args = append(args, "-f", f)
+	}
+	vars := MergeDeploymentVars(plan.Vars, p.DeploymentResource.FlagDeploymentVars)
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		args = append(args, "-v", k+":"+vars[k])
+	}
+	return args
+}
+
+// runInfra runs the infra binary with the arguments, changed by the tests.
+var runInfra = func(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
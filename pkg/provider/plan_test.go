@@ -0,0 +1,137 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	plan := filepath.Join(dir, "plan.yaml")
+	if err := ioutil.WriteFile(plan, []byte(`provider: gke
+auth: service-account.json
+vars:
+  CLUSTER_NAME: prombench
+  PR_NUMBER: "0"
+steps:
+- nodes: [nodes_gke.yaml]
+- name: benchmark
+  resources: [benchmark-{{ .PR_NUMBER }}]
+  flags: [--rollout-timeout, 30m]
+- checks: [checks.yaml]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	fail := ""
+	defer func(r func([]string) error) { runInfra = r }(runInfra)
+	runInfra = func(args []string) error {
+		cmd := strings.Join(args, " ")
+		commands = append(commands, cmd)
+		if fail != "" && strings.Contains(cmd, fail) {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+
+	dr := &DeploymentResource{DeploymentFiles: []string{plan}, FlagDeploymentVars: map[string]string{"PR_NUMBER": "1"}}
+	state := NewState(&Runs{DeploymentResource: dr, ID: "pr-1"})
+	state.URL = "gs://state"
+	state.Auth["gke"] = "other.json"
+	p := NewPlan(dr, state)
+	if err := p.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	vars := " -v CLUSTER_NAME:prombench -v PR_NUMBER:1"
+	expected := []string{
+		"--run-id pr-1 --state gs://state gke nodes create -a other.json -f " + filepath.Join(dir, "nodes_gke.yaml") + vars,
+		"--run-id pr-1 --state gs://state gke resource apply -a other.json --rollout-timeout 30m -f " + filepath.Join(dir, "benchmark-1") + vars,
+		"--run-id pr-1 --state gs://state check -f " + filepath.Join(dir, "checks.yaml") + vars,
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("expected the commands:\n%v\ngot:\n%v", strings.Join(expected, "\n"), strings.Join(commands, "\n"))
+	}
+
+	// Apply stops at the first failed step.
+	commands, fail = nil, "resource apply"
+	if err := p.Apply(nil); err == nil || !strings.Contains(err.Error(), "step 2") {
+		t.Errorf("expected step 2 to fail, got %v", err)
+	}
+	if len(commands) != 2 {
+		t.Errorf("expected the steps after the failed step to be skipped, got %v", commands)
+	}
+
+	// Destroy deletes all the steps in reverse, without the checks.
+	commands, fail = nil, "resource delete"
+	if err := p.Destroy(nil); err == nil || !strings.Contains(err.Error(), "destroying steps 2 of") {
+		t.Errorf("expected step 2 to fail, got %v", err)
+	}
+	if len(commands) != 2 || !strings.Contains(commands[0], "gke resource delete") || !strings.Contains(commands[1], "gke nodes delete") {
+		t.Errorf("expected the objects and the nodepools to be deleted, got %v", commands)
+	}
+}
+
+func TestPlanInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for content, expected := range map[string]string{
+		"provider: gke\nsteps:\n- nodes: [a.yaml]\n  resources: [b.yaml]\n": "one of cluster, nodes, resources or checks",
+		"provider: gce\nsteps:\n- nodes: [a.yaml]\n":                        `unknown provider "gce"`,
+		"provider: gke\nsteps: []\n":                                        "has no steps",
+		"provider: gke\nstep:\n- nodes: [a.yaml]\n":                         `unknown field "step"`,
+	} {
+		plan := filepath.Join(dir, "plan.yaml")
+		if err := ioutil.WriteFile(plan, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p := NewPlan(&DeploymentResource{DeploymentFiles: []string{plan}}, NewState(&Runs{}))
+		if _, err := p.parse(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected %q, got %v", content, expected, err)
+		}
+	}
+}
+
+func TestPrombenchPlan(t *testing.T) {
+	dr := &DeploymentResource{
+		DeploymentFiles:    []string{"../../prombench/manifests/prombench/plan.yaml"},
+		FlagDeploymentVars: map[string]string{"PROVIDER": "gke", "AUTH_FILE": "sa.json"},
+	}
+	plans, err := NewPlan(dr, NewState(&Runs{})).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range plans[0].Steps {
+		files, _, _, _ := step.commands()
+		for _, f := range files {
+			if _, err := os.Stat(f); err != nil {
+				t.Errorf("step %v: %v", step, err)
+			}
+		}
+	}
+}
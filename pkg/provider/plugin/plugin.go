@@ -0,0 +1,350 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin runs cluster providers shipped as external binaries.
+// The binaries implement the operations in protocol.go and infra applies
+// the k8s resources with the kubeconfig returned by the plugin.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Plugin holds the fields used to run the operations of a provider plugin.
+type Plugin struct {
+	// Path of the plugin binary, looked up in $PATH when it has no path separator.
+	Path string
+	// Name of the plugin returned by the handshake.
+	name string
+	// The k8s provider used when we work with the manifest files.
+	k8sProvider *k8sProvider.K8s
+	// Final DeploymentFiles files.
+	DeploymentFiles []string
+	// Final DeploymentVars.
+	DeploymentVars map[string]string
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Content of the deployment files after parsing the template variables.
+	files []File
+	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
+	k8sResources []k8sProvider.Resource
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
+
+	ctx context.Context
+}
+
+// New is the Plugin constructor.
+func New(dr *provider.DeploymentResource) *Plugin {
+	return &Plugin{
+		DeploymentResource: dr,
+		ctx:                provider.Context(),
+	}
+}
+
+// Handshake finds the plugin binary and checks that it implements the same protocol version.
+func (c *Plugin) Handshake(*kingpin.ParseContext) error {
+	if c.Path == "" {
+		return fmt.Errorf("missing provider plugin, set it with --provider-plugin")
+	}
+	path, err := exec.LookPath(c.Path)
+	if err != nil {
+		return errors.Wrapf(err, "finding the provider plugin %v", c.Path)
+	}
+	c.Path = path
+
+	resp, err := c.call(OpHandshake)
+	if err != nil {
+		return err
+	}
+	if resp.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("plugin %v implements protocol version %v, expected %v", c.Path, resp.ProtocolVersion, ProtocolVersion)
+	}
+	c.name = resp.Name
+	if c.name == "" {
+		c.name = c.Path
+	}
+	return nil
+}
+
+// SetupDeploymentResources Sets up DeploymentVars and DeploymentFiles
+func (c *Plugin) SetupDeploymentResources(*kingpin.ParseContext) error {
+	c.DeploymentFiles = c.DeploymentResource.DeploymentFiles
+	c.DeploymentVars = provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	)
+	return nil
+}
+
+// PluginDeploymentsParse parses the cluster/nodepool deployment files which are sent to the plugin as they are.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *Plugin) PluginDeploymentsParse(*kingpin.ParseContext) error {
+	if len(c.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+	for _, deployment := range deploymentResource {
+		c.files = append(c.files, File{Name: deployment.FileName, Content: string(deployment.Content)})
+	}
+	return nil
+}
+
+// K8SDeploymentsParse parses the k8s objects deployment files and saves the result as k8s objects grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *Plugin) K8SDeploymentsParse(*kingpin.ParseContext) error {
+	if len(c.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	for _, deployment := range deploymentResource {
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
+		}
+		if len(k8sObjects) > 0 {
+			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
+		}
+	}
+	return nil
+}
+
+func (c *Plugin) call(op string) (*Response, error) {
+	return call(c.ctx, c.Path, op, c.request())
+}
+
+func (c *Plugin) request() *Request {
+	return &Request{
+		ProtocolVersion: ProtocolVersion,
+		DeploymentVars:  c.DeploymentVars,
+		Files:           c.files,
+	}
+}
+
+// run calls an operation which doesn't return anything besides an error.
+// In dry-run mode the request is only printed.
+func (c *Plugin) run(op string) error {
+	if provider.DryRun {
+		return provider.DryRunRequest(fmt.Sprintf("%v %v", c.Path, op), c.request())
+	}
+	log.Printf("Running %v of plugin %v", op, c.name)
+	if err := provider.Chaos(op); err != nil {
+		return err
+	}
+	_, err := c.call(op)
+	return err
+}
+
+// ClusterCreate calls the cluster-create operation of the plugin.
+func (c *Plugin) ClusterCreate(*kingpin.ParseContext) error {
+	return c.run(OpClusterCreate)
+}
+
+// ClusterDelete calls the cluster-delete operation of the plugin.
+func (c *Plugin) ClusterDelete(*kingpin.ParseContext) error {
+	return c.run(OpClusterDelete)
+}
+
+// NodePoolCreate calls the nodes-create operation of the plugin.
+func (c *Plugin) NodePoolCreate(*kingpin.ParseContext) error {
+	return c.run(OpNodesCreate)
+}
+
+// NodePoolDelete calls the nodes-delete operation of the plugin.
+func (c *Plugin) NodePoolDelete(*kingpin.ParseContext) error {
+	return c.run(OpNodesDelete)
+}
+
+// AllNodePoolsRunning returns an error if not all nodepools are running.
+func (c *Plugin) AllNodePoolsRunning(*kingpin.ParseContext) error {
+	return c.check(OpNodesRunning, "not all nodepools are running")
+}
+
+// AllNodePoolsDeleted returns an error if not all nodepools are deleted.
+func (c *Plugin) AllNodePoolsDeleted(*kingpin.ParseContext) error {
+	return c.check(OpNodesDeleted, "not all nodepools are deleted")
+}
+
+func (c *Plugin) check(op, msg string) error {
+	resp, err := c.call(op)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("%v", msg)
+	}
+	return nil
+}
+
+// ClusterStatus prints the state returned by the plugin and, when it is running,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *Plugin) ClusterStatus(*kingpin.ParseContext) error {
+	resp, err := c.call(OpClusterStatus)
+	if err != nil {
+		return err
+	}
+	s := &k8sProvider.ClusterStatus{Name: c.DeploymentVars["CLUSTER_NAME"], State: resp.State}
+	if s.Name == "" {
+		s.Name = c.name
+	}
+
+	if s.State == "RUNNING" {
+		if err := c.NewK8sProvider(nil); err != nil {
+			return err
+		}
+		if err := c.k8sProvider.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
+// NewK8sProvider sets the k8s provider used for deploying k8s manifests
+// with the kubeconfig returned by the plugin.
+func (c *Plugin) NewK8sProvider(*kingpin.ParseContext) error {
+	resp, err := c.call(OpKubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to get cluster details")
+	}
+	config, err := clientcmd.Load([]byte(resp.Kubeconfig))
+	if err != nil {
+		return errors.Wrap(err, "parsing the kubeconfig returned by the plugin")
+	}
+
+	c.k8sProvider, err = k8sProvider.New(c.ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "k8s provider error")
+	}
+	return nil
+}
+
+// ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
+func (c *Plugin) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while applying a resource")
+	}
+	return nil
+}
+
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *Plugin) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	if err := c.k8sProvider.ResourceDiff(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while diffing the resources")
+	}
+	return nil
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *Plugin) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	if err := c.k8sProvider.ResourceLogs(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while streaming the logs")
+	}
+	return nil
+}
+
+// ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
+func (c *Plugin) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
+	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while deleting objects from a manifest file")
+	}
+	return nil
+}
+
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *Plugin) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *Plugin) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
+	}
+	return nil
+}
+
+// GetDeploymentVars shows deployment variables.
+func (c *Plugin) GetDeploymentVars(*kingpin.ParseContext) error {
+	fmt.Print("-------------------\n   DeploymentVars   \n------------------- \n")
+	for key, value := range c.DeploymentVars {
+		fmt.Println(key, " : ", value)
+	}
+
+	return nil
+}
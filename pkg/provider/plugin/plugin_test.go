@@ -0,0 +1,91 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/test-infra/pkg/provider"
+)
+
+// script is a plugin echoing the request for cluster-create
+// and failing with an error response for cluster-delete.
+const script = `#!/bin/sh
+case "$1" in
+handshake) echo '{"name": "test", "protocol_version": 1}' ;;
+nodes-running) echo '{"ok": true}' ;;
+nodes-deleted) echo '{}' ;;
+cluster-create) cat > "$(dirname "$0")/request.json"; echo '{}' ;;
+cluster-delete) echo '{"error": "cluster not found"}'; exit 1 ;;
+*) echo "unknown operation $1" >&2; exit 1 ;;
+esac
+`
+
+func TestPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "infra-provider-test")
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := New(&provider.DeploymentResource{
+		FlagDeploymentVars: map[string]string{"ZONE": "a"},
+	})
+	p.Path = path
+	if err := p.SetupDeploymentResources(nil); err != nil {
+		t.Fatal(err)
+	}
+	p.files = []File{{Name: "cluster.yaml", Content: "cluster: test"}}
+
+	if err := p.Handshake(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p.name != "test" {
+		t.Errorf("expected plugin name test, got %q", p.name)
+	}
+
+	if err := p.ClusterCreate(nil); err != nil {
+		t.Fatal(err)
+	}
+	req, err := ioutil.ReadFile(filepath.Join(dir, "request.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"protocol_version":1`, `"ZONE":"a"`, `"name":"cluster.yaml"`, `"content":"cluster: test"`} {
+		if !strings.Contains(string(req), s) {
+			t.Errorf("request %s doesn't contain %s", req, s)
+		}
+	}
+
+	if err := p.ClusterDelete(nil); err == nil || !strings.Contains(err.Error(), "cluster not found") {
+		t.Errorf("expected the error of the plugin response, got %v", err)
+	}
+	if err := p.AllNodePoolsRunning(nil); err != nil {
+		t.Errorf("expected all nodepools running, got %v", err)
+	}
+	if err := p.AllNodePoolsDeleted(nil); err == nil {
+		t.Error("expected an error for nodepools not deleted")
+	}
+	if _, err := p.call("unknown"); err == nil {
+		t.Error("expected an error for an unknown operation")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// ProtocolVersion is the version of the plugin protocol.
+// It is increased on incompatible changes and must match the version returned by the handshake.
+const ProtocolVersion = 1
+
+// The operations a plugin implements.
+// Each operation runs the plugin binary with the operation as its only argument,
+// the Request as json on stdin and expects the Response as json on stdout.
+// Stderr is passed through so plugins can log their progress.
+const (
+	// OpHandshake returns the protocol version and the name of the plugin.
+	OpHandshake = "handshake"
+	// OpClusterCreate creates the clusters in the deployment files and returns when they are running.
+	OpClusterCreate = "cluster-create"
+	// OpClusterDelete deletes the clusters in the deployment files and returns when they are removed.
+	OpClusterDelete = "cluster-delete"
+	// OpClusterStatus returns the state of the cluster.
+	OpClusterStatus = "cluster-status"
+	// OpNodesCreate creates the nodepools in the deployment files and returns when they are running.
+	OpNodesCreate = "nodes-create"
+	// OpNodesDelete deletes the nodepools in the deployment files and returns when they are removed.
+	OpNodesDelete = "nodes-delete"
+	// OpNodesRunning returns whether all nodepools in the deployment files are running.
+	OpNodesRunning = "nodes-running"
+	// OpNodesDeleted returns whether all nodepools in the deployment files are deleted.
+	OpNodesDeleted = "nodes-deleted"
+	// OpKubeconfig returns a kubeconfig for the cluster, used to apply and delete the k8s resources.
+	OpKubeconfig = "kubeconfig"
+)
+
+// File is a deployment file after applying the template variables.
+type File struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Request is sent to the plugin on stdin.
+type Request struct {
+	ProtocolVersion int               `json:"protocol_version"`
+	DeploymentVars  map[string]string `json:"deployment_vars"`
+	Files           []File            `json:"files,omitempty"`
+}
+
+// Response is read from the stdout of the plugin.
+type Response struct {
+	// Error is set when the operation failed.
+	Error string `json:"error,omitempty"`
+	// Name and ProtocolVersion of the plugin, returned by the handshake.
+	Name            string `json:"name,omitempty"`
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+	// State of the cluster, returned by cluster-status.
+	// The k8s status is reported by infra when the state is RUNNING.
+	State string `json:"state,omitempty"`
+	// Ok is the result of nodes-running and nodes-deleted.
+	Ok bool `json:"ok,omitempty"`
+	// Kubeconfig returned by kubeconfig.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+}
+
+// call runs an operation of the plugin.
+func call(ctx context.Context, path, op string, req *Request) (*Response, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, op)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	resp := &Response{}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		if runErr != nil {
+			return nil, errors.Wrapf(runErr, "plugin %v %v", path, op)
+		}
+		return nil, errors.Wrapf(err, "decoding the response of plugin %v %v", path, op)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %v %v: %v", path, op, resp.Error)
+	}
+	if runErr != nil {
+		return nil, errors.Wrapf(runErr, "plugin %v %v", path, op)
+	}
+	return resp, nil
+}
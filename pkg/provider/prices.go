@@ -0,0 +1,106 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// PreemptibleSuffix is appended to a machine type for the price of its preemptible nodes.
+const PreemptibleSuffix = "/preemptible"
+
+// DefaultPrices are the hourly on-demand prices in dollars of the common machine types
+// of GKE in us-central1, EKS in us-east-1 and DOKS, and of the preemptible GKE n1 machine types.
+// They are only an estimate, the prices of other regions and discounts are set with ParsePrices.
+var DefaultPrices = defaultPrices()
+
+func defaultPrices() map[string]float64 {
+	prices := map[string]float64{
+		// GKE, us-central1.
+		"e2-standard-2":  0.067006,
+		"e2-standard-4":  0.134012,
+		"e2-standard-8":  0.268024,
+		"e2-standard-16": 0.536048,
+		"e2-standard-32": 1.072096,
+
+		// EKS, us-east-1.
+		"t3.medium":   0.0416,
+		"t3.large":    0.0832,
+		"t3.xlarge":   0.1664,
+		"t3.2xlarge":  0.3328,
+		"m5.large":    0.096,
+		"m5.xlarge":   0.192,
+		"m5.2xlarge":  0.384,
+		"m5.4xlarge":  0.768,
+		"m5.8xlarge":  1.536,
+		"c5.large":    0.085,
+		"c5.xlarge":   0.17,
+		"c5.2xlarge":  0.34,
+		"c5.4xlarge":  0.68,
+		"c5.9xlarge":  1.53,
+		"r5.large":    0.126,
+		"r5.xlarge":   0.252,
+		"r5.2xlarge":  0.504,
+		"r5.4xlarge":  1.008,
+		"r5d.large":   0.144,
+		"r5d.xlarge":  0.288,
+		"r5d.2xlarge": 0.576,
+		"r5d.4xlarge": 1.152,
+
+		// DOKS, the monthly price of the droplets over 672 hours.
+		"s-1vcpu-2gb":  0.01488,
+		"s-2vcpu-4gb":  0.02976,
+		"s-4vcpu-8gb":  0.05952,
+		"s-8vcpu-16gb": 0.11905,
+	}
+	// The GKE n1 machine types are priced by vCPU.
+	for _, family := range []struct {
+		name                  string
+		onDemand, preemptible float64
+	}{
+		{"n1-standard", 0.0475, 0.01},
+		{"n1-highmem", 0.0592, 0.0125},
+		{"n1-highcpu", 0.03545, 0.0075},
+	} {
+		for _, cpus := range []int{1, 2, 4, 8, 16, 32, 64, 96} {
+			if cpus == 1 && family.name != "n1-standard" {
+				continue
+			}
+			machineType := fmt.Sprintf("%v-%v", family.name, cpus)
+			prices[machineType] = family.onDemand * float64(cpus)
+			prices[machineType+PreemptibleSuffix] = family.preemptible * float64(cpus)
+		}
+	}
+	return prices
+}
+
+// ParsePrices returns the default prices with the prices of the overrides,
+// hourly prices in dollars by machine type, like n1-standard-8=0.38 or n1-standard-8/preemptible=0.08.
+func ParsePrices(overrides map[string]string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(DefaultPrices)+len(overrides))
+	for machineType, p := range DefaultPrices {
+		prices[machineType] = p
+	}
+	for machineType, price := range overrides {
+		p, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing the price of machine type %v", machineType)
+		}
+		prices[machineType] = p
+	}
+	return prices, nil
+}
@@ -15,29 +15,67 @@ package provider
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
 )
 
 const (
 	EKSRetryCount    = 100
+	MagnumRetryCount = 180
 	GlobalRetryCount = 50
 	Separator        = "---"
 	globalRetryTime  = 10 * time.Second
+
+	// CreatedLabel is the label holding the unix time when a cluster or nodepool was created by infra.
+	CreatedLabel = "infra-created"
+	// OwnerLabel is the label holding the owner of a cluster or nodepool created by infra.
+	OwnerLabel = "infra-owner"
 )
 
+// DocumentSeparator is the line separating the documents of the deployment files.
+// Lines matching it are replaced with the yaml "---" separator after applying the template variables.
+var DocumentSeparator = Separator
+
+// FileEncoding is the encoding of the deployment files - auto, utf-8, utf-16le or utf-16be.
+// A byte order mark always takes precedence. Without one auto detects utf-16 from the first character.
+var FileEncoding = "auto"
+
+// AllowedEnv are the patterns of the environment variables the deployment files can read with the env template function.
+// The patterns follow the path.Match syntax, e.g. GITHUB_*.
+var AllowedEnv []string
+
+// DryRun disables all changes.
+// The requests that would change a cluster are printed instead of sent
+// and the k8s objects are validated by the API server without being persisted.
+var DryRun bool
+
 // DeploymentResource holds list of variables and corresponding files.
 type DeploymentResource struct {
 	// DeploymentFiles files provided from the cli.
 	DeploymentFiles []string
 	// DeploymentVars provided from the cli.
 	FlagDeploymentVars map[string]string
+	// VarsFiles are yaml files with DeploymentVars, later files override earlier ones
+	// and the DeploymentVars provided from the cli override all of them.
+	VarsFiles []string
 	// Default DeploymentVars.
 	DefaultDeploymentVars map[string]string
 }
@@ -52,10 +90,54 @@ func NewDeploymentResource() *DeploymentResource {
 			"LOADGEN_SCALE_UP_REPLICAS":   "10",
 			"SEPARATOR":                   ",",
 			"SERVICEACCOUNT_CLIENT_EMAIL": "example@example.com",
+			"PREEMPTIBLE":                 "false",
 		},
 	}
 }
 
+// LoadVarsFiles merges the DeploymentVars of the VarsFiles into the FlagDeploymentVars.
+func (d *DeploymentResource) LoadVarsFiles(*kingpin.ParseContext) error {
+	var vars []map[string]string
+	for _, name := range d.VarsFiles {
+		v, err := readVarsFile(name)
+		if err != nil {
+			return err
+		}
+		vars = append(vars, v)
+	}
+	d.FlagDeploymentVars = MergeDeploymentVars(append(vars, d.FlagDeploymentVars)...)
+	return nil
+}
+
+// readVarsFile reads a yaml file with a variable name and value on each line.
+// The values must be scalars, numbers and booleans are converted to strings.
+func readVarsFile(name string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading vars file %v:%v", name, err)
+	}
+	content, err = decodeContent(content, FileEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding vars file %v:%v", name, err)
+	}
+	values := map[string]interface{}{}
+	if err := yaml.UnmarshalStrict(content, &values); err != nil {
+		return nil, fmt.Errorf("error parsing vars file %v:%v", name, err)
+	}
+	vars := make(map[string]string, len(values))
+	for k, v := range values {
+		switch v := v.(type) {
+		case nil:
+			vars[k] = ""
+		case string, bool, int, float64:
+			vars[k] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("vars file %v: value of %v must be a string, number or boolean", name, k)
+		}
+	}
+	return vars, nil
+}
+
 // Resource holds the file content after parsing the template variables.
 type Resource struct {
 	FileName string
@@ -63,9 +145,28 @@ type Resource struct {
 }
 
 // RetryUntilTrue returns when there is an error or the requested operation returns true.
-func RetryUntilTrue(name string, retryCount int, fn func() (bool, error)) error {
+// A timeout injected by Chaos ends the retries as if they were exhausted.
+// It stops waiting when the context of the command is cancelled, see HandleSignals.
+// The operation is recorded for the report of the command, see RecordAction.
+func RetryUntilTrue(name string, retryCount int, fn func() (bool, error)) (err error) {
+	start := time.Now()
+	defer func() { RecordAction(name, start, err) }()
 	for i := 1; i <= retryCount; i++ {
-		time.Sleep(globalRetryTime)
+		if err := Chaos(name); err != nil {
+			if err.(*InjectedError).Timeout {
+				break
+			}
+			return err
+		}
+		select {
+		case <-Context().Done():
+			reason := Interrupted()
+			if reason == nil {
+				reason = Context().Err()
+			}
+			return errors.Wrapf(reason, "Request for '%v' was cancelled", name)
+		case <-time.After(globalRetryTime):
+		}
 		if ready, err := fn(); err != nil {
 			return err
 		} else if !ready {
@@ -79,10 +180,12 @@ func RetryUntilTrue(name string, retryCount int, fn func() (bool, error)) error
 }
 
 // applyTemplateVars applies golang templates to deployment files.
+// Using a variable which isn't set returns an *undefinedVarsError unless the template handles it,
+// for example with default, in which case the variable is empty.
 func applyTemplateVars(content []byte, deploymentVars map[string]string) ([]byte, error) {
 	fileContentParsed := bytes.NewBufferString("")
 	t := template.New("resource").Option("missingkey=error")
-	t = t.Funcs(template.FuncMap{
+	t = t.Funcs(sprigFuncs).Funcs(template.FuncMap{
 		// k8s objects can't have dots(.) se we add a custom function to allow normalising the variable values.
 		"normalise": func(t string) string {
 			return strings.Replace(t, ".", "-", -1)
@@ -90,21 +193,73 @@ func applyTemplateVars(content []byte, deploymentVars map[string]string) ([]byte
 		"split": func(rangeVars, separator string) []string {
 			return strings.Split(rangeVars, separator)
 		},
+		"env": Env,
 	})
-	if err := template.Must(t.Parse(string(content))).Execute(fileContentParsed, deploymentVars); err != nil {
+	t, err := t.Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse file err: %s", err)
+	}
+	undefined, optional := missingVars(t.Tree, deploymentVars)
+	if len(undefined) > 0 {
+		return nil, &undefinedVarsError{vars: undefined}
+	}
+	if len(optional) > 0 {
+		vars := make(map[string]string, len(deploymentVars)+len(optional))
+		for k, v := range deploymentVars {
+			vars[k] = v
+		}
+		for _, name := range optional {
+			vars[name] = ""
+		}
+		deploymentVars = vars
+	}
+	if err := t.Execute(fileContentParsed, deploymentVars); err != nil {
 		return nil, fmt.Errorf("Failed to execute parse file err: %s", err)
 	}
 	return fileContentParsed.Bytes(), nil
 }
 
+// Env returns the value of an environment variable allowed by AllowedEnv.
+func Env(name string) (string, error) {
+	allowed := false
+	for _, pattern := range AllowedEnv {
+		if ok, err := path.Match(pattern, name); err != nil {
+			return "", fmt.Errorf("invalid pattern %q of the allowed environment variables: %v", pattern, err)
+		} else if ok {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("environment variable %v is not allowed, allow it with --allow-env", name)
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %v is not set", name)
+	}
+	return value, nil
+}
+
 // DeploymentsParse parses the deployment files and returns the result as bytes grouped by the filename.
 // Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+// The variables which aren't set are reported for all the files in a single error.
+// A directory with a kustomization file is built as a kustomization, see buildKustomization,
+// and the HelmChart documents are replaced with the objects of their charts, see expandHelmCharts.
+// With HelmChartsOnly only the objects of the charts are returned.
 func DeploymentsParse(deploymentFiles []string, deploymentVars map[string]string) ([]Resource, error) {
 	var fileList []string
 	for _, name := range deploymentFiles {
 		if file, err := os.Stat(name); err == nil && file.IsDir() {
 			if err := filepath.Walk(name, func(path string, f os.FileInfo, err error) error {
-				if filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml" {
+				if f != nil && f.IsDir() {
+					// The files of a kustomization are read when building it.
+					if k := kustomizationFile(path); k != "" {
+						fileList = append(fileList, k)
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" || ext == ".json" {
 					fileList = append(fileList, path)
 				}
 				return nil
@@ -116,25 +271,150 @@ func DeploymentsParse(deploymentFiles []string, deploymentVars map[string]string
 		}
 	}
 
-	deploymentObjects := make([]Resource, 0)
-	for _, name := range fileList {
+	// readFile reads a file and applies the template variables.
+	readFile := func(name string) ([]byte, error) {
 		absFileName := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
 		content, err := ioutil.ReadFile(name)
 		if err != nil {
-			log.Fatalf("Error reading file %v:%v", name, err)
+			return nil, fmt.Errorf("error reading file %v:%v", name, err)
+		}
+		content, err = decodeContent(content, FileEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding file %v:%v", name, err)
 		}
 		// Don't parse file with the suffix "noparse".
 		if !strings.HasSuffix(absFileName, "noparse") {
 			content, err = applyTemplateVars(content, deploymentVars)
+			if _, ok := err.(*undefinedVarsError); ok {
+				return nil, err
+			}
 			if err != nil {
 				return nil, fmt.Errorf("couldn't apply template to file %s: %v", name, err)
 			}
 		}
+		return replaceSeparator(content, DocumentSeparator), nil
+	}
+
+	deploymentObjects := make([]Resource, 0)
+	// The files using each undefined variable.
+	undefined := map[string][]string{}
+	// readFileVars reads a file like readFile and records the undefined variables it uses.
+	readFileVars := func(name string) ([]byte, error) {
+		content, err := readFile(name)
+		if uErr, ok := err.(*undefinedVarsError); ok {
+			for _, v := range uErr.vars {
+				undefined[v] = append(undefined[v], name)
+			}
+		}
+		return content, err
+	}
+	for _, name := range fileList {
+		var content []byte
+		var err error
+		if isKustomization(name) {
+			if HelmChartsOnly {
+				continue
+			}
+			content, err = buildKustomization(filepath.Dir(name), readFileVars)
+			if _, ok := errors.Cause(err).(*undefinedVarsError); ok {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("couldn't build the kustomization %v: %v", filepath.Dir(name), err)
+			}
+		} else {
+			content, err = readFileVars(name)
+			if _, ok := err.(*undefinedVarsError); ok {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			content, err = expandHelmCharts(name, content, readFileVars)
+			if _, ok := errors.Cause(err).(*undefinedVarsError); ok {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("couldn't render the helm charts of %v: %v", name, err)
+			}
+			if HelmChartsOnly && len(content) == 0 {
+				continue
+			}
+		}
 		deploymentObjects = append(deploymentObjects, Resource{FileName: name, Content: content})
 	}
+	if len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for v := range undefined {
+			names = append(names, v)
+		}
+		sort.Strings(names)
+		for i, v := range names {
+			names[i] = fmt.Sprintf("%v (%v)", v, strings.Join(undefined[v], ", "))
+		}
+		return nil, fmt.Errorf("undefined variables, set them with -v or --vars-file: %v", strings.Join(names, ", "))
+	}
+	if HelmChartsOnly && len(deploymentObjects) == 0 {
+		return nil, fmt.Errorf("no %v documents in the deployment files", helmChartKind)
+	}
 	return deploymentObjects, nil
 }
 
+// decodeContent converts the content to utf-8 and removes the byte order mark.
+func decodeContent(content []byte, enc string) ([]byte, error) {
+	var e encoding.Encoding
+	switch strings.ToLower(enc) {
+	case "", "auto":
+		e = unicode.UTF8
+		// A yaml or json document starts with an ascii character
+		// so a utf-16 encoding has a zero byte in the first two.
+		if len(content) >= 2 && content[0] == 0 && content[1] != 0 {
+			e = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+		} else if len(content) >= 2 && content[0] != 0 && content[1] == 0 {
+			e = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+		}
+	case "utf-8", "utf8":
+		e = unicode.UTF8
+	case "utf-16le":
+		e = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case "utf-16be":
+		e = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %v", enc)
+	}
+	content, _, err := transform.Bytes(unicode.BOMOverride(e.NewDecoder()), content)
+	return content, err
+}
+
+// replaceSeparator replaces the lines matching the separator with the yaml "---" separator.
+func replaceSeparator(content []byte, separator string) []byte {
+	if separator == "" || separator == Separator {
+		return content
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	for i, line := range lines {
+		if trimmed := bytes.TrimRight(line, "\r\t "); string(trimmed) == separator {
+			lines[i] = append([]byte(Separator), line[len(trimmed):]...)
+		}
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// splitYAMLDocuments splits the content at the "---" lines.
+func splitYAMLDocuments(content []byte) [][]byte {
+	var docs [][]byte
+	var doc []byte
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if bytes.Equal(bytes.TrimRight(line, " \t\r\n"), []byte(Separator)) {
+			docs = append(docs, doc)
+			doc = nil
+			continue
+		}
+		doc = append(doc, line...)
+	}
+	return append(docs, doc)
+}
+
 // MergeDeploymentVars merges multiple maps based on the order.
 func MergeDeploymentVars(ms ...map[string]string) map[string]string {
 	res := map[string]string{}
@@ -145,3 +425,58 @@ func MergeDeploymentVars(ms ...map[string]string) map[string]string {
 	}
 	return res
 }
+
+// ResourceLabels returns the labels used to tag the clusters and nodepools created by infra
+// so that the expired ones can be garbage collected.
+func ResourceLabels(owner string, created time.Time) map[string]string {
+	if owner == "" {
+		owner = "infra"
+	}
+	return map[string]string{
+		CreatedLabel: strconv.FormatInt(created.Unix(), 10),
+		OwnerLabel:   labelValue(owner),
+	}
+}
+
+// Expired returns whether a resource tagged with ResourceLabels was created more than maxAge ago.
+// Resources without a creation label aren't managed by infra so are never expired.
+func Expired(labels map[string]string, maxAge time.Duration, now time.Time) bool {
+	created, err := strconv.ParseInt(labels[CreatedLabel], 10, 64)
+	if err != nil {
+		return false
+	}
+	return now.Sub(time.Unix(created, 0)) > maxAge
+}
+
+var invalidLabelChars = regexp.MustCompile("[^a-z0-9_-]")
+
+// labelValue converts s into a value accepted as a label by all providers.
+func labelValue(s string) string {
+	s = invalidLabelChars.ReplaceAllString(strings.ToLower(s), "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return s
+}
+
+// DryRunRequest prints a request that is skipped in dry-run mode.
+// Strings are printed as they are and other requests as json.
+// Requests without a body only print the operation.
+// The operation is recorded for the report of the command, see RecordAction.
+func DryRunRequest(operation string, req interface{}) error {
+	RecordAction("dry-run: "+operation, time.Now(), nil)
+	if req == nil {
+		fmt.Printf("# dry-run: %v\n", operation)
+		return nil
+	}
+	content, ok := req.(string)
+	if !ok {
+		out, err := json.MarshalIndent(req, "", "  ")
+		if err != nil {
+			return fmt.Errorf("printing the request of %v: %v", operation, err)
+		}
+		content = string(out)
+	}
+	fmt.Printf("# dry-run: %v\n%v\n", operation, strings.TrimRight(content, "\n"))
+	return nil
+}
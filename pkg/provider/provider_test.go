@@ -14,8 +14,35 @@
 package provider
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	pkgErrors "github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/alecthomas/kingpin.v2"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestMergeDeploymentVars(t *testing.T) {
@@ -57,3 +84,883 @@ func TestMergeDeploymentVars(t *testing.T) {
 		}
 	}
 }
+
+func TestExpired(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	labels := ResourceLabels("Prombench/PR-123", now.Add(-2*time.Hour))
+	if labels[OwnerLabel] != "prombench-pr-123" {
+		t.Errorf("unexpected owner label: %v", labels[OwnerLabel])
+	}
+
+	testCases := []struct {
+		labels  map[string]string
+		maxAge  time.Duration
+		expired bool
+	}{
+		{labels: labels, maxAge: time.Hour, expired: true},
+		{labels: labels, maxAge: 3 * time.Hour, expired: false},
+		{labels: map[string]string{}, maxAge: time.Hour, expired: false},
+		{labels: map[string]string{CreatedLabel: "invalid"}, maxAge: time.Hour, expired: false},
+	}
+	for _, tc := range testCases {
+		if got := Expired(tc.labels, tc.maxAge, now); got != tc.expired {
+			t.Errorf("labels:%v max age:%v expected expired:%v, got:%v", tc.labels, tc.maxAge, tc.expired, got)
+		}
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	utf16le := []byte{'a', 0, ':', 0, ' ', 0, 'b', 0}
+	utf16be := []byte{0, 'a', 0, ':', 0, ' ', 0, 'b'}
+	testCases := []struct {
+		content  []byte
+		encoding string
+	}{
+		{content: []byte("a: b"), encoding: "auto"},
+		{content: []byte("\xef\xbb\xbfa: b"), encoding: "auto"},
+		{content: append([]byte{0xff, 0xfe}, utf16le...), encoding: "auto"},
+		{content: append([]byte{0xfe, 0xff}, utf16be...), encoding: "auto"},
+		{content: utf16le, encoding: "auto"},
+		{content: utf16be, encoding: "auto"},
+		{content: utf16le, encoding: "utf-16le"},
+		{content: []byte("\xef\xbb\xbfa: b"), encoding: "utf-8"},
+	}
+	for _, tc := range testCases {
+		got, err := decodeContent(tc.content, tc.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "a: b" {
+			t.Errorf("content:%q encoding:%v expected %q, got %q", tc.content, tc.encoding, "a: b", got)
+		}
+	}
+}
+
+func TestReplaceSeparator(t *testing.T) {
+	content := "a: 1\r\n%%%\r\nb: '%%% in a string'\n%%%\nc: 3"
+	expected := "a: 1\r\n---\r\nb: '%%% in a string'\n---\nc: 3"
+	if got := string(replaceSeparator([]byte(content), "%%%")); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestChaos(t *testing.T) {
+	defer func() {
+		ChaosProbability, ChaosSeed, chaosRand = 0, 0, nil
+	}()
+
+	run := func(probability float64, seed int64) []string {
+		ChaosProbability, ChaosSeed, chaosRand = probability, seed, nil
+		var failures []string
+		for i := 0; i < 100; i++ {
+			if err := Chaos("op"); err != nil {
+				failures = append(failures, err.Error())
+			}
+		}
+		return failures
+	}
+
+	if failures := run(0, 1); len(failures) != 0 {
+		t.Errorf("expected no failures without chaos, got %v", len(failures))
+	}
+	if failures := run(1, 1); len(failures) != 100 {
+		t.Errorf("expected all calls to fail, got %v failures", len(failures))
+	}
+	first := run(0.3, 42)
+	if len(first) == 0 || len(first) == 100 {
+		t.Errorf("expected some calls to fail, got %v failures", len(first))
+	}
+	if second := run(0.3, 42); !reflect.DeepEqual(first, second) {
+		t.Error("expected the same failures with the same seed")
+	}
+
+	// Injected failures and timeouts are returned before the first retry.
+	ChaosProbability, ChaosSeed, chaosRand = 1, 1, nil
+	if err := RetryUntilTrue("op", 1, func() (bool, error) { return true, nil }); err == nil {
+		t.Error("expected an error from the injected failure")
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifests := filepath.Join(dir, "manifests")
+	files := map[string]string{
+		"a.yaml":             "name: {{ .NAME }}\n",
+		"sub/b.yaml":         "a: 1\n---\nb: {{ .NAME }}\n",
+		"sub/c_noparse.yaml": "name: {{ .NAME }}\n",
+		"sub/ignored.txt":    "ignored",
+		"sub/deeper/d.json":  `{"name": "{{ .NAME }}"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(manifests, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(dir, "out")
+	r := NewRender(&DeploymentResource{
+		DeploymentFiles:    []string{manifests},
+		FlagDeploymentVars: map[string]string{"NAME": "test"},
+	})
+	r.OutputDir = out
+	if err := r.Render(nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"a.yaml":             "name: test\n",
+		"sub/b.yaml":         "a: 1\n---\nb: test\n",
+		"sub/c_noparse.yaml": "name: {{ .NAME }}\n",
+		"sub/deeper/d.json":  `{"name": "test"}`,
+	}
+	for name, content := range expected {
+		got, err := ioutil.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%v: expected %q, got %q", name, content, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "sub/ignored.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected sub/ignored.txt not to be rendered, got %v", err)
+	}
+
+	// The same file names in different folders can't be written to the same directory.
+	r.DeploymentResource.DeploymentFiles = []string{filepath.Join(manifests, "sub"), filepath.Join(manifests, "sub")}
+	if err := r.Render(nil); err == nil {
+		t.Error("expected an error for files rendered to the same path")
+	}
+
+	var buf bytes.Buffer
+	if err := writeRendered(&buf, Resource{FileName: "a.yaml", Content: []byte("name: test\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "---\n# Source: a.yaml\nname: test\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+func TestRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifests := filepath.Join(dir, "manifests")
+	if err := os.MkdirAll(manifests, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(manifests, "a.yaml"), []byte("name: {{ .NAME }}\ntoken: {{ .API_TOKEN }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := kingpin.New("test", "")
+	app.Command("render", "")
+	app.Command("runs", "").Command("list", "")
+	r := NewRuns(&DeploymentResource{
+		DeploymentFiles:    []string{manifests},
+		FlagDeploymentVars: map[string]string{"NAME": "test", "API_TOKEN": "s3cr3t"},
+	})
+	r.Dir = filepath.Join(dir, "runs")
+	r.ID = "pr-1"
+	for _, args := range [][]string{{"render"}, {"runs", "list"}, {"render"}} {
+		c, err := app.ParseContext(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Record(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(r.Dir, "pr-1", "run.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record runRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Commands) != 2 {
+		t.Fatalf("expected the 2 render commands to be recorded, got %v", len(record.Commands))
+	}
+	if record.Commands[0].Digest != record.Commands[1].Digest {
+		t.Error("expected the same digest for the same inputs")
+	}
+	rendered, err := ioutil.ReadFile(filepath.Join(r.Dir, "pr-1", record.Commands[1].Manifests, "a.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "name: test\ntoken: <redacted>\n"; string(rendered) != expected {
+		t.Errorf("expected rendered manifest %q, got %q", expected, rendered)
+	}
+	vars, err := readVarsFile(filepath.Join(r.Dir, "pr-1", "vars.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["NAME"] != "test" || vars["API_TOKEN"] != redacted {
+		t.Errorf("unexpected recorded vars %v", vars)
+	}
+
+	r.ExportID = "pr-1"
+	r.Output = filepath.Join(dir, "pr-1.tar.gz")
+	if err := r.Export(nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(r.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[hdr.Name] = true
+	}
+	for _, name := range []string{"pr-1/run.json", "pr-1/vars.yaml", "pr-1/manifests/1-render/a.yaml", "pr-1/manifests/2-render/a.yaml"} {
+		if !names[name] {
+			t.Errorf("expected %v in the tarball, got %v", name, names)
+		}
+	}
+
+	r.ExportID = "../pr-1"
+	if err := r.Export(nil); err == nil {
+		t.Error("expected an error for an invalid run id")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(b Backoff) { RetryBackoff = b }(RetryBackoff)
+	RetryBackoff = Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond, Attempts: 3}
+
+	for _, tc := range []struct {
+		err       error
+		transient bool
+	}{
+		{err: errors.New("invalid"), transient: false},
+		{err: apiErrors.NewTooManyRequests("slow down", 1), transient: true},
+		{err: apiErrors.NewInternalError(errors.New("etcd")), transient: true},
+		{err: apiErrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "a"), transient: false},
+		{err: &googleapi.Error{Code: http.StatusBadGateway}, transient: true},
+		{err: status.Error(codes.Unavailable, "unavailable"), transient: true},
+		{err: status.Error(codes.InvalidArgument, "invalid"), transient: false},
+		{err: pkgErrors.Wrap(&url.Error{Op: "Get", URL: "/", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, "get"), transient: true},
+		{err: &InjectedError{Operation: "a"}, transient: true},
+		{err: &InjectedError{Operation: "a", Timeout: true}, transient: false},
+		{err: context.Canceled, transient: false},
+	} {
+		if got := IsTransient(tc.err); got != tc.transient {
+			t.Errorf("%v: expected transient %v, got %v", tc.err, tc.transient, got)
+		}
+	}
+
+	calls := 0
+	err := Retry(context.Background(), "test", func() error {
+		calls++
+		return &InjectedError{Operation: "test"}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected an error after 3 calls, got %v after %v calls", err, calls)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err := Retry(ctx, "test", func() error { calls++; return &InjectedError{Operation: "test"} }); err == nil || calls != 1 {
+		t.Errorf("expected an error after 1 call with a done context, got %v after %v calls", err, calls)
+	}
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "body" {
+			t.Errorf("expected the body of every attempt, got %q", body)
+		}
+		if r.URL.Path == "/fail" || requests < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	hc := &http.Client{Transport: RetryTransport(http.DefaultTransport)}
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		requests     int
+	}{
+		{method: http.MethodPut, path: "/", status: http.StatusOK, requests: 3},
+		// A POST could have been processed.
+		{method: http.MethodPost, path: "/fail", status: http.StatusInternalServerError, requests: 1},
+		{method: http.MethodPut, path: "/fail", status: http.StatusInternalServerError, requests: 3},
+	} {
+		requests = 0
+		req, err := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader("body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := hc.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || requests != tc.requests {
+			t.Errorf("%v %v: expected status %v after %v requests, got %v after %v", tc.method, tc.path, tc.status, tc.requests, resp.StatusCode, requests)
+		}
+	}
+}
+
+func TestLoadVarsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.yaml":      "PR_NUMBER: 1\nRELEASE: master\nPREEMPTIBLE: true\nRATIO: 0.5\nEMPTY:\n",
+		"b.yaml":      "PR_NUMBER: \"2\"\nZONE: europe-west1-b\n",
+		"nested.yaml": "NODES:\n  count: 3\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dr := NewDeploymentResource()
+	dr.VarsFiles = []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}
+	dr.FlagDeploymentVars = map[string]string{"ZONE": "us-east1-b"}
+	if err := dr.LoadVarsFiles(nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"PR_NUMBER":   "2",
+		"RELEASE":     "master",
+		"PREEMPTIBLE": "true",
+		"RATIO":       "0.5",
+		"EMPTY":       "",
+		"ZONE":        "us-east1-b",
+	}
+	if !reflect.DeepEqual(dr.FlagDeploymentVars, expected) {
+		t.Errorf("expected %v, got %v", expected, dr.FlagDeploymentVars)
+	}
+
+	dr.VarsFiles = []string{filepath.Join(dir, "nested.yaml")}
+	if err := dr.LoadVarsFiles(nil); err == nil {
+		t.Error("expected an error for a nested value")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	defer func(allowed []string) { AllowedEnv = allowed }(AllowedEnv)
+	os.Setenv("INFRA_TEST_SHA", "abc")
+	os.Setenv("INFRA_TEST_EMPTY", "")
+	os.Setenv("INFRA_SECRET", "secret")
+	defer os.Unsetenv("INFRA_TEST_SHA")
+	defer os.Unsetenv("INFRA_TEST_EMPTY")
+	defer os.Unsetenv("INFRA_SECRET")
+
+	AllowedEnv = []string{"INFRA_TEST_*"}
+	testCases := []struct {
+		content  string
+		expected string
+		invalid  bool
+	}{
+		{content: `sha: {{ env "INFRA_TEST_SHA" }}`, expected: "sha: abc"},
+		{content: `sha: "{{ env "INFRA_TEST_EMPTY" }}"`, expected: `sha: ""`},
+		{content: `sha: {{ env "INFRA_TEST_UNSET" }}`, invalid: true},
+		{content: `sha: {{ env "INFRA_SECRET" }}`, invalid: true},
+	}
+	for _, tc := range testCases {
+		got, err := applyTemplateVars([]byte(tc.content), map[string]string{})
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %s", tc.content, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.content, err)
+			continue
+		}
+		if string(got) != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.content, tc.expected, got)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	vars := map[string]string{"NAME": " prombench ", "EMPTY": "", "LIST": "a,b"}
+	testCases := []struct {
+		content  string
+		expected string
+		invalid  bool
+	}{
+		{content: `{{ .MISSING | default "v2.20.0" }}`, expected: "v2.20.0"},
+		{content: `{{ .EMPTY | default "v2.20.0" }}`, expected: "v2.20.0"},
+		{content: `{{ default "x" .NAME | trim | upper }}`, expected: "PROMBENCH"},
+		{content: `{{ coalesce .MISSING .EMPTY "last" }}`, expected: "last"},
+		{content: `{{ if .MISSING }}set{{ else }}unset{{ end }}`, expected: "unset"},
+		{content: `{{ .NAME | trim | b64enc }}`, expected: "cHJvbWJlbmNo"},
+		{content: `{{ "cHJvbWJlbmNo" | b64dec | quote }}`, expected: `"prombench"`},
+		{content: `{{ split .LIST "," | toYaml }}`, expected: "- a\n- b"},
+		{content: `args:{{ list "--a" "--b" | toYaml | nindent 2 }}`, expected: "args:\n  - --a\n  - --b"},
+		{content: `{{ range split .LIST "," }}{{ . }}{{ $.NAME | trim }}{{ end }}`, expected: "aprombenchbprombench"},
+		{content: `{{ range split .LIST "," }}{{ $.MISSING }}{{ end }}`, invalid: true},
+		{content: `{{ required "NAME is required" .MISSING }}`, invalid: true},
+		{content: `{{ .MISSING }} {{ $.OTHER }} {{ .NAME }}`, invalid: true},
+	}
+	for _, tc := range testCases {
+		got, err := applyTemplateVars([]byte(tc.content), vars)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %s", tc.content, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.content, err)
+			continue
+		}
+		if string(got) != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.content, tc.expected, got)
+		}
+	}
+
+	_, err := applyTemplateVars([]byte(`{{ .B }} {{ .A }} {{ .B | default "b" }}`), vars)
+	if err == nil || err.Error() != "undefined variables: A, B" {
+		t.Errorf("expected the undefined variables to be listed, got %v", err)
+	}
+}
+
+func TestDeploymentsParseUndefinedVars(t *testing.T) {
+	dir, err := ioutil.TempDir("", "undefined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.yaml": "name: {{ .NAME }}-{{ .ZONE }}\nversion: {{ .VERSION | default \"master\" }}\n",
+		"b.yaml": "zone: {{ .ZONE }}\n{{ if .DEBUG }}debug: true{{ end }}\n",
+		"c.yaml": "name: {{ .NAME }}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = DeploymentsParse([]string{dir}, map[string]string{"NAME": "test"})
+	expected := fmt.Sprintf("undefined variables, set them with -v or --vars-file: ZONE (%v, %v)",
+		filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml"))
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %q, got %v", expected, err)
+	}
+
+	resources, err := DeploymentsParse([]string{dir}, map[string]string{"NAME": "test", "ZONE": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(resources[0].Content); got != "name: test-eu\nversion: master\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+	if got := string(resources[1].Content); got != "zone: eu\n\n" {
+		t.Errorf("unexpected content %q", got)
+	}
+}
+
+func TestKustomization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kustomize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"base/kustomization.yaml": "resources:\n- deployment.yaml\n- namespace.yaml\n",
+		"base/namespace.yaml":     "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prombench-{{ .PR_NUMBER }}\n",
+		"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: prometheus
+  template:
+    metadata:
+      labels:
+        app: prometheus
+    spec:
+      containers:
+      - name: prometheus
+        image: quay.io/prometheus/prometheus:v2.20.0
+        args:
+        - --storage.tsdb.path=/data
+      - name: sidecar
+        image: busybox
+`,
+		"overlays/dev/kustomization.yaml": `resources:
+- ../../base
+namespace: prombench-{{ .PR_NUMBER }}
+commonLabels:
+  env: dev
+images:
+- name: quay.io/prometheus/prometheus
+  newTag: "{{ .RELEASE }}"
+patchesStrategicMerge:
+- resources.yaml
+patchesJson6902:
+- target:
+    kind: Deployment
+    name: prometheus
+  patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 2
+`,
+		"overlays/dev/resources.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prometheus
+spec:
+  template:
+    spec:
+      containers:
+      - name: prometheus
+        resources:
+          limits:
+            memory: 1Gi
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resources, err := DeploymentsParse([]string{filepath.Join(dir, "overlays")}, map[string]string{"PR_NUMBER": "1", "RELEASE": "v2.21.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 || resources[0].FileName != filepath.Join(dir, "overlays/dev/kustomization.yaml") {
+		t.Fatalf("expected the kustomization as a single resource, got %+v", resources)
+	}
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    env: dev
+  name: prometheus
+  namespace: prombench-1
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: prometheus
+      env: dev
+  template:
+    metadata:
+      labels:
+        app: prometheus
+        env: dev
+    spec:
+      containers:
+      - args:
+        - --storage.tsdb.path=/data
+        image: quay.io/prometheus/prometheus:v2.21.0
+        name: prometheus
+        resources:
+          limits:
+            memory: 1Gi
+      - image: busybox
+        name: sidecar
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  labels:
+    env: dev
+  name: prombench-1
+`
+	if got := string(resources[0].Content); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if _, err := DeploymentsParse([]string{filepath.Join(dir, "overlays")}, map[string]string{"PR_NUMBER": "1"}); err == nil || !strings.Contains(err.Error(), "RELEASE") {
+		t.Errorf("expected the undefined RELEASE variable, got %v", err)
+	}
+
+	// The whole kustomization is supported, like the generators and their options.
+	generator := filepath.Join(dir, "generator")
+	if err := os.MkdirAll(generator, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(generator, "kustomization.yaml"), []byte(`configMapGenerator:
+- name: config
+  literals:
+  - pr={{ .PR_NUMBER }}
+  options:
+    disableNameSuffixHash: true
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resources, err = DeploymentsParse([]string{generator}, map[string]string{"PR_NUMBER": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `apiVersion: v1
+data:
+  pr: "1"
+kind: ConfigMap
+metadata:
+  name: config
+`
+	if got := string(resources[0].Content); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+// fieldMap returns the map at the path of fields of m, nil when missing.
+func fieldMap(m map[string]interface{}, fields ...string) map[string]interface{} {
+	for _, f := range fields {
+		c, ok := m[f].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		m = c
+	}
+	return m
+}
+
+func TestHelmChart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "helm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(cacheDir string) { HelmCacheDir = cacheDir }(HelmCacheDir)
+	HelmCacheDir = filepath.Join(dir, "cache")
+
+	chartFiles := map[string]string{
+		"app/Chart.yaml": `apiVersion: v2
+name: app
+version: 0.1.0
+appVersion: 1.2.3
+dependencies:
+- name: cache
+  condition: cache.enabled
+`,
+		"app/values.yaml": `replicas: 1
+image:
+  repository: nginx
+  tag: ""
+greeting: hello {{ .Release.Name }}
+cache:
+  enabled: false
+global:
+  env: dev
+`,
+		"app/templates/_helpers.tpl": `{{- define "app.fullname" -}}
+{{- printf "%s-%s" .Release.Name .Chart.Name | trunc 63 | trimSuffix "-" -}}
+{{- end -}}
+{{- define "app.labels" -}}
+app: {{ include "app.fullname" . }}
+{{- end -}}
+`,
+		"app/templates/deployment.yaml": `apiVersion: {{ if semverCompare ">=1.9-0" .Capabilities.KubeVersion.GitVersion }}apps/v1{{ else }}extensions/v1beta1{{ end }}
+kind: Deployment
+metadata:
+  name: {{ include "app.fullname" . }}
+  labels:
+    {{- include "app.labels" . | nindent 4 }}
+spec:
+  replicas: {{ .Values.replicas }}
+  template:
+    metadata:
+      annotations:
+        checksum/config: {{ include (print $.Template.BasePath "/configmap.yaml") . | sha256sum }}
+    spec:
+      containers:
+      - name: app
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"
+        {{- with .Values.resources }}
+        resources:
+          {{- toYaml . | nindent 10 }}
+        {{- end }}
+`,
+		"app/templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "app.fullname" . }}
+data:
+  {{- (.Files.Glob "files/*.conf").AsConfig | nindent 2 }}
+  greeting: {{ tpl .Values.greeting . | quote }}
+`,
+		"app/templates/tests/test.yaml": `apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ include "app.fullname" . }}-test
+  annotations:
+    helm.sh/hook: test
+`,
+		"app/templates/NOTES.txt":      "{{ .Release.Name }} is installed.\n",
+		"app/files/app.conf":           "port 80\n",
+		"app/crds/foo.yaml":            "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: foos.example.com\n",
+		"app/charts/cache/Chart.yaml":  "apiVersion: v2\nname: cache\nversion: 0.1.0\n",
+		"app/charts/cache/values.yaml": "port: 6379\n",
+		"app/charts/cache/templates/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .Release.Name }}-cache
+  labels:
+    env: {{ .Values.global.env }}
+spec:
+  ports:
+  - port: {{ .Values.port }}
+`,
+	}
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, content := range chartFiles {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(archive.Bytes())
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			fmt.Fprintf(w, "apiVersion: v1\nentries:\n  app:\n  - name: app\n    apiVersion: v2\n    version: 0.2.0\n    urls: [charts/app-0.2.0.tgz]\n  - name: app\n    apiVersion: v2\n    version: 0.1.0\n    urls: [charts/app-0.1.0.tgz]\n    digest: %x\n", digest)
+		case "/charts/app-0.1.0.tgz":
+			w.Write(archive.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer repo.Close()
+
+	files := map[string]string{
+		"app.yaml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: monitoring
+---
+apiVersion: infra.prometheus.io/v1
+kind: HelmChart
+metadata:
+  name: test
+  namespace: monitoring
+spec:
+  repo: {{ .REPO }}
+  chart: app
+  version: "{{ .VERSION }}"
+  valuesFiles:
+  - app-values.yaml
+  values:
+    replicas: {{ .REPLICAS }}
+    cache:
+      enabled: true
+      port: 6380
+`,
+		"app-values.yaml": "global:\n  env: {{ .ENV }}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vars := map[string]string{"REPO": repo.URL, "VERSION": "~0.1.0", "REPLICAS": "3", "ENV": "prod"}
+
+	resources, err := DeploymentsParse([]string{filepath.Join(dir, "app.yaml")}, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := decodeKObjects("app.yaml", resources[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	byKind := map[string]kobject{}
+	for _, o := range objects {
+		kinds = append(kinds, o.gvk().Kind)
+		byKind[o.gvk().Kind] = o
+	}
+	if expected := []string{"Namespace", "CustomResourceDefinition", "ConfigMap", "Service", "Deployment"}; !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("expected the kinds %v, got %v", expected, kinds)
+	}
+	if ns := byKind["CustomResourceDefinition"].namespace(); ns != "" {
+		t.Errorf("expected no namespace for the cluster scoped CRD, got %v", ns)
+	}
+
+	d := byKind["Deployment"]
+	container := d["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	checksum, _ := fieldMap(d, "spec", "template", "metadata", "annotations")["checksum/config"].(string)
+	if d.gvk().GroupVersion().String() != "apps/v1" || d.name() != "test-app" || d.namespace() != "monitoring" ||
+		d["spec"].(map[string]interface{})["replicas"] != 3.0 || container["image"] != "nginx:1.2.3" ||
+		fieldMap(d, "metadata", "labels")["app"] != "test-app" || len(checksum) != 64 {
+		t.Errorf("unexpected deployment %v", d)
+	}
+	if data := fieldMap(byKind["ConfigMap"], "data"); data["app.conf"] != "port 80\n" || data["greeting"] != "hello test" {
+		t.Errorf("unexpected config map data %v", data)
+	}
+	s := byKind["Service"]
+	port := s["spec"].(map[string]interface{})["ports"].([]interface{})[0].(map[string]interface{})["port"]
+	if s.name() != "test-cache" || fieldMap(s, "metadata", "labels")["env"] != "prod" || port != 6380.0 {
+		t.Errorf("unexpected service %v", s)
+	}
+
+	// The helm-install command keeps only the objects of the charts.
+	HelmChartsOnly = true
+	defer func() { HelmChartsOnly = false }()
+	resources, err = DeploymentsParse([]string{filepath.Join(dir, "app.yaml"), filepath.Join(dir, "app-values.yaml")}, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 {
+		t.Fatalf("expected only the resource of app.yaml, got %v", len(resources))
+	}
+	objects, err = decodeKObjects("app.yaml", resources[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range objects {
+		if o.gvk().Kind == "Namespace" {
+			t.Errorf("unexpected object %v which isn't in the chart", o)
+		}
+	}
+	if _, err := DeploymentsParse([]string{filepath.Join(dir, "app-values.yaml")}, vars); err == nil {
+		t.Error("expected an error for deployment files without charts")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Reconciliation records what a create did with each resource of the deployment files.
+// A resource which already exists, for example after a crashed run, is adopted when it
+// matches the deployment file and replaced when it diverges, instead of failing the create.
+type Reconciliation struct {
+	kind     string
+	created  []string
+	adopted  []string
+	replaced []string
+}
+
+// NewReconciliation returns a Reconciliation of the resources of a kind, e.g. nodepools.
+func NewReconciliation(kind string) *Reconciliation {
+	return &Reconciliation{kind: kind}
+}
+
+// Created records a resource which didn't exist.
+func (r *Reconciliation) Created(name string) {
+	r.created = append(r.created, name)
+}
+
+// Adopted records an existing resource which matches the deployment file.
+func (r *Reconciliation) Adopted(name string) {
+	log.Printf("Adopting the existing %v '%v' which matches the deployment file", r.kind, name)
+	r.adopted = append(r.adopted, name)
+}
+
+// Replaced records an existing resource which was deleted and created again,
+// the reasons tell how it diverged from the deployment file.
+func (r *Reconciliation) Replaced(name string, reasons []string) {
+	log.Printf("Replacing the existing %v '%v': %v", r.kind, name, strings.Join(reasons, ", "))
+	r.replaced = append(r.replaced, fmt.Sprintf("%v (%v)", name, strings.Join(reasons, ", ")))
+}
+
+// Report logs the resources which were created, adopted and replaced.
+func (r *Reconciliation) Report() {
+	if len(r.adopted) == 0 && len(r.replaced) == 0 {
+		return
+	}
+	log.Printf("Found existing %vs, created: %v, adopted: %v, replaced: %v", r.kind, list(r.created), list(r.adopted), list(r.replaced))
+}
+
+func list(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Render writes the deployment files after applying the template variables,
+// to review or commit what will be applied.
+type Render struct {
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *DeploymentResource
+	// Directory to write the rendered files to, keeping the layout of the deployment folders.
+	// The files are written to stdout when empty.
+	OutputDir string
+}
+
+// NewRender is the Render constructor.
+func NewRender(dr *DeploymentResource) *Render {
+	return &Render{DeploymentResource: dr}
+}
+
+// Render renders the deployment files to the OutputDir or stdout.
+func (r *Render) Render(*kingpin.ParseContext) error {
+	if len(r.DeploymentResource.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+	vars := MergeDeploymentVars(
+		r.DeploymentResource.DefaultDeploymentVars,
+		r.DeploymentResource.FlagDeploymentVars,
+	)
+
+	// Report the undefined variables of all the files at once.
+	if _, err := DeploymentsParse(r.DeploymentResource.DeploymentFiles, vars); err != nil {
+		return err
+	}
+
+	// Each deployment file or folder is parsed on its own to know the path of the files within the folders.
+	written := map[string]string{}
+	for _, name := range r.DeploymentResource.DeploymentFiles {
+		deployments, err := DeploymentsParse([]string{name}, vars)
+		if err != nil {
+			return err
+		}
+		for _, d := range deployments {
+			if r.OutputDir == "" {
+				if err := writeRendered(os.Stdout, d); err != nil {
+					return err
+				}
+				continue
+			}
+
+			rel := filepath.Base(d.FileName)
+			if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+				if rel, err = filepath.Rel(name, d.FileName); err != nil {
+					return err
+				}
+			}
+			if other, ok := written[rel]; ok {
+				return fmt.Errorf("both %v and %v render to %v", other, d.FileName, rel)
+			}
+			written[rel] = d.FileName
+
+			path := filepath.Join(r.OutputDir, rel)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(path, d.Content, 0644); err != nil {
+				return fmt.Errorf("error writing file %v:%v", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeRendered writes the content of a deployment file as a yaml document
+// with a comment naming the source file.
+func writeRendered(w io.Writer, d Resource) error {
+	content := bytes.TrimRight(d.Content, "\n")
+	_, err := fmt.Fprintf(w, "%v\n# Source: %v\n%s\n", Separator, d.FileName, content)
+	return err
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
+)
+
+// actions are the actions of the command recorded with RecordAction.
+var actions struct {
+	mtx  sync.Mutex
+	list []Action
+}
+
+// Action is an action taken by a command, like creating a cluster or applying an object.
+type Action struct {
+	Name            string    `json:"name"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// RecordAction records an action started at start for the report of the command.
+// A nil error is a successful action.
+func RecordAction(name string, start time.Time, err error) {
+	a := Action{
+		Name:            name,
+		Start:           start.UTC(),
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	actions.mtx.Lock()
+	actions.list = append(actions.list, a)
+	actions.mtx.Unlock()
+}
+
+// Report writes a machine readable report of the command and the actions it took,
+// so CI jobs can summarize a run without parsing the logs.
+type Report struct {
+	// File is the json report, yaml with a .yaml or .yml extension. Nothing is written when empty.
+	File string
+
+	command string
+	start   time.Time
+}
+
+// reportFile is the content of the Report file.
+type reportFile struct {
+	Command         string    `json:"command"`
+	Version         string    `json:"version"`
+	DryRun          bool      `json:"dryRun"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Success         bool      `json:"success"`
+	Error           string    `json:"error,omitempty"`
+	Actions         []Action  `json:"actions"`
+}
+
+// NewReport is the Report constructor.
+func NewReport() *Report {
+	return &Report{start: time.Now()}
+}
+
+// Start records the command of the report, it runs before the actions of the command.
+func (r *Report) Start(c *kingpin.ParseContext) error {
+	if c.SelectedCommand != nil {
+		r.command = c.SelectedCommand.FullCommand()
+	}
+	r.start = time.Now()
+	return nil
+}
+
+// Write writes the report with the error of the command.
+func (r *Report) Write(cmdErr error) error {
+	if r.File == "" {
+		return nil
+	}
+	actions.mtx.Lock()
+	rep := reportFile{
+		Command:         r.command,
+		Version:         version.Version,
+		DryRun:          DryRun,
+		Start:           r.start.UTC(),
+		DurationSeconds: time.Since(r.start).Seconds(),
+		Success:         cmdErr == nil,
+		Actions:         append([]Action{}, actions.list...),
+	}
+	actions.mtx.Unlock()
+	if cmdErr != nil {
+		rep.Error = cmdErr.Error()
+	}
+
+	var (
+		content []byte
+		err     error
+	)
+	switch filepath.Ext(r.File) {
+	case ".yaml", ".yml":
+		content, err = yaml.Marshal(rep)
+	default:
+		content, err = json.MarshalIndent(rep, "", "  ")
+	}
+	if err != nil {
+		return errors.Wrap(err, "encoding the report")
+	}
+	return errors.Wrapf(ioutil.WriteFile(r.File, content, 0644), "writing the report %v", r.File)
+}
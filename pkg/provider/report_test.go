@@ -0,0 +1,72 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The other tests record actions too.
+	actions.list = nil
+	defer func() { actions.list = nil }()
+
+	start := time.Now().Add(-time.Minute)
+	RecordAction("creating cluster:test", start, nil)
+	RecordAction("apply Deployment prometheus", start, errors.New("timed out"))
+
+	for _, name := range []string{"report.json", "report.yaml"} {
+		r := NewReport()
+		r.File = filepath.Join(dir, name)
+		r.command = "gke cluster create"
+		if err := r.Write(errors.New("creating cluster")); err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadFile(r.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The yaml parser also reads json.
+		var rep reportFile
+		if err := yaml.UnmarshalStrict(content, &rep); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if rep.Command != "gke cluster create" || rep.Success || rep.Error != "creating cluster" {
+			t.Errorf("%v: unexpected command %q, success %v and error %q", name, rep.Command, rep.Success, rep.Error)
+		}
+		if len(rep.Actions) != 2 || rep.Actions[0].Name != "creating cluster:test" || rep.Actions[0].Error != "" || rep.Actions[1].Error != "timed out" {
+			t.Errorf("%v: unexpected actions %+v", name, rep.Actions)
+		}
+		if d := rep.Actions[0].DurationSeconds; d < 60 {
+			t.Errorf("%v: expected a duration of at least 60s, got %v", name, d)
+		}
+	}
+
+	// Nothing is written without a file.
+	if err := NewReport().Write(nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Backoff is the exponential backoff between the attempts of a call.
+type Backoff struct {
+	// Initial is the delay before the first retry, doubled for every following retry.
+	Initial time.Duration
+	// Max caps the delay between two attempts.
+	Max time.Duration
+	// Attempts is the number of calls, including the first one.
+	Attempts int
+}
+
+// RetryBackoff is the backoff of the retries of the transient errors of the provider APIs.
+var RetryBackoff = Backoff{Initial: time.Second, Max: 30 * time.Second, Attempts: 6}
+
+// delay returns the delay after the attempt, starting at 1.
+// The delay is jittered between half and all of the exponential delay so that concurrent callers spread out.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Retry calls fn until it succeeds or returns an error which isn't transient, with the RetryBackoff between the attempts.
+// It returns the last error when the attempts are exhausted or the context is done.
+func Retry(ctx context.Context, operation string, fn func() error) error {
+	b := RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= b.Attempts || !IsTransient(err) {
+			return err
+		}
+		d := b.delay(attempt)
+		log.Printf("'%v' failed with a transient error, retrying in %v: %v", operation, d.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
+
+// IsTransient returns true for the errors of a call which can succeed when retried:
+// the 429 and 5xx responses of the APIs, refused and reset connections, network timeouts and the failures injected by Chaos.
+func IsTransient(err error) bool {
+	for err != nil {
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return false
+		}
+		switch e := err.(type) {
+		case *InjectedError:
+			return !e.Timeout
+		case apiErrors.APIStatus:
+			return transientStatus(int(e.Status().Code))
+		case *googleapi.Error:
+			return transientStatus(e.Code)
+		case interface{ GRPCStatus() *status.Status }:
+			switch e.GRPCStatus().Code() {
+			case codes.Unavailable, codes.ResourceExhausted:
+				return true
+			}
+			return false
+		case interface{ StatusCode() int }:
+			// The request failures of the AWS SDK.
+			return transientStatus(e.StatusCode())
+		case syscall.Errno:
+			return e == syscall.ECONNREFUSED || e == syscall.ECONNRESET
+		case interface{ Timeout() bool }:
+			if e.Timeout() {
+				return true
+			}
+		}
+		err = unwrap(err)
+	}
+	return false
+}
+
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500 && code != http.StatusNotImplemented
+}
+
+// unwrap returns the error wrapped by err, nil when it doesn't wrap an error.
+func unwrap(err error) error {
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	case interface{ Cause() error }:
+		return e.Cause()
+	}
+	return nil
+}
+
+// refused returns true when the connection of a request was refused, so the request wasn't sent.
+func refused(err error) bool {
+	for ; err != nil; err = unwrap(err) {
+		if err == syscall.ECONNREFUSED {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryTransport retries the requests of the transport which fail with a transient error with the RetryBackoff.
+// A POST isn't idempotent so it is only retried when it wasn't processed: for a 429, a 503 or a refused connection.
+// Requests with a body which can't be read again aren't retried.
+func RetryTransport(rt http.RoundTripper) http.RoundTripper {
+	return &retryTransport{next: rt}
+}
+
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		return t.next.RoundTrip(req)
+	}
+	b := RetryBackoff
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.WithContext(req.Context())
+			r.Body = body
+		}
+		resp, err := t.next.RoundTrip(r)
+
+		var retryErr error
+		switch {
+		case err != nil:
+			if (req.Method != http.MethodPost || refused(err)) && IsTransient(err) {
+				retryErr = err
+			}
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable,
+			req.Method != http.MethodPost && transientStatus(resp.StatusCode):
+			retryErr = errors.New(resp.Status)
+		}
+		if retryErr == nil || attempt >= b.Attempts {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		d := b.delay(attempt)
+		log.Printf("'%v %v' failed with a transient error, retrying in %v: %v", req.Method, req.URL.Path, d.Round(time.Millisecond), retryErr)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(d):
+		}
+	}
+}
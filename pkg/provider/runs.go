@@ -0,0 +1,383 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/version"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+// redacted replaces the values of the secret variables in the recorded runs.
+const redacted = "<redacted>"
+
+// secretVar matches the names of the variables which are kept out of the recorded runs.
+var secretVar = regexp.MustCompile(`(?i)(password|secret|token|credential|private|auth)`)
+
+// Runs records the inputs of the commands of a run, to reproduce or audit its results later.
+type Runs struct {
+	DeploymentResource *DeploymentResource
+	// Dir has a directory for every recorded run.
+	Dir string
+	// ID of the run the commands belong to, nothing is recorded when empty.
+	ID string
+	// ExportID is the run to export.
+	ExportID string
+	// Output is the file of the exported run, <id>.tar.gz when empty.
+	Output string
+
+	now func() time.Time
+}
+
+// NewRuns is the Runs constructor.
+func NewRuns(dr *DeploymentResource) *Runs {
+	return &Runs{DeploymentResource: dr, now: time.Now}
+}
+
+// runRecord is the run.json of a recorded run.
+type runRecord struct {
+	ID       string          `json:"id"`
+	Commands []commandRecord `json:"commands"`
+}
+
+// commandRecord are the inputs of a command of a run.
+type commandRecord struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+	// Files are the deployment files, rendered to the Manifests directory of the run.
+	Files     []string `json:"files,omitempty"`
+	VarsFiles []string `json:"varsFiles,omitempty"`
+	Manifests string   `json:"manifests,omitempty"`
+	// Digest of the rendered manifests and the variables.
+	Digest      string            `json:"digest"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	ChaosSeed   int64             `json:"chaosSeed,omitempty"`
+	Version     map[string]string `json:"version"`
+	Environment environment       `json:"environment"`
+}
+
+// environment describes where a command ran.
+type environment struct {
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Hostname  string `json:"hostname"`
+	// Env are the environment variables allowed in the deployment files.
+	Env map[string]string `json:"env,omitempty"`
+	// Revisions are the git commits of the deployment files, with a +dirty suffix when they have uncommitted changes.
+	Revisions map[string]string `json:"revisions,omitempty"`
+	// Fingerprint is a digest of the other fields, except the hostname.
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (r *Runs) runDir(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid run id %q", id)
+	}
+	return filepath.Join(r.Dir, id), nil
+}
+
+// Record records the inputs of the command into the directory of the run when a run ID is set.
+// The deployment files are rendered with the variables and the values of the secret variables are redacted.
+func (r *Runs) Record(c *kingpin.ParseContext) error {
+	if r.ID == "" || c.SelectedCommand == nil || strings.HasPrefix(c.SelectedCommand.FullCommand(), "runs ") {
+		return nil
+	}
+	dir, err := r.runDir(r.ID)
+	if err != nil {
+		return err
+	}
+	record := runRecord{ID: r.ID}
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "run.json")); err == nil {
+		if err := json.Unmarshal(content, &record); err != nil {
+			return errors.Wrapf(err, "reading run %v", r.ID)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	vars := MergeDeploymentVars(r.DeploymentResource.DefaultDeploymentVars, r.DeploymentResource.FlagDeploymentVars)
+	cmd := commandRecord{
+		Command:   c.SelectedCommand.FullCommand(),
+		Time:      r.now().UTC(),
+		Files:     r.DeploymentResource.DeploymentFiles,
+		VarsFiles: r.DeploymentResource.VarsFiles,
+		DryRun:    DryRun,
+		ChaosSeed: ChaosSeed,
+		Version: map[string]string{
+			"version":   version.Version,
+			"revision":  version.Revision,
+			"branch":    version.Branch,
+			"buildDate": version.BuildDate,
+		},
+		Environment: currentEnvironment(r.DeploymentResource.DeploymentFiles),
+	}
+
+	digest := sha256.New()
+	if len(cmd.Files) > 0 {
+		cmd.Manifests = filepath.Join("manifests", fmt.Sprintf("%v-%v", len(record.Commands)+1, strings.Replace(cmd.Command, " ", "-", -1)))
+		render := &Render{DeploymentResource: r.DeploymentResource, OutputDir: filepath.Join(dir, cmd.Manifests)}
+		if err := render.Render(c); err != nil {
+			return errors.Wrapf(err, "recording the manifests of run %v", r.ID)
+		}
+		if err := redactFiles(render.OutputDir, vars, digest); err != nil {
+			return errors.Wrapf(err, "recording the manifests of run %v", r.ID)
+		}
+	}
+
+	// Later commands override the variables of the earlier ones, like the vars files.
+	recorded := redactVars(vars)
+	if _, err := os.Stat(filepath.Join(dir, "vars.yaml")); err == nil {
+		previous, err := readVarsFile(filepath.Join(dir, "vars.yaml"))
+		if err != nil {
+			return err
+		}
+		recorded = MergeDeploymentVars(previous, recorded)
+	}
+	content, err := yaml.Marshal(recorded)
+	if err != nil {
+		return err
+	}
+	digest.Write(content)
+	cmd.Digest = fmt.Sprintf("%x", digest.Sum(nil))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "vars.yaml"), content, 0644); err != nil {
+		return err
+	}
+
+	record.Commands = append(record.Commands, cmd)
+	content, err = json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "run.json"), content, 0644)
+}
+
+// redactVars returns the variables with the values of the secret variables redacted.
+func redactVars(vars map[string]string) map[string]string {
+	redactedVars := make(map[string]string, len(vars))
+	for k, v := range vars {
+		if secretVar.MatchString(k) && v != "" {
+			v = redacted
+		}
+		redactedVars[k] = v
+	}
+	return redactedVars
+}
+
+// redactFiles replaces the values of the secret variables in the rendered files
+// and adds the redacted files to the digest, in the order of their paths.
+func redactFiles(dir string, vars map[string]string, digest io.Writer) error {
+	var secrets []string
+	for k, v := range vars {
+		// Short values would redact unrelated content.
+		if secretVar.MatchString(k) && len(v) >= 4 {
+			secrets = append(secrets, v)
+		}
+	}
+	// Longer values first, in case a secret contains another one.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	return filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		for _, s := range secrets {
+			content = bytes.Replace(content, []byte(s), []byte(redacted), -1)
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(digest, "%v\n", filepath.ToSlash(rel))
+		digest.Write(content)
+		return ioutil.WriteFile(name, content, fi.Mode())
+	})
+}
+
+// currentEnvironment returns the environment of the command.
+func currentEnvironment(files []string) environment {
+	env := environment{
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Env:       map[string]string{},
+		Revisions: map[string]string{},
+	}
+	env.Hostname, _ = os.Hostname()
+	for _, kv := range os.Environ() {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		for _, pattern := range AllowedEnv {
+			if ok, _ := path.Match(pattern, name); ok {
+				env.Env[name] = value
+				break
+			}
+		}
+	}
+	env.Env = redactVars(env.Env)
+	for _, f := range files {
+		if rev := gitRevision(f); rev != "" {
+			env.Revisions[f] = rev
+		}
+	}
+
+	fingerprint := env
+	fingerprint.Hostname = ""
+	content, _ := json.Marshal(fingerprint)
+	env.Fingerprint = fmt.Sprintf("%x", sha256.Sum256(content))
+	return env
+}
+
+// gitRevision returns the commit of the repository of a file, empty when it isn't in a repository.
+func gitRevision(name string) string {
+	dir := name
+	if fi, err := os.Stat(name); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(name)
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	rev := strings.TrimSpace(string(out))
+	if status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--", filepath.Base(name)).Output(); err == nil && len(bytes.TrimSpace(status)) > 0 {
+		rev += "+dirty"
+	}
+	return rev
+}
+
+// List prints the recorded runs.
+func (r *Runs) List(*kingpin.ParseContext) error {
+	entries, err := ioutil.ReadDir(r.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "RUN\tCOMMANDS\tSTARTED\tLAST COMMAND")
+	for _, e := range entries {
+		content, err := ioutil.ReadFile(filepath.Join(r.Dir, e.Name(), "run.json"))
+		if err != nil {
+			continue
+		}
+		var record runRecord
+		if err := json.Unmarshal(content, &record); err != nil || len(record.Commands) == 0 {
+			continue
+		}
+		last := record.Commands[len(record.Commands)-1]
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", record.ID, len(record.Commands), record.Commands[0].Time.Format(time.RFC3339), last.Command)
+	}
+	return w.Flush()
+}
+
+// Export writes the recorded run as a gzipped tarball with the files of the run in a directory named after it.
+func (r *Runs) Export(*kingpin.ParseContext) error {
+	dir, err := r.runDir(r.ExportID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "run.json")); err != nil {
+		return errors.Wrapf(err, "run %v not found in %v", r.ExportID, r.Dir)
+	}
+	output := r.Output
+	if output == "" {
+		output = r.ExportID + ".tar.gz"
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := writeBundle(f, dir, r.ExportID); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "exporting run %v", r.ExportID)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Exported run %v to %v\n", r.ExportID, output)
+	return nil
+}
+
+// writeBundle writes the files of the directory to a gzipped tarball, under the prefix.
+func writeBundle(w io.Writer, dir, prefix string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
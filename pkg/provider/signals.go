@@ -0,0 +1,152 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	// Timeout of the command, the operations in progress are cancelled when it is reached. No timeout when 0.
+	Timeout time.Duration
+	// CleanupTimeout is how long the cleanup hooks can run after the command is interrupted or times out.
+	CleanupTimeout time.Duration
+)
+
+// command is the context of the command, cancelled when the command is interrupted or times out.
+var command struct {
+	mtx      sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	reason   error
+	cleanups []*cleanupHook
+}
+
+type cleanupHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func init() {
+	command.ctx, command.cancel = context.WithCancel(context.Background())
+}
+
+// Context returns the context of the long operations of the command, like the cloud API calls and the waits.
+// It is cancelled when infra receives SIGINT or SIGTERM or the Timeout is reached,
+// and replaced by the context of the cleanup while the cleanup hooks run.
+func Context() context.Context {
+	command.mtx.Lock()
+	defer command.mtx.Unlock()
+	return command.ctx
+}
+
+// Interrupted returns why the command was interrupted, nil when it wasn't.
+func Interrupted() error {
+	command.mtx.Lock()
+	defer command.mtx.Unlock()
+	return command.reason
+}
+
+// interrupt cancels the context of the command.
+func interrupt(reason error) {
+	command.mtx.Lock()
+	defer command.mtx.Unlock()
+	if command.reason != nil {
+		return
+	}
+	log.Printf("Cancelling the operations in progress: %v", reason)
+	command.reason = reason
+	command.cancel()
+}
+
+// HandleSignals starts the Timeout of the command and cancels its context on SIGINT or SIGTERM,
+// the cleanup hooks run once the command returns, see Cleanup. A second signal exits immediately.
+func HandleSignals(*kingpin.ParseContext) error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		interrupt(fmt.Errorf("received %v", s))
+		s = <-signals
+		log.Printf("Received %v again, exiting without cleaning up", s)
+		os.Exit(130)
+	}()
+	if Timeout > 0 {
+		time.AfterFunc(Timeout, func() { interrupt(fmt.Errorf("timed out after %v", Timeout)) })
+	}
+	return nil
+}
+
+// OnInterrupt registers a hook undoing an operation which is in progress, like deleting a cluster being created,
+// for Cleanup to run when the command is interrupted or times out before the operation completes.
+// The returned function unregisters the hook once the operation completed.
+func OnInterrupt(name string, fn func(ctx context.Context) error) (done func()) {
+	h := &cleanupHook{name: name, fn: fn}
+	command.mtx.Lock()
+	command.cleanups = append(command.cleanups, h)
+	command.mtx.Unlock()
+	return func() {
+		command.mtx.Lock()
+		defer command.mtx.Unlock()
+		for i, c := range command.cleanups {
+			if c == h {
+				command.cleanups = append(command.cleanups[:i], command.cleanups[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Cleanup runs the registered hooks, the last registered first, when the command was interrupted or timed out.
+// The hooks run with a new context cancelled after the CleanupTimeout.
+func Cleanup() error {
+	command.mtx.Lock()
+	if command.reason == nil || len(command.cleanups) == 0 {
+		command.mtx.Unlock()
+		return nil
+	}
+	hooks := command.cleanups
+	command.cleanups = nil
+	var ctx context.Context
+	if CleanupTimeout > 0 {
+		ctx, command.cancel = context.WithTimeout(context.Background(), CleanupTimeout)
+	} else {
+		ctx, command.cancel = context.WithCancel(context.Background())
+	}
+	command.ctx = ctx
+	command.mtx.Unlock()
+	defer command.cancel()
+
+	var failed []string
+	for i := len(hooks) - 1; i >= 0; i-- {
+		log.Printf("Cleaning up: %v", hooks[i].name)
+		if err := hooks[i].fn(ctx); err != nil {
+			log.Printf("Couldn't clean up '%v': %v", hooks[i].name, err)
+			failed = append(failed, hooks[i].name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("the cleanup of %v failed, they have to be deleted manually", failed)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterrupt(t *testing.T) {
+	ctx := Context()
+	defer func() {
+		command.ctx, command.cancel = context.WithCancel(context.Background())
+		command.reason, command.cleanups = nil, nil
+	}()
+
+	var cleaned []string
+	hook := func(name string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			if ctx.Err() != nil {
+				t.Errorf("%v: the cleanup context is cancelled", name)
+			}
+			cleaned = append(cleaned, name)
+			return nil
+		}
+	}
+	OnInterrupt("cluster", hook("cluster"))
+	done := OnInterrupt("completed nodepool", hook("completed nodepool"))
+	OnInterrupt("nodepool", hook("nodepool"))
+	done()
+
+	// Nothing is cleaned up without an interruption.
+	if err := Cleanup(); err != nil || len(cleaned) != 0 {
+		t.Fatalf("expected no cleanup, got %v, %v", cleaned, err)
+	}
+
+	// The waits stop when the command is interrupted.
+	go interrupt(errors.New("received interrupt"))
+	err := RetryUntilTrue("creating cluster:test", 1000, func() (bool, error) { return false, nil })
+	if err == nil || !strings.Contains(err.Error(), "received interrupt") {
+		t.Fatalf("expected the wait to be interrupted, got %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected the context of the command to be cancelled")
+	}
+
+	if err := Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"nodepool", "cluster"}; !reflect.DeepEqual(cleaned, expected) {
+		t.Errorf("expected the cleanups %v, got %v", expected, cleaned)
+	}
+	// The hooks run once.
+	if err := Cleanup(); err != nil || len(cleaned) != 2 {
+		t.Errorf("expected no other cleanup, got %v, %v", cleaned, err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	defer func(timeout time.Duration) {
+		Timeout = timeout
+		command.ctx, command.cancel = context.WithCancel(context.Background())
+		command.reason = nil
+	}(Timeout)
+	Timeout = 10 * time.Millisecond
+	if err := HandleSignals(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the context to be cancelled after the timeout")
+	}
+	if err := Interrupted(); err == nil || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	cryptoSSH "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// client runs commands on the hosts over ssh.
+type client struct {
+	config *cryptoSSH.ClientConfig
+	port   int
+}
+
+// newClient returns a client authenticating with the private keys
+// and, when SSH_AUTH_SOCK is set, with the keys of the ssh agent.
+func newClient(user string, port int, keys [][]byte, knownHostsFile string, insecure bool) (*client, error) {
+	var methods []cryptoSSH.AuthMethod
+	var signers []cryptoSSH.Signer
+	for _, key := range keys {
+		signer, err := cryptoSSH.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing the private key")
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, cryptoSSH.PublicKeys(signers...))
+	}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, errors.Wrap(err, "connecting to the ssh agent")
+		}
+		methods = append(methods, cryptoSSH.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no ssh keys provided set the auth flag or run an ssh agent")
+	}
+
+	hostKeyCallback := cryptoSSH.InsecureIgnoreHostKey()
+	if !insecure {
+		if knownHostsFile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		var err error
+		if hostKeyCallback, err = knownhosts.New(knownHostsFile); err != nil {
+			return nil, errors.Wrapf(err, "reading the known hosts file %v", knownHostsFile)
+		}
+	}
+
+	return &client{
+		config: &cryptoSSH.ClientConfig{
+			User:            user,
+			Auth:            methods,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         30 * time.Second,
+		},
+		port: port,
+	}, nil
+}
+
+// run executes the command on the host and returns its stdout.
+// Commands are run with sudo when not logged in as root.
+func (c *client) run(host, cmd string) ([]byte, error) {
+	conn, err := cryptoSSH.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(c.port)), c.config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connecting to %v", host)
+	}
+	defer conn.Close()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening a session on %v", host)
+	}
+	defer session.Close()
+
+	if c.config.User != "root" {
+		cmd = "sudo -n " + cmd
+	}
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		return nil, errors.Wrapf(err, "running '%v' on %v: %s", cmd, host, stderr.Bytes())
+	}
+	return stdout.Bytes(), nil
+}
+
+// readKeys returns the content of the private key files.
+func readKeys(files []string) ([][]byte, error) {
+	var keys [][]byte
+	for _, f := range files {
+		key, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading the private key %v", f)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
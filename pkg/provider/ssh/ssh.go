@@ -0,0 +1,641 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/provider"
+	k8sProvider "github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+	yamlGo "gopkg.in/yaml.v2"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type Resource = provider.Resource
+
+const (
+	adminConf   = "/etc/kubernetes/admin.conf"
+	kubeletConf = "/etc/kubernetes/kubelet.conf"
+	kubectl     = "kubectl --kubeconfig " + adminConf + " "
+)
+
+// Cluster is a kubeadm cluster with a single control plane host.
+type Cluster struct {
+	Name string `yaml:"name"`
+	// Address of the control plane host, also used to reach the API server.
+	ControlPlane string `yaml:"controlplane"`
+	// Passed to kubeadm init, defaults to the version of the installed kubeadm.
+	KubernetesVersion string `yaml:"kubernetesversion,omitempty"`
+	PodNetworkCIDR    string `yaml:"podnetworkcidr,omitempty"`
+	// URL or path on the control plane host of the CNI manifest.
+	CNI string `yaml:"cni"`
+}
+
+// NodePool is a group of hosts joined to the cluster as worker nodes with the same labels.
+type NodePool struct {
+	Name   string            `yaml:"name"`
+	Hosts  []string          `yaml:"hosts"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// sshCluster is the format of the cluster and nodepool deployment files.
+type sshCluster struct {
+	Cluster   Cluster    `yaml:"cluster"`
+	NodePools []NodePool `yaml:"nodepools"`
+}
+
+// SSH holds the fields used to bootstrap kubeadm clusters on existing hosts.
+type SSH struct {
+	// Private key files used to authenticate on the hosts.
+	Auth []string
+	// User and port for the ssh connections.
+	User string
+	Port int
+	// Known hosts file used to verify the host keys, defaults to ~/.ssh/known_hosts.
+	KnownHosts string
+	// Skip the host key verification.
+	InsecureIgnoreHostKey bool
+	// The client used to run commands on the hosts.
+	clientSSH *client
+	// The k8s provider used when we work with the manifest files.
+	k8sProvider *k8sProvider.K8s
+	// Final DeploymentFiles files.
+	DeploymentFiles []string
+	// Final DeploymentVars.
+	DeploymentVars map[string]string
+	// DeployResource to construct DeploymentVars and DeploymentFiles
+	DeploymentResource *provider.DeploymentResource
+	// Content bytes after parsing the template variables, grouped by filename.
+	sshResources []Resource
+	// K8s resource.runtime objects after parsing the template variables, grouped by filename.
+	k8sResources []k8sProvider.Resource
+	// Output format of the cluster status - table or markdown.
+	StatusFormat string
+	// Settings of the resource commands shared by the providers.
+	k8sProvider.Options
+	// How long to wait for the deleted objects to be removed.
+	DeleteTimeout time.Duration
+	// Propagation policy of the deletes - foreground, background or orphan.
+	DeletePropagation string
+	// Wait for the deleted objects to be removed.
+	DeleteWait bool
+	// Label the applied objects with this apply set so that they can be pruned.
+	ApplySet string
+	// Format of the resource diff, unified or structured.
+	DiffFormat string
+	// Logs of the pods written by the resource logs command.
+	LogOptions k8sProvider.LogOptions
+	// Namespaces to create or delete.
+	Namespaces []string
+
+	ctx context.Context
+}
+
+// New is the SSH constructor.
+func New(dr *provider.DeploymentResource) *SSH {
+	return &SSH{
+		DeploymentResource: dr,
+		ctx:                provider.Context(),
+	}
+}
+
+// NewSSHClient sets the client used to run commands on the hosts.
+func (c *SSH) NewSSHClient(*kingpin.ParseContext) error {
+	keys, err := readKeys(c.Auth)
+	if err != nil {
+		return err
+	}
+	c.clientSSH, err = newClient(c.User, c.Port, keys, c.KnownHosts, c.InsecureIgnoreHostKey)
+	return err
+}
+
+// SetupDeploymentResources Sets up DeploymentVars and DeploymentFiles
+func (c *SSH) SetupDeploymentResources(*kingpin.ParseContext) error {
+	c.DeploymentFiles = c.DeploymentResource.DeploymentFiles
+	c.DeploymentVars = provider.MergeDeploymentVars(
+		c.DeploymentResource.DefaultDeploymentVars,
+		c.DeploymentResource.FlagDeploymentVars,
+	)
+	return nil
+}
+
+// checkDeploymentVarsAndFiles checks whether the requied deployment vars are passed.
+func (c *SSH) checkDeploymentVarsAndFiles() error {
+	reqDepVars := []string{"CONTROL_PLANE"}
+	for _, k := range reqDepVars {
+		if v := c.DeploymentVars[k]; v == "" {
+			return fmt.Errorf("missing required %v variable", k)
+		}
+	}
+	if len(c.DeploymentFiles) == 0 {
+		return fmt.Errorf("missing deployment file(s)")
+	}
+	return nil
+}
+
+// SSHDeploymentsParse parses the cluster/nodepool deployment files and saves the result as bytes grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *SSH) SSHDeploymentsParse(*kingpin.ParseContext) error {
+	if err := c.checkDeploymentVarsAndFiles(); err != nil {
+		return err
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	c.sshResources = deploymentResource
+	return nil
+}
+
+// K8SDeploymentsParse parses the k8s objects deployment files and saves the result as k8s objects grouped by the filename.
+// Any variables passed to the cli will be replaced in the resources files following the golang text template format.
+func (c *SSH) K8SDeploymentsParse(*kingpin.ParseContext) error {
+	if err := c.checkDeploymentVarsAndFiles(); err != nil {
+		return err
+	}
+
+	deploymentResource, err := provider.DeploymentsParse(c.DeploymentFiles, c.DeploymentVars)
+	if err != nil {
+		return errors.Wrap(err, "couldn't parse deployment files")
+	}
+
+	for _, deployment := range deploymentResource {
+		k8sObjects, err := k8sProvider.DecodeObjects(deployment.FileName, deployment.Content)
+		if err != nil {
+			return err
+		}
+		if len(k8sObjects) > 0 {
+			c.k8sResources = append(c.k8sResources, k8sProvider.Resource{FileName: deployment.FileName, Objects: k8sObjects})
+		}
+	}
+	return nil
+}
+
+// parseCluster returns the cluster and nodepools of a deployment file.
+func parseCluster(deployment Resource) (*sshCluster, error) {
+	req := &sshCluster{}
+	if err := yamlGo.UnmarshalStrict(deployment.Content, req); err != nil {
+		return nil, errors.Wrapf(err, "parsing the cluster deployment file %s", deployment.FileName)
+	}
+	if req.Cluster.ControlPlane == "" {
+		return nil, fmt.Errorf("missing control plane address in the deployment file %s", deployment.FileName)
+	}
+	return req, nil
+}
+
+// ClusterCreate runs kubeadm init on the control plane host, installs the CNI
+// and joins the hosts of the nodepools in the deployment files.
+// Hosts that are already initialized or joined are skipped so it can be rerun after a failure.
+// The hosts must have a container runtime, kubeadm, kubelet and kubectl installed.
+func (c *SSH) ClusterCreate(*kingpin.ParseContext) error {
+	for _, deployment := range c.sshResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		cluster := req.Cluster
+		if cluster.CNI == "" {
+			return fmt.Errorf("missing cni manifest for cluster '%v', file:%v", cluster.Name, deployment.FileName)
+		}
+
+		if c.fileExists(cluster.ControlPlane, adminConf) {
+			log.Printf("Control plane '%v' already initialized", cluster.ControlPlane)
+		} else {
+			log.Printf("Cluster create request: name:'%s', control plane:'%s'", cluster.Name, cluster.ControlPlane)
+			if err := c.change(cluster.ControlPlane, kubeadmInit(cluster)); err != nil {
+				return errors.Wrapf(err, "couldn't create cluster '%v', file:%v", cluster.Name, deployment.FileName)
+			}
+		}
+
+		if err := c.change(cluster.ControlPlane, kubectl+"apply -f "+quote(cluster.CNI)); err != nil {
+			return errors.Wrapf(err, "couldn't install the cni for cluster '%v'", cluster.Name)
+		}
+
+		if err := c.nodePoolsCreate(cluster.ControlPlane, req.NodePools); err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+	}
+	return nil
+}
+
+// kubeadmInit returns the kubeadm init command for the cluster.
+// The control plane address is added to the API server certificate so that
+// it can be used to reach the API server when it is not the advertised address.
+func kubeadmInit(cluster Cluster) string {
+	cmd := "kubeadm init --apiserver-cert-extra-sans=" + quote(cluster.ControlPlane)
+	if cluster.KubernetesVersion != "" {
+		cmd += " --kubernetes-version=" + quote(cluster.KubernetesVersion)
+	}
+	if cluster.PodNetworkCIDR != "" {
+		cmd += " --pod-network-cidr=" + quote(cluster.PodNetworkCIDR)
+	}
+	return cmd
+}
+
+// ClusterDelete resets the hosts of the nodepools and the control plane host in the deployment files.
+// Hosts joined with 'nodes create' must be removed with 'nodes delete' first.
+func (c *SSH) ClusterDelete(*kingpin.ParseContext) error {
+	for _, deployment := range c.sshResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		for _, pool := range req.NodePools {
+			for _, host := range pool.Hosts {
+				if err := c.reset(host); err != nil {
+					return err
+				}
+			}
+		}
+		log.Printf("Removing cluster '%v'", req.Cluster.Name)
+		if err := c.reset(req.Cluster.ControlPlane); err != nil {
+			return errors.Wrapf(err, "couldn't delete cluster '%v'", req.Cluster.Name)
+		}
+	}
+	return nil
+}
+
+// reset reverts the changes made by kubeadm on the host.
+func (c *SSH) reset(host string) error {
+	log.Printf("Resetting host '%v'", host)
+	if err := c.change(host, "kubeadm reset -f"); err != nil {
+		return errors.Wrapf(err, "couldn't reset host '%v'", host)
+	}
+	return nil
+}
+
+// NodePoolCreate joins the hosts of the nodepools to an existing cluster.
+func (c *SSH) NodePoolCreate(*kingpin.ParseContext) error {
+	for _, deployment := range c.sshResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		if err := c.nodePoolsCreate(req.Cluster.ControlPlane, req.NodePools); err != nil {
+			return errors.Wrapf(err, "file:%v", deployment.FileName)
+		}
+	}
+	return nil
+}
+
+// nodePoolsCreate joins the hosts, waits for their nodes to become ready and sets the nodepool labels.
+func (c *SSH) nodePoolsCreate(controlPlane string, pools []NodePool) error {
+	for _, pool := range pools {
+		log.Printf("Nodepool create request: name:'%s', hosts:'%s'", pool.Name, strings.Join(pool.Hosts, ","))
+		for _, host := range pool.Hosts {
+			done := func() {}
+			if c.fileExists(host, kubeletConf) {
+				log.Printf("Host '%v' already joined", host)
+			} else if provider.DryRun {
+				if err := c.change(host, "kubeadm join with a new token of "+controlPlane); err != nil {
+					return err
+				}
+			} else {
+				// A host still joining when the command is interrupted is removed from the cluster and reset.
+				host, name := host, pool.Name
+				done = provider.OnInterrupt(fmt.Sprintf("removing the host:%v of nodepool:%v being joined", host, name), func(context.Context) error {
+					return c.removeHost(controlPlane, host, name)
+				})
+				// A new token for every host as the default token expires after 24h.
+				join, err := c.clientSSH.run(controlPlane, "kubeadm token create --print-join-command")
+				if err != nil {
+					return errors.Wrap(err, "creating the join token")
+				}
+				if _, err := c.clientSSH.run(host, strings.TrimSpace(string(join))); err != nil {
+					return errors.Wrapf(err, "couldn't join host '%v' of nodepool '%v'", host, pool.Name)
+				}
+			}
+
+			if provider.DryRun {
+				continue
+			}
+			node, err := c.nodeName(host)
+			if err != nil {
+				return err
+			}
+			err = provider.RetryUntilTrue(
+				fmt.Sprintf("creating node:%v of nodepool:%v", node, pool.Name),
+				provider.GlobalRetryCount,
+				func() (bool, error) { return c.nodeReady(controlPlane, node) },
+			)
+			if err != nil {
+				return errors.Wrap(err, "creating nodepool")
+			}
+			if err := c.nodeLabel(controlPlane, node, pool.Labels); err != nil {
+				return err
+			}
+			done()
+		}
+	}
+	return nil
+}
+
+// NodePoolDelete drains and removes the nodes of the nodepools and resets their hosts.
+func (c *SSH) NodePoolDelete(*kingpin.ParseContext) error {
+	for _, deployment := range c.sshResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		controlPlane := req.Cluster.ControlPlane
+
+		for _, pool := range req.NodePools {
+			log.Printf("Nodepool delete request: name:'%s', hosts:'%s'", pool.Name, strings.Join(pool.Hosts, ","))
+			for _, host := range pool.Hosts {
+				if err := c.removeHost(controlPlane, host, pool.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// removeHost drains and removes the node of the host and resets the host.
+func (c *SSH) removeHost(controlPlane, host, pool string) error {
+	node, err := c.nodeName(host)
+	if err != nil {
+		return err
+	}
+	deleted, err := c.nodeDeleted(controlPlane, node)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		if err := c.change(controlPlane, kubectl+"drain "+quote(node)+" --ignore-daemonsets --delete-local-data --force"); err != nil {
+			return errors.Wrapf(err, "couldn't drain node '%v' of nodepool '%v'", node, pool)
+		}
+		if err := c.change(controlPlane, kubectl+"delete node "+quote(node)); err != nil {
+			return errors.Wrapf(err, "couldn't delete node '%v' of nodepool '%v'", node, pool)
+		}
+	}
+	return c.reset(host)
+}
+
+// nodeName returns the name of the node registered by kubeadm for the host.
+func (c *SSH) nodeName(host string) (string, error) {
+	out, err := c.clientSSH.run(host, "hostname")
+	if err != nil {
+		return "", errors.Wrapf(err, "getting the hostname of '%v'", host)
+	}
+	return strings.ToLower(strings.TrimSpace(string(out))), nil
+}
+
+// nodeReady checks whether the node is registered and has a Ready condition.
+func (c *SSH) nodeReady(controlPlane, node string) (bool, error) {
+	out, err := c.clientSSH.run(controlPlane, kubectl+"get node "+quote(node)+` -o jsonpath='{.status.conditions[?(@.type=="Ready")].status}'`)
+	if err != nil {
+		if strings.Contains(err.Error(), "NotFound") {
+			log.Printf("Node '%v' not registered", node)
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "couldn't get node '%v' status", node)
+	}
+	if strings.TrimSpace(string(out)) != "True" {
+		log.Printf("Node '%v' is not ready", node)
+		return false, nil
+	}
+	return true, nil
+}
+
+// nodeDeleted checks whether the node is removed from the cluster.
+func (c *SSH) nodeDeleted(controlPlane, node string) (bool, error) {
+	_, err := c.clientSSH.run(controlPlane, kubectl+"get node "+quote(node))
+	if err == nil {
+		return false, nil
+	}
+	if strings.Contains(err.Error(), "NotFound") {
+		return true, nil
+	}
+	return false, errors.Wrapf(err, "couldn't get node '%v' status", node)
+}
+
+// nodeLabel sets the labels on the node.
+func (c *SSH) nodeLabel(controlPlane, node string, labels map[string]string) error {
+	if len(labels) == 0 {
+		return nil
+	}
+	var args []string
+	for k, v := range labels {
+		args = append(args, quote(k+"="+v))
+	}
+	sort.Strings(args)
+	if err := c.change(controlPlane, kubectl+"label node "+quote(node)+" --overwrite "+strings.Join(args, " ")); err != nil {
+		return errors.Wrapf(err, "couldn't label node '%v'", node)
+	}
+	return nil
+}
+
+// change runs a command that changes the host or the cluster.
+// In dry-run mode the command is only printed.
+func (c *SSH) change(host, cmd string) error {
+	if provider.DryRun {
+		return provider.DryRunRequest(fmt.Sprintf("ssh %v %v", host, cmd), nil)
+	}
+	if err := provider.Chaos(fmt.Sprintf("ssh %v %v", host, cmd)); err != nil {
+		return err
+	}
+	_, err := c.clientSSH.run(host, cmd)
+	return err
+}
+
+// fileExists returns true when the file exists on the host.
+func (c *SSH) fileExists(host, path string) bool {
+	_, err := c.clientSSH.run(host, "test -f "+path)
+	return err == nil
+}
+
+// AllNodePoolsRunning returns an error if at least one node of the nodepools is not ready.
+func (c *SSH) AllNodePoolsRunning(*kingpin.ParseContext) error {
+	return c.checkNodePools(c.nodeReady, "not running")
+}
+
+// AllNodePoolsDeleted returns an error if at least one node of the nodepools is not deleted.
+func (c *SSH) AllNodePoolsDeleted(*kingpin.ParseContext) error {
+	return c.checkNodePools(c.nodeDeleted, "not deleted")
+}
+
+func (c *SSH) checkNodePools(check func(controlPlane, node string) (bool, error), msg string) error {
+	for _, deployment := range c.sshResources {
+		req, err := parseCluster(deployment)
+		if err != nil {
+			return err
+		}
+		for _, pool := range req.NodePools {
+			for _, host := range pool.Hosts {
+				node, err := c.nodeName(host)
+				if err != nil {
+					return err
+				}
+				ok, err := check(req.Cluster.ControlPlane, node)
+				if err != nil {
+					return errors.Wrap(err, "error fetching nodepool info")
+				}
+				if !ok {
+					return fmt.Errorf("nodepool %v name: %v, node: %v", msg, pool.Name, node)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ClusterStatus prints the state of the cluster and, when it is running,
+// the node readiness, the pending pods and the versions of the deployed components.
+func (c *SSH) ClusterStatus(*kingpin.ParseContext) error {
+	controlPlane := c.DeploymentVars["CONTROL_PLANE"]
+	s := &k8sProvider.ClusterStatus{Name: c.DeploymentVars["CLUSTER_NAME"], State: "running"}
+	if s.Name == "" {
+		s.Name = controlPlane
+	}
+	if !c.fileExists(controlPlane, adminConf) {
+		s.State = "NOT_FOUND"
+	}
+
+	if s.State == "running" {
+		if err := c.NewK8sProvider(nil); err != nil {
+			return err
+		}
+		if err := c.k8sProvider.Status(s); err != nil {
+			return err
+		}
+	}
+	return s.Write(os.Stdout, c.StatusFormat)
+}
+
+// NewK8sProvider sets the k8s provider used for deploying k8s manifests.
+// The kubeconfig is the admin kubeconfig of the control plane host.
+func (c *SSH) NewK8sProvider(*kingpin.ParseContext) error {
+	controlPlane := c.DeploymentVars["CONTROL_PLANE"]
+	kubeconfig, err := c.clientSSH.run(controlPlane, "cat "+adminConf)
+	if err != nil {
+		return errors.Wrap(err, "failed to get cluster details")
+	}
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return errors.Wrap(err, "parsing the cluster kubeconfig")
+	}
+	// The advertised address might not be reachable from outside,
+	// use the control plane address which is in the API server certificate.
+	for _, cluster := range config.Clusters {
+		cluster.Server = "https://" + net.JoinHostPort(controlPlane, "6443")
+	}
+
+	c.k8sProvider, err = k8sProvider.New(c.ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "k8s provider error")
+	}
+	return nil
+}
+
+// ResourceApply calls k8s.ResourceApply to apply the k8s objects in the manifest files.
+func (c *SSH) ResourceApply(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	if err := c.k8sProvider.ResourceApply(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while applying a resource")
+	}
+	return nil
+}
+
+// ResourceDiff calls k8s.ResourceDiff to print the changes the apply of the k8s objects in the manifest files would make.
+func (c *SSH) ResourceDiff(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.ApplyVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.ApplySet = c.ApplySet
+	c.k8sProvider.DiffFormat = c.DiffFormat
+	if err := c.k8sProvider.ResourceDiff(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while diffing the resources")
+	}
+	return nil
+}
+
+// ResourceLogs calls k8s.ResourceLogs to stream the logs of the pods in the namespaces of the manifest files.
+func (c *SSH) ResourceLogs(*kingpin.ParseContext) error {
+	c.k8sProvider.LogOptions = c.LogOptions
+	if err := c.k8sProvider.ResourceLogs(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while streaming the logs")
+	}
+	return nil
+}
+
+// ResourceDelete calls k8s.ResourceDelete to apply the k8s objects in the manifest files.
+func (c *SSH) ResourceDelete(*kingpin.ParseContext) error {
+	if c.CheckPermissions {
+		if err := c.k8sProvider.PermissionsCheck(c.k8sResources, k8sProvider.DeleteVerbs); err != nil {
+			return err
+		}
+	}
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	c.k8sProvider.DeletePropagation = c.DeletePropagation
+	c.k8sProvider.DeleteWait = c.DeleteWait
+	if err := c.k8sProvider.ResourceDelete(c.k8sResources); err != nil {
+		return errors.Wrap(err, "error while deleting objects from a manifest file")
+	}
+	return nil
+}
+
+// NamespaceCreate calls k8s.NamespaceCreate to create the namespaces which don't exist.
+func (c *SSH) NamespaceCreate(*kingpin.ParseContext) error {
+	if err := c.k8sProvider.NamespaceCreate(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while creating namespaces")
+	}
+	return nil
+}
+
+// NamespaceDelete calls k8s.NamespaceDelete to delete the namespaces and wait until they are gone.
+func (c *SSH) NamespaceDelete(*kingpin.ParseContext) error {
+	c.k8sProvider.Options = c.Options
+	c.k8sProvider.DeleteTimeout = c.DeleteTimeout
+	if err := c.k8sProvider.NamespaceDelete(c.Namespaces); err != nil {
+		return errors.Wrap(err, "error while deleting namespaces")
+	}
+	return nil
+}
+
+// GetDeploymentVars shows deployment variables.
+func (c *SSH) GetDeploymentVars(*kingpin.ParseContext) error {
+	fmt.Print("-------------------\n   DeploymentVars   \n------------------- \n")
+	for key, value := range c.DeploymentVars {
+		fmt.Println(key, " : ", value)
+	}
+
+	return nil
+}
+
+// quote returns the string single quoted for the remote shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,336 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/store"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"sigs.k8s.io/yaml"
+)
+
+// State records the infrastructure created by the commands of a run - the clusters, the nodepools
+// and the applied objects - so that destroy can delete it even when the deployment files are gone.
+type State struct {
+	// Runs has the ID of the run, nothing is recorded when empty.
+	Runs *Runs
+	// URL of the state files, a local directory, gs://bucket/prefix or s3://bucket/prefix.
+	URL string
+	// Auth are the values of the auth flags of the providers, used by Destroy.
+	Auth map[string]string
+}
+
+// NewState is the State constructor.
+func NewState(runs *Runs) *State {
+	return &State{Runs: runs, Auth: map[string]string{}}
+}
+
+// stateCommands are the commands of the providers creating infrastructure
+// with the kind of infrastructure they create and the command deleting it.
+var stateCommands = map[string]struct{ kind, delete string }{
+	"cluster create": {"cluster", "cluster delete"},
+	"nodes create":   {"nodepools", "nodes delete"},
+	"resource apply": {"resources", "resource delete"},
+}
+
+// stateProviders are the providers whose commands are recorded.
+var stateProviders = map[string]bool{"gke": true, "kind": true, "eks": true, "doks": true, "magnum": true, "ssh": true, "plugin": true}
+
+// runState is the state file of a run.
+type runState struct {
+	RunID   string       `json:"runId"`
+	Entries []stateEntry `json:"entries"`
+}
+
+// stateEntry is the infrastructure created by a command.
+type stateEntry struct {
+	Provider string    `json:"provider"`
+	Kind     string    `json:"kind"`
+	Command  string    `json:"command"`
+	Time     time.Time `json:"time"`
+	// ProviderPlugin is the binary of the plugin provider.
+	ProviderPlugin string `json:"providerPlugin,omitempty"`
+	// Vars are the variables of the command, without the secret ones.
+	Vars map[string]string `json:"vars,omitempty"`
+	// Files are the rendered cluster and nodes files, or only the kinds and names of the applied objects.
+	Files []stateFile `json:"files"`
+}
+
+type stateFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Record records the infrastructure the command creates in the state of the run when a run ID is set,
+// before the command runs so that a failed command can be destroyed too.
+// The values of the secret variables aren't recorded, the applied objects are recorded by kind and name only.
+func (s *State) Record(c *kingpin.ParseContext) error {
+	if s.Runs.ID == "" || DryRun || c.SelectedCommand == nil {
+		return nil
+	}
+	fields := strings.SplitN(c.SelectedCommand.FullCommand(), " ", 2)
+	if len(fields) != 2 || !stateProviders[fields[0]] {
+		return nil
+	}
+	cmd, ok := stateCommands[fields[1]]
+	if !ok {
+		return nil
+	}
+
+	dr := s.Runs.DeploymentResource
+	vars := MergeDeploymentVars(dr.DefaultDeploymentVars, dr.FlagDeploymentVars)
+	deployments, err := DeploymentsParse(dr.DeploymentFiles, vars)
+	if err != nil {
+		return errors.Wrapf(err, "recording the state of run %v", s.Runs.ID)
+	}
+	entry := stateEntry{
+		Provider: fields[0],
+		Kind:     cmd.kind,
+		Command:  c.SelectedCommand.FullCommand(),
+		Time:     time.Now().UTC(),
+		Vars:     map[string]string{},
+	}
+	for k, v := range vars {
+		if !secretVar.MatchString(k) {
+			entry.Vars[k] = v
+		}
+	}
+	if entry.Provider == "plugin" {
+		entry.ProviderPlugin = flagValue(c, "provider-plugin")
+	}
+	for _, d := range deployments {
+		content := d.Content
+		if cmd.kind == "resources" {
+			if content, err = objectRefs(d.Content); err != nil {
+				return errors.Wrapf(err, "recording the objects of %v", d.FileName)
+			}
+		}
+		entry.Files = append(entry.Files, stateFile{Name: d.FileName, Content: string(content)})
+	}
+
+	files, err := store.New(Context(), s.URL, "")
+	if err != nil {
+		return err
+	}
+	st, err := readState(files, s.Runs.ID)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		st = &runState{RunID: s.Runs.ID}
+	}
+	// A command run again replaces its entry so the infrastructure is destroyed once.
+	for i, e := range st.Entries {
+		if e.Provider == entry.Provider && e.Kind == entry.Kind && reflect.DeepEqual(e.Files, entry.Files) {
+			st.Entries = append(st.Entries[:i], st.Entries[i+1:]...)
+			break
+		}
+	}
+	st.Entries = append(st.Entries, entry)
+	return writeState(files, st)
+}
+
+// flagValue returns the value of a flag set on the command line.
+func flagValue(c *kingpin.ParseContext, name string) string {
+	for _, el := range c.Elements {
+		if f, ok := el.Clause.(*kingpin.FlagClause); ok && f.Model().Name == name && el.Value != nil {
+			return *el.Value
+		}
+	}
+	return ""
+}
+
+// objectRefs returns the apiVersion, kind, name and namespace of the objects of the documents,
+// enough to delete them without recording their content.
+// The SecretSource documents are Secrets once applied.
+func objectRefs(content []byte) ([]byte, error) {
+	var refs []map[string]interface{}
+	var add func(obj map[string]interface{})
+	add = func(obj map[string]interface{}) {
+		if items, ok := obj["items"].([]interface{}); ok && obj["kind"] == "List" {
+			for _, item := range items {
+				if o, ok := item.(map[string]interface{}); ok {
+					add(o)
+				}
+			}
+			return
+		}
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		if obj["apiVersion"] == nil || obj["kind"] == nil || metadata["name"] == nil {
+			return
+		}
+		ref := map[string]interface{}{"apiVersion": obj["apiVersion"], "kind": obj["kind"]}
+		if ref["kind"] == "SecretSource" {
+			ref["apiVersion"], ref["kind"] = "v1", "Secret"
+		}
+		m := map[string]interface{}{"name": metadata["name"]}
+		if ns, ok := metadata["namespace"]; ok {
+			m["namespace"] = ns
+		}
+		ref["metadata"] = m
+		refs = append(refs, ref)
+	}
+	for _, doc := range splitYAMLDocuments(content) {
+		var v interface{}
+		if err := yaml.Unmarshal(doc, &v); err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			add(v)
+		case []interface{}:
+			// A json file with an array of objects.
+			for _, item := range v {
+				if o, ok := item.(map[string]interface{}); ok {
+					add(o)
+				}
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	for i, ref := range refs {
+		if i > 0 {
+			out.WriteString(Separator + "\n")
+		}
+		b, err := yaml.Marshal(ref)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(b)
+	}
+	return out.Bytes(), nil
+}
+
+// Destroy deletes the infrastructure recorded in the state of the run, in the reverse order it was created:
+// the objects, then the nodepools and the clusters, with the delete commands of the providers.
+// The state of the run is removed once everything is deleted, after a failure it keeps what is left to destroy.
+func (s *State) Destroy(*kingpin.ParseContext) error {
+	if s.Runs.ID == "" {
+		return errors.New("missing the --run-id of the run to destroy")
+	}
+	files, err := store.New(Context(), s.URL, "")
+	if err != nil {
+		return err
+	}
+	st, err := readState(files, s.Runs.ID)
+	if err != nil {
+		return err
+	}
+	if st == nil || len(st.Entries) == 0 {
+		return fmt.Errorf("nothing recorded for run %v in %v", s.Runs.ID, s.URL)
+	}
+	dir, err := ioutil.TempDir("", "infra-destroy")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	for i := len(st.Entries) - 1; i >= 0; i-- {
+		e := st.Entries[i]
+		log.Printf("Destroying the %v created by '%v' at %v", e.Kind, e.Command, e.Time.Format(time.RFC3339))
+		args, err := e.destroyArgs(filepath.Join(dir, fmt.Sprint(i)), s.Auth[e.Provider], s.Runs.DeploymentResource.FlagDeploymentVars)
+		if err == nil {
+			err = runInfra(args)
+		}
+		if err != nil {
+			if !DryRun {
+				// Keep what is left to destroy for the next attempt.
+				st.Entries = st.Entries[:i+1]
+				if err := writeState(files, st); err != nil {
+					log.Printf("Couldn't update the state of run %v: %v", s.Runs.ID, err)
+				}
+			}
+			return errors.Wrapf(err, "destroying the %v created by '%v'", e.Kind, e.Command)
+		}
+	}
+	if DryRun {
+		return nil
+	}
+	log.Printf("Everything created by run %v is destroyed", s.Runs.ID)
+	return files.Remove(s.Runs.ID + ".json")
+}
+
+// destroyArgs writes the files of the entry to dir and returns the arguments of the command deleting them.
+// The variables override the recorded ones, to set the secret variables that aren't recorded.
+func (e stateEntry) destroyArgs(dir, auth string, vars map[string]string) ([]string, error) {
+	var cmd string
+	for _, c := range stateCommands {
+		if c.kind == e.Kind {
+			cmd = c.delete
+		}
+	}
+	if cmd == "" || !stateProviders[e.Provider] {
+		return nil, fmt.Errorf("unknown %v of provider %v", e.Kind, e.Provider)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if DryRun {
+		args = append(args, "--dry-run")
+	}
+	if e.ProviderPlugin != "" {
+		args = append(args, "--provider-plugin", e.ProviderPlugin)
+	}
+	args = append(args, e.Provider)
+	args = append(args, strings.Fields(cmd)...)
+	if auth != "" {
+		args = append(args, "-a", auth)
+	}
+	for i, f := range e.Files {
+		// The files are rendered already, the noparse suffix skips the templates.
+		name := filepath.Join(dir, fmt.Sprintf("%v-%v-noparse.yaml", i, strings.TrimSuffix(filepath.Base(f.Name), filepath.Ext(f.Name))))
+		if err := ioutil.WriteFile(name, []byte(f.Content), 0600); err != nil {
+			return nil, err
+		}
+		args = append(args, "-f", name)
+	}
+	for k, v := range MergeDeploymentVars(e.Vars, vars) {
+		args = append(args, "-v", k+":"+v)
+	}
+	return args, nil
+}
+
+func readState(files store.Store, id string) (*runState, error) {
+	content, err := files.Read(id + ".json")
+	if err != nil || content == nil {
+		return nil, errors.Wrapf(err, "reading the state of run %v", id)
+	}
+	st := &runState{}
+	if err := json.Unmarshal(content, st); err != nil {
+		return nil, errors.Wrapf(err, "parsing the state of run %v", id)
+	}
+	return st, nil
+}
+
+func writeState(files store.Store, st *runState) error {
+	content, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(files.Write(st.RunID+".json", content), "writing the state of run %v", st.RunID)
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/test-infra/pkg/store"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestStateRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cluster := filepath.Join(dir, "cluster.yaml")
+	if err := ioutil.WriteFile(cluster, []byte("cluster:\n  name: {{ .CLUSTER_NAME }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifests := filepath.Join(dir, "manifests.yaml")
+	if err := ioutil.WriteFile(manifests, []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: prombench-{{ .PR_NUMBER }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: oauth-token
+  namespace: prombench-{{ .PR_NUMBER }}
+data:
+  oauth: {{ .OAUTH_TOKEN }}
+---
+apiVersion: infra.prometheus.io/v1
+kind: SecretSource
+metadata:
+  name: webhook
+data:
+  secret: {env: WH_SECRET}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := kingpin.New("test", "")
+	gke := app.Command("gke", "")
+	gke.Command("cluster", "").Command("create", "")
+	gke.Command("resource", "").Command("apply", "")
+	app.Command("render", "")
+	dr := &DeploymentResource{FlagDeploymentVars: map[string]string{"CLUSTER_NAME": "test", "PR_NUMBER": "1", "OAUTH_TOKEN": "s3cr3t"}}
+	s := NewState(&Runs{DeploymentResource: dr, ID: "pr-1"})
+	s.URL = filepath.Join(dir, "state")
+	for _, tc := range []struct {
+		args  []string
+		files []string
+	}{
+		{[]string{"gke", "cluster", "create"}, []string{cluster}},
+		{[]string{"render"}, []string{cluster}},
+		{[]string{"gke", "resource", "apply"}, []string{manifests}},
+		// Recording the same command again replaces its entry.
+		{[]string{"gke", "cluster", "create"}, []string{cluster}},
+	} {
+		c, err := app.ParseContext(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dr.DeploymentFiles = tc.files
+		if err := s.Record(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := readState(store.Dir(s.URL), "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Entries) != 2 || st.Entries[0].Kind != "resources" || st.Entries[1].Kind != "cluster" {
+		t.Fatalf("expected the resources and the cluster to be recorded, got %+v", st.Entries)
+	}
+	if c := st.Entries[1].Files[0].Content; c != "cluster:\n  name: test\n" {
+		t.Errorf("expected the rendered cluster file, got %q", c)
+	}
+	objects := st.Entries[0].Files[0].Content
+	if strings.Contains(objects, "s3cr3t") || st.Entries[0].Vars["OAUTH_TOKEN"] != "" {
+		t.Errorf("the secret is recorded:\n%v\n%v", objects, st.Entries[0].Vars)
+	}
+	expected := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: prombench-1
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: oauth-token
+  namespace: prombench-1
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: webhook
+`
+	if objects != expected {
+		t.Errorf("expected the objects:\n%v\ngot:\n%v", expected, objects)
+	}
+
+	args, err := st.Entries[0].destroyArgs(filepath.Join(dir, "destroy"), "service-account.json", map[string]string{"OAUTH_TOKEN": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := strings.Join(args, " ")
+	for _, arg := range []string{"gke resource delete -a service-account.json -f ", "-noparse.yaml", "-v PR_NUMBER:1", "-v OAUTH_TOKEN:x"} {
+		if !strings.Contains(cmd, arg) {
+			t.Errorf("expected %q in the destroy command %q", arg, cmd)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v2"
+)
+
+// sprigFuncs are the commonly used functions of the sprig library (https://masterminds.github.io/sprig/),
+// with the same names and arguments so that the deployment files read like helm charts.
+var sprigFuncs = template.FuncMap{
+	"default": func(d interface{}, given ...interface{}) interface{} {
+		if len(given) == 0 || empty(given[0]) {
+			return d
+		}
+		return given[0]
+	},
+	"empty": empty,
+	"coalesce": func(v ...interface{}) interface{} {
+		for _, val := range v {
+			if !empty(val) {
+				return val
+			}
+		}
+		return nil
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if empty(v) {
+			return nil, fmt.Errorf("%s", msg)
+		}
+		return v, nil
+	},
+	"ternary": func(vt, vf interface{}, v bool) interface{} {
+		if v {
+			return vt
+		}
+		return vf
+	},
+
+	"trim":       strings.TrimSpace,
+	"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+	"quote": func(v ...interface{}) string {
+		q := make([]string, 0, len(v))
+		for _, s := range v {
+			if s != nil {
+				q = append(q, fmt.Sprintf("%q", fmt.Sprint(s)))
+			}
+		}
+		return strings.Join(q, " ")
+	},
+	"squote": func(v ...interface{}) string {
+		q := make([]string, 0, len(v))
+		for _, s := range v {
+			if s != nil {
+				q = append(q, "'"+fmt.Sprint(s)+"'")
+			}
+		}
+		return strings.Join(q, " ")
+	},
+	"indent": indent,
+	"nindent": func(spaces int, s string) string {
+		return "\n" + indent(spaces, s)
+	},
+
+	"list": func(v ...interface{}) []interface{} { return v },
+	"join": func(sep string, v interface{}) string {
+		var s []string
+		val := reflect.ValueOf(v)
+		switch val.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < val.Len(); i++ {
+				s = append(s, fmt.Sprint(val.Index(i).Interface()))
+			}
+		default:
+			if v != nil {
+				s = append(s, fmt.Sprint(v))
+			}
+		}
+		return strings.Join(s, sep)
+	},
+	"splitList": func(sep, s string) []string { return strings.Split(s, sep) },
+	"toString":  func(v interface{}) string { return fmt.Sprint(v) },
+
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"b64dec": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", fmt.Errorf("b64dec: %v", err)
+		}
+		return string(b), nil
+	},
+	"toYaml": func(v interface{}) (string, error) {
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("toYaml: %v", err)
+		}
+		return strings.TrimSuffix(string(b), "\n"), nil
+	},
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("toJson: %v", err)
+		}
+		return string(b), nil
+	},
+}
+
+// empty reports whether the value is missing or the zero value of its type.
+func empty(v interface{}) bool {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		return true
+	}
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return val.IsNil()
+	}
+	return reflect.DeepEqual(v, reflect.Zero(val.Type()).Interface())
+}
+
+// indent adds the spaces to the start of every line.
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// guardFuncs are the functions which handle a missing variable passed to them.
+var guardFuncs = map[string]bool{
+	"default":  true,
+	"empty":    true,
+	"coalesce": true,
+	"required": true,
+}
+
+// missingVars returns the sorted names of the variables used by the template which aren't in vars.
+// A variable only used in if conditions or passed to the guardFuncs is optional, the others are undefined.
+func missingVars(tree *parse.Tree, vars map[string]string) (undefined, optional []string) {
+	missing := map[string]bool{}
+	check := func(name string, guarded bool) {
+		if _, ok := vars[name]; !ok {
+			missing[name] = missing[name] || !guarded
+		}
+	}
+
+	// root is false within range and with, where the dot is no longer the variables.
+	var walkPipe func(p *parse.PipeNode, root, guarded bool)
+	var walk func(n parse.Node, root bool)
+	walkArg := func(arg parse.Node, root, guarded bool) {
+		switch a := arg.(type) {
+		case *parse.FieldNode:
+			if root {
+				check(a.Ident[0], guarded)
+			}
+		case *parse.VariableNode:
+			// $ is always the variables.
+			if a.Ident[0] == "$" && len(a.Ident) > 1 {
+				check(a.Ident[1], guarded)
+			}
+		case *parse.PipeNode:
+			walkPipe(a, root, guarded)
+		}
+	}
+	walkPipe = func(p *parse.PipeNode, root, guarded bool) {
+		if p == nil {
+			return
+		}
+		for i, cmd := range p.Cmds {
+			g := guarded
+			// The result of the command is passed to the next one when it is a function.
+			if i+1 < len(p.Cmds) {
+				if id, ok := p.Cmds[i+1].Args[0].(*parse.IdentifierNode); ok && guardFuncs[id.Ident] {
+					g = true
+				}
+			}
+			if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok {
+				if guardFuncs[id.Ident] {
+					g = true
+				}
+				// index . "NAME" reads the variable NAME.
+				if id.Ident == "index" && len(cmd.Args) == 3 {
+					_, dot := cmd.Args[1].(*parse.DotNode)
+					if s, ok := cmd.Args[2].(*parse.StringNode); ok && dot && root {
+						check(s.Text, g)
+					}
+				}
+			}
+			for _, arg := range cmd.Args {
+				walkArg(arg, root, g)
+			}
+		}
+	}
+	walkBranch := func(b *parse.BranchNode, root, guarded, rebind bool) {
+		walkPipe(b.Pipe, root, guarded)
+		walk(b.List, root && !rebind)
+		if b.ElseList != nil {
+			walk(b.ElseList, root)
+		}
+	}
+	walk = func(n parse.Node, root bool) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c, root)
+			}
+		case *parse.ActionNode:
+			walkPipe(n.Pipe, root, false)
+		case *parse.IfNode:
+			walkBranch(&n.BranchNode, root, true, false)
+		case *parse.RangeNode:
+			walkBranch(&n.BranchNode, root, false, true)
+		case *parse.WithNode:
+			walkBranch(&n.BranchNode, root, true, true)
+		case *parse.TemplateNode:
+			walkPipe(n.Pipe, root, false)
+		}
+	}
+	walk(tree.Root, true)
+
+	for name, isUndefined := range missing {
+		if isUndefined {
+			undefined = append(undefined, name)
+		} else {
+			optional = append(optional, name)
+		}
+	}
+	sort.Strings(undefined)
+	sort.Strings(optional)
+	return undefined, optional
+}
+
+// undefinedVarsError lists the variables used by a file which aren't set.
+type undefinedVarsError struct {
+	vars []string
+}
+
+func (e *undefinedVarsError) Error() string {
+	return fmt.Sprintf("undefined variables: %s", strings.Join(e.vars, ", "))
+}
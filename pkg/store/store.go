@@ -0,0 +1,216 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store reads and writes files in a local directory or under a prefix of a GCS or S3 bucket,
+// so that the tools share the same URLs and credentials for their buckets.
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsSession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2/google"
+)
+
+// Store reads and writes the files of a store, the names are slash separated.
+type Store interface {
+	// Read returns nil when the file doesn't exist.
+	Read(name string) ([]byte, error)
+	Write(name string, content []byte) error
+	Remove(name string) error
+}
+
+// New returns the store of the url: a local directory, file://dir, gs://bucket/prefix or s3://bucket/prefix.
+// GCS buckets are accessed with their JSON API and the Google application default credentials,
+// S3 buckets with the credentials and region of the AWS environment.
+// The endpoint, when set, replaces the endpoint of the API of the bucket, eg. of a MinIO server for S3.
+func New(ctx context.Context, rawURL, endpoint string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		dir := rawURL
+		if err == nil && u.Scheme == "file" {
+			dir = u.Path
+		}
+		return Dir(dir), nil
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	switch u.Scheme {
+	case "gs":
+		if endpoint == "" {
+			endpoint = gcsEndpoint
+		}
+		client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/devstorage.read_write")
+		if err != nil {
+			return nil, errors.Wrap(err, "GCS credentials")
+		}
+		return &gcsStore{ctx: ctx, client: client, endpoint: endpoint, bucket: u.Host, prefix: prefix}, nil
+	case "s3":
+		config := aws.NewConfig()
+		if endpoint != "" {
+			config = config.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+		}
+		sess, err := awsSession.NewSessionWithOptions(awsSession.Options{Config: *config, SharedConfigState: awsSession.SharedConfigEnable})
+		if err != nil {
+			return nil, errors.Wrap(err, "S3 credentials")
+		}
+		return &s3Store{ctx: ctx, client: s3.New(sess), bucket: u.Host, prefix: prefix}, nil
+	}
+	return nil, errors.Errorf("unsupported store %q, expected gs://, s3:// or a directory", rawURL)
+}
+
+// Dir is a local directory, like a mounted volume.
+type Dir string
+
+func (d Dir) file(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// Read implements Store.
+func (d Dir) Read(name string) ([]byte, error) {
+	content, err := ioutil.ReadFile(d.file(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
+
+// Write implements Store.
+func (d Dir) Write(name string, content []byte) error {
+	fn := d.file(name)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, content, 0644)
+}
+
+// Remove implements Store.
+func (d Dir) Remove(name string) error {
+	return os.Remove(d.file(name))
+}
+
+// gcsEndpoint is the endpoint of the GCS json API.
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// gcsStore is a prefix of a GCS bucket.
+type gcsStore struct {
+	ctx      context.Context
+	client   *http.Client
+	endpoint string
+	bucket   string
+	prefix   string
+}
+
+func (g *gcsStore) object(name string) string {
+	return path.Join(g.prefix, name)
+}
+
+func (g *gcsStore) do(method, u string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	ctx, cancel := context.WithTimeout(g.ctx, time.Minute)
+	defer cancel()
+	resp, err := g.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return nil, resp.StatusCode, fmt.Errorf("%v gs://%v: %v: %s", method, path.Join(g.bucket, g.prefix), resp.Status, bytes.TrimSpace(content))
+	}
+	return content, resp.StatusCode, nil
+}
+
+func (g *gcsStore) Read(name string) ([]byte, error) {
+	content, status, err := g.do(http.MethodGet, fmt.Sprintf("%v/storage/v1/b/%v/o/%v?alt=media", g.endpoint, g.bucket, url.PathEscape(g.object(name))), nil)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	return content, err
+}
+
+func (g *gcsStore) Write(name string, content []byte) error {
+	_, status, err := g.do(http.MethodPost, fmt.Sprintf("%v/upload/storage/v1/b/%v/o?uploadType=media&name=%v", g.endpoint, g.bucket, url.QueryEscape(g.object(name))), content)
+	if err == nil && status == http.StatusNotFound {
+		err = fmt.Errorf("bucket %v not found", g.bucket)
+	}
+	return err
+}
+
+func (g *gcsStore) Remove(name string) error {
+	_, _, err := g.do(http.MethodDelete, fmt.Sprintf("%v/storage/v1/b/%v/o/%v", g.endpoint, g.bucket, url.PathEscape(g.object(name))), nil)
+	return err
+}
+
+// s3Store is a prefix of an S3 bucket.
+type s3Store struct {
+	ctx    context.Context
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func (s *s3Store) Read(name string) ([]byte, error) {
+	out, err := s.client.GetObjectWithContext(s.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, name)),
+	})
+	if aErr, ok := err.(awserr.Error); ok && aErr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+func (s *s3Store) Write(name string, content []byte) error {
+	_, err := s.client.PutObjectWithContext(s.ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, name)),
+		Body:   bytes.NewReader(content),
+	})
+	return err
+}
+
+func (s *s3Store) Remove(name string) error {
+	_, err := s.client.DeleteObjectWithContext(s.ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, name)),
+	})
+	return err
+}
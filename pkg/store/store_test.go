@@ -0,0 +1,104 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := New(context.Background(), "ftp://results", ""); err == nil {
+		t.Error("expected an error with an unsupported store")
+	}
+	for _, u := range []string{filepath.Join(dir, "store"), "file://" + filepath.Join(dir, "store")} {
+		d, err := New(context.Background(), u, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content, err := d.Read("a/b.out"); err != nil || content != nil {
+			t.Fatalf("expected no file, got %q, %v", content, err)
+		}
+		if err := d.Write("a/b.out", []byte("results")); err != nil {
+			t.Fatal(err)
+		}
+		if content, err := d.Read("a/b.out"); err != nil || string(content) != "results" {
+			t.Fatalf("expected the file, got %q, %v", content, err)
+		}
+		if err := d.Remove("a/b.out"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGCSStore(t *testing.T) {
+	var (
+		mtx     sync.Mutex
+		objects = map[string][]byte{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+			content, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Query().Get("name")] = content
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+			content, ok := objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(content)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+			delete(objects, strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	g := &gcsStore{ctx: context.Background(), client: http.DefaultClient, endpoint: srv.URL, bucket: "bucket", prefix: "infra/state"}
+	if content, err := g.Read("pr-1.json"); err != nil || content != nil {
+		t.Fatalf("expected no state, got %q, %v", content, err)
+	}
+	if err := g.Write("pr-1.json", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects["infra/state/pr-1.json"]; !ok {
+		t.Fatalf("expected the object under the prefix, got %v", objects)
+	}
+	if content, err := g.Read("pr-1.json"); err != nil || string(content) != "{}" {
+		t.Fatalf("expected the state, got %q, %v", content, err)
+	}
+	if err := g.Remove("pr-1.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("expected the state to be removed, got %v", objects)
+	}
+}
@@ -10,7 +10,7 @@ SED_BIN=${SED_BIN:-sed}
 README_FILES="./tools/*/README.md ./funcbench/README.md ./infra/README.md"
 
 primary_tools=("infra" "funcbench")
-helper_tools=("amGithubNotifier" "commentMonitor")
+helper_tools=("amGithubNotifier" "benchTrend" "commentMonitor" "logStreamer" "runnerPool" "sloChecker")
 
 function fetch_embedmd {
   pushd ..; go get github.com/campoy/embedmd; popd
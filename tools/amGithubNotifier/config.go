@@ -0,0 +1,220 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// notifierConfig routes the alerts to the receivers with the template of their event.
+type notifierConfig struct {
+	Receivers []receiverConfig `yaml:"receivers"`
+	Routes    []*routeConfig   `yaml:"routes"`
+}
+
+// receiverConfig is where the notifications are sent, exactly one of its types must be set.
+type receiverConfig struct {
+	Name    string         `yaml:"name"`
+	GitHub  *githubConfig  `yaml:"github"`
+	Webhook *webhookConfig `yaml:"webhook"`
+	Slack   *slackConfig   `yaml:"slack"`
+}
+
+// githubConfig comments on the pull request of the prNum label of the alerts.
+type githubConfig struct{}
+
+// webhookConfig posts the notifications as json, for example to page the on-call.
+type webhookConfig struct {
+	URL string `yaml:"url"`
+	// URLFile is read instead of the URL to keep the secret URLs out of the config.
+	URLFile string `yaml:"url_file"`
+}
+
+// slackConfig posts the notifications to a Slack incoming webhook.
+type slackConfig struct {
+	URL     string `yaml:"url"`
+	URLFile string `yaml:"url_file"`
+	// Channel overrides the channel of the incoming webhook.
+	Channel string `yaml:"channel"`
+}
+
+// routeConfig sends the alerts of an event to its receivers.
+type routeConfig struct {
+	// Match are the labels of the alerts of the route, like the event or the severity.
+	Match map[string]string `yaml:"match"`
+	// Status is firing or resolved, it matches both when empty.
+	Status    string   `yaml:"status"`
+	Receivers []string `yaml:"receivers"`
+	// Template of the notifications, the description annotation of the alert when empty.
+	Template string `yaml:"template"`
+	// Continue matching the next routes after this one, otherwise the alert stops at the first matching route.
+	Continue bool `yaml:"continue"`
+
+	tmpl *textTemplate.Template
+}
+
+// defaultConfig comments the description of all alerts on GitHub.
+func defaultConfig() *notifierConfig {
+	return &notifierConfig{
+		Receivers: []receiverConfig{{Name: "github", GitHub: &githubConfig{}}},
+		Routes:    []*routeConfig{{Receivers: []string{"github"}}},
+	}
+}
+
+func loadConfig(path string) (*notifierConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &notifierConfig{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal config: %v", err)
+	}
+	if err := cfg.init(); err != nil {
+		return nil, fmt.Errorf("invalid config %v: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// init validates the config, reads the URL files and parses the templates.
+func (c *notifierConfig) init() error {
+	names := map[string]bool{}
+	for i := range c.Receivers {
+		r := &c.Receivers[i]
+		if r.Name == "" {
+			return fmt.Errorf("receiver %v: missing name", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate receiver %v", r.Name)
+		}
+		names[r.Name] = true
+
+		var types int
+		var err error
+		if r.GitHub != nil {
+			types++
+		}
+		if r.Webhook != nil {
+			types++
+			r.Webhook.URL, err = readURL(r.Webhook.URL, r.Webhook.URLFile)
+		}
+		if r.Slack != nil {
+			types++
+			r.Slack.URL, err = readURL(r.Slack.URL, r.Slack.URLFile)
+		}
+		if types != 1 {
+			return fmt.Errorf("receiver %v: exactly one of github, webhook or slack must be set", r.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("receiver %v: %v", r.Name, err)
+		}
+	}
+
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("no routes")
+	}
+	for i, route := range c.Routes {
+		if len(route.Receivers) == 0 {
+			return fmt.Errorf("route %v: no receivers", i)
+		}
+		for _, name := range route.Receivers {
+			if !names[name] {
+				return fmt.Errorf("route %v: unknown receiver %v", i, name)
+			}
+		}
+		switch route.Status {
+		case "", string(model.AlertFiring), string(model.AlertResolved):
+		default:
+			return fmt.Errorf("route %v: status must be firing or resolved, got %v", i, route.Status)
+		}
+		if route.Template != "" {
+			tmpl, err := textTemplate.New(fmt.Sprintf("route %v", i)).Option("missingkey=zero").Parse(route.Template)
+			if err != nil {
+				return err
+			}
+			route.tmpl = tmpl
+		}
+	}
+	return nil
+}
+
+// readURL returns the URL or the content of the URL file when set.
+func readURL(url, file string) (string, error) {
+	if (url == "") == (file == "") {
+		return "", fmt.Errorf("exactly one of url or url_file must be set")
+	}
+	if file == "" {
+		return url, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (c *notifierConfig) receiver(name string) receiverConfig {
+	for _, r := range c.Receivers {
+		if r.Name == name {
+			return r
+		}
+	}
+	return receiverConfig{}
+}
+
+// routes returns the routes of an alert, in the order of the config.
+func (c *notifierConfig) routes(alert template.Alert) []*routeConfig {
+	var matched []*routeConfig
+	for _, route := range c.Routes {
+		if !route.matches(alert) {
+			continue
+		}
+		matched = append(matched, route)
+		if !route.Continue {
+			break
+		}
+	}
+	return matched
+}
+
+func (r *routeConfig) matches(alert template.Alert) bool {
+	if r.Status != "" && r.Status != alert.Status {
+		return false
+	}
+	for name, value := range r.Match {
+		if alert.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// format returns the notification of an alert.
+func (r *routeConfig) format(alert template.Alert) (string, error) {
+	if r.tmpl == nil {
+		return formatIssueCommentBody(alert)
+	}
+	var b strings.Builder
+	if err := r.tmpl.Execute(&b, alert); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
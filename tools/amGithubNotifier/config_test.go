@@ -0,0 +1,138 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+func TestRoutes(t *testing.T) {
+	received := map[string][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Message string `json:"message"`
+			Text    string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		received[r.URL.Path] = append(received[r.URL.Path], payload.Message+payload.Text)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "amGithubNotifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	authFile := filepath.Join(dir, "oauth")
+	if err := ioutil.WriteFile(authFile, []byte("token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "slack-url"), []byte(srv.URL+"/slack\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(configFile, []byte(`
+receivers:
+- name: oncall
+  webhook:
+    url: `+srv.URL+`/oncall
+- name: slack
+  slack:
+    url_file: `+filepath.Join(dir, "slack-url")+`
+    channel: '#prombench'
+routes:
+- match:
+    event: failed
+    severity: critical
+  status: firing
+  receivers: [oncall, slack]
+  template: 'Benchmark of PR {{ .Labels.prNum }} failed: {{ .Annotations.description }}'
+- match:
+    event: completed
+  receivers: [slack]
+  template: 'Benchmark of PR {{ .Labels.prNum }} completed'
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := newGhWebhookReceiver(ghWebhookReceiverConfig{authFile: authFile, configFile: configFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert := func(status, event, severity string) template.Alert {
+		return template.Alert{
+			Status:      status,
+			Labels:      template.KV{"event": event, "severity": severity, "prNum": "1"},
+			Annotations: template.KV{"description": "prometheus crashed"},
+		}
+	}
+	for _, a := range []template.Alert{
+		alert(string(model.AlertFiring), "failed", "critical"),
+		alert(string(model.AlertResolved), "failed", "critical"),
+		alert(string(model.AlertFiring), "failed", "warning"),
+		alert(string(model.AlertFiring), "completed", "info"),
+	} {
+		if _, err := client.processAlert(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string][]string{
+		"/oncall": {"Benchmark of PR 1 failed: prometheus crashed"},
+		"/slack":  {"Benchmark of PR 1 failed: prometheus crashed", "Benchmark of PR 1 completed"},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("unexpected notifications:\nexp: %v\ngot: %v", expected, received)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]*notifierConfig{
+		"no routes":        {Receivers: []receiverConfig{{Name: "github", GitHub: &githubConfig{}}}},
+		"unknown receiver": {Routes: []*routeConfig{{Receivers: []string{"github"}}}},
+		"two types": {
+			Receivers: []receiverConfig{{Name: "both", GitHub: &githubConfig{}, Slack: &slackConfig{URL: "http://slack"}}},
+			Routes:    []*routeConfig{{Receivers: []string{"both"}}},
+		},
+		"missing url": {
+			Receivers: []receiverConfig{{Name: "oncall", Webhook: &webhookConfig{}}},
+			Routes:    []*routeConfig{{Receivers: []string{"oncall"}}},
+		},
+		"invalid status": {
+			Receivers: []receiverConfig{{Name: "github", GitHub: &githubConfig{}}},
+			Routes:    []*routeConfig{{Receivers: []string{"github"}, Status: "pending"}},
+		},
+		"invalid template": {
+			Receivers: []receiverConfig{{Name: "github", GitHub: &githubConfig{}}},
+			Routes:    []*routeConfig{{Receivers: []string{"github"}, Template: "{{ .Labels"}},
+		},
+	} {
+		if err := cfg.init(); err == nil {
+			t.Errorf("%v: expected an error", name)
+		}
+	}
+}
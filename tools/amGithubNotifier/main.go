@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/google/go-github/v29/github"
 	"github.com/prometheus/alertmanager/notify/webhook"
@@ -31,16 +32,19 @@ import (
 )
 
 type ghWebhookReceiverConfig struct {
-	authFile string
-	org      string
-	repo     string
-	portNo   string
-	dryRun   bool
+	authFile   string
+	org        string
+	repo       string
+	portNo     string
+	dryRun     bool
+	configFile string
 }
 
 type ghWebhookReceiver struct {
-	ghClient *github.Client
-	cfg      ghWebhookReceiverConfig
+	ghClient   *github.Client
+	httpClient *http.Client
+	cfg        ghWebhookReceiverConfig
+	config     *notifierConfig
 }
 
 type ghWebhookHandler struct {
@@ -80,6 +84,7 @@ func main() {
 	app.Flag("repo", "name of the repo").Required().StringVar(&cfg.repo)
 	app.Flag("port", "port number to run the server in").Default("8080").StringVar(&cfg.portNo)
 	app.Flag("dryrun", "dry run for github api").BoolVar(&cfg.dryRun)
+	app.Flag("config", "path to the config file routing the alerts to the receivers, by default all alerts are commented on GitHub").StringVar(&cfg.configFile)
 
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
@@ -128,11 +133,21 @@ func (hl ghWebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func newGhWebhookReceiver(cfg ghWebhookReceiverConfig) (*ghWebhookReceiver, error) {
+	config := defaultConfig()
+	if cfg.configFile != "" {
+		var err error
+		if config, err = loadConfig(cfg.configFile); err != nil {
+			return nil, err
+		}
+	}
+	httpClient := &http.Client{Timeout: 30 * time.Second}
 
 	if cfg.dryRun {
 		return &ghWebhookReceiver{
-			ghClient: github.NewClient(nil),
-			cfg:      cfg,
+			ghClient:   github.NewClient(nil),
+			httpClient: httpClient,
+			cfg:        cfg,
+			config:     config,
 		}, nil
 	}
 
@@ -148,44 +163,49 @@ func newGhWebhookReceiver(cfg ghWebhookReceiverConfig) (*ghWebhookReceiver, erro
 	tc := oauth2.NewClient(ctx, ts)
 
 	return &ghWebhookReceiver{
-		ghClient: github.NewClient(tc),
-		cfg:      cfg,
+		ghClient:   github.NewClient(tc),
+		httpClient: httpClient,
+		cfg:        cfg,
+		config:     config,
 	}, nil
 }
 
-// processAlert formats and posts the alert to GitHub.
-func (g ghWebhookReceiver) processAlert(ctx context.Context, alert template.Alert) (string, error) {
-	msgBody, err := formatIssueCommentBody(alert)
-	if err != nil {
-		return "", err
-	}
-	issueComment := github.IssueComment{Body: &msgBody}
-
-	prNum, err := getTargetPR(alert)
-	if err != nil {
-		return "", err
+// processAlert formats the alert with the templates of its routes and sends it to their receivers.
+// It returns the formatted notifications.
+func (g ghWebhookReceiver) processAlert(ctx context.Context, alert template.Alert) ([]string, error) {
+	routes := g.config.routes(alert)
+	if len(routes) == 0 {
+		log.Printf("no route for alert %v, dropping it", alert.Labels)
+		return nil, nil
 	}
 
-	if g.cfg.dryRun {
-		return msgBody, err
+	var msgs []string
+	for _, route := range routes {
+		msg, err := route.format(alert)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range route.Receivers {
+			if err := g.send(ctx, g.config.receiver(name), alert, msg); err != nil {
+				return nil, fmt.Errorf("sending to receiver %v: %v", name, err)
+			}
+		}
+		msgs = append(msgs, msg)
 	}
-	_, _, err = g.ghClient.Issues.CreateComment(ctx,
-		g.getTargetOrg(alert), g.getTargetRepo(alert), prNum, &issueComment)
-
-	return msgBody, err
+	return msgs, nil
 }
 
 func (g ghWebhookReceiver) processAlerts(ctx context.Context, msg *webhook.Message) ([]string, error) {
 
 	var alertcomments []string
 
-	// Each alert will have its own comment.
+	// Each alert will have its own notifications.
 	for _, a := range msg.Alerts {
 		alertcomment, err := g.processAlert(ctx, a)
 		if err != nil {
 			return nil, err
 		}
-		alertcomments = append(alertcomments, alertcomment)
+		alertcomments = append(alertcomments, alertcomment...)
 	}
 	return alertcomments, nil
 }
@@ -0,0 +1,96 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// webhookPayload is the body posted to the webhook receivers.
+type webhookPayload struct {
+	Message     string      `json:"message"`
+	Status      string      `json:"status"`
+	Labels      template.KV `json:"labels"`
+	Annotations template.KV `json:"annotations"`
+}
+
+// slackPayload is the body posted to the Slack incoming webhooks.
+type slackPayload struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+// send sends the notification of an alert to a receiver.
+func (g ghWebhookReceiver) send(ctx context.Context, r receiverConfig, alert template.Alert, msg string) error {
+	switch {
+	case r.GitHub != nil:
+		prNum, err := getTargetPR(alert)
+		if err != nil {
+			return err
+		}
+		if g.cfg.dryRun {
+			return nil
+		}
+		_, _, err = g.ghClient.Issues.CreateComment(ctx,
+			g.getTargetOrg(alert), g.getTargetRepo(alert), prNum, &github.IssueComment{Body: &msg})
+		return err
+	case r.Webhook != nil:
+		return g.post(ctx, r.Webhook.URL, webhookPayload{
+			Message:     msg,
+			Status:      alert.Status,
+			Labels:      alert.Labels,
+			Annotations: alert.Annotations,
+		})
+	case r.Slack != nil:
+		return g.post(ctx, r.Slack.URL, slackPayload{Channel: r.Slack.Channel, Text: msg})
+	}
+	return fmt.Errorf("unknown receiver %v", r.Name)
+}
+
+// post posts the payload as json.
+func (g ghWebhookReceiver) post(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if g.cfg.dryRun {
+		log.Printf("dry run, not posting: %s", body)
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %v: %s", resp.Status, respBody)
+	}
+	return nil
+}
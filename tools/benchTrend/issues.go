@@ -0,0 +1,213 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// significanceLevel is the p-value below which the samples of the baseline and the last run differ.
+const significanceLevel = 0.05
+
+// regression is a regression confirmed by several runs.
+type regression struct {
+	trend
+	// Reruns is the number of the last runs that all regressed.
+	Reruns int
+	// PValue of the U-test between the samples of the baseline and the last run, when Tested.
+	PValue float64
+	Tested bool
+}
+
+// change returns the relative change of the value compared to the baseline, positive when it is worse.
+func (t trend) change(v float64) float64 {
+	if t.Baseline == 0 {
+		return 0
+	}
+	c := (v - t.Baseline) / t.Baseline
+	if higherIsBetter(t.Unit) {
+		return -c
+	}
+	return c
+}
+
+// confirm returns the regression when the last reruns values all regressed more than the threshold
+// and, when the benchmarks ran several times, the samples of the last run differ significantly from the baseline.
+func (t trend) confirm(threshold float64, reruns int) (*regression, bool) {
+	if reruns < 1 || len(t.Values) < reruns {
+		return nil, false
+	}
+	for _, v := range t.Values[len(t.Values)-reruns:] {
+		if t.change(v) <= threshold {
+			return nil, false
+		}
+	}
+
+	r := &regression{trend: t, Reruns: reruns}
+	old := t.baselineRun.samples[t.seriesKey]
+	last := t.runs[len(t.runs)-1].samples[t.seriesKey]
+	p, err := benchstat.UTest(&benchstat.Metrics{RValues: old}, &benchstat.Metrics{RValues: last})
+	if err == nil {
+		r.PValue, r.Tested = p, true
+		if p >= significanceLevel {
+			return nil, false
+		}
+	}
+	return r, true
+}
+
+// confirmedRegressions returns the regressions of the report confirmed by the last reruns runs.
+func (r *report) confirmedRegressions(threshold float64, reruns int) []regression {
+	var regs []regression
+	for _, t := range r.Regressions {
+		if reg, ok := t.confirm(threshold, reruns); ok {
+			regs = append(regs, *reg)
+		}
+	}
+	return regs
+}
+
+// Title is the title of the issue, used to find the issue already filed for the regression.
+func (r regression) Title() string {
+	return fmt.Sprintf("Benchmark regression: %s %s", r.Benchmark, r.Unit)
+}
+
+// issueRun is a row of the runs table in the issue.
+type issueRun struct {
+	Name, Commit, Profile string
+	Value                 float64
+	Change                string
+}
+
+type issueData struct {
+	regression
+	Runs []issueRun
+	// Compare links the commits between the last good run and the first run of the regression.
+	Compare string
+}
+
+const issueTemplate = `The benchmark ` + "`{{ .Benchmark }}`" + ` regressed by {{ .ChangeString }} in ` + "`{{ .Unit }}`" + ` compared to the baseline.
+The regression is confirmed by the last {{ .Reruns }} runs{{ if .Tested }}, the samples of the last run differ from the baseline with a p-value of {{ printf "%.4f" .PValue }}{{ end }}.
+{{ if .Compare }}
+Suspected commits: {{ .Compare }}
+{{ end }}
+| Run | Commit | {{ .Unit }} | Change | CPU profile |
+| --- | --- | --- | --- | --- |
+{{ range .Runs }}| {{ .Name }} | {{ .Commit }} | {{ .Value }} | {{ .Change }} | {{ .Profile }} |
+{{ end }}
+Filed by benchTrend, close the issue once the regression is resolved or accepted.
+`
+
+// body returns the markdown body of the issue with the runs of the regression,
+// linking the commits of the runs in the repo and the CPU profiles published at profilesURL.
+func (r regression) body(org, repo, profilesURL string) (string, error) {
+	commit := func(sha string) string {
+		if sha == "" {
+			return ""
+		}
+		if org == "" || repo == "" {
+			return sha[:12]
+		}
+		return fmt.Sprintf("[%s](https://github.com/%s/%s/commit/%s)", sha[:12], org, repo, sha)
+	}
+	profile := func(name string) string {
+		if name == "" || profilesURL == "" {
+			return ""
+		}
+		u := strings.TrimSuffix(profilesURL, "/") + "/" + url.PathEscape(name)
+		return fmt.Sprintf("[flamegraph](https://www.speedscope.app/#profileURL=%s) ([pprof](%s))", url.QueryEscape(u), u)
+	}
+
+	data := issueData{regression: r}
+	data.Runs = append(data.Runs, issueRun{
+		Name:    "baseline " + r.baselineRun.time.Format("2006-01-02"),
+		Commit:  commit(r.baselineRun.commit),
+		Profile: profile(r.baselineRun.profile),
+		Value:   r.Baseline,
+	})
+	for i, run := range r.runs {
+		data.Runs = append(data.Runs, issueRun{
+			Name:    run.time.Format("2006-01-02 15:04"),
+			Commit:  commit(run.commit),
+			Profile: profile(run.profile),
+			Value:   r.Values[i],
+			Change:  fmt.Sprintf("%+.2f%%", (r.Values[i]-r.Baseline)/r.Baseline*100),
+		})
+	}
+
+	// The regression started with the first of the reruns, the run before it is the last good one.
+	first := len(r.runs) - r.Reruns
+	good := r.baselineRun
+	if first > 0 {
+		good = r.runs[first-1]
+	}
+	if bad := r.runs[first]; good.commit != "" && bad.commit != "" && org != "" && repo != "" {
+		data.Compare = fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", org, repo, good.commit, bad.commit)
+	}
+
+	var b strings.Builder
+	if err := template.Must(template.New("issue").Parse(issueTemplate)).Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// fileIssues opens an issue with the labels for every regression without an open issue.
+func fileIssues(ctx context.Context, clt *github.Client, org, repo string, labels []string, profilesURL string, regs []regression) error {
+	filed := map[string]bool{}
+	opts := &github.IssueListByRepoOptions{State: "open", Labels: labels, ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		issues, resp, err := clt.Issues.ListByRepo(ctx, org, repo, opts)
+		if err != nil {
+			return errors.Wrap(err, "listing the open regression issues")
+		}
+		for _, i := range issues {
+			filed[i.GetTitle()] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	for _, r := range regs {
+		if filed[r.Title()] {
+			log.Printf("An issue is already open for %q", r.Title())
+			continue
+		}
+		body, err := r.body(org, repo, profilesURL)
+		if err != nil {
+			return err
+		}
+		issue, _, err := clt.Issues.Create(ctx, org, repo, &github.IssueRequest{
+			Title:  github.String(r.Title()),
+			Body:   github.String(body),
+			Labels: &labels,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "creating the issue %q", r.Title())
+		}
+		log.Printf("Filed %v", issue.GetHTMLURL())
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"golang.org/x/oauth2"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func main() {
+	log.SetFlags(log.Ltime | log.Lshortfile)
+	cfg := struct {
+		resultsDir string
+		period     time.Duration
+		threshold  float64
+		format     string
+		output     string
+
+		fileIssues  bool
+		reruns      int
+		org         string
+		repo        string
+		labels      []string
+		profilesURL string
+	}{}
+
+	app := kingpin.New(filepath.Base(os.Args[0]), `Generates a trend report of the benchmark results stored by funcbench
+	Example: ./benchTrend --results=_dev/funcbench --format=markdown > report.md
+
+	Each results file is a benchmark run at the modification time of the file.
+
+	Note: Filing issues requires the GITHUB_TOKEN env variable.
+	`)
+	app.Flag("results", "Directory with the stored benchmark results, e.g. the funcbench --result-cache directory.").Required().StringVar(&cfg.resultsDir)
+	app.Flag("period", "Period of the report ending now. The last run before the period is the baseline.").Default("168h").DurationVar(&cfg.period)
+	app.Flag("threshold", "Relative change of a benchmark reported as a regression or an improvement.").Default("0.05").Float64Var(&cfg.threshold)
+	app.Flag("format", "Format of the report.").Default("markdown").EnumVar(&cfg.format, "markdown", "html")
+	app.Flag("output", "File to write the report to. Defaults to stdout.").Short('o').StringVar(&cfg.output)
+	app.Flag("file-issues", "Open a GitHub issue for every confirmed regression without an open issue.").BoolVar(&cfg.fileIssues)
+	app.Flag("confirm-runs", "Number of the last runs that must all regress more than the threshold to confirm a regression.").Default("2").IntVar(&cfg.reruns)
+	app.Flag("org", "name of the org of the issues and the benchmarked commits").StringVar(&cfg.org)
+	app.Flag("repo", "name of the repo of the issues and the benchmarked commits").StringVar(&cfg.repo)
+	app.Flag("issue-label", "Label of the filed issues, can be repeated.").Default("kind/performance-regression").StringsVar(&cfg.labels)
+	app.Flag("profiles-url", "Base URL where the results directory is published, to link the CPU profiles of the runs in the issues.").StringVar(&cfg.profilesURL)
+
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	runs, err := readRuns(cfg.resultsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	now := time.Now()
+	rep := newReport(runs, now.Add(-cfg.period), now, cfg.threshold)
+
+	var w io.Writer = os.Stdout
+	if cfg.output != "" {
+		f, err := os.Create(cfg.output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := rep.write(w, cfg.format); err != nil {
+		log.Fatalf("writing the report: %v", err)
+	}
+
+	if cfg.fileIssues {
+		token := os.Getenv("GITHUB_TOKEN")
+		if token == "" || cfg.org == "" || cfg.repo == "" {
+			log.Fatal("the GITHUB_TOKEN env variable and the org and repo flags are required to file issues")
+		}
+		ctx := context.Background()
+		clt := github.NewClient(oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+		regs := rep.confirmedRegressions(cfg.threshold, cfg.reruns)
+		log.Printf("%d of %d regressions are confirmed", len(regs), len(rep.Regressions))
+		if err := fileIssues(ctx, clt, cfg.org, cfg.repo, cfg.labels, cfg.profilesURL, regs); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
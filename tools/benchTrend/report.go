@@ -0,0 +1,291 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/perf/benchstat"
+)
+
+// run is a single benchmark run stored in the results directory.
+type run struct {
+	time time.Time
+	// Mean values by benchmark and unit.
+	means map[seriesKey]float64
+	// Samples of the benchmarks run several times with -count, by benchmark and unit.
+	samples map[seriesKey][]float64
+	// Commit of the run and its CPU profile, set for the results named by funcbench.
+	commit  string
+	profile string
+}
+
+// resultsFile matches the name of the results files of funcbench, which end with the commit hash.
+var resultsFile = regexp.MustCompile(`-([0-9a-f]{40})\.out$`)
+
+type seriesKey struct {
+	Benchmark, Unit string
+}
+
+// trend is the evolution of a benchmark metric during the report period.
+type trend struct {
+	seriesKey
+	// Baseline is the last value before the report period or the first value in the period.
+	Baseline float64
+	Values   []float64
+	// Change is the relative change of the last value compared to the baseline.
+	Change float64
+
+	// The runs of the baseline and the values.
+	baselineRun run
+	runs        []run
+}
+
+// Sparkline returns the values as a unicode sparkline.
+func (t trend) Sparkline() string {
+	return sparkline(append([]float64{t.Baseline}, t.Values...))
+}
+
+// ChangeString returns the change as a signed percentage.
+func (t trend) ChangeString() string {
+	return fmt.Sprintf("%+.2f%%", t.Change*100)
+}
+
+// report is the trend report of the benchmarks run during a period.
+type report struct {
+	From, To     time.Time
+	Runs         int
+	Regressions  []trend
+	Improvements []trend
+	Trends       []trend
+}
+
+// readRuns reads the benchmark results stored in the directory.
+// The modification time of a file is the time of the run.
+func readRuns(dir string) ([]run, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the results directory")
+	}
+
+	var runs []run
+	for _, fi := range files {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".out" {
+			continue
+		}
+		fn := filepath.Join(dir, fi.Name())
+		f, err := os.Open(fn)
+		if err != nil {
+			return nil, err
+		}
+		c := &benchstat.Collection{}
+		err = c.AddFile(fi.Name(), f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", fn)
+		}
+
+		r := run{time: fi.ModTime(), means: map[seriesKey]float64{}, samples: map[seriesKey][]float64{}}
+		if m := resultsFile.FindStringSubmatch(fi.Name()); m != nil {
+			r.commit = m[1]
+			profile := strings.TrimSuffix(fi.Name(), ".out") + ".cpu.pprof"
+			if _, err := os.Stat(filepath.Join(dir, profile)); err == nil {
+				r.profile = profile
+			}
+		}
+		for k, m := range c.Metrics {
+			if len(m.Values) == 0 {
+				continue
+			}
+			var sum float64
+			for _, v := range m.Values {
+				sum += v
+			}
+			key := seriesKey{Benchmark: k.Benchmark, Unit: k.Unit}
+			r.means[key] = sum / float64(len(m.Values))
+			r.samples[key] = m.Values
+		}
+		runs = append(runs, r)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].time.Before(runs[j].time) })
+	return runs, nil
+}
+
+// newReport returns the trends of the runs between from and to.
+// A metric changing more than the threshold is reported as a regression or an improvement.
+func newReport(runs []run, from, to time.Time, threshold float64) *report {
+	rep := &report{From: from, To: to}
+	trends := map[seriesKey]*trend{}
+	baselines := map[seriesKey]run{}
+
+	for _, r := range runs {
+		if r.time.After(to) {
+			break
+		}
+		if r.time.Before(from) {
+			for k := range r.means {
+				baselines[k] = r
+			}
+			continue
+		}
+		rep.Runs++
+		for k, v := range r.means {
+			t, ok := trends[k]
+			if !ok {
+				t = &trend{seriesKey: k, Baseline: v, baselineRun: r}
+				if b, ok := baselines[k]; ok {
+					t.Baseline = b.means[k]
+					t.baselineRun = b
+				}
+				trends[k] = t
+			}
+			t.Values = append(t.Values, v)
+			t.runs = append(t.runs, r)
+		}
+	}
+
+	for _, t := range trends {
+		if t.Baseline != 0 {
+			t.Change = (t.Values[len(t.Values)-1] - t.Baseline) / t.Baseline
+		}
+		rep.Trends = append(rep.Trends, *t)
+
+		change := t.Change
+		if higherIsBetter(t.Unit) {
+			change = -change
+		}
+		switch {
+		case change > threshold:
+			rep.Regressions = append(rep.Regressions, *t)
+		case change < -threshold:
+			rep.Improvements = append(rep.Improvements, *t)
+		}
+	}
+	sortTrends(rep.Trends)
+	sortTrends(rep.Regressions)
+	sortTrends(rep.Improvements)
+	return rep
+}
+
+// higherIsBetter returns true for throughput units like MB/s.
+func higherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+func sortTrends(trends []trend) {
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Benchmark != trends[j].Benchmark {
+			return trends[i].Benchmark < trends[j].Benchmark
+		}
+		return trends[i].Unit < trends[j].Unit
+	})
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline scales the values between their min and max.
+func sparkline(values []float64) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > min {
+			i = int((v - min) / (max - min) * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+var funcs = template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2006-01-02") },
+}
+
+const markdownTemplate = `# Benchmark trend report {{ date .From }} - {{ date .To }}
+
+{{ .Runs }} benchmark runs.
+{{ if .Regressions }}
+## Regressions
+
+| Benchmark | Unit | Trend | Change |
+| --- | --- | --- | --- |
+{{ range .Regressions }}| {{ .Benchmark }} | {{ .Unit }} | {{ .Sparkline }} | {{ .ChangeString }} |
+{{ end }}{{ end }}{{ if .Improvements }}
+## Improvements
+
+| Benchmark | Unit | Trend | Change |
+| --- | --- | --- | --- |
+{{ range .Improvements }}| {{ .Benchmark }} | {{ .Unit }} | {{ .Sparkline }} | {{ .ChangeString }} |
+{{ end }}{{ end }}
+<details><summary>All benchmarks</summary>
+
+| Benchmark | Unit | Trend | Change |
+| --- | --- | --- | --- |
+{{ range .Trends }}| {{ .Benchmark }} | {{ .Unit }} | {{ .Sparkline }} | {{ .ChangeString }} |
+{{ end }}
+</details>
+`
+
+const htmlTemplate = `<html>
+<body>
+<h1>Benchmark trend report {{ date .From }} - {{ date .To }}</h1>
+<p>{{ .Runs }} benchmark runs.</p>
+{{ if .Regressions }}<h2>Regressions</h2>
+{{ template "table" .Regressions }}{{ end }}
+{{ if .Improvements }}<h2>Improvements</h2>
+{{ template "table" .Improvements }}{{ end }}
+<h2>All benchmarks</h2>
+{{ template "table" .Trends }}
+</body>
+</html>
+{{ define "table" }}<table>
+<tr><th>Benchmark</th><th>Unit</th><th>Trend</th><th>Change</th></tr>
+{{ range . }}<tr><td>{{ .Benchmark }}</td><td>{{ .Unit }}</td><td>{{ .Sparkline }}</td><td>{{ .ChangeString }}</td></tr>
+{{ end }}</table>{{ end }}
+`
+
+// write renders the report in the markdown or html format.
+func (r *report) write(w io.Writer, format string) error {
+	switch format {
+	case "markdown":
+		tmpl, err := textTemplate.New("report").Funcs(textTemplate.FuncMap(funcs)).Parse(markdownTemplate)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, r)
+	case "html":
+		tmpl, err := template.New("report").Funcs(funcs).Parse(htmlTemplate)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, r)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_bench_trend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, r := range []struct {
+		age        time.Duration
+		nsPerOp    int
+		throughput int
+	}{
+		{age: 10 * 24 * time.Hour, nsPerOp: 100, throughput: 100},
+		{age: 3 * 24 * time.Hour, nsPerOp: 102, throughput: 120},
+		{age: 24 * time.Hour, nsPerOp: 120, throughput: 150},
+	} {
+		file := filepath.Join(dir, fmt.Sprintf("run%d.out", i))
+		content := fmt.Sprintf("BenchmarkQuery-8 \t 1000 \t %d ns/op\nBenchmarkWrite-8 \t 1000 \t 10 ns/op \t %d MB/s\n", r.nsPerOp, r.throughput)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, now.Add(-r.age), now.Add(-r.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := readRuns(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := newReport(runs, now.Add(-7*24*time.Hour), now, 0.05)
+
+	if rep.Runs != 2 {
+		t.Errorf("expected 2 runs in the period, got %d", rep.Runs)
+	}
+	if len(rep.Regressions) != 1 || rep.Regressions[0].Benchmark != "Query-8" || rep.Regressions[0].ChangeString() != "+20.00%" {
+		t.Errorf("unexpected regressions: %+v", rep.Regressions)
+	}
+	if len(rep.Improvements) != 1 || rep.Improvements[0].Unit != "MB/s" {
+		t.Errorf("unexpected improvements: %+v", rep.Improvements)
+	}
+	if len(rep.Trends) != 3 {
+		t.Errorf("expected 3 trends, got %d", len(rep.Trends))
+	}
+
+	var b bytes.Buffer
+	if err := rep.write(&b, "markdown"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "| Query-8 | ns/op | ▁▁█ | +20.00% |") {
+		t.Errorf("unexpected report:\n%s", b.String())
+	}
+}
+
+func TestConfirmedRegressions(t *testing.T) {
+	key := seriesKey{Benchmark: "Query-8", Unit: "ns/op"}
+	now := time.Now()
+	newRun := func(age time.Duration, commit string, samples ...float64) run {
+		var sum float64
+		for _, s := range samples {
+			sum += s
+		}
+		return run{
+			time:    now.Add(-age),
+			commit:  strings.Repeat(commit, 40),
+			profile: "run-" + commit + ".cpu.pprof",
+			means:   map[seriesKey]float64{key: sum / float64(len(samples))},
+			samples: map[seriesKey][]float64{key: samples},
+		}
+	}
+	runs := []run{
+		newRun(10*24*time.Hour, "a", 100, 101, 99, 100, 102),
+		newRun(3*24*time.Hour, "b", 101, 100, 99, 102, 100),
+		newRun(2*24*time.Hour, "c", 120, 121, 119, 122, 120),
+		newRun(24*time.Hour, "d", 121, 120, 119, 120, 122),
+	}
+	rep := newReport(runs, now.Add(-7*24*time.Hour), now, 0.05)
+
+	if regs := rep.confirmedRegressions(0.05, 3); len(regs) != 0 {
+		t.Errorf("expected no regression confirmed by 3 runs, got %+v", regs)
+	}
+	regs := rep.confirmedRegressions(0.05, 2)
+	if len(regs) != 1 {
+		t.Fatalf("expected 1 regression confirmed by 2 runs, got %d", len(regs))
+	}
+	if !regs[0].Tested || regs[0].PValue >= significanceLevel {
+		t.Errorf("expected a significant U-test, got %+v", regs[0])
+	}
+
+	body, err := regs[0].body("prometheus", "prometheus", "https://example.com/results/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"https://github.com/prometheus/prometheus/compare/" + strings.Repeat("b", 40) + "..." + strings.Repeat("c", 40),
+		"[cccccccccccc](https://github.com/prometheus/prometheus/commit/" + strings.Repeat("c", 40) + ")",
+		"profileURL=" + url.QueryEscape("https://example.com/results/run-d.cpu.pprof"),
+		"| 120.4 | +19.92% |",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("issue body doesn't contain %s:\n%s", s, body)
+		}
+	}
+
+	// Samples which don't differ significantly don't confirm a regression.
+	runs[3] = newRun(24*time.Hour, "d", 90, 150, 99, 101, 160)
+	rep = newReport(runs, now.Add(-7*24*time.Hour), now, 0.05)
+	if regs := rep.confirmedRegressions(0.05, 2); len(regs) != 0 {
+		t.Errorf("expected no regression for noisy samples, got %+v", regs)
+	}
+}
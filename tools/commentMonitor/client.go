@@ -22,6 +22,7 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 type commentMonitorClient struct {
@@ -35,6 +36,7 @@ type commentMonitorClient struct {
 	eventType        string
 	commentTemplate  string
 	label            string
+	runLabel         string
 }
 
 // Set eventType and commentTemplate if
@@ -46,6 +48,7 @@ func (c *commentMonitorClient) validateRegex(command string) bool {
 			c.commentTemplate = e.CommentTemplate
 			c.eventType = e.EventType
 			c.label = e.Label
+			c.runLabel = e.RunLabel
 			log.Println("comment validation successful")
 			return true
 		}
@@ -106,6 +109,9 @@ func (c *commentMonitorClient) extractArgs(command string) error {
 		if err != nil {
 			return fmt.Errorf("%v: could not fetch SHA", err)
 		}
+		if err := c.setRunWindow(time.Now()); err != nil {
+			return err
+		}
 
 		// TODO (geekodour) : We could run this in a seperate method.
 		err = c.ghClient.createRepositoryDispatch(c.eventType, c.allArgs)
@@ -116,6 +122,26 @@ func (c *commentMonitorClient) extractArgs(command string) error {
 	return nil
 }
 
+// setRunWindow adds the window of the run to the args used for the links in the comments.
+// A run starts with the comment, unless the event ends the run started by adding the runLabel.
+func (c *commentMonitorClient) setRunWindow(now time.Time) error {
+	if c.runLabel == "" {
+		c.allArgs[runStartArg] = unixMilli(now)
+		return nil
+	}
+	start, err := c.ghClient.labeledAt(c.runLabel)
+	if err != nil {
+		return fmt.Errorf("%v: could not find the start of the run", err)
+	}
+	if start.IsZero() {
+		log.Printf("label %v was never added, the links are not pinned to the run", c.runLabel)
+		start = now
+	}
+	c.allArgs[runStartArg] = unixMilli(start)
+	c.allArgs[runEndArg] = unixMilli(now)
+	return nil
+}
+
 func (c commentMonitorClient) postLabel() error {
 	if c.label != "" {
 		if err := c.ghClient.createLabel(c.label); err != nil {
@@ -142,7 +168,10 @@ func (c commentMonitorClient) generateAndPostComment(commentTemplate string) err
 		}
 		// Generate the comment template.
 		var buf bytes.Buffer
-		ct := template.Must(template.New("Comment").Parse(commentTemplate))
+		ct, err := template.New("Comment").Funcs(linkFuncs(c.allArgs, time.Now())).Parse(commentTemplate)
+		if err != nil {
+			return err
+		}
 		if err := ct.Execute(&buf, c.allArgs); err != nil {
 			return err
 		}
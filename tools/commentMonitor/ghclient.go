@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/google/go-github/v29/github"
 	"golang.org/x/oauth2"
@@ -66,6 +67,27 @@ func (c githubClient) createLabel(labelName string) error {
 	return err
 }
 
+// labeledAt returns when the label was last added to the PR, zero if it never was.
+func (c githubClient) labeledAt(label string) (time.Time, error) {
+	var t time.Time
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := c.clt.Issues.ListIssueEvents(c.ctx, c.owner, c.repo, c.pr, opts)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, e := range events {
+			if e.GetEvent() == "labeled" && e.GetLabel().GetName() == label && e.GetCreatedAt().After(t) {
+				t = e.GetCreatedAt()
+			}
+		}
+		if resp.NextPage == 0 {
+			return t, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
 func (c githubClient) getLastCommitSHA() (string, error) {
 	// https://developer.github.com/v3/pulls/#list-commits-on-a-pull-request
 	listops := &github.ListOptions{Page: 1, PerPage: 250}
@@ -0,0 +1,121 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The run window is passed to the templates and the repository_dispatch payload
+// as unix timestamps in milliseconds. RUN_END is only set once the run has ended.
+const (
+	runStartArg = "RUN_START"
+	runEndArg   = "RUN_END"
+)
+
+// minGraphRange is the smallest range of the Prometheus graph links,
+// so that a run which just started still shows some data.
+const minGraphRange = time.Hour
+
+func unixMilli(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func parseUnixMilli(s string) (time.Time, bool) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// runWindow returns the window of the run from the args.
+// The start defaults to now and a zero end means the run is still going.
+func runWindow(args map[string]string, now time.Time) (start, end time.Time) {
+	start, ok := parseUnixMilli(args[runStartArg])
+	if !ok {
+		start = now
+	}
+	end, _ = parseUnixMilli(args[runEndArg])
+	return start, end
+}
+
+// linkFuncs returns the template functions which build the links pinned to the run window,
+// so that the links still show the run after it has ended and newer runs have started.
+func linkFuncs(args map[string]string, now time.Time) template.FuncMap {
+	start, end := runWindow(args, now)
+	from, to := unixMilli(start), "now"
+	if !end.IsZero() {
+		to = unixMilli(end)
+	}
+
+	return template.FuncMap{
+		// dashboardURL links a Grafana dashboard with the time range of the run
+		// and the dashboard variables given as name value pairs.
+		"dashboardURL": func(base string, vars ...string) (string, error) {
+			if len(vars)%2 != 0 {
+				return "", fmt.Errorf("dashboard variables must be name value pairs, got %v", vars)
+			}
+			v := url.Values{}
+			v.Set("orgId", "1")
+			v.Set("from", from)
+			v.Set("to", to)
+			for i := 0; i < len(vars); i += 2 {
+				v.Add("var-"+vars[i], vars[i+1])
+			}
+			return base + "?" + v.Encode(), nil
+		},
+		// exploreURL links the Grafana explorer with the logs query of the datasource in the time range of the run.
+		"exploreURL": func(base, datasource, expr string) (string, error) {
+			left, err := json.Marshal([]interface{}{
+				from, to, datasource,
+				map[string]string{"expr": expr},
+				map[string]string{"mode": "Logs"},
+				map[string][]interface{}{"ui": {true, true, true, "none"}},
+			})
+			if err != nil {
+				return "", err
+			}
+			v := url.Values{}
+			v.Set("orgId", "1")
+			v.Set("left", string(left))
+			return base + "?" + v.Encode(), nil
+		},
+		// graphURL links the Prometheus graph of the expression covering the run.
+		"graphURL": func(base, expr string) string {
+			e := end
+			if e.IsZero() {
+				e = now
+			}
+			r := e.Sub(start).Round(time.Minute) + time.Minute
+			if r < minGraphRange {
+				r = minGraphRange
+			}
+			v := url.Values{}
+			v.Set("g0.expr", expr)
+			v.Set("g0.tab", "0")
+			v.Set("g0.range_input", fmt.Sprintf("%vs", int64(r/time.Second)))
+			if !end.IsZero() {
+				v.Set("g0.end_input", end.UTC().Format("2006-01-02 15:04:05"))
+			}
+			return strings.TrimSuffix(base, "/") + "/graph?" + v.Encode()
+		},
+	}
+}
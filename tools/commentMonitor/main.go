@@ -47,6 +47,9 @@ type webhookEvent struct {
 	CommentTemplate string `yaml:"comment_template"`
 	RegexString     string `yaml:"regex_string"`
 	Label           string `yaml:"label"`
+	// RunLabel is set for events ending a run, the links in the comment are pinned
+	// to the window from when the label was last added to the PR until now.
+	RunLabel string `yaml:"run_label"`
 }
 
 type configFile struct {
@@ -13,7 +13,14 @@
 
 package main
 
-import "testing"
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
 
 func TestExtractCommand(t *testing.T) {
 	testCases := []struct {
@@ -59,3 +66,59 @@ func TestCheckCommandPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestLinkFuncs(t *testing.T) {
+	start := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	now := end.Add(24 * time.Hour)
+	tmpl := `{{ dashboardURL "http://d/grafana/d/uid/prombench" "pr-number" (index . "PR_NUMBER") }}
+{{ exploreURL "http://d/grafana/explore" "loki-meta" "{namespace=\"prombench-1\"}" }}
+{{ graphURL "http://d/prometheus-meta/" "up" }}`
+
+	testCases := []struct {
+		name string
+		args map[string]string
+		want []string
+	}{
+		{
+			name: "running",
+			args: map[string]string{"PR_NUMBER": "1", runStartArg: unixMilli(start)},
+			want: []string{
+				"from=1583056800000&orgId=1&to=now&var-pr-number=1",
+				url.QueryEscape(`["1583056800000","now","loki-meta",{"expr":"{namespace=\"prombench-1\"}"}`),
+				"http://d/prometheus-meta/graph?g0.expr=up&g0.range_input=93660s&g0.tab=0",
+			},
+		},
+		{
+			name: "ended",
+			args: map[string]string{"PR_NUMBER": "1", runStartArg: unixMilli(start), runEndArg: unixMilli(end)},
+			want: []string{
+				"from=1583056800000&orgId=1&to=1583064000000&var-pr-number=1",
+				url.QueryEscape(`["1583056800000","1583064000000","loki-meta"`),
+				"g0.end_input=2020-03-01+12%3A00%3A00&g0.expr=up&g0.range_input=7260s&g0.tab=0",
+			},
+		},
+		{
+			name: "no run",
+			args: map[string]string{"PR_NUMBER": "1"},
+			want: []string{
+				"from=" + unixMilli(now) + "&orgId=1&to=now",
+				"g0.range_input=3600s",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			ct := template.Must(template.New("Comment").Funcs(linkFuncs(tc.args, now)).Parse(tmpl))
+			if err := ct.Execute(&buf, tc.args); err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(buf.String(), w) {
+					t.Errorf("links %s don't contain %s", buf.String(), w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/test-infra/pkg/auth"
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// prNumber matches the path of the logs of a benchmark.
+var prNumber = regexp.MustCompile(`^[0-9]+$`)
+
+type logStreamer struct {
+	k8sClient       *k8s.K8s
+	namespacePrefix string
+	tailLines       int64
+}
+
+func main() {
+	log.SetFlags(log.Ltime | log.Lshortfile)
+	var (
+		port       string
+		token      string
+		authConfig string
+		s          logStreamer
+	)
+
+	app := kingpin.New(filepath.Base(os.Args[0]), `Streams the live logs of the benchmarks running in the cluster over http.
+	Example: curl http://prombench.prometheus.io/logs/123?pod=prometheus-test-pr`)
+	app.HelpFlag.Short('h')
+	app.Flag("port", "port number to serve the logs on.").
+		Default("8080").
+		StringVar(&port)
+	app.Flag("namespace-prefix", "Prefix of the benchmark namespaces, followed by the PR number.").
+		Default("prombench-").
+		StringVar(&s.namespacePrefix)
+	app.Flag("tail", "Number of lines from the end of the logs of each container, when not set in the request. 0 streams all lines.").
+		Default("100").
+		Int64Var(&s.tailLines)
+	app.Flag("token", "Token allowed to stream the logs, read from the LOG_STREAMER_TOKEN env var when not set. The logs are served without authentication when it is empty without an --auth-config.").
+		Envar("LOG_STREAMER_TOKEN").
+		StringVar(&token)
+	app.Flag("auth-config", "File with the tokens allowed to stream the logs, the tokens with the read scope of the runnerPool auth config.").
+		ExistingFileVar(&authConfig)
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	authenticator, err := auth.New(token, authConfig)
+	if err != nil {
+		log.Fatalf("creating the authenticator: %v", err)
+	}
+
+	s.k8sClient, err = k8s.New(context.Background(), nil)
+	if err != nil {
+		log.Fatalf("creating the k8s client inside the cluster: %v", err)
+	}
+
+	var logs http.Handler = http.HandlerFunc(s.logs)
+	if authenticator != nil {
+		logs = authenticator.Require(auth.ScopeRead, logs)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/logs/", logs)
+	log.Println("Server is ready to handle requests at", port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", port), mux))
+}
+
+// logOptions returns the options of a request for /logs/<pr number>.
+// The query parameters pod, container, tail, follow and events change the defaults.
+func (s *logStreamer) logOptions(r *http.Request) (k8s.LogOptions, error) {
+	pr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/logs/"), "/")
+	if !prNumber.MatchString(pr) {
+		return k8s.LogOptions{}, fmt.Errorf("expected /logs/<pr number>, got %v", r.URL.Path)
+	}
+	q := r.URL.Query()
+	opts := k8s.LogOptions{
+		Namespace: s.namespacePrefix + pr,
+		Pod:       q.Get("pod"),
+		Container: q.Get("container"),
+		TailLines: s.tailLines,
+		Follow:    true,
+		Events:    true,
+	}
+
+	var err error
+	if v := q.Get("tail"); v != "" {
+		if opts.TailLines, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return opts, fmt.Errorf("invalid tail %q: %v", v, err)
+		}
+	}
+	if v := q.Get("follow"); v != "" {
+		if opts.Follow, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid follow %q: %v", v, err)
+		}
+	}
+	if v := q.Get("events"); v != "" {
+		if opts.Events, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid events %q: %v", v, err)
+		}
+	}
+	return opts, nil
+}
+
+// flushWriter sends every line to the client right away.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+func (f flushWriter) Flush() {
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (s *logStreamer) logs(w http.ResponseWriter, r *http.Request) {
+	opts, err := s.logOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Disable the response buffering of the nginx ingress.
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	log.Printf("streaming the logs of namespace %v to %v", opts.Namespace, r.RemoteAddr)
+	// The request context is done when the client goes away.
+	if err := s.k8sClient.StreamLogs(r.Context(), flushWriter{w: w}, opts); err != nil {
+		log.Println(err)
+		fmt.Fprintln(w, err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/test-infra/pkg/provider/k8s"
+)
+
+func TestLogOptions(t *testing.T) {
+	s := &logStreamer{namespacePrefix: "prombench-", tailLines: 100}
+	testCases := []struct {
+		url     string
+		opts    k8s.LogOptions
+		invalid bool
+	}{
+		{
+			url:  "/logs/123",
+			opts: k8s.LogOptions{Namespace: "prombench-123", TailLines: 100, Follow: true, Events: true},
+		},
+		{
+			url:  "/logs/123/?pod=prometheus-test-pr&container=prometheus&tail=0&follow=false&events=false",
+			opts: k8s.LogOptions{Namespace: "prombench-123", Pod: "prometheus-test-pr", Container: "prometheus"},
+		},
+		{url: "/logs/", invalid: true},
+		{url: "/logs/kube-system", invalid: true},
+		{url: "/logs/123/extra", invalid: true},
+		{url: "/logs/123?tail=all", invalid: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			opts, err := s.logOptions(httptest.NewRequest("GET", tc.url, nil))
+			if tc.invalid {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts != tc.opts {
+				t.Errorf("expected %+v, got %+v", tc.opts, opts)
+			}
+		})
+	}
+}
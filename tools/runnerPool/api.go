@@ -0,0 +1,245 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/test-infra/pkg/auth"
+)
+
+const apiPrefix = "/api/v1/"
+
+type leaseRequest struct {
+	Owner    string            `json:"owner"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Duration string            `json:"duration"`
+}
+
+type leaseResponse struct {
+	Lease  lease  `json:"lease"`
+	Runner runner `json:"runner"`
+}
+
+// server serves the api of the pool:
+//
+//	POST   /api/v1/heartbeat           registers and updates a runner, sent by the agents.
+//	GET    /api/v1/runners             lists the runners with their state.
+//	DELETE /api/v1/runners/<name>      removes a runner which isn't leased.
+//	POST   /api/v1/leases              leases a free runner matching the labels.
+//	POST   /api/v1/leases/<id>/renew   extends a lease.
+//	DELETE /api/v1/leases/<id>         releases a lease.
+//
+// Each request needs a scope of the token, see requiredScope.
+type server struct {
+	pool *pool
+	// auth authenticates the requests, all requests are allowed when nil.
+	auth *auth.Authenticator
+}
+
+// requiredScope returns the scope of a request, empty for unknown requests.
+func requiredScope(method string, path []string) string {
+	switch {
+	case method == http.MethodPost && len(path) == 1 && path[0] == "heartbeat":
+		return auth.ScopeAgent
+	case method == http.MethodGet && len(path) == 1 && path[0] == "runners":
+		return auth.ScopeRead
+	case method == http.MethodPost && len(path) == 1 && path[0] == "leases",
+		method == http.MethodPost && len(path) == 3 && path[0] == "leases" && path[2] == "renew":
+		return auth.ScopeTrigger
+	case method == http.MethodDelete && len(path) == 2 && (path[0] == "leases" || path[0] == "runners"):
+		return auth.ScopeTeardown
+	}
+	return ""
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	caller := "anonymous"
+	if s.auth != nil {
+		id, err := s.auth.Authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if scope := requiredScope(r.Method, path); scope != "" && !id.HasScope(scope) {
+			log.Printf("%v denied to %v without the %v scope", r.Method+" "+r.URL.Path, id.Name, scope)
+			http.Error(w, fmt.Sprintf("the %v scope is required", scope), http.StatusForbidden)
+			return
+		}
+		caller = id.Name
+	}
+
+	var (
+		resp interface{}
+		err  error
+	)
+	switch {
+	case r.Method == http.MethodPost && len(path) == 1 && path[0] == "heartbeat":
+		var hb heartbeat
+		if err = decodeRequest(r, &hb); err == nil {
+			resp, err = s.pool.heartbeat(hb)
+		}
+	case r.Method == http.MethodGet && len(path) == 1 && path[0] == "runners":
+		resp = s.pool.list()
+	case r.Method == http.MethodDelete && len(path) == 2 && path[0] == "runners":
+		if err = s.pool.deregister(path[1]); err == nil {
+			log.Printf("Runner %v removed by %v", path[1], caller)
+		}
+	case r.Method == http.MethodPost && len(path) == 1 && path[0] == "leases":
+		var req leaseRequest
+		if err = decodeRequest(r, &req); err == nil {
+			var d time.Duration
+			if d, err = time.ParseDuration(req.Duration); err == nil {
+				var lr leaseResponse
+				lr.Lease, lr.Runner, err = s.pool.acquire(req.Owner, req.Labels, d)
+				resp = lr
+			}
+		}
+	case r.Method == http.MethodPost && len(path) == 3 && path[0] == "leases" && path[2] == "renew":
+		var req leaseRequest
+		if err = decodeRequest(r, &req); err == nil {
+			var d time.Duration
+			if d, err = time.ParseDuration(req.Duration); err == nil {
+				resp, err = s.pool.renew(path[1], d)
+			}
+		}
+	case r.Method == http.MethodDelete && len(path) == 2 && path[0] == "leases":
+		if err = s.pool.release(path[1]); err == nil {
+			log.Printf("Lease %v released by %v", path[1], caller)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch err {
+	case nil:
+	case errNotFound, errNoneMatch:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errNoneFree:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp == nil {
+		resp = struct{}{}
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func decodeRequest(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.Wrap(err, "decoding the request")
+	}
+	return nil
+}
+
+// client calls the api of the pool.
+type client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func newClient(url, token string) *client {
+	return &client{url: strings.TrimSuffix(url, "/"), token: token, http: &http.Client{Timeout: time.Minute}}
+}
+
+// apiError is an error response of the api.
+type apiError struct {
+	status int
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%v: %v", http.StatusText(e.status), e.msg)
+}
+
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.url+apiPrefix+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &apiError{status: resp.StatusCode, msg: strings.TrimSpace(string(b))}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+func (c *client) heartbeat(hb heartbeat) (runner, error) {
+	var r runner
+	err := c.do(http.MethodPost, "heartbeat", hb, &r)
+	return r, err
+}
+
+func (c *client) runners() ([]runnerStatus, error) {
+	var list []runnerStatus
+	err := c.do(http.MethodGet, "runners", nil, &list)
+	return list, err
+}
+
+func (c *client) acquire(owner string, labels map[string]string, duration time.Duration) (leaseResponse, error) {
+	var lr leaseResponse
+	err := c.do(http.MethodPost, "leases", leaseRequest{Owner: owner, Labels: labels, Duration: duration.String()}, &lr)
+	return lr, err
+}
+
+func (c *client) renew(id string, duration time.Duration) (lease, error) {
+	var l lease
+	err := c.do(http.MethodPost, "leases/"+id+"/renew", leaseRequest{Duration: duration.String()}, &l)
+	return l, err
+}
+
+func (c *client) release(id string) error {
+	return c.do(http.MethodDelete, "leases/"+id, nil, nil)
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/test-infra/pkg/auth"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// signToken returns an RS256 ID token with the claims.
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	segment := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := segment(map[string]string{"alg": "RS256", "kid": kid}) + "." + segment(claims)
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	oidcSrv := httptest.NewServer(mux)
+	defer oidcSrv.Close()
+	issuer = oidcSrv.URL
+
+	dir, err := ioutil.TempDir("", "runnerPool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "ci-token"), []byte("ci-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "auth.yml")
+	if err := ioutil.WriteFile(configFile, []byte(`
+tokens:
+- name: dashboard
+  token: dashboard-secret
+  scopes: [read]
+- name: ci
+  token_file: `+filepath.Join(dir, "ci-token")+`
+  scopes: [read, trigger]
+oidc:
+  issuer: `+issuer+`
+  audience: runner-pool
+  scopes: [read]
+  groups:
+    benchmark-admins: [trigger, teardown]
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.New("agent-secret", configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newPool("", time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&server{pool: p, auth: authenticator})
+	defer srv.Close()
+	if _, err := newClient(srv.URL, "agent-secret").heartbeat(heartbeat{Name: "a", Address: "a:22", Healthy: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	admin := signToken(t, key, "key-1", map[string]interface{}{
+		"iss": issuer, "aud": "runner-pool", "exp": expiry, "email": "admin@example.com", "groups": []string{"benchmark-admins"},
+	})
+	employee := signToken(t, key, "key-1", map[string]interface{}{
+		"iss": issuer, "aud": []string{"runner-pool"}, "exp": expiry, "email": "employee@example.com",
+	})
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		status map[string]int
+	}{
+		{
+			name:   "no token",
+			status: map[string]int{auth.ScopeRead: http.StatusUnauthorized, auth.ScopeTrigger: http.StatusUnauthorized, auth.ScopeTeardown: http.StatusUnauthorized},
+		},
+		{
+			name:   "read-only token",
+			token:  "dashboard-secret",
+			status: map[string]int{auth.ScopeRead: http.StatusOK, auth.ScopeTrigger: http.StatusForbidden, auth.ScopeTeardown: http.StatusForbidden},
+		},
+		{
+			name:   "trigger token",
+			token:  "ci-secret",
+			status: map[string]int{auth.ScopeRead: http.StatusOK, auth.ScopeTrigger: http.StatusOK, auth.ScopeTeardown: http.StatusForbidden},
+		},
+		{
+			name:   "oidc identity",
+			token:  employee,
+			status: map[string]int{auth.ScopeRead: http.StatusOK, auth.ScopeTrigger: http.StatusForbidden, auth.ScopeTeardown: http.StatusForbidden},
+		},
+		{
+			name:   "oidc group",
+			token:  admin,
+			status: map[string]int{auth.ScopeRead: http.StatusOK, auth.ScopeTrigger: http.StatusOK, auth.ScopeTeardown: http.StatusOK},
+		},
+		{
+			name: "oidc wrong audience",
+			token: signToken(t, key, "key-1", map[string]interface{}{
+				"iss": issuer, "aud": "other", "exp": expiry, "groups": []string{"benchmark-admins"},
+			}),
+			status: map[string]int{auth.ScopeRead: http.StatusUnauthorized, auth.ScopeTrigger: http.StatusUnauthorized, auth.ScopeTeardown: http.StatusUnauthorized},
+		},
+		{
+			name: "oidc expired",
+			token: signToken(t, key, "key-1", map[string]interface{}{
+				"iss": issuer, "aud": "runner-pool", "exp": time.Now().Add(-time.Minute).Unix(), "groups": []string{"benchmark-admins"},
+			}),
+			status: map[string]int{auth.ScopeRead: http.StatusUnauthorized, auth.ScopeTrigger: http.StatusUnauthorized, auth.ScopeTeardown: http.StatusUnauthorized},
+		},
+		{
+			name: "oidc other audiences without authorized party",
+			token: signToken(t, key, "key-1", map[string]interface{}{
+				"iss": issuer, "aud": []string{"runner-pool", "other"}, "exp": expiry, "groups": []string{"benchmark-admins"},
+			}),
+			status: map[string]int{auth.ScopeRead: http.StatusUnauthorized, auth.ScopeTrigger: http.StatusUnauthorized, auth.ScopeTeardown: http.StatusUnauthorized},
+		},
+		{
+			name: "oidc other authorized party",
+			token: signToken(t, key, "key-1", map[string]interface{}{
+				"iss": issuer, "aud": []string{"runner-pool", "other"}, "azp": "other", "exp": expiry, "groups": []string{"benchmark-admins"},
+			}),
+			status: map[string]int{auth.ScopeRead: http.StatusUnauthorized, auth.ScopeTrigger: http.StatusUnauthorized, auth.ScopeTeardown: http.StatusUnauthorized},
+		},
+		{
+			name: "oidc authorized party",
+			token: signToken(t, key, "key-1", map[string]interface{}{
+				"iss": issuer, "aud": []string{"runner-pool", "other"}, "azp": "runner-pool", "exp": expiry, "email": "employee@example.com",
+			}),
+			status: map[string]int{auth.ScopeRead: http.StatusOK, auth.ScopeTrigger: http.StatusForbidden, auth.ScopeTeardown: http.StatusForbidden},
+		},
+		{
+			name: "oidc forged",
+			token: signToken(t, otherKey, "key-1", map[string]interface{}{
+				"iss": issuer, "aud": "runner-pool", "exp": expiry, "groups": []string{"benchmark-admins"},
+			}),
+			status: map[string]int{auth.ScopeRead: http.StatusUnauthorized, auth.ScopeTrigger: http.StatusUnauthorized, auth.ScopeTeardown: http.StatusUnauthorized},
+		},
+	} {
+		c := newClient(srv.URL, tc.token)
+		status := func(err error) int {
+			if err == nil {
+				return http.StatusOK
+			}
+			if e, ok := err.(*apiError); ok {
+				return e.status
+			}
+			t.Fatalf("%v: %v", tc.name, err)
+			return 0
+		}
+
+		_, err := c.runners()
+		if got := status(err); got != tc.status[auth.ScopeRead] {
+			t.Errorf("%v: expected status %v listing the runners, got %v", tc.name, tc.status[auth.ScopeRead], err)
+		}
+		lr, err := c.acquire("pr-1", nil, time.Hour)
+		if got := status(err); got != tc.status[auth.ScopeTrigger] {
+			t.Errorf("%v: expected status %v leasing a runner, got %v", tc.name, tc.status[auth.ScopeTrigger], err)
+		}
+		if err != nil {
+			// Release the lease of the free runner when the token can't lease one.
+			lr, err = newClient(srv.URL, "agent-secret").acquire("pr-1", nil, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = c.release(lr.Lease.ID)
+		if got := status(err); got != tc.status[auth.ScopeTeardown] {
+			t.Errorf("%v: expected status %v releasing a lease, got %v", tc.name, tc.status[auth.ScopeTeardown], err)
+		}
+		// Make the runner free again for the next case.
+		if err != nil {
+			if err := newClient(srv.URL, "agent-secret").release(lr.Lease.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := newClient(srv.URL, "agent-secret").heartbeat(heartbeat{Name: "a", Address: "a:22", Healthy: true, Reclaimed: lr.Lease.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/test-infra/pkg/auth"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// agent runs on a runner, reporting its health to the pool and cleaning it up after every lease.
+type agent struct {
+	client      *client
+	hb          heartbeat
+	healthCheck string
+	cleanup     string
+	interval    time.Duration
+}
+
+// sh runs the command with the shell, logging its output.
+func sh(command string) error {
+	out, err := exec.Command("sh", "-c", command).CombinedOutput()
+	if err != nil {
+		log.Printf("%v: %v\n%s", command, err, out)
+	}
+	return err
+}
+
+// beat sends a heartbeat and cleans up the runner when its last lease isn't reclaimed yet.
+func (a *agent) beat() error {
+	a.hb.Healthy = a.healthCheck == "" || sh(a.healthCheck) == nil
+	r, err := a.client.heartbeat(a.hb)
+	if err != nil {
+		return err
+	}
+	if r.Lease != nil || r.LastLease == "" || r.LastLease == r.Reclaimed {
+		return nil
+	}
+	log.Printf("Reclaiming the runner after lease %v", r.LastLease)
+	if a.cleanup != "" {
+		if err := sh(a.cleanup); err != nil {
+			// The runner stays out of the pool until the cleanup succeeds.
+			return fmt.Errorf("cleanup after lease %v: %v", r.LastLease, err)
+		}
+	}
+	a.hb.Reclaimed = r.LastLease
+	_, err = a.client.heartbeat(a.hb)
+	return err
+}
+
+func (a *agent) run() {
+	for {
+		if err := a.beat(); err != nil {
+			log.Printf("heartbeat: %v", err)
+		}
+		time.Sleep(a.interval)
+	}
+}
+
+func main() {
+	log.SetFlags(log.Ltime | log.Lshortfile)
+
+	app := kingpin.New(filepath.Base(os.Args[0]), `Manages a pool of dedicated machines to run the benchmarks on.
+	The runners register with the pool by running the agent, which reports their health and cleans them up after every run.
+	A benchmark leases a free runner for the time of the run, so that no other benchmark runs on it at the same time.`)
+	app.HelpFlag.Short('h')
+
+	var (
+		url   string
+		token string
+	)
+	app.Flag("token", "Token used to authenticate with the pool, read from the RUNNER_POOL_TOKEN env var when not set. The server gives it all the scopes and doesn't authenticate when it is empty without an --auth-config.").
+		Envar("RUNNER_POOL_TOKEN").
+		StringVar(&token)
+
+	var (
+		port             string
+		authConfig       string
+		stateFile        string
+		heartbeatTimeout time.Duration
+		forgetAfter      time.Duration
+	)
+	serveCmd := app.Command("serve", "Serve the api of the pool.")
+	serveCmd.Flag("port", "port number to serve the api on.").
+		Default("8080").
+		StringVar(&port)
+	serveCmd.Flag("auth-config", "File with the tokens allowed to use the api and their scopes, static tokens or the ID tokens of an OpenID Connect issuer. The --token has all the scopes.").
+		ExistingFileVar(&authConfig)
+	serveCmd.Flag("state-file", "File to keep the runners and leases in across restarts. The state is only kept in memory when empty.").
+		StringVar(&stateFile)
+	serveCmd.Flag("heartbeat-timeout", "Runners without a heartbeat for this long are unhealthy and aren't leased.").
+		Default("2m").
+		DurationVar(&heartbeatTimeout)
+	serveCmd.Flag("forget-after", "Runners without a heartbeat for this long are removed from the pool. 0 keeps them.").
+		Default("168h").
+		DurationVar(&forgetAfter)
+
+	a := agent{hb: heartbeat{Labels: map[string]string{}}}
+	agentCmd := app.Command("agent", "Run the agent on a runner, registering it with the pool.")
+	agentCmd.Flag("url", "url of the pool.").
+		Required().
+		StringVar(&url)
+	agentCmd.Flag("name", "Name of the runner, the hostname by default.").
+		StringVar(&a.hb.Name)
+	agentCmd.Flag("address", "Address to reach the runner, e.g. host:port for ssh.").
+		Required().
+		StringVar(&a.hb.Address)
+	agentCmd.Flag("label", "Label of the runner as name=value, to lease a runner with the given labels. Can be repeated.").
+		StringMapVar(&a.hb.Labels)
+	agentCmd.Flag("health-check", "Shell command checking the runner, which is unhealthy when the command fails.").
+		StringVar(&a.healthCheck)
+	agentCmd.Flag("cleanup", "Shell command cleaning up the runner after a lease. The runner is leased again once it succeeds.").
+		StringVar(&a.cleanup)
+	agentCmd.Flag("interval", "Interval between the heartbeats.").
+		Default("30s").
+		DurationVar(&a.interval)
+
+	var (
+		owner    string
+		labels   = map[string]string{}
+		duration time.Duration
+		wait     time.Duration
+	)
+	leaseCmd := app.Command("lease", `Lease a free runner, printing the lease as shell variables:
+	eval $(runnerPool lease --url=... --owner=pr-123) && ssh $RUNNER_ADDRESS ...`)
+	leaseCmd.Flag("url", "url of the pool.").
+		Required().
+		StringVar(&url)
+	leaseCmd.Flag("owner", "Owner of the lease, e.g. the benchmarked PR.").
+		Required().
+		StringVar(&owner)
+	leaseCmd.Flag("label", "Label as name=value which the runner must have. Can be repeated.").
+		StringMapVar(&labels)
+	leaseCmd.Flag("duration", "Duration of the lease, after which the runner is reclaimed when the lease isn't renewed or released.").
+		Default("2h").
+		DurationVar(&duration)
+	leaseCmd.Flag("wait", "How long to wait for a free runner.").
+		Default("0s").
+		DurationVar(&wait)
+
+	var leaseID string
+	renewCmd := app.Command("renew", "Extend a lease by the duration from now.")
+	renewCmd.Flag("url", "url of the pool.").
+		Required().
+		StringVar(&url)
+	renewCmd.Flag("duration", "Duration of the lease from now.").
+		Default("2h").
+		DurationVar(&duration)
+	renewCmd.Arg("lease", "ID of the lease.").
+		Required().
+		StringVar(&leaseID)
+
+	releaseCmd := app.Command("release", "Release a lease.")
+	releaseCmd.Flag("url", "url of the pool.").
+		Required().
+		StringVar(&url)
+	releaseCmd.Arg("lease", "ID of the lease.").
+		Required().
+		StringVar(&leaseID)
+
+	listCmd := app.Command("list", "List the runners of the pool.")
+	listCmd.Flag("url", "url of the pool.").
+		Required().
+		StringVar(&url)
+
+	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	c := newClient(url, token)
+
+	switch cmd {
+	case serveCmd.FullCommand():
+		p, err := newPool(stateFile, heartbeatTimeout, forgetAfter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		authenticator, err := auth.New(token, authConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			for range time.Tick(10 * time.Second) {
+				p.reclaim()
+			}
+		}()
+		mux := http.NewServeMux()
+		mux.Handle(apiPrefix, &server{pool: p, auth: authenticator})
+		log.Println("Server is ready to handle requests at", port)
+		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", port), mux))
+
+	case agentCmd.FullCommand():
+		if a.hb.Name == "" {
+			var err error
+			if a.hb.Name, err = os.Hostname(); err != nil {
+				log.Fatalf("getting the hostname: %v", err)
+			}
+		}
+		a.client = c
+		log.Printf("Running the agent of runner %v", a.hb.Name)
+		a.run()
+
+	case leaseCmd.FullCommand():
+		deadline := time.Now().Add(wait)
+		for {
+			lr, err := c.acquire(owner, labels, duration)
+			if e, ok := err.(*apiError); ok && e.status == http.StatusServiceUnavailable && time.Now().Before(deadline) {
+				log.Printf("Waiting for a free runner: %v", err)
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			if err != nil {
+				log.Fatalf("leasing a runner: %v", err)
+			}
+			fmt.Printf("LEASE_ID=%v\nRUNNER_NAME=%v\nRUNNER_ADDRESS=%v\n", lr.Lease.ID, lr.Runner.Name, lr.Runner.Address)
+			return
+		}
+
+	case renewCmd.FullCommand():
+		l, err := c.renew(leaseID, duration)
+		if err != nil {
+			log.Fatalf("renewing lease %v: %v", leaseID, err)
+		}
+		log.Printf("Lease %v expires at %v", l.ID, l.Expires)
+
+	case releaseCmd.FullCommand():
+		if err := c.release(leaseID); err != nil {
+			log.Fatalf("releasing lease %v: %v", leaseID, err)
+		}
+
+	case listCmd.FullCommand():
+		list, err := c.runners()
+		if err != nil {
+			log.Fatalf("listing the runners: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tADDRESS\tSTATE\tOWNER\tEXPIRES\tLAST SEEN")
+		for _, r := range list {
+			var owner, expires string
+			if r.Lease != nil {
+				owner, expires = r.Lease.Owner, r.Lease.Expires.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", r.Name, r.Address, r.State, owner, expires, r.LastSeen.Format(time.RFC3339))
+		}
+		w.Flush()
+	}
+}
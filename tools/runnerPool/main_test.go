@@ -0,0 +1,139 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/test-infra/pkg/auth"
+)
+
+func TestPool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runnerPool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	p, err := newPool(stateFile, time.Minute, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	authenticator, err := auth.New("secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&server{pool: p, auth: authenticator})
+	defer srv.Close()
+	c := newClient(srv.URL, "secret")
+
+	if _, err := newClient(srv.URL, "wrong").runners(); err == nil || err.(*apiError).status != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized error, got %v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := c.heartbeat(heartbeat{Name: name, Address: name + ":22", Labels: map[string]string{"arch": "amd64"}, Healthy: true}); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+	if _, err := c.acquire("pr-1", map[string]string{"arch": "arm64"}, time.Hour); err == nil || err.(*apiError).status != http.StatusNotFound {
+		t.Fatalf("expected no runner to match, got %v", err)
+	}
+
+	// The runner free the longest is leased first.
+	lr, err := c.acquire("pr-1", map[string]string{"arch": "amd64"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr.Runner.Name != "a" || lr.Lease.Owner != "pr-1" {
+		t.Fatalf("expected runner a leased by pr-1, got %+v", lr)
+	}
+	lr2, err := c.acquire("pr-2", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr2.Runner.Name != "b" {
+		t.Fatalf("expected runner b, got %v", lr2.Runner.Name)
+	}
+	if _, err := c.acquire("pr-3", nil, time.Hour); err == nil || err.(*apiError).status != http.StatusServiceUnavailable {
+		t.Fatalf("expected no free runner, got %v", err)
+	}
+
+	// A released runner isn't leased again until its agent reclaimed it.
+	if err := c.release(lr.Lease.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.release(lr.Lease.ID); err == nil {
+		t.Fatal("expected an error releasing a released lease")
+	}
+	if _, err := c.acquire("pr-3", nil, time.Hour); err == nil {
+		t.Fatal("expected the released runner to be reclaimed first")
+	}
+	a := &agent{client: c, hb: heartbeat{Name: "a", Address: "a:22", Labels: map[string]string{"arch": "amd64"}}, cleanup: "true"}
+	if err := a.beat(); err != nil {
+		t.Fatal(err)
+	}
+	if a.hb.Reclaimed != lr.Lease.ID {
+		t.Fatalf("expected the agent to reclaim lease %v, got %q", lr.Lease.ID, a.hb.Reclaimed)
+	}
+	lr3, err := c.acquire("pr-3", nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr3.Runner.Name != "a" {
+		t.Fatalf("expected runner a, got %v", lr3.Runner.Name)
+	}
+
+	// Renewed leases are kept, the others expire.
+	now = now.Add(50 * time.Minute)
+	if _, err := c.renew(lr2.Lease.ID, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(20 * time.Minute)
+	p.reclaim()
+
+	// The state is kept across restarts.
+	p, err = newPool(stateFile, time.Minute, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.now = func() time.Time { return now }
+	states := map[string]string{}
+	for _, r := range p.list() {
+		states[r.Name] = r.State
+	}
+	// The heartbeats are older than the timeout.
+	expected := map[string]string{"a": stateUnhealthy, "b": stateLeased}
+	if len(states) != len(expected) || states["a"] != expected["a"] || states["b"] != expected["b"] {
+		t.Fatalf("expected %v, got %v", expected, states)
+	}
+
+	// Runners not seen for long are forgotten once they aren't leased.
+	now = now.Add(3 * time.Hour)
+	p.reclaim()
+	if list := p.list(); len(list) != 0 {
+		t.Fatalf("expected all runners to be forgotten, got %v", list)
+	}
+}
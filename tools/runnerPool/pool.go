@@ -0,0 +1,343 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// runner is a machine of the pool running the agent.
+type runner struct {
+	Name string `json:"name"`
+	// Address to reach the runner, e.g. host:port for ssh.
+	Address string            `json:"address"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// Healthy is the result of the last health check of the agent.
+	Healthy  bool      `json:"healthy"`
+	LastSeen time.Time `json:"last_seen"`
+
+	Lease *lease `json:"lease,omitempty"`
+	// LastLease is the ID of the last released lease, which the agent reclaims by cleaning up the runner.
+	// The runner isn't leased again until Reclaimed is LastLease.
+	LastLease string    `json:"last_lease,omitempty"`
+	Reclaimed string    `json:"reclaimed,omitempty"`
+	FreeSince time.Time `json:"free_since"`
+}
+
+// lease gives a run the exclusive use of a runner until it expires or is released.
+type lease struct {
+	ID     string `json:"id"`
+	Runner string `json:"runner"`
+	// Owner is the run using the runner, e.g. the benchmarked PR.
+	Owner   string    `json:"owner"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// State of a runner, derived from its fields.
+const (
+	stateLeased     = "leased"
+	stateReclaiming = "reclaiming"
+	stateUnhealthy  = "unhealthy"
+	stateFree       = "free"
+)
+
+func (r *runner) state(now time.Time, heartbeatTimeout time.Duration) string {
+	switch {
+	case r.Lease != nil:
+		return stateLeased
+	case !r.Healthy || now.Sub(r.LastSeen) > heartbeatTimeout:
+		return stateUnhealthy
+	case r.LastLease != r.Reclaimed:
+		return stateReclaiming
+	}
+	return stateFree
+}
+
+func (r *runner) matches(labels map[string]string) bool {
+	for k, v := range labels {
+		if r.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// pool keeps the runners and their leases, saved to the state file after every change.
+type pool struct {
+	mtx     sync.Mutex
+	runners map[string]*runner
+
+	stateFile        string
+	heartbeatTimeout time.Duration
+	// Runners not seen for forgetAfter are removed from the pool.
+	forgetAfter time.Duration
+	now         func() time.Time
+}
+
+func newPool(stateFile string, heartbeatTimeout, forgetAfter time.Duration) (*pool, error) {
+	p := &pool{
+		runners:          map[string]*runner{},
+		stateFile:        stateFile,
+		heartbeatTimeout: heartbeatTimeout,
+		forgetAfter:      forgetAfter,
+		now:              time.Now,
+	}
+	if stateFile == "" {
+		return p, nil
+	}
+	b, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the state file")
+	}
+	if err := json.Unmarshal(b, &p.runners); err != nil {
+		return nil, errors.Wrapf(err, "parsing the state file %v", stateFile)
+	}
+	return p, nil
+}
+
+// save writes the state file, the caller holds the lock.
+func (p *pool) save() {
+	if p.stateFile == "" {
+		return
+	}
+	b, err := json.MarshalIndent(p.runners, "", "  ")
+	if err != nil {
+		log.Printf("saving the state: %v", err)
+		return
+	}
+	// Write to a temporary file first so that a crash doesn't leave a partial state.
+	tmp := p.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		log.Printf("saving the state: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, p.stateFile); err != nil {
+		log.Printf("saving the state: %v", err)
+	}
+}
+
+// heartbeat is sent by the agent of a runner, registering it when it is new.
+type heartbeat struct {
+	Name      string            `json:"name"`
+	Address   string            `json:"address"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Healthy   bool              `json:"healthy"`
+	Reclaimed string            `json:"reclaimed,omitempty"`
+}
+
+// heartbeat updates the runner and returns it.
+func (p *pool) heartbeat(hb heartbeat) (runner, error) {
+	if hb.Name == "" || hb.Address == "" {
+		return runner{}, fmt.Errorf("the name and the address of the runner are required")
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	r, ok := p.runners[hb.Name]
+	if !ok {
+		log.Printf("Registered runner %v at %v", hb.Name, hb.Address)
+		r = &runner{Name: hb.Name, FreeSince: now}
+		p.runners[hb.Name] = r
+	}
+	if r.Healthy != hb.Healthy {
+		log.Printf("Runner %v healthy: %v", hb.Name, hb.Healthy)
+	}
+	r.Address, r.Labels, r.Healthy, r.LastSeen = hb.Address, hb.Labels, hb.Healthy, now
+	if hb.Reclaimed != "" && hb.Reclaimed == r.LastLease && r.Reclaimed != r.LastLease {
+		log.Printf("Runner %v is reclaimed after lease %v", r.Name, r.LastLease)
+		r.Reclaimed = hb.Reclaimed
+		r.FreeSince = now
+	}
+	p.save()
+	return *r, nil
+}
+
+// deregister removes a runner which isn't leased.
+func (p *pool) deregister(name string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	r, ok := p.runners[name]
+	if !ok {
+		return errNotFound
+	}
+	if r.Lease != nil {
+		return fmt.Errorf("runner %v is leased by %v until %v", name, r.Lease.Owner, r.Lease.Expires)
+	}
+	delete(p.runners, name)
+	p.save()
+	log.Printf("Deregistered runner %v", name)
+	return nil
+}
+
+var (
+	errNotFound  = errors.New("not found")
+	errNoneFree  = errors.New("no free runner matches the labels")
+	errNoneMatch = errors.New("no runner of the pool matches the labels")
+)
+
+// acquire leases the free runner matching the labels which has been free the longest,
+// so that the runners are used evenly and had time to settle since their last run.
+func (p *pool) acquire(owner string, labels map[string]string, duration time.Duration) (lease, runner, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	var free []*runner
+	matched := false
+	for _, r := range p.runners {
+		if !r.matches(labels) {
+			continue
+		}
+		matched = true
+		if r.state(now, p.heartbeatTimeout) == stateFree {
+			free = append(free, r)
+		}
+	}
+	if !matched {
+		return lease{}, runner{}, errNoneMatch
+	}
+	if len(free) == 0 {
+		return lease{}, runner{}, errNoneFree
+	}
+	sort.Slice(free, func(i, j int) bool {
+		if !free[i].FreeSince.Equal(free[j].FreeSince) {
+			return free[i].FreeSince.Before(free[j].FreeSince)
+		}
+		return free[i].Name < free[j].Name
+	})
+
+	r := free[0]
+	r.Lease = &lease{
+		ID:      newID(),
+		Runner:  r.Name,
+		Owner:   owner,
+		Created: now,
+		Expires: now.Add(duration),
+	}
+	p.save()
+	log.Printf("Leased runner %v to %v until %v", r.Name, owner, r.Lease.Expires)
+	return *r.Lease, *r, nil
+}
+
+// findLease returns the runner with the lease, the caller holds the lock.
+func (p *pool) findLease(id string) (*runner, error) {
+	for _, r := range p.runners {
+		if r.Lease != nil && r.Lease.ID == id {
+			return r, nil
+		}
+	}
+	return nil, errNotFound
+}
+
+// renew extends the lease by the duration from now.
+func (p *pool) renew(id string, duration time.Duration) (lease, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	r, err := p.findLease(id)
+	if err != nil {
+		return lease{}, err
+	}
+	r.Lease.Expires = p.now().Add(duration)
+	p.save()
+	return *r.Lease, nil
+}
+
+// release ends the lease, the runner is leased again once its agent reclaimed it.
+func (p *pool) release(id string) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	r, err := p.findLease(id)
+	if err != nil {
+		return err
+	}
+	p.releaseRunner(r, "released")
+	p.save()
+	return nil
+}
+
+// releaseRunner ends the lease of the runner, the caller holds the lock.
+func (p *pool) releaseRunner(r *runner, reason string) {
+	log.Printf("Lease %v of runner %v by %v %v", r.Lease.ID, r.Name, r.Lease.Owner, reason)
+	r.LastLease = r.Lease.ID
+	r.Lease = nil
+}
+
+// reclaim ends the expired leases and forgets the runners not seen for a long time.
+func (p *pool) reclaim() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	changed := false
+	for name, r := range p.runners {
+		if r.Lease != nil && now.After(r.Lease.Expires) {
+			p.releaseRunner(r, "expired")
+			changed = true
+		}
+		if r.Lease == nil && p.forgetAfter > 0 && now.Sub(r.LastSeen) > p.forgetAfter {
+			log.Printf("Forgetting runner %v, last seen %v", name, r.LastSeen)
+			delete(p.runners, name)
+			changed = true
+		}
+	}
+	if changed {
+		p.save()
+	}
+}
+
+// runnerStatus is a runner with its state.
+type runnerStatus struct {
+	runner
+	State string `json:"state"`
+}
+
+func (p *pool) list() []runnerStatus {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	list := make([]runnerStatus, 0, len(p.runners))
+	for _, r := range p.runners {
+		list = append(list, runnerStatus{runner: *r, State: r.state(now, p.heartbeatTimeout)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
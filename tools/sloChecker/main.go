@@ -0,0 +1,128 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/api"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"golang.org/x/oauth2"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type sloCheckerConfig struct {
+	prometheusURL string
+	files         []string
+	vars          map[string]string
+	org           string
+	repo          string
+	pr            int
+	checkName     string
+}
+
+func main() {
+	log.SetFlags(log.Ltime | log.Lshortfile)
+	cfg := sloCheckerConfig{vars: map[string]string{}}
+
+	app := kingpin.New(filepath.Base(os.Args[0]), `Evaluates the SLOs of a benchmark and reports the result as a GitHub check run
+	Example: ./sloChecker --prometheus-url=http://prombench.prometheus.io/prometheus-meta -f slo.yaml -v PR_NUMBER:123 -v RELEASE:master --org=prometheus --repo=prometheus --pr=123
+
+	Note: The check run is created only when the GITHUB_TOKEN env variable is set.
+	Creating check runs requires a GitHub App installation token.
+	`)
+	app.Flag("prometheus-url", "URL of the Prometheus server that monitors the benchmark.").Required().StringVar(&cfg.prometheusURL)
+	app.Flag("file", "SLO file or folder.").Required().Short('f').ExistingFilesOrDirsVar(&cfg.files)
+	app.Flag("vars", "When provided it will substitute the token holders in the SLO files. Follows the standard golang template formating - {{ .PR_NUMBER }}.").Short('v').StringMapVar(&cfg.vars)
+	app.Flag("org", "name of the org").StringVar(&cfg.org)
+	app.Flag("repo", "name of the repo").StringVar(&cfg.repo)
+	app.Flag("pr", "number of the benchmarked PR").IntVar(&cfg.pr)
+	app.Flag("name", "name of the check run").Default("prombench SLOs").StringVar(&cfg.checkName)
+
+	kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	passed, err := run(context.Background(), cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+// run evaluates the SLOs and returns whether all of them passed.
+func run(ctx context.Context, cfg sloCheckerConfig) (bool, error) {
+	slos, err := loadSLOs(cfg.files, cfg.vars)
+	if err != nil {
+		return false, err
+	}
+
+	clt, err := api.NewClient(api.Config{Address: cfg.prometheusURL})
+	if err != nil {
+		return false, errors.Wrap(err, "creating the Prometheus client")
+	}
+	results := evaluate(ctx, v1.NewAPI(clt), slos, time.Now())
+
+	summary := report(results)
+	concl := conclusion(results)
+	fmt.Println(summary)
+
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		if err := createCheckRun(ctx, cfg, token, concl, summary); err != nil {
+			return false, err
+		}
+	}
+	return concl != "failure", nil
+}
+
+// createCheckRun creates a completed check run on the head commit of the PR.
+func createCheckRun(ctx context.Context, cfg sloCheckerConfig, token, concl, summary string) error {
+	if cfg.org == "" || cfg.repo == "" || cfg.pr == 0 {
+		return fmt.Errorf("the org, repo and pr flags are required for the check run")
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	clt := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	pr, _, err := clt.PullRequests.Get(ctx, cfg.org, cfg.repo, cfg.pr)
+	if err != nil {
+		return errors.Wrapf(err, "getting PR #%d", cfg.pr)
+	}
+
+	title := "All SLOs passed"
+	switch concl {
+	case "failure":
+		title = "Some SLOs failed"
+	case "neutral":
+		title = "Some SLOs couldn't be evaluated"
+	}
+	_, _, err = clt.Checks.CreateCheckRun(ctx, cfg.org, cfg.repo, github.CreateCheckRunOptions{
+		Name:        cfg.checkName,
+		HeadSHA:     pr.GetHead().GetSHA(),
+		Status:      github.String("completed"),
+		Conclusion:  github.String(concl),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:   github.String(title),
+			Summary: github.String(summary),
+		},
+	})
+	return errors.Wrap(err, "creating the check run")
+}
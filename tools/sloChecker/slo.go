@@ -0,0 +1,211 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/test-infra/pkg/provider"
+	"gopkg.in/yaml.v2"
+)
+
+// slo is a service level objective of a benchmark scenario.
+type slo struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// Expr is a PromQL expression that returns series when the objective is violated,
+	// the same way an alerting rule fires.
+	Expr string `yaml:"expr,omitempty"`
+	// Values are PromQL expressions returning a single sample, named to be used in the Verdict.
+	Values map[string]string `yaml:"values,omitempty"`
+	// Verdict is a Go expression over the Values which is true when the objective is met.
+	// It is used instead of the Expr for the rules that can't be written as a single query.
+	Verdict string `yaml:"verdict,omitempty"`
+
+	verdict *verdict
+}
+
+type sloFile struct {
+	SLOs []slo `yaml:"slos"`
+}
+
+// sloResult is the outcome of evaluating an slo.
+type sloResult struct {
+	slo
+	// Violations are the series returned by the expression.
+	Violations []string
+	Err        error
+}
+
+func (r sloResult) passed() bool {
+	return r.Err == nil && len(r.Violations) == 0
+}
+
+// loadSLOs parses the slo files after replacing the template variables.
+func loadSLOs(files []string, vars map[string]string) ([]slo, error) {
+	resources, err := provider.DeploymentsParse(files, vars)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse the slo files")
+	}
+
+	var slos []slo
+	for _, r := range resources {
+		f := &sloFile{}
+		if err := yaml.UnmarshalStrict(r.Content, f); err != nil {
+			return nil, errors.Wrapf(err, "parsing the slo file %s", r.FileName)
+		}
+		for i, s := range f.SLOs {
+			if s.Name == "" || (s.Expr == "") == (s.Verdict == "") {
+				return nil, fmt.Errorf("slo without a name or without exactly one of an expression and a verdict in file %s", r.FileName)
+			}
+			if s.Verdict == "" {
+				continue
+			}
+			if len(s.Values) == 0 {
+				return nil, fmt.Errorf("slo %s in file %s has a verdict without values", s.Name, r.FileName)
+			}
+			if f.SLOs[i].verdict, err = parseVerdict(s.Verdict, s.Values); err != nil {
+				return nil, errors.Wrapf(err, "slo %s in file %s", s.Name, r.FileName)
+			}
+		}
+		slos = append(slos, f.SLOs...)
+	}
+	return slos, nil
+}
+
+// evaluate runs the expression of every slo as an instant query at the given time.
+func evaluate(ctx context.Context, api v1.API, slos []slo, ts time.Time) []sloResult {
+	results := make([]sloResult, 0, len(slos))
+	for _, s := range slos {
+		r := sloResult{slo: s}
+		if s.verdict != nil {
+			r.Violations, r.Err = evaluateVerdict(ctx, api, s, ts)
+			results = append(results, r)
+			continue
+		}
+		val, _, err := api.Query(ctx, s.Expr, ts)
+		if err != nil {
+			r.Err = errors.Wrap(err, "query failed")
+			results = append(results, r)
+			continue
+		}
+		vector, ok := val.(model.Vector)
+		if !ok {
+			r.Err = fmt.Errorf("expected an instant vector, got %s", val.Type())
+			results = append(results, r)
+			continue
+		}
+		for _, sample := range vector {
+			r.Violations = append(r.Violations, fmt.Sprintf("%s => %s", sample.Metric, sample.Value))
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// evaluateVerdict queries the values of the slo and returns them as the violations when the verdict is false.
+func evaluateVerdict(ctx context.Context, api v1.API, s slo, ts time.Time) ([]string, error) {
+	names := make([]string, 0, len(s.Values))
+	for name := range s.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := map[string]float64{}
+	for _, name := range names {
+		val, _, err := api.Query(ctx, s.Values[name], ts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query of %s failed", name)
+		}
+		switch v := val.(type) {
+		case *model.Scalar:
+			values[name] = float64(v.Value)
+		case model.Vector:
+			if len(v) != 1 {
+				return nil, fmt.Errorf("expected a single sample for %s, got %d", name, len(v))
+			}
+			values[name] = float64(v[0].Value)
+		default:
+			return nil, fmt.Errorf("expected a scalar or an instant vector for %s, got %s", name, val.Type())
+		}
+	}
+
+	ok, err := s.verdict.eval(values)
+	if err != nil || ok {
+		return nil, err
+	}
+	violations := []string{fmt.Sprintf("%s is false", s.Verdict)}
+	for _, name := range names {
+		violations = append(violations, fmt.Sprintf("%s = %v", name, values[name]))
+	}
+	return violations, nil
+}
+
+// conclusion returns the check run conclusion for the results.
+// Failed objectives take precedence over the ones that couldn't be evaluated.
+func conclusion(results []sloResult) string {
+	c := "success"
+	for _, r := range results {
+		if r.Err != nil {
+			c = "neutral"
+			continue
+		}
+		if !r.passed() {
+			return "failure"
+		}
+	}
+	return c
+}
+
+// report returns a markdown summary of the results.
+func report(results []sloResult) string {
+	var b strings.Builder
+	b.WriteString("| SLO | Result |\n| --- | --- |\n")
+	for _, r := range results {
+		status := "passed"
+		switch {
+		case r.Err != nil:
+			status = "error"
+		case !r.passed():
+			status = "failed"
+		}
+		fmt.Fprintf(&b, "| %s | %s |\n", r.Name, status)
+	}
+
+	for _, r := range results {
+		if r.passed() {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n", r.Name)
+		if r.Description != "" {
+			fmt.Fprintf(&b, "%s\n", r.Description)
+		}
+		b.WriteString("```\n")
+		if r.Err != nil {
+			fmt.Fprintf(&b, "%v\n", r.Err)
+		}
+		for _, v := range r.Violations {
+			fmt.Fprintf(&b, "%s\n", v)
+		}
+		b.WriteString("```\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoadSLOs(t *testing.T) {
+	slos, err := loadSLOs([]string{"../../prombench/manifests/prombench/slo.yaml"}, map[string]string{"PR_NUMBER": "123", "RELEASE": "v2.20.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slos) != 4 {
+		t.Fatalf("expected 4 slos, got %d", len(slos))
+	}
+	if !strings.Contains(slos[0].Expr, `namespace="prombench-123"`) {
+		t.Errorf("template variables not replaced in:\n%s", slos[0].Expr)
+	}
+	if slos[3].verdict == nil || !strings.Contains(slos[3].Values["release"], `prometheus="test-v2-20-0"`) {
+		t.Errorf("verdict not parsed or template variables not replaced in:\n%v", slos[3].Values)
+	}
+}
+
+func TestConclusion(t *testing.T) {
+	passed := sloResult{slo: slo{Name: "passed"}}
+	failed := sloResult{slo: slo{Name: "failed"}, Violations: []string{`{} => 1`}}
+	errored := sloResult{slo: slo{Name: "errored"}, Err: errors.New("query failed")}
+
+	testCases := []struct {
+		results  []sloResult
+		expected string
+	}{
+		{results: []sloResult{passed}, expected: "success"},
+		{results: []sloResult{passed, errored}, expected: "neutral"},
+		{results: []sloResult{errored, failed, passed}, expected: "failure"},
+	}
+	for _, tc := range testCases {
+		if got := conclusion(tc.results); got != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, got)
+		}
+	}
+
+	r := report([]sloResult{passed, failed})
+	if !strings.Contains(r, "| failed | failed |") || !strings.Contains(r, "{} => 1") {
+		t.Errorf("unexpected report:\n%s", r)
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	values := map[string]string{"pr": "", "release": ""}
+	testCases := []struct {
+		verdict  string
+		values   map[string]float64
+		expected bool
+		invalid  bool
+	}{
+		{verdict: "pr <= 1.1 * release", values: map[string]float64{"pr": 1.05, "release": 1}, expected: true},
+		{verdict: "pr <= 1.1 * release", values: map[string]float64{"pr": 1.2, "release": 1}, expected: false},
+		{verdict: "abs(pr-release)/release < 0.1 && pr > 0", values: map[string]float64{"pr": 0.95, "release": 1}, expected: true},
+		{verdict: "!(pr > max(release, 2)) || false", values: map[string]float64{"pr": 3, "release": 1}, expected: false},
+		{verdict: "-pr == min(-1, -release)", values: map[string]float64{"pr": 1, "release": 0.5}, expected: true},
+		{verdict: "(pr > release) == (release > 0)", values: map[string]float64{"pr": 2, "release": 1}, expected: true},
+		{verdict: "(pr > release) != true", values: map[string]float64{"pr": 2, "release": 1}, expected: false},
+		// The right operand isn't evaluated, so the value missing from the results isn't an error.
+		{verdict: "pr > 0 || release > 0", values: map[string]float64{"pr": 1}, expected: true},
+		{verdict: "pr < 0 && release > 0", values: map[string]float64{"pr": 1}, expected: false},
+		{verdict: "pr <", invalid: true},
+		{verdict: "pr == true", invalid: true},
+		{verdict: "true || pr < other", invalid: true},
+		{verdict: "pr + release", invalid: true},
+		{verdict: "pr < other", invalid: true},
+		{verdict: "pr < median(release)", invalid: true},
+		{verdict: `pr < "1"`, invalid: true},
+		{verdict: "pr && release", invalid: true},
+		{verdict: "pr.p99 < 1", invalid: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.verdict, func(t *testing.T) {
+			v, err := parseVerdict(tc.verdict, values)
+			if tc.invalid {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := v.eval(tc.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
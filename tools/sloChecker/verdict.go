@@ -0,0 +1,248 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"strconv"
+)
+
+// verdict is a Go expression over the values of an slo, true when the objective is met.
+// It supports numbers, the names of the values, true and false, parentheses,
+// the arithmetic, comparison and logical operators and the functions in verdictFuncs.
+// && and || short-circuit like in Go, == and != compare two numbers or two booleans.
+type verdict struct {
+	expr ast.Expr
+}
+
+// verdictFuncs are the functions a verdict can call.
+var verdictFuncs = map[string]func(args ...float64) (float64, error){
+	"abs": func(args ...float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("abs expects 1 argument, got %d", len(args))
+		}
+		return math.Abs(args[0]), nil
+	},
+	"min": func(args ...float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("min expects at least 1 argument")
+		}
+		m := args[0]
+		for _, a := range args[1:] {
+			m = math.Min(m, a)
+		}
+		return m, nil
+	},
+	"max": func(args ...float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, fmt.Errorf("max expects at least 1 argument")
+		}
+		m := args[0]
+		for _, a := range args[1:] {
+			m = math.Max(m, a)
+		}
+		return m, nil
+	},
+}
+
+// parseVerdict parses the expression and checks that it only uses the given value names.
+func parseVerdict(s string, names map[string]string) (*verdict, error) {
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing verdict %q: %v", s, err)
+	}
+	v := &verdict{expr: expr}
+	// Evaluating every operand with all values set to 1 reports the unsupported syntax,
+	// unknown names and mismatched types before any query runs.
+	values := map[string]float64{}
+	for name := range names {
+		values[name] = 1
+	}
+	if _, err := v.evalAll(values, false); err != nil {
+		return nil, fmt.Errorf("verdict %q: %v", s, err)
+	}
+	return v, nil
+}
+
+// eval returns whether the objective is met with the values.
+func (v *verdict) eval(values map[string]float64) (bool, error) {
+	return v.evalAll(values, true)
+}
+
+// evalAll evaluates the verdict, skipping the operands of && and || which don't change the result when shortCircuit is set.
+func (v *verdict) evalAll(values map[string]float64, shortCircuit bool) (bool, error) {
+	r, err := evalExpr(v.expr, values, shortCircuit)
+	if err != nil {
+		return false, err
+	}
+	b, ok := r.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean result, got %v", r)
+	}
+	return b, nil
+}
+
+// evalExpr returns the float64 or bool value of the expression.
+func evalExpr(e ast.Expr, values map[string]float64, shortCircuit bool) (interface{}, error) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return evalExpr(e.X, values, shortCircuit)
+
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return nil, fmt.Errorf("unsupported literal %v", e.Value)
+		}
+		return strconv.ParseFloat(e.Value, 64)
+
+	case *ast.Ident:
+		switch e.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if v, ok := values[e.Name]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("unknown value %v", e.Name)
+
+	case *ast.CallExpr:
+		name, ok := e.Fun.(*ast.Ident)
+		if !ok || verdictFuncs[name.Name] == nil {
+			return nil, fmt.Errorf("unknown function %v", types.ExprString(e.Fun))
+		}
+		args := make([]float64, 0, len(e.Args))
+		for _, a := range e.Args {
+			f, err := evalNumber(a, values, shortCircuit)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, f)
+		}
+		return verdictFuncs[name.Name](args...)
+
+	case *ast.UnaryExpr:
+		switch e.Op {
+		case token.SUB, token.ADD:
+			x, err := evalNumber(e.X, values, shortCircuit)
+			if err != nil {
+				return nil, err
+			}
+			if e.Op == token.SUB {
+				return -x, nil
+			}
+			return x, nil
+		case token.NOT:
+			x, err := evalBool(e.X, values, shortCircuit)
+			return !x, err
+		}
+
+	case *ast.BinaryExpr:
+		switch e.Op {
+		case token.LAND, token.LOR:
+			x, err := evalBool(e.X, values, shortCircuit)
+			if err != nil {
+				return nil, err
+			}
+			// x decides the result when it is false for && and true for ||.
+			if shortCircuit && x == (e.Op == token.LOR) {
+				return x, nil
+			}
+			y, err := evalBool(e.Y, values, shortCircuit)
+			if err != nil {
+				return nil, err
+			}
+			if e.Op == token.LAND {
+				return x && y, nil
+			}
+			return x || y, nil
+
+		case token.EQL, token.NEQ:
+			x, err := evalExpr(e.X, values, shortCircuit)
+			if err != nil {
+				return nil, err
+			}
+			y, err := evalExpr(e.Y, values, shortCircuit)
+			if err != nil {
+				return nil, err
+			}
+			if isBool(x) != isBool(y) {
+				return nil, fmt.Errorf("mismatched types comparing %v and %v in %v", x, y, types.ExprString(e))
+			}
+			return (x == y) == (e.Op == token.EQL), nil
+		}
+
+		x, err := evalNumber(e.X, values, shortCircuit)
+		if err != nil {
+			return nil, err
+		}
+		y, err := evalNumber(e.Y, values, shortCircuit)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			return x / y, nil
+		case token.LSS:
+			return x < y, nil
+		case token.LEQ:
+			return x <= y, nil
+		case token.GTR:
+			return x > y, nil
+		case token.GEQ:
+			return x >= y, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported expression %v", types.ExprString(e))
+}
+
+func evalNumber(e ast.Expr, values map[string]float64, shortCircuit bool) (float64, error) {
+	r, err := evalExpr(e, values, shortCircuit)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := r.(float64)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %v in %v", r, types.ExprString(e))
+	}
+	return f, nil
+}
+
+func evalBool(e ast.Expr, values map[string]float64, shortCircuit bool) (bool, error) {
+	r, err := evalExpr(e, values, shortCircuit)
+	if err != nil {
+		return false, err
+	}
+	b, ok := r.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %v in %v", r, types.ExprString(e))
+	}
+	return b, nil
+}
+
+func isBool(r interface{}) bool {
+	_, ok := r.(bool)
+	return ok
+}